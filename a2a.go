@@ -221,6 +221,7 @@ func handleAgentCard(w http.ResponseWriter, r *http.Request) {
 			},
 		},
 	}
+	localizeAgentCard(&agentCard, localizer(w, r))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(agentCard)
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+)
+
+var errABIShort = errors.New("calldata too short")
+
+// abiData reads ABI-encoded arguments, without the selector
+type abiData []byte
+
+func (d abiData) word(i int) ([]byte, error) {
+	if i < 0 || (i+1)*32 > len(d) {
+		return nil, errABIShort
+	}
+	return d[i*32 : (i+1)*32], nil
+}
+
+func (d abiData) uint(i int) (*big.Int, error) {
+	w, err := d.word(i)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(w), nil
+}
+
+func (d abiData) address(i int) (string, error) {
+	w, err := d.word(i)
+	if err != nil {
+		return "", err
+	}
+	return address.Checksum("0x" + hex.EncodeToString(w[12:])), nil
+}
+
+// bytes reads the dynamic bytes argument whose offset is in word i
+func (d abiData) bytes(i int) ([]byte, error) {
+	offset, err := d.uint(i)
+	if err != nil {
+		return nil, err
+	}
+	if !offset.IsInt64() || offset.Int64()%32 != 0 || offset.Int64() > int64(len(d)) {
+		return nil, errABIShort
+	}
+	tail := d[offset.Int64():]
+	length, err := tail.uint(0)
+	if err != nil {
+		return nil, err
+	}
+	if !length.IsInt64() || 32+length.Int64() > int64(len(tail)) {
+		return nil, errABIShort
+	}
+	return tail[32 : 32+length.Int64()], nil
+}
+
+// decodeCalldata splits 0x-hex calldata into its selector and arguments
+func decodeCalldata(data string) (string, abiData, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(data, "0x"), "0X"))
+	if err != nil {
+		return "", nil, fmt.Errorf("calldata is not hex")
+	}
+	if len(raw) < 4 {
+		return "", nil, errABIShort
+	}
+	return hex.EncodeToString(raw[:4]), abiData(raw[4:]), nil
+}
+
+// array reads the dynamic array of static elements whose offset is in
+// word i, returning one word per element
+func (d abiData) array(i int) ([]abiData, error) {
+	offset, err := d.uint(i)
+	if err != nil {
+		return nil, err
+	}
+	if !offset.IsInt64() || offset.Int64() > int64(len(d)) {
+		return nil, errABIShort
+	}
+	tail := d[offset.Int64():]
+	length, err := tail.uint(0)
+	if err != nil {
+		return nil, err
+	}
+	if !length.IsInt64() || (1+length.Int64())*32 > int64(len(tail)) {
+		return nil, errABIShort
+	}
+	out := make([]abiData, length.Int64())
+	for j := range out {
+		out[j] = tail[32*(j+1) : 32*(j+2)]
+	}
+	return out, nil
+}
+
+// addresses reads the address[] whose offset is in word i
+func (d abiData) addresses(i int) ([]string, error) {
+	words, err := d.array(i)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(words))
+	for j, w := range words {
+		out[j], _ = w.address(0)
+	}
+	return out, nil
+}
+
+// uints reads the uint256[] whose offset is in word i
+func (d abiData) uints(i int) ([]*big.Int, error) {
+	words, err := d.array(i)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*big.Int, len(words))
+	for j, w := range words {
+		out[j], _ = w.uint(0)
+	}
+	return out, nil
+}
+
+// encodeUintAddresses encodes a call taking (uint256, address[]), such as
+// a V2 router's getAmountsOut
+func encodeUintAddresses(selector string, v *big.Int, addrs []string) string {
+	var b strings.Builder
+	b.WriteString("0x" + selector)
+	word := func(v *big.Int) { fmt.Fprintf(&b, "%064x", v) }
+	word(v)
+	word(big.NewInt(64))
+	word(big.NewInt(int64(len(addrs))))
+	for _, a := range addrs {
+		digits := strings.ToLower(strings.TrimPrefix(a, "0x"))
+		b.WriteString(strings.Repeat("0", 64-len(digits)) + digits)
+	}
+	return b.String()
+}
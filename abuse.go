@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+	"github.com/arithmosquillsworth/x402-service/pkg/trace"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultDecoyPaths look like paid endpoints worth probing. They are never
+// advertised, so only scanners find them.
+var defaultDecoyPaths = []string{"/api/admin/keys", "/api/wallet/export", "/api/internal/debug", "/api/v1/private-keys"}
+
+// Kinds of scanner source
+const (
+	SourceIP    = "ip"
+	SourcePayer = "payer"
+)
+
+// maxScannerMarks is how many recent marks each replica keeps for the
+// admin API
+const maxScannerMarks = 100
+
+// ScannerMark records a source caught requesting a decoy endpoint
+type ScannerMark struct {
+	Kind   string `json:"kind"` // ip or payer
+	Source string `json:"source"`
+	Path   string `json:"path"`
+	At     int64  `json:"at"`
+}
+
+// Abuse marks sources that request decoy endpoints as scanners. Marks are
+// kept in the shared store, so every replica knows them, and expire after
+// ttl. Marked sources get a much smaller allowance on paid endpoints. A nil
+// *Abuse marks and limits nothing.
+type Abuse struct {
+	ttl     time.Duration
+	limiter ratelimit.Limiter // the allowance of marked sources
+	proxies *TrustedProxies   // whose X-Forwarded-For hops are believed
+	clock   clock.Clock
+
+	mu     sync.Mutex
+	recent []ScannerMark    // newest last
+	hits   map[string]int64 // decoy path -> requests
+}
+
+// NewAbuse keeps marks for ttl and limits marked sources with limiter. A
+// nil proxies takes the client address from the connection alone.
+func NewAbuse(ttl time.Duration, limiter ratelimit.Limiter, proxies *TrustedProxies) *Abuse {
+	return &Abuse{ttl: ttl, limiter: limiter, proxies: proxies, clock: clock.System, hits: make(map[string]int64)}
+}
+
+// TrustedProxies are the proxies in front of the service, whose
+// X-Forwarded-For hops are believed. Every other hop may be forged by the
+// client.
+type TrustedProxies struct {
+	peer bool         // the connecting peer, whatever its address
+	nets []*net.IPNet // proxies by address, at any hop
+}
+
+// parseTrustedProxies reads TRUST_PROXY: "true" trusts only the connecting
+// peer, a comma-separated list of addresses or CIDRs trusts those proxies,
+// and empty or "false" trusts none
+func parseTrustedProxies(s string) (*TrustedProxies, error) {
+	switch s = strings.TrimSpace(s); s {
+	case "", "false":
+		return nil, nil
+	case "true":
+		return &TrustedProxies{peer: true}, nil
+	}
+	t := &TrustedProxies{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR", entry)
+		}
+		t.nets = append(t.nets, network)
+	}
+	return t, nil
+}
+
+// trusts reports whether the hop at addr is a trusted proxy; peer is
+// whether it is the connecting peer
+func (t *TrustedProxies) trusts(addr string, peer bool) bool {
+	if t == nil {
+		return false
+	}
+	if peer && t.peer {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	for _, network := range t.nets {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDecoyPaths reads HONEYTOKEN_PATHS: a comma-separated list of paths,
+// "none" for no decoys, or empty for the defaults
+func parseDecoyPaths(s string) []string {
+	switch strings.TrimSpace(s) {
+	case "":
+		return defaultDecoyPaths
+	case "none":
+		return nil
+	}
+	var paths []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, "/"+strings.TrimLeft(p, "/"))
+		}
+	}
+	return paths
+}
+
+func scannerKey(kind, source string) string { return "scanner:" + kind + ":" + source }
+
+// clientIP returns the address r came from: walking X-Forwarded-For from
+// the connecting peer leftwards, the first hop that is not a trusted proxy.
+// Hops further left are whatever the client chose to send.
+func (a *Abuse) clientIP(r *http.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	if a == nil || a.proxies == nil {
+		return addr
+	}
+	var hops []string
+	for _, fwd := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(fwd, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for peer := true; len(hops) > 0 && a.proxies.trusts(addr, peer); peer = false {
+		addr, hops = hops[len(hops)-1], hops[:len(hops)-1]
+	}
+	return addr
+}
+
+// Mark records source as a scanner caught at path
+func (a *Abuse) Mark(kind, source, path string) {
+	if a == nil || source == "" {
+		return
+	}
+	if err := sharedState.Set(scannerKey(kind, source), path, a.ttl); err != nil {
+		log.Printf("⚠️  Scanner %s %s not marked: %v", kind, source, err)
+	}
+	log.Printf("🍯 Scanner marked: %s=%s path=%s", kind, source, path)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.recent = append(a.recent, ScannerMark{Kind: kind, Source: source, Path: path, At: a.clock.Now().Unix()})
+	if len(a.recent) > maxScannerMarks {
+		a.recent = a.recent[len(a.recent)-maxScannerMarks:]
+	}
+}
+
+// Scanner reports whether source is marked. If the store is unreachable
+// it is not.
+func (a *Abuse) Scanner(kind, source string) bool {
+	if a == nil || source == "" {
+		return false
+	}
+	_, ok, err := sharedState.Get(scannerKey(kind, source))
+	return err == nil && ok
+}
+
+// Take takes from the allowance of source if it is marked as a scanner. It
+// reports false for unmarked sources, which it does not limit.
+func (a *Abuse) Take(kind, source string) (ratelimit.Status, bool) {
+	if !a.Scanner(kind, source) {
+		return ratelimit.Status{}, false
+	}
+	return a.limiter.Take(kind + ":" + source), true
+}
+
+// Decoy serves a decoy endpoint. It answers like a paid endpoint, with a
+// 402 challenge for the price, but marks the caller's address as a
+// scanner, and the payer of a payment token if its signature checks out,
+// so nobody can get someone else's payer marked by naming it. It never
+// runs a handler or captures a payment.
+func (p *Paywall) Decoy(endpoint, price string, priceUSD float64, description string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a := p.abuse
+		a.Mark(SourceIP, a.clientIP(r), endpoint)
+		if token := r.Header.Get("X-Payment-Response"); token != "" {
+			claims := &PaymentToken{}
+			if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err == nil && len(paymentKeys.check(token, claims, p.clock.Now())) == 0 {
+				a.Mark(SourcePayer, payerFromClaims(claims, "").Address, endpoint)
+			}
+		}
+		if a != nil {
+			a.mu.Lock()
+			a.hits[endpoint]++
+			a.mu.Unlock()
+		}
+
+		q, err := p.quote(r.Context(), endpoint, price, priceUSD, description)
+		if err != nil {
+			http.Error(w, `{"error":"Pricing unavailable, try again shortly"}`, http.StatusServiceUnavailable)
+			return
+		}
+		q.localize(r)
+		p.challenge(w, q)
+	}
+}
+
+// scannerLimited refuses a and reports true if source is a marked scanner
+// over its allowance. The allowance of a marked scanner is reported either
+// way.
+func (p *Paywall) scannerLimited(a *admission, kind, source string) bool {
+	st, marked := p.abuse.Take(kind, source)
+	if !marked {
+		return false
+	}
+	a.rate = &st
+	if st.Allowed {
+		return false
+	}
+	trace.FromContext(a.ctx).SetAttr("outcome", "scanner_limited")
+	a.refusal = &refusal{status: http.StatusTooManyRequests, message: "Rate limit exceeded, payment not captured"}
+	return true
+}
+
+// WriteMetrics appends decoy hits in Prometheus format
+func (a *Abuse) WriteMetrics(b *strings.Builder) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	paths := make([]string, 0, len(a.hits))
+	for path := range a.hits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	b.WriteString("# HELP x402_decoy_hits_total Requests to decoy endpoints\n")
+	b.WriteString("# TYPE x402_decoy_hits_total counter\n")
+	for _, path := range paths {
+		fmt.Fprintf(b, "x402_decoy_hits_total{path=%q} %d\n", path, a.hits[path])
+	}
+}
+
+// handleAdminAbuse serves /admin/abuse. GET lists the scanners this replica
+// marked recently, newest first; DELETE /admin/abuse/{kind}/{source} lifts
+// a mark.
+func (a *Abuse) handleAdminAbuse(w http.ResponseWriter, r *http.Request) {
+	if a == nil {
+		http.Error(w, `{"error":"No decoy endpoints are configured"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		a.mu.Lock()
+		marks := make([]ScannerMark, len(a.recent))
+		for i, m := range a.recent {
+			marks[len(a.recent)-1-i] = m
+		}
+		a.mu.Unlock()
+		for i := range marks {
+			if !a.Scanner(marks[i].Kind, marks[i].Source) {
+				marks[i].Path = "" // lifted or expired
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ttl": a.ttl.String(), "marks": marks})
+	case http.MethodDelete:
+		kind, source, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/abuse/"), "/")
+		if !ok || (kind != SourceIP && kind != SourcePayer) || source == "" {
+			http.Error(w, `{"error":"Use DELETE /admin/abuse/{ip|payer}/{source}"}`, http.StatusBadRequest)
+			return
+		}
+		if err := sharedState.Delete(scannerKey(kind, source)); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("🍯 Scanner mark lifted: %s=%s", kind, source)
+		json.NewEncoder(w).Encode(map[string]string{"kind": kind, "source": source, "status": "lifted"})
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
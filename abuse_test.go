@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestHoneytokens(t *testing.T) {
+	// The test client connects from loopback, through a proxy at 10.0.0.1
+	srv, _ := startService(t, map[string]string{"TRUST_PROXY": "127.0.0.1, 10.0.0.0/8", "ABUSE_SCANNER_PER_MINUTE": "2"})
+	do := func(method, path, ip, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		if strings.HasPrefix(path, "/admin/") {
+			req.Header.Set("Authorization", "Bearer "+e2eAdminToken)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	status := func(method, path, ip string) int {
+		t.Helper()
+		resp := do(method, path, ip, "")
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	resp := do("GET", "/", "198.51.100.1", "")
+	manifest, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Contains(string(manifest), "/api/wallet/export") {
+		t.Error("decoy endpoint advertised in the manifest")
+	}
+
+	// A token that does not verify marks nobody but its sender, whose
+	// address is the hop before the trusted proxies, whatever it forged
+	forged := PaymentToken{}
+	forged.Subject = "0xBEEF000000000000000000000000000000000001"
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, forged).SignedString([]byte("guessed"))
+	resp = do("GET", "/api/wallet/export", "198.51.100.1, 192.0.2.9, 10.0.0.1", unsigned)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPaymentRequired {
+		t.Fatalf("decoy returned %d, want 402", resp.StatusCode)
+	}
+	if got := status("DELETE", "/admin/abuse/ip/192.0.2.9", "198.51.100.1"); got != http.StatusOK {
+		t.Fatalf("lifting the forger's mark returned %d", got)
+	}
+
+	// The decoy looks paid and marks both the address and the payer
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.01"
+	claims.Subject = "0xDEAD000000000000000000000000000000000001"
+	token := signPayment(t, claims)
+	resp = do("GET", "/api/wallet/export", "203.0.113.7, 10.0.0.1", token)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPaymentRequired {
+		t.Fatalf("decoy returned %d, want 402", resp.StatusCode)
+	}
+
+	// The scanner's address now gets the scanner allowance, others do not
+	for i, want := range []int{402, 402, 429} {
+		if got := status("GET", "/api/gas", "203.0.113.7"); got != want {
+			t.Errorf("scanner request %d returned %d, want %d", i+1, got, want)
+		}
+	}
+	for i := range 3 {
+		if got := status("GET", "/api/gas", "198.51.100.1"); got != http.StatusPaymentRequired {
+			t.Errorf("clean request %d returned %d, want 402", i+1, got)
+		}
+	}
+
+	resp = do("GET", "/admin/abuse", "198.51.100.1", "")
+	var list struct {
+		Marks []ScannerMark `json:"marks"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Marks) != 3 || list.Marks[2].Path != "" || list.Marks[0].Kind != SourcePayer || list.Marks[0].Source != "0xdead000000000000000000000000000000000001" ||
+		list.Marks[1].Kind != SourceIP || list.Marks[1].Source != "203.0.113.7" || list.Marks[1].Path != "/api/wallet/export" {
+		t.Errorf("marks = %+v", list.Marks)
+	}
+
+	if got := status("DELETE", "/admin/abuse/ip/203.0.113.7", "198.51.100.1"); got != http.StatusOK {
+		t.Fatalf("lifting the mark returned %d", got)
+	}
+	if got := status("GET", "/api/gas", "203.0.113.7"); got != http.StatusPaymentRequired {
+		t.Errorf("request after lifting the mark returned %d, want 402", got)
+	}
+	if got := status("DELETE", "/admin/abuse/host/203.0.113.7", "198.51.100.1"); got != http.StatusBadRequest {
+		t.Errorf("unknown kind returned %d, want 400", got)
+	}
+	if entries := ledgerEntries(t, srv); len(entries) != 0 {
+		t.Errorf("decoy recorded payments: %+v", entries)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		trust, remote, forwarded, want string
+	}{
+		{"", "192.0.2.1:4000", "203.0.113.7", "192.0.2.1"},
+		{"true", "192.0.2.1:4000", "", "192.0.2.1"},
+		// Only the hop the proxy appended is believed
+		{"true", "192.0.2.1:4000", "6.6.6.6, 203.0.113.7", "203.0.113.7"},
+		{"10.0.0.0/8", "10.0.0.2:4000", "6.6.6.6, 203.0.113.7, 10.0.0.1", "203.0.113.7"},
+		// An untrusted peer's header is ignored
+		{"10.0.0.0/8", "192.0.2.1:4000", "203.0.113.7", "192.0.2.1"},
+		// Every hop trusted: the leftmost is the client
+		{"10.0.0.0/8", "10.0.0.2:4000", "10.0.0.9, 10.0.0.1", "10.0.0.9"},
+	}
+	for _, tt := range tests {
+		proxies, err := parseTrustedProxies(tt.trust)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		a := NewAbuse(time.Hour, nil, proxies)
+		if got := a.clientIP(req); got != tt.want {
+			t.Errorf("TRUST_PROXY=%q from %s via %q: client %s, want %s", tt.trust, tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+	if _, err := parseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+}
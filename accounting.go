@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ledger export formats
+const (
+	ExportCSV    = "csv"    // one row per payment with the chosen columns
+	ExportKoinly = "koinly" // Koinly universal format, read by most crypto tax tools
+)
+
+var exportFormats = map[string]bool{ExportCSV: true, ExportKoinly: true}
+
+// exportColumns render the columns of the csv export
+var exportColumns = map[string]func(LedgerEntry) string{
+	"id":               func(e LedgerEntry) string { return e.ID },
+	"date":             func(e LedgerEntry) string { return time.Unix(e.CreatedAt, 0).UTC().Format(time.RFC3339) },
+	"created_at":       func(e LedgerEntry) string { return strconv.FormatInt(e.CreatedAt, 10) },
+	"tenant":           func(e LedgerEntry) string { return e.Tenant },
+	"endpoint":         func(e LedgerEntry) string { return e.Endpoint },
+	"payer":            func(e LedgerEntry) string { return e.Payer },
+	"receiver":         func(e LedgerEntry) string { return e.Receiver },
+	"amount":           func(e LedgerEntry) string { return e.Amount },
+	"asset":            func(e LedgerEntry) string { return e.Asset },
+	"asset_usd":        func(e LedgerEntry) string { return formatValue(e.AssetUSD) },
+	"amount_usd":       func(e LedgerEntry) string { return formatValue(e.AmountUSD) },
+	"value":            func(e LedgerEntry) string { v, _ := e.value(); return formatValue(v) },
+	"currency":         func(e LedgerEntry) string { _, c := e.value(); return c },
+	"fiat_price":       func(e LedgerEntry) string { return e.FiatPrice },
+	"coupon":           func(e LedgerEntry) string { return e.Coupon },
+	"credit":           func(e LedgerEntry) string { return e.Credit },
+	"account":          func(e LedgerEntry) string { return e.Account },
+	"referrer":         func(e LedgerEntry) string { return e.Referrer },
+	"referrer_address": func(e LedgerEntry) string { return e.ReferrerAddress },
+	"referral_amount":  func(e LedgerEntry) string { return e.ReferralAmount },
+	"referral_usd":     func(e LedgerEntry) string { return formatValue(e.ReferralUSD) },
+	"status":           func(e LedgerEntry) string { return e.Status },
+	"trace_id":         func(e LedgerEntry) string { return e.TraceID },
+}
+
+// defaultExportColumns are exported unless ?columns= names others
+var defaultExportColumns = []string{"date", "id", "tenant", "endpoint", "payer", "amount", "asset", "asset_usd", "amount_usd", "value", "currency", "coupon", "referrer", "referral_amount"}
+
+// koinlyHeader is the Koinly universal CSV header
+var koinlyHeader = []string{"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency", "Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency", "Label", "Description", "TxHash"}
+
+func formatValue(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// value is what the payment was worth when it was made, in the accounting
+// currency if one was set then and in USD otherwise
+func (e LedgerEntry) value() (float64, string) {
+	if e.FiatCurrency != "" {
+		return e.FiatValue, e.FiatCurrency
+	}
+	return e.AmountUSD, "USD"
+}
+
+// SetAccountingCurrency values captured payments in currency as well as
+// USD, at the exchange rate of the moment
+func (p *Paywall) SetAccountingCurrency(currency string) {
+	p.accounting = strings.ToLower(currency)
+}
+
+// value records the asset's USD price at payment time and, if an
+// accounting currency is set, the payment's worth in it. Rates that cannot
+// be fetched are left out rather than guessed.
+func (p *Paywall) value(e *LedgerEntry) {
+	if c := p.converter(e.Asset); c != nil {
+		if rate, err := c.assetRate(); err == nil {
+			e.AssetUSD = rate
+		}
+	}
+	if p.accounting == "" || p.accounting == "usd" {
+		return
+	}
+	rate, err := fxRate(p.accounting)
+	if err != nil {
+		log.Printf("⚠️  Payment %s not valued in %s: %v", e.ID, strings.ToUpper(p.accounting), err)
+		return
+	}
+	e.FiatValue, e.FiatCurrency = round(e.AmountUSD*rate, 6), strings.ToUpper(p.accounting)
+}
+
+// parseExportColumns reads ?columns=, a comma-separated list
+func parseExportColumns(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return defaultExportColumns, nil
+	}
+	var columns []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if _, ok := exportColumns[c]; !ok {
+			return nil, fmt.Errorf("unknown column %q - use %s", c, optionList(exportColumns))
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// exportLedger writes entries as format, oldest first
+func exportLedger(entries []LedgerEntry, format string, columns []string) ([]byte, error) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt < entries[j].CreatedAt })
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	switch format {
+	case ExportKoinly:
+		cw.Write(koinlyHeader)
+		for _, e := range entries {
+			if e.Amount == "0" {
+				continue // paid for by a coupon, nothing was received
+			}
+			if e.Account == AccountDebit {
+				continue // paid from a balance, received when it was deposited
+			}
+			value, currency := e.value()
+			cw.Write([]string{
+				time.Unix(e.CreatedAt, 0).UTC().Format("2006-01-02 15:04:05 UTC"),
+				"", "",
+				e.Amount, e.Asset,
+				"", "",
+				formatValue(value), currency,
+				"income",
+				fmt.Sprintf("x402 payment %s for %s from %s", e.ID, e.Endpoint, e.Payer),
+				"",
+			})
+		}
+	default:
+		cw.Write(columns)
+		for _, e := range entries {
+			record := make([]string, len(columns))
+			for i, c := range columns {
+				record[i] = exportColumns[c](e)
+			}
+			cw.Write(record)
+		}
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// handleAdminExport serves GET /admin/ledger/export, the ledger as a CSV
+// file for accounting. ?format= is csv (the default) or koinly, ?columns=
+// picks the csv columns, ?tenant= limits it to one tenant and ?since= and
+// ?until= (unix seconds) to a period.
+func (l *Ledger) handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = ExportCSV
+	}
+	if !exportFormats[format] {
+		http.Error(w, fmt.Sprintf(`{"error":"unknown format %q - use %s"}`, format, optionList(exportFormats)), http.StatusBadRequest)
+		return
+	}
+	columns, err := parseExportColumns(q.Get("columns"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	since, _ := strconv.ParseInt(q.Get("since"), 10, 64)
+	until, _ := strconv.ParseInt(q.Get("until"), 10, 64)
+
+	tenants := l.Tenants()
+	if tenant := q.Get("tenant"); tenant != "" {
+		tenants = []string{tenant}
+	}
+	var entries []LedgerEntry
+	for _, tenant := range tenants {
+		for _, e := range l.Entries(tenant) {
+			if e.CreatedAt >= since && (until == 0 || e.CreatedAt < until) {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	out, err := exportLedger(entries, format, columns)
+	if err != nil {
+		http.Error(w, `{"error":"Could not encode export"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mediaCSV+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ledger-%s.csv"`, format))
+	w.Write(out)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLedgerExport(t *testing.T) {
+	srv, _ := startService(t, map[string]string{"ACCOUNTING_CURRENCY": "eur"})
+	resp := paidRequest(t, srv, "GET", "/api/gas", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("paid request returned %d", resp.StatusCode)
+	}
+
+	export := func(query string) (int, [][]string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+"/admin/ledger/export"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+e2eAdminToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, nil
+		}
+		rows, err := csv.NewReader(resp.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, rows
+	}
+
+	// Valued in EUR at the fake rate of 0.9 per USD
+	_, rows := export("?columns=endpoint,amount,asset,asset_usd,amount_usd,value,currency")
+	if len(rows) != 2 || strings.Join(rows[0], ",") != "endpoint,amount,asset,asset_usd,amount_usd,value,currency" ||
+		strings.Join(rows[1], ",") != "/api/gas,0.001,USDC,1,0.001,0.0009,EUR" {
+		t.Errorf("csv export = %q", rows)
+	}
+	if _, rows := export(""); len(rows) != 2 || strings.Join(rows[0], ",") != strings.Join(defaultExportColumns, ",") {
+		t.Errorf("default export = %q", rows)
+	}
+	if _, rows := export("?since=1&until=2"); len(rows) != 1 {
+		t.Errorf("export outside the period = %q", rows)
+	}
+
+	_, rows = export("?format=koinly")
+	if len(rows) != 2 || rows[0][0] != "Date" || !strings.HasSuffix(rows[1][0], " UTC") {
+		t.Fatalf("koinly export = %q", rows)
+	}
+	row := strings.Join(rows[1][1:10], ",")
+	if row != ",,0.001,USDC,,,0.0009,EUR,income" {
+		t.Errorf("koinly row = %q", row)
+	}
+
+	for _, query := range []string{"?format=xlsx", "?columns=amount,secret"} {
+		if code, _ := export(query); code != http.StatusBadRequest {
+			t.Errorf("%s returned %d, want 400", query, code)
+		}
+	}
+}
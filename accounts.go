@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/trace"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// Prepaid account movements, the account of a ledger entry and a charge
+const (
+	AccountDeposit = "deposit" // a top-up of the payer's balance
+	AccountDebit   = "debit"   // a call paid from it
+)
+
+const (
+	// accountTopupEndpoint is paid to top a balance up, never from one
+	accountTopupEndpoint = "/api/account/topup"
+	// accountDecimals are the decimals balances are kept to. Amounts
+	// finer than that are rounded up when debited.
+	accountDecimals = 9
+	// debitWindow is how far a debit ID's timestamp may be from now
+	debitWindow = 5 * time.Minute
+	// accountInsufficient counts debits refused for want of balance
+	accountInsufficient = "insufficient"
+)
+
+var (
+	errInsufficientBalance = errors.New("insufficient prepaid balance")
+	errBalancesUnavailable = errors.New("prepaid balances unavailable")
+)
+
+// Accounts keeps prepaid balances. A payer tops up once with an ordinary
+// payment to /api/account/topup, then signs later calls with a debit ID
+// instead of paying each one on-chain, and the price is debited from the
+// balance. A balance belongs to a tenant, payer and asset, and is kept in
+// sharedState so any replica honors it. A nil *Accounts takes no debits.
+type Accounts struct {
+	asset  string // the asset balances are paid and debited in
+	mu     sync.Mutex
+	counts map[string]int64 // AccountDeposit, AccountDebit or accountInsufficient -> count
+}
+
+// NewAccounts returns prepaid accounts in asset
+func NewAccounts(asset string) *Accounts {
+	return &Accounts{asset: asset, counts: make(map[string]int64)}
+}
+
+func accountKey(tenant, payer, asset string) string {
+	return "account:" + tenant + ":" + payer + ":" + asset
+}
+
+// toAccountUnits converts an asset amount into balance units, rounding up
+// digits beyond accountDecimals so a debit never undercharges
+func toAccountUnits(amount string) (int64, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if whole == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	roundUp := false
+	if len(frac) > accountDecimals {
+		roundUp = strings.Trim(frac[accountDecimals:], "0") != ""
+		frac = frac[:accountDecimals]
+	}
+	n, err := strconv.ParseInt(whole+frac+strings.Repeat("0", accountDecimals-len(frac)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q is too large", amount)
+	}
+	if roundUp {
+		n++
+	}
+	return n, nil
+}
+
+func formatAccountUnits(n int64) string {
+	return units.Format(big.NewInt(n), accountDecimals)
+}
+
+// Balance returns payer's balance
+func (a *Accounts) Balance(tenant, payer string) (string, error) {
+	v, ok, err := sharedState.Get(accountKey(tenant, payer, a.asset))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errBalancesUnavailable, err)
+	}
+	n := int64(0)
+	if ok {
+		n, _ = strconv.ParseInt(v, 10, 64)
+	}
+	return formatAccountUnits(n), nil
+}
+
+// deposit adds amount to payer's balance and returns the new balance
+func (a *Accounts) deposit(tenant, payer, amount string) (string, error) {
+	n, err := toAccountUnits(amount)
+	if err != nil {
+		return "", err
+	}
+	balance, err := sharedState.IncrBy(accountKey(tenant, payer, a.asset), n)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errBalancesUnavailable, err)
+	}
+	a.count(AccountDeposit)
+	log.Printf("🏦 Account topped up: tenant=%s payer=%s amount=%s %s balance=%s", tenant, payer, amount, a.asset, formatAccountUnits(balance))
+	return formatAccountUnits(balance), nil
+}
+
+// accountHold is the price of one call taken from a balance, given back if
+// the call is not charged
+type accountHold struct {
+	key     string
+	units   int64
+	balance int64 // left after the hold
+}
+
+// hold takes amount from payer's balance, refusing with
+// errInsufficientBalance if the balance does not cover it
+func (a *Accounts) hold(tenant, payer, amount string) (*accountHold, error) {
+	n, err := toAccountUnits(amount)
+	if err != nil {
+		return nil, err
+	}
+	key := accountKey(tenant, payer, a.asset)
+	left, err := sharedState.IncrBy(key, -n)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBalancesUnavailable, err)
+	}
+	// Another replica may have spent the balance first; the take is undone
+	if left < 0 {
+		if _, err := sharedState.IncrBy(key, n); err != nil {
+			log.Printf("⚠️  Balance of %s not restored after a refused debit: %v", payer, err)
+		}
+		a.count(accountInsufficient)
+		return nil, fmt.Errorf("%w: %s %s left", errInsufficientBalance, formatAccountUnits(left+n), a.asset)
+	}
+	return &accountHold{key: key, units: n, balance: left}, nil
+}
+
+// refund gives back fraction of the hold
+func (h *accountHold) refund(fraction float64) {
+	if h == nil {
+		return
+	}
+	n := int64(math.Floor(float64(h.units) * fraction))
+	if n <= 0 {
+		return
+	}
+	if _, err := sharedState.IncrBy(h.key, n); err != nil {
+		log.Printf("⚠️  Prepaid balance %s not refunded %s: %v", h.key, formatAccountUnits(n), err)
+	}
+}
+
+func (a *Accounts) count(event string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.counts[event]++
+	a.mu.Unlock()
+}
+
+// WriteMetrics emits the deposits and debits this replica took, and the
+// debits it refused
+func (a *Accounts) WriteMetrics(b *strings.Builder) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b.WriteString("# HELP x402_prepaid_accounts_total Prepaid account deposits, debits and debits refused for want of balance\n")
+	b.WriteString("# TYPE x402_prepaid_accounts_total counter\n")
+	for _, event := range []string{AccountDeposit, AccountDebit, accountInsufficient} {
+		fmt.Fprintf(b, "x402_prepaid_accounts_total{event=%q} %d\n", event, a.counts[event])
+	}
+}
+
+// debit pays for a request from the payer's prepaid balance. The payer
+// signs the request along with its debit ID, "<unix seconds>.<nonce>",
+// which is spent like a payment so the signed request pays only once.
+// The price is held until the request is captured, and given back with
+// the debit ID if it is not.
+func (p *Paywall) debit(ctx context.Context, r *http.Request, q quote, debitID string) (context.Context, Payer, *accountHold, error) {
+	seconds, nonce, _ := strings.Cut(debitID, ".")
+	at, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || nonce == "" || len(debitID) > 128 {
+		return ctx, Payer{}, nil, errors.New("debit ID must be <unix seconds>.<nonce>")
+	}
+	if d := p.clock.Now().Sub(time.Unix(at, 0)); d > debitWindow || d < -debitWindow {
+		return ctx, Payer{}, nil, errors.New("debit ID must be timestamped within five minutes of now")
+	}
+	body, err := peekBody(r)
+	if err != nil {
+		return ctx, Payer{}, nil, err
+	}
+	signature := r.Header.Get(reqsig.Header)
+	if signature == "" {
+		return ctx, Payer{}, nil, errors.New("sign the request and its debit ID in " + reqsig.Header)
+	}
+	signer, err := reqsig.RecoverDebit(signature, r.Method, r.URL.RequestURI(), body, debitID)
+	if err != nil {
+		return ctx, Payer{}, nil, err
+	}
+
+	tenant := tenantID(ctx)
+	claim, err := claimPayment("x402:debit:"+tenant+":"+signer+":"+debitID, replayDebit, 2*debitWindow)
+	if err != nil {
+		return ctx, Payer{}, nil, err
+	}
+	hold, err := p.account.hold(tenant, signer, q.price)
+	if err != nil {
+		claim.release()
+		return ctx, Payer{}, nil, err
+	}
+	payer := Payer{Address: signer, Source: "signer"}
+	c := &charge{id: newPaymentID(), amount: q.price, asset: q.asset, fiat: q.fiat, receiver: q.receiver, fraction: 1,
+		spends: []*paymentClaim{claim}, hold: hold, account: AccountDebit}
+	trace.FromContext(ctx).SetAttr("payment.id", c.id)
+	return withCharge(withPayer(ctx, payer), c), payer, hold, nil
+}
+
+// debitRefusal is the answer to a request the payer's balance could not
+// pay for. A short balance gets the 402 challenge, to pay for the call or
+// top up.
+func debitRefusal(err error) *refusal {
+	switch {
+	case errors.Is(err, errInsufficientBalance):
+		return &refusal{status: http.StatusPaymentRequired, message: err.Error(), challenge: true, headers: map[string]string{"X-Account-Error": err.Error()}}
+	case errors.Is(err, errBalancesUnavailable):
+		return &refusal{status: http.StatusServiceUnavailable, message: "Prepaid balances unavailable, try again shortly", headers: map[string]string{"Retry-After": "30"}}
+	}
+	return &refusal{status: http.StatusBadRequest, message: "Debit not accepted: " + err.Error()}
+}
+
+// AccountBalance is a payer's prepaid balance
+type AccountBalance struct {
+	Payer   string `json:"payer"`
+	Asset   string `json:"asset"`
+	Balance string `json:"balance"`
+}
+
+// handleTopup serves POST /api/account/topup: the payment is added to the
+// payer's balance in full. Payments that cannot fund a balance are refused
+// without capturing them.
+func (a *Accounts) handleTopup(w http.ResponseWriter, r *http.Request) {
+	c := chargeFromContext(r.Context())
+	payer, _ := PayerFromContext(r.Context())
+	refuse := func(status int, reason string) {
+		c.refuse()
+		log.Printf("Top-up refused (payer=%s): %s", payerLabel(r), reason)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, reason+", payment not captured"), status)
+	}
+	switch {
+	case c == nil || payer.Address == "":
+		refuse(http.StatusBadRequest, "Top-ups must be paid by an identified payer")
+		return
+	case IsSandbox(r.Context()):
+		refuse(http.StatusBadRequest, "Sandbox payments cannot fund an account")
+		return
+	case c.accountMovement() == AccountDebit:
+		refuse(http.StatusBadRequest, "A balance cannot top itself up")
+		return
+	case payer.Source == "coupon" || c.credited() == CreditRedeemed:
+		refuse(http.StatusBadRequest, "Only payments can fund an account")
+		return
+	case c.asset != a.asset:
+		refuse(http.StatusBadRequest, "Top-ups are paid in "+a.asset)
+		return
+	}
+
+	balance, err := a.deposit(tenantID(r.Context()), payer.Address, c.amount)
+	if err != nil {
+		w.Header().Set("Retry-After", "30")
+		refuse(http.StatusServiceUnavailable, "Balance not topped up")
+		return
+	}
+	// The deposit is made, so nothing below may refuse the payment
+	c.fundAccount()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Account-Balance", balance)
+	json.NewEncoder(w).Encode(AccountBalance{Payer: payer.Address, Asset: a.asset, Balance: balance})
+}
+
+// handleBalance serves GET /api/account/balance, signed by the payer like
+// a watch list request
+func (a *Accounts) handleBalance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	signature := r.Header.Get(reqsig.Header)
+	if signature == "" {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "Sign the request with the paying wallet in "+reqsig.Header), http.StatusUnauthorized)
+		return
+	}
+	body, _ := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	payer, err := reqsig.Recover(signature, r.Method, r.URL.RequestURI(), body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnauthorized)
+		return
+	}
+	balance, err := a.Balance(tenantID(r.Context()), payer)
+	if err != nil {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, `{"error":"Prepaid balances unavailable, try again shortly"}`, http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(AccountBalance{Payer: payer, Asset: a.asset, Balance: balance})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+)
+
+func TestToAccountUnits(t *testing.T) {
+	for amount, want := range map[string]int64{
+		"1":            1_000_000_000,
+		"0.001":        1_000_000,
+		"0.0000000001": 1, // finer than a balance unit rounds up
+		"0.0000000010": 1,
+	} {
+		if got, err := toAccountUnits(amount); err != nil || got != want {
+			t.Errorf("toAccountUnits(%s) = %d, %v, want %d", amount, got, err, want)
+		}
+	}
+	for _, amount := range []string{"", "-1", "1e3", "99999999999"} {
+		if _, err := toAccountUnits(amount); err == nil {
+			t.Errorf("toAccountUnits(%q) accepted", amount)
+		}
+	}
+}
+
+func TestPrepaidAccount(t *testing.T) {
+	key, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	address := ethsig.Address(key)
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	accounts := NewAccounts(config.Asset)
+	paywall.SetAccounts(accounts)
+	sharedState.Delete(accountKey(DefaultTenant, address, config.Asset))
+
+	topup := paywall.ProtectRoute("/api/account/topup", accounts.handleTopup)
+	refuse := false
+	gas := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		if refuse {
+			DegradationPolicy{Mode: DegradeRefuse}.Fallback(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":{}}`))
+	})
+	sign := func(message []byte) string {
+		sig, err := ethsig.Sign(ethsig.PersonalHash(message), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "0x" + hex.EncodeToString(sig)
+	}
+	debit := func(debitID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set(reqsig.DebitHeader, debitID)
+		req.Header.Set(reqsig.Header, sign(reqsig.DebitMessage("GET", "/api/gas", reqsig.BodyHash(nil), debitID)))
+		rr := httptest.NewRecorder()
+		gas(rr, req)
+		return rr
+	}
+	newDebitID := func() string {
+		return fmt.Sprintf("%d.%s", time.Now().Unix(), randomNonce()[:16])
+	}
+	balance := func() string {
+		req := httptest.NewRequest("GET", "/api/account/balance", nil)
+		req.Header.Set(reqsig.Header, sign(reqsig.Message("GET", "/api/account/balance", reqsig.BodyHash(nil))))
+		rr := httptest.NewRecorder()
+		accounts.handleBalance(rr, req)
+		var got AccountBalance
+		json.NewDecoder(rr.Body).Decode(&got)
+		if rr.Code != http.StatusOK || !strings.EqualFold(got.Payer, address) || got.Asset != "USDC" {
+			t.Fatalf("balance returned %d: %+v", rr.Code, got)
+		}
+		return got.Balance
+	}
+
+	// With no balance a debit is answered with the challenge
+	if rr := debit(newDebitID()); rr.Code != http.StatusPaymentRequired || rr.Header().Get("X-Payment-Required") == "" {
+		t.Fatalf("debit without balance returned %d", rr.Code)
+	}
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "1"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Network = "base"
+	claims.Payment.Receiver = config.Receiver
+	claims.Subject = address
+	req := httptest.NewRequest("POST", "/api/account/topup", nil)
+	req.Header.Set("X-Payment-Response", signPayment(t, claims))
+	rr := httptest.NewRecorder()
+	topup(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Account-Balance") != "1" {
+		t.Fatalf("top-up returned %d, balance %q: %s", rr.Code, rr.Header().Get("X-Account-Balance"), rr.Body)
+	}
+	// A top-up cannot be paid from the balance it tops up
+	req = httptest.NewRequest("POST", "/api/account/topup", nil)
+	req.Header.Set(reqsig.DebitHeader, newDebitID())
+	rr = httptest.NewRecorder()
+	topup(rr, req)
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("top-up by debit returned %d, want 402", rr.Code)
+	}
+
+	id := newDebitID()
+	if rr := debit(id); rr.Code != http.StatusOK || rr.Header().Get("X-Account-Balance") != "0.999" {
+		t.Fatalf("debit returned %d, balance %q: %s", rr.Code, rr.Header().Get("X-Account-Balance"), rr.Body)
+	}
+	if rr := debit(id); rr.Code != http.StatusBadRequest {
+		t.Errorf("replayed debit ID returned %d, want 400", rr.Code)
+	}
+	stale := fmt.Sprintf("%d.%s", time.Now().Add(-time.Hour).Unix(), randomNonce()[:16])
+	if rr := debit(stale); rr.Code != http.StatusBadRequest {
+		t.Errorf("stale debit ID returned %d, want 400", rr.Code)
+	}
+	// A debit signed for another request is someone else's, without a balance
+	req = httptest.NewRequest("GET", "/api/gas?unit=wei", nil)
+	id = newDebitID()
+	req.Header.Set(reqsig.DebitHeader, id)
+	req.Header.Set(reqsig.Header, sign(reqsig.DebitMessage("GET", "/api/gas", reqsig.BodyHash(nil), id)))
+	rr = httptest.NewRecorder()
+	gas(rr, req)
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("mis-signed debit returned %d, want 402", rr.Code)
+	}
+
+	// A call that is not captured gives the price back
+	refuse = true
+	if rr := debit(newDebitID()); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("refused debit returned %d", rr.Code)
+	}
+	refuse = false
+	if got := balance(); got != "0.999" {
+		t.Errorf("balance after refused call = %s, want 0.999", got)
+	}
+
+	var deposits, debits int
+	for _, e := range ledger.Entries(DefaultTenant) {
+		if !strings.EqualFold(e.Payer, address) {
+			continue
+		}
+		switch e.Account {
+		case AccountDeposit:
+			deposits++
+			if e.AmountUSD != 0 || e.Amount != "1" {
+				t.Errorf("deposit entry = %+v, want no revenue", e)
+			}
+		case AccountDebit:
+			debits++
+			if e.AmountUSD != 0.001 || e.Endpoint != "/api/gas" {
+				t.Errorf("debit entry = %+v", e)
+			}
+		}
+	}
+	if deposits != 1 || debits != 1 {
+		t.Errorf("ledger has %d deposits and %d debits, want 1 and 1", deposits, debits)
+	}
+
+	var b strings.Builder
+	accounts.WriteMetrics(&b)
+	for _, want := range []string{`{event="deposit"} 1`, `{event="debit"} 1`, `{event="insufficient"} 2`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+	"github.com/arithmosquillsworth/x402-service/pkg/trace"
+)
+
+// paidCall is a call to a paid route as any transport carries it
+type paidCall struct {
+	route   paidRoute
+	payment string // the payment token or exact payload, if any
+	scheme  string // "x402" or SchemeExact
+	coupon  string // coupon code, if any
+	debitID string // prepaid account debit ID, if any
+	// quoteOnly asks for the price without paying, as HEAD does
+	quoteOnly bool
+	// request is the HTTP request signatures and debits are checked
+	// against. Transports without one cannot carry either.
+	request *http.Request
+}
+
+// admission is the paywall's answer to a paidCall: the payer and charge in
+// ctx if it was let through, or why it was refused
+type admission struct {
+	ctx     context.Context
+	q       quote
+	payer   Payer
+	rate    *ratelimit.Status // the last rate limit taken, for its headers
+	balance string            // prepaid balance left after a debit
+	refusal *refusal          // nil if admitted
+}
+
+// refusal is why a call was turned away, for the transport to answer
+type refusal struct {
+	status    int               // HTTP status; other transports map it to theirs
+	message   string            // for the caller
+	challenge bool              // ask the caller to pay, with the 402 challenge
+	failed    []CheckFailure    // the checks a presented payment failed
+	headers   map[string]string // set on the answer, such as Retry-After
+}
+
+// admit runs a paid call through the paywall, shared by every transport:
+// load shedding, pricing, scanner and payer rate limits, coupons and the
+// payment itself, whether a token, a signed debit or a free coupon. A
+// charge in the returned context must be released by the caller once the
+// call ends, whether or not it was admitted.
+func (p *Paywall) admit(ctx context.Context, call paidCall) *admission {
+	a := &admission{ctx: ctx}
+	span := trace.FromContext(ctx)
+	endpoint := call.route.endpoint
+	refuse := func(r *refusal) *admission {
+		a.refusal = r
+		return a
+	}
+	if !p.shedder.Admit(endpoint, call.route.priceUSD) {
+		span.SetAttr("outcome", "shed")
+		return refuse(&refusal{status: http.StatusServiceUnavailable, message: "Service busy, retry shortly", headers: map[string]string{"Retry-After": shedRetryAfter}})
+	}
+
+	var err error
+	a.q, err = p.quote(ctx, endpoint, call.route.price, call.route.priceUSD, call.route.description)
+	q := &a.q
+	span.SetAttr("endpoint", endpoint)
+	span.SetAttr("price", q.price)
+	span.SetAttr("receiver", q.receiver)
+	span.SetAttr("tenant", tenantID(ctx))
+	if err != nil {
+		span.SetError(err.Error())
+		unavailable := &refusal{status: http.StatusServiceUnavailable, message: "Pricing unavailable, try again shortly", headers: map[string]string{"Retry-After": "30"}}
+		if errors.Is(err, errAssetPaused) {
+			unavailable.message = "Payments in " + p.config.Asset + " are paused: the asset is off its peg"
+			p.recordFailure(ctx, endpoint, "", "asset off its peg")
+		} else {
+			log.Printf("❌ Pricing %s failed: %v", endpoint, err)
+			p.recordFailure(ctx, endpoint, "", "pricing unavailable")
+		}
+		return refuse(unavailable)
+	}
+	if q.fiat != "" {
+		span.SetAttr("price.fiat", q.fiat)
+	}
+	if call.request != nil {
+		q.localize(call.request)
+	}
+	if p.scannerLimited(a, SourceIP, clientFromContext(ctx)) {
+		return a
+	}
+
+	if call.coupon != "" {
+		coupon, err := p.coupons.Check(call.coupon, endpoint, tenantID(ctx))
+		if err != nil {
+			span.SetError(err.Error())
+			return refuse(&refusal{status: http.StatusBadRequest, message: "Coupon not accepted: " + err.Error()})
+		}
+		span.SetAttr("coupon", coupon.ID)
+		*q = p.discount(*q, coupon)
+	}
+
+	// A signed debit ID pays from the payer's prepaid balance instead,
+	// except for a top-up, which must be paid to fund it
+	prepaid := call.payment == "" && call.debitID != "" && p.account != nil && !q.coupon.free() && endpoint != accountTopupEndpoint
+	if (call.payment == "" && !q.coupon.free() && !prepaid) || call.quoteOnly {
+		span.SetAttr("outcome", "challenged")
+		p.experiments.Challenged(q.experiment, q.variant)
+		return refuse(&refusal{status: http.StatusPaymentRequired, message: "Payment required", challenge: true})
+	}
+
+	payer := Payer{}
+	var failed []CheckFailure
+	switch {
+	case q.coupon.free():
+		ctx, payer = p.redeemFree(ctx, *q)
+	case prepaid:
+		if call.request == nil {
+			return refuse(&refusal{status: http.StatusBadRequest, message: "Debit not accepted: prepaid debits are only accepted over HTTP"})
+		}
+		var hold *accountHold
+		if ctx, payer, hold, err = p.debit(ctx, call.request, *q, call.debitID); err != nil {
+			span.SetError(err.Error())
+			r := debitRefusal(err)
+			if !r.challenge {
+				p.recordFailure(ctx, endpoint, "", "debit refused: "+err.Error())
+			}
+			return refuse(r)
+		}
+		span.SetAttr("account", AccountDebit)
+		a.balance = formatAccountUnits(hold.balance)
+	default:
+		switch {
+		case call.request != nil:
+			q.binding, err = bindRequest(call.request, p.signedRequests[endpoint])
+		case p.signedRequests[endpoint]:
+			err = errors.New("this endpoint requires a signed request, which only HTTP carries")
+		}
+		if err != nil {
+			span.SetError(err.Error())
+			p.recordFailure(ctx, endpoint, "", err.Error())
+			return refuse(&refusal{status: http.StatusBadRequest, message: "Request signature not accepted: " + err.Error()})
+		}
+		ctx, payer, failed = p.verify(ctx, call.scheme, call.payment, *q)
+	}
+	if len(failed) > 0 {
+		span.SetError("invalid or insufficient payment")
+		return refuse(&refusal{status: http.StatusPaymentRequired, message: "Invalid or insufficient payment", failed: failed})
+	}
+	a.ctx, a.payer = ctx, payer
+	span.SetAttr("payer", payer.String())
+
+	if p.scannerLimited(a, SourcePayer, payer.Address) {
+		return a
+	}
+	if p.limiter != nil {
+		st := p.limiter.Take(payer.String())
+		a.rate = &st
+		if !st.Allowed {
+			span.SetAttr("outcome", "rate_limited")
+			return refuse(&refusal{status: http.StatusTooManyRequests, message: "Rate limit exceeded, payment not captured"})
+		}
+	}
+	if q.coupon != nil && !p.coupons.reserve(q.coupon) {
+		span.SetError("coupon used up")
+		return refuse(&refusal{status: http.StatusBadRequest, message: "Coupon not accepted: coupon used up"})
+	}
+	return a
+}
+
+// redeemCredit pays for an admitted call with a credit from an earlier
+// fallback response, if the payer has one. The payment then only proves
+// who the payer is.
+func (p *Paywall) redeemCredit(a *admission) bool {
+	if a.q.coupon != nil || a.payer.Address == "" || IsSandbox(a.ctx) || !p.credits.redeem(tenantID(a.ctx), a.payer.String(), a.q.endpoint) {
+		return false
+	}
+	chargeFromContext(a.ctx).redeemCredit()
+	trace.FromContext(a.ctx).SetAttr("credit", CreditRedeemed)
+	return true
+}
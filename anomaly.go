@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Anomaly kinds
+const (
+	AnomalyRejectionSpike     = "rejection_spike"     // far more payments refused than usual
+	AnomalyPayerConcentration = "payer_concentration" // one payer makes nearly all the paid traffic
+	AnomalyNearThreshold      = "near_threshold"      // a payer keeps paying just under the price
+)
+
+// maxAnomalies is how many anomalies the detector keeps for the admin API
+const maxAnomalies = 100
+
+// nearMissAlert is how many underpayments just below the price, from one
+// payer in one window, are an anomaly
+const nearMissAlert = 3
+
+// baselineWeight is how much each calm window moves the rejection baseline
+const baselineWeight = 0.3
+
+// AnomalyPolicy is what the detector considers unusual
+type AnomalyPolicy struct {
+	MinEvents   int     // windows with fewer payments are not judged
+	SpikeFactor float64 // rejections over this multiple of the baseline are a spike
+	PayerShare  float64 // fraction of accepted payments from one payer that is an anomaly
+	NearMiss    float64 // fraction below the price that counts as a near miss
+}
+
+// Anomaly is an unusual pattern in payment traffic
+type Anomaly struct {
+	Kind       string  `json:"kind"`
+	Subject    string  `json:"subject,omitempty"` // the payer, for per-payer anomalies
+	Message    string  `json:"message"`
+	Value      float64 `json:"value"`     // what was observed
+	Threshold  float64 `json:"threshold"` // what it was judged against
+	StartedAt  int64   `json:"started_at"`
+	ResolvedAt int64   `json:"resolved_at,omitempty"`
+}
+
+func (a Anomaly) key() string { return a.Kind + " " + a.Subject }
+
+// AnomalyDetector watches payment traffic for unusual patterns: spikes in
+// refused payments, one payer generating nearly all of the traffic, and
+// repeated payments just below the price. The paywall reports each payment
+// and Check judges them once per window, notifying when an anomaly starts
+// and ends. Each replica watches its own traffic. A nil *AnomalyDetector
+// ignores everything.
+type AnomalyDetector struct {
+	policy   AnomalyPolicy
+	window   time.Duration
+	notifier *Notifier
+	clock    clock.Clock
+
+	mu         sync.Mutex
+	accepted   int
+	rejected   int
+	payers     map[string]int // payer -> accepted payments this window
+	nearMisses map[string]int // payer -> underpayments just below the price
+	baseline   float64        // rejections per calm window, smoothed
+	active     map[string]*Anomaly
+	history    []*Anomaly // newest last
+}
+
+// NewAnomalyDetector creates a detector. Call Check once per window.
+func NewAnomalyDetector(policy AnomalyPolicy, window time.Duration, notifier *Notifier) *AnomalyDetector {
+	return &AnomalyDetector{
+		policy:     policy,
+		window:     window,
+		notifier:   notifier,
+		clock:      clock.System,
+		payers:     make(map[string]int),
+		nearMisses: make(map[string]int),
+		active:     make(map[string]*Anomaly),
+	}
+}
+
+// Accepted counts a captured payment from payer
+func (d *AnomalyDetector) Accepted(payer string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.accepted++
+	d.payers[payer]++
+}
+
+// onPaymentVerified counts a captured payment
+func (d *AnomalyDetector) onPaymentVerified(_ context.Context, e Event) error {
+	d.Accepted(e.Data.(VerifiedPayment).Entry.Payer)
+	return nil
+}
+
+// Rejected counts a refused payment token. Tokens paying just under
+// minAmount are counted as near misses for their payer.
+func (d *AnomalyDetector) Rejected(token, minAmount string) {
+	if d == nil {
+		return
+	}
+	var payer string
+	var amount float64
+	claims := &PaymentToken{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err == nil {
+		payer = payerFromClaims(claims, "").String()
+		amount, _ = strconv.ParseFloat(claims.Payment.Amount, 64)
+	}
+	min, _ := strconv.ParseFloat(minAmount, 64)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rejected++
+	if payer != "" && amount > 0 && amount < min && amount >= min*(1-d.policy.NearMiss) {
+		d.nearMisses[payer]++
+	}
+}
+
+// Check judges the traffic since the last check and resets the counts
+func (d *AnomalyDetector) Check() {
+	d.mu.Lock()
+	accepted, rejected, payers, nearMisses := d.accepted, d.rejected, d.payers, d.nearMisses
+	d.accepted, d.rejected = 0, 0
+	d.payers, d.nearMisses = make(map[string]int), make(map[string]int)
+	baseline := d.baseline
+	d.mu.Unlock()
+
+	var found []Anomaly
+	spike := math.Max(float64(d.policy.MinEvents), d.policy.SpikeFactor*baseline)
+	if float64(rejected) >= spike && rejected > accepted {
+		found = append(found, Anomaly{
+			Kind:      AnomalyRejectionSpike,
+			Message:   fmt.Sprintf("%d payments refused in the last %s, against %.1f usually", rejected, d.window, baseline),
+			Value:     float64(rejected),
+			Threshold: round(spike, 1),
+		})
+	} else {
+		baseline += baselineWeight * (float64(rejected) - baseline)
+	}
+
+	if accepted >= d.policy.MinEvents {
+		for payer, n := range payers {
+			if share := float64(n) / float64(accepted); share >= d.policy.PayerShare {
+				found = append(found, Anomaly{
+					Kind:      AnomalyPayerConcentration,
+					Subject:   payer,
+					Message:   fmt.Sprintf("%s made %.0f%% of the %d payments in the last %s", payer, share*100, accepted, d.window),
+					Value:     round(share, 4),
+					Threshold: d.policy.PayerShare,
+				})
+			}
+		}
+	}
+
+	for payer, n := range nearMisses {
+		if n >= nearMissAlert {
+			found = append(found, Anomaly{
+				Kind:      AnomalyNearThreshold,
+				Subject:   payer,
+				Message:   fmt.Sprintf("%s paid just under the price %d times in the last %s", payer, n, d.window),
+				Value:     float64(n),
+				Threshold: nearMissAlert,
+			})
+		}
+	}
+
+	d.mu.Lock()
+	d.baseline = baseline
+	started, ended := d.update(found)
+	d.mu.Unlock()
+
+	for _, a := range started {
+		log.Printf("🕵️  Anomaly: %s", a.Message)
+		d.notify(a, "started", a.Message)
+	}
+	for _, a := range ended {
+		message := fmt.Sprintf("Anomaly over: %s %s", a.Kind, a.Subject)
+		log.Printf("🕵️  %s", message)
+		d.notify(a, "resolved", message)
+	}
+}
+
+// update opens the anomalies in found that are new and resolves the
+// active ones that are gone. Call it with d.mu held.
+func (d *AnomalyDetector) update(found []Anomaly) (started, ended []Anomaly) {
+	now := d.clock.Now().Unix()
+	seen := make(map[string]bool, len(found))
+	for _, a := range found {
+		seen[a.key()] = true
+		if open, ok := d.active[a.key()]; ok {
+			open.Message, open.Value, open.Threshold = a.Message, a.Value, a.Threshold
+			continue
+		}
+		a.StartedAt = now
+		started = append(started, a)
+	}
+	for key, open := range d.active {
+		if !seen[key] {
+			open.ResolvedAt = now
+			delete(d.active, key)
+			ended = append(ended, *open)
+		}
+	}
+	sort.Slice(started, func(i, j int) bool { return started[i].key() < started[j].key() })
+	sort.Slice(ended, func(i, j int) bool { return ended[i].key() < ended[j].key() })
+
+	for _, a := range started {
+		open := a
+		d.active[a.key()] = &open
+		d.history = append(d.history, &open)
+	}
+	if len(d.history) > maxAnomalies {
+		d.history = d.history[len(d.history)-maxAnomalies:]
+	}
+	return started, ended
+}
+
+func (d *AnomalyDetector) notify(a Anomaly, status, message string) {
+	d.notifier.Notify(NotifyMonitor, map[string]string{
+		"monitor": "anomaly",
+		"kind":    a.Kind,
+		"subject": a.Subject,
+		"status":  status,
+		"value":   strconv.FormatFloat(a.Value, 'f', -1, 64),
+		"message": message,
+	})
+}
+
+// Anomalies returns the active anomalies and the recent ones, newest first
+func (d *AnomalyDetector) Anomalies() (active, recent []Anomaly) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	active, recent = []Anomaly{}, make([]Anomaly, 0, len(d.history))
+	for i := len(d.history) - 1; i >= 0; i-- {
+		a := *d.history[i]
+		if a.ResolvedAt == 0 {
+			active = append(active, a)
+		}
+		recent = append(recent, a)
+	}
+	return active, recent
+}
+
+// handleAdminAnomalies serves GET /admin/anomalies
+func (d *AnomalyDetector) handleAdminAnomalies(w http.ResponseWriter, r *http.Request) {
+	active, recent := d.Anomalies()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window": d.window.String(),
+		"active": active,
+		"recent": recent,
+	})
+}
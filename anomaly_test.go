@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnomalyDetector(t *testing.T) {
+	srv, got := notifyTarget(t)
+	t.Setenv("TEST_SLACK_URL", srv.URL)
+	useNotifiers(t, `[{"name": "ops", "type": "slack", "url_env": "TEST_SLACK_URL"}]`)
+	d := NewAnomalyDetector(AnomalyPolicy{MinEvents: 10, SpikeFactor: 3, PayerShare: 0.9, NearMiss: 0.1}, 5*time.Minute, NewNotifier())
+
+	token := func(payer, amount string) string {
+		claims := PaymentToken{}
+		claims.Payment.Amount = amount
+		claims.Subject = payer
+		return signPayment(t, claims)
+	}
+	traffic := func(payers map[string]int, rejected int) {
+		for payer, n := range payers {
+			for range n {
+				d.Accepted(payer)
+			}
+		}
+		for range rejected {
+			d.Rejected("garbage", "0.001")
+		}
+	}
+
+	// Calm windows set the baseline
+	traffic(map[string]int{"0xa": 10, "0xb": 10}, 2)
+	d.Check()
+	if active, _ := d.Anomalies(); len(active) != 0 {
+		t.Fatalf("calm window flagged %+v", active)
+	}
+
+	// A flood of refused payments, one payer taking over and near misses
+	traffic(map[string]int{"0xa": 19, "0xb": 1}, 30)
+	for range 3 {
+		d.Rejected(token("0xc", "0.00095"), "0.001")
+	}
+	d.Rejected(token("0xd", "0.0005"), "0.001") // too far under to be a near miss
+	d.Check()
+	active, _ := d.Anomalies()
+	kinds := []string{}
+	for _, a := range active {
+		kinds = append(kinds, a.Kind+":"+a.Subject)
+	}
+	if strings.Join(kinds, " ") != "rejection_spike: payer_concentration:0xa near_threshold:0xc" {
+		t.Errorf("active anomalies = %v", kinds)
+	}
+	for range 3 {
+		if body := receive(t, got); !strings.HasPrefix(body["text"], "🚨 ") {
+			t.Errorf("alert = %v", body)
+		}
+	}
+
+	// Anomalies still present are not announced again; gone ones resolve
+	traffic(map[string]int{"0xa": 19, "0xb": 1}, 0)
+	d.Check()
+	active, recent := d.Anomalies()
+	if len(active) != 1 || active[0].Kind != AnomalyPayerConcentration || len(recent) != 3 {
+		t.Errorf("after calm rejections: active %+v, recent %+v", active, recent)
+	}
+	for range 2 {
+		if body := receive(t, got); !strings.Contains(body["text"], "Anomaly over") {
+			t.Errorf("resolution = %v", body)
+		}
+	}
+	select {
+	case body := <-got:
+		t.Errorf("extra notification %v", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Attester produces attestation documents proving the service runs inside
+// a trusted execution environment
+type Attester interface {
+	// Platform names the TEE, e.g. "aws-nitro"
+	Platform() string
+	// Attest returns a signed attestation document binding nonce and
+	// publicKey (either may be nil)
+	Attest(nonce, publicKey []byte) ([]byte, error)
+}
+
+// attester is nil unless the service runs inside a supported TEE
+var attester Attester
+
+// maxAttestationNonce is the largest nonce accepted from clients, in bytes
+const maxAttestationNonce = 64
+
+// nsmDevice is the Nitro Secure Module, present only inside an enclave
+const nsmDevice = "/dev/nsm"
+
+// detectAttester picks an attester for TEE_ATTESTATION: "off", "nitro", or
+// "auto" (default) to use the Nitro Secure Module when it is present
+func detectAttester(mode string) (Attester, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "off":
+		return nil, nil
+	case "", "auto":
+		if _, err := os.Stat(nsmDevice); err != nil {
+			return nil, nil
+		}
+		return nitroAttester{device: nsmDevice}, nil
+	case "nitro":
+		if _, err := os.Stat(nsmDevice); err != nil {
+			return nil, fmt.Errorf("nitro attestation requested but %s is unavailable: %w", nsmDevice, err)
+		}
+		return nitroAttester{device: nsmDevice}, nil
+	}
+	return nil, fmt.Errorf("unknown attestation mode %q (want auto, nitro or off)", mode)
+}
+
+// handleAttestation serves /.well-known/attestation (free). Clients pass a
+// fresh hex nonce so the document cannot be replayed. When response
+// signing is enabled its public key is bound into the document, tying
+// signed responses to the attested environment.
+func handleAttestation(w http.ResponseWriter, r *http.Request) {
+	if attester == nil {
+		http.Error(w, `{"error":"Not running in a trusted execution environment"}`, http.StatusNotFound)
+		return
+	}
+
+	nonce, err := hex.DecodeString(strings.TrimPrefix(r.URL.Query().Get("nonce"), "0x"))
+	if err != nil || len(nonce) > maxAttestationNonce {
+		http.Error(w, fmt.Sprintf(`{"error":"nonce must be hex, at most %d bytes"}`, maxAttestationNonce), http.StatusBadRequest)
+		return
+	}
+
+	var publicKey []byte
+	if responseSigner != nil {
+		publicKey = responseSigner.PublicKey()
+	}
+	doc, err := attester.Attest(nonce, publicKey)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "attestation failed: "+err.Error()), http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"platform": attester.Platform(),
+		"format":   "cose_sign1",
+		"document": base64.StdEncoding.EncodeToString(doc),
+		"nonce":    hex.EncodeToString(nonce),
+	}
+	if publicKey != nil {
+		resp["public_key"] = base64.StdEncoding.EncodeToString(publicKey)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// nitroAttester requests attestation documents from the AWS Nitro Secure
+// Module. The request and response are CBOR; the document is a COSE_Sign1
+// structure signed by the AWS Nitro PKI.
+type nitroAttester struct {
+	device string
+}
+
+func (nitroAttester) Platform() string { return "aws-nitro" }
+
+func (a nitroAttester) Attest(nonce, publicKey []byte) ([]byte, error) {
+	req := encodeNSMAttestationRequest(nonce, publicKey)
+	resp, err := nsmCall(a.device, req)
+	if err != nil {
+		return nil, err
+	}
+	return decodeNSMAttestationResponse(resp)
+}
+
+// encodeNSMAttestationRequest builds the CBOR request
+// {"Attestation": {"user_data": null, "nonce": ..., "public_key": ...}}
+func encodeNSMAttestationRequest(nonce, publicKey []byte) []byte {
+	var b []byte
+	b = cborHead(b, 5, 1)
+	b = cborText(b, "Attestation")
+	b = cborHead(b, 5, 3)
+	b = cborText(b, "user_data")
+	b = cborBytesOrNull(b, nil)
+	b = cborText(b, "nonce")
+	b = cborBytesOrNull(b, nonce)
+	b = cborText(b, "public_key")
+	b = cborBytesOrNull(b, publicKey)
+	return b
+}
+
+// decodeNSMAttestationResponse extracts the document from
+// {"Attestation": {"document": ...}} or reports {"Error": ...}
+func decodeNSMAttestationResponse(b []byte) ([]byte, error) {
+	v, _, err := cborDecode(b)
+	if err != nil {
+		return nil, fmt.Errorf("decoding NSM response: %w", err)
+	}
+	m, _ := v.(map[string]interface{})
+	if e, ok := m["Error"]; ok {
+		return nil, fmt.Errorf("NSM error: %v", e)
+	}
+	inner, _ := m["Attestation"].(map[string]interface{})
+	doc, ok := inner["document"].([]byte)
+	if !ok || len(doc) == 0 {
+		return nil, errors.New("NSM response has no attestation document")
+	}
+	return doc, nil
+}
+
+// ==================== CBOR ====================
+//
+// Just enough CBOR (RFC 8949) for the NSM protocol: definite-length maps
+// with text keys, byte strings, text, integers and simple values.
+
+func cborHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= 0xff:
+		return append(b, m|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, m|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, m|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, m|27), n)
+}
+
+func cborText(b []byte, s string) []byte {
+	return append(cborHead(b, 3, uint64(len(s))), s...)
+}
+
+func cborBytesOrNull(b []byte, v []byte) []byte {
+	if v == nil {
+		return append(b, 0xf6)
+	}
+	return append(cborHead(b, 2, uint64(len(v))), v...)
+}
+
+// cborDecode decodes one item from b and returns it with the remaining
+// input. Maps become map[string]interface{}, byte strings []byte.
+func cborDecode(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errors.New("unexpected end of CBOR input")
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	b = b[1:]
+
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(b) < size {
+			return nil, nil, errors.New("unexpected end of CBOR input")
+		}
+		for _, c := range b[:size] {
+			n = n<<8 | uint64(c)
+		}
+		b = b[size:]
+	default:
+		return nil, nil, fmt.Errorf("unsupported CBOR additional info %d", info)
+	}
+
+	switch major {
+	case 0:
+		return n, b, nil
+	case 1:
+		return -1 - int64(n), b, nil
+	case 2, 3:
+		if uint64(len(b)) < n {
+			return nil, nil, errors.New("unexpected end of CBOR input")
+		}
+		if major == 2 {
+			return append([]byte(nil), b[:n]...), b[n:], nil
+		}
+		return string(b[:n]), b[n:], nil
+	case 4:
+		if n > uint64(len(b)) {
+			return nil, nil, errors.New("CBOR array longer than input")
+		}
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var item interface{}
+			var err error
+			if item, b, err = cborDecode(b); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, b, nil
+	case 5:
+		if n > uint64(len(b)) {
+			return nil, nil, errors.New("CBOR map longer than input")
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			var k, v interface{}
+			var err error
+			if k, b, err = cborDecode(b); err != nil {
+				return nil, nil, err
+			}
+			if v, b, err = cborDecode(b); err != nil {
+				return nil, nil, err
+			}
+			m[fmt.Sprint(k)] = v
+		}
+		return m, b, nil
+	case 6:
+		return cborDecode(b) // tags carry no meaning here
+	}
+	switch info {
+	case 20:
+		return false, b, nil
+	case 21:
+		return true, b, nil
+	case 22, 23:
+		return nil, b, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported CBOR simple value %d", info)
+}
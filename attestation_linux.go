@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// nsmIoctlRequest is _IOWR(0x0A, 0, struct nsm_message)
+const nsmIoctlRequest = 3<<30 | unsafe.Sizeof(nsmMessage{})<<16 | 0x0A<<8
+
+// nsmMaxResponse is the largest response the NSM driver returns
+const nsmMaxResponse = 0x3000
+
+// nsmMessage mirrors the driver's struct nsm_message: two iovecs
+type nsmMessage struct {
+	request  syscall.Iovec
+	response syscall.Iovec
+}
+
+// nsmCall sends a CBOR request to the Nitro Secure Module and returns its
+// CBOR response
+func nsmCall(device string, req []byte) ([]byte, error) {
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	resp := make([]byte, nsmMaxResponse)
+	msg := nsmMessage{}
+	msg.request.Base = &req[0]
+	msg.request.SetLen(len(req))
+	msg.response.Base = &resp[0]
+	msg.response.SetLen(len(resp))
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), nsmIoctlRequest, uintptr(unsafe.Pointer(&msg))); errno != 0 {
+		return nil, fmt.Errorf("NSM ioctl: %w", errno)
+	}
+	return resp[:msg.response.Len], nil
+}
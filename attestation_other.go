@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// nsmCall is only available on Linux, where Nitro enclaves run
+func nsmCall(device string, req []byte) ([]byte, error) {
+	return nil, errors.New("NSM is only available on Linux")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeAttester struct {
+	nonce, publicKey []byte
+}
+
+func (*fakeAttester) Platform() string { return "fake" }
+
+func (f *fakeAttester) Attest(nonce, publicKey []byte) ([]byte, error) {
+	f.nonce, f.publicKey = nonce, publicKey
+	return []byte("cose-document"), nil
+}
+
+func TestAttestationEndpoint(t *testing.T) {
+	serve := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleAttestation(rr, httptest.NewRequest("GET", "/.well-known/attestation"+query, nil))
+		return rr
+	}
+
+	attester = nil
+	if rr := serve(""); rr.Code != http.StatusNotFound {
+		t.Errorf("outside a TEE: %d, want 404", rr.Code)
+	}
+
+	fake := &fakeAttester{}
+	attester = fake
+	defer func() { attester = nil }()
+
+	rr := serve("?nonce=c0ffee")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("attestation returned %d: %s", rr.Code, rr.Body)
+	}
+	var body struct {
+		Platform string `json:"platform"`
+		Document []byte `json:"document"`
+		Nonce    string `json:"nonce"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Platform != "fake" || string(body.Document) != "cose-document" || body.Nonce != "c0ffee" {
+		t.Errorf("unexpected body: %s", rr.Body)
+	}
+	if !bytes.Equal(fake.nonce, []byte{0xc0, 0xff, 0xee}) {
+		t.Errorf("nonce passed to attester = %x", fake.nonce)
+	}
+
+	if rr := serve("?nonce=zz"); rr.Code != http.StatusBadRequest {
+		t.Errorf("bad nonce: %d, want 400", rr.Code)
+	}
+
+	manifest := httptest.NewRecorder()
+	handleOASFManifest(manifest, httptest.NewRequest("GET", "/.well-known/oasf.json", nil))
+	var m OASFManifest
+	json.Unmarshal(manifest.Body.Bytes(), &m)
+	if !m.Capabilities.TEESupported || m.Capabilities.TEEPlatform != "fake" || m.Endpoints.Attestation == "" {
+		t.Errorf("manifest capabilities = %+v", m.Capabilities)
+	}
+}
+
+func TestNSMMessages(t *testing.T) {
+	req := encodeNSMAttestationRequest([]byte{1, 2}, nil)
+	v, rest, err := cborDecode(req)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("request does not decode: %v (%d bytes left)", err, len(rest))
+	}
+	inner := v.(map[string]interface{})["Attestation"].(map[string]interface{})
+	if !bytes.Equal(inner["nonce"].([]byte), []byte{1, 2}) || inner["public_key"] != nil || inner["user_data"] != nil {
+		t.Errorf("request = %#v", inner)
+	}
+
+	// {"Attestation": {"document": h'd28443'}}
+	var resp []byte
+	resp = cborHead(resp, 5, 1)
+	resp = cborText(resp, "Attestation")
+	resp = cborHead(resp, 5, 1)
+	resp = cborText(resp, "document")
+	resp = cborBytesOrNull(resp, []byte{0xd2, 0x84, 0x43})
+	if doc, err := decodeNSMAttestationResponse(resp); err != nil || !bytes.Equal(doc, []byte{0xd2, 0x84, 0x43}) {
+		t.Errorf("document = %x, %v", doc, err)
+	}
+
+	// {"Error": "InvalidArgument"}
+	resp = cborText(cborHead(nil, 5, 1), "Error")
+	resp = cborText(resp, "InvalidArgument")
+	if _, err := decodeNSMAttestationResponse(resp); err == nil {
+		t.Error("NSM error not reported")
+	}
+
+	if _, _, err := cborDecode([]byte{0x5a, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Error("truncated byte string decoded")
+	}
+}
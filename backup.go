@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/backup"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// BackupResult describes a completed backup
+type BackupResult struct {
+	Name     string          `json:"name"`
+	SHA256   string          `json:"sha256"`
+	Size     int             `json:"size"`
+	Manifest backup.Manifest `json:"manifest"`
+}
+
+// Backups exports the ledger and async jobs to BACKUP_DEST. Archives are
+// built from in-memory state under each store's lock, so they are
+// consistent without pausing the service. Restore with
+// cmd/restore-backup while the service is stopped.
+type Backups struct {
+	store  backup.Store
+	ledger *Ledger
+	jobs   *JobManager
+	clock  clock.Clock
+}
+
+// NewBackups creates a backup exporter writing to store
+func NewBackups(store backup.Store, ledger *Ledger, jobs *JobManager) *Backups {
+	return &Backups{store: store, ledger: ledger, jobs: jobs, clock: clock.System}
+}
+
+// Backup writes one archive and its checksum to the store
+func (b *Backups) Backup() (BackupResult, error) {
+	files, err := b.ledger.Snapshot()
+	if err != nil {
+		return BackupResult{}, fmt.Errorf("ledger snapshot: %w", err)
+	}
+	jobs, err := b.jobs.Snapshot()
+	if err != nil {
+		return BackupResult{}, fmt.Errorf("jobs snapshot: %w", err)
+	}
+	files["jobs.json"] = jobs
+
+	now := b.clock.Now()
+	archive, manifest, err := backup.Create(files, now)
+	if err != nil {
+		return BackupResult{}, err
+	}
+	name := backup.Name(now)
+	if err := backup.Upload(b.store, name, archive); err != nil {
+		return BackupResult{}, fmt.Errorf("uploading %s: %w", name, err)
+	}
+	log.Printf("💾 Backed up %d files to %s", len(manifest.Files), name)
+	return BackupResult{Name: name, SHA256: backup.Checksum(archive), Size: len(archive), Manifest: manifest}, nil
+}
+
+// handleAdminBackup serves POST /admin/backup, taking a backup immediately
+func (b *Backups) handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	if b == nil {
+		http.Error(w, `{"error":"Backups are not configured"}`, http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	result, err := b.Backup()
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "backup failed: "+err.Error()), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
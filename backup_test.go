@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/backup"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	ledger, err := NewLedger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := NewJobManager(dir, 0, NewMetrics())
+	ledger.Record(LedgerEntry{Endpoint: "/api/gas", Payer: alice, Amount: "0.001"})
+	ledger.Record(LedgerEntry{Tenant: "agent-b", Endpoint: "/api/price", Payer: bob, Amount: "0.002"})
+	jobs.jobs["done"] = &Job{ID: "done", Status: JobSucceeded, Body: []byte(`{"ok":true}`)}
+
+	store := backup.DirStore(t.TempDir())
+	b := NewBackups(store, ledger, jobs)
+	b.clock = clock.NewFake(epoch)
+
+	rec := httptest.NewRecorder()
+	b.handleAdminBackup(rec, httptest.NewRequest(http.MethodPost, "/admin/backup", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("backup returned %d: %s", rec.Code, rec.Body)
+	}
+
+	archive, err := backup.Download(store, backup.Name(epoch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := t.TempDir()
+	manifest, err := backup.Restore(archive, restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 3 {
+		t.Errorf("manifest = %+v", manifest.Files)
+	}
+
+	reopened, err := NewLedger(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Entries("agent-b"); len(got) != 1 || got[0].Payer != bob {
+		t.Errorf("restored agent-b partition = %+v", got)
+	}
+	if len(reopened.Entries(DefaultTenant)) != 1 {
+		t.Error("default partition not restored")
+	}
+	restoredJobs := NewJobManager(restored, 0, NewMetrics())
+	if job, ok := restoredJobs.Get("done"); !ok || string(job.Body) != `{"ok":true}` {
+		t.Errorf("restored job = %+v, %v", job, ok)
+	}
+}
+
+func TestAdminBackupDisabled(t *testing.T) {
+	var b *Backups
+	rec := httptest.NewRecorder()
+	b.handleAdminBackup(rec, httptest.NewRequest(http.MethodPost, "/admin/backup", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unconfigured backup returned %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// defaultBeaconURL is used unless BEACON_API_URL is set
+const defaultBeaconURL = "https://ethereum-beacon-api.publicnode.com"
+
+// beaconEpoch is how long beacon state results are cached. The validator
+// set only changes at epoch boundaries (32 slots of 12 seconds).
+const beaconEpoch = 384 * time.Second
+
+// Standard Eth Beacon API routes
+const (
+	beaconActiveValidatorsRoute = "/eth/v1/beacon/states/head/validators?status=active"
+	beaconPendingDepositsRoute  = "/eth/v1/beacon/states/head/pending_deposits"
+)
+
+// BeaconError is an error response from a beacon node. The Beacon API
+// reports errors as {"code": ..., "message": ...}.
+type BeaconError struct {
+	Node    string
+	Route   string
+	Status  int
+	Message string
+}
+
+func (e *BeaconError) Error() string {
+	return fmt.Sprintf("beacon node %s: %s: %d %s", e.Node, e.Route, e.Status, e.Message)
+}
+
+// retryable reports whether another attempt could succeed
+func (e *BeaconError) retryable() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// BeaconClient queries the standard Eth Beacon API. Requests go to the
+// configured nodes in order until one answers; network errors, 429 and 5xx
+// responses are retried with backoff. Results are cached for an epoch and
+// shared by every caller.
+type BeaconClient struct {
+	urls     []string
+	client   *http.Client
+	cache    *Cache
+	attempts int
+	backoff  time.Duration
+
+	validators lastGood[ValidatorData] // refreshed in the background
+}
+
+// validatorSnapshotMaxAge is the oldest validator snapshot served before
+// falling back to a live fetch: one missed refresh is tolerated
+const validatorSnapshotMaxAge = 2 * beaconEpoch
+
+// NewBeaconClient creates a client for the given beacon nodes, in order of
+// preference
+func NewBeaconClient(urls []string, timeout time.Duration) *BeaconClient {
+	nodes := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			nodes = append(nodes, u)
+		}
+	}
+	if len(nodes) == 0 {
+		nodes = []string{defaultBeaconURL}
+	}
+	return &BeaconClient{
+		urls:     nodes,
+		client:   &http.Client{Timeout: timeout, Transport: upstreamLimiter},
+		cache:    NewCache(beaconEpoch),
+		attempts: 3,
+		backoff:  500 * time.Millisecond,
+	}
+}
+
+// beaconClient is shared by the REST, GraphQL and MCP validator endpoints.
+// newService replaces it with one built from BEACON_API_URL.
+var beaconClient = NewBeaconClient(nil, 60*time.Second)
+
+// get fetches route and passes the body of the first successful response
+// to decode
+func (c *BeaconClient) get(route string, decode func(io.Reader) error) error {
+	var lastErr error
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.backoff << (attempt - 1))
+		}
+		retry := false
+		for _, node := range c.urls {
+			err := c.getFrom(node, route, decode)
+			if err == nil {
+				return nil
+			}
+			lastErr = err
+			var be *BeaconError
+			if !errors.As(err, &be) || be.retryable() {
+				retry = true
+				log.Printf("⚠️  Beacon node %s failed for %s: %v", node, route, err)
+			}
+		}
+		if !retry {
+			break
+		}
+	}
+	return lastErr
+}
+
+func (c *BeaconClient) getFrom(node, route string, decode func(io.Reader) error) error {
+	req, err := http.NewRequest(http.MethodGet, node+route, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body)
+		if body.Message == "" {
+			body.Message = http.StatusText(resp.StatusCode)
+		}
+		return &BeaconError{Node: node, Route: route, Status: resp.StatusCode, Message: body.Message}
+	}
+	if err := decode(resp.Body); err != nil {
+		return fmt.Errorf("beacon node %s: %s: %w", node, route, err)
+	}
+	return nil
+}
+
+// count returns the length of the data array served at route, cached for
+// an epoch. The array is streamed so the full validator set (a million
+// entries) is never held in memory.
+func (c *BeaconClient) count(route string) (int, error) {
+	if cached, ok := c.cache.Get(route); ok {
+		return cached.(int), nil
+	}
+	var n int
+	err := c.get(route, func(r io.Reader) (err error) {
+		n, err = countDataArray(r)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	c.cache.Set(route, n)
+	return n, nil
+}
+
+// countDataArray counts the elements of the top-level "data" array of a
+// Beacon API response
+func countDataArray(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return 0, fmt.Errorf("invalid beacon API response")
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return 0, err
+		}
+		if key != "data" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return 0, fmt.Errorf("invalid beacon API response: data is not a list")
+		}
+		n := 0
+		for dec.More() {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return 0, err
+			}
+			n++
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid beacon API response: no data")
+}
+
+// fetchValidatorData returns the active validator count and deposit queue
+func (c *BeaconClient) fetchValidatorData() (*ValidatorData, error) {
+	activeValidators, err := c.count(beaconActiveValidatorsRoute)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pending deposit queue only exists from Electra on; older nodes
+	// answer 404 or 400 and the queue is reported as empty
+	pendingDeposits, err := c.count(beaconPendingDepositsRoute)
+	if err != nil {
+		var be *BeaconError
+		if !errors.As(err, &be) || (be.Status != http.StatusNotFound && be.Status != http.StatusBadRequest) {
+			return nil, err
+		}
+		pendingDeposits = 0
+		c.cache.Set(beaconPendingDepositsRoute, 0)
+	}
+
+	// Estimate wait times based on churn limit
+	// Current churn limit is ~8 validators per epoch (1800 per day)
+	// Entry queue is roughly pending deposits / 1800 * 24 hours
+	entryQueueHours := 0
+	if pendingDeposits > 0 {
+		entryQueueHours = pendingDeposits / 75 // ~75 validators per hour
+	}
+
+	now := time.Now().Unix()
+	return &ValidatorData{
+		Timestamp: now,
+		AsOf:      now,
+		Queue: map[string]interface{}{
+			"entry_wait_hours":      entryQueueHours,
+			"exit_wait_hours":       0,
+			"churn_limit_per_epoch": 8,
+			"churn_limit_per_day":   1800,
+		},
+		Active:          activeValidators,
+		PendingDeposits: pendingDeposits,
+		DataQuality:     types.DataQuality{Quality: types.QualityLive},
+	}, nil
+}
+
+// RefreshValidators re-reads the validator data from the beacon nodes,
+// past the epoch cache, and makes it the snapshot paid requests are served
+// from. The scheduler calls it once an epoch.
+func (c *BeaconClient) RefreshValidators() {
+	c.cache.Delete(beaconActiveValidatorsRoute)
+	c.cache.Delete(beaconPendingDepositsRoute)
+	data, err := c.fetchValidatorData()
+	if err != nil {
+		log.Printf("⚠️  Validator refresh failed, serving the previous snapshot: %v", err)
+		return
+	}
+	c.validators.Store(*data)
+}
+
+// ValidatorData returns the validator data from the background snapshot,
+// marked cached with the time it was read as as_of. Without a recent
+// snapshot it is fetched on the spot.
+func (c *BeaconClient) ValidatorData() (*ValidatorData, error) {
+	if snapshot, age, ok := c.validators.Load(validatorSnapshotMaxAge); ok {
+		snapshot.Timestamp = time.Now().Unix()
+		snapshot.DataQuality = types.DataQuality{Quality: types.QualityCached, StalenessSeconds: int64(age.Seconds())}
+		return &snapshot, nil
+	}
+	data, err := c.fetchValidatorData()
+	if err != nil {
+		return nil, err
+	}
+	c.validators.Store(*data)
+	return data, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// beaconNode serves n active validators and, if deposits >= 0, a deposit
+// queue of that length. Older nodes without the queue pass deposits < 0.
+func beaconNode(t *testing.T, validators, deposits int, hits *int64) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(hits, 1)
+		n := validators
+		switch {
+		case r.URL.Path == "/eth/v1/beacon/states/head/validators" && r.URL.Query().Get("status") == "active":
+		case r.URL.Path == "/eth/v1/beacon/states/head/pending_deposits" && deposits >= 0:
+			n = deposits
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":404,"message":"Route not found"}`)
+			return
+		}
+		items := make([]string, n)
+		for i := range items {
+			items[i] = fmt.Sprintf(`{"index":"%d"}`, i)
+		}
+		fmt.Fprintf(w, `{"execution_optimistic":false,"data":[%s],"finalized":true}`, strings.Join(items, ","))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func failingNode(t *testing.T, status int, hits *int64) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(hits, 1)
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"code":%d,"message":"node is syncing"}`, status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBeaconClientFallback(t *testing.T) {
+	var downHits, upHits int64
+	down := failingNode(t, http.StatusServiceUnavailable, &downHits)
+	up := beaconNode(t, 5, 3, &upHits)
+
+	client := NewBeaconClient([]string{down.URL, up.URL + "/"}, time.Second)
+	data, err := client.fetchValidatorData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Active != 5 || data.PendingDeposits != 3 {
+		t.Errorf("active=%d pending=%d, want 5 and 3", data.Active, data.PendingDeposits)
+	}
+	if downHits != 2 || upHits != 2 {
+		t.Errorf("hits: down=%d up=%d, want 2 each", downHits, upHits)
+	}
+
+	// Served from the shared cache for the rest of the epoch
+	if _, err := client.fetchValidatorData(); err != nil {
+		t.Fatal(err)
+	}
+	if upHits != 2 {
+		t.Errorf("cached data refetched: %d hits", upHits)
+	}
+}
+
+func TestBeaconClientRetriesAndErrors(t *testing.T) {
+	var hits int64
+	client := NewBeaconClient([]string{failingNode(t, http.StatusInternalServerError, &hits).URL}, time.Second)
+	client.backoff = time.Millisecond
+
+	_, err := client.fetchValidatorData()
+	var be *BeaconError
+	if !errors.As(err, &be) || be.Status != http.StatusInternalServerError || be.Message != "node is syncing" {
+		t.Fatalf("err = %v, want a BeaconError with the node's message", err)
+	}
+	if hits != int64(client.attempts) {
+		t.Errorf("%d attempts, want %d", hits, client.attempts)
+	}
+
+	// Client errors are not retried
+	hits = 0
+	client = NewBeaconClient([]string{failingNode(t, http.StatusBadRequest, &hits).URL}, time.Second)
+	if _, err := client.count(beaconActiveValidatorsRoute); err == nil || hits != 1 {
+		t.Errorf("err=%v after %d attempts, want one failed attempt", err, hits)
+	}
+}
+
+func TestBeaconClientWithoutDepositQueue(t *testing.T) {
+	var hits int64
+	client := NewBeaconClient([]string{beaconNode(t, 7, -1, &hits).URL}, time.Second)
+	data, err := client.fetchValidatorData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Active != 7 || data.PendingDeposits != 0 {
+		t.Errorf("active=%d pending=%d, want 7 and 0", data.Active, data.PendingDeposits)
+	}
+}
+
+func TestBeaconValidatorSnapshot(t *testing.T) {
+	var hits int64
+	client := NewBeaconClient([]string{beaconNode(t, 5, 3, &hits).URL}, time.Second)
+	fake := clock.NewFake(time.Now())
+	client.validators.clock = fake
+
+	client.RefreshValidators()
+	if hits != 2 {
+		t.Fatalf("refresh made %d requests, want 2", hits)
+	}
+
+	// Paid requests are served from the snapshot with its age
+	fake.Advance(time.Minute)
+	data, err := client.ValidatorData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits != 2 || data.Active != 5 || data.Quality != types.QualityCached || data.StalenessSeconds != 60 || data.AsOf == 0 {
+		t.Errorf("served %+v after %d requests, want the snapshot", data, hits)
+	}
+
+	// A refresh goes past the epoch cache
+	client.RefreshValidators()
+	if hits != 4 {
+		t.Errorf("second refresh: %d requests, want 4", hits)
+	}
+
+	// Without a recent snapshot the data is fetched on the spot
+	fake.Advance(validatorSnapshotMaxAge + time.Second)
+	client.cache.Delete(beaconActiveValidatorsRoute)
+	client.cache.Delete(beaconPendingDepositsRoute)
+	if data, err := client.ValidatorData(); err != nil || data.Quality != types.QualityLive || hits != 6 {
+		t.Errorf("expired snapshot: %+v, %v after %d requests", data, err, hits)
+	}
+}
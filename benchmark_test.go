@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestBenchmark(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+	up.SetContract("0x833589fcd6edb6e08f4c7c32d4f71b54bda02913", testhttp.Contract{Verified: true, Proxy: true})
+
+	fake := clock.NewFake(epoch)
+	benchmark := NewBenchmark(NewPromptGuard())
+	benchmark.SetClock(fake)
+
+	report := benchmark.Report()
+	if len(report.Cases) != len(benchmarkFixtures) || report.RanAt != epoch.Unix() {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, c := range report.Cases {
+		if !c.Passed {
+			t.Errorf("%s %s: got %s with risk %d, want %s (%s)", c.Scanner, c.Fixture, c.Got, c.RiskScore, c.Expected, c.Error)
+		}
+	}
+	if report.Accuracy != 1 || len(report.Scanners) != 3 || report.Scanners[0].Scanner != "prompt" || report.Scanners[0].Cases != 3 {
+		t.Errorf("accuracy %v by scanner %+v", report.Accuracy, report.Scanners)
+	}
+	if report.ModelVersions["contract"] != riskModelVersions["contract"] || report.RulesetHash != runtimeConfig.Current().RulesetHash {
+		t.Errorf("model versions %v ruleset %s", report.ModelVersions, report.RulesetHash)
+	}
+
+	// The report is shared until it is too old
+	fake.Advance(time.Hour)
+	if again := benchmark.Report(); again.RanAt != report.RanAt {
+		t.Errorf("report rerun after an hour")
+	}
+	fake.Advance(benchmarkMaxAge)
+	if again := benchmark.Report(); again.RanAt != fake.Now().Unix() {
+		t.Errorf("report from %d not rerun at %d", again.RanAt, fake.Now().Unix())
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// BridgeInfo describes the bridge a transaction interacts with
+type BridgeInfo = types.BridgeInfo
+
+// Bridge kinds
+const (
+	BridgeCanonical    = "canonical"    // the rollup's or chain's own bridge
+	BridgeThirdParty   = "third_party"  // an established liquidity or messaging bridge
+	BridgeUnregistered = "unregistered" // bridge calls to a contract not in the registry
+)
+
+// bridgeRegistry is the built-in registry of Ethereum mainnet bridge
+// contracts, keyed by lowercase address. The config file's "bridges"
+// entries extend it.
+var bridgeRegistry = map[string]BridgeConfig{
+	"0x3154cf16ccdb4c6d922629664174b904d80f2c35": {Name: "Base L1StandardBridge", Kind: BridgeCanonical},
+	"0x49048044d57e1c92a77f79988d21fa8faf74e97e": {Name: "Base OptimismPortal", Kind: BridgeCanonical},
+	"0x99c9fc46f92e8a1c0dec1b1747d010903e884be1": {Name: "OP Mainnet L1StandardBridge", Kind: BridgeCanonical},
+	"0xbeb5fc579115071764c7423a4f12edde41f106ed": {Name: "OP Mainnet OptimismPortal", Kind: BridgeCanonical},
+	"0x72ce9c846789fdb6fc1f34ac4ad25dd9ef7031ef": {Name: "Arbitrum One L1GatewayRouter", Kind: BridgeCanonical},
+	"0x4dbd4fc535ac27206064b68ffcf827b0a60bab3f": {Name: "Arbitrum One Delayed Inbox", Kind: BridgeCanonical},
+	"0xa0c68c638235ee32657e8f720a23cec1bfc77c77": {Name: "Polygon PoS RootChainManager", Kind: BridgeCanonical},
+	"0x32400084c286cf3e17e7b677ea9583e60a000324": {Name: "zkSync Era Diamond Proxy", Kind: BridgeCanonical},
+	"0x5c7bcd6e7de5423a257d81b442095a1a6ced35c5": {Name: "Across SpokePool", Kind: BridgeThirdParty},
+	"0x8731d54e9d02c286767d56ac03e8037c07e01e98": {Name: "Stargate Router", Kind: BridgeThirdParty},
+	"0x3ee18b2214aff97000d974cf647e7c347e8fa585": {Name: "Wormhole Token Bridge", Kind: BridgeThirdParty},
+}
+
+// bridgeMethods are the deposit entry points of common bridges, by
+// selector. Clones of a bridge keep its selectors.
+var bridgeMethods = map[string]string{
+	"b1a1a882": "depositETH",
+	"9a2ac6d5": "depositETHTo",
+	"58a997f6": "depositERC20",
+	"838b2520": "depositERC20To",
+	"09fc8843": "bridgeETH",
+	"e11013dd": "bridgeETHTo",
+	"e9e05c42": "depositTransaction",
+	"d2ce7d65": "outboundTransfer",
+	"679b6ded": "createRetryableTicket",
+	"439370b1": "depositEth",
+	"4faa8a26": "depositEtherFor",
+	"e3dec8fb": "depositFor",
+	"eb672419": "requestL2Transaction",
+	"7b939232": "depositV3",
+	"0f5287b0": "transferTokens",
+	"9981509f": "wrapAndTransferETH",
+	"9fbf10fc": "swap",
+}
+
+// recentBridgeAge is how young an unregistered bridge must be to count as
+// recently deployed
+const recentBridgeAge = 30 * 24 * time.Hour
+
+func (b BridgeConfig) validate() error {
+	if b.Name == "" {
+		return fmt.Errorf("bridge %s needs a name", b.Address)
+	}
+	if !isValidAddress(b.Address) {
+		return fmt.Errorf("bridge %s: invalid address %q", b.Name, b.Address)
+	}
+	if b.Kind != BridgeCanonical && b.Kind != BridgeThirdParty {
+		return fmt.Errorf("bridge %s: kind must be %s or %s", b.Name, BridgeCanonical, BridgeThirdParty)
+	}
+	return nil
+}
+
+// riskFinding is a risk read from a transaction, as a MEV check risk
+// factor and a preflight warning
+type riskFinding struct {
+	factor      string
+	score       int
+	description string
+}
+
+// checkBridge classifies a call to to as a canonical, third-party or
+// unregistered bridge interaction, or returns nil if it is none. Calls to
+// unregistered contracts are bridge interactions when they use a known
+// bridge method; those contracts are looked up on the explorer to flag
+// unverified and recently deployed clones.
+func checkBridge(to, data string) (*BridgeInfo, []riskFinding) {
+	var method string
+	if selector, _, err := decodeCalldata(data); err == nil {
+		method = bridgeMethods[selector]
+	}
+	if entry, ok := runtimeConfig.Current().Bridge(to); ok {
+		info := &BridgeInfo{Name: entry.Name, Kind: entry.Kind, Method: method}
+		if entry.Kind == BridgeThirdParty {
+			return info, []riskFinding{{"third_party_bridge", 10, fmt.Sprintf("Third-party bridge (%s) - funds depend on its contracts and relayers, not the destination chain", entry.Name)}}
+		}
+		return info, nil
+	}
+	if method == "" {
+		return nil, nil
+	}
+
+	info := &BridgeInfo{Kind: BridgeUnregistered, Method: method}
+	findings := []riskFinding{{"unregistered_bridge", 40, fmt.Sprintf("Bridge call (%s) to a contract not in the bridge registry - possible clone of a canonical bridge", method)}}
+	chain, _ := runtimeConfig.Current().Chain("ethereum")
+	if source, err := providers.Explorer.ContractSource(to, chain); err == nil {
+		info.Name, info.Verified = source.Name, &source.Verified
+		if !source.Verified {
+			findings = append(findings, riskFinding{"unverified_bridge", 20, "Bridge contract source is not verified"})
+		}
+	}
+	if creation, err := providers.Explorer.ContractCreation(to, chain); err == nil && !creation.Created.IsZero() {
+		days := creation.ageDays()
+		info.AgeDays = &days
+		if time.Since(creation.Created) < recentBridgeAge {
+			findings = append(findings, riskFinding{"recent_bridge_deployment", 20, fmt.Sprintf("Bridge contract deployed %d days ago", days)})
+		}
+	}
+	return info, findings
+}
+
+// contractCreation is a contract's creation record on the explorer
+type contractCreation struct {
+	Creator string
+	TxHash  string
+	Created time.Time // zero if the explorer does not report it
+}
+
+func (c *contractCreation) ageDays() int {
+	return int(time.Since(c.Created).Hours() / 24)
+}
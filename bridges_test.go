@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestCheckBridge(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+
+	depositETH := "0xb1a1a882" + "0000000000000000000000000000000000000000000000000000000000030d40"
+	simulator := NewTxSimulator(up.RPC.URL)
+
+	// The canonical Base bridge is recognized and adds no risk
+	result, err := simulator.Simulate(&TxPreflightRequest{To: "0x3154Cf16ccdb4C6d922629664174b904d80F2C35", Data: depositETH})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Bridge == nil || result.Bridge.Kind != BridgeCanonical || result.Bridge.Method != "depositETH" || result.RiskScore != 0 {
+		t.Errorf("canonical bridge = %+v, bridge %+v", result, result.Bridge)
+	}
+
+	if bridge, findings := checkBridge("0x5c7BCd6E7De5423a257D81B442095A1a6ced35C5", "0x"); bridge == nil || bridge.Kind != BridgeThirdParty || len(findings) != 1 {
+		t.Errorf("Across = %+v, %+v", bridge, findings)
+	}
+
+	// A fresh, unverified contract taking bridge deposits looks like a clone
+	clone := "0x00000000000000000000000000000000000b41d6"
+	up.SetContract(clone, testhttp.Contract{Name: "L1StandardBridge", Created: time.Now().Add(-48 * time.Hour).Unix()})
+	result, _ = simulator.Simulate(&TxPreflightRequest{To: clone, Data: depositETH})
+	if result.Safe || result.Bridge == nil || result.Bridge.Kind != BridgeUnregistered || *result.Bridge.Verified || *result.Bridge.AgeDays != 2 {
+		t.Errorf("clone = %+v, bridge %+v", result, result.Bridge)
+	}
+	mev := checkMEVRisk(MEVCheckRequest{To: clone, Value: "0", Data: depositETH})
+	if len(mev.RiskFactors) != 3 || mev.RiskFactors[0] != "unregistered_bridge" || mev.RiskFactors[2] != "recent_bridge_deployment" {
+		t.Errorf("MEV risk factors = %v", mev.RiskFactors)
+	}
+
+	// Ordinary calls are not bridge interactions
+	if bridge, _ := checkBridge(clone, "0xa9059cbb"); bridge != nil {
+		t.Errorf("transfer classified as %+v", bridge)
+	}
+
+	// The config file extends the registry
+	cfg, err := parseRuntimeConfig([]byte(`{"bridges": [{"name": "Internal bridge", "address": "` + clone + `", "kind": "canonical"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousConfig := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previousConfig)
+	if bridge, findings := checkBridge(clone, depositETH); bridge == nil || bridge.Name != "Internal bridge" || len(findings) != 0 {
+		t.Errorf("configured bridge = %+v, %+v", bridge, findings)
+	}
+}
+
+func TestBridgeConfigValidation(t *testing.T) {
+	for _, bad := range []string{
+		`{"bridges": [{"name": "x", "address": "0x12", "kind": "canonical"}]}`,
+		`{"bridges": [{"name": "x", "address": "0x00000000000000000000000000000000000b41d6", "kind": "trusted"}]}`,
+		`{"bridges": [{"address": "0x00000000000000000000000000000000000b41d6", "kind": "canonical"}]}`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(bad)); err == nil {
+			t.Errorf("accepted %s", bad)
+		}
+	}
+}
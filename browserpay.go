@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+//go:embed pay/index.html
+var browserPayHTML []byte
+
+// browserPayTTL is how long a prepared browser payment can be signed, and
+// how long the signed authorization stays valid
+const browserPayTTL = 5 * time.Minute
+
+// BrowserPayPrepareRequest is the body of POST /pay/prepare: the wallet
+// account and the requirement from the endpoint's 402 challenge
+type BrowserPayPrepareRequest struct {
+	Payer   string             `json:"payer"`
+	Payment PaymentRequirement `json:"payment"`
+}
+
+// BrowserPayIntent is a payment waiting for the wallet's signature
+type BrowserPayIntent struct {
+	ID        string          `json:"id"`
+	TypedData EIP712TypedData `json:"typed_data"` // to sign with eth_signTypedData_v4
+	ExpiresAt int64           `json:"expires_at"`
+}
+
+// EIP712TypedData is a transfer authorization in the JSON form wallets
+// sign with eth_signTypedData_v4
+type EIP712TypedData struct {
+	Types       map[string][]EIP712Field    `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      EIP712Domain                `json:"domain"`
+	Message     types.TransferAuthorization `json:"message"`
+}
+
+// EIP712Field is one member of an EIP-712 struct type
+type EIP712Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// EIP712Domain is the signing domain of an asset contract
+type EIP712Domain struct {
+	Name              string `json:"name"`
+	Version           string `json:"version"`
+	ChainID           int64  `json:"chainId"`
+	VerifyingContract string `json:"verifyingContract"`
+}
+
+// transferAuthorizationTypes are the EIP-712 types of an EIP-3009
+// TransferWithAuthorization
+var transferAuthorizationTypes = map[string][]EIP712Field{
+	"EIP712Domain": {
+		{"name", "string"}, {"version", "string"}, {"chainId", "uint256"}, {"verifyingContract", "address"},
+	},
+	"TransferWithAuthorization": {
+		{"from", "address"}, {"to", "address"}, {"value", "uint256"},
+		{"validAfter", "uint256"}, {"validBefore", "uint256"}, {"nonce", "bytes32"},
+	},
+}
+
+// BrowserPayConfirmRequest is the body of POST /pay/confirm
+type BrowserPayConfirmRequest struct {
+	ID        string `json:"id"`
+	Signature string `json:"signature"` // 0x-prefixed 65-byte EIP-712 signature
+}
+
+// BrowserPayPayment is the payment header for the signed authorization
+type BrowserPayPayment struct {
+	Header    string `json:"header"`  // X-Payment
+	Payment   string `json:"payment"` // the exact scheme payload
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// browserPayIntent is what the service keeps between prepare and confirm
+type browserPayIntent struct {
+	Network       string                      `json:"network"`
+	Asset         string                      `json:"asset"`
+	Authorization types.TransferAuthorization `json:"authorization"`
+}
+
+// BrowserPay lets people pay for one-off calls with a browser wallet. The
+// wallet signs an EIP-3009 transferWithAuthorization of the price (EIP-712,
+// via EIP-1193), which is returned as an exact scheme X-PAYMENT payload.
+// The paywall checks it like any exact payment and the receiver or the
+// facilitator collects it, so the service never vouches for a payment
+// itself. It needs the exact_scheme flag and an asset that supports it.
+type BrowserPay struct {
+	clock clock.Clock
+}
+
+// NewBrowserPay creates the browser payment flow
+func NewBrowserPay() *BrowserPay {
+	return &BrowserPay{clock: clock.System}
+}
+
+func browserPayKey(id string) string {
+	return "payintent:" + id
+}
+
+// validate checks a prepare request. The amount is not checked against the
+// endpoint's price: the paywall does that when the payment is presented.
+func (req *BrowserPayPrepareRequest) validate() error {
+	payer, err := address.Normalize(req.Payer)
+	if err != nil {
+		return fmt.Errorf("payer: %w", err)
+	}
+	req.Payer = payer
+	p := &req.Payment
+	if _, err := strconv.ParseFloat(p.MaxAmount, 64); err != nil {
+		return errors.New("payment.maxAmount must be a decimal amount")
+	}
+	if !address.IsHex(p.Receiver) {
+		return errors.New("payment.receiver must be an address")
+	}
+	if p.Asset == "" || p.Network == "" {
+		return errors.New("payment.asset and payment.network are required")
+	}
+	if p.Nonce != "" && (len(p.Nonce) != 32 || strings.Trim(strings.ToLower(p.Nonce), "0123456789abcdef") != "") {
+		return errors.New("payment.nonce must be the challenge's 16-byte hex nonce")
+	}
+	return nil
+}
+
+// authorizationNonce is the EIP-3009 nonce for a payment: the challenge
+// nonce, when there is one, in the low 16 bytes, or 32 random bytes
+func authorizationNonce(challenge string) string {
+	if challenge != "" {
+		return "0x" + strings.Repeat("0", 32) + strings.ToLower(challenge)
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "0x" + hex.EncodeToString(b)
+}
+
+// handlePage serves GET /pay, a page that pays for a call with the
+// browser's wallet
+func (b *BrowserPay) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(browserPayHTML)
+}
+
+// handlePrepare serves POST /pay/prepare
+func (b *BrowserPay) handlePrepare(w http.ResponseWriter, r *http.Request) {
+	var req BrowserPayPrepareRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	exact, ok := exactRequirement(req.Payment)
+	if !ok {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, fmt.Sprintf("%s payments on %s cannot be authorized from a browser wallet", req.Payment.Asset, req.Payment.Network)), http.StatusBadRequest)
+		return
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	expires := b.clock.Now().Add(browserPayTTL)
+	intent := browserPayIntent{
+		Network: req.Payment.Network,
+		Asset:   req.Payment.Asset,
+		Authorization: types.TransferAuthorization{
+			From:        req.Payer,
+			To:          strings.ToLower(req.Payment.Receiver),
+			Value:       exact.MaxAmountRequired,
+			ValidAfter:  "0",
+			ValidBefore: strconv.FormatInt(expires.Unix(), 10),
+			Nonce:       authorizationNonce(req.Payment.Nonce),
+		},
+	}
+	data, _ := json.Marshal(intent)
+	if err := sharedState.Set(browserPayKey(hex.EncodeToString(id)), string(data), browserPayTTL); err != nil {
+		log.Printf("❌ Browser payment intent not stored: %v", err)
+		http.Error(w, `{"error":"Payments unavailable, try again shortly"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BrowserPayIntent{
+		ID: hex.EncodeToString(id),
+		TypedData: EIP712TypedData{
+			Types:       transferAuthorizationTypes,
+			PrimaryType: "TransferWithAuthorization",
+			Domain: EIP712Domain{
+				Name:              exact.Extra.Name,
+				Version:           exact.Extra.Version,
+				ChainID:           exact.Extra.ChainID,
+				VerifyingContract: exact.Extra.VerifyingContract,
+			},
+			Message: intent.Authorization,
+		},
+		ExpiresAt: expires.Unix(),
+	})
+}
+
+// handleConfirm serves POST /pay/confirm. The signature must recover to
+// the payer, and each intent yields one payment.
+func (b *BrowserPay) handleConfirm(w http.ResponseWriter, r *http.Request) {
+	var req BrowserPayConfirmRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(req.Signature, "0x"))
+	if err != nil {
+		http.Error(w, `{"error":"signature must be hex"}`, http.StatusBadRequest)
+		return
+	}
+
+	key := browserPayKey(req.ID)
+	stored, ok, err := sharedState.Get(key)
+	if err != nil {
+		log.Printf("❌ Browser payment intent not loaded: %v", err)
+		http.Error(w, `{"error":"Payments unavailable, try again shortly"}`, http.StatusServiceUnavailable)
+		return
+	}
+	var intent browserPayIntent
+	if !ok || json.Unmarshal([]byte(stored), &intent) != nil {
+		http.Error(w, `{"error":"Unknown or expired payment intent"}`, http.StatusNotFound)
+		return
+	}
+
+	auth := intent.Authorization
+	value, err1 := units.ParseWei(auth.Value)
+	validBefore, err2 := strconv.ParseInt(auth.ValidBefore, 10, 64)
+	hash, err3 := authorizationHash(exactDomains[intent.Network+":"+intent.Asset], auth, value, 0, validBefore)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		log.Printf("❌ Browser payment intent %s unreadable: %v", req.ID, err)
+		http.Error(w, `{"error":"Unknown or expired payment intent"}`, http.StatusNotFound)
+		return
+	}
+	signer, err := ethsig.Recover(hash, sig)
+	if err != nil || signer != auth.From {
+		http.Error(w, `{"error":"Signature does not match the payer"}`, http.StatusUnauthorized)
+		return
+	}
+	if used, err := sharedState.DeleteIf(key, stored); err != nil || !used {
+		http.Error(w, `{"error":"Unknown or expired payment intent"}`, http.StatusNotFound)
+		return
+	}
+
+	data, _ := json.Marshal(ExactPayment{
+		X402Version: 1,
+		Scheme:      SchemeExact,
+		Network:     intent.Network,
+		Payload:     ExactPayload{Signature: "0x" + hex.EncodeToString(sig), Authorization: auth},
+	})
+	log.Printf("🦊 Browser payment authorized: intent=%s payer=%s value=%s %s", req.ID, auth.From, auth.Value, intent.Asset)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BrowserPayPayment{Header: "X-Payment", Payment: base64.StdEncoding.EncodeToString(data), ExpiresAt: validBefore})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+)
+
+func TestBrowserPayment(t *testing.T) {
+	srv, _ := startService(t, map[string]string{"FEATURE_FLAGS": "challenge_nonces"})
+	t.Cleanup(func() { featureFlags.ParseEnv("") })
+	wallet, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	payer := ethsig.Address(wallet)
+
+	post := func(path string, body interface{}, out interface{}) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+	// sign does what the wallet's eth_signTypedData_v4 does
+	sign := func(data EIP712TypedData, key *big.Int) string {
+		auth := data.Message
+		value, _ := new(big.Int).SetString(auth.Value, 10)
+		validBefore, _ := strconv.ParseInt(auth.ValidBefore, 10, 64)
+		domain := ethsig.Domain{Name: data.Domain.Name, Version: data.Domain.Version, ChainID: data.Domain.ChainID, VerifyingContract: data.Domain.VerifyingContract}
+		hash, err := authorizationHash(domain, auth, value, 0, validBefore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := ethsig.Sign(hash, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "0x" + hex.EncodeToString(sig)
+	}
+	call := func(payment BrowserPayPayment) int {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/gas", nil)
+		req.Header.Set(payment.Header, payment.Payment)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	challenge, err := http.Get(srv.URL + "/api/gas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(challenge.Body).Decode(&body)
+	challenge.Body.Close()
+
+	// The wallet authorizes a transfer, so exact payments must be on
+	if code := post("/pay/prepare", BrowserPayPrepareRequest{Payer: payer, Payment: body.Payment}, nil); code != http.StatusBadRequest {
+		t.Errorf("prepare without exact payments returned %d, want 400", code)
+	}
+	featureFlags.ParseEnv("challenge_nonces,exact_scheme")
+
+	var intent BrowserPayIntent
+	if code := post("/pay/prepare", BrowserPayPrepareRequest{Payer: payer, Payment: body.Payment}, &intent); code != http.StatusOK {
+		t.Fatalf("prepare returned %d", code)
+	}
+	auth := intent.TypedData.Message
+	if intent.TypedData.PrimaryType != "TransferWithAuthorization" || intent.TypedData.Domain.ChainID != 8453 ||
+		auth.From != payer || !strings.EqualFold(auth.To, body.Payment.Receiver) || auth.Value != "1000" ||
+		exactChallengeNonce(auth.Nonce) != body.Payment.Nonce {
+		t.Errorf("typed data = %+v", intent.TypedData)
+	}
+
+	// Only the payer's wallet can confirm
+	if code := post("/pay/confirm", BrowserPayConfirmRequest{ID: intent.ID, Signature: sign(intent.TypedData, big.NewInt(1))}, nil); code != http.StatusUnauthorized {
+		t.Errorf("other wallet's signature returned %d, want 401", code)
+	}
+	var payment BrowserPayPayment
+	confirm := BrowserPayConfirmRequest{ID: intent.ID, Signature: sign(intent.TypedData, wallet)}
+	if code := post("/pay/confirm", confirm, &payment); code != http.StatusOK || payment.Header != "X-Payment" {
+		t.Fatalf("confirm returned %d %+v", code, payment)
+	}
+	if code := post("/pay/confirm", confirm, nil); code != http.StatusNotFound {
+		t.Errorf("second confirm returned %d, want 404", code)
+	}
+
+	if code := call(payment); code != http.StatusOK {
+		t.Fatalf("paid call returned %d", code)
+	}
+	if code := call(payment); code != http.StatusPaymentRequired {
+		t.Errorf("reused authorization returned %d, want 402", code)
+	}
+	entries := ledgerEntries(t, srv)
+	if len(entries) != 1 || entries[0].Payer != payer || entries[0].Authorization == nil || entries[0].Authorization.Authorization.Nonce != auth.Nonce {
+		t.Errorf("ledger = %+v, want the authorization recorded", entries)
+	}
+
+	if code := post("/pay/prepare", BrowserPayPrepareRequest{Payer: "0xnope", Payment: body.Payment}, nil); code != http.StatusBadRequest {
+		t.Errorf("bad payer returned %d, want 400", code)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	srv, _ := startService(t, nil)
+
+	preflight := func(path string) *http.Response {
+		req, _ := http.NewRequest("OPTIONS", srv.URL+path, nil)
+		req.Header.Set("Origin", "https://app.example")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		req.Header.Set("Access-Control-Request-Headers", "x-payment-response")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	resp := preflight("/api/gas")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "*" ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "X-Payment-Response") {
+		t.Errorf("preflight returned %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := preflight("/admin/ledger"); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Error("admin API allowed cross-origin")
+	}
+
+	handler := withCORS(parseOrigins("https://app.example/, https://other.example"), http.NotFoundHandler())
+	for origin, want := range map[string]string{"https://app.example": "https://app.example", "https://evil.example": ""} {
+		req, _ := http.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Errorf("origin %s allowed as %q, want %q", origin, got, want)
+		}
+	}
+	if parseOrigins("none") != nil {
+		t.Error("none did not disable CORS")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+)
+
+// maxRequestBytes bounds the bodies of GraphQL queries and async job
+// requests
+const maxRequestBytes = 1 << 20
+
+// Capabilities is what this deployment supports, so SDKs can negotiate
+// behavior instead of assuming it. Served at /capabilities.
+type Capabilities struct {
+	Version    string                `json:"version"`
+	Payment    PaymentCapabilities   `json:"payment"`
+	Sandbox    SandboxCapabilities   `json:"sandbox"`
+	Transports TransportCapabilities `json:"transports"`
+	Formats    []string              `json:"formats"` // response media types offered via Accept
+	Limits     LimitCapabilities     `json:"limits"`
+	Features   map[Flag]bool         `json:"features"` // feature flags as they stand now
+	Ruleset    RulesetCapabilities   `json:"ruleset"`  // the scoring rules as they stand now
+}
+
+// PaymentCapabilities describes how calls can be paid for
+type PaymentCapabilities struct {
+	Schemes         []string `json:"schemes"`
+	Network         string   `json:"network"`
+	Networks        []string `json:"networks"` // accepted on some or all endpoints, network first
+	Assets          []string `json:"assets"`
+	ChallengeNonces bool     `json:"challenge_nonces"` // tokens must echo a 402 challenge nonce
+	StrictPayments  bool     `json:"strict_payments"`  // tokens must be signed, unexpired and for this audience
+	Diagnostics     bool     `json:"diagnostics"`      // refused tokens get the failed checks in the 402
+	Settlement      bool     `json:"settlement"`       // tokens must name a confirmed on-chain transfer in payment.txHash
+	BrowserPayments bool     `json:"browser_payments"` // /pay
+	Coupons         bool     `json:"coupons"`          // X-Coupon
+	Referrals       bool     `json:"referrals"`        // payment.referrer earns a share
+	PrepaidAccounts bool     `json:"prepaid_accounts"` // X-Account-Debit, funded at /api/account/topup
+	SignedResponses bool     `json:"signed_responses"` // /.well-known/response-signing
+	SignedRequests  []string `json:"signed_requests"`  // endpoints requiring X-Request-Signature; any may be signed
+	Attestation     bool     `json:"attestation"`      // /.well-known/attestation
+}
+
+// SandboxCapabilities describes whether test payments are accepted
+type SandboxCapabilities struct {
+	Available bool        `json:"available"`
+	Mode      SandboxMode `json:"mode"`
+	Network   string      `json:"network,omitempty"` // tokens on this network are test payments
+}
+
+// TransportCapabilities lists the ways to call the service. Streaming is
+// empty: every response is sent whole.
+type TransportCapabilities struct {
+	HTTP      bool     `json:"http"`
+	GraphQL   string   `json:"graphql,omitempty"`
+	GRPCPort  string   `json:"grpc_port,omitempty"`
+	MCP       string   `json:"mcp,omitempty"`
+	A2A       string   `json:"a2a,omitempty"`
+	AsyncJobs bool     `json:"async_jobs"` // ?async=true on scans, polled at /api/jobs/{id}
+	Streaming []string `json:"streaming"`
+}
+
+// LimitCapabilities are the limits a client should batch and pace within
+type LimitCapabilities struct {
+	MaxRequestBytes    int `json:"max_request_bytes"`
+	MaxSafeBatchCalls  int `json:"max_safe_batch_calls"`            // MultiSend calls checked by /api/safe-check
+	RateLimitPerMinute int `json:"rate_limit_per_minute,omitempty"` // paid requests per payer, 0 if unlimited
+	RateLimitBurst     int `json:"rate_limit_burst,omitempty"`
+}
+
+// RulesetCapabilities is the scoring ruleset in effect, so clients can tell
+// which rules produced a score
+type RulesetCapabilities struct {
+	Hash          string            `json:"hash"`           // ruleset_hash of scored results
+	ModelVersions map[string]string `json:"model_versions"` // kind of result -> model_version
+	RiskWeights   map[string]int    `json:"risk_weights"`   // scan rule -> points it adds
+}
+
+// handleCapabilities serves GET /capabilities. caps holds what is fixed at
+// startup; feature flags and the ruleset are read per request since the
+// admin API and config reloads can change them.
+func handleCapabilities(caps Capabilities) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		out := caps
+		out.Features = make(map[Flag]bool, len(knownFlags))
+		for flag := range knownFlags {
+			out.Features[flag] = featureFlags.Enabled(flag)
+		}
+		out.Payment.ChallengeNonces = out.Features[FlagChallengeNonces] || out.Payment.StrictPayments
+		cfg := runtimeConfig.Current()
+		out.Ruleset = RulesetCapabilities{Hash: cfg.RulesetHash, ModelVersions: riskModelVersions, RiskWeights: cfg.EffectiveRiskWeights()}
+		out.Payment.Networks = cfg.networkNames(caps.Payment.Network)
+		if slices.ContainsFunc(out.Payment.Networks, func(network string) bool { return exactSupported(network, caps.Payment.Assets) }) {
+			out.Payment.Schemes = append(caps.Payment.Schemes[:len(caps.Payment.Schemes):len(caps.Payment.Schemes)], SchemeExact)
+			// Browser wallets pay with exact scheme authorizations
+			out.Payment.BrowserPayments = true
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	probe := func(env map[string]string) Capabilities {
+		t.Helper()
+		srv, _ := startService(t, env)
+		resp, err := http.Get(srv.URL + "/capabilities")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var caps Capabilities
+		if err := json.NewDecoder(resp.Body).Decode(&caps); err != nil {
+			t.Fatal(err)
+		}
+		return caps
+	}
+
+	caps := probe(nil)
+	if caps.Sandbox.Available || caps.Payment.Coupons || caps.Payment.ChallengeNonces || caps.Limits.RateLimitPerMinute != 0 {
+		t.Errorf("default capabilities = %+v", caps)
+	}
+	if len(caps.Payment.Schemes) != 1 || caps.Payment.Schemes[0] != "x402" || caps.Payment.BrowserPayments || caps.Transports.Streaming == nil ||
+		caps.Limits.MaxSafeBatchCalls != maxSafeBatch || len(caps.Formats) != 3 || len(caps.Features) != len(knownFlags) {
+		t.Errorf("capabilities = %+v", caps)
+	}
+	if caps.Ruleset.Hash != runtimeConfig.Current().RulesetHash || caps.Ruleset.RiskWeights[RuleUnverifiedContract] != 30 || caps.Ruleset.ModelVersions["contract"] == "" {
+		t.Errorf("ruleset = %+v", caps.Ruleset)
+	}
+
+	caps = probe(map[string]string{
+		"SANDBOX_MODE":          "allow",
+		"COUPON_SECRET":         "s3cret",
+		"FEATURE_FLAGS":         "challenge_nonces,exact_scheme",
+		"RATE_LIMIT_PER_MINUTE": "30",
+		"RATE_LIMIT_BURST":      "10",
+	})
+	t.Cleanup(func() { featureFlags.ParseEnv("") })
+	if !caps.Sandbox.Available || caps.Sandbox.Network != defaultSandboxNetwork || !caps.Payment.Coupons ||
+		!caps.Payment.ChallengeNonces || !caps.Features[FlagChallengeNonces] ||
+		strings.Join(caps.Payment.Schemes, ",") != "x402,exact" || !caps.Payment.BrowserPayments ||
+		caps.Limits.RateLimitPerMinute != 30 || caps.Limits.RateLimitBurst != 10 {
+		t.Errorf("configured capabilities = %+v", caps)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of skill change
+const (
+	ChangeAdded      = "added"
+	ChangeChanged    = "changed"
+	ChangeDeprecated = "deprecated"
+	ChangeRemoved    = "removed"
+)
+
+// What a skill change touched
+const (
+	AreaSkill  = "skill"
+	AreaPrice  = "price"
+	AreaInput  = "input_schema"
+	AreaOutput = "output_schema"
+)
+
+// SkillChange is one versioned change to a skill advertised in the OASF
+// manifest. Breaking changes bump the skill's major version.
+type SkillChange struct {
+	Skill    string `json:"skill"`
+	Version  string `json:"version"` // the skill version the change shipped in
+	Date     string `json:"date"`    // YYYY-MM-DD
+	Kind     string `json:"kind"`
+	Area     string `json:"area"`
+	Breaking bool   `json:"breaking"`
+	Summary  string `json:"summary"`
+}
+
+// skillHistory is the version history of the skill registry, oldest
+// first. Add an entry here whenever a skill's version in the OASF manifest
+// changes; TestChangelog holds the two together.
+var skillHistory = []SkillChange{
+	{Skill: "gas_monitoring", Version: "1.0.0", Date: "2026-02-07", Kind: ChangeAdded, Area: AreaSkill, Summary: "Ethereum gas prices at 0.001 USDC per call"},
+	{Skill: "validator_queue", Version: "1.0.0", Date: "2026-02-07", Kind: ChangeAdded, Area: AreaSkill, Summary: "Validator entry and exit queue at 0.005 USDC per call"},
+	{Skill: "token_security_scan", Version: "1.0.0", Date: "2026-02-07", Kind: ChangeAdded, Area: AreaSkill, Summary: "ERC-20 token security scan at 0.008 USDC per call"},
+	{Skill: "wallet_risk_analysis", Version: "1.0.0", Date: "2026-02-07", Kind: ChangeAdded, Area: AreaSkill, Summary: "Wallet risk profile at 0.01 USDC per call"},
+	{Skill: "address_labels", Version: "1.0.0", Date: "2026-02-07", Kind: ChangeAdded, Area: AreaSkill, Summary: "Address labels and entities at 0.003 USDC per call"},
+	{Skill: "mev_protection", Version: "1.0.0", Date: "2026-02-07", Kind: ChangeAdded, Area: AreaSkill, Summary: "MEV risk check at 0.005 USDC per call"},
+	{Skill: "tx_preflight", Version: "1.0.0", Date: "2026-02-07", Kind: ChangeAdded, Area: AreaSkill, Summary: "Transaction pre-flight checks at 0.003 USDC per call"},
+	{Skill: "gas_monitoring", Version: "1.1.0", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaInput, Summary: "Optional unit input selects the gas unit (gwei by default)"},
+	{Skill: "tx_preflight", Version: "1.1.0", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaInput, Summary: "Optional user_operation input checks an ERC-4337 v0.7 user operation instead of a transaction"},
+	{Skill: "gas_monitoring", Version: "1.1.1", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaOutput, Summary: "Output schema lists the current level returned in place of average, and its required fields"},
+	{Skill: "validator_queue", Version: "1.0.1", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaOutput, Summary: "Output schema lists the entry_wait_hours and exit_wait_hours returned in place of wait times in days"},
+	{Skill: "token_security_scan", Version: "1.0.1", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaOutput, Summary: "Output schema names is_verified as returned, and its required fields"},
+	{Skill: "wallet_risk_analysis", Version: "1.0.1", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaOutput, Summary: "Output schema lists holdings as the array returned and suspicious_tokens in place of flags"},
+	{Skill: "address_labels", Version: "1.0.1", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaOutput, Summary: "Output schema marks entity optional and the other fields required"},
+	{Skill: "mev_protection", Version: "1.0.1", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaOutput, Summary: "Output schema lists the safe, mev_risk_score, risk_factors and per-attack risk fields returned"},
+	{Skill: "tx_preflight", Version: "1.1.1", Date: "2026-10-16", Kind: ChangeChanged, Area: AreaOutput, Summary: "Output schema lists its required fields"},
+}
+
+// parseVersion splits a major.minor.patch version
+func parseVersion(v string) ([3]int, error) {
+	var out [3]int
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return out, fmt.Errorf("version %q is not major.minor.patch", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, fmt.Errorf("version %q is not major.minor.patch", v)
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+// compareVersions orders two major.minor.patch versions; malformed ones
+// sort first
+func compareVersions(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	for i := range va {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// SkillVersion is where a skill stands in its history
+type SkillVersion struct {
+	Version       string `json:"version"`
+	BreakingSince string `json:"breaking_since"` // the last version with a breaking change
+	Updated       string `json:"updated"`
+	Removed       bool   `json:"removed,omitempty"`
+}
+
+// Changelog is the body of /.well-known/changelog.json
+type Changelog struct {
+	Skills  map[string]SkillVersion `json:"skills"`
+	Changes []SkillChange           `json:"changes"` // newest first
+}
+
+// buildChangelog derives the current version of every skill from history
+// and lists the changes matching keep, newest first
+func buildChangelog(history []SkillChange, keep func(SkillChange) bool) Changelog {
+	cl := Changelog{Skills: make(map[string]SkillVersion), Changes: []SkillChange{}}
+	for _, c := range history {
+		s := cl.Skills[c.Skill]
+		s.Version, s.Updated, s.Removed = c.Version, c.Date, c.Kind == ChangeRemoved
+		if c.Breaking || c.Kind == ChangeAdded {
+			s.BreakingSince = c.Version
+		}
+		cl.Skills[c.Skill] = s
+		if keep(c) {
+			cl.Changes = append(cl.Changes, c)
+		}
+	}
+	sort.SliceStable(cl.Changes, func(i, j int) bool {
+		if cl.Changes[i].Date != cl.Changes[j].Date {
+			return cl.Changes[i].Date > cl.Changes[j].Date
+		}
+		return compareVersions(cl.Changes[i].Version, cl.Changes[j].Version) > 0
+	})
+	return cl
+}
+
+// handleChangelog serves GET /.well-known/changelog.json, the versioned
+// changes to skills, prices and schemas. ?skill= limits the changes to one
+// skill, ?since=YYYY-MM-DD to those made on or after a date, and
+// ?breaking=true to breaking ones. The current version of every skill is
+// always listed.
+func handleChangelog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	skill, since, breaking := q.Get("skill"), q.Get("since"), q.Get("breaking") == "true"
+	if _, err := time.Parse(time.DateOnly, since); since != "" && err != nil {
+		http.Error(w, `{"error":"since must be a date, YYYY-MM-DD"}`, http.StatusBadRequest)
+		return
+	}
+	cl := buildChangelog(skillHistory, func(c SkillChange) bool {
+		return (skill == "" || c.Skill == skill) && c.Date >= since && (!breaking || c.Breaking)
+	})
+	if _, ok := cl.Skills[skill]; skill != "" && !ok {
+		http.Error(w, fmt.Sprintf(`{"error":"unknown skill %q"}`, skill), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(cl)
+}
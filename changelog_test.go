@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChangelog(t *testing.T) {
+	// The history must be ordered and versioned by the semver rules agents
+	// rely on to spot breaking changes
+	seen := map[string]SkillChange{}
+	for _, c := range skillHistory {
+		v, err := parseVersion(c.Version)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Skill, err)
+		}
+		if _, err := time.Parse(time.DateOnly, c.Date); err != nil {
+			t.Errorf("%s %s: bad date %q", c.Skill, c.Version, c.Date)
+		}
+		prev, ok := seen[c.Skill]
+		switch {
+		case !ok && c.Kind != ChangeAdded:
+			t.Errorf("%s %s: history does not start with %q", c.Skill, c.Version, ChangeAdded)
+		case ok && (compareVersions(c.Version, prev.Version) <= 0 || c.Date < prev.Date):
+			t.Errorf("%s %s does not follow %s", c.Skill, c.Version, prev.Version)
+		case ok:
+			p, _ := parseVersion(prev.Version)
+			if c.Breaking != (v[0] > p[0]) {
+				t.Errorf("%s %s: breaking=%v but major version went %d -> %d", c.Skill, c.Version, c.Breaking, p[0], v[0])
+			}
+		}
+		seen[c.Skill] = c
+	}
+
+	// and match what the OASF manifest advertises
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if path == "/.well-known/oasf.json" {
+			handleOASFManifest(rec, req)
+		} else {
+			handleChangelog(rec, req)
+		}
+		return rec
+	}
+	var manifest OASFManifest
+	json.NewDecoder(get("/.well-known/oasf.json").Body).Decode(&manifest)
+	var full Changelog
+	json.NewDecoder(get("/.well-known/changelog.json").Body).Decode(&full)
+	if len(manifest.Skills) != len(full.Skills) {
+		t.Errorf("manifest has %d skills, changelog %d", len(manifest.Skills), len(full.Skills))
+	}
+	for _, s := range manifest.Skills {
+		if got := full.Skills[s.ID].Version; got != s.Version {
+			t.Errorf("%s is %s in the manifest but %q in the changelog", s.ID, s.Version, got)
+		}
+	}
+	if len(full.Changes) != len(skillHistory) || full.Changes[0].Date < full.Changes[len(full.Changes)-1].Date {
+		t.Errorf("changes not listed newest first: %+v", full.Changes)
+	}
+
+	var filtered Changelog
+	json.NewDecoder(get("/.well-known/changelog.json?skill=tx_preflight&since=2026-03-01").Body).Decode(&filtered)
+	if len(filtered.Changes) != 2 || filtered.Changes[0].Version != "1.1.1" || filtered.Skills["tx_preflight"].BreakingSince != "1.0.0" {
+		t.Errorf("filtered changelog = %+v", filtered)
+	}
+	for path, want := range map[string]int{
+		"/.well-known/changelog.json?skill=teleport":  http.StatusNotFound,
+		"/.well-known/changelog.json?since=last-week": http.StatusBadRequest,
+		"/.well-known/changelog.json?breaking=true":   http.StatusOK,
+	} {
+		if got := get(path).Code; got != want {
+			t.Errorf("%s returned %d, want %d", path, got, want)
+		}
+	}
+}
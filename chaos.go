@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Fault kinds the chaos injector can produce
+const (
+	FaultRechallenge = "rechallenge" // 402 despite a valid payment
+	FaultRateLimit   = "rate_limit"  // 429 with Retry-After
+	FaultSlow        = "slow"        // response delayed by DelayMS
+	FaultTruncate    = "truncate"    // body cut off halfway
+)
+
+var allFaults = []string{FaultRechallenge, FaultRateLimit, FaultSlow, FaultTruncate}
+
+// ChaosConfig controls fault injection on paid endpoints
+type ChaosConfig struct {
+	Enabled       bool     `json:"enabled"`
+	Fraction      float64  `json:"fraction"`                 // share of paid requests affected, 0-1
+	Faults        []string `json:"faults,omitempty"`         // default: all
+	DelayMS       int      `json:"delay_ms,omitempty"`       // for slow, default 3000
+	RequireHeader bool     `json:"require_header,omitempty"` // only requests sending X-Chaos: true
+}
+
+func (c *ChaosConfig) validate() error {
+	if c.Fraction < 0 || c.Fraction > 1 {
+		return fmt.Errorf("fraction must be between 0 and 1")
+	}
+	for _, f := range c.Faults {
+		known := false
+		for _, k := range allFaults {
+			known = known || f == k
+		}
+		if !known {
+			return fmt.Errorf("unknown fault %q (want %s)", f, strings.Join(allFaults, ", "))
+		}
+	}
+	if c.DelayMS < 0 {
+		return fmt.Errorf("delay_ms must not be negative")
+	}
+	return nil
+}
+
+// ChaosInjector randomly fails paid requests so SDK and agent authors can
+// exercise their retry and re-payment logic. It is off until enabled
+// through the admin API. Injected faults are never charged.
+type ChaosInjector struct {
+	mu       sync.RWMutex
+	config   ChaosConfig
+	injected map[string]*int64
+}
+
+// NewChaosInjector creates a disabled injector
+func NewChaosInjector() *ChaosInjector {
+	c := &ChaosInjector{injected: make(map[string]*int64)}
+	for _, f := range allFaults {
+		c.injected[f] = new(int64)
+	}
+	return c
+}
+
+// Config returns the current settings
+func (c *ChaosInjector) Config() ChaosConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config
+}
+
+// Set replaces the settings after validating them
+func (c *ChaosInjector) Set(config ChaosConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.config = config
+	c.mu.Unlock()
+	return nil
+}
+
+// pick returns the fault to inject into r, or "" for none
+func (c *ChaosInjector) pick(r *http.Request) string {
+	if c == nil {
+		return ""
+	}
+	config := c.Config()
+	if !config.Enabled || config.Fraction == 0 {
+		return ""
+	}
+	if config.RequireHeader && r.Header.Get("X-Chaos") != "true" {
+		return ""
+	}
+	if rand.Float64() >= config.Fraction {
+		return ""
+	}
+	faults := config.Faults
+	if len(faults) == 0 {
+		faults = allFaults
+	}
+	fault := faults[rand.Intn(len(faults))]
+	atomic.AddInt64(c.injected[fault], 1)
+	return fault
+}
+
+// delay returns how long a slow fault waits
+func (c *ChaosInjector) delay() time.Duration {
+	if ms := c.Config().DelayMS; ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return 3 * time.Second
+}
+
+// truncated runs next into a buffer and sends only the first half of the
+// body. Content-Length announces the full size, so clients see an
+// unexpected EOF rather than a short but well-formed response.
+func truncated(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	rec := newBufferedResponse()
+	next(rec, r)
+
+	for k, v := range rec.header {
+		w.Header()[k] = v
+	}
+	body := rec.body.Bytes()
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(rec.status)
+	w.Write(body[:len(body)/2])
+}
+
+// handleAdminChaos serves /admin/chaos. GET shows the settings, PUT or
+// POST replaces them.
+func (c *ChaosInjector) handleAdminChaos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var config ChaosConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, `{"error":"Invalid JSON body"}`, http.StatusBadRequest)
+			return
+		}
+		if err := c.Set(config); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Config())
+}
+
+// WriteMetrics writes the x402_chaos_faults_total counter
+func (c *ChaosInjector) WriteMetrics(b *strings.Builder) {
+	faults := append([]string(nil), allFaults...)
+	sort.Strings(faults)
+
+	b.WriteString("# HELP x402_chaos_faults_total Faults injected by chaos mode\n")
+	b.WriteString("# TYPE x402_chaos_faults_total counter\n")
+	for _, f := range faults {
+		fmt.Fprintf(b, "x402_chaos_faults_total{fault=%q} %d\n", f, atomic.LoadInt64(c.injected[f]))
+	}
+}
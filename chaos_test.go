@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChaosFaults(t *testing.T) {
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	chaos := NewChaosInjector()
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	paywall.SetChaos(chaos)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	})
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.001"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = config.Receiver
+	serve := func(chaosHeader bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment-Response", signPayment(t, claims))
+		if chaosHeader {
+			req.Header.Set("X-Chaos", "true")
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	if err := chaos.Set(ChaosConfig{Enabled: true, Fraction: 2}); err == nil {
+		t.Error("fraction above 1 accepted")
+	}
+
+	chaos.Set(ChaosConfig{Enabled: true, Fraction: 1, Faults: []string{FaultRateLimit}})
+	if rr := serve(false); rr.Code != http.StatusTooManyRequests || rr.Header().Get("X-Chaos-Fault") != FaultRateLimit {
+		t.Errorf("rate_limit fault: %d %v", rr.Code, rr.Header())
+	}
+
+	chaos.Set(ChaosConfig{Enabled: true, Fraction: 1, Faults: []string{FaultTruncate}})
+	if rr := serve(false); rr.Body.String() != "01234" || rr.Header().Get("Content-Length") != "10" {
+		t.Errorf("truncate fault: body %q, Content-Length %s", rr.Body.String(), rr.Header().Get("Content-Length"))
+	}
+	if n := len(ledger.Entries(DefaultTenant)); n != 0 {
+		t.Errorf("injected faults were charged (%d ledger entries)", n)
+	}
+
+	// With require_header only opted-in requests are affected
+	chaos.Set(ChaosConfig{Enabled: true, Fraction: 1, Faults: []string{FaultRechallenge}, RequireHeader: true})
+	if rr := serve(false); rr.Code != http.StatusOK {
+		t.Errorf("request without X-Chaos was faulted: %d", rr.Code)
+	}
+	if rr := serve(true); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("rechallenge fault: %d", rr.Code)
+	}
+}
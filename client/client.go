@@ -0,0 +1,203 @@
+// Package client is a Go client for the x402 service. Request and response
+// types come from pkg/types so they always match the server.
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/respsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// DefaultBaseURL is the hosted service
+const DefaultBaseURL = "https://x402-security-service.onrender.com"
+
+// Client for the x402 data and security APIs
+type Client struct {
+	BaseURL string
+	// PaymentToken is sent in the X-Payment-Response header when set
+	PaymentToken string
+	// SigningKey, when set, makes every successful response carry a valid
+	// signature by this key (see /.well-known/response-signing)
+	SigningKey ed25519.PublicKey
+	// Receipt, when set, is called with the payment receipt of every paid
+	// response, to keep as proof of payment. With SigningKey set, the
+	// receipt must be signed by it too.
+	Receipt func(types.PaymentReceipt)
+
+	httpClient *http.Client
+}
+
+// NewClient creates a new client; an empty baseURL selects DefaultBaseURL
+func NewClient(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// PaymentRequiredError is returned when the server answers 402
+type PaymentRequiredError struct {
+	Message     string
+	Requirement types.PaymentRequirement
+}
+
+func (e *PaymentRequiredError) Error() string {
+	if e.Requirement.MaxAmount == "" {
+		return "payment required: " + e.Message
+	}
+	return fmt.Sprintf("payment required: %s %s %s",
+		e.Requirement.Description, e.Requirement.MaxAmount, e.Requirement.Asset)
+}
+
+// GetHealth checks service health
+func (c *Client) GetHealth() (map[string]interface{}, error) {
+	var result map[string]interface{}
+	if err := c.do(http.MethodGet, "/health", nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetConfig gets the x402 payment configuration
+func (c *Client) GetConfig() (*types.X402Config, error) {
+	var result types.X402Config
+	if err := c.do(http.MethodGet, "/.well-known/x402", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetGasPrice gets current gas prices (paid)
+func (c *Client) GetGasPrice() (*types.GasData, error) {
+	var result struct {
+		Data *types.GasData `json:"data"`
+	}
+	if err := c.do(http.MethodGet, "/api/gas", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// ScanContract scans a smart contract for risks (paid)
+func (c *Client) ScanContract(address, chain string) (*types.ContractScanResult, error) {
+	var result struct {
+		Data types.ContractScanResult `json:"data"`
+	}
+	req := types.ContractScanRequest{Address: address, Chain: chain}
+	if err := c.do(http.MethodPost, "/api/scan-contract", req, &result); err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
+// GetAgentScore gets the security score for an agent (paid)
+func (c *Client) GetAgentScore(agentID string) (*types.AgentScoreResult, error) {
+	var result struct {
+		Data types.AgentScoreResult `json:"data"`
+	}
+	req := types.AgentScoreRequest{AgentID: agentID}
+	if err := c.do(http.MethodPost, "/api/agent-score", req, &result); err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
+// TxPreflight checks a transaction before execution (paid)
+func (c *Client) TxPreflight(from, to, value, data string) (*types.TxPreflightResult, error) {
+	var result struct {
+		Data types.TxPreflightResult `json:"data"`
+	}
+	req := types.TxPreflightRequest{From: from, To: to, Value: value, Data: data}
+	if err := c.do(http.MethodPost, "/api/tx-preflight", req, &result); err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
+// TestPrompt tests a prompt for injection attacks (paid)
+func (c *Client) TestPrompt(prompt string) (*types.PromptTestResult, error) {
+	var result struct {
+		Data types.PromptTestResult `json:"data"`
+	}
+	req := types.PromptTestRequest{Prompt: prompt}
+	if err := c.do(http.MethodPost, "/api/prompt-test", req, &result); err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
+func (c *Client) do(method, endpoint string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.PaymentToken != "" {
+		req.Header.Set("X-Payment-Response", c.PaymentToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusPaymentRequired {
+		var paymentReq struct {
+			Error   string                   `json:"error"`
+			Payment types.PaymentRequirement `json:"payment"`
+		}
+		json.Unmarshal(data, &paymentReq)
+		return &PaymentRequiredError{Message: paymentReq.Error, Requirement: paymentReq.Payment}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(data))
+	}
+
+	if c.SigningKey != nil {
+		if _, err := respsig.Verify(c.SigningKey, resp.Header, method, req.URL.RequestURI(), data); err != nil {
+			return err
+		}
+	}
+	if header := resp.Header.Get(respsig.HeaderReceipt); header != "" && c.Receipt != nil {
+		receipt, err := respsig.DecodeReceipt(header)
+		if err != nil {
+			return err
+		}
+		if c.SigningKey != nil {
+			if err := respsig.VerifyReceipt(c.SigningKey, receipt); err != nil {
+				return err
+			}
+		}
+		c.Receipt(receipt)
+	}
+
+	return json.Unmarshal(data, out)
+}
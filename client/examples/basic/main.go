@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/arithmosquillsworth/x402-service/client"
+)
+
+func main() {
+	c := client.NewClient(getEnv("X402_API_URL", "http://localhost:8080"))
+	c.PaymentToken = os.Getenv("X402_PAYMENT_TOKEN")
+
+	// Check health
+	fmt.Println("🔍 Checking service health...")
+	health, err := c.GetHealth()
+	if err != nil {
+		fmt.Printf("❌ Health check failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Service healthy: %+v\n\n", health)
+
+	// Get payment config
+	fmt.Println("💰 Getting payment configuration...")
+	config, err := c.GetConfig()
+	if err != nil {
+		fmt.Printf("❌ Failed to get config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Payment config: %+v\n\n", config)
+
+	// Try to get gas price (will show payment requirement)
+	fmt.Println("⛽ Attempting to get gas price...")
+	gas, err := c.GetGasPrice()
+	if err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+		fmt.Println("\nTo access paid endpoints, you need to:")
+		fmt.Println("1. Create an x402 payment token")
+		fmt.Println("2. Include it in the X-Payment-Response header")
+		fmt.Println("\nExample:")
+		fmt.Println(`curl -H "X-Payment-Response: <token>" ` + c.BaseURL + `/api/gas`)
+	} else {
+		fmt.Printf("✅ Gas data: %+v\n", gas)
+	}
+}
+
+func getEnv(key, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return defaultVal
+}
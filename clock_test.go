@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCacheTTLWithFakeClock(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	cache := NewCache(time.Minute)
+	cache.clock = fake
+
+	cache.Set("k", "v")
+	fake.Advance(59 * time.Second)
+	if _, ok := cache.Get("k"); !ok {
+		t.Fatal("item expired before its TTL")
+	}
+	fake.Advance(2 * time.Second)
+	if _, ok := cache.Get("k"); ok {
+		t.Fatal("item still served after its TTL")
+	}
+	cache.evictExpired()
+	if len(cache.items) != 0 {
+		t.Errorf("expired item not evicted: %v", cache.items)
+	}
+}
+
+func TestRateLimiterRefillWithFakeClock(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	limiter := ratelimit.New(60, 2)
+	limiter.SetClock(fake)
+
+	if !limiter.Allow("a") || !limiter.Allow("a") {
+		t.Fatal("burst not allowed")
+	}
+	if limiter.Allow("a") {
+		t.Fatal("request beyond burst allowed")
+	}
+	fake.Advance(time.Second)
+	if !limiter.Allow("a") {
+		t.Error("token not refilled after one second")
+	}
+	if limiter.Allow("a") {
+		t.Error("refilled more than one token")
+	}
+}
+
+func TestLastGoodAgeWithFakeClock(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	cache := lastGood[int]{clock: fake}
+
+	cache.Store(42)
+	fake.Advance(5 * time.Minute)
+	if v, age, ok := cache.Load(10 * time.Minute); !ok || v != 42 || age != 5*time.Minute {
+		t.Fatalf("Load = %d, %v, %v", v, age, ok)
+	}
+	fake.Advance(6 * time.Minute)
+	if _, _, ok := cache.Load(10 * time.Minute); ok {
+		t.Error("value served past maxAge")
+	}
+}
+
+func TestJobExpiryWithFakeClock(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	jobs := NewJobManager(t.TempDir(), 0, NewMetrics())
+	jobs.clock = fake
+
+	jobs.jobs["done"] = &Job{ID: "done", Status: JobSucceeded, UpdatedAt: fake.Now().Unix()}
+	jobs.jobs["queued"] = &Job{ID: "queued", Status: JobQueued, UpdatedAt: fake.Now().Unix()}
+
+	fake.Advance(23 * time.Hour)
+	jobs.expire()
+	if _, ok := jobs.Get("done"); !ok {
+		t.Fatal("job expired before its TTL")
+	}
+	fake.Advance(2 * time.Hour)
+	jobs.expire()
+	if _, ok := jobs.Get("done"); ok {
+		t.Error("finished job kept past its TTL")
+	}
+	if _, ok := jobs.Get("queued"); !ok {
+		t.Error("unfinished job expired")
+	}
+}
+
+func TestPaywallUsesClock(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := NewMetrics()
+	metrics.startTime, metrics.clock = fake.Now(), fake
+
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, metrics, ledger)
+	paywall.SetClock(fake)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		fake.Advance(250 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.001"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = config.Receiver
+	claims.Payment.Network = "base"
+	claims.ExpiresAt = jwt.NewNumericDate(epoch.Add(time.Hour))
+	token := signPayment(t, claims)
+	req := httptest.NewRequest("GET", "/api/gas", nil)
+	req.Header.Set("X-Payment-Response", token)
+	handler(httptest.NewRecorder(), req)
+
+	entries := ledger.Entries(DefaultTenant)
+	if len(entries) != 1 || entries[0].CreatedAt != epoch.Add(250*time.Millisecond).Unix() {
+		t.Fatalf("ledger = %+v, want one entry stamped by the fake clock", entries)
+	}
+
+	fake.Advance(time.Hour)
+	if out := metrics.PrometheusFormat(); !strings.Contains(out, "x402_uptime_seconds 3600.25\n") {
+		t.Errorf("uptime not taken from the fake clock:\n%s", out)
+	}
+}
@@ -1,25 +1,17 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// PaymentToken represents the x402 payment token
-type PaymentToken struct {
-	Payment struct {
-		Amount   string `json:"amount"`
-		Asset    string `json:"asset"`
-		Receiver string `json:"receiver"`
-		Network  string `json:"network"`
-	} `json:"payment"`
-	jwt.RegisteredClaims
-}
-
 func main() {
 	if len(os.Args) < 4 {
 		fmt.Println("Usage: generate-payment <receiver-address> <amount> <network>")
@@ -29,6 +21,15 @@ func main() {
 		fmt.Println("  X402_SIGNING_KEY - Secret key for signing (required)")
 		fmt.Println("  X402_ASSET       - Asset to use (default: USDC)")
 		fmt.Println("  X402_EXPIRY_MIN  - Expiry in minutes (default: 5)")
+		fmt.Println("  X402_PAYER       - Payer address for the sub claim (default: receiver)")
+		fmt.Println("  X402_NONCE       - Nonce from the 402 challenge, if the server issued one")
+		fmt.Println("  X402_REFERRER    - ERC-8004 agent ID that referred you, if any")
+		fmt.Println("  X402_BODY_HASH   - Bind the payment to one request body (0x sha256 of the body)")
+		fmt.Println("  X402_AUDIENCE    - The server's audience, if it validates payments strictly")
+		fmt.Println("  X402_PATH        - Endpoint the payment is for, as named in the 402's resource (default: /api/gas)")
+		fmt.Println("  X402_METHOD      - HTTP method the payment is for (default: GET)")
+		fmt.Println("  X402_TX_HASH     - The transfer that paid, if the server verifies settlement")
+		fmt.Println("  X402_KEY_ID      - Key ID, if the server holds the key in X402_SIGNING_KEYS")
 		os.Exit(1)
 	}
 
@@ -38,6 +39,9 @@ func main() {
 
 	// Get config from env
 	asset := getEnv("X402_ASSET", "USDC")
+	payer := getEnv("X402_PAYER", receiver)
+	path := getEnv("X402_PATH", "/api/gas")
+	method := strings.ToUpper(getEnv("X402_METHOD", "GET"))
 	expiryMin := 5
 	if e := os.Getenv("X402_EXPIRY_MIN"); e != "" {
 		if m, err := time.ParseDuration(e + "m"); err == nil {
@@ -53,28 +57,35 @@ func main() {
 	}
 
 	// Create claims
-	claims := PaymentToken{
-		Payment: struct {
-			Amount   string `json:"amount"`
-			Asset    string `json:"asset"`
-			Receiver string `json:"receiver"`
-			Network  string `json:"network"`
-		}{
+	claims := types.PaymentToken{
+		Payment: types.PaymentClaims{
 			Amount:   amount,
 			Asset:    asset,
 			Receiver: receiver,
 			Network:  network,
+			Nonce:    os.Getenv("X402_NONCE"),
+			Referrer: os.Getenv("X402_REFERRER"),
+			BodyHash: os.Getenv("X402_BODY_HASH"),
+			Method:   method,
+			Path:     path,
+			TxHash:   os.Getenv("X402_TX_HASH"),
 		},
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   receiver,
-			ID:        fmt.Sprintf("%d", time.Now().Unix()),
+			Subject:   payer,
+			ID:        randomID(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiryMin) * time.Minute)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if audience := os.Getenv("X402_AUDIENCE"); audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
 
 	// Create token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if kid := os.Getenv("X402_KEY_ID"); kid != "" {
+		token.Header["kid"] = kid
+	}
 	tokenString, err := token.SignedString([]byte(signingKey))
 	if err != nil {
 		fmt.Printf("❌ Failed to sign token: %v\n", err)
@@ -86,12 +97,14 @@ func main() {
 	fmt.Println("================================")
 	fmt.Printf("Amount:   %s %s\n", amount, asset)
 	fmt.Printf("Receiver: %s\n", receiver)
+	fmt.Printf("Payer:    %s\n", payer)
 	fmt.Printf("Network:  %s\n", network)
+	fmt.Printf("Route:    %s %s\n", method, path)
 	fmt.Printf("Expires:  %d minutes\n", expiryMin)
 	fmt.Println("\nToken:")
 	fmt.Println(tokenString)
 	fmt.Println("\nUsage:")
-	fmt.Printf("  curl -H \"X-Payment-Response: %s\" http://localhost:8080/api/gas\n", tokenString[:50]+"...")
+	fmt.Printf("  curl -X %s -H \"X-Payment-Response: %s\" http://localhost:8080%s\n", method, tokenString[:50]+"...", path)
 }
 
 func getEnv(key, defaultVal string) string {
@@ -100,3 +113,14 @@ func getEnv(key, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+// randomID returns a 128-bit hex jti, so tokens generated in the same
+// second are told apart
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		fmt.Printf("❌ Failed to generate a token ID: %v\n", err)
+		os.Exit(1)
+	}
+	return hex.EncodeToString(b)
+}
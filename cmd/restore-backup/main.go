@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/backup"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("Usage: restore-backup <archive>")
+		fmt.Println("\nRestores a backup into DATA_DIR. Stop the service first.")
+		fmt.Println("\nExamples:")
+		fmt.Println("  restore-backup ./backups/x402-backup-20240101T000000Z.tar.gz")
+		fmt.Println("  BACKUP_DEST=s3://my-bucket/x402 restore-backup x402-backup-20240101T000000Z.tar.gz")
+		fmt.Println("\nEnvironment variables:")
+		fmt.Println("  DATA_DIR       - Directory to restore into (default: ./data)")
+		fmt.Println("  BACKUP_DEST    - Store to fetch the archive from (default: the archive is a local path)")
+		fmt.Println("  RESTORE_FORCE  - Set to 1 to overwrite existing state in DATA_DIR")
+		fmt.Println("  AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_REGION, BACKUP_S3_ENDPOINT - S3 credentials")
+		os.Exit(1)
+	}
+
+	name := os.Args[1]
+	dataDir := getEnv("DATA_DIR", "./data")
+
+	// The archive is checked against its .sha256 sidecar before anything
+	// is written
+	dest := os.Getenv("BACKUP_DEST")
+	if dest == "" {
+		dest, name = filepath.Dir(name), filepath.Base(name)
+	}
+	store, err := backup.OpenStore(dest, backup.S3ConfigFromEnv())
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	archive, err := backup.Download(store, name)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	if os.Getenv("RESTORE_FORCE") != "1" && hasState(dataDir) {
+		fmt.Printf("❌ %s already holds a ledger or jobs; set RESTORE_FORCE=1 to overwrite\n", dataDir)
+		os.Exit(1)
+	}
+
+	manifest, err := backup.Restore(archive, dataDir)
+	if err != nil {
+		fmt.Printf("❌ Restore failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("✅ Backup restored")
+	fmt.Println("==================")
+	fmt.Printf("Archive:  %s\n", name)
+	fmt.Printf("Taken:    %s\n", manifest.CreatedAt.Format("2006-01-02 15:04:05 UTC"))
+	fmt.Printf("Into:     %s\n", dataDir)
+	for _, f := range manifest.Files {
+		fmt.Printf("  %-32s %8d bytes  sha256:%s\n", f.Path, f.Size, f.SHA256[:16])
+	}
+}
+
+// hasState reports whether dataDir already holds service state
+func hasState(dataDir string) bool {
+	if _, err := os.Stat(filepath.Join(dataDir, "jobs.json")); err == nil {
+		return true
+	}
+	partitions, _ := filepath.Glob(filepath.Join(dataDir, "ledger", "*.jsonl"))
+	return len(partitions) > 0
+}
+
+func getEnv(key, defaultVal string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return defaultVal
+}
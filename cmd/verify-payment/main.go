@@ -1,25 +1,14 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// PaymentToken represents the x402 payment token
-type PaymentToken struct {
-	Payment struct {
-		Amount   string `json:"amount"`
-		Asset    string `json:"asset"`
-		Receiver string `json:"receiver"`
-		Network  string `json:"network"`
-	} `json:"payment"`
-	jwt.RegisteredClaims
-}
-
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: verify-payment <jwt-token>")
@@ -31,13 +20,13 @@ func main() {
 	tokenString := os.Args[1]
 
 	// Parse without verification (for inspection)
-	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, &PaymentToken{})
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, &types.PaymentToken{})
 	if err != nil {
 		fmt.Printf("❌ Failed to parse token: %v\n", err)
 		os.Exit(1)
 	}
 
-	claims, ok := token.Claims.(*PaymentToken)
+	claims, ok := token.Claims.(*types.PaymentToken)
 	if !ok {
 		fmt.Println("❌ Invalid token claims")
 		os.Exit(1)
@@ -50,6 +39,9 @@ func main() {
 	fmt.Printf("Receiver: %s\n", claims.Payment.Receiver)
 	fmt.Printf("Network:  %s\n", claims.Payment.Network)
 	
+	if claims.Payment.Path != "" {
+		fmt.Printf("Route:    %s %s\n", claims.Payment.Method, claims.Payment.Path)
+	}
 	if claims.Subject != "" {
 		fmt.Printf("Subject:  %s\n", claims.Subject)
 	}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+)
+
+// ChainConfig describes a supported chain and its block explorer
+type ChainConfig struct {
+	ChainID     string `json:"chain_id"`
+	ExplorerAPI string `json:"explorer_api"`
+	APIKeyEnv   string `json:"api_key_env"` // env var holding the explorer API keys, comma separated
+}
+
+// APIKey returns the first explorer API key from the environment.
+// explorerKeys swaps in whichever of the chain's keys has budget left.
+func (c ChainConfig) APIKey() string {
+	if keys := c.APIKeys(); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// APIKeys returns every explorer API key in the environment
+func (c ChainConfig) APIKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv(c.APIKeyEnv), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// PatternConfig is a prompt injection pattern loaded from the config file
+type PatternConfig struct {
+	Name        string `json:"name"`
+	Regex       string `json:"regex"`
+	RiskPoints  int    `json:"risk_points"`
+	Description string `json:"description"`
+}
+
+// PriceSourceConfig weights or disables an ETH price source
+type PriceSourceConfig struct {
+	Weight   float64 `json:"weight,omitempty"` // share of the consensus price, default 1
+	Disabled bool    `json:"disabled,omitempty"`
+}
+
+// BridgeConfig adds a bridge contract to the registry tx-preflight and the
+// MEV check validate bridge calls against
+type BridgeConfig struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Kind    string `json:"kind"` // canonical or third_party
+}
+
+// KnownContractConfig adds a contract to the allowlist of recognized
+// protocol contracts, whose scan risk scores are capped
+type KnownContractConfig struct {
+	Name    string `json:"name"`
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+}
+
+// PolicyConfig is a set of transaction approval rules tx-preflight rules
+// on: allow, needs_review or deny. Rules left out do not apply.
+type PolicyConfig struct {
+	Name            string   `json:"name"`
+	Chains          []string `json:"chains,omitempty"`            // chains transactions may be sent on
+	MaxValue        string   `json:"max_value,omitempty"`         // wei; more is denied
+	ReviewValue     string   `json:"review_value,omitempty"`      // wei; more needs review
+	Selectors       []string `json:"selectors,omitempty"`         // functions that may be called; plain transfers always may
+	MaxRiskScore    *int     `json:"max_risk_score,omitempty"`    // a higher preflight risk score is denied
+	ReviewRiskScore *int     `json:"review_risk_score,omitempty"` // a higher one needs review
+}
+
+// RuntimeConfig is the part of the configuration that can be reloaded
+// without a restart. Snapshots are immutable once published.
+type RuntimeConfig struct {
+	Prices          map[string]string            `json:"prices,omitempty"` // endpoint -> USDC price override
+	Chains          map[string]ChainConfig       `json:"chains"`
+	Patterns        []PatternConfig              `json:"injection_patterns,omitempty"`
+	Blocklist       []string                     `json:"blocklist,omitempty"`
+	Tenants         []TenantConfig               `json:"tenants,omitempty"`
+	Gateways        []GatewayRoute               `json:"gateways,omitempty"`
+	Flags           map[string]bool              `json:"flags,omitempty"` // feature flag -> enabled
+	PriceSources    map[string]PriceSourceConfig `json:"price_sources,omitempty"`
+	Bridges         []BridgeConfig               `json:"bridges,omitempty"`
+	KnownContracts  []KnownContractConfig        `json:"known_contracts,omitempty"`
+	Notifiers       []NotifierConfig             `json:"notifiers,omitempty"`
+	Policies        []PolicyConfig               `json:"policies,omitempty"`
+	Translations    map[string]map[string]string `json:"translations,omitempty"` // language -> English text -> translation
+	RiskWeights     map[string]int               `json:"risk_weights,omitempty"` // rule -> points, overriding defaultRiskWeights
+	PaymentNetworks []PaymentNetworkConfig       `json:"payment_networks,omitempty"`
+	Experiments     []PriceExperiment            `json:"price_experiments,omitempty"`
+	LoadedAt        int64                        `json:"loaded_at"`
+	RulesetHash     string                       `json:"ruleset_hash"` // see rulesetHash
+
+	blocked      map[string]bool
+	bridges      map[string]BridgeConfig
+	known        map[string]string // "chain:address" -> name
+	weights      map[string]int    // every rule's effective weight
+	patterns     []InjectionPattern
+	translations map[string]map[string]string // keyed by lowercase language tag
+}
+
+// defaultChains are used when the config file does not define any
+var defaultChains = map[string]ChainConfig{
+	"base":     {ChainID: "8453", ExplorerAPI: "https://api.basescan.org/api", APIKeyEnv: "BASESCAN_API_KEY"},
+	"ethereum": {ChainID: "1", ExplorerAPI: "https://api.etherscan.io/api", APIKeyEnv: "ETHERSCAN_API_KEY"},
+}
+
+// Chain returns the config for a chain name
+func (c *RuntimeConfig) Chain(name string) (ChainConfig, bool) {
+	chain, ok := c.Chains[name]
+	return chain, ok
+}
+
+// ChainNames returns the configured chain names, quoted for error messages
+func (c *RuntimeConfig) ChainNames() string {
+	names := make([]string, 0, len(c.Chains))
+	for name := range c.Chains {
+		names = append(names, "'"+name+"'")
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Price returns the price override for endpoint, if any
+func (c *RuntimeConfig) Price(endpoint string) (string, float64, bool) {
+	return lookupPrice(c.Prices, endpoint)
+}
+
+func lookupPrice(prices map[string]string, endpoint string) (string, float64, bool) {
+	price, ok := prices[endpoint]
+	if !ok {
+		return "", 0, false
+	}
+	usd, _ := strconv.ParseFloat(price, 64)
+	return price, usd, true
+}
+
+func validatePrices(prices map[string]string) error {
+	for endpoint, price := range prices {
+		if err := validatePrice(price); err != nil {
+			return fmt.Errorf("%s: %w", endpoint, err)
+		}
+	}
+	return nil
+}
+
+// PriceSource returns the consensus weight of an ETH price source, or false
+// if it is disabled
+func (c *RuntimeConfig) PriceSource(name string) (float64, bool) {
+	src := c.PriceSources[name]
+	if src.Disabled {
+		return 0, false
+	}
+	if src.Weight == 0 {
+		return 1, true
+	}
+	return src.Weight, true
+}
+
+func validatePriceSources(sources map[string]PriceSourceConfig) error {
+	for name, src := range sources {
+		if !isPriceSource(name) {
+			return fmt.Errorf("unknown price source %q", name)
+		}
+		if src.Weight < 0 {
+			return fmt.Errorf("invalid weight %v for price source %s", src.Weight, name)
+		}
+	}
+	for _, src := range ethPriceSources {
+		if !sources[src.name].Disabled {
+			return nil
+		}
+	}
+	return fmt.Errorf("every price source is disabled")
+}
+
+// Gateway returns the gateway route with the given name
+func (c *RuntimeConfig) Gateway(name string) (*GatewayRoute, bool) {
+	for i := range c.Gateways {
+		if c.Gateways[i].Name == name {
+			return &c.Gateways[i], true
+		}
+	}
+	return nil, false
+}
+
+// IsBlocked reports whether addr is on the blocklist
+func (c *RuntimeConfig) IsBlocked(addr string) bool {
+	return c.blocked[strings.ToLower(addr)]
+}
+
+// Bridge returns the registry entry for a bridge contract. Entries from
+// the config file take precedence over the built-in registry.
+func (c *RuntimeConfig) Bridge(addr string) (BridgeConfig, bool) {
+	if b, ok := c.bridges[strings.ToLower(addr)]; ok {
+		return b, true
+	}
+	b, ok := bridgeRegistry[strings.ToLower(addr)]
+	return b, ok
+}
+
+// KnownContract returns the name of a recognized protocol contract on
+// chain. Entries from the config file take precedence over the built-in
+// allowlist.
+func (c *RuntimeConfig) KnownContract(chain, addr string) (string, bool) {
+	if name, ok := c.known[knownContractKey(chain, addr)]; ok {
+		return name, true
+	}
+	name, ok := knownContracts[chain][strings.ToLower(addr)]
+	return name, ok
+}
+
+// InjectionPatterns returns the compiled extra prompt injection patterns
+func (c *RuntimeConfig) InjectionPatterns() []InjectionPattern {
+	return c.patterns
+}
+
+// RiskWeight returns the points a named scan rule adds to a risk score
+func (c *RuntimeConfig) RiskWeight(rule string) int {
+	return c.weights[rule]
+}
+
+// EffectiveRiskWeights returns every scan rule's weight, defaults included
+func (c *RuntimeConfig) EffectiveRiskWeights() map[string]int {
+	return c.weights
+}
+
+// parseRuntimeConfig decodes and validates a config file. Every field is
+// checked up front so a bad file never replaces a good snapshot.
+func parseRuntimeConfig(data []byte) (*RuntimeConfig, error) {
+	cfg := &RuntimeConfig{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validatePrices(cfg.Prices); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Chains) == 0 {
+		cfg.Chains = defaultChains
+	}
+	for name, chain := range cfg.Chains {
+		if chain.ChainID == "" || chain.ExplorerAPI == "" {
+			return nil, fmt.Errorf("chain %s needs chain_id and explorer_api", name)
+		}
+	}
+
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %s: %w", p.Name, err)
+		}
+		cfg.patterns = append(cfg.patterns, InjectionPattern{
+			Name:        p.Name,
+			Regex:       re,
+			RiskPoints:  p.RiskPoints,
+			Description: p.Description,
+		})
+	}
+
+	cfg.blocked = make(map[string]bool, len(cfg.Blocklist))
+	for _, addr := range cfg.Blocklist {
+		if err := address.Validate(addr); err != nil {
+			return nil, fmt.Errorf("blocklist entry %q: %w", addr, err)
+		}
+		cfg.blocked[strings.ToLower(addr)] = true
+	}
+
+	cfg.bridges = make(map[string]BridgeConfig, len(cfg.Bridges))
+	for _, b := range cfg.Bridges {
+		if err := b.validate(); err != nil {
+			return nil, err
+		}
+		cfg.bridges[strings.ToLower(b.Address)] = b
+	}
+
+	cfg.known = make(map[string]string, len(cfg.KnownContracts))
+	for _, k := range cfg.KnownContracts {
+		if err := k.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := cfg.Chains[k.Chain]; !ok {
+			return nil, fmt.Errorf("known contract %s: unknown chain %q", k.Name, k.Chain)
+		}
+		cfg.known[knownContractKey(k.Chain, k.Address)] = k.Name
+	}
+
+	policies := make(map[string]bool, len(cfg.Policies))
+	for i := range cfg.Policies {
+		p := &cfg.Policies[i]
+		if err := p.validate(cfg.Chains); err != nil {
+			return nil, err
+		}
+		if policies[p.Name] {
+			return nil, fmt.Errorf("duplicate policy %s", p.Name)
+		}
+		policies[p.Name] = true
+	}
+
+	seen := make(map[string]bool)
+	for i := range cfg.Tenants {
+		t := &cfg.Tenants[i]
+		if err := t.validate(); err != nil {
+			return nil, err
+		}
+		keys := []string{"id:" + t.ID}
+		for _, h := range t.Hosts {
+			keys = append(keys, "host:"+strings.ToLower(h))
+		}
+		if t.PathPrefix != "" {
+			keys = append(keys, "prefix:"+t.PathPrefix)
+		}
+		for _, k := range keys {
+			if seen[k] {
+				return nil, fmt.Errorf("tenant %s: duplicate %s", t.ID, k)
+			}
+			seen[k] = true
+		}
+	}
+
+	names := make(map[string]bool)
+	for i := range cfg.Gateways {
+		g := &cfg.Gateways[i]
+		if err := g.validate(); err != nil {
+			return nil, err
+		}
+		if names[g.Name] {
+			return nil, fmt.Errorf("duplicate gateway %s", g.Name)
+		}
+		names[g.Name] = true
+	}
+
+	networks := make(map[string]bool)
+	for i := range cfg.PaymentNetworks {
+		n := &cfg.PaymentNetworks[i]
+		if err := n.validate(); err != nil {
+			return nil, err
+		}
+		if networks[n.Network] {
+			return nil, fmt.Errorf("duplicate payment network %s", n.Network)
+		}
+		networks[n.Network] = true
+	}
+
+	experiments := make(map[string]bool)
+	for i := range cfg.Experiments {
+		e := &cfg.Experiments[i]
+		if err := e.validate(); err != nil {
+			return nil, err
+		}
+		for _, k := range []string{"name:" + e.Name, "endpoint:" + e.Endpoint} {
+			if experiments[k] {
+				return nil, fmt.Errorf("price experiment %s: duplicate %s", e.Name, k)
+			}
+			experiments[k] = true
+		}
+	}
+
+	notifiers := make(map[string]bool)
+	for i := range cfg.Notifiers {
+		n := &cfg.Notifiers[i]
+		if err := n.validate(); err != nil {
+			return nil, err
+		}
+		if notifiers[n.Name] {
+			return nil, fmt.Errorf("duplicate notifier %s", n.Name)
+		}
+		notifiers[n.Name] = true
+	}
+
+	for name := range cfg.Flags {
+		if err := validateFlag(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validatePriceSources(cfg.PriceSources); err != nil {
+		return nil, err
+	}
+
+	translations, err := validateTranslations(cfg.Translations)
+	if err != nil {
+		return nil, err
+	}
+	cfg.translations = translations
+
+	weights, err := resolveRiskWeights(cfg.RiskWeights)
+	if err != nil {
+		return nil, err
+	}
+	cfg.weights = weights
+
+	cfg.RulesetHash = rulesetHash(cfg)
+	cfg.LoadedAt = time.Now().Unix()
+	return cfg, nil
+}
+
+// ConfigStore holds the current RuntimeConfig snapshot. Readers call
+// Current once per request; Reload swaps in a new snapshot atomically.
+type ConfigStore struct {
+	path    string
+	current atomic.Pointer[RuntimeConfig]
+
+	mu       sync.Mutex
+	onReload []func(*RuntimeConfig)
+}
+
+// NewConfigStore creates a store with the built-in defaults
+func NewConfigStore() *ConfigStore {
+	s := &ConfigStore{}
+	cfg, _ := parseRuntimeConfig(nil)
+	s.current.Store(cfg)
+	return s
+}
+
+// SetPath sets the config file read by Reload
+func (s *ConfigStore) SetPath(path string) {
+	s.path = path
+}
+
+// Current returns the active snapshot
+func (s *ConfigStore) Current() *RuntimeConfig {
+	return s.current.Load()
+}
+
+// OnReload calls fn with the active snapshot now and with every snapshot a
+// Reload swaps in after, for state that is built from the config
+func (s *ConfigStore) OnReload(fn func(*RuntimeConfig)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReload = append(s.onReload, fn)
+	fn(s.Current())
+}
+
+// Reload re-reads the config file and swaps it in. On error the previous
+// snapshot stays active.
+func (s *ConfigStore) Reload() error {
+	var data []byte
+	if s.path != "" {
+		var err error
+		data, err = os.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+	}
+	cfg, err := parseRuntimeConfig(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.current.Store(cfg)
+	for _, fn := range s.onReload {
+		fn(cfg)
+	}
+	s.mu.Unlock()
+	log.Printf("🔄 Config loaded: %d price overrides, %d chains, %d patterns, %d blocked addresses, %d tenants, %d gateways, ruleset %.12s",
+		len(cfg.Prices), len(cfg.Chains), len(cfg.patterns), len(cfg.blocked), len(cfg.Tenants), len(cfg.Gateways), cfg.RulesetHash)
+	return nil
+}
+
+// handleAdminReload serves POST /admin/reload
+func (s *ConfigStore) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.Reload(); err != nil {
+		log.Printf("⚠️  Config reload failed: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Current())
+}
+
+// handleAdminConfig serves GET /admin/config
+func (s *ConfigStore) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Current())
+}
+
+// adminOnly requires "Authorization: Bearer <token>". With no token
+// configured the admin API is disabled.
+func adminOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, `{"error":"Forbidden"}`, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// runtimeConfig is the process-wide reloadable configuration. main points
+// it at CONFIG_FILE and reloads it on SIGHUP.
+var runtimeConfig = NewConfigStore()
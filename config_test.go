@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	store := NewConfigStore()
+	store.SetPath(path)
+
+	good := `{
+		"prices": {"/api/gas": "0.004"},
+		"injection_patterns": [{"name": "custom", "regex": "(?i)exfiltrate", "risk_points": 80}],
+		"blocklist": ["0x000000000000000000000000000000000000dEaD"]
+	}`
+	if err := os.WriteFile(path, []byte(good), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	cfg := store.Current()
+	if price, usd, ok := cfg.Price("/api/gas"); !ok || price != "0.004" || usd != 0.004 {
+		t.Errorf("price override = %q %v %v", price, usd, ok)
+	}
+	if _, ok := cfg.Chain("base"); !ok {
+		t.Error("default chains missing")
+	}
+	if !cfg.IsBlocked("0x000000000000000000000000000000000000dead") {
+		t.Error("blocklist lookup should be case-insensitive")
+	}
+	if len(cfg.InjectionPatterns()) != 1 {
+		t.Errorf("got %d patterns, want 1", len(cfg.InjectionPatterns()))
+	}
+
+	// A bad file leaves the previous snapshot in place
+	if err := os.WriteFile(path, []byte(`{"prices": {"/api/gas": "free"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Fatal("expected error for invalid price")
+	}
+	if store.Current() != cfg {
+		t.Error("failed reload replaced the snapshot")
+	}
+}
+
+func TestPaywallUsesPriceOverride(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(`{"prices": {"/api/gas": "0.004"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	handler := NewPaywall(config, NewMetrics(), nil).Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/gas", nil))
+
+	var body struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Payment.MaxAmount != "0.004" {
+		t.Errorf("402 quoted %q, want 0.004", body.Payment.MaxAmount)
+	}
+}
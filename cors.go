@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsExposedHeaders are the response headers browser clients may read
+var corsExposedHeaders = strings.Join([]string{
+	"X-Payment-Id", "X-Trace-Id", "X-Sandbox", "X-RateLimit-Limit", "X-RateLimit-Remaining",
+	"X-RateLimit-Reset", "Retry-After", "Age", "X-Payment-Required", "X-Payment-Response",
+}, ", ")
+
+// parseOrigins reads CORS_ALLOWED_ORIGINS: "*", a comma-separated list of
+// origins, or "none" to disable cross-origin access
+func parseOrigins(s string) []string {
+	if strings.TrimSpace(s) == "none" {
+		return nil
+	}
+	var origins []string
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSuffix(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+// withCORS lets pages on the allowed origins call the API from a browser,
+// including sending X-Payment-Response. The admin API is not shared.
+func withCORS(origins []string, next http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	wildcard := false
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		wildcard = wildcard || o == "*"
+		allowed[o] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || strings.HasPrefix(r.URL.Path, "/admin/") || !wildcard && !allowed[origin] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if wildcard {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, X-Payment-Response, X-Payment, X-Coupon, X-Request-Signature, traceparent")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// couponPrefix starts every coupon code
+const couponPrefix = "x402c_"
+
+var (
+	errCouponsDisabled = errors.New("coupons are not accepted")
+	errCouponInvalid   = errors.New("invalid coupon")
+	errCouponExpired   = errors.New("coupon expired")
+	errCouponRevoked   = errors.New("coupon revoked")
+	errCouponUsedUp    = errors.New("coupon used up")
+	errCouponEndpoint  = errors.New("coupon not valid for this endpoint")
+)
+
+// Coupon grants free or discounted calls. Its terms are signed into the
+// code, so only use counts and revocations are stored.
+type Coupon struct {
+	ID          string   `json:"id"`
+	DiscountPct int      `json:"discount_pct"`        // 100 makes calls free
+	Uses        int64    `json:"uses"`                // calls it pays for, 0 for unlimited
+	ExpiresAt   int64    `json:"expires_at"`          // unix seconds, 0 for never
+	Endpoints   []string `json:"endpoints,omitempty"` // empty for every paid endpoint
+	Tenant      string   `json:"tenant,omitempty"`    // empty for every tenant
+	Note        string   `json:"note,omitempty"`
+}
+
+// free reports whether the coupon replaces payment entirely
+func (c *Coupon) free() bool {
+	return c != nil && c.DiscountPct >= 100
+}
+
+func couponID(c *Coupon) string {
+	if c == nil {
+		return ""
+	}
+	return c.ID
+}
+
+func (c *Coupon) validate(now time.Time) error {
+	if c.DiscountPct < 1 || c.DiscountPct > 100 {
+		return errors.New("discount_pct must be between 1 and 100")
+	}
+	if c.Uses < 0 {
+		return errors.New("uses must not be negative")
+	}
+	if c.ExpiresAt != 0 && c.ExpiresAt <= now.Unix() {
+		return errors.New("expires_at must be in the future")
+	}
+	for _, e := range c.Endpoints {
+		if !strings.HasPrefix(e, "/") {
+			return fmt.Errorf("endpoint %q must start with /", e)
+		}
+	}
+	return nil
+}
+
+// CouponStatus is how much of a coupon is used
+type CouponStatus struct {
+	ID      string `json:"id"`
+	Used    int64  `json:"used"`
+	Revoked bool   `json:"revoked"`
+}
+
+// Coupons issues and redeems coupon codes signed with COUPON_SECRET. A nil
+// *Coupons accepts none.
+type Coupons struct {
+	secret []byte
+	clock  clock.Clock
+}
+
+// NewCoupons returns the coupon book for secret, or nil if it is empty
+func NewCoupons(secret string) *Coupons {
+	if secret == "" {
+		return nil
+	}
+	return &Coupons{secret: []byte(secret), clock: clock.System}
+}
+
+func (c *Coupons) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue returns the code for coupon, assigning it an ID if it has none
+func (c *Coupons) Issue(coupon *Coupon) (string, error) {
+	if c == nil {
+		return "", errCouponsDisabled
+	}
+	if err := coupon.validate(c.clock.Now()); err != nil {
+		return "", err
+	}
+	if coupon.ID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		coupon.ID = "cpn_" + hex.EncodeToString(b)
+	}
+	data, _ := json.Marshal(coupon)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return couponPrefix + payload + "." + c.sign(payload), nil
+}
+
+// parse verifies a code's signature and returns its terms
+func (c *Coupons) parse(code string) (*Coupon, error) {
+	payload, sig, ok := strings.Cut(strings.TrimPrefix(code, couponPrefix), ".")
+	if !ok || !strings.HasPrefix(code, couponPrefix) || !hmac.Equal([]byte(sig), []byte(c.sign(payload))) {
+		return nil, errCouponInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errCouponInvalid
+	}
+	var coupon Coupon
+	if err := json.Unmarshal(data, &coupon); err != nil || coupon.ID == "" {
+		return nil, errCouponInvalid
+	}
+	return &coupon, nil
+}
+
+// Check returns the coupon for code if it may be applied to a call to
+// endpoint for tenant. It does not use it up; reserve does.
+func (c *Coupons) Check(code, endpoint, tenant string) (*Coupon, error) {
+	if c == nil {
+		return nil, errCouponsDisabled
+	}
+	coupon, err := c.parse(code)
+	if err != nil {
+		return nil, err
+	}
+	if coupon.ExpiresAt != 0 && c.clock.Now().Unix() >= coupon.ExpiresAt {
+		return nil, errCouponExpired
+	}
+	if coupon.Tenant != "" && coupon.Tenant != tenant {
+		return nil, errCouponInvalid
+	}
+	if len(coupon.Endpoints) > 0 && !containsString(coupon.Endpoints, endpoint) {
+		return nil, errCouponEndpoint
+	}
+	status := c.Status(coupon.ID)
+	if status.Revoked {
+		return nil, errCouponRevoked
+	}
+	if coupon.Uses > 0 && status.Used >= coupon.Uses {
+		return nil, errCouponUsedUp
+	}
+	return coupon, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func couponKey(id, counter string) string {
+	return "coupon:" + id + ":" + counter
+}
+
+// counterTTL keeps a coupon's counters a day past its expiry
+func (c *Coupon) counterTTL(now time.Time) time.Duration {
+	if c.ExpiresAt == 0 {
+		return 0
+	}
+	return time.Unix(c.ExpiresAt, 0).Sub(now) + 24*time.Hour
+}
+
+func (c *Coupons) counter(id, name string) int64 {
+	v, ok, err := sharedState.Get(couponKey(id, name))
+	if err != nil || !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(v, 10, 64)
+	return n
+}
+
+// Status returns how many calls a coupon has paid for
+func (c *Coupons) Status(id string) CouponStatus {
+	_, revoked, _ := sharedState.Get(couponKey(id, "revoked"))
+	return CouponStatus{ID: id, Used: c.counter(id, "used") - c.counter(id, "released"), Revoked: revoked}
+}
+
+// reserve counts a use of coupon, reporting false if none is left. If the
+// store is unreachable the use is allowed.
+func (c *Coupons) reserve(coupon *Coupon) bool {
+	ttl := coupon.counterTTL(c.clock.Now())
+	n, err := sharedState.Incr(couponKey(coupon.ID, "used"), ttl)
+	if err != nil {
+		log.Printf("⚠️  Coupon uses unavailable, allowing %s: %v", coupon.ID, err)
+		return true
+	}
+	if coupon.Uses > 0 && n-c.counter(coupon.ID, "released") > coupon.Uses {
+		c.release(coupon)
+		return false
+	}
+	return true
+}
+
+// release gives back a use whose call was not charged
+func (c *Coupons) release(coupon *Coupon) {
+	if c == nil || coupon == nil {
+		return
+	}
+	if _, err := sharedState.Incr(couponKey(coupon.ID, "released"), coupon.counterTTL(c.clock.Now())); err != nil {
+		log.Printf("⚠️  Coupon use of %s not released: %v", coupon.ID, err)
+	}
+}
+
+// handleAdminCoupons serves /admin/coupons. POST with the coupon's terms
+// issues a code, GET /admin/coupons/{id} reports its uses and DELETE
+// /admin/coupons/{id} revokes it.
+func (c *Coupons) handleAdminCoupons(w http.ResponseWriter, r *http.Request) {
+	if c == nil {
+		http.Error(w, `{"error":"Coupons are disabled: set COUPON_SECRET"}`, http.StatusNotFound)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/coupons"), "/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		var coupon Coupon
+		if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+			http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		code, err := c.Issue(&coupon)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		log.Printf("🎟️  Coupon issued: id=%s discount=%d%% uses=%d expires=%d", coupon.ID, coupon.DiscountPct, coupon.Uses, coupon.ExpiresAt)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "coupon": coupon})
+	case r.Method == http.MethodGet && id != "":
+		json.NewEncoder(w).Encode(c.Status(id))
+	case r.Method == http.MethodDelete && id != "":
+		if err := sharedState.Set(couponKey(id, "revoked"), "1", 0); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("🎟️  Coupon revoked: id=%s", id)
+		json.NewEncoder(w).Encode(c.Status(id))
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestCoupons(t *testing.T) {
+	srv, up := startService(t, map[string]string{"COUPON_SECRET": "s3cret", "DEGRADED_MODE": "refuse"})
+
+	admin := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+e2eAdminToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	issue := func(terms string) (string, Coupon) {
+		t.Helper()
+		resp := admin("POST", "/admin/coupons", terms)
+		var out struct {
+			Code   string `json:"code"`
+			Coupon Coupon `json:"coupon"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(out.Code, couponPrefix) {
+			t.Fatalf("issue returned %d %+v", resp.StatusCode, out)
+		}
+		return out.Code, out.Coupon
+	}
+	call := func(coupon, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+"/api/gas", nil)
+		req.Header.Set("X-Coupon", coupon)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// Free calls need no payment, up to the coupon's uses
+	free, freeCoupon := issue(`{"discount_pct": 100, "uses": 2, "endpoints": ["/api/gas"]}`)
+	up.Fail(testhttp.RPC, true)
+	if resp := call(free, ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("free call with failed RPC returned %d", resp.StatusCode)
+	}
+	up.Fail(testhttp.RPC, false)
+	for i := range 2 {
+		if resp := call(free, ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("free call %d returned %d", i, resp.StatusCode)
+		}
+	}
+	if resp := call(free, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("used up coupon returned %d, want 400", resp.StatusCode)
+	}
+	var status CouponStatus
+	json.NewDecoder(admin("GET", "/admin/coupons/"+freeCoupon.ID, "").Body).Decode(&status)
+	if status.Used != 2 {
+		t.Errorf("status = %+v, want 2 uses; the failed call is not counted", status)
+	}
+
+	// Discounts lower the quoted price
+	half, halfCoupon := issue(`{"discount_pct": 50}`)
+	challenge := call(half, "")
+	if challenge.StatusCode != http.StatusPaymentRequired {
+		t.Fatalf("discounted call without payment returned %d", challenge.StatusCode)
+	}
+	if resp := call(half, pay(t, challenge)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("discounted payment returned %d", resp.StatusCode)
+	}
+
+	entries := ledgerEntries(t, srv)
+	if len(entries) != 3 {
+		t.Fatalf("ledger = %+v", entries)
+	}
+	amounts := map[string]string{}
+	for _, e := range entries {
+		amounts[e.Coupon] += e.Amount + " "
+	}
+	if amounts[freeCoupon.ID] != "0 0 " || amounts[halfCoupon.ID] != "0.0005 " {
+		t.Errorf("ledger amounts by coupon = %v", amounts)
+	}
+
+	// Tampered and revoked codes are refused
+	if resp := call(half+"x", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("tampered coupon returned %d", resp.StatusCode)
+	}
+	admin("DELETE", "/admin/coupons/"+halfCoupon.ID, "")
+	if resp := call(half, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("revoked coupon returned %d", resp.StatusCode)
+	}
+	if resp := admin("POST", "/admin/coupons", `{"discount_pct": 0}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("coupon without a discount returned %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Credit states of a ledger entry and a request's charge
+const (
+	CreditGranted  = "granted"  // served from fallback data, so the payer's next call is free
+	CreditRedeemed = "redeemed" // paid for by an earlier credit
+)
+
+// Credits refunds calls served from fallback data with a free call to the
+// same endpoint. A credit belongs to a tenant, payer and endpoint, and is
+// counted in sharedState so any replica honors it. A nil *Credits grants
+// none.
+type Credits struct {
+	mu     sync.Mutex
+	counts map[string]int64 // CreditGranted or CreditRedeemed -> credits
+}
+
+// NewCredits returns an empty credit book
+func NewCredits() *Credits {
+	return &Credits{counts: make(map[string]int64)}
+}
+
+func creditKey(tenant, payer, endpoint, counter string) string {
+	return "credit:" + tenant + ":" + payer + ":" + endpoint + ":" + counter
+}
+
+func (c *Credits) counter(key string) int64 {
+	v, ok, err := sharedState.Get(key)
+	if err != nil || !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(v, 10, 64)
+	return n
+}
+
+// Balance returns how many free calls payer has left at endpoint
+func (c *Credits) Balance(tenant, payer, endpoint string) int64 {
+	if c == nil {
+		return 0
+	}
+	key := func(counter string) string { return creditKey(tenant, payer, endpoint, counter) }
+	return c.counter(key("granted")) - c.counter(key("redeemed")) + c.counter(key("restored"))
+}
+
+// grant credits payer with a free call to endpoint
+func (c *Credits) grant(tenant, payer, endpoint string) error {
+	if c == nil {
+		return nil
+	}
+	if _, err := sharedState.Incr(creditKey(tenant, payer, endpoint, "granted"), 0); err != nil {
+		return err
+	}
+	c.count(CreditGranted)
+	log.Printf("💸 Credit granted: tenant=%s endpoint=%s payer=%s", tenant, endpoint, payer)
+	return nil
+}
+
+// redeem uses up one of payer's credits at endpoint, reporting false if
+// there is none. If the store is unreachable no credit is redeemed.
+func (c *Credits) redeem(tenant, payer, endpoint string) bool {
+	if c == nil {
+		return false
+	}
+	if c.Balance(tenant, payer, endpoint) <= 0 {
+		return false
+	}
+	if _, err := sharedState.Incr(creditKey(tenant, payer, endpoint, "redeemed"), 0); err != nil {
+		log.Printf("⚠️  Credits unavailable, charging %s: %v", payer, err)
+		return false
+	}
+	// Another replica may have redeemed the last credit first
+	if c.Balance(tenant, payer, endpoint) < 0 {
+		c.restore(tenant, payer, endpoint)
+		return false
+	}
+	c.count(CreditRedeemed)
+	return true
+}
+
+// restore gives back a credit whose call was not served
+func (c *Credits) restore(tenant, payer, endpoint string) {
+	if _, err := sharedState.Incr(creditKey(tenant, payer, endpoint, "restored"), 0); err != nil {
+		log.Printf("⚠️  Credit of %s at %s not restored: %v", payer, endpoint, err)
+	}
+}
+
+func (c *Credits) count(state string) {
+	c.mu.Lock()
+	c.counts[state]++
+	c.mu.Unlock()
+}
+
+// WriteMetrics emits the credits this replica granted and redeemed
+func (c *Credits) WriteMetrics(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b.WriteString("# HELP x402_payment_credits_total Free calls credited for fallback responses, by state\n")
+	b.WriteString("# TYPE x402_payment_credits_total counter\n")
+	for _, state := range []string{CreditGranted, CreditRedeemed} {
+		fmt.Fprintf(b, "x402_payment_credits_total{state=%q} %d\n", state, c.counts[state])
+	}
+}
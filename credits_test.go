@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCredits(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	const payer = "0x00000000000000000000000000000000000c0ed1"
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	credits := NewCredits()
+	paywall.SetCredits(credits)
+
+	policy := DegradationPolicy{Mode: DegradeCredit}
+	upstreamDown, refuse := true, false
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if refuse {
+			chargeFromContext(r.Context()).refuse()
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if upstreamDown {
+			policy.Fallback(w, r)
+		}
+	}
+	price := paywall.Protect("/api/price", "0.002", 0.002, "test", handler)
+	gas := paywall.Protect("/api/gas", "0.001", 0.001, "test", handler)
+
+	token := func(amount string) string {
+		claims := PaymentToken{}
+		claims.Subject = payer
+		claims.Payment.Amount = amount
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Receiver = config.Receiver
+		return signPayment(t, claims)
+	}
+	call := func(h http.HandlerFunc, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Payment-Response", token)
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+	last := func() LedgerEntry {
+		return ledger.Entries(DefaultTenant)[0]
+	}
+
+	// Fallback data is charged, and earns a credit
+	if rr := call(price, "/api/price", token("0.002")); rr.Code != http.StatusOK || rr.Header().Get("X-Payment-Credit") != CreditGranted {
+		t.Fatalf("fallback call returned %d, credit %q", rr.Code, rr.Header().Get("X-Payment-Credit"))
+	}
+	if e := last(); e.Credit != CreditGranted || e.Amount != "0.002" {
+		t.Errorf("fallback entry = %+v", e)
+	}
+	if n := credits.Balance(DefaultTenant, payer, "/api/price"); n != 1 {
+		t.Fatalf("balance = %d, want 1", n)
+	}
+
+	// The credit is only good at the same endpoint
+	upstreamDown = false
+	if rr := call(gas, "/api/gas", token("0.001")); rr.Header().Get("X-Payment-Credit") != "" || last().Credit != "" {
+		t.Errorf("credit redeemed at another endpoint: %+v", last())
+	}
+
+	// The next call is free, and its payment is given back
+	next := token("0.002")
+	if rr := call(price, "/api/price", next); rr.Code != http.StatusOK || rr.Header().Get("X-Payment-Credit") != CreditRedeemed {
+		t.Fatalf("next call returned %d, credit %q", rr.Code, rr.Header().Get("X-Payment-Credit"))
+	}
+	if e := last(); e.Credit != CreditRedeemed || e.Amount != "0" || e.AmountUSD != 0 {
+		t.Errorf("redeemed entry = %+v, want it free", e)
+	}
+	if rr := call(price, "/api/price", next); rr.Code != http.StatusOK || rr.Header().Get("X-Payment-Credit") != "" || last().Amount != "0.002" {
+		t.Errorf("reused payment returned %d, entry %+v, want it charged", rr.Code, last())
+	}
+
+	// A credit whose call is refused is kept for the next one, and a free
+	// call served from fallback data earns none
+	upstreamDown = true
+	call(price, "/api/price", token("0.002"))
+	refuse = true
+	call(price, "/api/price", token("0.002"))
+	if n := credits.Balance(DefaultTenant, payer, "/api/price"); n != 1 {
+		t.Fatalf("balance after a refused call = %d, want 1", n)
+	}
+	refuse = false
+	if rr := call(price, "/api/price", token("0.002")); rr.Header().Get("X-Payment-Credit") != CreditRedeemed {
+		t.Errorf("fallback call paid by a credit: credit %q", rr.Header().Get("X-Payment-Credit"))
+	}
+	if n := credits.Balance(DefaultTenant, payer, "/api/price"); n != 0 {
+		t.Errorf("balance = %d, want 0", n)
+	}
+
+	var b strings.Builder
+	credits.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_payment_credits_total{state="granted"} 2`,
+		`x402_payment_credits_total{state="redeemed"} 3`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
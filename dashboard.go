@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+//go:embed operator/index.html
+var operatorDashboardHTML []byte
+
+// dashboardTopPayers is how many payers the dashboard lists
+const dashboardTopPayers = 10
+
+// DashboardData is the snapshot the operator dashboard polls
+type DashboardData struct {
+	GeneratedAt   int64             `json:"generated_at"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Revenue       DashboardRevenue  `json:"revenue"`
+	Endpoints     []EndpointTraffic `json:"endpoints"`
+	Upstreams     []UpstreamHealth  `json:"upstreams"`
+	TopPayers     []PayerRevenue    `json:"top_payers"` // last 24 hours
+	Failures      []PaymentFailure  `json:"failures"`   // newest first
+}
+
+// DashboardRevenue is captured revenue from the ledger, across tenants
+type DashboardRevenue struct {
+	LastHourUSD float64   `json:"last_hour_usd"`
+	Last24hUSD  float64   `json:"last_24h_usd"`
+	TotalUSD    float64   `json:"total_usd"`
+	Payments24h int       `json:"payments_24h"`
+	HourlyUSD   []float64 `json:"hourly_usd"` // the last 24 hours, oldest first
+}
+
+// EndpointTraffic is an endpoint's request counters since start. The
+// dashboard derives rates from successive polls.
+type EndpointTraffic struct {
+	Endpoint string `json:"endpoint"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"` // 5xx responses
+	Payments int64  `json:"payments"`
+}
+
+// PayerRevenue is what one payer paid
+type PayerRevenue struct {
+	Payer     string  `json:"payer"`
+	Payments  int     `json:"payments"`
+	AmountUSD float64 `json:"amount_usd"`
+}
+
+// Dashboard serves the operator dashboard from the metrics, the ledger,
+// the paywall's recent failures and the upstream limiter
+type Dashboard struct {
+	metrics   *Metrics
+	ledger    *Ledger
+	paywall   *Paywall
+	upstreams *UpstreamLimiter
+	clock     clock.Clock
+}
+
+// NewDashboard creates the operator dashboard
+func NewDashboard(metrics *Metrics, ledger *Ledger, paywall *Paywall, upstreams *UpstreamLimiter) *Dashboard {
+	return &Dashboard{metrics: metrics, ledger: ledger, paywall: paywall, upstreams: upstreams, clock: clock.System}
+}
+
+// Data builds the current snapshot
+func (d *Dashboard) Data() DashboardData {
+	now := d.clock.Now()
+	data := DashboardData{
+		GeneratedAt:   now.Unix(),
+		UptimeSeconds: int64(d.metrics.Uptime().Seconds()),
+		Revenue:       DashboardRevenue{HourlyUSD: make([]float64, 24)},
+		Endpoints:     []EndpointTraffic{},
+		Upstreams:     d.upstreams.Health(),
+		TopPayers:     []PayerRevenue{},
+		Failures:      d.paywall.Failures(),
+	}
+
+	dayAgo := now.Add(-24 * time.Hour).Unix()
+	payers := make(map[string]*PayerRevenue)
+	for _, tenant := range d.ledger.Tenants() {
+		for _, e := range d.ledger.Entries(tenant) {
+			data.Revenue.TotalUSD += e.AmountUSD
+			if e.CreatedAt <= dayAgo {
+				continue
+			}
+			data.Revenue.Last24hUSD += e.AmountUSD
+			data.Revenue.Payments24h++
+			if hour := int((now.Unix() - e.CreatedAt) / 3600); hour < 24 {
+				data.Revenue.HourlyUSD[23-hour] += e.AmountUSD
+				if hour == 0 {
+					data.Revenue.LastHourUSD += e.AmountUSD
+				}
+			}
+			p, ok := payers[e.Payer]
+			if !ok {
+				p = &PayerRevenue{Payer: e.Payer}
+				payers[e.Payer] = p
+			}
+			p.Payments++
+			p.AmountUSD += e.AmountUSD
+		}
+	}
+	for _, p := range payers {
+		data.TopPayers = append(data.TopPayers, *p)
+	}
+	sort.Slice(data.TopPayers, func(i, j int) bool {
+		a, b := data.TopPayers[i], data.TopPayers[j]
+		if a.AmountUSD != b.AmountUSD {
+			return a.AmountUSD > b.AmountUSD
+		}
+		return a.Payer < b.Payer
+	})
+	if len(data.TopPayers) > dashboardTopPayers {
+		data.TopPayers = data.TopPayers[:dashboardTopPayers]
+	}
+
+	payments := d.metrics.PaymentCounts()
+	for endpoint, counts := range d.metrics.RequestCounts() {
+		data.Endpoints = append(data.Endpoints, EndpointTraffic{
+			Endpoint: endpoint,
+			Requests: counts[0],
+			Errors:   counts[1],
+			Payments: payments[endpoint],
+		})
+	}
+	sort.Slice(data.Endpoints, func(i, j int) bool {
+		a, b := data.Endpoints[i], data.Endpoints[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	return data
+}
+
+// handleDashboard serves GET /admin/dashboard and its data feed at
+// /admin/dashboard/data
+func (d *Dashboard) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/admin/dashboard":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(operatorDashboardHTML)
+	case "/admin/dashboard/data":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.Data())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// adminBrowserOnly is adminOnly for pages opened in a browser. It also
+// accepts HTTP Basic credentials with the admin token as the password, and
+// asks for them when they are missing.
+func adminBrowserOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	bearer := adminOnly(token, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, password, ok := r.BasicAuth(); ok {
+			if token != "" && subtle.ConstantTimeCompare([]byte(password), []byte(token)) == 1 {
+				next(w, r)
+				return
+			}
+		} else if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			bearer(w, r)
+			return
+		}
+		if token != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="x402 operator", charset="UTF-8"`)
+			http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, `{"error":"Forbidden"}`, http.StatusForbidden)
+	}
+}
+
+// Uptime is how long the metrics have been collected
+func (m *Metrics) Uptime() time.Duration {
+	return clock.Since(m.clock, m.startTime)
+}
+
+// PaymentCounts returns the number of captured payments per endpoint
+func (m *Metrics) PaymentCounts() map[string]int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]int64, len(m.paymentsByEndpoint))
+	for endpoint, n := range m.paymentsByEndpoint {
+		out[endpoint] = n
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOperatorDashboard(t *testing.T) {
+	srv, _ := startService(t, nil)
+
+	resp := paidRequest(t, srv, "GET", "/api/gas", "")
+	resp.Body.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/api/gas", nil)
+	req.Header.Set("X-Payment-Response", "not-a-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	get := func(path string, auth func(*http.Request)) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		auth(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Browsers are asked for Basic credentials
+	resp = get("/admin/dashboard", func(*http.Request) {})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("anonymous dashboard returned %d", resp.StatusCode)
+	}
+	resp = get("/admin/dashboard", func(r *http.Request) { r.SetBasicAuth("ops", "wrong") })
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password returned %d", resp.StatusCode)
+	}
+	resp = get("/admin/dashboard", func(r *http.Request) { r.SetBasicAuth("ops", e2eAdminToken) })
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("dashboard returned %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	resp = get("/admin/dashboard/data", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+e2eAdminToken) })
+	defer resp.Body.Close()
+	var data DashboardData
+	json.NewDecoder(resp.Body).Decode(&data)
+
+	if data.Revenue.Payments24h != 1 || data.Revenue.LastHourUSD != 0.001 || data.Revenue.HourlyUSD[23] != 0.001 || len(data.Revenue.HourlyUSD) != 24 {
+		t.Errorf("revenue = %+v", data.Revenue)
+	}
+	if len(data.TopPayers) != 1 || data.TopPayers[0].Payments != 1 {
+		t.Errorf("top payers = %+v", data.TopPayers)
+	}
+	var gas *EndpointTraffic
+	for i := range data.Endpoints {
+		if data.Endpoints[i].Endpoint == "/api/gas" {
+			gas = &data.Endpoints[i]
+		}
+	}
+	if gas == nil || gas.Requests != 3 || gas.Payments != 1 {
+		t.Errorf("endpoints = %+v", data.Endpoints)
+	}
+	if len(data.Upstreams) == 0 || data.Upstreams[0].Status != UpstreamOK || data.Upstreams[0].Requests == 0 {
+		t.Errorf("upstreams = %+v", data.Upstreams)
+	}
+	if len(data.Failures) != 1 || data.Failures[0].Endpoint != "/api/gas" || data.Failures[0].Reason != "invalid or insufficient payment" {
+		t.Errorf("failures = %+v", data.Failures)
+	}
+}
+
+func TestUpstreamHealth(t *testing.T) {
+	l := NewUpstreamLimiter(nil, 1, 0)
+	p := l.pool("etherscan")
+	p.record(&http.Response{StatusCode: http.StatusOK}, nil, time.Now())
+	for range upstreamDownAfter {
+		p.record(&http.Response{StatusCode: http.StatusBadGateway}, nil, time.Now())
+	}
+	health := l.Health()
+	if len(health) != 1 || health[0].Status != UpstreamDown || health[0].Requests != 4 || health[0].Failures != 3 || health[0].LastError != "status 502" {
+		t.Errorf("health = %+v", health)
+	}
+	p.record(&http.Response{StatusCode: http.StatusOK}, nil, time.Now())
+	if health := l.Health(); health[0].Status != UpstreamOK {
+		t.Errorf("recovered health = %+v", health)
+	}
+}
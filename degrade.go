@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// Degradation modes for responses that can only be built from fallback data
+const (
+	DegradeServe    = "serve"    // serve fallback data at full price
+	DegradeDiscount = "discount" // serve fallback data and capture a fraction of the price
+	DegradeRefuse   = "refuse"   // answer 503 and capture nothing
+	DegradeCredit   = "credit"   // serve fallback data at full price and credit the payer's next call
+)
+
+// DegradationPolicy decides what a data endpoint does when upstreams fail
+type DegradationPolicy struct {
+	Mode           string
+	ChargeFraction float64       // share of the price captured in discount mode
+	MaxStaleness   time.Duration // how long a last good value may be re-served
+}
+
+// ParseDegradationMode validates a DEGRADED_MODE value
+func ParseDegradationMode(mode string) (string, error) {
+	switch mode {
+	case "", DegradeServe:
+		return DegradeServe, nil
+	case DegradeDiscount, DegradeRefuse, DegradeCredit:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown degradation mode %q", mode)
+}
+
+// Fallback applies the policy to a request that only has fallback data.
+// It returns false when the request was refused and a 503 already written.
+func (p DegradationPolicy) Fallback(w http.ResponseWriter, r *http.Request) bool {
+	c := chargeFromContext(r.Context())
+	switch p.Mode {
+	case DegradeRefuse:
+		c.refuse()
+		log.Printf("⚠️  Refusing %s with fallback data, payment not captured: payer=%s", r.URL.Path, payerLabel(r))
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, `{"error":"Upstream data unavailable, payment not captured"}`, http.StatusServiceUnavailable)
+		return false
+	case DegradeDiscount:
+		c.discount(p.ChargeFraction)
+		w.Header().Set("X-Payment-Charge-Fraction", strconv.FormatFloat(p.ChargeFraction, 'f', -1, 64))
+	case DegradeCredit:
+		if c.creditFallback() {
+			w.Header().Set("X-Payment-Credit", CreditGranted)
+		}
+	}
+	w.Header().Set("X-Data-Quality", types.QualityFallback)
+	return true
+}
+
+// charge tracks how much of a verified payment a request captures. The
+// paywall attaches one to each paid request and records the payment after
+// the handler returns. Its id becomes the ledger entry's ID.
+type charge struct {
+	id       string
+	amount   string // asset amount paid
+	asset    string // the asset it was paid in
+	fiat     string // the fiat price the amount was converted from, if any
+	network  string // the network it was paid on
+	receiver string // who it was paid to on that network
+	referrer string // ERC-8004 agent ID named in the payment
+	txHash   string // the verified on-chain transfer, if settlement is checked
+	// authorization is the signed transfer an exact payment was made with
+	authorization *ExactPayload
+	// facilitated is what the facilitator verified, to settle on capture
+	facilitated *facilitatorRequest
+	// spends are the token, authorization or transaction the payment
+	// spent, given back if the request does not capture it
+	spends []*paymentClaim
+	// hold is the price taken from a prepaid balance, refunded if the
+	// request does not capture it
+	hold *accountHold
+	// account is AccountDebit for a call paid from a prepaid balance, or
+	// AccountDeposit once the payment has topped one up
+	account  string
+	mu       sync.Mutex
+	fraction float64
+	refused  bool
+	kept     bool   // captured, so the spends are final
+	credit   string // CreditGranted or CreditRedeemed, if the call earned or used a credit
+}
+
+const chargeContextKey contextKey = "x402.charge"
+
+func withCharge(ctx context.Context, c *charge) context.Context {
+	return context.WithValue(ctx, chargeContextKey, c)
+}
+
+// chargeFromContext returns the request's charge, or nil outside the paywall
+func chargeFromContext(ctx context.Context) *charge {
+	c, _ := ctx.Value(chargeContextKey).(*charge)
+	return c
+}
+
+func (c *charge) refuse() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refused = true
+}
+
+func (c *charge) discount(fraction float64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fraction < c.fraction {
+		c.fraction = fraction
+	}
+}
+
+// creditFallback earns the payer a credit for a call served from fallback
+// data, reporting false if the call was itself paid for by one
+func (c *charge) creditFallback() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.credit == CreditRedeemed {
+		return false
+	}
+	c.credit = CreditGranted
+	return true
+}
+
+// redeemCredit makes the call free. The payment only identified the payer,
+// so it is not settled or shared with a referrer, and is given back on
+// release.
+func (c *charge) redeemCredit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.credit = CreditRedeemed
+	c.amount, c.txHash, c.referrer = "0", "", ""
+	c.authorization, c.facilitated = nil, nil
+}
+
+// captured returns the fraction of the price to record, or false if refused
+func (c *charge) captured() (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fraction, !c.refused
+}
+
+// credited returns the credit the call earned or used, if any
+func (c *charge) credited() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.credit
+}
+
+// fundAccount marks the payment as deposited into a prepaid balance. A
+// deposit is not revenue until it is spent, so no referrer shares it.
+func (c *charge) fundAccount() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.account = AccountDeposit
+	c.referrer = ""
+}
+
+// accountMovement returns AccountDeposit or AccountDebit if the payment
+// moved a prepaid balance
+func (c *charge) accountMovement() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.account
+}
+
+// keep makes the payment's spends final, once it is captured
+func (c *charge) keep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.kept = true
+}
+
+// release ends the request. A payment it did not capture is given back,
+// so the client can pay with it again; a captured one stays spent.
+func (c *charge) release() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	kept := c.kept
+	c.mu.Unlock()
+	if kept {
+		return
+	}
+	for _, claim := range c.spends {
+		claim.release()
+	}
+	c.hold.refund(1)
+}
+
+// lastGood keeps the most recent successful upstream value so it can be
+// re-served, marked stale, while upstreams are failing
+type lastGood[T any] struct {
+	mu    sync.Mutex
+	value T
+	at    time.Time
+	clock clock.Clock // nil means clock.System
+}
+
+func (c *lastGood[T]) now() time.Time {
+	if c.clock == nil {
+		return clock.System.Now()
+	}
+	return c.clock.Now()
+}
+
+// Store records a fresh value
+func (c *lastGood[T]) Store(v T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value = v
+	c.at = c.now()
+}
+
+// Load returns the last value and its age if it is no older than maxAge
+func (c *lastGood[T]) Load(maxAge time.Duration) (T, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero T
+	if c.at.IsZero() {
+		return zero, 0, false
+	}
+	age := c.now().Sub(c.at)
+	if age > maxAge {
+		return zero, 0, false
+	}
+	return c.value, age, true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mixers are the Tornado Cash contracts on Ethereum mainnet, keyed by
+// lowercase address. ETH withdrawn from them has no traceable source.
+var mixers = map[string]string{
+	"0x12d66f87a04a9e220743712ce6d9bb1b5616b8fc": "Tornado Cash 0.1 ETH",
+	"0x47ce0c6ed5b0ce3d3a51fdb1c52dc66a7c3c2936": "Tornado Cash 1 ETH",
+	"0x910cbd523d972eb0a6f4cae4618ad62622b39dbf": "Tornado Cash 10 ETH",
+	"0xa160cdab225685da1d56aa342ad8841c3b53f291": "Tornado Cash 100 ETH",
+	"0xd90e2f925da726b50c4ed8d0fb90ad053324f31b": "Tornado Cash Router",
+	"0x722122df12d4e14e13ac3b6895a86e84145b6967": "Tornado Cash Proxy",
+}
+
+// Contract age thresholds; most scam contracts are days old when they are
+// reported
+const (
+	newContractAge    = 7 * 24 * time.Hour
+	recentContractAge = 30 * 24 * time.Hour
+)
+
+// deployerHistoryLimit is how many of a deployer's earliest transactions
+// are read, enough to find its funding and first deployments
+const deployerHistoryLimit = 100
+
+// explorerTx is a normal or internal transaction from the explorer's
+// account module
+type explorerTx struct {
+	From            string `json:"from"`
+	To              string `json:"to"`
+	Value           string `json:"value"`
+	ContractAddress string `json:"contractAddress"`
+	IsError         string `json:"isError"`
+}
+
+// checkDeployment records when and by whom a contract was deployed, flags
+// young contracts, and scores the deployer: blocklisted itself, earlier
+// deployments on the blocklist, or funded from a mixer
+func (s *ContractScanner) checkDeployment(address string, chain ChainConfig, result *ContractScanResult) []riskPattern {
+	patterns := []riskPattern{}
+	creation, err := providers.Explorer.ContractCreation(address, chain)
+	if err != nil {
+		return patterns
+	}
+	result.Deployer = creation.Creator
+	result.CreationTx = creation.TxHash
+
+	if !creation.Created.IsZero() {
+		days := creation.ageDays()
+		result.DeployedAt = creation.Created.Unix()
+		result.AgeDays = &days
+		age := time.Since(creation.Created)
+		if age < recentContractAge {
+			score := runtimeConfig.Current().RiskWeight(RuleRecentContract)
+			if age < newContractAge {
+				score = runtimeConfig.Current().RiskWeight(RuleNewContract)
+			}
+			patterns = append(patterns, riskPattern{
+				name:        deployedAgoFlag(days),
+				score:       score,
+				description: fmt.Sprintf("Contract age is %d day(s) - new contracts carry the most scam risk", days),
+			})
+		}
+	}
+
+	if creation.Creator == "" {
+		return patterns
+	}
+	if runtimeConfig.Current().IsBlocked(creation.Creator) {
+		patterns = append(patterns, riskPattern{
+			name:        "deployer_blocklisted",
+			score:       runtimeConfig.Current().RiskWeight(RuleDeployerBlocklisted),
+			description: fmt.Sprintf("Deployer %s is on the operator blocklist", creation.Creator),
+		})
+	}
+
+	txs, err := providers.Explorer.AccountTxs(creation.Creator, "txlist", chain)
+	if err != nil {
+		return patterns
+	}
+	var rugs []string
+	for _, tx := range txs {
+		if tx.ContractAddress != "" && !strings.EqualFold(tx.ContractAddress, address) && runtimeConfig.Current().IsBlocked(tx.ContractAddress) {
+			rugs = append(rugs, strings.ToLower(tx.ContractAddress))
+		}
+	}
+	if len(rugs) > 0 {
+		patterns = append(patterns, riskPattern{
+			name:        "deployer_prior_rugs",
+			score:       runtimeConfig.Current().RiskWeight(RuleDeployerPriorRugs),
+			description: fmt.Sprintf("Deployer created %d other blocklisted contract(s): %s", len(rugs), strings.Join(rugs, ", ")),
+		})
+	}
+
+	// Mixer withdrawals arrive as internal transactions from the pool
+	internal, err := providers.Explorer.AccountTxs(creation.Creator, "txlistinternal", chain)
+	if err == nil {
+		txs = append(txs, internal...)
+	}
+	for _, tx := range txs {
+		mixer, ok := mixers[strings.ToLower(tx.From)]
+		if ok && strings.EqualFold(tx.To, creation.Creator) && tx.IsError != "1" {
+			patterns = append(patterns, riskPattern{
+				name:        "deployer_mixer_funded",
+				score:       runtimeConfig.Current().RiskWeight(RuleDeployerMixerFunded),
+				description: fmt.Sprintf("Deployer was funded from %s", mixer),
+			})
+			break
+		}
+	}
+	return patterns
+}
+
+// deployedAgoFlag is the age flag for a contract deployed days ago
+func deployedAgoFlag(days int) string {
+	switch days {
+	case 0:
+		return "deployed_today"
+	case 1:
+		return "deployed_1_day_ago"
+	}
+	return fmt.Sprintf("deployed_%d_days_ago", days)
+}
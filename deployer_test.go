@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestScanDeployment(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+
+	const (
+		token    = "0x00000000000000000000000000000000000d0c01"
+		rugged   = "0x00000000000000000000000000000000000d0c02"
+		deployer = "0x00000000000000000000000000000000000de901"
+	)
+	cfg, err := parseRuntimeConfig([]byte(`{"blocklist": ["` + rugged + `"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousConfig := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previousConfig)
+
+	up.SetContract(token, testhttp.Contract{Verified: true, Creator: deployer, Created: time.Now().Add(-3*24*time.Hour - time.Hour).Unix()})
+	up.AddTransactions(deployer,
+		testhttp.Tx{From: "0x910cbd523d972eb0a6f4cae4618ad62622b39dbf", To: deployer, Value: "10000000000000000000", Internal: true},
+		testhttp.Tx{From: deployer, ContractAddress: rugged},
+		testhttp.Tx{From: deployer, ContractAddress: token},
+	)
+
+	result, err := NewContractScanner().Scan(token, "ethereum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := strings.Join(result.Flags, ",")
+	if flags != "deployed_3_days_ago,deployer_prior_rugs,deployer_mixer_funded" || result.RiskScore != 95 {
+		t.Errorf("risk %d flags %v", result.RiskScore, result.Flags)
+	}
+	if result.Deployer != deployer || result.AgeDays == nil || *result.AgeDays != 3 || result.DeployedAt == 0 {
+		t.Errorf("deployment = %+v", result)
+	}
+
+	// An old contract from a clean deployer adds nothing
+	const old = "0x00000000000000000000000000000000000d0c03"
+	up.SetContract(old, testhttp.Contract{Verified: true, Creator: "0x00000000000000000000000000000000000de902", Created: time.Now().Add(-400 * 24 * time.Hour).Unix()})
+	result, _ = NewContractScanner().Scan(old, "ethereum")
+	if len(result.Flags) != 0 || result.RiskScore != 0 || *result.AgeDays != 400 {
+		t.Errorf("old contract = %+v", result)
+	}
+
+	if flag := deployedAgoFlag(0); flag != "deployed_today" {
+		t.Errorf("deployedAgoFlag(0) = %s", flag)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+	"github.com/arithmosquillsworth/x402-service/pkg/respsig"
+)
+
+const e2eAdminToken = "e2e-admin"
+
+// startService boots the full service against fake upstreams. env is
+// applied on top of a test baseline.
+func startService(t *testing.T, env map[string]string) (*httptest.Server, *testhttp.Upstreams) {
+	t.Helper()
+	up := testhttp.New(t)
+
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+	previousProviders := providers
+	t.Cleanup(func() { providers = previousProviders })
+	previousSchemas := responseSchemas
+	t.Cleanup(func() { responseSchemas = previousSchemas })
+	previousEvents := events
+	t.Cleanup(func() { events = previousEvents })
+	previousKeys := paymentKeys
+	paymentKeys = &PaymentKeys{}
+	t.Cleanup(func() { paymentKeys = previousKeys })
+
+	t.Setenv("ETH_RPC_URL", up.RPC.URL)
+	t.Setenv("BEACON_API_URL", up.Beacon.URL)
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("ADMIN_TOKEN", e2eAdminToken)
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("RESPONSE_SCHEMAS", SchemaCheckStrict)
+	t.Setenv("X402_SIGNING_KEY", testSigningKey)
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	svc, err := newService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(svc.handler)
+	t.Cleanup(srv.Close)
+	return srv, up
+}
+
+// pay answers a 402 challenge with a token for the quoted requirement
+func pay(t *testing.T, challenge *http.Response) string {
+	t.Helper()
+	var body struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	if err := json.NewDecoder(challenge.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	claims := PaymentToken{}
+	claims.Payment.Amount = body.Payment.MaxAmount
+	claims.Payment.Asset = body.Payment.Asset
+	claims.Payment.Receiver = body.Payment.Receiver
+	claims.Payment.Network = body.Payment.Network
+	claims.Payment.Nonce = body.Payment.Nonce
+	claims.Subject = "0xabc0000000000000000000000000000000000001"
+	return signPayment(t, claims)
+}
+
+// paidRequest runs the full 402 flow: an unpaid request, then the same
+// request with a token for the quoted price
+func paidRequest(t *testing.T, srv *httptest.Server, method, path, body string) *http.Response {
+	t.Helper()
+	do := func(token string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	challenge := do("")
+	defer challenge.Body.Close()
+	if challenge.StatusCode != http.StatusPaymentRequired {
+		t.Fatalf("%s %s without payment returned %d, want 402", method, path, challenge.StatusCode)
+	}
+	return do(pay(t, challenge))
+}
+
+func ledgerEntries(t *testing.T, srv *httptest.Server) []LedgerEntry {
+	t.Helper()
+	req, _ := http.NewRequest("GET", srv.URL+"/admin/ledger", nil)
+	req.Header.Set("Authorization", "Bearer "+e2eAdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Entries []LedgerEntry `json:"entries"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return body.Entries
+}
+
+func TestE2EGasPaymentFlow(t *testing.T) {
+	srv, up := startService(t, nil)
+
+	resp := paidRequest(t, srv, "GET", "/api/gas", "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("paid request returned %d", resp.StatusCode)
+	}
+	var body struct {
+		Data GasData `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Data.Gas["current"] != 20 || body.Data.Quality != "live" {
+		t.Errorf("unexpected gas data: %+v", body.Data)
+	}
+	if up.Hits(testhttp.RPC) == 0 {
+		t.Error("fake RPC was not called")
+	}
+
+	entries := ledgerEntries(t, srv)
+	if len(entries) != 1 || entries[0].Endpoint != "/api/gas" || entries[0].Amount != "0.001" {
+		t.Errorf("ledger = %+v", entries)
+	}
+}
+
+func TestE2EChallengeNonces(t *testing.T) {
+	srv, _ := startService(t, map[string]string{"FEATURE_FLAGS": "challenge_nonces"})
+	t.Cleanup(func() { featureFlags.ParseEnv("") })
+
+	get := func(path, token string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	token := pay(t, get("/api/gas", ""))
+	if resp := get("/api/gas", token); resp.StatusCode != http.StatusOK {
+		t.Fatalf("payment with the challenge nonce returned %d", resp.StatusCode)
+	}
+	if resp := get("/api/gas", token); resp.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("reused nonce returned %d, want 402", resp.StatusCode)
+	}
+
+	// A token minted without a challenge is refused
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.001"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"
+	claims.Payment.Network = "base"
+	claims.Payment.Nonce = "deadbeef"
+	premint := signPayment(t, claims)
+	if resp := get("/api/gas", premint); resp.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("pre-minted token returned %d, want 402", resp.StatusCode)
+	}
+
+	// A nonce quoted for one endpoint does not pay for another
+	var body struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(get("/api/validators", "").Body).Decode(&body)
+	if body.Payment.Nonce == "" || body.Payment.NonceExpiresAt == 0 {
+		t.Fatalf("challenge = %+v, want a nonce", body.Payment)
+	}
+	claims.Payment.Nonce = body.Payment.Nonce
+	other := signPayment(t, claims)
+	if resp := get("/api/gas", other); resp.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("nonce from another endpoint returned %d, want 402", resp.StatusCode)
+	}
+
+	if entries := ledgerEntries(t, srv); len(entries) != 1 {
+		t.Errorf("ledger = %+v, want only the nonced payment", entries)
+	}
+}
+
+func TestE2EPriceInCurrency(t *testing.T) {
+	srv, up := startService(t, nil)
+	up.SetETHPrice(2000)
+
+	resp := paidRequest(t, srv, "GET", "/api/price?currency=eur", "")
+	defer resp.Body.Close()
+	var body struct {
+		Data PriceData `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Data.Eth != 2000 || body.Data.EthPrice != 1800 || len(body.Data.Sources) != 3 {
+		t.Errorf("unexpected price data: %+v", body.Data)
+	}
+}
+
+func TestE2EValidators(t *testing.T) {
+	srv, up := startService(t, nil)
+	up.SetActiveValidators(1200)
+	up.SetPendingDeposits(150)
+
+	resp := paidRequest(t, srv, "GET", "/api/validators", "")
+	defer resp.Body.Close()
+	var body struct {
+		Data ValidatorData `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Data.Active != 1200 || body.Data.PendingDeposits != 150 || body.Data.Queue["entry_wait_hours"] != 2.0 {
+		t.Errorf("unexpected validator data: %+v", body.Data)
+	}
+}
+
+func TestE2EContractScan(t *testing.T) {
+	srv, up := startService(t, nil)
+	const target = "0x1111111111111111111111111111111111111111"
+	up.SetContract(target, testhttp.Contract{Verified: false, Honeypot: true})
+
+	resp := paidRequest(t, srv, "POST", "/api/scan-contract", `{"address":"`+target+`","chain":"base"}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scan returned %d", resp.StatusCode)
+	}
+	var body struct {
+		Data ContractScanResult `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	flags := strings.Join(body.Data.Flags, ",")
+	if !strings.Contains(flags, "unverified_contract") || !strings.Contains(flags, "honeypot_indicators") {
+		t.Errorf("flags = %v", body.Data.Flags)
+	}
+	if up.Hits(testhttp.Basescan) == 0 || up.Hits(testhttp.Honeypot) == 0 {
+		t.Error("scanner did not query the explorer and honeypot fakes")
+	}
+}
+
+func TestE2EUpstreamFailureIsNotCharged(t *testing.T) {
+	srv, up := startService(t, map[string]string{"DEGRADED_MODE": "refuse"})
+	up.Fail(testhttp.RPC, true)
+
+	resp := paidRequest(t, srv, "GET", "/api/gas", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("gas with failed RPC returned %d, want 503", resp.StatusCode)
+	}
+	if entries := ledgerEntries(t, srv); len(entries) != 0 {
+		t.Errorf("failed request was charged: %+v", entries)
+	}
+}
+
+func TestE2ESignedResponses(t *testing.T) {
+	srv, _ := startService(t, map[string]string{"RESPONSE_SIGNING_KEY": strings.Repeat("07", 32)})
+
+	resp, err := http.Get(srv.URL + "/.well-known/response-signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key struct {
+		PublicKey []byte `json:"public_key"`
+	}
+	json.NewDecoder(resp.Body).Decode(&key)
+	resp.Body.Close()
+	if len(key.PublicKey) != ed25519.PublicKeySize {
+		t.Fatalf("public key = %x", key.PublicKey)
+	}
+
+	for _, accept := range []string{"application/json", "text/csv"} {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/gas?unit=wei", nil)
+		req.Header.Set("Accept", accept)
+		challenge, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Payment-Response", pay(t, challenge))
+		challenge.Body.Close()
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if _, err := respsig.Verify(key.PublicKey, resp.Header, "GET", "/api/gas?unit=wei", body); err != nil {
+			t.Errorf("%s response: %v", accept, err)
+		}
+	}
+
+	// Free and admin responses are not signed
+	req, _ := http.NewRequest("GET", srv.URL+"/admin/ledger", nil)
+	req.Header.Set("Authorization", "Bearer "+e2eAdminToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get(respsig.HeaderSignature) != "" {
+		t.Error("admin ledger response was signed")
+	}
+}
+
+func TestE2EPrepaidAccountsGated(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		env := map[string]string{"PREPAID_ACCOUNTS": ""}
+		if enabled {
+			env["PREPAID_ACCOUNTS"] = "true"
+		}
+		srv, _ := startService(t, env)
+
+		resp, err := http.Get(srv.URL + "/capabilities")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var caps Capabilities
+		json.NewDecoder(resp.Body).Decode(&caps)
+		resp.Body.Close()
+		if caps.Payment.PrepaidAccounts != enabled {
+			t.Errorf("enabled=%v: capabilities report prepaid_accounts=%v", enabled, caps.Payment.PrepaidAccounts)
+		}
+
+		resp, err = http.Get(srv.URL + "/api/pricing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if listed := strings.Contains(string(body), `"/api/account/topup"`); listed != enabled {
+			t.Errorf("enabled=%v: /api/pricing lists the top-up: %v", enabled, listed)
+		}
+
+		resp, err = http.Post(srv.URL+"/api/account/topup", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if paid := resp.StatusCode == http.StatusPaymentRequired; paid != enabled {
+			t.Errorf("enabled=%v: unpaid top-up returned %d", enabled, resp.StatusCode)
+		}
+	}
+}
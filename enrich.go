@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// maxEnrichItems bounds how many items one /api/enrich call covers
+const maxEnrichItems = 50
+
+// enrichWorkers bounds how many transactions are fetched at once
+const enrichWorkers = 8
+
+// Risk flags /api/enrich sets on an item
+const (
+	riskFlagBlocklisted       = "blocklisted"                  // the address, or a party to the transaction, is on the blocklist
+	riskFlagKnownContract     = "recognized_protocol_contract" // the address, or the transaction's target, is on the allowlist
+	riskFlagHighRiskLabel     = "high_risk_label"              // labeled high risk
+	riskFlagUnlimitedApproval = "unlimited_approval"           // approve() of the maximum amount
+	riskFlagApprovalForAll    = "approval_for_all"             // setApprovalForAll(operator, true)
+	riskFlagContractCreation  = "contract_creation"            // the transaction has no target
+)
+
+// EnrichRequest is a batch of transaction hashes and addresses, mixed
+type EnrichRequest struct {
+	Items []string `json:"items"`
+	Chain string   `json:"chain,omitempty"` // default base
+}
+
+// EnrichedItem is what /api/enrich found about one item. An item that
+// could not be enriched has Error set; the rest of the batch still is.
+type EnrichedItem struct {
+	Item  string `json:"item"`
+	Kind  string `json:"kind,omitempty"` // "transaction" or "address"
+	Error string `json:"error,omitempty"`
+
+	// Transactions
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`    // empty for contract creations
+	Value    string `json:"value,omitempty"` // wei
+	Selector string `json:"selector,omitempty"`
+	Method   string `json:"method,omitempty"` // name of Selector, where known
+
+	// The address, or the transaction's target
+	Label         *AddressLabelResult `json:"label,omitempty"`
+	KnownContract string              `json:"known_contract,omitempty"`
+
+	Flags []string `json:"flags"` // riskFlag* values
+}
+
+// EnrichResult is the response of /api/enrich, items in request order
+type EnrichResult struct {
+	Chain     string         `json:"chain"`
+	Items     []EnrichedItem `json:"items"`
+	CheckedAt int64          `json:"checked_at"`
+}
+
+// Enricher decodes, labels and risk-flags transactions and addresses in
+// bulk, fetching transactions from each chain's RPC
+type Enricher struct {
+	rpcs map[string]*RPCClient // chain ->
+}
+
+// NewEnricher fetches transactions from rpcURLs, by chain
+func NewEnricher(rpcURLs map[string]string) *Enricher {
+	e := &Enricher{rpcs: make(map[string]*RPCClient, len(rpcURLs))}
+	for chain, url := range rpcURLs {
+		e.rpcs[chain] = &RPCClient{url: url}
+	}
+	return e
+}
+
+// methodName names a 4-byte selector from the calls the scanners decode
+func methodName(selector string) (string, bool) {
+	if name, ok := knownMethods[selector]; ok {
+		return name, true
+	}
+	if layout, ok := swapLayouts[selector]; ok {
+		return layout.method, true
+	}
+	if call, ok := safeSelfCalls[selector]; ok {
+		return call.name, true
+	}
+	if selector == selectorExecTransaction {
+		return "execTransaction", true
+	}
+	return "", false
+}
+
+// Enrich looks up every item on chain. Transactions are fetched
+// concurrently; a transaction that cannot be fetched only fails its item.
+func (e *Enricher) Enrich(items []string, chain string) EnrichResult {
+	cfg := runtimeConfig.Current()
+	result := EnrichResult{Chain: chain, Items: make([]EnrichedItem, len(items)), CheckedAt: time.Now().Unix()}
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, enrichWorkers)
+	for i, item := range items {
+		item = strings.TrimSpace(item)
+		switch {
+		case txHashPattern.MatchString(item):
+			wg.Add(1)
+			go func(i int, hash string) {
+				defer wg.Done()
+				workers <- struct{}{}
+				defer func() { <-workers }()
+				result.Items[i] = e.enrichTx(cfg, chain, hash)
+			}(i, strings.ToLower(item))
+		case isValidAddress(item):
+			result.Items[i] = enrichAddress(cfg, chain, strings.ToLower(item))
+		default:
+			result.Items[i] = EnrichedItem{Item: item, Error: "not a transaction hash or address", Flags: []string{}}
+		}
+	}
+	wg.Wait()
+	return result
+}
+
+// enrichAddress labels addr and flags it
+func enrichAddress(cfg *RuntimeConfig, chain, addr string) EnrichedItem {
+	item := EnrichedItem{Item: addr, Kind: "address", Flags: []string{}}
+	item.label(cfg, chain, addr)
+	return item
+}
+
+// label sets the label and known contract of addr, and the flags they raise
+func (item *EnrichedItem) label(cfg *RuntimeConfig, chain, addr string) {
+	label := lookupAddressLabel(addr)
+	item.Label = &label
+	if name, ok := cfg.KnownContract(chain, addr); ok {
+		item.KnownContract = name
+		item.flag(riskFlagKnownContract)
+	}
+	if label.RiskLevel == "high" {
+		item.flag(riskFlagHighRiskLabel)
+	}
+	if cfg.IsBlocked(addr) {
+		item.flag(riskFlagBlocklisted)
+	}
+}
+
+func (item *EnrichedItem) flag(flag string) {
+	for _, f := range item.Flags {
+		if f == flag {
+			return
+		}
+	}
+	item.Flags = append(item.Flags, flag)
+}
+
+// rpcTransaction is the part of eth_getTransactionByHash that is decoded
+type rpcTransaction struct {
+	From  string  `json:"from"`
+	To    *string `json:"to"`
+	Value string  `json:"value"`
+	Input string  `json:"input"`
+}
+
+// enrichTx fetches hash, decodes its method and labels its target
+func (e *Enricher) enrichTx(cfg *RuntimeConfig, chain, hash string) EnrichedItem {
+	item := EnrichedItem{Item: hash, Kind: "transaction", Flags: []string{}}
+	tx, err := e.transaction(chain, hash)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	item.From = strings.ToLower(tx.From)
+	if v, err := units.ParseHex(tx.Value); err == nil {
+		item.Value = v.String()
+	}
+	if cfg.IsBlocked(item.From) {
+		item.flag(riskFlagBlocklisted)
+	}
+	if tx.To == nil {
+		item.flag(riskFlagContractCreation)
+		return item
+	}
+	item.To = strings.ToLower(*tx.To)
+	item.label(cfg, chain, item.To)
+
+	selector, args, err := decodeCalldata(tx.Input)
+	if err != nil {
+		return item
+	}
+	item.Selector = "0x" + selector
+	item.Method, _ = methodName(selector)
+	switch selector {
+	case "095ea7b3":
+		if amount, err := args.uint(1); err == nil && amount.Cmp(units.MaxUint256) == 0 {
+			item.flag(riskFlagUnlimitedApproval)
+		}
+	case "a22cb465":
+		if approved, err := args.uint(1); err == nil && approved.Sign() != 0 {
+			item.flag(riskFlagApprovalForAll)
+		}
+	}
+	return item
+}
+
+// transaction fetches hash from chain's RPC
+func (e *Enricher) transaction(chain, hash string) (*rpcTransaction, error) {
+	resp, err := e.rpcs[chain].call("eth_getTransactionByHash", []interface{}{hash})
+	if err != nil {
+		log.Printf("⚠️  Enrich: fetching %s on %s failed: %v", hash, chain, err)
+		return nil, fmt.Errorf("%s RPC unavailable", chain)
+	}
+	if resp["result"] == nil {
+		return nil, fmt.Errorf("transaction not found on %s", chain)
+	}
+	data, _ := json.Marshal(resp["result"])
+	var tx rpcTransaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return nil, fmt.Errorf("invalid transaction from RPC")
+	}
+	return &tx, nil
+}
+
+// handleEnrich serves POST /api/enrich, one paid call for a whole batch
+func (e *Enricher) handleEnrich(w http.ResponseWriter, r *http.Request) {
+	var req EnrichRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Enrich decode error (payer=%s): %v", payerLabel(r), err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Chain == "" {
+		req.Chain = "base"
+	}
+	if _, ok := e.rpcs[req.Chain]; !ok {
+		chargeFromContext(r.Context()).refuse()
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, fmt.Sprintf("unsupported chain %q, want one of %s; payment not captured", req.Chain, strings.Join(sortedKeys(e.rpcs), ", "))), http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxEnrichItems {
+		chargeFromContext(r.Context()).refuse()
+		http.Error(w, fmt.Sprintf(`{"error":"items must list 1 to %d transaction hashes or addresses, payment not captured"}`, maxEnrichItems), http.StatusBadRequest)
+		return
+	}
+	writePaidData(w, r, e.Enrich(req.Items, req.Chain))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnrich(t *testing.T) {
+	const (
+		usdc     = "0x833589fcd6edb6e08f4c7c32d4f71b54bda02913"
+		sender   = "0x00000000000000000000000000000000000000b1"
+		spender  = "0000000000000000000000000000000000000000000000000000000000000abc"
+		approve  = "0x0000000000000000000000000000000000000000000000000000000000000a01"
+		create   = "0x0000000000000000000000000000000000000000000000000000000000000a02"
+		missing  = "0x0000000000000000000000000000000000000000000000000000000000000a03"
+		maxUint  = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+		selector = "095ea7b3"
+	)
+	cfg, err := parseRuntimeConfig([]byte(`{"blocklist": ["` + sender + `"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	rpc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params []string `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var tx interface{}
+		switch req.Params[0] {
+		case approve:
+			tx = map[string]interface{}{"from": sender, "to": usdc, "value": "0x0", "input": "0x" + selector + spender + maxUint}
+		case create:
+			tx = map[string]interface{}{"from": "0x00000000000000000000000000000000000000b2", "to": nil, "value": "0xde0b6b3a7640000", "input": "0x6080"}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": tx})
+	}))
+	defer rpc.Close()
+	enricher := NewEnricher(map[string]string{"base": rpc.URL})
+
+	enrich := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		enricher.handleEnrich(rr, httptest.NewRequest("POST", "/api/enrich", strings.NewReader(body)))
+		return rr
+	}
+	for name, body := range map[string]string{
+		"no items":      `{"items": []}`,
+		"unknown chain": `{"chain": "solana", "items": ["` + usdc + `"]}`,
+		"too many":      `{"items": [` + strings.Repeat(`"`+usdc+`",`, maxEnrichItems) + `"` + usdc + `"]}`,
+	} {
+		if rr := enrich(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s returned %d, want 400", name, rr.Code)
+		}
+	}
+
+	rr := enrich(`{"items": ["` + approve + `", "` + strings.ToUpper(usdc[2:]) + `", "0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913", "` + create + `", "` + missing + `", "hello"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("enrich returned %d: %s", rr.Code, rr.Body)
+	}
+	var body struct {
+		Data EnrichResult `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	items := body.Data.Items
+	if len(items) != 6 {
+		t.Fatalf("items = %+v, want one per item in order", items)
+	}
+
+	// The approval is decoded, labeled by its target and flagged
+	tx := items[0]
+	if tx.Kind != "transaction" || tx.From != sender || tx.To != usdc || tx.Method != "approve" || tx.Selector != "0x"+selector || tx.Value != "0" {
+		t.Errorf("approval = %+v", tx)
+	}
+	if tx.Label == nil || tx.Label.Entity != "USD Coin" || tx.KnownContract == "" {
+		t.Errorf("approval target not labeled: %+v", tx)
+	}
+	if got := strings.Join(tx.Flags, ","); got != "blocklisted,recognized_protocol_contract,unlimited_approval" {
+		t.Errorf("approval flags = %s", got)
+	}
+
+	if items[1].Error == "" {
+		t.Errorf("address without 0x = %+v, want an error", items[1])
+	}
+	if addr := items[2]; addr.Kind != "address" || addr.Item != usdc || addr.Label == nil || addr.Label.Entity != "USD Coin" {
+		t.Errorf("address = %+v", addr)
+	}
+	if c := items[3]; c.To != "" || c.Value != "1000000000000000000" || strings.Join(c.Flags, ",") != "contract_creation" {
+		t.Errorf("contract creation = %+v", c)
+	}
+	if m := items[4]; m.Kind != "transaction" || !strings.Contains(m.Error, "not found") {
+		t.Errorf("missing transaction = %+v", m)
+	}
+	if bad := items[5]; bad.Error == "" || bad.Kind != "" {
+		t.Errorf("invalid item = %+v", bad)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event topics
+const (
+	EventPaymentVerified  = "payment.verified"  // a paid request was captured
+	EventPaymentSettled   = "payment.settled"   // a facilitator settled a captured payment on-chain
+	EventPaymentFinalized = "payment.finalized" // a payment's transfer reached the finality depth
+	EventPaymentReorged   = "payment.reorged"   // a reorg dropped or moved a payment's transfer
+	EventScanCompleted    = "scan.completed"    // a token or contract scan finished
+	EventUpstreamDegraded = "upstream.degraded" // a provider went down or recovered
+)
+
+// events carries side effects between modules, nil until the service starts
+var events *EventBus
+
+// Event is something that happened, delivered to every subscriber of its
+// topic. Data is the topic's payload type.
+type Event struct {
+	Topic string
+	At    time.Time
+	Data  interface{}
+}
+
+// VerifiedPayment is the payload of payment.verified: the captured
+// payment, valued and ready for the ledger
+type VerifiedPayment struct {
+	Entry LedgerEntry
+}
+
+// SettledPayment is the payload of payment.settled: the ledger entry,
+// with its settled status and transaction
+type SettledPayment struct {
+	Entry LedgerEntry
+}
+
+// FinalizedPayment is the payload of payment.finalized: the ledger entry,
+// with its final status
+type FinalizedPayment struct {
+	Entry LedgerEntry
+}
+
+// ReorgedPayment is the payload of payment.reorged. Entry has the reorged
+// status if the transfer was dropped or failed, and is unchanged if it was
+// only moved to another block.
+type ReorgedPayment struct {
+	Entry  LedgerEntry
+	Reason string
+}
+
+// ScanCompleted is the payload of scan.completed
+type ScanCompleted struct {
+	Kind    string // "token" or "contract"
+	Chain   string
+	Address string
+	Result  interface{} // TokenScanResult or *ContractScanResult
+}
+
+// UpstreamDegradation is the payload of upstream.degraded. Status is
+// UpstreamDown when the provider is marked down and UpstreamOK when it
+// recovers.
+type UpstreamDegradation struct {
+	Provider  string
+	Status    string
+	LastError string
+}
+
+// EventHandler handles one event. ctx is the publisher's, so spans started
+// from it join the publisher's trace.
+type EventHandler func(ctx context.Context, e Event) error
+
+type subscription struct {
+	name   string
+	handle EventHandler
+}
+
+// EventBus is an in-process publish/subscribe bus. It decouples the modules
+// that do things, like the paywall, from the growing list of side effects
+// that follow: metrics, the ledger, notifications and monitors. Handlers run
+// synchronously in the order they subscribed, so a publisher can act on
+// their errors; handlers with slow work, like the notifier, hand it off.
+type EventBus struct {
+	mu   sync.RWMutex
+	subs map[string][]subscription // topic -> subscribers
+
+	countMu   sync.Mutex
+	published map[string]int64 // topic -> events
+	failed    map[string]int64 // topic + "\x00" + subscriber -> errors
+}
+
+// NewEventBus creates a bus with no subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs:      make(map[string][]subscription),
+		published: make(map[string]int64),
+		failed:    make(map[string]int64),
+	}
+}
+
+// Subscribe calls handle for every event published on topic. name labels
+// the subscriber in errors and metrics.
+func (b *EventBus) Subscribe(topic, name string, handle EventHandler) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[topic] = append(b.subs[topic], subscription{name: name, handle: handle})
+}
+
+// Publish delivers data on topic to every subscriber. A failing or
+// panicking subscriber does not stop the rest; their errors are returned
+// together, each prefixed with the subscriber's name.
+func (b *EventBus) Publish(ctx context.Context, topic string, data interface{}) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.RLock()
+	subs := b.subs[topic]
+	b.mu.RUnlock()
+
+	e := Event{Topic: topic, At: time.Now().UTC(), Data: data}
+	var errs []error
+	for _, sub := range subs {
+		if err := deliver(ctx, sub, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+			b.countMu.Lock()
+			b.failed[topic+"\x00"+sub.name]++
+			b.countMu.Unlock()
+		}
+	}
+	b.countMu.Lock()
+	b.published[topic]++
+	b.countMu.Unlock()
+	return errors.Join(errs...)
+}
+
+// deliver runs one handler, turning a panic into an error
+func deliver(ctx context.Context, sub subscription, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("❌ Event handler %s panicked on %s: %v", sub.name, e.Topic, r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return sub.handle(ctx, e)
+}
+
+// WriteMetrics appends events published per topic and handler errors per
+// subscriber to the Prometheus output
+func (b *EventBus) WriteMetrics(w *strings.Builder) {
+	if b == nil {
+		return
+	}
+	b.countMu.Lock()
+	defer b.countMu.Unlock()
+
+	topics := make([]string, 0, len(b.published))
+	for topic := range b.published {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	w.WriteString("# HELP x402_events_published_total Events published on the internal bus, by topic\n")
+	w.WriteString("# TYPE x402_events_published_total counter\n")
+	for _, topic := range topics {
+		fmt.Fprintf(w, "x402_events_published_total{topic=%q} %d\n", topic, b.published[topic])
+	}
+
+	keys := make([]string, 0, len(b.failed))
+	for key := range b.failed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w.WriteString("# HELP x402_event_handler_errors_total Subscribers that failed or panicked handling an event\n")
+	w.WriteString("# TYPE x402_event_handler_errors_total counter\n")
+	for _, key := range keys {
+		topic, name, _ := strings.Cut(key, "\x00")
+		fmt.Fprintf(w, "x402_event_handler_errors_total{topic=%q,subscriber=%q} %d\n", topic, name, b.failed[key])
+	}
+}
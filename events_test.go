@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	var got []string
+	bus.Subscribe(EventScanCompleted, "first", func(_ context.Context, e Event) error {
+		got = append(got, "first:"+e.Data.(ScanCompleted).Address)
+		return nil
+	})
+	bus.Subscribe(EventScanCompleted, "failing", func(context.Context, Event) error {
+		return errors.New("disk full")
+	})
+	bus.Subscribe(EventScanCompleted, "panicking", func(_ context.Context, e Event) error {
+		var missing map[string]int
+		missing["x"]++
+		return nil
+	})
+	bus.Subscribe(EventScanCompleted, "last", func(context.Context, Event) error {
+		got = append(got, "last")
+		return nil
+	})
+	bus.Subscribe(EventPaymentVerified, "other-topic", func(context.Context, Event) error {
+		got = append(got, "other-topic")
+		return nil
+	})
+
+	err := bus.Publish(context.Background(), EventScanCompleted, ScanCompleted{Kind: "token", Address: "0xabc"})
+	if strings.Join(got, ",") != "first:0xabc,last" {
+		t.Errorf("delivered to %v, want first then last only", got)
+	}
+	if err == nil || !strings.Contains(err.Error(), "failing: disk full") || !strings.Contains(err.Error(), "panicking: panic") {
+		t.Errorf("Publish error = %v, want the failing and panicking subscribers", err)
+	}
+
+	var b strings.Builder
+	bus.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_events_published_total{topic="scan.completed"} 1`,
+		`x402_event_handler_errors_total{topic="scan.completed",subscriber="failing"} 1`,
+		`x402_event_handler_errors_total{topic="scan.completed",subscriber="panicking"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+
+	var unset *EventBus
+	unset.Subscribe(EventScanCompleted, "noop", nil)
+	if err := unset.Publish(context.Background(), EventScanCompleted, nil); err != nil {
+		t.Errorf("nil bus Publish = %v", err)
+	}
+}
+
+func TestUpstreamDegradedEvents(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	previous := events
+	events = NewEventBus()
+	t.Cleanup(func() { events = previous })
+	var got []UpstreamDegradation
+	events.Subscribe(EventUpstreamDegraded, "test", func(_ context.Context, e Event) error {
+		got = append(got, e.Data.(UpstreamDegradation))
+		return nil
+	})
+
+	client := &http.Client{Transport: NewUpstreamLimiter(http.DefaultTransport, 1, time.Second)}
+	get := func() {
+		t.Helper()
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	failing.Store(true)
+	for range upstreamDownAfter + 2 {
+		get()
+	}
+	failing.Store(false)
+	get()
+	get()
+
+	if len(got) != 2 || got[0].Status != UpstreamDown || got[0].LastError != "status 502" || got[1].Status != UpstreamOK {
+		t.Errorf("events = %+v, want one down then one recovery", got)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// SchemeExact is the official x402 scheme: the client sends, in X-PAYMENT,
+// an EIP-3009 transferWithAuthorization of the payment signed by the payer
+const SchemeExact = "exact"
+
+// exactMaxValidity is the longest an authorization may stay valid. Spent
+// authorizations are remembered until they expire.
+const exactMaxValidity = time.Hour
+
+// authorizationKeyPrefix marks authorizations that have paid for a request
+// in the shared state store
+const authorizationKeyPrefix = "x402:authorization:"
+
+// transferAuthorizationTypeHash is keccak256 of the EIP-3009 message type
+var transferAuthorizationTypeHash = ethsig.Keccak256([]byte("TransferWithAuthorization(address from,address to,uint256 value,uint256 validAfter,uint256 validBefore,bytes32 nonce)"))
+
+// exactDomains are the EIP-712 domains of the contracts exact payments can
+// be authorized on, by "network:asset"
+var exactDomains = map[string]ethsig.Domain{
+	"base:USDC":         {Name: "USD Coin", Version: "2", ChainID: 8453, VerifyingContract: payoutTokens["base:USDC"]},
+	"base-sepolia:USDC": {Name: "USDC", Version: "2", ChainID: 84532, VerifyingContract: payoutTokens["base-sepolia:USDC"]},
+	"ethereum:USDC":     {Name: "USD Coin", Version: "2", ChainID: 1, VerifyingContract: payoutTokens["ethereum:USDC"]},
+	"polygon:USDC":      {Name: "USD Coin", Version: "2", ChainID: 137, VerifyingContract: payoutTokens["polygon:USDC"]},
+}
+
+var bytes32Pattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// exactSupported reports whether exact payments are accepted: the
+// exact_scheme flag is on and one of assets can be authorized on network
+func exactSupported(network string, assets []string) bool {
+	if !featureFlags.Enabled(FlagExactScheme) {
+		return false
+	}
+	for _, asset := range assets {
+		if _, ok := exactDomains[network+":"+asset]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// exactRequirement turns req into its exact scheme equivalent, if exact
+// payments are accepted in its asset on its network
+func exactRequirement(req PaymentRequirement) (PaymentRequirement, bool) {
+	if !exactSupported(req.Network, []string{req.Asset}) {
+		return req, false
+	}
+	domain := exactDomains[req.Network+":"+req.Asset]
+	value, ok := new(big.Rat).SetString(req.MaxAmount)
+	if !ok {
+		return req, false
+	}
+	value.Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(paymentAssets[req.Asset].decimals)), nil)))
+	if !value.IsInt() {
+		return req, false
+	}
+	req.Scheme = SchemeExact
+	req.MaxAmountRequired = value.Num().String()
+	req.Extra = &types.SchemeExtra{
+		Name:              domain.Name,
+		Version:           domain.Version,
+		ChainID:           domain.ChainID,
+		VerifyingContract: domain.VerifyingContract,
+	}
+	return req, true
+}
+
+// authorizationHash is the EIP-712 digest the payer signs for auth
+func authorizationHash(domain ethsig.Domain, auth types.TransferAuthorization, value *big.Int, validAfter, validBefore int64) ([]byte, error) {
+	separator, err := domain.Separator()
+	if err != nil {
+		return nil, err
+	}
+	from, err1 := ethsig.Word(auth.From)
+	to, err2 := ethsig.Word(auth.To)
+	nonce, err3 := ethsig.Word(auth.Nonce)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, err
+	}
+	message := ethsig.Keccak256(transferAuthorizationTypeHash, from, to, ethsig.Uint(value),
+		ethsig.Uint(big.NewInt(validAfter)), ethsig.Uint(big.NewInt(validBefore)), nonce)
+	return ethsig.TypedDataHash(separator, message), nil
+}
+
+// exactChallengeNonce returns the challenge nonce an authorization nonce
+// carries: with challenge nonces on, clients use the challenge's nonce,
+// zero-padded on the left to 32 bytes, as the authorization nonce
+func exactChallengeNonce(nonce string) string {
+	digits := strings.ToLower(strings.TrimPrefix(nonce, "0x"))
+	if len(digits) != 64 || strings.TrimLeft(digits[:32], "0") != "" {
+		return ""
+	}
+	return digits[32:]
+}
+
+// checkExactPayment decodes an X-PAYMENT header and runs the checks that
+// depend only on it: the quoted amount range and receiver, the
+// authorization's validity window, and that it is signed by its from
+// address. The authorization is returned as claims too, so the rest of the
+// paywall checks it like a token; claims is nil only if the header could
+// not be parsed.
+func checkExactPayment(header, minAmount, maxAmount, expectedAsset, expectedReceiver string, now time.Time) (*PaymentToken, *ExactPayload, []CheckFailure) {
+	var payment ExactPayment
+	data, err := base64.StdEncoding.DecodeString(header)
+	if err == nil {
+		err = json.Unmarshal(data, &payment)
+	}
+	if err != nil {
+		return nil, nil, []CheckFailure{{CheckFormat, "X-PAYMENT is not base64-encoded JSON: " + err.Error()}}
+	}
+	if payment.Scheme != SchemeExact {
+		return nil, nil, []CheckFailure{{CheckFormat, fmt.Sprintf("got scheme %q, want %s", payment.Scheme, SchemeExact)}}
+	}
+	auth := payment.Payload.Authorization
+	value, err := units.ParseWei(auth.Value)
+	validAfter, err1 := strconv.ParseInt(auth.ValidAfter, 10, 64)
+	validBefore, err2 := strconv.ParseInt(auth.ValidBefore, 10, 64)
+	if err != nil || err1 != nil || err2 != nil || !address.IsHex(auth.From) || !address.IsHex(auth.To) || !bytes32Pattern.MatchString(auth.Nonce) {
+		return nil, nil, []CheckFailure{{CheckFormat, "authorization needs from and to addresses, decimal value, validAfter and validBefore, and a bytes32 nonce"}}
+	}
+
+	claims := &PaymentToken{Payment: PaymentClaims{
+		Amount:   units.Format(value, paymentAssets[expectedAsset].decimals),
+		Asset:    expectedAsset,
+		Receiver: auth.To,
+		Network:  payment.Network,
+		Nonce:    exactChallengeNonce(auth.Nonce),
+	}}
+	claims.Subject = strings.ToLower(auth.From)
+	domain, ok := exactDomains[payment.Network+":"+expectedAsset]
+	if !ok {
+		return claims, nil, []CheckFailure{{CheckNetwork, fmt.Sprintf("exact payments in %s on %q are not supported", expectedAsset, payment.Network)}}
+	}
+
+	var failed []CheckFailure
+	fail := func(check, format string, args ...interface{}) {
+		failed = append(failed, CheckFailure{check, fmt.Sprintf(format, args...)})
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(payment.Payload.Signature, "0x"))
+	if err != nil {
+		fail(CheckSignature, "signature must be hex")
+	} else if hash, err := authorizationHash(domain, auth, value, validAfter, validBefore); err != nil {
+		fail(CheckSignature, "%v", err)
+	} else if signer, err := ethsig.Recover(hash, sig); err != nil || signer != claims.Subject {
+		fail(CheckSignature, "authorization is not signed by %s", claims.Subject)
+	}
+	switch {
+	case now.Unix() >= validBefore:
+		fail(CheckExpiry, "authorization expired at %s", time.Unix(validBefore, 0).UTC().Format(time.RFC3339))
+	case time.Unix(validBefore, 0).Sub(now) > exactMaxValidity:
+		fail(CheckLifetime, "authorization valid until %s, at most %s ahead is accepted", time.Unix(validBefore, 0).UTC().Format(time.RFC3339), exactMaxValidity)
+	}
+	if now.Unix() <= validAfter {
+		fail(CheckNotBefore, "authorization not valid before %s", time.Unix(validAfter, 0).UTC().Format(time.RFC3339))
+	}
+	failed = append(failed, checkQuoted(claims.Payment, minAmount, maxAmount, expectedAsset, expectedReceiver)...)
+	return claims, &payment.Payload, failed
+}
+
+// claimAuthorization spends auth, failing if it paid for another request
+// first. It is remembered until it expires, when the asset contract would
+// refuse it anyway.
+func claimAuthorization(auth *ExactPayload, now time.Time) (*paymentClaim, error) {
+	validBefore, _ := strconv.ParseInt(auth.Authorization.ValidBefore, 10, 64)
+	key := authorizationKeyPrefix + strings.ToLower(auth.Authorization.From) + ":" + strings.ToLower(auth.Authorization.Nonce)
+	return claimPayment(key, replayAuthorization, time.Unix(validBefore, 0).Sub(now)+time.Minute)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// signExactPayment returns the X-PAYMENT header of auth, signed with key
+// for base USDC
+func signExactPayment(t *testing.T, auth types.TransferAuthorization, key *big.Int) string {
+	t.Helper()
+	value, _ := new(big.Int).SetString(auth.Value, 10)
+	validAfter, _ := strconv.ParseInt(auth.ValidAfter, 10, 64)
+	validBefore, _ := strconv.ParseInt(auth.ValidBefore, 10, 64)
+	hash, err := authorizationHash(exactDomains["base:USDC"], auth, value, validAfter, validBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := ethsig.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(ExactPayment{
+		X402Version: 1,
+		Scheme:      SchemeExact,
+		Network:     "base",
+		Payload:     ExactPayload{Signature: "0x" + hex.EncodeToString(sig), Authorization: auth},
+	})
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func randomNonce() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "0x" + hex.EncodeToString(b)
+}
+
+func TestCheckExactPayment(t *testing.T) {
+	wallet, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	receiver := "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"
+	valid := func() types.TransferAuthorization {
+		return types.TransferAuthorization{
+			From:        ethsig.Address(wallet),
+			To:          receiver,
+			Value:       "1000",
+			ValidAfter:  strconv.FormatInt(epoch.Add(-time.Minute).Unix(), 10),
+			ValidBefore: strconv.FormatInt(epoch.Add(5*time.Minute).Unix(), 10),
+			Nonce:       randomNonce(),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		edit   func(*types.TransferAuthorization)
+		key    *big.Int
+		failed []string
+	}{
+		{"valid", func(*types.TransferAuthorization) {}, wallet, nil},
+		{"other signer", func(*types.TransferAuthorization) {}, big.NewInt(1), []string{CheckSignature}},
+		{"expired", func(a *types.TransferAuthorization) { a.ValidBefore = strconv.FormatInt(epoch.Unix(), 10) }, wallet, []string{CheckExpiry}},
+		{"valid too long", func(a *types.TransferAuthorization) {
+			a.ValidBefore = strconv.FormatInt(epoch.Add(2*time.Hour).Unix(), 10)
+		}, wallet, []string{CheckLifetime}},
+		{"not yet valid", func(a *types.TransferAuthorization) {
+			a.ValidAfter = strconv.FormatInt(epoch.Add(time.Minute).Unix(), 10)
+		}, wallet, []string{CheckNotBefore}},
+		{"underpaid", func(a *types.TransferAuthorization) { a.Value = "999" }, wallet, []string{CheckAmount}},
+		{"other receiver", func(a *types.TransferAuthorization) { a.To = "0x0000000000000000000000000000000000000001" }, wallet, []string{CheckReceiver}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := valid()
+			tt.edit(&auth)
+			claims, payload, failed := checkExactPayment(signExactPayment(t, auth, tt.key), "0.001", "0.001", "USDC", receiver, epoch)
+			var got []string
+			for _, f := range failed {
+				got = append(got, f.Check)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.failed, ",") {
+				t.Errorf("failed = %v, want %v", failed, tt.failed)
+			}
+			if claims == nil || payload == nil {
+				t.Fatal("signed authorization returned no claims")
+			}
+			if claims.Subject != ethsig.Address(wallet) || claims.Payment.Network != "base" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+
+	for _, header := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte(`{"scheme":"upto"}`))} {
+		if claims, _, failed := checkExactPayment(header, "0.001", "0.001", "USDC", receiver, epoch); claims != nil || len(failed) != 1 || failed[0].Check != CheckFormat {
+			t.Errorf("%q: failed = %v, want format", header, failed)
+		}
+	}
+}
+
+func TestExactRequirement(t *testing.T) {
+	if _, ok := exactRequirement(PaymentRequirement{Network: "base", Asset: "USDC", MaxAmount: "0.001"}); ok {
+		t.Error("exact requirement offered with exact_scheme off")
+	}
+	featureFlags.ParseEnv("exact_scheme")
+	t.Cleanup(func() { featureFlags.ParseEnv("") })
+
+	req, ok := exactRequirement(PaymentRequirement{Scheme: "x402", Network: "base", Asset: "USDC", MaxAmount: "0.001", MinAmount: "0.001"})
+	if !ok || req.Scheme != SchemeExact || req.MaxAmountRequired != "1000" {
+		t.Fatalf("requirement = %+v", req)
+	}
+	if req.Extra == nil || req.Extra.ChainID != 8453 || req.Extra.VerifyingContract != payoutTokens["base:USDC"] {
+		t.Errorf("extra = %+v", req.Extra)
+	}
+	if _, ok := exactRequirement(PaymentRequirement{Network: "optimism", Asset: "USDC", MaxAmount: "0.001"}); ok {
+		t.Error("exact requirement offered on a network without a domain")
+	}
+}
+
+func TestPaywallExactPayment(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	paywall.SetClock(fake)
+	var got Payer
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PayerFromContext(r.Context())
+	})
+
+	wallet, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	header := signExactPayment(t, types.TransferAuthorization{
+		From:        ethsig.Address(wallet),
+		To:          config.Receiver,
+		Value:       "1000",
+		ValidAfter:  "0",
+		ValidBefore: strconv.FormatInt(fake.Now().Add(10*time.Minute).Unix(), 10),
+		Nonce:       randomNonce(),
+	}, wallet)
+
+	pay := func() int {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment", header)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := pay(); code != http.StatusPaymentRequired {
+		t.Fatalf("exact payment with exact_scheme off returned %d, want 402", code)
+	}
+	featureFlags.ParseEnv("exact_scheme")
+	t.Cleanup(func() { featureFlags.ParseEnv("") })
+	if code := pay(); code != http.StatusOK {
+		t.Fatalf("exact payment returned %d", code)
+	}
+	if got.Address != ethsig.Address(wallet) || got.Source != "signer" {
+		t.Errorf("payer = %+v, want the authorization's signer", got)
+	}
+	entries := ledger.Entries(DefaultTenant)
+	if len(entries) != 1 || entries[0].Authorization == nil || entries[0].TxHash != "" {
+		t.Errorf("ledger = %+v, want the authorization recorded", entries)
+	}
+
+	// An authorization pays for one request only
+	if code := pay(); code != http.StatusPaymentRequired {
+		t.Errorf("replayed authorization returned %d, want 402", code)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PriceExperiment splits an endpoint's traffic between price variants, to
+// find the price that earns the most
+type PriceExperiment struct {
+	Name     string         `json:"name"`
+	Endpoint string         `json:"endpoint"`
+	Variants []PriceVariant `json:"variants"`
+}
+
+// PriceVariant is one price in an experiment, quoted to Weight parts of
+// the traffic
+type PriceVariant struct {
+	Name   string `json:"name"`
+	Price  string `json:"price"`
+	Weight int    `json:"weight"`
+}
+
+func (e *PriceExperiment) validate() error {
+	if e.Name == "" || strings.ContainsAny(e.Name, "/ ") {
+		return fmt.Errorf("invalid price experiment name %q", e.Name)
+	}
+	if !strings.HasPrefix(e.Endpoint, "/") {
+		return fmt.Errorf("price experiment %s: endpoint %q must start with /", e.Name, e.Endpoint)
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("price experiment %s needs at least two variants", e.Name)
+	}
+	names := make(map[string]bool, len(e.Variants))
+	for _, v := range e.Variants {
+		if v.Name == "" || names[v.Name] {
+			return fmt.Errorf("price experiment %s: missing or duplicate variant name %q", e.Name, v.Name)
+		}
+		names[v.Name] = true
+		if err := validatePrice(v.Price); err != nil {
+			return fmt.Errorf("price experiment %s variant %s: %w", e.Name, v.Name, err)
+		}
+		if v.Weight < 1 {
+			return fmt.Errorf("price experiment %s variant %s: weight must be positive", e.Name, v.Name)
+		}
+	}
+	return nil
+}
+
+// assign picks the variant quoted to client. A client always gets the same
+// variant, on every replica, so its payment is checked against the price
+// it was challenged with.
+func (e *PriceExperiment) assign(client string) PriceVariant {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	h := sha256.Sum256([]byte(e.Name + "\x00" + client))
+	n := int(binary.BigEndian.Uint64(h[:8]) % uint64(total))
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// PriceExperiment returns the price experiment running on endpoint, if any
+func (c *RuntimeConfig) PriceExperiment(endpoint string) (*PriceExperiment, bool) {
+	for i := range c.Experiments {
+		if c.Experiments[i].Endpoint == endpoint {
+			return &c.Experiments[i], true
+		}
+	}
+	return nil, false
+}
+
+const clientContextKey contextKey = "x402.client"
+
+// withClient attaches the address a request came from, which price
+// experiments assign variants by
+func withClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientContextKey, client)
+}
+
+func clientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(clientContextKey).(string)
+	return client
+}
+
+// VariantStats is how one price variant has done since startup
+type VariantStats struct {
+	Experiment string  `json:"experiment"`
+	Variant    string  `json:"variant"`
+	Price      string  `json:"price,omitempty"` // as configured now
+	Challenges int64   `json:"challenges"`      // 402s quoting the variant
+	Payments   int64   `json:"payments"`
+	RevenueUSD float64 `json:"revenue_usd"`
+	Conversion float64 `json:"conversion"` // payments per challenge
+	// RevenuePerChallenge is the figure the best price maximizes
+	RevenuePerChallenge float64 `json:"revenue_per_challenge"`
+}
+
+// Experiments counts the challenges and payments of each price variant
+type Experiments struct {
+	mu    sync.Mutex
+	stats map[string]*VariantStats // "experiment/variant" ->
+}
+
+// NewExperiments starts counting with no challenges
+func NewExperiments() *Experiments {
+	return &Experiments{stats: make(map[string]*VariantStats)}
+}
+
+func (e *Experiments) variant(experiment, variant string) *VariantStats {
+	key := experiment + "/" + variant
+	s, ok := e.stats[key]
+	if !ok {
+		s = &VariantStats{Experiment: experiment, Variant: variant}
+		e.stats[key] = s
+	}
+	return s
+}
+
+// Challenged counts a 402 quoting variant. A nil tracker counts nothing.
+func (e *Experiments) Challenged(experiment, variant string) {
+	if e == nil || experiment == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.variant(experiment, variant).Challenges++
+}
+
+// onPaymentVerified counts a captured payment towards its variant
+func (e *Experiments) onPaymentVerified(_ context.Context, ev Event) error {
+	entry := ev.Data.(VerifiedPayment).Entry
+	if entry.Experiment == "" {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.variant(entry.Experiment, entry.Variant)
+	s.Payments++
+	s.RevenueUSD += entry.AmountUSD
+	return nil
+}
+
+// Stats returns every variant's figures, by experiment and variant, with
+// the variants of experiments configured now listed even before traffic
+func (e *Experiments) Stats(cfg *RuntimeConfig) []VariantStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, exp := range cfg.Experiments {
+		for _, v := range exp.Variants {
+			e.variant(exp.Name, v.Name)
+		}
+	}
+	out := make([]VariantStats, 0, len(e.stats))
+	for _, s := range e.stats {
+		v := *s
+		v.RevenueUSD = round(v.RevenueUSD, 6)
+		if v.Challenges > 0 {
+			v.Conversion = round(float64(v.Payments)/float64(v.Challenges), 4)
+			v.RevenuePerChallenge = round(s.RevenueUSD/float64(v.Challenges), 6)
+		}
+		if exp, ok := cfg.experimentNamed(v.Experiment); ok {
+			for _, variant := range exp.Variants {
+				if variant.Name == v.Variant {
+					v.Price = variant.Price
+				}
+			}
+		}
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Experiment != out[j].Experiment {
+			return out[i].Experiment < out[j].Experiment
+		}
+		return out[i].Variant < out[j].Variant
+	})
+	return out
+}
+
+func (c *RuntimeConfig) experimentNamed(name string) (*PriceExperiment, bool) {
+	for i := range c.Experiments {
+		if c.Experiments[i].Name == name {
+			return &c.Experiments[i], true
+		}
+	}
+	return nil, false
+}
+
+// handleAdminExperiments serves GET /admin/experiments, each variant's
+// conversion and revenue per challenge
+func (e *Experiments) handleAdminExperiments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"variants": e.Stats(runtimeConfig.Current()),
+	})
+}
+
+// WriteMetrics emits the challenges, payments and revenue of each variant
+func (e *Experiments) WriteMetrics(b *strings.Builder) {
+	stats := e.Stats(runtimeConfig.Current())
+	b.WriteString("# HELP x402_price_experiment_challenges_total 402 challenges quoting a price variant\n")
+	b.WriteString("# TYPE x402_price_experiment_challenges_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(b, "x402_price_experiment_challenges_total{experiment=%q,variant=%q} %d\n", s.Experiment, s.Variant, s.Challenges)
+	}
+	b.WriteString("# HELP x402_price_experiment_payments_total Payments captured at a price variant\n")
+	b.WriteString("# TYPE x402_price_experiment_payments_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(b, "x402_price_experiment_payments_total{experiment=%q,variant=%q} %d\n", s.Experiment, s.Variant, s.Payments)
+	}
+	b.WriteString("# HELP x402_price_experiment_revenue_usd_total Revenue captured at a price variant, in USD\n")
+	b.WriteString("# TYPE x402_price_experiment_revenue_usd_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(b, "x402_price_experiment_revenue_usd_total{experiment=%q,variant=%q} %g\n", s.Experiment, s.Variant, s.RevenueUSD)
+	}
+	b.WriteString("# HELP x402_price_experiment_conversion Payments per 402 challenge of a price variant\n")
+	b.WriteString("# TYPE x402_price_experiment_conversion gauge\n")
+	for _, s := range stats {
+		fmt.Fprintf(b, "x402_price_experiment_conversion{experiment=%q,variant=%q} %g\n", s.Experiment, s.Variant, s.Conversion)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const gasExperiment = `{"price_experiments": [{"name": "gas-q3", "endpoint": "/api/gas", "variants": [
+	{"name": "control", "price": "0.001", "weight": 3},
+	{"name": "cheap", "price": "0.0005", "weight": 1}
+]}]}`
+
+func TestParsePriceExperiments(t *testing.T) {
+	for name, raw := range map[string]string{
+		"one variant":       `{"price_experiments": [{"name": "a", "endpoint": "/api/gas", "variants": [{"name": "x", "price": "0.001", "weight": 1}]}]}`,
+		"no weight":         `{"price_experiments": [{"name": "a", "endpoint": "/api/gas", "variants": [{"name": "x", "price": "0.001"}, {"name": "y", "price": "0.002", "weight": 1}]}]}`,
+		"invalid price":     `{"price_experiments": [{"name": "a", "endpoint": "/api/gas", "variants": [{"name": "x", "price": "free", "weight": 1}, {"name": "y", "price": "0.002", "weight": 1}]}]}`,
+		"duplicate variant": `{"price_experiments": [{"name": "a", "endpoint": "/api/gas", "variants": [{"name": "x", "price": "0.001", "weight": 1}, {"name": "x", "price": "0.002", "weight": 1}]}]}`,
+		"relative endpoint": `{"price_experiments": [{"name": "a", "endpoint": "api/gas", "variants": [{"name": "x", "price": "0.001", "weight": 1}, {"name": "y", "price": "0.002", "weight": 1}]}]}`,
+		"same endpoint": `{"price_experiments": [
+			{"name": "a", "endpoint": "/api/gas", "variants": [{"name": "x", "price": "0.001", "weight": 1}, {"name": "y", "price": "0.002", "weight": 1}]},
+			{"name": "b", "endpoint": "/api/gas", "variants": [{"name": "x", "price": "0.001", "weight": 1}, {"name": "y", "price": "0.002", "weight": 1}]}
+		]}`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(raw)); err == nil {
+			t.Errorf("%s: config accepted", name)
+		}
+	}
+	cfg, err := parseRuntimeConfig([]byte(gasExperiment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.PriceExperiment("/api/gas"); !ok {
+		t.Error("experiment on /api/gas not found")
+	}
+	if _, ok := cfg.PriceExperiment("/api/price"); ok {
+		t.Error("experiment found on /api/price")
+	}
+}
+
+func TestPriceExperimentAssign(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(gasExperiment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, _ := cfg.PriceExperiment("/api/gas")
+	control := 0
+	for i := 0; i < 1000; i++ {
+		client := fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		v := exp.assign(client)
+		if exp.assign(client) != v {
+			t.Fatalf("%s assigned two variants", client)
+		}
+		if v.Name == "control" {
+			control++
+		}
+	}
+	// Three parts in four, give or take
+	if control < 680 || control > 820 {
+		t.Errorf("control got %d of 1000 clients, want about 750", control)
+	}
+}
+
+func TestPaywallPriceExperiment(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(gasExperiment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+	exp, _ := cfg.PriceExperiment("/api/gas")
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	experiments := NewExperiments()
+	paywall.SetExperiments(experiments)
+	paywall.events.Subscribe(EventPaymentVerified, "experiments", experiments.onPaymentVerified)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+	call := func(client, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.RemoteAddr = client + ":4242"
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	pay := func(amount string) string {
+		claims := PaymentToken{}
+		claims.Payment.Amount = amount
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Network = "base"
+		claims.Payment.Receiver = config.Receiver
+		return signPayment(t, claims)
+	}
+
+	// One client in each variant
+	clients := make(map[string]string)
+	for i := 1; len(clients) < 2; i++ {
+		client := fmt.Sprintf("10.0.0.%d", i)
+		if v := exp.assign(client); clients[v.Name] == "" {
+			clients[v.Name] = client
+		}
+	}
+
+	// Each client is challenged with its variant's price
+	for variant, price := range map[string]string{"control": "0.001", "cheap": "0.0005"} {
+		var body struct {
+			Payment PaymentRequirement `json:"payment"`
+		}
+		if err := json.NewDecoder(call(clients[variant], "").Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Payment.MaxAmount != price {
+			t.Errorf("%s challenged for %s, want %s", variant, body.Payment.MaxAmount, price)
+		}
+	}
+	call(clients["cheap"], "")
+
+	// The cheap variant's price is enough for its clients only
+	if rr := call(clients["control"], pay("0.0005")); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("control client paying the cheap price returned %d, want 402", rr.Code)
+	}
+	if rr := call(clients["cheap"], pay("0.0005")); rr.Code != http.StatusOK {
+		t.Fatalf("cheap client payment returned %d: %s", rr.Code, rr.Body)
+	}
+	entries := ledger.Entries(DefaultTenant)
+	if len(entries) != 1 || entries[0].Experiment != "gas-q3" || entries[0].Variant != "cheap" {
+		t.Fatalf("ledger = %+v, want the payment tagged with its variant", entries)
+	}
+
+	stats := experiments.Stats(cfg)
+	if len(stats) != 2 {
+		t.Fatalf("stats = %+v, want both variants", stats)
+	}
+	cheap, control := stats[0], stats[1]
+	if cheap.Challenges != 2 || cheap.Payments != 1 || cheap.Conversion != 0.5 || cheap.RevenueUSD != 0.0005 || cheap.RevenuePerChallenge != 0.00025 || cheap.Price != "0.0005" {
+		t.Errorf("cheap = %+v", cheap)
+	}
+	if control.Challenges != 1 || control.Payments != 0 || control.Conversion != 0 {
+		t.Errorf("control = %+v", control)
+	}
+
+	var b strings.Builder
+	experiments.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_price_experiment_challenges_total{experiment="gas-q3",variant="cheap"} 2`,
+		`x402_price_experiment_payments_total{experiment="gas-q3",variant="cheap"} 1`,
+		`x402_price_experiment_revenue_usd_total{experiment="gas-q3",variant="cheap"} 0.0005`,
+		`x402_price_experiment_conversion{experiment="gas-q3",variant="control"} 0`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// Explorer cache outcomes, the result label of x402_explorer_cache_total
+const (
+	explorerHit         = "hit"
+	explorerNegativeHit = "negative_hit" // a cached "not verified" or "no data"
+	explorerMiss        = "miss"
+	explorerShared      = "shared" // waited for another caller's fetch of the same key
+)
+
+// ExplorerCache caches explorer contract lookups (ABIs, source code and
+// creation records), which token scans, contract scans and pre-flight
+// checks repeat for the same addresses. Answers that a contract is not
+// verified or has no record are cached too, for a shorter time, so
+// unverified contracts are not re-queried on every scan. Errors such as
+// rate limits are never cached. Concurrent misses for one key share a
+// single fetch.
+type ExplorerCache struct {
+	client      *http.Client
+	ttl         time.Duration
+	negativeTTL time.Duration
+	clock       clock.Clock
+
+	mu       sync.Mutex
+	entries  map[string]explorerEntry
+	inflight map[string]*explorerFetch
+	counts   map[string]int64 // outcome -> lookups
+}
+
+type explorerEntry struct {
+	body     []byte
+	negative bool
+	expires  time.Time
+}
+
+// explorerFetch is a fetch in progress that other callers wait on
+type explorerFetch struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+// NewExplorerCache caches answers for ttl and negative answers for
+// negativeTTL
+func NewExplorerCache(client *http.Client, ttl, negativeTTL time.Duration) *ExplorerCache {
+	return &ExplorerCache{
+		client:      client,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		clock:       clock.System,
+		entries:     make(map[string]explorerEntry),
+		inflight:    make(map[string]*explorerFetch),
+		counts:      make(map[string]int64),
+	}
+}
+
+// explorerCache is shared by every explorer contract lookup. newService
+// replaces it with one using the configured TTLs.
+var explorerCache = NewExplorerCache(upstreamHTTP, time.Hour, 10*time.Minute)
+
+// explorerKey identifies a lookup by its URL without the API key, so the
+// same answer is shared whichever key fetched it
+func explorerKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	q.Del("apikey")
+	for k, v := range q {
+		if k == "address" || k == "contractaddresses" {
+			q[k] = []string{strings.ToLower(strings.Join(v, ","))}
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// classifyExplorer reports whether an explorer answer can be cached and
+// whether it is negative: the contract is not verified or the explorer has
+// no data for it. Anything else with status "0", such as a rate limit or a
+// bad API key, is an error and not cached.
+func classifyExplorer(body []byte) (cacheable, negative bool) {
+	var result struct {
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if json.Unmarshal(body, &result) != nil {
+		return false, false
+	}
+	notVerified := strings.Contains(string(result.Result), "not verified")
+	switch result.Status {
+	case "1":
+		return true, notVerified
+	case "0":
+		return notVerified || strings.EqualFold(result.Message, "No data found"), true
+	}
+	return false, false
+}
+
+// Get returns the body of the explorer answer at rawURL, from the cache if
+// it holds one
+func (c *ExplorerCache) Get(rawURL string) ([]byte, error) {
+	key := explorerKey(rawURL)
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && c.clock.Now().Before(e.expires) {
+		if e.negative {
+			c.counts[explorerNegativeHit]++
+		} else {
+			c.counts[explorerHit]++
+		}
+		c.mu.Unlock()
+		return e.body, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.counts[explorerShared]++
+		c.mu.Unlock()
+		<-call.done
+		return call.body, call.err
+	}
+	call := &explorerFetch{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.counts[explorerMiss]++
+	c.mu.Unlock()
+
+	call.body, call.err = c.fetch(rawURL)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if call.err == nil {
+		if cacheable, negative := classifyExplorer(call.body); cacheable {
+			ttl := c.ttl
+			if negative {
+				ttl = c.negativeTTL
+			}
+			c.entries[key] = explorerEntry{body: call.body, negative: negative, expires: c.clock.Now().Add(ttl)}
+		}
+	}
+	c.evictExpired()
+	c.mu.Unlock()
+	close(call.done)
+	return call.body, call.err
+}
+
+func (c *ExplorerCache) fetch(rawURL string) ([]byte, error) {
+	resp, err := c.client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("explorer returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+}
+
+// evictExpired drops expired entries. Call it with c.mu held.
+func (c *ExplorerCache) evictExpired() {
+	now := c.clock.Now()
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// WriteMetrics writes the x402_explorer_cache_total counter
+func (c *ExplorerCache) WriteMetrics(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	outcomes := make([]string, 0, len(c.counts))
+	for outcome := range c.counts {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Strings(outcomes)
+	b.WriteString("# HELP x402_explorer_cache_total Explorer contract lookups by cache outcome\n")
+	b.WriteString("# TYPE x402_explorer_cache_total counter\n")
+	for _, outcome := range outcomes {
+		fmt.Fprintf(b, "x402_explorer_cache_total{result=%q} %d\n", outcome, c.counts[outcome])
+	}
+	b.WriteString("# HELP x402_explorer_cache_entries Explorer answers currently cached\n")
+	b.WriteString("# TYPE x402_explorer_cache_entries gauge\n")
+	fmt.Fprintf(b, "x402_explorer_cache_entries %d\n", len(c.entries))
+}
+
+// errNotVerified is returned for contracts whose source the explorer has
+// not verified
+var errNotVerified = errors.New("contract source code not verified")
+
+// contractSource is a contract's entry in the explorer's verified sources
+type contractSource struct {
+	Name     string
+	Verified bool
+	Proxy    bool // the explorer recognized it as a proxy
+}
+
+// etherscanExplorer is the Etherscan-compatible API of each chain's
+// explorer. Contract lookups go through explorerCache; account history and
+// eth_call results change with every block and are always fetched.
+type etherscanExplorer struct{}
+
+// ContractABI implements ExplorerProvider
+func (etherscanExplorer) ContractABI(addr string, chain ChainConfig) (string, error) {
+	url := fmt.Sprintf("%s?module=contract&action=getabi&address=%s&apikey=%s", chain.ExplorerAPI, addr, chain.APIKey())
+	body, err := explorerCache.Get(url)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Result  string `json:"result"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	if result.Status != "1" {
+		if strings.Contains(result.Result, "not verified") {
+			return "", errNotVerified
+		}
+		return "", fmt.Errorf("API error: %s", result.Message)
+	}
+	return result.Result, nil
+}
+
+// ContractSource implements ExplorerProvider
+func (etherscanExplorer) ContractSource(addr string, chain ChainConfig) (*contractSource, error) {
+	url := fmt.Sprintf("%s?module=contract&action=getsourcecode&address=%s&apikey=%s", chain.ExplorerAPI, addr, chain.APIKey())
+	body, err := explorerCache.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Status string `json:"status"`
+		Result []struct {
+			ContractName string `json:"ContractName"`
+			ABI          string `json:"ABI"`
+			Proxy        string `json:"Proxy"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.Status != "1" || len(result.Result) == 0 {
+		return nil, fmt.Errorf("no source information")
+	}
+	source := result.Result[0]
+	return &contractSource{
+		Name:     source.ContractName,
+		Verified: !strings.Contains(source.ABI, "not verified"),
+		Proxy:    source.Proxy == "1",
+	}, nil
+}
+
+// ContractCreation implements ExplorerProvider. It reports who deployed a
+// contract, in which transaction and when.
+func (etherscanExplorer) ContractCreation(addr string, chain ChainConfig) (*contractCreation, error) {
+	url := fmt.Sprintf("%s?module=contract&action=getcontractcreation&contractaddresses=%s&apikey=%s", chain.ExplorerAPI, addr, chain.APIKey())
+	body, err := explorerCache.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Status string `json:"status"`
+		Result []struct {
+			Creator   string `json:"contractCreator"`
+			TxHash    string `json:"txHash"`
+			Timestamp string `json:"timestamp"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.Status != "1" || len(result.Result) == 0 {
+		return nil, fmt.Errorf("no creation record")
+	}
+	record := result.Result[0]
+	creation := &contractCreation{Creator: strings.ToLower(record.Creator), TxHash: record.TxHash}
+	if record.Timestamp != "" {
+		ts, err := strconv.ParseInt(record.Timestamp, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		creation.Created = time.Unix(ts, 0)
+	}
+	return creation, nil
+}
+
+// AccountTxs implements ExplorerProvider
+func (etherscanExplorer) AccountTxs(addr, action string, chain ChainConfig) ([]explorerTx, error) {
+	url := fmt.Sprintf("%s?module=account&action=%s&address=%s&page=1&offset=%d&sort=asc&apikey=%s", chain.ExplorerAPI, action, addr, deployerHistoryLimit, chain.APIKey())
+	resp, err := upstreamHTTP.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Status != "1" {
+		if strings.HasPrefix(result.Message, "No transactions found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("explorer error: %s", result.Message)
+	}
+	var txs []explorerTx
+	if err := json.Unmarshal(result.Result, &txs); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+// Call implements ExplorerProvider through the explorer's proxy module
+func (etherscanExplorer) Call(to, selector string, chain ChainConfig) ([]byte, error) {
+	url := fmt.Sprintf("%s?module=proxy&action=eth_call&to=%s&data=0x%s&tag=latest&apikey=%s", chain.ExplorerAPI, to, selector, chain.APIKey())
+	resp, err := upstreamHTTP.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(result.Result, "0x") {
+		return nil, fmt.Errorf("eth_call failed: %s", result.Result)
+	}
+	return hex.DecodeString(strings.TrimPrefix(result.Result, "0x"))
+}
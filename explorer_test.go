@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestExplorerCache(t *testing.T) {
+	var hits int64
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		switch r.URL.Query().Get("address") {
+		case "0xslow":
+			<-release
+			fmt.Fprint(w, `{"status":"1","message":"OK","result":"[]"}`)
+		case "0xunverified":
+			fmt.Fprint(w, `{"status":"0","message":"NOTOK","result":"Contract source code not verified"}`)
+		case "0xlimited":
+			fmt.Fprint(w, `{"status":"0","message":"NOTOK","result":"Max rate limit reached"}`)
+		default:
+			fmt.Fprint(w, `{"status":"1","message":"OK","result":"[]"}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	fake := clock.NewFake(time.Now())
+	cache := NewExplorerCache(srv.Client(), time.Hour, 10*time.Minute)
+	cache.clock = fake
+	lookup := func(address, apiKey string) string {
+		t.Helper()
+		body, err := cache.Get(srv.URL + "?module=contract&action=getabi&address=" + address + "&apikey=" + apiKey)
+		if err != nil {
+			t.Error(err)
+		}
+		return string(body)
+	}
+	fetched := func(want int64) {
+		t.Helper()
+		if got := atomic.LoadInt64(&hits); got != want {
+			t.Errorf("explorer hit %d times, want %d", got, want)
+		}
+	}
+
+	// Answers are shared whichever API key or address case asked
+	lookup("0xAbC", "key1")
+	lookup("0xabc", "key2")
+	fetched(1)
+
+	// Not verified is cached for the negative TTL only
+	if body := lookup("0xunverified", "key1"); !strings.Contains(body, "not verified") {
+		t.Errorf("unverified body = %s", body)
+	}
+	lookup("0xunverified", "key1")
+	fetched(2)
+	fake.Advance(11 * time.Minute)
+	lookup("0xunverified", "key1")
+	lookup("0xabc", "key1")
+	fetched(3)
+
+	// Rate limits are never cached
+	lookup("0xlimited", "key1")
+	lookup("0xlimited", "key1")
+	fetched(5)
+
+	// Concurrent misses share one fetch
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lookup("0xslow", "key1")
+		}()
+	}
+	for {
+		cache.mu.Lock()
+		shared := cache.counts[explorerShared]
+		cache.mu.Unlock()
+		if shared == 4 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	fetched(6)
+
+	var b strings.Builder
+	cache.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_explorer_cache_total{result="hit"} 2`,
+		`x402_explorer_cache_total{result="negative_hit"} 1`,
+		`x402_explorer_cache_total{result="shared"} 4`,
+		`x402_explorer_cache_entries 3`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+)
+
+// ExplorerKeys is an http.RoundTripper that spends explorer API calls from a
+// per-key token bucket. A chain's explorer may have several keys (a comma
+// separated list in its api_key_env); each request is sent with the next
+// key in rotation that has budget left. When every key is spent the request
+// queues until one refills, for up to wait, instead of failing. A key whose
+// call the explorer still refuses as rate limited is drained, and the call
+// is retried once with another key.
+type ExplorerKeys struct {
+	next    http.RoundTripper
+	limiter *ratelimit.Bucket // keyed by API key, so chains sharing a key share its budget
+	wait    time.Duration
+	keys    func(host string) (provider string, keys []string) // nil means chainExplorerKeys
+
+	mu    sync.Mutex
+	turn  map[string]int // provider -> next key to try
+	stats map[string]*explorerKeyStats
+}
+
+type explorerKeyStats struct {
+	requests    []int64 // per key index
+	queued      int64
+	rejected    int64
+	rateLimited int64
+}
+
+// NewExplorerKeys allows perSecond calls per API key, in bursts of up to
+// perSecond
+func NewExplorerKeys(next http.RoundTripper, perSecond int, wait time.Duration) *ExplorerKeys {
+	return &ExplorerKeys{
+		next:    next,
+		limiter: ratelimit.New(perSecond*60, perSecond),
+		wait:    wait,
+		turn:    make(map[string]int),
+		stats:   make(map[string]*explorerKeyStats),
+	}
+}
+
+// SetBudget changes the per-key rate and queue wait. Call before serving.
+func (e *ExplorerKeys) SetBudget(perSecond int, wait time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limiter = ratelimit.New(perSecond*60, perSecond)
+	e.wait = wait
+}
+
+// chainExplorerKeys returns the API keys of the configured chain whose
+// explorer is at host
+func chainExplorerKeys(host string) (string, []string) {
+	for _, chain := range runtimeConfig.Current().Chains {
+		if u, err := url.Parse(chain.ExplorerAPI); err == nil && u.Host == host {
+			return upstreamProvider(u.Hostname()), chain.APIKeys()
+		}
+	}
+	return "", nil
+}
+
+// RoundTrip implements http.RoundTripper. Requests without an apikey
+// parameter, or to hosts with no configured keys, pass straight through.
+func (e *ExplorerKeys) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !req.URL.Query().Has("apikey") {
+		return e.next.RoundTrip(req)
+	}
+	lookup := e.keys
+	if lookup == nil {
+		lookup = chainExplorerKeys
+	}
+	provider, keys := lookup(req.URL.Host)
+	if len(keys) == 0 {
+		return e.next.RoundTrip(req)
+	}
+
+	e.mu.Lock()
+	limiter, deadline := e.limiter, time.Now().Add(e.wait)
+	e.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		i, err := e.acquire(req, limiter, provider, keys, deadline)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := e.next.RoundTrip(withAPIKey(req, keys[i]))
+		if err != nil || attempt > 0 || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if !explorerRateLimited(body) {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return resp, nil
+		}
+		e.count(provider, len(keys), func(s *explorerKeyStats) { s.rateLimited++ })
+		// The explorer's own count disagrees with ours: spend what is left
+		for limiter.Allow(keys[i]) {
+		}
+	}
+}
+
+// acquire waits until one of keys has budget and returns its index
+func (e *ExplorerKeys) acquire(req *http.Request, limiter *ratelimit.Bucket, provider string, keys []string, deadline time.Time) (int, error) {
+	queued := false
+	defer func() {
+		if queued {
+			e.count(provider, len(keys), func(s *explorerKeyStats) { s.queued-- })
+		}
+	}()
+	for {
+		e.mu.Lock()
+		start := e.turn[provider]
+		e.turn[provider] = (start + 1) % len(keys)
+		e.mu.Unlock()
+
+		var retry time.Duration
+		for n := range keys {
+			i := (start + n) % len(keys)
+			st := limiter.Take(keys[i])
+			if st.Allowed {
+				e.count(provider, len(keys), func(s *explorerKeyStats) { s.requests[i]++ })
+				return i, nil
+			}
+			if retry == 0 || st.Retry < retry {
+				retry = st.Retry
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			e.count(provider, len(keys), func(s *explorerKeyStats) { s.rejected++ })
+			return 0, fmt.Errorf("%s API keys: %w", provider, ErrUpstreamBusy)
+		}
+		if !queued {
+			queued = true
+			e.count(provider, len(keys), func(s *explorerKeyStats) { s.queued++ })
+		}
+		timer := time.NewTimer(min(max(retry, time.Millisecond), remaining))
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return 0, req.Context().Err()
+		}
+	}
+}
+
+// count updates provider's stats under e.mu
+func (e *ExplorerKeys) count(provider string, keys int, update func(*explorerKeyStats)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.stats[provider]
+	if !ok {
+		s = &explorerKeyStats{}
+		e.stats[provider] = s
+	}
+	for len(s.requests) < keys {
+		s.requests = append(s.requests, 0)
+	}
+	update(s)
+}
+
+// withAPIKey returns a copy of req using key
+func withAPIKey(req *http.Request, key string) *http.Request {
+	out := req.Clone(req.Context())
+	q := out.URL.Query()
+	q.Set("apikey", key)
+	out.URL.RawQuery = q.Encode()
+	return out
+}
+
+// explorerRateLimited reports whether an explorer answer is a refusal for
+// exceeding the key's rate, such as "Max calls per sec rate limit reached"
+func explorerRateLimited(body []byte) bool {
+	var result struct {
+		Status string          `json:"status"`
+		Result json.RawMessage `json:"result"`
+	}
+	if json.Unmarshal(body, &result) != nil || result.Status != "0" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(result.Result)), "rate limit")
+}
+
+// WriteMetrics writes per-key request counts, the queue depth and the
+// rejected and rate limited counters per explorer provider. Keys are
+// labelled by their position in the list, never by value.
+func (e *ExplorerKeys) WriteMetrics(b *strings.Builder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	providers := make([]string, 0, len(e.stats))
+	for provider := range e.stats {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	b.WriteString("# HELP x402_explorer_key_requests_total Explorer calls made with each API key\n")
+	b.WriteString("# TYPE x402_explorer_key_requests_total counter\n")
+	for _, provider := range providers {
+		for i, n := range e.stats[provider].requests {
+			fmt.Fprintf(b, "x402_explorer_key_requests_total{provider=%q,key=%q} %d\n", provider, strconv.Itoa(i+1), n)
+		}
+	}
+	b.WriteString("# HELP x402_explorer_key_queue_depth Explorer calls waiting for API key budget\n")
+	b.WriteString("# TYPE x402_explorer_key_queue_depth gauge\n")
+	for _, provider := range providers {
+		fmt.Fprintf(b, "x402_explorer_key_queue_depth{provider=%q} %d\n", provider, e.stats[provider].queued)
+	}
+	b.WriteString("# HELP x402_explorer_key_rejected_total Explorer calls that timed out waiting for API key budget\n")
+	b.WriteString("# TYPE x402_explorer_key_rejected_total counter\n")
+	for _, provider := range providers {
+		fmt.Fprintf(b, "x402_explorer_key_rejected_total{provider=%q} %d\n", provider, e.stats[provider].rejected)
+	}
+	b.WriteString("# HELP x402_explorer_rate_limited_total Explorer calls refused as rate limited and retried\n")
+	b.WriteString("# TYPE x402_explorer_rate_limited_total counter\n")
+	for _, provider := range providers {
+		fmt.Fprintf(b, "x402_explorer_rate_limited_total{provider=%q} %d\n", provider, e.stats[provider].rateLimited)
+	}
+}
+
+// explorerKeys budgets explorer calls made through upstreamHTTP. main
+// applies EXPLORER_* overrides at startup.
+var explorerKeys = NewExplorerKeys(upstreamLimiter, 5, 30*time.Second)
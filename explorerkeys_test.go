@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExplorerKeys(t *testing.T) {
+	var mu sync.Mutex
+	used := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("apikey")
+		mu.Lock()
+		used[key]++
+		mu.Unlock()
+		if key == "spent" {
+			fmt.Fprint(w, `{"status":"0","message":"NOTOK","result":"Max calls per sec rate limit reached (5/sec)"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"1","message":"OK","result":%q}`, key)
+	}))
+	t.Cleanup(srv.Close)
+
+	newKeys := func(perSecond int, wait time.Duration, keys ...string) *ExplorerKeys {
+		e := NewExplorerKeys(http.DefaultTransport, perSecond, wait)
+		e.keys = func(string) (string, []string) { return "etherscan", keys }
+		return e
+	}
+	get := func(e *ExplorerKeys, query string) (string, error) {
+		t.Helper()
+		resp, err := (&http.Client{Transport: e}).Get(srv.URL + "?module=contract&action=getabi" + query)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// Calls beyond the burst queue for budget instead of failing, and are
+	// spread across both keys
+	e := newKeys(10, 5*time.Second, "k1", "k2")
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := get(e, "&apikey=k1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("30 calls at 2x10/s took %v", elapsed)
+	}
+	if used["k1"] != 15 || used["k2"] != 15 {
+		t.Errorf("keys used %v, want 15 each", used)
+	}
+
+	// Past the queue timeout the call fails as busy
+	e = newKeys(1, 20*time.Millisecond, "k1")
+	get(e, "&apikey=k1")
+	if _, err := get(e, "&apikey=k1"); !errors.Is(err, ErrUpstreamBusy) {
+		t.Errorf("exhausted key: err = %v", err)
+	}
+
+	// A key the explorer refuses is drained and the call retried on the next
+	e = newKeys(5, time.Second, "spent", "k2")
+	if body, err := get(e, "&apikey=x"); err != nil || !strings.Contains(body, `"k2"`) {
+		t.Errorf("retry: %s, %v", body, err)
+	}
+
+	// Calls without a key are left alone
+	if body, err := get(e, ""); err != nil || !strings.Contains(body, `""`) {
+		t.Errorf("keyless call: %s, %v", body, err)
+	}
+
+	var b strings.Builder
+	e.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_explorer_key_requests_total{provider="etherscan",key="1"} 1`,
+		`x402_explorer_key_requests_total{provider="etherscan",key="2"} 1`,
+		`x402_explorer_rate_limited_total{provider="etherscan"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+
+	t.Setenv("TEST_EXPLORER_KEYS", " a, b,,c ")
+	if keys := (ChainConfig{APIKeyEnv: "TEST_EXPLORER_KEYS"}).APIKeys(); strings.Join(keys, "|") != "a|b|c" {
+		t.Errorf("APIKeys = %q", keys)
+	}
+}
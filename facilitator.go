@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facilitator call outcomes, the result label of
+// x402_facilitator_requests_total
+const (
+	facilitatorValid       = "valid"
+	facilitatorInvalid     = "invalid"
+	facilitatorSettled     = "settled"
+	facilitatorFailed      = "failed"      // the facilitator could not settle
+	facilitatorUnavailable = "unavailable" // unreachable or not answering in JSON
+)
+
+// FacilitatorRequirements is an exact payment requirement as x402
+// facilitators take it
+type FacilitatorRequirements struct {
+	Scheme            string            `json:"scheme"`
+	Network           string            `json:"network"`
+	MaxAmountRequired string            `json:"maxAmountRequired"`
+	Resource          string            `json:"resource"`
+	Description       string            `json:"description"`
+	MimeType          string            `json:"mimeType"`
+	PayTo             string            `json:"payTo"`
+	MaxTimeoutSeconds int               `json:"maxTimeoutSeconds"`
+	Asset             string            `json:"asset"` // the token contract
+	Extra             map[string]string `json:"extra"` // EIP-712 domain name and version
+}
+
+// facilitatorRequest is the body of /verify and /settle
+type facilitatorRequest struct {
+	X402Version  int                     `json:"x402Version"`
+	Payload      ExactPayment            `json:"paymentPayload"`
+	Requirements FacilitatorRequirements `json:"paymentRequirements"`
+}
+
+// FacilitatorClient outsources exact payments to an x402 facilitator such
+// as Coinbase's: /verify checks the signature and the payer's balance,
+// /settle submits the authorization on-chain. When the facilitator cannot
+// be reached the service falls back to its own checks, and leaves the
+// authorization in the ledger for the receiver to submit.
+type FacilitatorClient struct {
+	url    string
+	client *http.Client
+
+	mu     sync.Mutex
+	counts map[string]map[string]int64 // call -> outcome -> requests
+}
+
+// NewFacilitatorClient calls the facilitator at url, for example
+// https://x402.org/facilitator
+func NewFacilitatorClient(url string) *FacilitatorClient {
+	return &FacilitatorClient{
+		url:    strings.TrimRight(url, "/"),
+		client: &http.Client{Timeout: 10 * time.Second, Transport: upstreamLimiter},
+		counts: make(map[string]map[string]int64),
+	}
+}
+
+func (f *FacilitatorClient) count(call, outcome string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counts[call] == nil {
+		f.counts[call] = make(map[string]int64)
+	}
+	f.counts[call][outcome]++
+}
+
+// facilitatorRequestFor is what the facilitator is asked about an exact
+// payment of claims for q
+func facilitatorRequestFor(claims *PaymentToken, auth *ExactPayload, q quote, asset string) (*facilitatorRequest, bool) {
+	req, ok := exactRequirement(PaymentRequirement{Network: claims.Payment.Network, Asset: asset, MaxAmount: q.maxPrice})
+	if !ok {
+		return nil, false
+	}
+	return &facilitatorRequest{
+		X402Version: 1,
+		Payload:     ExactPayment{X402Version: 1, Scheme: SchemeExact, Network: claims.Payment.Network, Payload: *auth},
+		Requirements: FacilitatorRequirements{
+			Scheme:            SchemeExact,
+			Network:           req.Network,
+			MaxAmountRequired: req.MaxAmountRequired,
+			Resource:          q.endpoint,
+			Description:       q.description,
+			MimeType:          "application/json",
+			PayTo:             q.receiver,
+			MaxTimeoutSeconds: int(exactMaxValidity.Seconds()),
+			Asset:             req.Extra.VerifyingContract,
+			Extra:             map[string]string{"name": req.Extra.Name, "version": req.Extra.Version},
+		},
+	}, true
+}
+
+// check asks the facilitator to verify an exact payment that passed every
+// local check but, possibly, the signature, and returns the failures that
+// stand: the facilitator's verdict replaces the local signature check. If
+// the facilitator does not answer, the local checks stand. The request to
+// settle with is returned when the facilitator accepted the payment.
+func (f *FacilitatorClient) check(ctx context.Context, claims *PaymentToken, auth *ExactPayload, q quote, asset string, failed []CheckFailure) ([]CheckFailure, *facilitatorRequest) {
+	for _, fail := range failed {
+		if fail.Check != CheckSignature {
+			return failed, nil
+		}
+	}
+	req, ok := facilitatorRequestFor(claims, auth, q, asset)
+	if !ok {
+		return failed, nil
+	}
+	var resp struct {
+		IsValid       bool   `json:"isValid"`
+		InvalidReason string `json:"invalidReason"`
+		Payer         string `json:"payer"`
+	}
+	if err := f.call(ctx, "verify", req, &resp); err != nil {
+		f.count("verify", facilitatorUnavailable)
+		log.Printf("⚠️  Facilitator verify unavailable, checking locally: %v", err)
+		return failed, nil
+	}
+	if !resp.IsValid {
+		f.count("verify", facilitatorInvalid)
+		return []CheckFailure{{CheckFacilitator, "facilitator: " + resp.InvalidReason}}, nil
+	}
+	f.count("verify", facilitatorValid)
+	return nil, req
+}
+
+// settle has the facilitator submit a verified payment and returns the
+// settlement transaction's hash
+func (f *FacilitatorClient) settle(ctx context.Context, req *facilitatorRequest) (string, error) {
+	var resp struct {
+		Success     bool   `json:"success"`
+		ErrorReason string `json:"errorReason"`
+		Transaction string `json:"transaction"`
+	}
+	if err := f.call(ctx, "settle", req, &resp); err != nil {
+		f.count("settle", facilitatorUnavailable)
+		return "", err
+	}
+	if !resp.Success {
+		f.count("settle", facilitatorFailed)
+		return "", errors.New(resp.ErrorReason)
+	}
+	f.count("settle", facilitatorSettled)
+	return strings.ToLower(resp.Transaction), nil
+}
+
+// settlementDelivery is a facilitated payment queued in the outbox to be
+// settled again
+type settlementDelivery struct {
+	Tenant    string              `json:"tenant"`
+	PaymentID string              `json:"payment_id"`
+	Request   *facilitatorRequest `json:"request"`
+}
+
+// deliverSettlement asks the facilitator again to settle a payment it
+// failed to settle at capture, and marks the ledger entry settled. An
+// entry settled meanwhile, by a callback or the receiver, is left alone.
+func (p *Paywall) deliverSettlement(d Delivery) error {
+	var s settlementDelivery
+	if err := json.Unmarshal(d.Payload, &s); err != nil {
+		return err
+	}
+	if p.facilitator == nil {
+		return errors.New("no facilitator")
+	}
+	// The entry is recorded after the settlement is queued
+	entry, ok := p.ledger.Find(s.Tenant, s.PaymentID)
+	if !ok {
+		return fmt.Errorf("payment %s is not in the ledger yet", s.PaymentID)
+	}
+	if entry.Status != PaymentVerified {
+		return nil
+	}
+	txHash, err := p.facilitator.settle(context.Background(), s.Request)
+	if err != nil || txHash == "" {
+		// Without a transaction, the facilitator calls back once it is mined
+		return err
+	}
+	entry.Status = PaymentSettled
+	entry.TxHash = txHash
+	return p.events.Publish(context.Background(), EventPaymentSettled, SettledPayment{Entry: entry})
+}
+
+func (f *FacilitatorClient) call(ctx context.Context, path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url+"/"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Facilitators answer a refused payment with 400 and a JSON verdict
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("/%s returned %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("/%s returned %d: %w", path, resp.StatusCode, err)
+	}
+	return nil
+}
+
+// WriteMetrics emits facilitator calls by outcome
+func (f *FacilitatorClient) WriteMetrics(b *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b.WriteString("# HELP x402_facilitator_requests_total Calls to the x402 facilitator, by call and result\n")
+	b.WriteString("# TYPE x402_facilitator_requests_total counter\n")
+	for _, call := range sortedKeys(f.counts) {
+		for _, outcome := range sortedKeys(f.counts[call]) {
+			fmt.Fprintf(b, "x402_facilitator_requests_total{call=%q,result=%q} %d\n", call, outcome, f.counts[call][outcome])
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+func TestPaywallFacilitator(t *testing.T) {
+	featureFlags.ParseEnv("exact_scheme")
+	t.Cleanup(func() { featureFlags.ParseEnv("") })
+
+	const settleTx = "0x00000000000000000000000000000000000000000000000000000000000f00d5"
+	verdict := `{"isValid": true}`
+	var verified FacilitatorRequirements
+	fac := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req facilitatorRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.URL.Path {
+		case "/verify":
+			verified = req.Requirements
+			if verdict == "" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(verdict))
+		case "/settle":
+			w.Write([]byte(`{"success": true, "transaction": "` + settleTx + `", "network": "base"}`))
+		}
+	}))
+	defer fac.Close()
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	facilitator := NewFacilitatorClient(fac.URL + "/")
+	paywall.SetFacilitator(facilitator)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+
+	wallet, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	pay := func(key *big.Int) int {
+		header := signExactPayment(t, types.TransferAuthorization{
+			From:        ethsig.Address(wallet),
+			To:          config.Receiver,
+			Value:       "1000",
+			ValidAfter:  "0",
+			ValidBefore: strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10),
+			Nonce:       randomNonce(),
+		}, key)
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment", header)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := pay(wallet); code != http.StatusOK {
+		t.Fatalf("facilitated payment returned %d", code)
+	}
+	if verified.PayTo != config.Receiver || verified.MaxAmountRequired != "1000" || verified.Asset != payoutTokens["base:USDC"] || verified.Resource != "/api/gas" {
+		t.Errorf("verified requirements = %+v", verified)
+	}
+	if entries := ledger.Entries(DefaultTenant); len(entries) != 1 || entries[0].TxHash != settleTx {
+		t.Errorf("ledger = %+v, want the settlement transaction", entries)
+	}
+
+	// The facilitator's verdict replaces the local signature check, so a
+	// smart wallet it can verify pays, and a refusal is final
+	if code := pay(big.NewInt(1)); code != http.StatusOK {
+		t.Errorf("signature the facilitator accepted returned %d", code)
+	}
+	verdict = `{"isValid": false, "invalidReason": "insufficient_funds"}`
+	if code := pay(wallet); code != http.StatusPaymentRequired {
+		t.Errorf("refused payment returned %d, want 402", code)
+	}
+	if failures := paywall.Failures(); len(failures) == 0 || failures[0].Reason != "facilitator: insufficient_funds" {
+		t.Errorf("failures = %+v", failures)
+	}
+
+	// Unreachable, the local checks stand
+	verdict = ""
+	if code := pay(big.NewInt(1)); code != http.StatusPaymentRequired {
+		t.Errorf("bad signature without the facilitator returned %d, want 402", code)
+	}
+	if code := pay(wallet); code != http.StatusOK {
+		t.Errorf("good signature without the facilitator returned %d", code)
+	}
+	if entries := ledger.Entries(DefaultTenant); len(entries) != 3 || entries[0].TxHash != "" || entries[0].Authorization == nil {
+		t.Errorf("ledger = %+v, want the unsettled authorization first", entries)
+	}
+
+	var b strings.Builder
+	facilitator.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_facilitator_requests_total{call="settle",result="settled"} 2`,
+		`x402_facilitator_requests_total{call="verify",result="invalid"} 1`,
+		`x402_facilitator_requests_total{call="verify",result="unavailable"} 2`,
+		`x402_facilitator_requests_total{call="verify",result="valid"} 2`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestFacilitatorSettlementRetried(t *testing.T) {
+	featureFlags.ParseEnv("exact_scheme")
+	t.Cleanup(func() { featureFlags.ParseEnv("") })
+
+	const settleTx = "0x00000000000000000000000000000000000000000000000000000000000f00d5"
+	settled := false
+	fac := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/verify":
+			w.Write([]byte(`{"isValid": true}`))
+		case "/settle":
+			if !settled {
+				w.Write([]byte(`{"success": false, "errorReason": "nonce_pending"}`))
+				return
+			}
+			w.Write([]byte(`{"success": true, "transaction": "` + settleTx + `", "network": "base"}`))
+		}
+	}))
+	defer fac.Close()
+
+	dir := t.TempDir()
+	ledger, err := NewLedger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox.kick = func() {}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	paywall.SetFacilitator(NewFacilitatorClient(fac.URL + "/"))
+	paywall.SetOutbox(outbox, RetryPolicy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour})
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+
+	wallet, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	req := httptest.NewRequest("GET", "/api/gas", nil)
+	req.Header.Set("X-Payment", signExactPayment(t, types.TransferAuthorization{
+		From:        ethsig.Address(wallet),
+		To:          config.Receiver,
+		Value:       "1000",
+		ValidAfter:  "0",
+		ValidBefore: strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10),
+		Nonce:       randomNonce(),
+	}, wallet))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("facilitated payment returned %d", rr.Code)
+	}
+	if queued := outbox.List(DeliveryPending); len(queued) != 1 || queued[0].Kind != DeliverySettlement {
+		t.Fatalf("outbox = %+v, want the failed settlement", queued)
+	}
+
+	settled = true
+	outbox.Deliver()
+	if entries := ledger.Entries(DefaultTenant); len(entries) != 1 || entries[0].Status != PaymentSettled || entries[0].TxHash != settleTx {
+		t.Errorf("ledger = %+v, want the entry settled", entries)
+	}
+	if queued := outbox.List(""); len(queued) != 0 {
+		t.Errorf("outbox = %+v, want it delivered", queued)
+	}
+}
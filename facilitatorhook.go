@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// facilitatorSignatureHeader signs a settlement callback:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">"
+const facilitatorSignatureHeader = "X-Facilitator-Signature"
+
+// facilitatorCallbackTolerance is how far a callback's timestamp may be
+// from now, which bounds how long a captured callback can be replayed
+const facilitatorCallbackTolerance = 5 * time.Minute
+
+// FacilitatorCallback is the body a facilitator that settles
+// asynchronously posts once the authorization is on-chain, or has failed
+type FacilitatorCallback struct {
+	Success     bool   `json:"success"`
+	Transaction string `json:"transaction"`
+	Network     string `json:"network"`
+	Payer       string `json:"payer"`
+	Nonce       string `json:"nonce"` // of the settled authorization
+	ErrorReason string `json:"errorReason,omitempty"`
+}
+
+// FacilitatorWebhook receives settlement callbacks. A facilitator that
+// settles asynchronously answers /settle before the transaction is mined,
+// so the payment is recorded as verified; its callback, signed with a
+// shared secret, marks the entry settled and publishes payment.settled.
+type FacilitatorWebhook struct {
+	secret []byte
+	ledger *Ledger
+	events *EventBus
+	clock  clock.Clock
+
+	mu     sync.Mutex
+	counts map[string]int64 // result -> callbacks
+}
+
+// NewFacilitatorWebhook accepts callbacks signed with secret, settling
+// entries in ledger
+func NewFacilitatorWebhook(secret string, ledger *Ledger, events *EventBus) *FacilitatorWebhook {
+	return &FacilitatorWebhook{
+		secret: []byte(secret),
+		ledger: ledger,
+		events: events,
+		clock:  clock.System,
+		counts: make(map[string]int64),
+	}
+}
+
+// SetClock replaces the clock callback timestamps are checked against
+func (f *FacilitatorWebhook) SetClock(c clock.Clock) {
+	f.clock = c
+}
+
+// signFacilitatorCallback returns the signature header for body sent at t
+func signFacilitatorCallback(secret []byte, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + facilitatorCallbackMAC(secret, ts, body)
+}
+
+func facilitatorCallbackMAC(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a callback's signature header and its age
+func (f *FacilitatorWebhook) verify(header string, body []byte) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("%s must be t=<unix seconds>,v1=<signature>", facilitatorSignatureHeader)
+	}
+	sent := time.Unix(unix, 0)
+	if age := f.clock.Now().Sub(sent); age > facilitatorCallbackTolerance || age < -facilitatorCallbackTolerance {
+		return fmt.Errorf("callback sent at %s is outside the %s tolerance", sent.UTC().Format(time.RFC3339), facilitatorCallbackTolerance)
+	}
+	if !hmac.Equal([]byte(sig), []byte(facilitatorCallbackMAC(f.secret, ts, body))) {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
+
+func (f *FacilitatorWebhook) count(result string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[result]++
+}
+
+// handleCallback serves POST /webhooks/facilitator. A settled payment
+// answers with its ledger entry; a callback repeated with the same
+// transaction is acknowledged again, one naming another is a conflict.
+func (f *FacilitatorWebhook) handleCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(status int, result, message string) {
+		f.count(result)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		fail(http.StatusBadRequest, "invalid", "reading body: "+err.Error())
+		return
+	}
+	if err := f.verify(r.Header.Get(facilitatorSignatureHeader), body); err != nil {
+		fail(http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+	var callback FacilitatorCallback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		fail(http.StatusBadRequest, "invalid", "invalid JSON: "+err.Error())
+		return
+	}
+	if callback.Nonce == "" {
+		fail(http.StatusBadRequest, "invalid", "nonce is required")
+		return
+	}
+	if callback.Success && !txHashPattern.MatchString(callback.Transaction) {
+		fail(http.StatusBadRequest, "invalid", "transaction must be a 0x-prefixed 32-byte hash")
+		return
+	}
+	entry, ok := f.ledger.FindAuthorization(callback.Nonce)
+	if !ok {
+		fail(http.StatusNotFound, "unknown", "no payment with authorization nonce "+callback.Nonce)
+		return
+	}
+
+	if !callback.Success {
+		// The authorization stays in the ledger for the receiver to submit
+		log.Printf("⚠️  Facilitator could not settle %s: %s", entry.ID, callback.ErrorReason)
+		f.count(facilitatorFailed)
+		json.NewEncoder(w).Encode(entry)
+		return
+	}
+	txHash := strings.ToLower(callback.Transaction)
+	if entry.Status == PaymentSettled {
+		if entry.TxHash != txHash {
+			fail(http.StatusConflict, "conflict", fmt.Sprintf("payment %s was settled in %s", entry.ID, entry.TxHash))
+			return
+		}
+		f.count("duplicate")
+		json.NewEncoder(w).Encode(entry)
+		return
+	}
+
+	entry.Status = PaymentSettled
+	entry.TxHash = txHash
+	// The ledger subscribes; the facilitator retries if it fails
+	if err := f.events.Publish(r.Context(), EventPaymentSettled, SettledPayment{Entry: entry}); err != nil {
+		log.Printf("❌ Settlement of %s not recorded: %v", entry.ID, err)
+		fail(http.StatusInternalServerError, "error", "settlement not recorded")
+		return
+	}
+	f.count(facilitatorSettled)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// WriteMetrics emits settlement callbacks by result
+func (f *FacilitatorWebhook) WriteMetrics(b *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b.WriteString("# HELP x402_facilitator_callbacks_total Settlement callbacks from the x402 facilitator, by result\n")
+	b.WriteString("# TYPE x402_facilitator_callbacks_total counter\n")
+	for _, result := range sortedKeys(f.counts) {
+		fmt.Fprintf(b, "x402_facilitator_callbacks_total{result=%q} %d\n", result, f.counts[result])
+	}
+}
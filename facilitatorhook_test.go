@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+func TestFacilitatorWebhook(t *testing.T) {
+	featureFlags.ParseEnv("exact_scheme")
+	t.Cleanup(func() { featureFlags.ParseEnv("") })
+
+	// The facilitator accepts the settlement and calls back once it is mined
+	fac := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/verify":
+			w.Write([]byte(`{"isValid": true}`))
+		case "/settle":
+			w.Write([]byte(`{"success": true, "network": "base"}`))
+		}
+	}))
+	defer fac.Close()
+
+	dir := t.TempDir()
+	ledger, err := NewLedger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	paywall.SetFacilitator(NewFacilitatorClient(fac.URL))
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+
+	wallet, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	nonce := randomNonce()
+	req := httptest.NewRequest("GET", "/api/gas", nil)
+	req.Header.Set("X-Payment", signExactPayment(t, types.TransferAuthorization{
+		From:        ethsig.Address(wallet),
+		To:          config.Receiver,
+		Value:       "1000",
+		ValidAfter:  "0",
+		ValidBefore: strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10),
+		Nonce:       nonce,
+	}, wallet))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("payment returned %d", rr.Code)
+	}
+	entries := ledger.Entries(DefaultTenant)
+	if len(entries) != 1 || entries[0].Status != PaymentVerified || entries[0].TxHash != "" {
+		t.Fatalf("ledger = %+v, want one verified entry awaiting settlement", entries)
+	}
+
+	fake := clock.NewFake(time.Now())
+	webhook := NewFacilitatorWebhook("hook-secret", ledger, paywall.events)
+	webhook.SetClock(fake)
+	post := func(body, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/webhooks/facilitator", strings.NewReader(body))
+		req.Header.Set(facilitatorSignatureHeader, signature)
+		rr := httptest.NewRecorder()
+		webhook.handleCallback(rr, req)
+		return rr
+	}
+	const tx = "0x00000000000000000000000000000000000000000000000000000000000F00D5"
+	settled := `{"success": true, "transaction": "` + tx + `", "network": "base", "nonce": "` + nonce + `"}`
+	sign := func(body string) string {
+		return signFacilitatorCallback([]byte("hook-secret"), fake.Now(), []byte(body))
+	}
+
+	for name, signature := range map[string]string{
+		"unsigned":   "",
+		"wrong key":  signFacilitatorCallback([]byte("other"), fake.Now(), []byte(settled)),
+		"stale":      signFacilitatorCallback([]byte("hook-secret"), fake.Now().Add(-10*time.Minute), []byte(settled)),
+		"other body": sign(`{"success": false}`),
+	} {
+		if rr := post(settled, signature); rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s callback returned %d, want 401", name, rr.Code)
+		}
+	}
+	unknown := `{"success": true, "transaction": "` + tx + `", "nonce": "0x01"}`
+	if rr := post(unknown, sign(unknown)); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown nonce returned %d, want 404", rr.Code)
+	}
+	if entries := ledger.Entries(DefaultTenant); entries[0].Status != PaymentVerified {
+		t.Fatalf("refused callbacks changed the entry: %+v", entries[0])
+	}
+
+	if rr := post(settled, sign(settled)); rr.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", rr.Code, rr.Body)
+	}
+	if rr := post(settled, sign(settled)); rr.Code != http.StatusOK {
+		t.Errorf("repeated callback returned %d", rr.Code)
+	}
+	other := strings.Replace(settled, "F00D5", "BEEF5", 1)
+	if rr := post(other, sign(other)); rr.Code != http.StatusConflict {
+		t.Errorf("callback with another transaction returned %d, want 409", rr.Code)
+	}
+
+	// The settlement survives a restart
+	reopened, err := NewLedger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []*Ledger{ledger, reopened} {
+		if entries := l.Entries(DefaultTenant); len(entries) != 1 || entries[0].Status != PaymentSettled || entries[0].TxHash != strings.ToLower(tx) {
+			t.Errorf("ledger = %+v, want the entry settled", entries)
+		}
+	}
+
+	var b strings.Builder
+	webhook.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_facilitator_callbacks_total{result="conflict"} 1`,
+		`x402_facilitator_callbacks_total{result="duplicate"} 1`,
+		`x402_facilitator_callbacks_total{result="settled"} 1`,
+		`x402_facilitator_callbacks_total{result="unauthorized"} 4`,
+		`x402_facilitator_callbacks_total{result="unknown"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
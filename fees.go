@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// Fee estimation parameters
+const (
+	feeHistoryBlocks     = 10
+	feeHistoryPercentile = 50   // reward percentile used as the priority fee
+	waitBaseFeeRatio     = 1.25 // base fee over the recent average at which waiting pays
+	trendBaseFeeRatio    = 0.1  // change against the recent average that counts as a trend
+)
+
+// defaultPriorityFee is the tip used when the node offers no fee data
+var defaultPriorityFee = units.Gwei
+
+// estimateFees recommends EIP-1559 fees for the next block from the last
+// blocks' base fees and median tips. maxFeePerGas is twice the next base
+// fee plus the tip, which stays valid through six full blocks of base fee
+// increases. When the node has no eth_feeHistory, the fees are derived
+// from eth_gasPrice and the trend is unknown.
+func estimateFees(rpc *RPCClient) (*FeeRecommendation, error) {
+	baseFee, priorityFee, average, err := feeHistory(rpc)
+	if err != nil {
+		baseFee, priorityFee, err = gasPriceFees(rpc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maxFee := new(big.Int).Add(new(big.Int).Lsh(baseFee, 1), priorityFee)
+	fees := &FeeRecommendation{
+		BaseFeeGwei:              round(units.ToGwei(baseFee), 2),
+		BaseFeePerGas:            baseFee.String(),
+		MaxFeePerGas:             maxFee.String(),
+		MaxPriorityFeePerGas:     priorityFee.String(),
+		MaxFeePerGasGwei:         round(units.ToGwei(maxFee), 2),
+		MaxPriorityFeePerGasGwei: round(units.ToGwei(priorityFee), 2),
+		BaseFeeTrend:             "unknown",
+		Timing:                   "send_now",
+		Reason:                   "No fee history available - fees are based on the current gas price",
+	}
+	if average == 0 {
+		return fees, nil
+	}
+
+	ratio := units.ToGwei(baseFee) / average
+	switch {
+	case ratio > 1+trendBaseFeeRatio:
+		fees.BaseFeeTrend = "rising"
+	case ratio < 1-trendBaseFeeRatio:
+		fees.BaseFeeTrend = "falling"
+	default:
+		fees.BaseFeeTrend = "steady"
+	}
+	if ratio > waitBaseFeeRatio {
+		fees.Timing = "wait"
+		fees.Reason = fmt.Sprintf("Base fee is %.0f%% above its %d-block average - waiting a few blocks is likely cheaper", (ratio-1)*100, feeHistoryBlocks)
+	} else {
+		fees.Reason = fmt.Sprintf("Base fee is %s (%+.0f%% against its %d-block average) - sending now is fine", fees.BaseFeeTrend, (ratio-1)*100, feeHistoryBlocks)
+	}
+	return fees, nil
+}
+
+// feeHistory returns the next block's base fee, the median tip and the
+// recent average base fee in gwei
+func feeHistory(rpc *RPCClient) (*big.Int, *big.Int, float64, error) {
+	result, err := rpc.call("eth_feeHistory", []interface{}{units.Hex(big.NewInt(feeHistoryBlocks)), "latest", []int{feeHistoryPercentile}})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	history, ok := result["result"].(map[string]interface{})
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("no fee history")
+	}
+
+	// baseFeePerGas has one entry per block plus the next block's
+	baseFees, _ := history["baseFeePerGas"].([]interface{})
+	if len(baseFees) < 2 {
+		return nil, nil, 0, fmt.Errorf("fee history has no base fees")
+	}
+	var sum float64
+	var next *big.Int
+	for i, v := range baseFees {
+		s, _ := v.(string)
+		fee, err := units.ParseHex(s)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("invalid base fee %q", s)
+		}
+		if i == len(baseFees)-1 {
+			next = fee
+		} else {
+			sum += units.ToGwei(fee)
+		}
+	}
+
+	var tips []*big.Int
+	rewards, _ := history["reward"].([]interface{})
+	for _, block := range rewards {
+		percentiles, _ := block.([]interface{})
+		if len(percentiles) == 0 {
+			continue
+		}
+		s, _ := percentiles[0].(string)
+		if tip, err := units.ParseHex(s); err == nil {
+			tips = append(tips, tip)
+		}
+	}
+	tip := defaultPriorityFee
+	if len(tips) > 0 {
+		sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+		tip = tips[len(tips)/2]
+	}
+	return next, tip, sum / float64(len(baseFees)-1), nil
+}
+
+// gasPriceFees splits eth_gasPrice into a base fee and a tip, using
+// eth_maxPriorityFeePerGas for the tip when the node has it
+func gasPriceFees(rpc *RPCClient) (*big.Int, *big.Int, error) {
+	result, err := rpc.call("eth_gasPrice", []interface{}{})
+	if err != nil {
+		return nil, nil, err
+	}
+	s, ok := result["result"].(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid gas price response")
+	}
+	gasPrice, err := units.ParseHex(s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tip := defaultPriorityFee
+	if result, err := rpc.call("eth_maxPriorityFeePerGas", []interface{}{}); err == nil {
+		if s, ok := result["result"].(string); ok {
+			if v, err := units.ParseHex(s); err == nil {
+				tip = v
+			}
+		}
+	}
+	if tip.Cmp(gasPrice) > 0 {
+		tip = gasPrice
+	}
+	return new(big.Int).Sub(gasPrice, tip), tip, nil
+}
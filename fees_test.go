@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+// testFeeHistory is ten blocks at 10 gwei followed by the next block's
+// base fee, with tips of 1-3 gwei
+func testFeeHistory(next string) map[string]interface{} {
+	baseFees := []interface{}{}
+	rewards := []interface{}{}
+	for i := 0; i < 10; i++ {
+		baseFees = append(baseFees, "0x2540be400") // 10 gwei
+		rewards = append(rewards, []interface{}{[]string{"0x3b9aca00", "0x77359400", "0xb2d05e00"}[i%3]})
+	}
+	return map[string]interface{}{
+		"oldestBlock":   "0x1",
+		"baseFeePerGas": append(baseFees, next),
+		"gasUsedRatio":  []float64{0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5},
+		"reward":        rewards,
+	}
+}
+
+func TestEstimateFees(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+	rpc := &RPCClient{url: up.RPC.URL}
+
+	// Without eth_feeHistory, eth_gasPrice (20 gwei) is split with a 1 gwei tip
+	fees, err := estimateFees(rpc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees.BaseFeeGwei != 19 || fees.MaxPriorityFeePerGas != "1000000000" || fees.MaxFeePerGasGwei != 39 || fees.BaseFeeTrend != "unknown" || fees.Timing != "send_now" {
+		t.Errorf("gas price fallback = %+v", fees)
+	}
+
+	up.SetRPCResult("eth_feeHistory", testFeeHistory("0x2540be400"))
+	fees, _ = estimateFees(rpc)
+	if fees.BaseFeeGwei != 10 || fees.MaxPriorityFeePerGasGwei != 2 || fees.MaxFeePerGas != "22000000000" || fees.BaseFeeTrend != "steady" || fees.Timing != "send_now" {
+		t.Errorf("steady base fee = %+v", fees)
+	}
+
+	// A base fee spike: 15 gwei against a 10 gwei average
+	up.SetRPCResult("eth_feeHistory", testFeeHistory("0x37e11d600"))
+	fees, _ = estimateFees(rpc)
+	if fees.BaseFeeTrend != "rising" || fees.Timing != "wait" || fees.MaxFeePerGasGwei != 32 {
+		t.Errorf("base fee spike = %+v", fees)
+	}
+	result, err := NewTxSimulator(up.RPC.URL).Simulate(&TxPreflightRequest{To: testToken, Value: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Fees == nil || result.Fees.Timing != "wait" || len(result.Recommendations) != 1 {
+		t.Errorf("preflight = %+v", result)
+	}
+
+	// The MEV check prices gas risk from the estimate: 15 + 2 gwei
+	t.Setenv("ETH_RPC_URL", up.RPC.URL)
+	if mev := checkMEVRisk(MEVCheckRequest{To: testToken, Value: "0"}); mev.Fees == nil || mev.GasPriceRisk != "low" {
+		t.Errorf("MEV check = %+v", mev)
+	}
+	up.SetRPCResult("eth_feeHistory", testFeeHistory("0xe8d4a51000")) // 1000 gwei
+	if mev := checkMEVRisk(MEVCheckRequest{To: testToken, Value: "0"}); mev.GasPriceRisk != "high" || mev.MEVRiskScore != 10 {
+		t.Errorf("MEV check at 1000 gwei = %+v", mev)
+	}
+
+	up.Fail(testhttp.RPC, true)
+	if _, err := estimateFees(rpc); err == nil {
+		t.Error("estimate succeeded with the RPC down")
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// paymentAsset describes an asset payments can be made in
+type paymentAsset struct {
+	decimals int
+	pegged   bool // worth one USD
+}
+
+// paymentAssets are the assets PAYMENT_ASSET accepts
+var paymentAssets = map[string]paymentAsset{
+	"USDC": {decimals: 6, pegged: true},
+	"USDT": {decimals: 6, pegged: true},
+	"DAI":  {decimals: 18, pegged: true},
+	"ETH":  {decimals: 18},
+	"WETH": {decimals: 18},
+}
+
+// parsePaymentAssets reads PAYMENT_ASSETS, the assets accepted besides
+// primary, e.g. "DAI,ETH"
+func parsePaymentAssets(s, primary string) ([]string, error) {
+	var assets []string
+	for _, asset := range strings.Split(s, ",") {
+		asset = strings.ToUpper(strings.TrimSpace(asset))
+		if asset == "" || asset == primary || slices.Contains(assets, asset) {
+			continue
+		}
+		if _, ok := paymentAssets[asset]; !ok {
+			return nil, fmt.Errorf("unsupported asset %q - use %s", asset, optionList(paymentAssets))
+		}
+		assets = append(assets, asset)
+	}
+	return assets, nil
+}
+
+// FiatPrice is a price set in a fiat currency rather than in the payment
+// asset, written "0.001 USD", "0.001 eur" or "$0.001"
+type FiatPrice struct {
+	Amount   float64
+	Currency string // lowercase, one of priceCurrencies
+}
+
+func (f FiatPrice) String() string {
+	return strconv.FormatFloat(f.Amount, 'f', -1, 64) + " " + strings.ToUpper(f.Currency)
+}
+
+// parseFiatPrice reads a fiat price. ok is false for a plain asset amount.
+func parseFiatPrice(s string) (price FiatPrice, ok bool, err error) {
+	s = strings.TrimSpace(s)
+	amount, currency := s, ""
+	if strings.HasPrefix(s, "$") {
+		amount, currency = s[1:], "usd"
+	} else if i := strings.LastIndexByte(s, ' '); i >= 0 {
+		amount, currency = strings.TrimSpace(s[:i]), strings.ToLower(s[i+1:])
+	}
+	if currency == "" {
+		return FiatPrice{}, false, nil
+	}
+	if !priceCurrencies[currency] {
+		return FiatPrice{}, true, fmt.Errorf("unsupported currency in price %q - use %s", s, optionList(priceCurrencies))
+	}
+	v, err := strconv.ParseFloat(amount, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) {
+		return FiatPrice{}, true, fmt.Errorf("invalid price %q", s)
+	}
+	return FiatPrice{Amount: v, Currency: currency}, true, nil
+}
+
+// validatePrice accepts a plain asset amount or a fiat price
+func validatePrice(s string) error {
+	if _, ok, err := parseFiatPrice(s); ok {
+		return err
+	}
+	if v, err := strconv.ParseFloat(s, 64); err != nil || v < 0 {
+		return fmt.Errorf("invalid price %q", s)
+	}
+	return nil
+}
+
+// priceLabel describes a configured price for listings, e.g. "0.002 USDC"
+// or "0.001 EUR"
+func priceLabel(price, asset string) string {
+	if fiat, ok, err := parseFiatPrice(price); ok && err == nil {
+		return fiat.String()
+	}
+	return price + " " + asset
+}
+
+// Conversion is a fiat price expressed in the payment asset
+type Conversion struct {
+	Fiat   FiatPrice
+	Amount string  // asset amount to pay
+	Min    string  // smallest amount accepted
+	Max    string  // largest amount accepted
+	USD    float64 // value of the price in USD
+	Rate   float64 // USD price of one unit of the asset
+}
+
+// PriceConverter turns fiat prices into payment asset amounts at challenge
+// time. Exchange rates are refreshed at most once per refresh interval and
+// a rate older than maxAge is never quoted. Payments within tolerance of
+// the current amount are accepted, so a refresh between the challenge and
+// the payment does not reject it.
+type PriceConverter struct {
+	asset     string
+	info      paymentAsset
+	currency  string  // currency of plain prices; empty means they are asset amounts
+	tolerance float64 // fraction of the amount
+	refresh   time.Duration
+	maxAge    time.Duration
+
+	mu       sync.Mutex // one refresh at a time
+	rate     lastGood[float64]
+	tried    time.Time
+	clock    clock.Clock
+	assetUSD func(asset string) (float64, error)
+	usdRate  func(currency string) (float64, error) // units of currency per USD
+}
+
+// NewPriceConverter converts prices into asset. Plain prices are read as
+// amounts in currency, or as asset amounts if currency is empty.
+func NewPriceConverter(asset, currency string) (*PriceConverter, error) {
+	info, ok := paymentAssets[asset]
+	if !ok {
+		return nil, fmt.Errorf("unsupported asset %q", asset)
+	}
+	currency = strings.ToLower(currency)
+	if currency != "" && !priceCurrencies[currency] {
+		return nil, fmt.Errorf("unsupported currency %q - use %s", currency, optionList(priceCurrencies))
+	}
+	if currency == "" && !info.pegged {
+		return nil, fmt.Errorf("%s is not a stablecoin, so prices must be set in fiat: set PRICE_CURRENCY", asset)
+	}
+	return &PriceConverter{
+		asset:     asset,
+		info:      info,
+		currency:  currency,
+		tolerance: 0.02,
+		refresh:   time.Minute,
+		maxAge:    10 * time.Minute,
+		clock:     clock.System,
+		assetUSD:  fetchAssetUSD,
+		usdRate:   fxRate,
+	}, nil
+}
+
+// SetLimits sets how often the asset rate is refreshed, the oldest rate
+// quoted, and the accepted deviation from the current amount
+func (c *PriceConverter) SetLimits(refresh, maxAge time.Duration, tolerance float64) {
+	c.refresh, c.maxAge, c.tolerance = refresh, maxAge, tolerance
+}
+
+// fiatPrice reads price as a fiat price, if it is one
+func (c *PriceConverter) fiatPrice(price string) (FiatPrice, bool, error) {
+	fiat, ok, err := parseFiatPrice(price)
+	if ok || c.currency == "" {
+		return fiat, ok, err
+	}
+	v, err := strconv.ParseFloat(price, 64)
+	return FiatPrice{Amount: v, Currency: c.currency}, true, err
+}
+
+// Convert prices fiat in the payment asset at the current rate
+func (c *PriceConverter) Convert(fiat FiatPrice) (Conversion, error) {
+	usd := fiat.Amount
+	if fiat.Currency != "usd" {
+		perUSD, err := c.usdRate(fiat.Currency)
+		if err != nil {
+			return Conversion{}, fmt.Errorf("%s rate: %w", strings.ToUpper(fiat.Currency), err)
+		}
+		usd = fiat.Amount / perUSD
+	}
+	rate, err := c.assetRate()
+	if err != nil {
+		return Conversion{}, fmt.Errorf("%s rate: %w", c.asset, err)
+	}
+
+	amount := usd / rate
+	conv := Conversion{Fiat: fiat, USD: round(usd, 6), Rate: rate}
+	conv.Amount = c.format(amount)
+	conv.Min, conv.Max = conv.Amount, conv.Amount
+	// Rates that move between challenge and payment need some slack
+	if !c.info.pegged || fiat.Currency != "usd" {
+		conv.Min = c.format(amount * (1 - c.tolerance))
+		conv.Max = c.format(amount * (1 + c.tolerance))
+	}
+	return conv, nil
+}
+
+// assetRate returns the USD price of the asset, refreshing it if it is
+// older than the refresh interval. A failed refresh is not retried within
+// the interval; the last rate is used until it exceeds maxAge.
+func (c *PriceConverter) assetRate() (float64, error) {
+	if c.info.pegged {
+		return 1, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rate, age, ok := c.rate.Load(c.maxAge)
+	now := c.clock.Now()
+	if ok && age < c.refresh || now.Sub(c.tried) < c.refresh {
+		if !ok {
+			return 0, fmt.Errorf("no recent rate")
+		}
+		return rate, nil
+	}
+	c.tried = now
+	fresh, err := c.assetUSD(c.asset)
+	if err == nil && !(fresh > 0) {
+		err = fmt.Errorf("implausible rate %v", fresh)
+	}
+	if err != nil {
+		if !ok {
+			return 0, err
+		}
+		log.Printf("⚠️  %s rate refresh failed, quoting a %s old rate: %v", c.asset, age.Round(time.Second), err)
+		return rate, nil
+	}
+	c.rate.Store(fresh)
+	return fresh, nil
+}
+
+// format writes amount with the asset's decimals, without trailing zeros
+func (c *PriceConverter) format(amount float64) string {
+	s := strconv.FormatFloat(amount, 'f', c.info.decimals, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// fetchAssetUSD returns the USD price of a non-pegged asset
+func fetchAssetUSD(asset string) (float64, error) {
+	switch asset {
+	case "ETH", "WETH":
+		price, err := providers.Price.ETHPrice()
+		if err != nil {
+			return 0, err
+		}
+		return price.Eth, nil
+	}
+	return 0, fmt.Errorf("no price feed for %s", asset)
+}
+
+// amountInRange reports whether a paid amount lies in [min, max]. When
+// they are equal the amount must match exactly, as for fixed prices.
+func amountInRange(amount, min, max string) bool {
+	if min == max {
+		return amount == min
+	}
+	v, err := strconv.ParseFloat(amount, 64)
+	lo, err1 := strconv.ParseFloat(min, 64)
+	hi, err2 := strconv.ParseFloat(max, 64)
+	return err == nil && err1 == nil && err2 == nil && v >= lo && v <= hi
+}
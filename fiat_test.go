@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestParseFiatPrice(t *testing.T) {
+	tests := []struct {
+		in   string
+		want FiatPrice
+		ok   bool
+		err  bool
+	}{
+		{"0.001", FiatPrice{}, false, false},
+		{"0.001 USD", FiatPrice{0.001, "usd"}, true, false},
+		{"$0.001", FiatPrice{0.001, "usd"}, true, false},
+		{"0.5 eur", FiatPrice{0.5, "eur"}, true, false},
+		{"0.001 XYZ", FiatPrice{}, true, true},
+		{"-1 USD", FiatPrice{}, true, true},
+		{"$abc", FiatPrice{}, true, true},
+	}
+	for _, tt := range tests {
+		got, ok, err := parseFiatPrice(tt.in)
+		if got != tt.want || ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("parseFiatPrice(%q) = %v, %v, %v", tt.in, got, ok, err)
+		}
+	}
+	if err := validatePrice("0.01 GBP"); err != nil {
+		t.Error(err)
+	}
+	if err := validatePrice("cheap"); err == nil {
+		t.Error("validatePrice accepted a word")
+	}
+
+	if assets, err := parsePaymentAssets(" dai, ETH ,USDC,DAI", "USDC"); err != nil || strings.Join(assets, ",") != "DAI,ETH" {
+		t.Errorf("parsePaymentAssets = %v, %v", assets, err)
+	}
+	if _, err := parsePaymentAssets("DOGE", "USDC"); err == nil {
+		t.Error("parsePaymentAssets accepted DOGE")
+	}
+}
+
+// ethConverter prices in ETH from a stubbed rate feed
+func ethConverter(t *testing.T, fake *clock.Fake, rate *float64, fail *bool, calls *int) *PriceConverter {
+	t.Helper()
+	c, err := NewPriceConverter("ETH", "usd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.clock, c.rate.clock = fake, fake
+	c.assetUSD = func(string) (float64, error) {
+		*calls++
+		if *fail {
+			return 0, errors.New("feeds down")
+		}
+		return *rate, nil
+	}
+	c.usdRate = func(currency string) (float64, error) { return 0.9, nil }
+	return c
+}
+
+func TestPriceConverterRefresh(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	rate, fail, calls := 2000.0, false, 0
+	c := ethConverter(t, fake, &rate, &fail, &calls)
+
+	conv, err := c.Convert(FiatPrice{2, "usd"})
+	if err != nil || conv.Amount != "0.001" || conv.Min != "0.00098" || conv.Max != "0.00102" || conv.USD != 2 {
+		t.Fatalf("Convert = %+v, %v", conv, err)
+	}
+	if conv, _ := c.Convert(FiatPrice{1.8, "eur"}); conv.Amount != "0.001" || conv.USD != 2 {
+		t.Errorf("EUR conversion = %+v", conv)
+	}
+
+	// Within the refresh interval the cached rate is used
+	rate = 4000
+	fake.Advance(30 * time.Second)
+	c.Convert(FiatPrice{2, "usd"})
+	if calls != 1 {
+		t.Errorf("rate fetched %d times within the refresh interval", calls)
+	}
+	fake.Advance(31 * time.Second)
+	if conv, _ := c.Convert(FiatPrice{2, "usd"}); conv.Amount != "0.0005" || calls != 2 {
+		t.Errorf("after refresh: %+v, %d fetches", conv, calls)
+	}
+
+	// A failed refresh falls back to the last rate, and is not retried
+	// until the interval has passed again
+	fail = true
+	fake.Advance(2 * time.Minute)
+	if conv, err := c.Convert(FiatPrice{2, "usd"}); err != nil || conv.Amount != "0.0005" {
+		t.Errorf("stale fallback = %+v, %v", conv, err)
+	}
+	c.Convert(FiatPrice{2, "usd"})
+	if calls != 3 {
+		t.Errorf("failed refresh retried: %d fetches", calls)
+	}
+
+	// A rate older than the max age is never quoted
+	fake.Advance(10 * time.Minute)
+	if _, err := c.Convert(FiatPrice{2, "usd"}); err == nil {
+		t.Error("quoted a rate older than the max age")
+	}
+
+	if _, err := NewPriceConverter("ETH", ""); err == nil {
+		t.Error("ETH prices accepted without a fiat currency")
+	}
+}
+
+func TestFiatPricedPayment(t *testing.T) {
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(epoch)
+	rate, fail, calls := 2000.0, false, 0
+	config := ServiceConfig{Asset: "ETH", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	paywall.SetPricing(ethConverter(t, fake, &rate, &fail, &calls))
+	handler := paywall.Protect("/api/gas", "0.002", 0.002, "test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	serve := func(amount string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		if amount != "" {
+			claims := PaymentToken{}
+			claims.Payment.Amount, claims.Payment.Asset, claims.Payment.Receiver = amount, "ETH", config.Receiver
+			token := signPayment(t, claims)
+			req.Header.Set("X-Payment-Response", token)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	var challenge struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(serve("").Body).Decode(&challenge)
+	if challenge.Payment.MaxAmount != "0.000001" || challenge.Payment.FiatPrice != "0.002 USD" || challenge.Payment.Asset != "ETH" {
+		t.Fatalf("challenge = %+v", challenge.Payment)
+	}
+
+	// The rate moves 1% before the payment arrives
+	rate = 2020
+	fake.Advance(2 * time.Minute)
+	if rr := serve(challenge.Payment.MaxAmount); rr.Code != http.StatusOK {
+		t.Fatalf("payment within tolerance returned %d", rr.Code)
+	}
+	if rr := serve("0.0000005"); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("underpayment returned %d", rr.Code)
+	}
+
+	entries := ledger.Entries(DefaultTenant)
+	if len(entries) != 1 || entries[0].Amount != "0.000001" || entries[0].FiatPrice != "0.002 USD" || entries[0].AmountUSD != 0.002 {
+		t.Errorf("ledger = %+v", entries)
+	}
+
+	// Without a usable rate the challenge cannot be priced
+	fail = true
+	fake.Advance(time.Hour)
+	if rr := serve(""); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("unpriceable challenge returned %d", rr.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// finalityInterval is how often the transfers behind unfinished payments
+// are checked
+const finalityInterval = 30 * time.Second
+
+// Finality check outcomes, the result label of x402_settlement_finality_total
+const (
+	finalityFinal       = "final"       // the transfer reached the finality depth
+	finalityMoved       = "moved"       // a reorg put the transfer in another block
+	finalityReorged     = "reorged"     // a reorg dropped the transfer, or it failed when re-executed
+	finalityUnavailable = "unavailable" // the RPC failed
+)
+
+// Finality follows the transfers behind captured payments until they are
+// depth blocks deep, then marks their ledger entries final. A reorg on the
+// way is published: a transfer that left the chain, or failed when it was
+// re-executed, marks its entry reorged, and one moved to another block is
+// followed from there.
+type Finality struct {
+	ledger  *Ledger
+	events  *EventBus
+	rpcURLs map[string]string // network -> JSON-RPC URL
+	depth   int64
+
+	mu     sync.Mutex
+	blocks map[string]string // entry ID -> hash of the block its transfer was last seen in
+	counts map[string]int64  // outcome -> checks
+}
+
+// NewFinality follows payments on the networks in rpcURLs until their
+// transfers have depth confirmations, counting the block they are in
+func NewFinality(ledger *Ledger, events *EventBus, rpcURLs map[string]string, depth int64) *Finality {
+	return &Finality{
+		ledger:  ledger,
+		events:  events,
+		rpcURLs: rpcURLs,
+		depth:   max(depth, 1),
+		blocks:  make(map[string]string),
+		counts:  make(map[string]int64),
+	}
+}
+
+// Check looks at the transfer of every payment that is not final yet
+func (f *Finality) Check() {
+	heads := make(map[string]*big.Int) // network -> latest block, read once per check
+	for _, tenant := range f.ledger.Tenants() {
+		for _, e := range f.ledger.Entries(tenant) {
+			if e.TxHash == "" || (e.Status != PaymentVerified && e.Status != PaymentSettled) {
+				continue
+			}
+			rpcURL, ok := f.rpcURLs[e.Network]
+			if !ok {
+				continue
+			}
+			if err := f.check(e, rpcURL, heads); err != nil {
+				f.count(finalityUnavailable)
+				log.Printf("⚠️  Finality check of %s (%s on %s) failed: %v", e.ID, e.TxHash, e.Network, err)
+			}
+		}
+	}
+}
+
+func (f *Finality) check(e LedgerEntry, rpcURL string, heads map[string]*big.Int) error {
+	var receipt *txReceipt
+	if err := jsonRPC(rpcURL, "eth_getTransactionReceipt", []interface{}{e.TxHash}, &receipt); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	last, seen := f.blocks[e.ID]
+	f.mu.Unlock()
+
+	switch {
+	case receipt == nil && !seen && e.Status == PaymentSettled:
+		// A facilitator may answer before its transaction is mined
+		return nil
+	case receipt == nil:
+		// Settlement verification saw it confirmed, or this check saw it
+		// mined: it is gone
+		return f.reorged(e, fmt.Sprintf("transaction %s is no longer on %s", e.TxHash, e.Network))
+	case receipt.Status != "0x1":
+		return f.reorged(e, fmt.Sprintf("transaction %s failed when re-executed on %s", e.TxHash, e.Network))
+	}
+
+	if seen && !strings.EqualFold(last, receipt.BlockHash) {
+		f.count(finalityMoved)
+		log.Printf("⛓️  Reorg: payment %s moved to block %s on %s", e.ID, receipt.BlockNumber, e.Network)
+		if err := f.events.Publish(context.Background(), EventPaymentReorged, ReorgedPayment{
+			Entry:  e,
+			Reason: fmt.Sprintf("transaction %s moved to block %s in a reorg on %s", e.TxHash, receipt.BlockNumber, e.Network),
+		}); err != nil {
+			log.Printf("⚠️  Publishing the reorg of %s failed: %v", e.ID, err)
+		}
+	}
+	f.mu.Lock()
+	f.blocks[e.ID] = receipt.BlockHash
+	f.mu.Unlock()
+
+	head, ok := heads[e.Network]
+	if !ok {
+		var latest string
+		if err := jsonRPC(rpcURL, "eth_blockNumber", []interface{}{}, &latest); err != nil {
+			return fmt.Errorf("reading the latest block: %w", err)
+		}
+		n, err := units.ParseHex(latest)
+		if err != nil {
+			return fmt.Errorf("reading the latest block: %w", err)
+		}
+		head, heads[e.Network] = n, n
+	}
+	block, err := units.ParseHex(receipt.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("invalid block number %q", receipt.BlockNumber)
+	}
+	if new(big.Int).Sub(head, block).Int64()+1 < f.depth {
+		return nil
+	}
+	e.Status = PaymentFinal
+	f.forget(e.ID)
+	f.count(finalityFinal)
+	return f.events.Publish(context.Background(), EventPaymentFinalized, FinalizedPayment{Entry: e})
+}
+
+// reorged marks e reorged and publishes it
+func (f *Finality) reorged(e LedgerEntry, reason string) error {
+	e.Status = PaymentReorged
+	f.forget(e.ID)
+	f.count(finalityReorged)
+	log.Printf("🚨 Reorg: payment %s of %s %s by %s is no longer settled: %s", e.ID, e.Amount, e.Asset, e.Payer, reason)
+	return f.events.Publish(context.Background(), EventPaymentReorged, ReorgedPayment{Entry: e, Reason: reason})
+}
+
+func (f *Finality) forget(id string) {
+	f.mu.Lock()
+	delete(f.blocks, id)
+	f.mu.Unlock()
+}
+
+func (f *Finality) count(outcome string) {
+	f.mu.Lock()
+	f.counts[outcome]++
+	f.mu.Unlock()
+}
+
+// WriteMetrics emits finality checks by outcome and the payments followed
+func (f *Finality) WriteMetrics(b *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b.WriteString("# HELP x402_settlement_finality_total Finality checks of settled payments that changed something or failed, by result\n")
+	b.WriteString("# TYPE x402_settlement_finality_total counter\n")
+	for _, outcome := range sortedKeys(f.counts) {
+		fmt.Fprintf(b, "x402_settlement_finality_total{result=%q} %d\n", outcome, f.counts[outcome])
+	}
+	b.WriteString("# HELP x402_settlement_unfinalized Payments whose transfer is mined but not final yet\n")
+	b.WriteString("# TYPE x402_settlement_unfinalized gauge\n")
+	fmt.Fprintf(b, "x402_settlement_unfinalized %d\n", len(f.blocks))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFinality(t *testing.T) {
+	const (
+		kept    = "0x0000000000000000000000000000000000000000000000000000000000000f01"
+		pending = "0x0000000000000000000000000000000000000000000000000000000000000f02"
+		dropped = "0x0000000000000000000000000000000000000000000000000000000000000f03"
+	)
+	var mu sync.Mutex
+	head := "0x11"
+	receipts := map[string]map[string]interface{}{
+		kept:    {"status": "0x1", "blockNumber": "0x10", "blockHash": "0xaa"},
+		dropped: {"status": "0x1", "blockNumber": "0x10", "blockHash": "0xaa"},
+	}
+	rpc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string   `json:"method"`
+			Params []string `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		var result interface{} = head
+		if req.Method == "eth_getTransactionReceipt" {
+			if receipt, ok := receipts[req.Params[0]]; ok {
+				result = receipt
+			} else {
+				result = nil
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+	}))
+	defer rpc.Close()
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(txHash, status string) string {
+		e, err := ledger.Record(LedgerEntry{Endpoint: "/api/gas", Network: "base", Amount: "0.001", Asset: "USDC", TxHash: txHash, Status: status})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e.ID
+	}
+	keptID, pendingID, droppedID := record(kept, PaymentVerified), record(pending, PaymentSettled), record(dropped, PaymentVerified)
+	record("", PaymentVerified)
+	status := func(id string) string {
+		for _, e := range ledger.Entries(DefaultTenant) {
+			if e.ID == id {
+				return e.Status
+			}
+		}
+		return ""
+	}
+
+	bus := NewEventBus()
+	var reorgs []ReorgedPayment
+	bus.Subscribe(EventPaymentFinalized, "ledger", ledger.onPaymentFinalized)
+	bus.Subscribe(EventPaymentReorged, "ledger", ledger.onPaymentReorged)
+	bus.Subscribe(EventPaymentReorged, "test", func(_ context.Context, e Event) error {
+		reorgs = append(reorgs, e.Data.(ReorgedPayment))
+		return nil
+	})
+	finality := NewFinality(ledger, bus, map[string]string{"base": rpc.URL}, 3)
+
+	// Two confirmations of three: nothing is final yet
+	finality.Check()
+	if status(keptID) != PaymentVerified || status(pendingID) != PaymentSettled || status(droppedID) != PaymentVerified {
+		t.Fatalf("ledger = %+v, want nothing final", ledger.Entries(DefaultTenant))
+	}
+
+	// A reorg drops one transfer and moves another to a later block. The
+	// facilitator's transaction is still not mined, which is no reorg.
+	mu.Lock()
+	delete(receipts, dropped)
+	receipts[kept] = map[string]interface{}{"status": "0x1", "blockNumber": "0x12", "blockHash": "0xbb"}
+	head = "0x13"
+	mu.Unlock()
+	finality.Check()
+	if status(droppedID) != PaymentReorged || status(keptID) != PaymentVerified || status(pendingID) != PaymentSettled {
+		t.Fatalf("ledger = %+v, want the dropped payment reorged", ledger.Entries(DefaultTenant))
+	}
+	if len(reorgs) != 2 {
+		t.Fatalf("reorgs = %+v, want the drop and the move", reorgs)
+	}
+	for _, r := range reorgs {
+		switch r.Entry.ID {
+		case droppedID:
+			if r.Entry.Status != PaymentReorged || !strings.Contains(r.Reason, "no longer") {
+				t.Errorf("drop = %+v", r)
+			}
+		case keptID:
+			if r.Entry.Status != PaymentVerified || !strings.Contains(r.Reason, "moved") {
+				t.Errorf("move = %+v", r)
+			}
+		}
+	}
+
+	// Three confirmations in its new block make it final; reorged and
+	// final payments are not followed any further
+	mu.Lock()
+	head = "0x14"
+	mu.Unlock()
+	finality.Check()
+	finality.Check()
+	if status(keptID) != PaymentFinal || status(droppedID) != PaymentReorged || len(reorgs) != 2 {
+		t.Errorf("ledger = %+v, reorgs = %d", ledger.Entries(DefaultTenant), len(reorgs))
+	}
+
+	var b strings.Builder
+	finality.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_settlement_finality_total{result="final"} 1`,
+		`x402_settlement_finality_total{result="moved"} 1`,
+		`x402_settlement_finality_total{result="reorged"} 1`,
+		"x402_settlement_unfinalized 0",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Flag names an experimental feature that can be switched per deployment
+type Flag string
+
+// Known feature flags. All default to off.
+const (
+	FlagExactScheme         Flag = "exact_scheme"          // EIP-712 signed payment payloads
+	FlagSemanticPromptGuard Flag = "semantic_prompt_guard" // embedding-based prompt injection checks
+	FlagDynamicPricing      Flag = "dynamic_pricing"       // load- and demand-based prices
+	FlagChallengeNonces     Flag = "challenge_nonces"      // payments must echo a 402 challenge nonce
+)
+
+var knownFlags = map[Flag]string{
+	FlagExactScheme:         "Accept the x402 \"exact\" scheme (EIP-712 signed payloads)",
+	FlagSemanticPromptGuard: "Semantic prompt injection detection in /api/prompt-test",
+	FlagDynamicPricing:      "Adjust endpoint prices with load and demand",
+	FlagChallengeNonces:     "Require payments to echo the nonce of a recent 402 challenge",
+}
+
+// Flag sources, lowest precedence first
+const (
+	flagSourceDefault = "default"
+	flagSourceEnv     = "env"
+	flagSourceConfig  = "config"
+	flagSourceAdmin   = "admin"
+)
+
+// FlagState is a flag's effective value and where it came from
+type FlagState struct {
+	Enabled     bool   `json:"enabled"`
+	Source      string `json:"source"`
+	Description string `json:"description"`
+}
+
+// FeatureFlags resolves flags from FEATURE_FLAGS, the "flags" section of the
+// runtime config and admin API overrides, in increasing precedence. Admin
+// overrides live in memory and are lost on restart.
+type FeatureFlags struct {
+	mu        sync.RWMutex
+	env       map[Flag]bool
+	overrides map[Flag]bool
+}
+
+// NewFeatureFlags creates a flag set with every flag at its default
+func NewFeatureFlags() *FeatureFlags {
+	return &FeatureFlags{
+		env:       make(map[Flag]bool),
+		overrides: make(map[Flag]bool),
+	}
+}
+
+// ParseEnv reads a FEATURE_FLAGS value such as "exact_scheme,dynamic_pricing=false"
+func (f *FeatureFlags) ParseEnv(s string) error {
+	env := make(map[Flag]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(item, "=")
+		enabled := true
+		if hasValue {
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("flag %s: invalid value %q", name, value)
+			}
+			enabled = v
+		}
+		if err := validateFlag(name); err != nil {
+			return err
+		}
+		env[Flag(name)] = enabled
+	}
+
+	f.mu.Lock()
+	f.env = env
+	f.mu.Unlock()
+	return nil
+}
+
+func validateFlag(name string) error {
+	if _, ok := knownFlags[Flag(name)]; !ok {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	return nil
+}
+
+// Enabled reports whether flag is on
+func (f *FeatureFlags) Enabled(flag Flag) bool {
+	return f.state(flag, runtimeConfig.Current()).Enabled
+}
+
+func (f *FeatureFlags) state(flag Flag, cfg *RuntimeConfig) FlagState {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	state := FlagState{Source: flagSourceDefault, Description: knownFlags[flag]}
+	if v, ok := f.env[flag]; ok {
+		state.Enabled, state.Source = v, flagSourceEnv
+	}
+	if v, ok := cfg.Flags[string(flag)]; ok {
+		state.Enabled, state.Source = v, flagSourceConfig
+	}
+	if v, ok := f.overrides[flag]; ok {
+		state.Enabled, state.Source = v, flagSourceAdmin
+	}
+	return state
+}
+
+// Snapshot returns the state of every known flag
+func (f *FeatureFlags) Snapshot() map[string]FlagState {
+	cfg := runtimeConfig.Current()
+	out := make(map[string]FlagState, len(knownFlags))
+	for flag := range knownFlags {
+		out[string(flag)] = f.state(flag, cfg)
+	}
+	return out
+}
+
+// EnabledSet returns the names of the flags that are on, sorted
+func (f *FeatureFlags) EnabledSet() []string {
+	names := []string{}
+	for name, state := range f.Snapshot() {
+		if state.Enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Override sets an admin override for flag
+func (f *FeatureFlags) Override(flag Flag, enabled bool) {
+	f.mu.Lock()
+	f.overrides[flag] = enabled
+	f.mu.Unlock()
+}
+
+// ClearOverride removes the admin override for flag
+func (f *FeatureFlags) ClearOverride(flag Flag) {
+	f.mu.Lock()
+	delete(f.overrides, flag)
+	f.mu.Unlock()
+}
+
+// handleAdminFlags serves /admin/flags. GET lists the flags, POST
+// {"flag":"...","enabled":true} overrides one and DELETE ?flag=... clears
+// the override.
+func (f *FeatureFlags) handleAdminFlags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Flag    string `json:"flag"`
+			Enabled *bool  `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+			http.Error(w, `{"error":"Body must be {\"flag\":\"...\",\"enabled\":true|false}"}`, http.StatusBadRequest)
+			return
+		}
+		if err := validateFlag(req.Flag); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		f.Override(Flag(req.Flag), *req.Enabled)
+	case http.MethodDelete:
+		name := r.URL.Query().Get("flag")
+		if err := validateFlag(name); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		f.ClearOverride(Flag(name))
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f.Snapshot())
+}
+
+// WriteMetrics writes the x402_feature_flag gauge
+func (f *FeatureFlags) WriteMetrics(b *strings.Builder) {
+	snapshot := f.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("# HELP x402_feature_flag Whether a feature flag is enabled (1) or not (0)\n")
+	b.WriteString("# TYPE x402_feature_flag gauge\n")
+	for _, name := range names {
+		v := 0
+		if snapshot[name].Enabled {
+			v = 1
+		}
+		fmt.Fprintf(b, "x402_feature_flag{flag=%q,source=%q} %d\n", name, snapshot[name].Source, v)
+	}
+}
+
+// featureFlags is the process-wide flag set. main loads FEATURE_FLAGS into it.
+var featureFlags = NewFeatureFlags()
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFeatureFlagPrecedence(t *testing.T) {
+	flags := NewFeatureFlags()
+	if flags.Enabled(FlagDynamicPricing) {
+		t.Fatal("flags should default to off")
+	}
+
+	if err := flags.ParseEnv("dynamic_pricing, exact_scheme=false"); err != nil {
+		t.Fatal(err)
+	}
+	if !flags.Enabled(FlagDynamicPricing) || flags.Enabled(FlagExactScheme) {
+		t.Errorf("env flags not applied: %+v", flags.Snapshot())
+	}
+	if err := flags.ParseEnv("no_such_flag"); err == nil {
+		t.Error("unknown flag accepted")
+	}
+
+	flags.Override(FlagDynamicPricing, false)
+	if s := flags.Snapshot()[string(FlagDynamicPricing)]; s.Enabled || s.Source != flagSourceAdmin {
+		t.Errorf("admin override not applied: %+v", s)
+	}
+	flags.ClearOverride(FlagDynamicPricing)
+	if !flags.Enabled(FlagDynamicPricing) {
+		t.Error("clearing the override should fall back to env")
+	}
+
+	if _, err := parseRuntimeConfig([]byte(`{"flags":{"bogus":true}}`)); err == nil {
+		t.Error("config with unknown flag accepted")
+	}
+}
+
+func TestAdminFlags(t *testing.T) {
+	flags := NewFeatureFlags()
+
+	req := httptest.NewRequest("POST", "/admin/flags", strings.NewReader(`{"flag":"exact_scheme","enabled":true}`))
+	rr := httptest.NewRecorder()
+	flags.handleAdminFlags(rr, req)
+	if rr.Code != http.StatusOK || !flags.Enabled(FlagExactScheme) {
+		t.Fatalf("override failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	var b strings.Builder
+	flags.WriteMetrics(&b)
+	if !strings.Contains(b.String(), `x402_feature_flag{flag="exact_scheme",source="admin"} 1`) {
+		t.Errorf("unexpected metrics:\n%s", b.String())
+	}
+}
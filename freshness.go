@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+const stalenessLimitContextKey contextKey = "x402.staleness-limit"
+
+// withStalenessLimit declares the oldest data an endpoint may serve, which
+// is reported as staleness_limit_seconds in its responses. Endpoints without
+// a limit always serve live data.
+func withStalenessLimit(limit time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), stalenessLimitContextKey, limit)))
+	}
+}
+
+// responseMeta describes how fresh data is. Data endpoints report their
+// quality through the embedded DataQuality and cached scans through their
+// scan time; everything else was generated for this request.
+func responseMeta(ctx context.Context, data interface{}) types.ResponseMeta {
+	now := time.Now().Unix()
+	limit, _ := ctx.Value(stalenessLimitContextKey).(time.Duration)
+	meta := types.ResponseMeta{
+		GeneratedAt:           now,
+		Source:                types.QualityLive,
+		StalenessLimitSeconds: int64(limit.Seconds()),
+	}
+	switch d := data.(type) {
+	case interface{ Freshness() types.DataQuality }:
+		q := d.Freshness()
+		if q.Quality != "" {
+			meta.Source = q.Quality
+		}
+		meta.CacheAgeSeconds = q.StalenessSeconds
+		meta.GeneratedAt = now - q.StalenessSeconds
+	case *ContractScanResult:
+		if d.Cached {
+			meta.Source = types.QualityCached
+			meta.GeneratedAt = d.ScannedAt
+			meta.CacheAgeSeconds = now - d.ScannedAt
+		}
+	}
+	return meta
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+func TestResponseMeta(t *testing.T) {
+	srv, up := startService(t, map[string]string{"MAX_STALENESS_SEC": "120"})
+	meta := func(path string) (types.ResponseMeta, string) {
+		t.Helper()
+		resp := paidRequest(t, srv, "GET", path, "")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s returned %d", path, resp.StatusCode)
+		}
+		var body struct {
+			Meta types.ResponseMeta `json:"meta"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body.Meta, resp.Header.Get("Age")
+	}
+
+	live, age := meta("/api/gas")
+	if live.Source != types.QualityLive || live.CacheAgeSeconds != 0 || live.StalenessLimitSeconds != 120 || live.GeneratedAt == 0 || age != "0" {
+		t.Errorf("live gas meta = %+v, Age %s", live, age)
+	}
+
+	// The last good value is re-served within the endpoint's limit
+	up.Fail(testhttp.RPC, true)
+	if stale, _ := meta("/api/gas"); stale.Source != types.QualityStale || stale.GeneratedAt > live.GeneratedAt || stale.StalenessLimitSeconds != 120 {
+		t.Errorf("stale gas meta = %+v", stale)
+	}
+}
+
+func TestResponseMetaCachedScan(t *testing.T) {
+	// Endpoints without a limit only serve live data
+	if meta := responseMeta(context.Background(), &ContractScanResult{ScannedAt: 1700000000}); meta.Source != types.QualityLive || meta.StalenessLimitSeconds != 0 || meta.CacheAgeSeconds != 0 {
+		t.Errorf("fresh scan meta = %+v", meta)
+	}
+
+	scanned := &ContractScanResult{Cached: true, ScannedAt: 1700000000}
+	meta := responseMeta(context.Background(), scanned)
+	if meta.Source != types.QualityCached || meta.GeneratedAt != 1700000000 || meta.CacheAgeSeconds <= 0 {
+		t.Errorf("cached scan meta = %+v", meta)
+	}
+}
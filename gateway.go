@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/trace"
+)
+
+// GatewayRoute puts the paywall in front of an upstream API that knows
+// nothing about x402. It is mounted at /gw/{name}/.
+type GatewayRoute struct {
+	Name        string          `json:"name"`
+	Upstream    string          `json:"upstream"` // e.g. "http://internal-api:3000/v1"
+	Price       string          `json:"price"`
+	Description string          `json:"description,omitempty"`
+	Methods     []string        `json:"methods,omitempty"` // default: any
+	RateLimit   *GatewayLimiter `json:"rate_limit,omitempty"`
+}
+
+// GatewayLimiter caps requests per payer on a gateway route
+type GatewayLimiter struct {
+	PerMinute int `json:"per_minute"`
+	Burst     int `json:"burst"`
+}
+
+func (g *GatewayRoute) validate() error {
+	if g.Name == "" || strings.ContainsAny(g.Name, "/ ") {
+		return fmt.Errorf("invalid gateway name %q", g.Name)
+	}
+	u, err := url.Parse(g.Upstream)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("gateway %s: invalid upstream %q", g.Name, g.Upstream)
+	}
+	if err := validatePrice(g.Price); err != nil {
+		return fmt.Errorf("gateway %s: %w", g.Name, err)
+	}
+	if g.RateLimit != nil && g.RateLimit.PerMinute < 1 {
+		return fmt.Errorf("gateway %s: rate_limit.per_minute must be positive", g.Name)
+	}
+	return nil
+}
+
+// allowed is the route's Allow set. HEAD is answered with the price and
+// never proxied.
+func (g *GatewayRoute) allowed() []string {
+	if len(g.Methods) == 0 {
+		return allowSet(anyMethod)
+	}
+	return allowSet(g.Methods)
+}
+
+func (g *GatewayRoute) allowsMethod(method string) bool {
+	return slices.Contains(g.allowed(), method)
+}
+
+// Gateway serves /gw/{name}/... by proxying paid requests to the route's
+// upstream. Routes come from the runtime config and change on reload.
+type Gateway struct {
+	paywall *Paywall
+	metrics *Metrics
+	paid    http.HandlerFunc // the paywall in front of serveUpstream
+
+	mu       sync.Mutex
+	proxies  map[string]*httputil.ReverseProxy // upstream URL -> proxy
+	limiters map[string]gatewayLimiterState    // route name -> limiter
+}
+
+type gatewayLimiterState struct {
+	settings GatewayLimiter
+	limiter  ratelimit.Limiter
+}
+
+// gatewayCall is the route a gateway request was matched to
+type gatewayCall struct {
+	route *GatewayRoute
+	paid  paidRoute
+	path  string // upstream path
+}
+
+type gatewayCallKey struct{}
+
+// NewGateway creates a gateway charging through paywall. Its routes are
+// listed in /api/pricing from each config snapshot.
+func NewGateway(paywall *Paywall, metrics *Metrics) *Gateway {
+	g := &Gateway{
+		paywall:  paywall,
+		metrics:  metrics,
+		proxies:  make(map[string]*httputil.ReverseProxy),
+		limiters: make(map[string]gatewayLimiterState),
+	}
+	g.paid = paywall.protectPriced(func(r *http.Request) paidRoute {
+		return r.Context().Value(gatewayCallKey{}).(*gatewayCall).paid
+	}, g.serveUpstream)
+	runtimeConfig.OnReload(g.register)
+	return g
+}
+
+// register lists the gateway routes of cfg in place of the previous
+// snapshot's. A route whose price cannot be converted now is left out of
+// the listing, and is priced again on each request.
+func (g *Gateway) register(cfg *RuntimeConfig) {
+	routes := make([]paidRoute, 0, len(cfg.Gateways))
+	for i := range cfg.Gateways {
+		route, err := g.paidRoute(&cfg.Gateways[i])
+		if err != nil {
+			log.Printf("⚠️  Pricing gateway %s failed: %v", cfg.Gateways[i].Name, err)
+			continue
+		}
+		routes = append(routes, route)
+	}
+	g.paywall.replaceRoutes("/gw/", routes)
+}
+
+// paidRoute is route as the paywall charges for it
+func (g *Gateway) paidRoute(route *GatewayRoute) (paidRoute, error) {
+	priceUSD, err := g.paywall.priceUSD(route.Price)
+	if err != nil {
+		return paidRoute{}, err
+	}
+	description := route.Description
+	if description == "" {
+		description = "Proxied API " + route.Name
+	}
+	return paidRoute{endpoint: "/gw/" + route.Name, price: route.Price, priceUSD: priceUSD, description: description}, nil
+}
+
+// ServeHTTP implements http.Handler
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/gw/")
+	name, path, _ := strings.Cut(rest, "/")
+	route, ok := runtimeConfig.Current().Gateway(name)
+	if !ok {
+		http.Error(w, `{"error":"Unknown gateway route"}`, http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", strings.Join(route.allowed(), ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !route.allowsMethod(r.Method) {
+		w.Header().Set("Allow", strings.Join(route.allowed(), ", "))
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Fiat prices are converted at the current rate
+	paid, err := g.paidRoute(route)
+	if err != nil {
+		log.Printf("❌ Pricing gateway %s failed: %v", route.Name, err)
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, `{"error":"Pricing unavailable, try again shortly"}`, http.StatusServiceUnavailable)
+		g.metrics.RecordRequest("/gw/"+route.Name, "503")
+		return
+	}
+	call := &gatewayCall{route: route, paid: paid, path: "/" + path}
+	g.paid(w, r.WithContext(context.WithValue(r.Context(), gatewayCallKey{}, call)))
+}
+
+// serveUpstream proxies a paid gateway request
+func (g *Gateway) serveUpstream(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	call := r.Context().Value(gatewayCallKey{}).(*gatewayCall)
+	endpoint := call.paid.endpoint
+	c := chargeFromContext(r.Context())
+	payer, _ := PayerFromContext(r.Context())
+
+	if limiter := g.limiter(call.route); limiter != nil {
+		st := limiter.Take(payer.String())
+		ratelimit.SetHeaders(w, st)
+		if !st.Allowed {
+			c.refuse()
+			http.Error(w, `{"error":"Rate limit exceeded, payment not captured"}`, http.StatusTooManyRequests)
+			g.metrics.RecordRequest(endpoint, "429")
+			return
+		}
+	}
+
+	// Upstream failures are not charged
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK, charge: c}
+	g.proxy(call.route.Upstream).ServeHTTP(rec, proxyRequest(r, call.path, payer))
+	g.metrics.RecordRequest(endpoint, strconv.Itoa(rec.status))
+	g.metrics.RecordResponseTime(endpoint, time.Since(start))
+}
+
+// proxyRequest prepares r for the upstream: the gateway prefix is removed,
+// the payer's credentials are not forwarded and the payer is passed along
+// instead. A payment, coupon, request signature or debit ID reaching a
+// third party could be spent by it.
+// X-Sandbox tells the upstream the request was paid with a test token, and
+// traceparent lets it continue the payment's trace.
+func proxyRequest(r *http.Request, path string, payer Payer) *http.Request {
+	out := r.Clone(r.Context())
+	out.URL.Path = path
+	out.URL.RawPath = ""
+	for _, credential := range []string{"X-Payment-Response", "X-Payment", "X-Coupon", reqsig.Header, reqsig.DebitHeader} {
+		out.Header.Del(credential)
+	}
+	out.Header.Set("X-Payer", payer.String())
+	out.Header.Del("X-Sandbox")
+	if IsSandbox(r.Context()) {
+		out.Header.Set("X-Sandbox", "true")
+	}
+	trace.Inject(out)
+	return out
+}
+
+func (g *Gateway) proxy(upstream string) *httputil.ReverseProxy {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if p, ok := g.proxies[upstream]; ok {
+		return p
+	}
+	target, _ := url.Parse(upstream) // validated on config load
+	p := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("❌ Gateway upstream %s: %v", target.Host, err)
+			http.Error(w, `{"error":"Upstream unavailable"}`, http.StatusBadGateway)
+		},
+	}
+	g.proxies[upstream] = p
+	return p
+}
+
+// limiter returns the route's rate limiter, replacing it if the route's
+// settings changed on reload
+func (g *Gateway) limiter(route *GatewayRoute) ratelimit.Limiter {
+	if route.RateLimit == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	state, ok := g.limiters[route.Name]
+	if !ok || state.settings != *route.RateLimit {
+		state = gatewayLimiterState{settings: *route.RateLimit}
+		state.limiter = newRateLimit("gw:"+route.Name, route.RateLimit.PerMinute, route.RateLimit.Burst)
+		g.limiters[route.Name] = state
+	}
+	return state.limiter
+}
+
+// statusRecorder remembers the status code written through it. A server
+// error refuses the charge before the headers, and with them the payment
+// receipt, go out.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	charge *charge
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	if status >= 500 {
+		s.charge.refuse()
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streamed upstream responses through
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/respsig"
+)
+
+func TestGatewayProxiesPaidRequests(t *testing.T) {
+	var gotPath, gotPayer, gotToken, gotTrace string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotPayer, gotToken = r.URL.Path, r.Header.Get("X-Payer"), r.Header.Get("X-Payment-Response")
+		gotTrace = r.Header.Get("traceparent")
+		if r.URL.Path == "/v1/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer upstream.Close()
+
+	cfg, err := parseRuntimeConfig([]byte(`{"gateways": [{"name": "internal", "upstream": "` + upstream.URL + `/v1", "price": "0.002", "rate_limit": {"per_minute": 1, "burst": 2}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	metrics := NewMetrics()
+	gateway := NewGateway(NewPaywall(config, metrics, nil), metrics)
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.002"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = config.Receiver
+	claims.Subject = "0xabc0000000000000000000000000000000000001"
+	var traceID string
+	call := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Payment-Response", signPayment(t, claims))
+		rr := httptest.NewRecorder()
+		gateway.ServeHTTP(rr, req)
+		traceID = rr.Header().Get("X-Trace-Id")
+		return rr.Code
+	}
+
+	if code := call("/gw/internal/items"); code != http.StatusOK {
+		t.Fatalf("paid request returned %d", code)
+	}
+	if gotPath != "/v1/items" || gotPayer != claims.Subject || gotToken != "" {
+		t.Errorf("upstream saw path=%q payer=%q token=%q", gotPath, gotPayer, gotToken)
+	}
+	if !strings.HasPrefix(gotTrace, "00-"+traceID+"-") {
+		t.Errorf("upstream traceparent %q does not continue trace %s", gotTrace, traceID)
+	}
+	if metrics.paymentsTotal != 1 {
+		t.Errorf("payments = %d, want 1", metrics.paymentsTotal)
+	}
+
+	// Upstream errors are not charged
+	if code := call("/gw/internal/fail"); code != http.StatusInternalServerError {
+		t.Errorf("failing upstream returned %d", code)
+	}
+	if metrics.paymentsTotal != 1 {
+		t.Errorf("upstream failure was charged")
+	}
+
+	// Burst of 2 is used up
+	if code := call("/gw/internal/items"); code != http.StatusTooManyRequests {
+		t.Errorf("rate limited request returned %d, want 429", code)
+	}
+
+	rr := httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest("GET", "/gw/unknown/x", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown route returned %d", rr.Code)
+	}
+}
+
+func TestGatewayUpstreamFailureHasNoReceipt(t *testing.T) {
+	key, err := respsig.ParsePrivateKey(strings.Repeat("03", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousSigner := responseSigner
+	responseSigner = NewResponseSigner(key)
+	defer func() { responseSigner = previousSigner }()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer upstream.Close()
+	cfg, err := parseRuntimeConfig([]byte(`{"gateways": [{"name": "receipts", "upstream": "` + upstream.URL + `", "price": "0.002"}, {"name": "down", "upstream": "http://127.0.0.1:1", "price": "0.002"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	metrics := NewMetrics()
+	gateway := NewGateway(NewPaywall(config, metrics, nil), metrics)
+	call := func(path string) *httptest.ResponseRecorder {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.002"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Receiver = config.Receiver
+		claims.Subject = "0xabc0000000000000000000000000000000000002"
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Payment-Response", signPayment(t, claims))
+		rr := httptest.NewRecorder()
+		gateway.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := call("/gw/receipts/ok"); rr.Code != http.StatusOK || rr.Header().Get(respsig.HeaderReceipt) == "" {
+		t.Fatalf("paid request returned %d without a receipt", rr.Code)
+	}
+	// Neither an upstream 500 nor the proxy's own 502 is receipted
+	for path, want := range map[string]int{"/gw/receipts/fail": http.StatusInternalServerError, "/gw/down/x": http.StatusBadGateway} {
+		rr := call(path)
+		if rr.Code != want || rr.Header().Get(respsig.HeaderReceipt) != "" {
+			t.Errorf("%s returned %d with receipt %q", path, rr.Code, rr.Header().Get(respsig.HeaderReceipt))
+		}
+	}
+	if metrics.paymentsTotal != 1 {
+		t.Errorf("payments = %d, want 1", metrics.paymentsTotal)
+	}
+}
+
+func TestGatewayFiatPrice(t *testing.T) {
+	for _, price := range []string{"abc", "0.01 USDC", "-1"} {
+		if _, err := parseRuntimeConfig([]byte(`{"gateways": [{"name": "bad", "upstream": "http://internal:3000", "price": "` + price + `"}]}`)); err == nil {
+			t.Errorf("gateway price %q accepted", price)
+		}
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer upstream.Close()
+	cfg, err := parseRuntimeConfig([]byte(`{"gateways": [{"name": "fiat", "upstream": "` + upstream.URL + `", "price": "0.01 USD"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	metrics := NewMetrics()
+	paywall := NewPaywall(config, metrics, nil)
+	pricing, err := NewPriceConverter("USDC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paywall.SetPricing(pricing)
+	gateway := NewGateway(paywall, metrics)
+
+	rr := httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest("GET", "/gw/fiat/x", nil))
+	if rr.Code != http.StatusPaymentRequired {
+		t.Fatalf("unpaid request returned %d", rr.Code)
+	}
+	priced := false
+	for _, route := range paywall.routes.list() {
+		if route.endpoint == "/gw/fiat" {
+			priced = route.priceUSD == 0.01
+		}
+	}
+	if !priced {
+		t.Errorf("gateway not priced at 0.01 USD: %+v", paywall.routes.list())
+	}
+}
+
+func TestGatewayRoutesFollowReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(name string) {
+		data := `{"gateways": [{"name": "` + name + `", "upstream": "http://upstream.internal", "price": "0.004"}]}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous := runtimeConfig.Current()
+	defer runtimeConfig.current.Store(previous)
+	runtimeConfig.SetPath(path)
+	defer runtimeConfig.SetPath("")
+	write("first")
+	if err := runtimeConfig.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	metrics := NewMetrics()
+	paywall := NewPaywall(config, metrics, nil)
+	paywall.ProtectRoute("/api/gas", func(w http.ResponseWriter, r *http.Request) {})
+	NewGateway(paywall, metrics)
+	listed := func() string {
+		var endpoints []string
+		for _, route := range paywall.routes.list() {
+			endpoints = append(endpoints, route.endpoint)
+		}
+		return strings.Join(endpoints, " ")
+	}
+	// Listed before any request reaches it
+	if got := listed(); got != "/api/gas /gw/first" {
+		t.Errorf("routes = %s, want /api/gas /gw/first", got)
+	}
+
+	write("second")
+	if err := runtimeConfig.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := listed(); got != "/api/gas /gw/second" {
+		t.Errorf("routes after reload = %s, want /api/gas /gw/second", got)
+	}
+}
+
+func TestProxyRequestDropsCredentials(t *testing.T) {
+	r := httptest.NewRequest("POST", "/gw/internal/items", nil)
+	for _, h := range []string{"X-Payment-Response", "X-Payment", "X-Coupon", reqsig.Header, reqsig.DebitHeader} {
+		r.Header.Set(h, "secret")
+	}
+	r.Header.Set("Accept", "application/json")
+	out := proxyRequest(r, "/items", Payer{Address: "0xabc0000000000000000000000000000000000001"})
+	for name := range out.Header {
+		if out.Header.Get(name) == "secret" {
+			t.Errorf("%s forwarded to the upstream", name)
+		}
+	}
+	if out.Header.Get("Accept") != "application/json" || out.Header.Get("X-Payer") == "" {
+		t.Errorf("upstream headers = %v", out.Header)
+	}
+}
@@ -2,4 +2,20 @@ module github.com/arithmosquillsworth/x402-service
 
 go 1.23
 
-require github.com/golang-jwt/jwt/v5 v5.3.1
+require (
+	github.com/golang-jwt/jwt/v5 v5.3.1
+	github.com/graphql-go/graphql v0.8.1
+	google.golang.org/grpc v1.67.3
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+)
+
+require (
+	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.28.0 // indirect
+)
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// graphqlFieldPrices maps each paid root field to the REST endpoint whose
+// price (including runtime and tenant overrides) it costs
+var graphqlFieldPrices = map[string]paidRoute{
+	"gas":           routeFor("/api/gas"),
+	"price":         routeFor("/api/price"),
+	"validators":    routeFor("/api/validators"),
+	"scan_contract": routeFor("/api/scan-contract"),
+}
+
+// GraphQL serves /graphql. A query costs the sum of the prices of the paid
+// root fields it selects, and only fields that resolve are charged.
+type GraphQL struct {
+	paywall *Paywall
+	metrics *Metrics
+	schema  graphql.Schema
+	paid    http.HandlerFunc // the paywall in front of executePaid
+
+	mu    sync.Mutex
+	stats map[string]*graphqlFieldStats // root field -> accounting
+}
+
+type graphqlFieldStats struct {
+	requests   int64
+	revenueUSD float64
+}
+
+// queryCost tracks what a single query owes per root field
+type queryCost struct {
+	mu       sync.Mutex
+	prices   map[string]float64 // root field -> USD per selection
+	resolved map[string]float64 // root field -> USD actually earned
+}
+
+func (c *queryCost) total() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sum := 0.0
+	for _, usd := range c.resolved {
+		sum += usd
+	}
+	return sum
+}
+
+type queryCostKey struct{}
+
+// NewGraphQL builds the schema on top of the same data sources as REST
+func NewGraphQL(paywall *Paywall, metrics *Metrics, gas GasProvider, scanner *ContractScanner) (*GraphQL, error) {
+	g := &GraphQL{paywall: paywall, metrics: metrics, stats: make(map[string]*graphqlFieldStats)}
+
+	// Field names follow the REST JSON keys, so the default resolver reads
+	// most of them straight from the shared types' json tags
+	qualityType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DataQuality",
+		Fields: graphql.Fields{
+			"quality":           &graphql.Field{Type: graphql.String},
+			"staleness_seconds": &graphql.Field{Type: graphql.Int},
+		},
+	})
+	quality := &graphql.Field{Type: qualityType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		switch v := p.Source.(type) {
+		case *GasData:
+			return v.DataQuality, nil
+		case *PriceData:
+			return v.DataQuality, nil
+		case *ValidatorData:
+			return v.DataQuality, nil
+		}
+		return nil, nil
+	}}
+	computed := func(t graphql.Output, get func(src interface{}) interface{}) *graphql.Field {
+		return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source), nil
+		}}
+	}
+	gasLevel := func(level string) *graphql.Field {
+		return computed(graphql.Float, func(src interface{}) interface{} {
+			if v, ok := src.(*GasData).Gas[level]; ok {
+				return v
+			}
+			return nil
+		})
+	}
+
+	gasType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Gas",
+		Fields: graphql.Fields{
+			"timestamp":    &graphql.Field{Type: graphql.Int},
+			"unit":         &graphql.Field{Type: graphql.String},
+			"source":       &graphql.Field{Type: graphql.String},
+			"current":      gasLevel("current"),
+			"safe":         gasLevel("safe"),
+			"average":      gasLevel("average"),
+			"fast":         gasLevel("fast"),
+			"data_quality": quality,
+		},
+	})
+
+	priceSourceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PriceSource",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.String},
+			"usd":  &graphql.Field{Type: graphql.Float},
+		},
+	})
+	priceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Price",
+		Fields: graphql.Fields{
+			"timestamp":          &graphql.Field{Type: graphql.Int},
+			"eth_usd":            &graphql.Field{Type: graphql.Float},
+			"average_usd":        &graphql.Field{Type: graphql.Float},
+			"change_24h_percent": &graphql.Field{Type: graphql.Float},
+			"sources": computed(graphql.NewList(priceSourceType), func(src interface{}) interface{} {
+				sources := src.(*PriceData).Sources
+				names := make([]string, 0, len(sources))
+				for name := range sources {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				out := make([]map[string]interface{}, 0, len(names))
+				for _, name := range names {
+					out = append(out, map[string]interface{}{"name": name, "usd": sources[name]})
+				}
+				return out
+			}),
+			"data_quality": quality,
+		},
+	})
+
+	validatorsType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Validators",
+		Fields: graphql.Fields{
+			"timestamp":         &graphql.Field{Type: graphql.Int},
+			"active_validators": &graphql.Field{Type: graphql.Int},
+			"pending_deposits":  &graphql.Field{Type: graphql.Int},
+			"entry_wait_hours": computed(graphql.Float, func(src interface{}) interface{} {
+				return src.(*ValidatorData).Queue["entry_wait_hours"]
+			}),
+			"exit_wait_hours": computed(graphql.Float, func(src interface{}) interface{} {
+				return src.(*ValidatorData).Queue["exit_wait_hours"]
+			}),
+			"data_quality": quality,
+		},
+	})
+
+	scanType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ContractScan",
+		Fields: graphql.Fields{
+			"address":     &graphql.Field{Type: graphql.String},
+			"chain":       &graphql.Field{Type: graphql.String},
+			"risk_score":  &graphql.Field{Type: graphql.Int},
+			"is_verified": &graphql.Field{Type: graphql.Boolean},
+			"is_proxy":    &graphql.Field{Type: graphql.Boolean},
+			"is_honeypot": &graphql.Field{Type: graphql.Boolean},
+			"flags":       &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"warnings":    &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"cached":      &graphql.Field{Type: graphql.Boolean},
+			"scanned_at":  &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"gas": &graphql.Field{Type: gasType, Resolve: paidField("gas", func(p graphql.ResolveParams) (interface{}, error) {
+				return gas.GasPrices()
+			})},
+			"price": &graphql.Field{Type: priceType, Resolve: paidField("price", func(p graphql.ResolveParams) (interface{}, error) {
+				return providers.Price.ETHPrice()
+			})},
+			"validators": &graphql.Field{Type: validatorsType, Resolve: paidField("validators", func(p graphql.ResolveParams) (interface{}, error) {
+				return providers.Beacon.ValidatorData()
+			})},
+			"scan_contract": &graphql.Field{
+				Type: scanType,
+				Args: graphql.FieldConfigArgument{
+					"address": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"chain":   &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "base"},
+				},
+				Resolve: paidField("scan_contract", func(p graphql.ResolveParams) (interface{}, error) {
+					addr, _ := p.Args["address"].(string)
+					chain, _ := p.Args["chain"].(string)
+					if err := address.Validate(addr); err != nil {
+						return nil, fmt.Errorf("invalid address: %v", err)
+					}
+					if _, ok := runtimeConfig.Current().Chain(chain); !ok {
+						return nil, fmt.Errorf("invalid chain - use %s", runtimeConfig.Current().ChainNames())
+					}
+					result, err := scanner.Scan(addr, chain)
+					if err != nil {
+						return nil, err
+					}
+					events.Publish(p.Context, EventScanCompleted, ScanCompleted{Kind: "contract", Chain: chain, Address: addr, Result: result})
+					return result, nil
+				}),
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		return nil, err
+	}
+	g.schema = schema
+
+	// A query is priced by the fields it selects, so /graphql has no one
+	// price to list or rank by
+	paywall.shedder.RegisterDynamic("/graphql")
+	g.paid = paywall.protectPriced(func(r *http.Request) paidRoute {
+		q := r.Context().Value(graphqlQueryKey{}).(*graphqlQuery)
+		price := strconv.FormatFloat(q.totalUSD, 'f', -1, 64)
+		// The total is in USD whatever the payment asset
+		return paidRoute{endpoint: "/graphql", price: price + " USD", priceUSD: q.totalUSD, description: "GraphQL query"}
+	}, g.executePaid)
+	return g, nil
+}
+
+// paidField credits the field's price to the query once it resolves
+// without error
+func paidField(name string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		v, err := resolve(p)
+		if err != nil {
+			return nil, err
+		}
+		if cost, ok := p.Context.Value(queryCostKey{}).(*queryCost); ok {
+			cost.mu.Lock()
+			cost.resolved[name] += cost.prices[name]
+			cost.mu.Unlock()
+		}
+		return v, nil
+	}
+}
+
+// graphqlQuery is a priced query on its way through the paywall
+type graphqlQuery struct {
+	req      graphqlRequest
+	cost     *queryCost
+	totalUSD float64
+	start    time.Time
+}
+
+type graphqlQueryKey struct{}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// ServeHTTP implements http.Handler
+func (g *GraphQL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+			writeGraphQLError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	selected, err := rootFieldCounts(req.Query, req.OperationName)
+	if err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Price each selected root field at its REST endpoint's current price
+	cost := &queryCost{prices: make(map[string]float64), resolved: make(map[string]float64)}
+	totalUSD := 0.0
+	for field, count := range selected {
+		product, ok := graphqlFieldPrices[field]
+		if !ok {
+			continue
+		}
+		fq, err := g.paywall.quote(r.Context(), product.endpoint, product.price, product.priceUSD, product.description)
+		if err != nil {
+			log.Printf("❌ Pricing %s failed: %v", product.endpoint, err)
+			writeGraphQLError(w, http.StatusServiceUnavailable, "pricing unavailable, try again shortly")
+			g.metrics.RecordRequest("/graphql", "503")
+			return
+		}
+		cost.prices[field] = fq.priceUSD
+		totalUSD += fq.priceUSD * float64(count)
+	}
+	totalUSD = round(totalUSD, 6)
+	price := strconv.FormatFloat(totalUSD, 'f', -1, 64)
+	ctx := context.WithValue(r.Context(), queryCostKey{}, cost)
+	w.Header().Set("X-Query-Cost", price)
+
+	// Introspection and free fields need no payment, and are shed as free
+	if totalUSD == 0 {
+		if !g.paywall.shedder.Admit("free", 0) {
+			refuseShed(w)
+			return
+		}
+		g.execute(w, ctx, req, nil)
+		g.metrics.RecordRequest("/graphql", "200")
+		g.metrics.RecordResponseTime("/graphql", time.Since(start))
+		return
+	}
+
+	query := &graphqlQuery{req: req, cost: cost, totalUSD: totalUSD, start: start}
+	g.paid(w, r.WithContext(context.WithValue(ctx, graphqlQueryKey{}, query)))
+}
+
+// executePaid runs a query the paywall let through
+func (g *GraphQL) executePaid(w http.ResponseWriter, r *http.Request) {
+	q := r.Context().Value(graphqlQueryKey{}).(*graphqlQuery)
+	g.execute(w, r.Context(), q.req, q.cost)
+
+	// Only fields that resolved are charged
+	earned := q.cost.total()
+	if earned == 0 {
+		chargeFromContext(r.Context()).refuse()
+	} else {
+		chargeFromContext(r.Context()).discount(earned / q.totalUSD)
+	}
+	g.record(q.cost)
+	g.metrics.RecordRequest("/graphql", "200")
+	g.metrics.RecordResponseTime("/graphql", time.Since(q.start))
+}
+
+func (g *GraphQL) execute(w http.ResponseWriter, ctx context.Context, req graphqlRequest, cost *queryCost) {
+	result := graphql.Do(graphql.Params{
+		Schema:         g.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+	if cost != nil {
+		cost.mu.Lock()
+		fields := make(map[string]float64, len(cost.resolved))
+		for name, usd := range cost.resolved {
+			fields[name] = usd
+		}
+		cost.mu.Unlock()
+		result.Extensions = map[string]interface{}{"cost": map[string]interface{}{"charged_usd": cost.total(), "fields": fields}}
+		if IsSandbox(ctx) {
+			result.Extensions["sandbox"] = true
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// record adds a query's per-field charges to the running totals
+func (g *GraphQL) record(cost *queryCost) {
+	cost.mu.Lock()
+	defer cost.mu.Unlock()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for name, usd := range cost.resolved {
+		s, ok := g.stats[name]
+		if !ok {
+			s = &graphqlFieldStats{}
+			g.stats[name] = s
+		}
+		s.requests++
+		s.revenueUSD += usd
+	}
+}
+
+// WriteMetrics emits per-field GraphQL request and revenue counters
+func (g *GraphQL) WriteMetrics(b *strings.Builder) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	names := make([]string, 0, len(g.stats))
+	for name := range g.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("# HELP x402_graphql_field_requests_total Paid GraphQL queries that resolved each root field\n")
+	b.WriteString("# TYPE x402_graphql_field_requests_total counter\n")
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("x402_graphql_field_requests_total{field=\"%s\"} %d\n", name, g.stats[name].requests))
+	}
+	b.WriteString("# HELP x402_graphql_field_revenue_usd_total Revenue attributed to each GraphQL root field\n")
+	b.WriteString("# TYPE x402_graphql_field_revenue_usd_total counter\n")
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("x402_graphql_field_revenue_usd_total{field=\"%s\"} %.6f\n", name, g.stats[name].revenueUSD))
+	}
+}
+
+// rootFieldCounts parses a query and counts how often each root field of
+// the chosen operation is selected, following fragments
+func rootFieldCounts(query, operationName string) (map[string]int, error) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query), Name: "GraphQL request"})})
+	if err != nil {
+		return nil, err
+	}
+
+	fragments := make(map[string]*ast.FragmentDefinition)
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				if op == nil {
+					op = d
+				}
+			}
+		}
+	}
+	if op == nil {
+		return nil, fmt.Errorf("no operation found")
+	}
+	if op.Operation != ast.OperationTypeQuery {
+		return nil, fmt.Errorf("only queries are supported")
+	}
+
+	counts := make(map[string]int)
+	seen := make(map[string]bool)
+	var walk func(set *ast.SelectionSet)
+	walk = func(set *ast.SelectionSet) {
+		if set == nil {
+			return
+		}
+		for _, sel := range set.Selections {
+			switch s := sel.(type) {
+			case *ast.Field:
+				counts[s.Name.Value]++
+			case *ast.InlineFragment:
+				walk(s.SelectionSet)
+			case *ast.FragmentSpread:
+				if f, ok := fragments[s.Name.Value]; ok && !seen[f.Name.Value] {
+					seen[f.Name.Value] = true
+					walk(f.SelectionSet)
+					seen[f.Name.Value] = false
+				}
+			}
+		}
+	}
+	walk(op.SelectionSet)
+	return counts, nil
+}
+
+func writeGraphQLError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
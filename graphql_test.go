@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRootFieldCounts(t *testing.T) {
+	counts, err := rootFieldCounts(`
+		query Q { gas { fast } a: price { eth_usd } ...More }
+		fragment More on Query { b: price { average_usd } validators { pending_deposits } }
+	`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"gas": 1, "price": 2, "validators": 1}
+	for field, n := range want {
+		if counts[field] != n {
+			t.Errorf("%s selected %d times, want %d", field, counts[field], n)
+		}
+	}
+
+	if _, err := rootFieldCounts(`mutation { gas { fast } }`, ""); err == nil {
+		t.Error("expected mutations to be rejected")
+	}
+}
+
+func TestGraphQLQuotesSumOfFields(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), nil)
+	shedder := NewLoadShedder(10, 0.5, nil)
+	paywall.SetLoadShedder(shedder)
+	gql, err := NewGraphQL(paywall, NewMetrics(), &RPCClient{}, NewContractScanner())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(query string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		rr := httptest.NewRecorder()
+		gql.ServeHTTP(rr, httptest.NewRequest("POST", "/graphql", bytes.NewReader(body)))
+		return rr
+	}
+
+	// Introspection is free
+	if rr := post(`{ __schema { queryType { name } } }`); rr.Code != http.StatusOK {
+		t.Errorf("introspection returned %d", rr.Code)
+	}
+
+	rr := post(`{ gas { fast } price { eth_usd } }`)
+	if rr.Code != http.StatusPaymentRequired {
+		t.Fatalf("paid query returned %d, want 402", rr.Code)
+	}
+	var body struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(rr.Body).Decode(&body)
+	if body.Payment.MaxAmount != "0.003" || rr.Header().Get("X-Query-Cost") != "0.003" {
+		t.Errorf("quoted %q (header %q), want 0.003", body.Payment.MaxAmount, rr.Header().Get("X-Query-Cost"))
+	}
+
+	// Each query's price is its own: nothing is listed or ranked
+	if routes := paywall.routes.list(); len(routes) != 0 {
+		t.Errorf("graphql listed routes %+v", routes)
+	}
+	if _, ok := shedder.paid("/graphql"); ok || !shedder.priced("/graphql") {
+		t.Errorf("shedder ranked /graphql or took it for free")
+	}
+}
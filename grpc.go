@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/trace"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+	"github.com/arithmosquillsworth/x402-service/pkg/x402pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcProducts ties each paid RPC to the REST route it mirrors, so prices,
+// overrides, metrics and ledger entries are shared between the two
+var grpcProducts = map[string]paidRoute{
+	x402pb.X402_ScanContract_FullMethodName: routeFor("/api/scan-contract"),
+	x402pb.X402_TxPreflight_FullMethodName:  routeFor("/api/tx-preflight"),
+	x402pb.X402_GetGas_FullMethodName:       routeFor("/api/gas"),
+	x402pb.X402_GetPrice_FullMethodName:     routeFor("/api/price"),
+}
+
+// UnaryInterceptor enforces payment on gRPC calls through the same path as
+// Protect. The token is read from the "x-payment-response" metadata key,
+// or with exact_scheme on an exact scheme payment from "x-payment", and a
+// coupon from "x-coupon". Unpaid calls fail with FAILED_PRECONDITION and
+// the requirement in the "x402-payment-required" trailer. Calls that
+// return an error are not charged. gRPC cannot carry request signatures,
+// so endpoints in SIGNED_REQUESTS and prepaid debits are refused.
+func (p *Paywall) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		product, ok := grpcProducts[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		start := p.clock.Now()
+		call := paidCall{route: product, scheme: "x402"}
+		var traceparent string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get("x-payment-response"); len(v) > 0 {
+				call.payment = v[0]
+			} else if v := md.Get("x-payment"); len(v) > 0 && featureFlags.Enabled(FlagExactScheme) {
+				call.payment, call.scheme = v[0], SchemeExact
+			}
+			if v := md.Get("x-coupon"); len(v) > 0 {
+				call.coupon = v[0]
+			}
+			if v := md.Get("x-account-debit"); len(v) > 0 {
+				call.debitID = v[0]
+			}
+			if v := md.Get(trace.Header); len(v) > 0 {
+				traceparent = v[0]
+			}
+		}
+		ctx, span := tracer.Continue(ctx, traceparent, "x402.payment")
+		defer span.End()
+		grpc.SetHeader(ctx, metadata.Pairs("x-trace-id", span.Context.TraceID.String()))
+		if pr, ok := peer.FromContext(ctx); ok {
+			host, _, err := net.SplitHostPort(pr.Addr.String())
+			if err != nil {
+				host = pr.Addr.String()
+			}
+			ctx = withClient(ctx, host)
+		}
+
+		a := p.admit(ctx, call)
+		defer chargeFromContext(a.ctx).release()
+		if c := chargeFromContext(a.ctx); c != nil {
+			grpc.SetHeader(ctx, metadata.Pairs("x-payment-id", c.id))
+			if IsSandbox(a.ctx) {
+				grpc.SetHeader(ctx, metadata.Pairs("x402-sandbox", "true"))
+			}
+		}
+		if a.refusal != nil {
+			err := p.grpcRefusal(ctx, a)
+			label := "grpc_" + status.Code(err).String()
+			if a.refusal.status == http.StatusPaymentRequired {
+				label = "402"
+			}
+			p.metrics.RecordRequest(product.endpoint, label)
+			p.metrics.RecordResponseTime(product.endpoint, clock.Since(p.clock, start))
+			return nil, err
+		}
+
+		if p.redeemCredit(a) {
+			grpc.SetHeader(ctx, metadata.Pairs("x-payment-credit", CreditRedeemed))
+		}
+		paidCtx, payer := a.ctx, a.payer
+		handlerCtx, handlerSpan := tracer.Start(paidCtx, "x402.handler")
+		resp, err := handler(handlerCtx, req)
+		if err != nil {
+			handlerSpan.SetError(err.Error())
+			chargeFromContext(paidCtx).refuse()
+		}
+		handlerSpan.End()
+		if c := chargeFromContext(paidCtx); err == nil {
+			grpc.SetHeader(ctx, metadata.Pairs("x-payment-response", p.receipt(c, payer, product.endpoint)))
+		}
+		p.capture(paidCtx, a.q, payer)
+		p.metrics.RecordRequest(product.endpoint, "grpc_"+status.Code(err).String())
+		p.metrics.RecordResponseTime(product.endpoint, clock.Since(p.clock, start))
+		return resp, err
+	}
+}
+
+// grpcRefusal answers a gRPC call the paywall turned away. A call asked to
+// pay gets the requirements in trailers.
+func (p *Paywall) grpcRefusal(ctx context.Context, a *admission) error {
+	r := a.refusal
+	if !r.challenge && len(r.failed) == 0 {
+		switch r.status {
+		case http.StatusTooManyRequests:
+			return status.Error(codes.ResourceExhausted, r.message)
+		case http.StatusBadRequest:
+			return status.Error(codes.InvalidArgument, r.message)
+		}
+		return status.Error(codes.Unavailable, r.message)
+	}
+
+	reqs := p.requirements(a.q)
+	requirement, _ := json.Marshal(reqs[0])
+	accepts, _ := json.Marshal(reqs)
+	grpc.SetTrailer(ctx, metadata.Pairs("x402-payment-required", string(requirement), "x402-payment-accepts", string(accepts)))
+	if len(r.failed) == 0 {
+		return status.Error(codes.FailedPrecondition, "payment required")
+	}
+	if p.diagnostics {
+		checks, _ := json.Marshal(r.failed)
+		grpc.SetTrailer(ctx, metadata.Pairs("x402-payment-checks", string(checks)))
+	}
+	code := refusalCode(r.failed)
+	grpc.SetTrailer(ctx, metadata.Pairs("x402-payment-code", code))
+	switch code {
+	case paymentSpentCode:
+		// Aborted: retry, but with a new payment
+		return status.Error(codes.Aborted, "payment already spent")
+	case paymentExpiredCode:
+		return status.Error(codes.FailedPrecondition, "payment expired")
+	case paymentNotYetValidCode:
+		return status.Error(codes.FailedPrecondition, "payment not yet valid")
+	}
+	return status.Error(codes.FailedPrecondition, "invalid or insufficient payment")
+}
+
+// grpcService implements x402pb.X402Server on top of the REST handlers'
+// scanners and data sources
+type grpcService struct {
+	x402pb.UnimplementedX402Server
+	scanner   *ContractScanner
+	simulator *TxSimulator
+	gas       GasProvider
+}
+
+// grpcPort returns GRPC_PORT, 50051 if it is unset. Setting it empty or
+// to "off" disables the gRPC server.
+func grpcPort() string {
+	port, ok := os.LookupEnv("GRPC_PORT")
+	if !ok {
+		return "50051"
+	}
+	if strings.EqualFold(strings.TrimSpace(port), "off") {
+		return ""
+	}
+	return strings.TrimSpace(port)
+}
+
+// NewGRPCServer creates a gRPC server exposing the paid APIs behind paywall
+func NewGRPCServer(paywall *Paywall, scanner *ContractScanner, simulator *TxSimulator, gas GasProvider) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(paywall.UnaryInterceptor()))
+	x402pb.RegisterX402Server(server, &grpcService{scanner: scanner, simulator: simulator, gas: gas})
+	return server
+}
+
+func (s *grpcService) ScanContract(ctx context.Context, req *x402pb.ScanContractRequest) (*x402pb.ContractScanResult, error) {
+	if err := address.Validate(req.GetAddress()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid address: %v", err)
+	}
+	chain := req.GetChain()
+	if chain == "" {
+		chain = "base"
+	}
+	if _, ok := runtimeConfig.Current().Chain(chain); !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid chain - use %s", runtimeConfig.Current().ChainNames())
+	}
+
+	result, err := s.scanner.Scan(req.GetAddress(), chain)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "scan failed: %v", err)
+	}
+	events.Publish(ctx, EventScanCompleted, ScanCompleted{Kind: "contract", Chain: chain, Address: req.GetAddress(), Result: result})
+	return &x402pb.ContractScanResult{
+		Address:    result.Address,
+		Chain:      result.Chain,
+		RiskScore:  int32(result.RiskScore),
+		IsVerified: result.IsVerified,
+		IsProxy:    result.IsProxy,
+		IsHoneypot: result.IsHoneypot,
+		Flags:      result.Flags,
+		Warnings:   result.Warnings,
+		Cached:     result.Cached,
+		CachedAt:   result.CachedAt,
+		ScannedAt:  result.ScannedAt,
+	}, nil
+}
+
+func (s *grpcService) TxPreflight(ctx context.Context, req *x402pb.TxPreflightRequest) (*x402pb.TxPreflightResult, error) {
+	result, err := s.simulator.Simulate(&TxPreflightRequest{
+		From:  req.GetFrom(),
+		To:    req.GetTo(),
+		Value: req.GetValue(),
+		Data:  req.GetData(),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "preflight failed: %v", err)
+	}
+	watchLists.checkPreflight(ctx, &TxPreflightRequest{To: req.GetTo(), Data: req.GetData()}, result)
+	return &x402pb.TxPreflightResult{
+		Safe:              result.Safe,
+		RiskScore:         int32(result.RiskScore),
+		SimulationSuccess: result.SimulationSuccess,
+		GasEstimate:       result.GasEstimate,
+		Warnings:          result.Warnings,
+		Errors:            result.Errors,
+		Recommendations:   result.Recommendations,
+		CheckedAt:         result.CheckedAt,
+	}, nil
+}
+
+func (s *grpcService) GetGas(ctx context.Context, req *x402pb.GetGasRequest) (*x402pb.GasData, error) {
+	gas, err := s.gas.GasPrices()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "gas data unavailable: %v", err)
+	}
+	return &x402pb.GasData{
+		Timestamp:   gas.Timestamp,
+		Gas:         gas.Gas,
+		Unit:        gas.Unit,
+		Source:      gas.Source,
+		DataQuality: dataQualityPB(gas.DataQuality),
+	}, nil
+}
+
+func (s *grpcService) GetPrice(ctx context.Context, req *x402pb.GetPriceRequest) (*x402pb.PriceData, error) {
+	price, err := providers.Price.ETHPrice()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "price data unavailable: %v", err)
+	}
+	return &x402pb.PriceData{
+		Timestamp:         price.Timestamp,
+		EthUsd:            price.Eth,
+		Sources:           price.Sources,
+		AverageUsd:        price.Average,
+		Change_24HPercent: price.Change24h,
+		DataQuality:       dataQualityPB(price.DataQuality),
+	}, nil
+}
+
+func dataQualityPB(q types.DataQuality) *x402pb.DataQuality {
+	return &x402pb.DataQuality{Quality: q.Quality, StalenessSeconds: q.StalenessSeconds}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/x402pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCPaywallInterceptor(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	metrics := NewMetrics()
+	paywall := NewPaywall(config, metrics, nil)
+	interceptor := paywall.UnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: x402pb.X402_GetGas_FullMethodName}
+
+	var sawPayer Payer
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) {
+		sawPayer, _ = PayerFromContext(ctx)
+		return &x402pb.GasData{Unit: "gwei"}, nil
+	}
+
+	_, err := interceptor(context.Background(), &x402pb.GetGasRequest{}, info, ok)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("unpaid call returned %v, want FailedPrecondition", err)
+	}
+	if failures := paywall.Failures(); len(failures) != 0 {
+		t.Errorf("unpaid call recorded as refused: %+v", failures)
+	}
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.001"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = config.Receiver
+	claims.Subject = "0xabc0000000000000000000000000000000000001"
+	paid := func() context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-payment-response", signPayment(t, claims)))
+	}
+
+	if _, err := interceptor(paid(), &x402pb.GetGasRequest{}, info, ok); err != nil {
+		t.Fatalf("paid call failed: %v", err)
+	}
+	if sawPayer.Address != claims.Subject || metrics.paymentsTotal != 1 {
+		t.Errorf("payer=%+v payments=%d", sawPayer, metrics.paymentsTotal)
+	}
+
+	// Failed calls are not charged
+	failing := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "upstream down")
+	}
+	if _, err := interceptor(paid(), &x402pb.GetGasRequest{}, info, failing); status.Code(err) != codes.Unavailable {
+		t.Errorf("failing call returned %v", err)
+	}
+	if metrics.paymentsTotal != 1 {
+		t.Errorf("failed call was charged")
+	}
+}
+
+func TestGRPCPort(t *testing.T) {
+	if _, set := os.LookupEnv("GRPC_PORT"); !set {
+		if got := grpcPort(); got != "50051" {
+			t.Errorf("unset GRPC_PORT serves on %q, want 50051", got)
+		}
+	}
+	for value, want := range map[string]string{"9090": "9090", "": "", "off": "", "OFF": ""} {
+		t.Setenv("GRPC_PORT", value)
+		if got := grpcPort(); got != want {
+			t.Errorf("GRPC_PORT=%q serves on %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestGRPCSharesPaywallChecks(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	metrics := NewMetrics()
+	paywall := NewPaywall(config, metrics, nil)
+	paywall.SetRateLimit(newRateLimit("grpc-test", 1, 1))
+	paywall.SetSignedRequests([]string{"/api/scan-contract"})
+	paywall.SetAccounts(NewAccounts(config.Asset))
+	interceptor := paywall.UnaryInterceptor()
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &x402pb.GasData{Unit: "gwei"}, nil
+	}
+	call := func(method string, pairs ...string) error {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Receiver = config.Receiver
+		claims.Subject = "0xabc0000000000000000000000000000000000003"
+		md := metadata.Pairs(pairs...)
+		if len(pairs) == 0 {
+			md = metadata.Pairs("x-payment-response", signPayment(t, claims))
+		}
+		_, err := interceptor(metadata.NewIncomingContext(context.Background(), md), &x402pb.GetGasRequest{}, &grpc.UnaryServerInfo{FullMethod: method}, ok)
+		return err
+	}
+
+	// The payer's rate limit applies as over HTTP, and is not charged
+	if err := call(x402pb.X402_GetGas_FullMethodName); err != nil {
+		t.Fatalf("paid call failed: %v", err)
+	}
+	if err := call(x402pb.X402_GetGas_FullMethodName); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("call over the rate limit returned %v, want ResourceExhausted", err)
+	}
+	if metrics.paymentsTotal != 1 {
+		t.Errorf("payments = %d, want 1", metrics.paymentsTotal)
+	}
+
+	// gRPC cannot carry the signature SIGNED_REQUESTS requires, nor a debit
+	if err := call(x402pb.X402_ScanContract_FullMethodName); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unsigned call to a signed endpoint returned %v, want InvalidArgument", err)
+	}
+	if err := call(x402pb.X402_GetPrice_FullMethodName, "x-account-debit", "1767225600.9f3c"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("debit returned %v, want InvalidArgument", err)
+	}
+	if err := call(x402pb.X402_GetPrice_FullMethodName, "x-coupon", "x402c_bogus"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("invalid coupon returned %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,216 @@
+package testhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// RecordEnv switches every Replay transport to record mode: requests go to
+// the real upstreams and the exchanges are written back to the golden file.
+//
+//	UPSTREAM_RECORD=1 go test -run TestScannerReplay .
+const RecordEnv = "UPSTREAM_RECORD"
+
+// redactedParams are query parameters stripped before an exchange is
+// stored or matched, so API keys never end up in golden files
+var redactedParams = []string{"apikey", "api_key", "key", "token"}
+
+// Interaction is one recorded upstream exchange
+type Interaction struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	RequestBody json.RawMessage `json:"request_body,omitempty"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`     // JSON responses, stored as-is
+	RawBody     string          `json:"raw_body,omitempty"` // anything else
+}
+
+// Cassette is the content of a golden file
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Replay returns a transport that answers upstream requests from the golden
+// file at path. A request with no recorded exchange fails the test. With
+// UPSTREAM_RECORD=1 the transport calls the real upstreams instead and
+// rewrites the file when t finishes.
+func Replay(t testing.TB, path string) http.RoundTripper {
+	t.Helper()
+	if os.Getenv(RecordEnv) != "" {
+		r := &recorder{t: t, path: path}
+		t.Cleanup(r.save)
+		return r
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("testhttp: %v (record it with %s=1)", err, RecordEnv)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("testhttp: %s: %v", path, err)
+	}
+	return &replayer{t: t, path: path, cassette: c}
+}
+
+type replayer struct {
+	t        testing.TB
+	path     string
+	cassette Cassette
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	method, u, body, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, in := range r.cassette.Interactions {
+		if in.Method == method && in.URL == u && bytes.Equal(canonicalJSON(in.RequestBody), body) {
+			return in.response(req), nil
+		}
+	}
+	r.t.Errorf("testhttp: no recorded response for %s %s %s in %s", method, u, body, r.path)
+	return nil, fmt.Errorf("testhttp: no recorded response for %s %s", method, u)
+}
+
+type recorder struct {
+	t    testing.TB
+	path string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	method, u, body, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 && !json.Valid(body) {
+		return nil, fmt.Errorf("testhttp: cannot record non-JSON request body for %s %s", method, u)
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	in := Interaction{
+		Method:      method,
+		URL:         u,
+		RequestBody: body,
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if json.Valid(respBody) {
+		in.Body = canonicalJSON(respBody)
+	} else {
+		in.RawBody = string(respBody)
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	r.mu.Unlock()
+	return in.response(req), nil
+}
+
+func (r *recorder) save() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(r.cassette)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(r.path), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(r.path, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		r.t.Errorf("testhttp: saving %s: %v", r.path, err)
+	}
+}
+
+func (in Interaction) response(req *http.Request) *http.Response {
+	body := []byte(in.RawBody)
+	if len(in.Body) > 0 {
+		body = in.Body
+	}
+	header := http.Header{}
+	if in.ContentType != "" {
+		header.Set("Content-Type", in.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// requestKey returns what a request is matched on: its method, its URL with
+// secrets removed and its body in canonical JSON form. The body is restored
+// so the request can still be sent.
+func requestKey(req *http.Request) (string, string, []byte, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", "", nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		body = canonicalJSON(b)
+	}
+	return req.Method, redactURL(req.URL), body, nil
+}
+
+func redactURL(u *url.URL) string {
+	out := *u
+	q := out.Query()
+	for _, p := range redactedParams {
+		q.Del(p)
+	}
+	out.RawQuery = q.Encode() // sorted by key
+	return out.String()
+}
+
+// canonicalJSON re-encodes JSON with sorted keys so key order and spacing
+// do not affect matching. Anything else is returned unchanged.
+func canonicalJSON(b []byte) []byte {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return b
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return b
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+}
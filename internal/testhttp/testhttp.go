@@ -0,0 +1,431 @@
+// Package testhttp provides fake upstreams for end-to-end tests: an
+// Ethereum JSON-RPC node, a beacon API, and the public explorer, honeypot
+// and price APIs. Point ETH_RPC_URL and BEACON_API_URL at RPC and Beacon,
+// and route everything else through Transport so no test touches the
+// network. Replay serves captured real-world responses from golden files
+// instead.
+package testhttp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Upstream names accepted by Fail and Hits. Public APIs are named by host.
+const (
+	RPC       = "rpc"
+	Beacon    = "beacon"
+	Etherscan = "api.etherscan.io"
+	Basescan  = "api.basescan.org"
+	Honeypot  = "api.honeypot.is"
+	CoinGecko = "api.coingecko.com"
+	Coinbase  = "api.coinbase.com"
+	Kraken    = "api.kraken.com"
+	BaseRPC   = "mainnet.base.org" // answers like RPC
+)
+
+// Contract is what the fake explorer and honeypot API know about an address
+type Contract struct {
+	Verified bool
+	Proxy    bool
+	Honeypot bool
+	Name     string
+	ABI      string // defaults to "[]" for verified contracts
+	Created  int64  // deployment time, unix seconds; 0 means no creation record
+	Creator  string // deployer address, reported with the creation record
+
+	// Token state, served by eth_call through the explorer proxy and by
+	// the honeypot API
+	Owner       string
+	TotalSupply int64
+	BuyTax      float64
+	SellTax     float64
+	Liquidity   float64 // USD; 0 means no pair
+}
+
+// Tx is a normal or internal transaction in an account's explorer history
+type Tx struct {
+	From            string
+	To              string
+	Value           string // wei, decimal
+	ContractAddress string // set for contract creations
+	Internal        bool
+}
+
+// Upstreams is a set of running fake upstream servers
+type Upstreams struct {
+	RPC    *httptest.Server
+	Beacon *httptest.Server
+	Public *httptest.Server // explorer, honeypot and price APIs, routed by Host
+
+	mu              sync.Mutex
+	rpcResults      map[string]interface{}
+	contracts       map[string]Contract
+	txs             map[string][]Tx
+	ethUSD          float64
+	stableUSD       map[string]float64 // stablecoin symbol -> USD price
+	usdRates        map[string]float64
+	validators      int
+	pendingDeposits int
+	failing         map[string]bool
+	hits            map[string]int
+}
+
+// New starts the fake upstreams and stops them when t finishes
+func New(t testing.TB) *Upstreams {
+	u := &Upstreams{
+		rpcResults: map[string]interface{}{
+			"eth_gasPrice":    "0x4a817c800", // 20 gwei
+			"eth_getCode":     "0x",
+			"eth_estimateGas": "0x5208",
+			"eth_call":        "0x",
+			"eth_blockNumber": "0x1",
+		},
+		contracts:  make(map[string]Contract),
+		txs:        make(map[string][]Tx),
+		ethUSD:     3000,
+		stableUSD:  map[string]float64{"USDC": 1, "USDT": 1, "DAI": 1},
+		usdRates:   map[string]float64{"EUR": 0.9, "GBP": 0.8, "JPY": 150},
+		validators: 1000,
+		failing:    make(map[string]bool),
+		hits:       make(map[string]int),
+	}
+	u.RPC = httptest.NewServer(http.HandlerFunc(u.serveRPC))
+	u.Beacon = httptest.NewServer(http.HandlerFunc(u.serveBeacon))
+	u.Public = httptest.NewServer(http.HandlerFunc(u.servePublic))
+	t.Cleanup(func() {
+		u.RPC.Close()
+		u.Beacon.Close()
+		u.Public.Close()
+	})
+	return u
+}
+
+// SetRPCResult sets the result returned for a JSON-RPC method
+func (u *Upstreams) SetRPCResult(method string, result interface{}) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.rpcResults[method] = result
+}
+
+// SetContract registers what the explorer and honeypot API report for address
+func (u *Upstreams) SetContract(address string, c Contract) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.contracts[strings.ToLower(address)] = c
+}
+
+// AddTransactions appends to the explorer history of address
+func (u *Upstreams) AddTransactions(address string, txs ...Tx) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	key := strings.ToLower(address)
+	u.txs[key] = append(u.txs[key], txs...)
+}
+
+// SetETHPrice sets the ETH/USD price reported by every price API
+func (u *Upstreams) SetETHPrice(usd float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ethUSD = usd
+}
+
+// SetStablecoinPrice sets the USD price reported for a stablecoin such as
+// USDC, to simulate a depeg
+func (u *Upstreams) SetStablecoinPrice(symbol string, usd float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.stableUSD[symbol] = usd
+}
+
+// SetActiveValidators sets the beacon chain's active validator count
+func (u *Upstreams) SetActiveValidators(n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.validators = n
+}
+
+// SetPendingDeposits sets the length of the beacon chain's deposit queue
+func (u *Upstreams) SetPendingDeposits(n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.pendingDeposits = n
+}
+
+// Fail makes an upstream answer 500 until called again with false
+func (u *Upstreams) Fail(name string, failing bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failing[name] = failing
+}
+
+// Hits returns how many requests an upstream has received
+func (u *Upstreams) Hits(name string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.hits[name]
+}
+
+// hit counts a request and reports whether the upstream should fail it
+func (u *Upstreams) hit(name string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.hits[name]++
+	return u.failing[name]
+}
+
+// Transport sends requests for the fake RPC and beacon servers through
+// unchanged and redirects every other host to Public, keeping the original
+// Host header so it can tell the APIs apart.
+func (u *Upstreams) Transport() http.RoundTripper {
+	local := map[string]bool{
+		strings.TrimPrefix(u.RPC.URL, "http://"):    true,
+		strings.TrimPrefix(u.Beacon.URL, "http://"): true,
+	}
+	public, _ := url.Parse(u.Public.URL)
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if local[req.URL.Host] {
+			return http.DefaultTransport.RoundTrip(req)
+		}
+		out := req.Clone(req.Context())
+		out.Host = req.URL.Hostname()
+		out.URL.Scheme = public.Scheme
+		out.URL.Host = public.Host
+		return http.DefaultTransport.RoundTrip(out)
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func (u *Upstreams) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if u.hit(RPC) {
+		http.Error(w, "rpc unavailable", http.StatusInternalServerError)
+		return
+	}
+	var req struct {
+		ID     interface{} `json:"id"`
+		Method string      `json:"method"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	u.mu.Lock()
+	result, ok := u.rpcResults[req.Method]
+	u.mu.Unlock()
+
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if ok {
+		resp["result"] = result
+	} else {
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "method not found: " + req.Method}
+	}
+	writeJSON(w, resp)
+}
+
+func (u *Upstreams) serveBeacon(w http.ResponseWriter, r *http.Request) {
+	if u.hit(Beacon) {
+		writeJSON(w, map[string]interface{}{"code": 503, "message": "beacon unavailable"}, http.StatusServiceUnavailable)
+		return
+	}
+	u.mu.Lock()
+	active, pending := u.validators, u.pendingDeposits
+	u.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/eth/v1/beacon/states/head/validators":
+		data := make([]map[string]string, active)
+		for i := range data {
+			data[i] = map[string]string{"index": strconv.Itoa(i), "status": "active_ongoing"}
+		}
+		writeJSON(w, map[string]interface{}{"execution_optimistic": false, "finalized": false, "data": data})
+	case "/eth/v1/beacon/states/head/pending_deposits":
+		data := make([]map[string]string, pending)
+		for i := range data {
+			data[i] = map[string]string{"amount": "32000000000", "slot": strconv.Itoa(i)}
+		}
+		writeJSON(w, map[string]interface{}{"version": "electra", "execution_optimistic": false, "finalized": false, "data": data})
+	default:
+		writeJSON(w, map[string]interface{}{"code": 404, "message": "route not found"}, http.StatusNotFound)
+	}
+}
+
+func (u *Upstreams) servePublic(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if u.hit(host) {
+		http.Error(w, host+" unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	switch host {
+	case Etherscan, Basescan:
+		u.serveExplorer(w, r)
+	case Honeypot:
+		c := u.contract(r.URL.Query().Get("address"))
+		report := map[string]interface{}{
+			"IsHoneypot":       c.Honeypot,
+			"simulationResult": map[string]float64{"buyTax": c.BuyTax, "sellTax": c.SellTax},
+		}
+		if c.Liquidity > 0 {
+			report["pair"] = map[string]float64{"liquidity": c.Liquidity}
+		}
+		writeJSON(w, report)
+	case CoinGecko:
+		prices := map[string]map[string]float64{}
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if symbol, ok := coingeckoSymbols[id]; ok {
+				prices[id] = map[string]float64{"usd": u.stablecoin(symbol)}
+			} else if id == "ethereum" {
+				prices[id] = map[string]float64{"usd": u.price()}
+			}
+		}
+		writeJSON(w, prices)
+	case Coinbase:
+		rates := map[string]string{}
+		switch currency := r.URL.Query().Get("currency"); currency {
+		case "USD":
+			u.mu.Lock()
+			for code, rate := range u.usdRates {
+				rates[code] = strconv.FormatFloat(rate, 'f', -1, 64)
+			}
+			u.mu.Unlock()
+		case "USDC", "USDT", "DAI":
+			rates["USD"] = strconv.FormatFloat(u.stablecoin(currency), 'f', -1, 64)
+		default:
+			rates["USD"] = strconv.FormatFloat(u.price(), 'f', -1, 64)
+		}
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"rates": rates}})
+	case BaseRPC:
+		u.serveRPC(w, r)
+	case Kraken:
+		last := strconv.FormatFloat(u.price(), 'f', -1, 64)
+		writeJSON(w, map[string]interface{}{"result": map[string]interface{}{"XETHZUSD": map[string][]string{"c": {last, "1"}}}})
+	default:
+		http.Error(w, fmt.Sprintf("testhttp: no fake for host %q", host), http.StatusBadGateway)
+	}
+}
+
+// serveExplorer implements the Etherscan-compatible contract and account
+// transaction list modules
+func (u *Upstreams) serveExplorer(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	c := u.contract(q.Get("address") + q.Get("contractaddresses") + q.Get("to"))
+
+	switch q.Get("module") + "." + q.Get("action") {
+	case "contract.getabi":
+		if !c.Verified {
+			writeJSON(w, map[string]string{"status": "0", "message": "NOTOK", "result": "Contract source code not verified"})
+			return
+		}
+		writeJSON(w, map[string]string{"status": "1", "message": "OK", "result": c.abi()})
+	case "contract.getsourcecode":
+		proxy := "0"
+		if c.Proxy {
+			proxy = "1"
+		}
+		abi := "Contract source code not verified"
+		if c.Verified {
+			abi = c.abi()
+		}
+		writeJSON(w, map[string]interface{}{
+			"status":  "1",
+			"message": "OK",
+			"result": []map[string]string{{
+				"ContractName": c.Name,
+				"ABI":          abi,
+				"Proxy":        proxy,
+			}},
+		})
+	case "contract.getcontractcreation":
+		if c.Created == 0 {
+			writeJSON(w, map[string]interface{}{"status": "0", "message": "No data found", "result": nil})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"status":  "1",
+			"message": "OK",
+			"result": []map[string]string{{
+				"contractAddress": strings.ToLower(q.Get("contractaddresses")),
+				"contractCreator": c.Creator,
+				"timestamp":       strconv.FormatInt(c.Created, 10),
+			}},
+		})
+	case "proxy.eth_call":
+		var word []byte
+		switch q.Get("data") {
+		case "0x8da5cb5b": // owner()
+			if c.Owner != "" {
+				raw, _ := hex.DecodeString(strings.TrimPrefix(c.Owner, "0x"))
+				word = append(make([]byte, 12), raw...)
+			}
+		case "0x18160ddd": // totalSupply()
+			word = big.NewInt(c.TotalSupply).FillBytes(make([]byte, 32))
+		}
+		writeJSON(w, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": "0x" + hex.EncodeToString(word)})
+	case "account.txlist", "account.txlistinternal":
+		internal := q.Get("action") == "txlistinternal"
+		txs := []map[string]string{}
+		for _, tx := range u.transactions(q.Get("address")) {
+			if tx.Internal == internal {
+				txs = append(txs, map[string]string{"from": tx.From, "to": tx.To, "value": tx.Value, "contractAddress": tx.ContractAddress, "isError": "0"})
+			}
+		}
+		if len(txs) == 0 {
+			writeJSON(w, map[string]interface{}{"status": "0", "message": "No transactions found", "result": txs})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"status": "1", "message": "OK", "result": txs})
+	default:
+		writeJSON(w, map[string]string{"status": "0", "message": "NOTOK", "result": "unsupported action"})
+	}
+}
+
+func (c Contract) abi() string {
+	if c.ABI != "" {
+		return c.ABI
+	}
+	return "[]"
+}
+
+func (u *Upstreams) contract(address string) Contract {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.contracts[strings.ToLower(address)]
+}
+
+func (u *Upstreams) transactions(address string) []Tx {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.txs[strings.ToLower(address)]
+}
+
+var coingeckoSymbols = map[string]string{"usd-coin": "USDC", "tether": "USDT", "dai": "DAI"}
+
+func (u *Upstreams) stablecoin(symbol string) float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.stableUSD[symbol]
+}
+
+func (u *Upstreams) price() float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.ethUSD
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, status ...int) {
+	w.Header().Set("Content-Type", "application/json")
+	if len(status) > 0 {
+		w.WriteHeader(status[0])
+	}
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/kv"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a paid request executed in the background
+type Job struct {
+	ID          string          `json:"id"`
+	Endpoint    string          `json:"endpoint"`
+	Status      string          `json:"status"`
+	Payer       Payer           `json:"payer"`
+	Sandbox     bool            `json:"sandbox,omitempty"`
+	WebhookURL  string          `json:"webhook_url,omitempty"`
+	ContentType string          `json:"-"`
+	Body        []byte          `json:"-"`
+	StatusCode  int             `json:"status_code,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   int64           `json:"created_at"`
+	UpdatedAt   int64           `json:"updated_at"`
+}
+
+// storedJob is the on-disk form of a Job, which keeps the request body so
+// unfinished jobs can be re-run after a restart
+type storedJob struct {
+	Job
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// JobManager runs async jobs and persists them to disk
+type JobManager struct {
+	mu       sync.RWMutex
+	jobs     map[string]*Job
+	handlers map[string]http.HandlerFunc
+	queue    chan string
+	path     string
+	ttl      time.Duration
+	client   *http.Client
+	metrics  *Metrics
+	clock    clock.Clock
+	shared   kv.Store // nil unless job status is shared across replicas
+	outbox   *Outbox  // delivers webhooks
+}
+
+// jobWebhook is a finished job owed to its callback URL
+type jobWebhook struct {
+	URL string `json:"url"`
+	Job Job    `json:"job"`
+}
+
+// NewJobManager creates a job manager persisting to dataDir/jobs.json,
+// starts its workers and re-queues jobs left unfinished by a restart
+func NewJobManager(dataDir string, workers int, metrics *Metrics) *JobManager {
+	m := &JobManager{
+		jobs:     make(map[string]*Job),
+		handlers: make(map[string]http.HandlerFunc),
+		queue:    make(chan string, 1024),
+		path:     filepath.Join(dataDir, "jobs.json"),
+		ttl:      24 * time.Hour,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		metrics:  metrics,
+		clock:    clock.System,
+	}
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	if err := m.load(); err != nil {
+		log.Printf("⚠️  Could not load jobs from %s: %v", m.path, err)
+	}
+	go m.cleanup()
+	return m
+}
+
+// Async wraps a paid handler so that requests with ?async=true are queued
+// and answered immediately with 202 and a job ID. Synchronous requests pass
+// straight through. The callback URL may be given in X-Callback-URL.
+func (m *JobManager) Async(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	m.mu.Lock()
+	m.handlers[endpoint] = next
+	m.mu.Unlock()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("async") != "true" {
+			next(w, r)
+			return
+		}
+
+		webhook := r.Header.Get("X-Callback-URL")
+		if webhook != "" {
+			if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				http.Error(w, `{"error":"Invalid X-Callback-URL"}`, http.StatusBadRequest)
+				return
+			}
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+		if err != nil {
+			http.Error(w, `{"error":"Could not read body"}`, http.StatusBadRequest)
+			return
+		}
+
+		payer, _ := PayerFromContext(r.Context())
+		now := m.clock.Now().Unix()
+		job := &Job{
+			ID:          newJobID(),
+			Endpoint:    endpoint,
+			Status:      JobQueued,
+			Payer:       payer,
+			Sandbox:     IsSandbox(r.Context()),
+			WebhookURL:  webhook,
+			ContentType: r.Header.Get("Content-Type"),
+			Body:        body,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+
+		m.mu.Lock()
+		m.jobs[job.ID] = job
+		m.mu.Unlock()
+		m.persist()
+		m.publish(*job)
+
+		// Once queued the job belongs to a worker; only read it via Get
+		id := job.ID
+		select {
+		case m.queue <- id:
+		default:
+			m.finish(id, http.StatusServiceUnavailable, nil, "job queue full")
+		}
+		current, _ := m.Get(id)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/jobs/"+id)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"job_id":           id,
+			"status":           current.Status,
+			"status_url":       "/api/jobs/" + id,
+			"payment_verified": true,
+		})
+	}
+}
+
+// WriteMetrics emits job queue depth and per-status job counts
+func (m *JobManager) WriteMetrics(b *strings.Builder) {
+	m.mu.RLock()
+	counts := make(map[string]int)
+	for _, job := range m.jobs {
+		counts[job.Status]++
+	}
+	m.mu.RUnlock()
+
+	b.WriteString("# HELP x402_job_queue_depth Async jobs waiting for a worker\n")
+	b.WriteString("# TYPE x402_job_queue_depth gauge\n")
+	b.WriteString(fmt.Sprintf("x402_job_queue_depth %d\n", len(m.queue)))
+	b.WriteString("# HELP x402_jobs Async jobs by status\n")
+	b.WriteString("# TYPE x402_jobs gauge\n")
+	for _, status := range []string{JobQueued, JobRunning, JobSucceeded, JobFailed} {
+		b.WriteString(fmt.Sprintf("x402_jobs{status=\"%s\"} %d\n", status, counts[status]))
+	}
+}
+
+// handleGetJob serves GET /api/jobs/{id}
+func (m *JobManager) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	job, ok := m.Get(id)
+	if !ok {
+		http.Error(w, `{"error":"Job not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// Get returns a snapshot of a job. Jobs run by other replicas are looked
+// up in the shared store.
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	job, ok := m.jobs[id]
+	var snapshot Job
+	if ok {
+		snapshot = *job
+	}
+	m.mu.RUnlock()
+	if ok || m.shared == nil {
+		return snapshot, ok
+	}
+
+	data, ok, err := m.shared.Get("job:" + id)
+	if err != nil {
+		log.Printf("⚠️  Shared job lookup failed for %s: %v", id, err)
+		return Job{}, false
+	}
+	if !ok || json.Unmarshal([]byte(data), &snapshot) != nil {
+		return Job{}, false
+	}
+	return snapshot, true
+}
+
+// Share publishes job status to store so any replica can answer polls
+func (m *JobManager) Share(store kv.Store) {
+	m.shared = store
+}
+
+// publish copies a job's status to the shared store. It expires with the
+// job's TTL, counted from its last update.
+func (m *JobManager) publish(job Job) {
+	if m.shared == nil {
+		return
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	m.mu.RLock()
+	ttl := m.ttl
+	m.mu.RUnlock()
+	if err := m.shared.Set("job:"+job.ID, string(data), ttl); err != nil {
+		log.Printf("⚠️  Could not share job %s: %v", job.ID, err)
+	}
+}
+
+func (m *JobManager) worker() {
+	for id := range m.queue {
+		m.run(id)
+	}
+}
+
+func (m *JobManager) run(id string) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	handler := m.handlers[job.Endpoint]
+	job.Status = JobRunning
+	job.UpdatedAt = m.clock.Now().Unix()
+	endpoint, body, contentType, payer, sandbox := job.Endpoint, job.Body, job.ContentType, job.Payer, job.Sandbox
+	snapshot := *job
+	m.mu.Unlock()
+	m.persist()
+	m.publish(snapshot)
+
+	if handler == nil {
+		m.finish(id, http.StatusInternalServerError, nil, "no handler registered for "+endpoint)
+		return
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req = req.WithContext(withPayer(req.Context(), payer))
+	if sandbox {
+		req = req.WithContext(withSandbox(req.Context()))
+	}
+
+	rec := newBufferedResponse()
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				rec.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(rec.body, `{"error":"job panicked: %v"}`, p)
+			}
+		}()
+		handler(rec, req)
+	}()
+
+	m.finish(id, rec.status, rec.body.Bytes(), "")
+}
+
+// finish records the outcome of a job and fires its webhook
+func (m *JobManager) finish(id string, status int, body []byte, errMsg string) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	job.StatusCode = status
+	job.UpdatedAt = m.clock.Now().Unix()
+	if status >= 200 && status < 300 && errMsg == "" {
+		job.Status = JobSucceeded
+	} else {
+		job.Status = JobFailed
+		job.Error = errMsg
+		if job.Error == "" {
+			job.Error = strings.TrimSpace(string(body))
+		}
+	}
+	if json.Valid(body) {
+		job.Result = json.RawMessage(body)
+	}
+	job.Body = nil
+	snapshot := *job
+	m.mu.Unlock()
+	m.persist()
+	m.publish(snapshot)
+
+	m.metrics.RecordRequest("/api/jobs", snapshot.Status)
+	if snapshot.WebhookURL != "" {
+		if _, err := m.outbox.Enqueue(DeliveryWebhook, jobWebhook{URL: snapshot.WebhookURL, Job: snapshot}); err != nil {
+			log.Printf("⚠️  Job %s webhook not queued: %v", id, err)
+		}
+	}
+}
+
+// SetOutbox queues finished jobs' webhooks in o, retried under policy
+func (m *JobManager) SetOutbox(o *Outbox, policy RetryPolicy) {
+	m.outbox = o
+	o.Register(DeliveryWebhook, policy, m.deliverWebhook)
+}
+
+// deliverWebhook posts a finished job to its callback URL. X-Delivery-Id
+// is the same on every attempt, for receivers to drop repeats.
+func (m *JobManager) deliverWebhook(d Delivery) error {
+	var hook jobWebhook
+	if err := json.Unmarshal(d.Payload, &hook); err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(hook.Job)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Delivery-Id", d.ID)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// load restores jobs from disk and re-queues any that had not finished
+func (m *JobManager) load() error {
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var stored []storedJob
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	var pending []string
+	m.mu.Lock()
+	for _, s := range stored {
+		job := s.Job
+		job.ContentType = s.ContentType
+		job.Body = s.Body
+		m.jobs[job.ID] = &job
+		if job.Status == JobQueued || job.Status == JobRunning {
+			job.Status = JobQueued
+			pending = append(pending, job.ID)
+		}
+	}
+	m.mu.Unlock()
+	for _, id := range pending {
+		m.queue <- id
+	}
+	if len(pending) > 0 {
+		log.Printf("🔁 Re-queued %d unfinished jobs", len(pending))
+	}
+	return nil
+}
+
+// stored returns all jobs in their on-disk form
+func (m *JobManager) stored() []storedJob {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored := make([]storedJob, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		stored = append(stored, storedJob{Job: *job, ContentType: job.ContentType, Body: job.Body})
+	}
+	return stored
+}
+
+// Snapshot returns the contents of jobs.json for a backup
+func (m *JobManager) Snapshot() ([]byte, error) {
+	return json.Marshal(m.stored())
+}
+
+// persist writes all jobs to disk atomically
+func (m *JobManager) persist() {
+	if err := writeJSONFile(m.path, m.stored()); err != nil {
+		log.Printf("⚠️  Could not persist jobs: %v", err)
+	}
+}
+
+// cleanup periodically expires finished jobs
+func (m *JobManager) cleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.expire()
+	}
+}
+
+// SetTTL sets how long finished jobs are kept; zero keeps them forever
+func (m *JobManager) SetTTL(ttl time.Duration) {
+	m.mu.Lock()
+	m.ttl = ttl
+	m.mu.Unlock()
+}
+
+// RemovePayer drops every job paid for by address, queued ones included,
+// and returns how many were removed
+func (m *JobManager) RemovePayer(address string) int {
+	m.mu.Lock()
+	var removed []string
+	for id, job := range m.jobs {
+		if strings.EqualFold(job.Payer.Address, address) {
+			delete(m.jobs, id)
+			removed = append(removed, id)
+		}
+	}
+	m.mu.Unlock()
+	if len(removed) > 0 {
+		m.persist()
+	}
+	if m.shared != nil {
+		for _, id := range removed {
+			m.shared.Delete("job:" + id)
+		}
+	}
+	return len(removed)
+}
+
+// expire drops finished jobs whose last update is older than the TTL
+func (m *JobManager) expire() {
+	m.mu.Lock()
+	if m.ttl <= 0 {
+		m.mu.Unlock()
+		return
+	}
+	cutoff := m.clock.Now().Add(-m.ttl).Unix()
+	for id, job := range m.jobs {
+		if (job.Status == JobSucceeded || job.Status == JobFailed) && job.UpdatedAt < cutoff {
+			delete(m.jobs, id)
+		}
+	}
+	m.mu.Unlock()
+	m.persist()
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// writeJSONFile atomically replaces path with the JSON encoding of v
+func writeJSONFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// bufferedResponse captures a handler's response for later delivery
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   *bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK, body: new(bytes.Buffer)}
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
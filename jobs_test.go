@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsyncJobLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	jobs := NewJobManager(dir, 1, NewMetrics())
+
+	handler := jobs.Async("/api/echo", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"echo": body["msg"]})
+	})
+
+	req := httptest.NewRequest("POST", "/api/echo?async=true", strings.NewReader(`{"msg":"hi"}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("async request returned %d, want 202", rr.Code)
+	}
+
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &accepted)
+
+	var job Job
+	for i := 0; i < 100; i++ {
+		job, _ = jobs.Get(accepted.JobID)
+		if job.Status == JobSucceeded || job.Status == JobFailed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.Status != JobSucceeded {
+		t.Fatalf("job status = %s, want %s", job.Status, JobSucceeded)
+	}
+	if !strings.Contains(string(job.Result), `"echo":"hi"`) {
+		t.Errorf("unexpected job result: %s", job.Result)
+	}
+
+	// A fresh manager sees the persisted job
+	reloaded := NewJobManager(dir, 1, NewMetrics())
+	if got, ok := reloaded.Get(accepted.JobID); !ok || got.Status != JobSucceeded {
+		t.Errorf("job not restored after restart: %+v", got)
+	}
+}
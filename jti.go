@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenIDKeyPrefix marks token IDs (jti) that have paid for a request in
+// the shared state store
+const tokenIDKeyPrefix = "x402:jti:"
+
+// What a replayed payment reused, the kind label of x402_payment_replays_total
+const (
+	replayToken         = "token"         // a token's jti
+	replayAuthorization = "authorization" // an exact payment's authorization nonce
+	replaySettlement    = "settlement"    // the transaction behind a token
+	replayDebit         = "debit"         // a prepaid account debit ID
+)
+
+// paymentReplays counts payments refused as already spent
+var paymentReplays = &replayCounter{counts: make(map[string]int64)}
+
+type replayCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64 // kind -> refused payments
+}
+
+func (c *replayCounter) count(kind string) {
+	c.mu.Lock()
+	c.counts[kind]++
+	c.mu.Unlock()
+}
+
+// WriteMetrics emits replayed payments by what they reused
+func (c *replayCounter) WriteMetrics(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b.WriteString("# HELP x402_payment_replays_total Payments refused as already spent, by what was reused\n")
+	b.WriteString("# TYPE x402_payment_replays_total counter\n")
+	for _, kind := range []string{replayToken, replayAuthorization, replaySettlement, replayDebit} {
+		fmt.Fprintf(b, "x402_payment_replays_total{kind=%q} %d\n", kind, c.counts[kind])
+	}
+}
+
+// paymentSpentCode is the code of a 402 refusing a spent payment
+const paymentSpentCode = "payment_already_spent"
+
+// paymentClaim is a payment's hold on its key in the shared state store,
+// kept until the payment expires
+type paymentClaim struct {
+	key   string
+	owner string
+}
+
+// claimPayment sets key to a value of its own unless another request has,
+// which makes the claim a single atomic step on any replica. kind labels
+// a refusal in x402_payment_replays_total.
+func claimPayment(key, kind string, ttl time.Duration) (*paymentClaim, error) {
+	c := &paymentClaim{key: key, owner: newPaymentID()}
+	ok, err := sharedState.SetNX(key, c.owner, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("%s records unavailable: %w", kind, err)
+	}
+	if !ok {
+		paymentReplays.count(kind)
+		return nil, fmt.Errorf("%s already paid for a request", kind)
+	}
+	return c, nil
+}
+
+// release gives the payment back, for a request refused after the claim
+func (c *paymentClaim) release() {
+	if c != nil {
+		sharedState.DeleteIf(c.key, c.owner)
+	}
+}
+
+// claimTokenID spends a token, so it pays for one request only. A jti is
+// scoped to the token's issuer, or its subject if it names none, so
+// clients picking IDs independently do not collide; a token without a jti
+// is keyed by its hash. The claim is remembered until the token expires,
+// or for good if it is already past exp.
+func claimTokenID(token string, claims *PaymentToken, now time.Time) (*paymentClaim, error) {
+	key := tokenIDKeyPrefix + tokenIDScope(claims) + ":" + claims.ID
+	if claims.ID == "" {
+		sum := sha256.Sum256([]byte(token))
+		key = tokenIDKeyPrefix + "sha256:" + hex.EncodeToString(sum[:])
+	}
+	var ttl time.Duration
+	if exp := claims.ExpiresAt; exp != nil && exp.After(now) {
+		ttl = exp.Sub(now) + time.Minute
+	}
+	return claimPayment(key, replayToken, ttl)
+}
+
+// tokenIDScope is who picked a token's jti: its issuer, or its subject
+func tokenIDScope(claims *PaymentToken) string {
+	if claims.Issuer != "" {
+		return strings.ToLower(claims.Issuer)
+	}
+	return strings.ToLower(claims.Subject)
+}
+
+// spent reports whether failed refuses a payment as already spent, which a
+// client can only get past with a new payment
+func spent(failed []CheckFailure) bool {
+	for _, f := range failed {
+		if f.Check == CheckReplay {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPaywallTokenReplay(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), nil)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+
+	sign := func(id string) string {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Receiver = config.Receiver
+		claims.ID = id
+		// A payer of its own keeps a token without a jti unlike any
+		// other test's
+		claims.Subject = "0x" + randomNonce()[26:]
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		return signPaymentWithoutID(t, claims)
+	}
+	pay := func(token string) int {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment-Response", token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	replays := func() string {
+		var b strings.Builder
+		paymentReplays.WriteMetrics(&b)
+		return b.String()
+	}
+
+	before := paymentReplays.counts[replayToken]
+	token := sign(randomNonce())
+	if code := pay(token); code != http.StatusOK {
+		t.Fatalf("first use returned %d", code)
+	}
+	if code := pay(token); code != http.StatusPaymentRequired {
+		t.Errorf("replayed token returned %d, want 402", code)
+	}
+	if code := pay(sign(randomNonce())); code != http.StatusOK {
+		t.Errorf("fresh jti returned %d", code)
+	}
+	if got := paymentReplays.counts[replayToken]; got != before+1 {
+		t.Errorf("token replays = %d, want %d", got, before+1)
+	}
+	if !strings.Contains(replays(), `x402_payment_replays_total{kind="token"}`) {
+		t.Errorf("metrics = %s", replays())
+	}
+	if failures := paywall.Failures(); len(failures) != 1 || failures[0].Reason != "token already paid for a request" {
+		t.Errorf("failures = %+v", failures)
+	}
+
+	// Without a jti the token itself is remembered until it expires
+	untracked := sign("")
+	if code := pay(untracked); code != http.StatusOK {
+		t.Errorf("token without jti returned %d", code)
+	}
+	if code := pay(untracked); code != http.StatusPaymentRequired {
+		t.Errorf("replayed token without jti returned %d, want 402", code)
+	}
+
+	// A jti only collides with the same issuer's
+	shared := randomNonce()
+	for _, iss := range []string{"wallet-a", "wallet-b"} {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Receiver = config.Receiver
+		claims.Issuer = iss
+		claims.ID = shared
+		if code := pay(signPayment(t, claims)); code != http.StatusOK {
+			t.Errorf("jti from %s returned %d", iss, code)
+		}
+	}
+}
+
+func TestPaywallReleasesUncapturedPayment(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), nil)
+	refuse := true
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		if refuse {
+			chargeFromContext(r.Context()).refuse()
+			http.Error(w, `{"error":"Upstream data unavailable, payment not captured"}`, http.StatusServiceUnavailable)
+		}
+	})
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.001"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = config.Receiver
+	claims.ID = randomNonce()
+	token := signPayment(t, claims)
+	pay := func() int {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment-Response", token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// A request that does not capture the payment leaves it unspent
+	if code := pay(); code != http.StatusServiceUnavailable {
+		t.Fatalf("refused request returned %d", code)
+	}
+	refuse = false
+	if code := pay(); code != http.StatusOK {
+		t.Fatalf("token refused once returned %d, want it accepted", code)
+	}
+	if code := pay(); code != http.StatusPaymentRequired {
+		t.Errorf("captured token returned %d, want 402", code)
+	}
+}
+
+func TestPaywallConcurrentPayment(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), nil)
+
+	for _, id := range []string{randomNonce(), ""} {
+		// The handler holds the first request until the rest have raced it
+		arrived, proceed := make(chan struct{}, 2), make(chan struct{})
+		handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+			arrived <- struct{}{}
+			<-proceed
+		})
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Receiver = config.Receiver
+		claims.ID = id
+		claims.Subject = "0x" + randomNonce()[26:]
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		token := signPaymentWithoutID(t, claims)
+		pay := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "/api/gas", nil)
+			req.Header.Set("X-Payment-Response", token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		served := make(chan *httptest.ResponseRecorder, 1)
+		go func() { served <- pay() }()
+		<-arrived
+		var wg sync.WaitGroup
+		losers := make(chan *httptest.ResponseRecorder, 8)
+		for i := 0; i < cap(losers); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				losers <- pay()
+			}()
+		}
+		wg.Wait()
+		close(losers)
+		close(proceed)
+		if rr := <-served; rr.Code != http.StatusOK {
+			t.Errorf("jti %q: winner returned %d", id, rr.Code)
+		}
+		for rr := range losers {
+			var body struct {
+				Code    string             `json:"code"`
+				Retry   string             `json:"retry"`
+				Payment PaymentRequirement `json:"payment"`
+			}
+			json.NewDecoder(rr.Body).Decode(&body)
+			if rr.Code != http.StatusPaymentRequired || body.Code != paymentSpentCode || body.Retry != "new_payment" || body.Payment.MaxAmount != "0.001" || rr.Header().Get("X-Payment-Required") == "" {
+				t.Errorf("jti %q: loser returned %d %+v, want a retry with a new payment", id, rr.Code, body)
+			}
+		}
+
+		// Once served, the token is spent with or without a jti
+		if rr := pay(); rr.Code != http.StatusPaymentRequired {
+			t.Errorf("jti %q: reuse returned %d, want 402", id, rr.Code)
+		}
+	}
+}
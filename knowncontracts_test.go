@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestKnownContracts(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+
+	// A flaky honeypot verdict on Base WETH does not make it high risk
+	const weth = "0x4200000000000000000000000000000000000006"
+	up.SetContract(weth, testhttp.Contract{Verified: true, Proxy: true, Honeypot: true})
+	result, err := NewContractScanner().Scan(weth, "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Known != "Wrapped Ether (WETH)" || result.RiskScore != knownContractMaxRisk || len(result.Warnings) != 1 {
+		t.Errorf("WETH = %+v", result)
+	}
+	if token := scanToken(weth, "base"); token.Known == "" || token.RiskScore != knownContractMaxRisk {
+		t.Errorf("WETH token scan = %+v", token)
+	}
+
+	// The same contract on another chain is not recognized
+	if result, _ := NewContractScanner().Scan(weth, "ethereum"); result.Known != "" {
+		t.Errorf("WETH on ethereum = %+v", result)
+	}
+
+	// The config file extends the allowlist, and the blocklist overrides it
+	const vault = "0x00000000000000000000000000000000000a11e0"
+	up.SetContract(vault, testhttp.Contract{Honeypot: true})
+	cfg, err := parseRuntimeConfig([]byte(`{
+		"known_contracts": [{"name": "Treasury vault", "chain": "base", "address": "` + vault + `"}],
+		"blocklist": ["` + weth + `"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousConfig := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previousConfig)
+	if result, _ := NewContractScanner().Scan(vault, "base"); result.Known != "Treasury vault" || result.RiskScore != knownContractMaxRisk {
+		t.Errorf("configured contract = %+v", result)
+	}
+	if token := scanToken(weth, "base"); token.Known != "" || token.RiskScore != 100 {
+		t.Errorf("blocklisted WETH = %+v", token)
+	}
+}
+
+func TestKnownContractConfigValidation(t *testing.T) {
+	for _, bad := range []string{
+		`{"known_contracts": [{"name": "x", "chain": "base", "address": "0x12"}]}`,
+		`{"known_contracts": [{"name": "x", "chain": "solana", "address": "0x00000000000000000000000000000000000a11e0"}]}`,
+		`{"known_contracts": [{"chain": "base", "address": "0x00000000000000000000000000000000000a11e0"}]}`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(bad)); err == nil {
+			t.Errorf("accepted %s", bad)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ledger entry states
+const (
+	PaymentVerified = "verified"
+	PaymentSettled  = "settled" // a facilitator submitted the payment on-chain
+	PaymentFinal    = "final"   // its transfer is SETTLEMENT_FINALITY_BLOCKS deep
+	PaymentReorged  = "reorged" // a reorg dropped its transfer, or made it fail
+)
+
+// DefaultTenant is the ledger partition for requests not matched to a tenant
+const DefaultTenant = "default"
+
+// LedgerEntry records one captured payment
+type LedgerEntry struct {
+	ID        string  `json:"id"`
+	Tenant    string  `json:"tenant"`
+	Endpoint  string  `json:"endpoint"`
+	Payer     string  `json:"payer"`
+	Receiver  string  `json:"receiver"`
+	Network   string  `json:"network,omitempty"` // the payment was made on
+	Amount    string  `json:"amount"`
+	Asset     string  `json:"asset"`
+	AmountUSD float64 `json:"amount_usd"`
+	FiatPrice string  `json:"fiat_price,omitempty"` // e.g. "0.001 USD", if Amount was converted from it
+	Coupon    string  `json:"coupon,omitempty"`     // ID of the coupon that discounted or paid for the call
+	Credit    string  `json:"credit,omitempty"`     // "granted" if served from fallback data, "redeemed" if paid for by a credit
+	Account   string  `json:"account,omitempty"`    // "deposit" if it topped up a prepaid balance, "debit" if paid from one
+	TxHash    string  `json:"tx_hash,omitempty"`    // on-chain transfer that settled the payment, if verified
+	// Authorization is the signed transferWithAuthorization of an exact
+	// scheme payment, which the receiver submits to collect it
+	Authorization *ExactPayload `json:"authorization,omitempty"`
+	Status        string        `json:"status"`
+	CreatedAt     int64         `json:"created_at"`
+	TraceID       string        `json:"trace_id,omitempty"`
+
+	// Price experiment and variant the call was priced by, if any
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+
+	// Referral share, if an ERC-8004 agent referred the payer
+	Referrer        string  `json:"referrer,omitempty"`         // agent ID
+	ReferrerAddress string  `json:"referrer_address,omitempty"` // agent owner at payment time
+	ReferralAmount  string  `json:"referral_amount,omitempty"`  // share in Asset
+	ReferralUSD     float64 `json:"referral_usd,omitempty"`
+
+	// Valuation at payment time
+	AssetUSD     float64 `json:"asset_usd,omitempty"`     // USD price of one unit of Asset
+	FiatValue    float64 `json:"fiat_value,omitempty"`    // AmountUSD in FiatCurrency
+	FiatCurrency string  `json:"fiat_currency,omitempty"` // ACCOUNTING_CURRENCY, if set
+}
+
+// Ledger is an append-only record of payments, partitioned by tenant. Each
+// partition is a JSON-lines file under DATA_DIR/ledger.
+type Ledger struct {
+	mu      sync.RWMutex
+	dir     string
+	entries map[string][]LedgerEntry // tenant -> entries, oldest first
+}
+
+// NewLedger opens the ledger in dataDir/ledger, loading existing partitions
+func NewLedger(dataDir string) (*Ledger, error) {
+	l := &Ledger{
+		dir:     filepath.Join(dataDir, "ledger"),
+		entries: make(map[string][]LedgerEntry),
+	}
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(l.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		tenant := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+		entries, err := readLedgerFile(path)
+		if err != nil {
+			return nil, err
+		}
+		l.entries[tenant] = entries
+	}
+	return l, nil
+}
+
+func readLedgerFile(path string) ([]LedgerEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []LedgerEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A torn final line from a crash is skipped, not fatal
+			log.Printf("⚠️  Skipping bad ledger line in %s: %v", path, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// onPaymentVerified records a captured payment, traced as a "ledger.write"
+// span of the capture
+func (l *Ledger) onPaymentVerified(ctx context.Context, e Event) error {
+	entry := e.Data.(VerifiedPayment).Entry
+	_, span := tracer.Start(ctx, "ledger.write")
+	defer span.End()
+	if _, err := l.Record(entry); err != nil {
+		span.SetError(err.Error())
+		log.Printf("❌ Ledger write failed: id=%s endpoint=%s payer=%s trace=%s: %v", entry.ID, entry.Endpoint, entry.Payer, entry.TraceID, err)
+		return err
+	}
+	return nil
+}
+
+// onPaymentSettled marks a payment settled
+func (l *Ledger) onPaymentSettled(_ context.Context, e Event) error {
+	return l.Update(e.Data.(SettledPayment).Entry)
+}
+
+// onPaymentFinalized marks a payment final
+func (l *Ledger) onPaymentFinalized(_ context.Context, e Event) error {
+	return l.Update(e.Data.(FinalizedPayment).Entry)
+}
+
+// onPaymentReorged marks a payment reorged, if the reorg dropped its
+// transfer
+func (l *Ledger) onPaymentReorged(_ context.Context, e Event) error {
+	return l.Update(e.Data.(ReorgedPayment).Entry)
+}
+
+// Record appends an entry to its tenant's partition, filling in the ID,
+// status and timestamp if unset
+func (l *Ledger) Record(e LedgerEntry) (LedgerEntry, error) {
+	if e.ID == "" {
+		e.ID = newPaymentID()
+	}
+	if e.Tenant == "" {
+		e.Tenant = DefaultTenant
+	}
+	if e.Status == "" {
+		e.Status = PaymentVerified
+	}
+	if e.CreatedAt == 0 {
+		e.CreatedAt = time.Now().Unix()
+	}
+	if l == nil {
+		return e, nil
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(l.dir, e.Tenant+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return e, err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return e, err
+	}
+
+	l.entries[e.Tenant] = append(l.entries[e.Tenant], e)
+	return e, nil
+}
+
+// Entries returns a copy of one tenant's partition, newest first
+func (l *Ledger) Entries(tenant string) []LedgerEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	src := l.entries[tenant]
+	out := make([]LedgerEntry, len(src))
+	for i, e := range src {
+		out[len(src)-1-i] = e
+	}
+	return out
+}
+
+// Find returns the entry of payment id in tenant's partition
+func (l *Ledger) Find(tenant, id string) (LedgerEntry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, e := range l.entries[tenant] {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return LedgerEntry{}, false
+}
+
+// FindAuthorization returns the entry of the exact payment whose
+// authorization has nonce
+func (l *Ledger) FindAuthorization(nonce string) (LedgerEntry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, entries := range l.entries {
+		for _, e := range entries {
+			if e.Authorization != nil && strings.EqualFold(e.Authorization.Authorization.Nonce, nonce) {
+				return e, true
+			}
+		}
+	}
+	return LedgerEntry{}, false
+}
+
+// Update replaces the entry with e's ID in e's tenant partition and
+// rewrites the partition, unless the entry already equals e
+func (l *Ledger) Update(e LedgerEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := l.entries[e.Tenant]
+	for i := range entries {
+		if entries[i].ID != e.ID {
+			continue
+		}
+		if reflect.DeepEqual(entries[i], e) {
+			return nil
+		}
+		updated := slices.Clone(entries)
+		updated[i] = e
+		if err := writeLedgerFile(filepath.Join(l.dir, e.Tenant+".jsonl"), updated); err != nil {
+			return err
+		}
+		l.entries[e.Tenant] = updated
+		return nil
+	}
+	return fmt.Errorf("no ledger entry %s in tenant %s", e.ID, e.Tenant)
+}
+
+// Tenants returns the names of all partitions
+func (l *Ledger) Tenants() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	names := make([]string, 0, len(l.entries))
+	for name := range l.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Remove deletes every entry for which drop returns true and rewrites the
+// affected partitions. It returns the number of entries removed.
+func (l *Ledger) Remove(drop func(LedgerEntry) bool) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	removed := 0
+	for tenant, entries := range l.entries {
+		kept := make([]LedgerEntry, 0, len(entries))
+		for _, e := range entries {
+			if !drop(e) {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) == len(entries) {
+			continue
+		}
+		if err := writeLedgerFile(filepath.Join(l.dir, tenant+".jsonl"), kept); err != nil {
+			return removed, err
+		}
+		removed += len(entries) - len(kept)
+		l.entries[tenant] = kept
+	}
+	return removed, nil
+}
+
+// Snapshot returns every partition file's contents, keyed by path relative
+// to the data directory
+func (l *Ledger) Snapshot() (map[string][]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	files := make(map[string][]byte, len(l.entries))
+	for tenant, entries := range l.entries {
+		data, err := encodeLedger(entries)
+		if err != nil {
+			return nil, err
+		}
+		files["ledger/"+tenant+".jsonl"] = data
+	}
+	return files, nil
+}
+
+// encodeLedger encodes entries as JSON lines
+func encodeLedger(entries []LedgerEntry) ([]byte, error) {
+	var buf []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	return buf, nil
+}
+
+// writeLedgerFile replaces a partition file atomically
+func writeLedgerFile(path string, entries []LedgerEntry) error {
+	buf, err := encodeLedger(entries)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// handleAdminLedger serves GET /admin/ledger?tenant=<id>&limit=<n>
+func (l *Ledger) handleAdminLedger(w http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+
+	entries := l.Entries(tenant)
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	// Accept: text/csv returns the entries alone as a revenue report
+	writeNegotiated(w, r, map[string]interface{}{
+		"tenant":  tenant,
+		"tenants": l.Tenants(),
+		"entries": entries,
+	}, entries)
+}
+
+func newPaymentID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "pay_" + hex.EncodeToString(b)
+}
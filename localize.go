@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage is the language of every string in the code
+const defaultLanguage = "en"
+
+// languageTag matches the BCP 47 tags translations are keyed by, such as
+// "es" or "pt-br"
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// validateTranslations checks the "translations" section of the config
+// file: language tag -> English text -> translation
+func validateTranslations(t map[string]map[string]string) (map[string]map[string]string, error) {
+	out := make(map[string]map[string]string, len(t))
+	for tag, table := range t {
+		lang := strings.ToLower(strings.TrimSpace(tag))
+		if !languageTag.MatchString(lang) {
+			return nil, fmt.Errorf("translations: invalid language tag %q", tag)
+		}
+		if lang == defaultLanguage {
+			return nil, fmt.Errorf("translations: %q is the default language", tag)
+		}
+		if _, dup := out[lang]; dup {
+			return nil, fmt.Errorf("translations: duplicate language %q", tag)
+		}
+		for source, translated := range table {
+			if strings.TrimSpace(translated) == "" {
+				return nil, fmt.Errorf("translations: empty %s translation of %q", lang, source)
+			}
+		}
+		out[lang] = table
+	}
+	return out, nil
+}
+
+// Localizer translates English strings into one language. Strings without
+// a translation are left in English.
+type Localizer struct {
+	Lang    string
+	strings map[string]string
+}
+
+// T returns the translation of s
+func (l Localizer) T(s string) string {
+	if t, ok := l.strings[s]; ok {
+		return t
+	}
+	return s
+}
+
+// parseAcceptLanguage returns the languages in an Accept-Language header,
+// most preferred first. Ranges with q=0 are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var ranges []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	tags := make([]string, len(ranges))
+	for i, r := range ranges {
+		tags[i] = r.tag
+	}
+	return tags
+}
+
+// Localizer picks the most preferred language in acceptLanguage that has
+// translations, trying "pt" for "pt-br" too. English, or any language
+// without translations, gets English.
+func (c *RuntimeConfig) Localizer(acceptLanguage string) Localizer {
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		for lang := tag; lang != ""; {
+			if lang == defaultLanguage {
+				return Localizer{Lang: defaultLanguage}
+			}
+			if t, ok := c.translations[lang]; ok {
+				return Localizer{Lang: lang, strings: t}
+			}
+			i := strings.LastIndex(lang, "-")
+			if i < 0 {
+				break
+			}
+			lang = lang[:i]
+		}
+	}
+	return Localizer{Lang: defaultLanguage}
+}
+
+// localizer returns the Localizer for r's Accept-Language and labels the
+// response with the language chosen
+func localizer(w http.ResponseWriter, r *http.Request) Localizer {
+	l := runtimeConfig.Current().Localizer(r.Header.Get("Accept-Language"))
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", l.Lang)
+	return l
+}
+
+// localize translates q's description into the language r asked for
+func (q *quote) localize(r *http.Request) {
+	l := runtimeConfig.Current().Localizer(r.Header.Get("Accept-Language"))
+	q.description, q.lang = l.T(q.description), l.Lang
+}
+
+// localizeOASF translates the human-readable strings of an OASF manifest
+func localizeOASF(m *OASFManifest, l Localizer) {
+	m.Agent.Description = l.T(m.Agent.Description)
+	for i := range m.Skills {
+		s := &m.Skills[i]
+		s.Name, s.Description = l.T(s.Name), l.T(s.Description)
+		for j := range s.Examples {
+			e := &s.Examples[j]
+			e.Name, e.Description = l.T(e.Name), l.T(e.Description)
+		}
+		if s.Pricing != nil {
+			s.Pricing.Unit = l.T(s.Pricing.Unit)
+		}
+	}
+	for i := range m.Domains {
+		d := &m.Domains[i]
+		d.Name, d.Description = l.T(d.Name), l.T(d.Description)
+	}
+	for i := range m.Integrations {
+		m.Integrations[i].Description = l.T(m.Integrations[i].Description)
+	}
+}
+
+// localizeAgentCard translates the human-readable strings of an A2A agent
+// card, including the example prompts
+func localizeAgentCard(c *AgentCard, l Localizer) {
+	c.Description = l.T(c.Description)
+	for i := range c.Skills {
+		s := &c.Skills[i]
+		s.Name, s.Description = l.T(s.Name), l.T(s.Description)
+		for j := range s.Examples {
+			s.Examples[j] = l.T(s.Examples[j])
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalization(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(`{"translations": {
+		"es": {
+			"Get current Ethereum gas prices": "Obtener los precios actuales del gas de Ethereum",
+			"Real-time gas price monitoring with trend analysis": "Monitoreo del precio del gas en tiempo real",
+			"Gas Price Monitoring": "Monitoreo del precio del gas"
+		},
+		"pt-BR": {"Get current Ethereum gas prices": "Obter os preços atuais de gás do Ethereum"}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	for accept, want := range map[string]string{
+		"":                          "en",
+		"es":                        "es",
+		"es-MX,en;q=0.5":            "es",
+		"fr, pt;q=0.9, es;q=0.8":    "es", // no Portuguese without a region
+		"PT-br":                     "pt-br",
+		"en-US, es;q=0.9":           "en",
+		"de, es;q=0":                "en",
+		"es;q=0.4, pt-br;q=0.6, fr": "pt-br",
+	} {
+		if got := cfg.Localizer(accept).Lang; got != want {
+			t.Errorf("Accept-Language %q chose %q, want %q", accept, got, want)
+		}
+	}
+
+	// The 402 description
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	handler := NewPaywall(config, NewMetrics(), nil).Protect("/api/gas", "0.001", 0.001, "Get current Ethereum gas prices", func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest("GET", "/api/gas", nil)
+	req.Header.Set("Accept-Language", "es-ES")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var challenge struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(rr.Body).Decode(&challenge)
+	if challenge.Payment.Description != "Obtener los precios actuales del gas de Ethereum" || rr.Header().Get("Content-Language") != "es" {
+		t.Errorf("402 description = %q, Content-Language %q", challenge.Payment.Description, rr.Header().Get("Content-Language"))
+	}
+
+	// The OASF manifest and agent card, with untranslated strings left in English
+	req = httptest.NewRequest("GET", "/.well-known/oasf.json", nil)
+	req.Header.Set("Accept-Language", "es")
+	rr = httptest.NewRecorder()
+	handleOASFManifest(rr, req)
+	var manifest OASFManifest
+	json.NewDecoder(rr.Body).Decode(&manifest)
+	if manifest.Skills[0].Description != "Monitoreo del precio del gas en tiempo real" || manifest.Skills[0].Name != "Ethereum Gas Monitoring" {
+		t.Errorf("OASF skill = %q / %q", manifest.Skills[0].Name, manifest.Skills[0].Description)
+	}
+	if rr.Header().Get("Vary") != "Accept-Language" {
+		t.Errorf("OASF Vary = %q", rr.Header().Get("Vary"))
+	}
+
+	rr = httptest.NewRecorder()
+	handleAgentCard(rr, req)
+	var card AgentCard
+	json.NewDecoder(rr.Body).Decode(&card)
+	if card.Skills[0].Name != "Monitoreo del precio del gas" {
+		t.Errorf("agent card skill = %q", card.Skills[0].Name)
+	}
+
+	for _, bad := range []string{
+		`{"translations": {"english!": {"a": "b"}}}`,
+		`{"translations": {"en": {"a": "b"}}}`,
+		`{"translations": {"es": {"a": " "}}}`,
+		`{"translations": {"es": {}, "ES": {}}}`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(bad)); err == nil {
+			t.Errorf("%s: accepted", bad)
+		}
+	}
+}
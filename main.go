@@ -1,92 +1,78 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/arithmosquillsworth/x402-service/pkg/backup"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/kv"
+	"github.com/arithmosquillsworth/x402-service/pkg/respsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+	"google.golang.org/grpc"
 )
 
 // ServiceConfig holds the x402 configuration
 type ServiceConfig struct {
 	Price       string `json:"price"`
-	Asset       string `json:"asset"`
+	Asset       string   `json:"asset"`
+	Assets      []string `json:"assets,omitempty"` // accepted besides Asset
 	Network     string `json:"network"`
 	Receiver    string `json:"receiver"`
 	Description string `json:"description"`
 }
 
-// PaymentRequirement is what we send in 402 responses
-type PaymentRequirement struct {
-	Scheme      string `json:"scheme"`
-	Network     string `json:"network"`
-	MaxAmount   string `json:"maxAmount"`
-	MinAmount   string `json:"minAmount"`
-	Asset       string `json:"asset"`
-	Receiver    string `json:"receiver"`
-	Description string `json:"description"`
-}
-
-// X402Config is the full configuration object
-type X402Config struct {
-	Version             string               `json:"version"`
-	PaymentRequirements []PaymentRequirement `json:"paymentRequirements"`
-}
-
-// GasData represents current gas prices
-type GasData struct {
-	Timestamp int64              `json:"timestamp"`
-	Gas       map[string]float64 `json:"gas"`
-	Unit      string             `json:"unit"`
-	Source    string             `json:"source"`
-}
-
-// ValidatorData represents validator queue status
-type ValidatorData struct {
-	Timestamp   int64                  `json:"timestamp"`
-	Queue       map[string]interface{} `json:"queue"`
-	Active      int                    `json:"active_validators"`
-	PendingDeposits int                `json:"pending_deposits"`
-}
-
-// PaymentToken represents the JWT token structure for x402 payments
-type PaymentToken struct {
-	Payment struct {
-		Amount   string `json:"amount"`
-		Asset    string `json:"asset"`
-		Receiver string `json:"receiver"`
-		Network  string `json:"network"`
-	} `json:"payment"`
-	jwt.RegisteredClaims
-}
+// Wire types shared with the CLIs and client (see pkg/types)
+type (
+	PaymentRequirement = types.PaymentRequirement
+	X402Config         = types.X402Config
+	GasData            = types.GasData
+	ValidatorData      = types.ValidatorData
+	PaymentToken       = types.PaymentToken
+	PaymentClaims      = types.PaymentClaims
+	ExactPayment       = types.ExactPayment
+	ExactPayload       = types.ExactPayload
+	PaymentReceipt     = types.PaymentReceipt
+)
 
 // Metrics holds Prometheus-style metrics
 type Metrics struct {
 	mu sync.RWMutex
-	
+
 	// Request counters
 	requestsTotal    map[string]int64 // endpoint -> count
 	requestsByStatus map[string]map[string]int64 // endpoint -> status -> count
-	
+
 	// Payment counters
 	paymentsTotal    int64
 	paymentsByEndpoint map[string]int64 // endpoint -> count
+	paymentsByPayer    map[string]int64 // payer -> count
+	payerLastSeen      map[string]time.Time
 	paymentAmountUSD float64
-	
+
 	// Response time tracking (simple histogram buckets)
 	responseTimeBuckets map[string][]float64 // endpoint -> []durations
-	
+
 	// Start time for uptime
 	startTime time.Time
+	clock     clock.Clock
+
+	// Extra collectors appended to the exposition (gauges owned by other modules)
+	collectors []func(b *strings.Builder)
 }
 
 // NewMetrics creates a new metrics collector
@@ -95,8 +81,11 @@ func NewMetrics() *Metrics {
 		requestsTotal:       make(map[string]int64),
 		requestsByStatus:    make(map[string]map[string]int64),
 		paymentsByEndpoint:  make(map[string]int64),
+		paymentsByPayer:     make(map[string]int64),
+		payerLastSeen:       make(map[string]time.Time),
 		responseTimeBuckets: make(map[string][]float64),
-		startTime:          time.Now(),
+		startTime:          clock.System.Now(),
+		clock:              clock.System,
 	}
 }
 
@@ -104,9 +93,9 @@ func NewMetrics() *Metrics {
 func (m *Metrics) RecordRequest(endpoint, status string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+
 	m.requestsTotal[endpoint]++
-	
+
 	if m.requestsByStatus[endpoint] == nil {
 		m.requestsByStatus[endpoint] = make(map[string]int64)
 	}
@@ -114,20 +103,56 @@ func (m *Metrics) RecordRequest(endpoint, status string) {
 }
 
 // RecordPayment records a successful payment
-func (m *Metrics) RecordPayment(endpoint string, amountUSD float64) {
+func (m *Metrics) RecordPayment(endpoint, payer string, amountUSD float64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+
 	atomic.AddInt64(&m.paymentsTotal, 1)
 	m.paymentsByEndpoint[endpoint]++
+	m.paymentsByPayer[payer]++
+	m.payerLastSeen[payer] = m.clock.Now()
 	m.paymentAmountUSD += amountUSD
 }
 
+// onPaymentVerified records a captured payment
+func (m *Metrics) onPaymentVerified(_ context.Context, e Event) error {
+	entry := e.Data.(VerifiedPayment).Entry
+	m.RecordPayment(entry.Endpoint, entry.Payer, entry.AmountUSD)
+	return nil
+}
+
+// ForgetPayer drops the per-payer counters for payer
+func (m *Metrics) ForgetPayer(payer string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.paymentsByPayer[payer]
+	delete(m.paymentsByPayer, payer)
+	delete(m.payerLastSeen, payer)
+	return ok
+}
+
+// PrunePayers drops the counters of payers not seen since before
+func (m *Metrics) PrunePayers(before time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pruned := 0
+	for payer, seen := range m.payerLastSeen {
+		if seen.Before(before) {
+			delete(m.paymentsByPayer, payer)
+			delete(m.payerLastSeen, payer)
+			pruned++
+		}
+	}
+	return pruned
+}
+
 // RecordResponseTime records response duration
 func (m *Metrics) RecordResponseTime(endpoint string, duration time.Duration) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+
 	m.responseTimeBuckets[endpoint] = append(m.responseTimeBuckets[endpoint], duration.Seconds())
 	// Keep last 1000 samples per endpoint
 	if len(m.responseTimeBuckets[endpoint]) > 1000 {
@@ -135,25 +160,32 @@ func (m *Metrics) RecordResponseTime(endpoint string, duration time.Duration) {
 	}
 }
 
+// RegisterCollector adds a function that writes additional metrics
+func (m *Metrics) RegisterCollector(fn func(b *strings.Builder)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.collectors = append(m.collectors, fn)
+}
+
 // PrometheusFormat returns metrics in Prometheus exposition format
 func (m *Metrics) PrometheusFormat() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	
+
 	var b strings.Builder
-	uptime := time.Since(m.startTime).Seconds()
-	
+	uptime := clock.Since(m.clock, m.startTime).Seconds()
+
 	// HELP and TYPE
 	b.WriteString("# HELP x402_uptime_seconds Service uptime\n")
 	b.WriteString("# TYPE x402_uptime_seconds gauge\n")
 	b.WriteString(fmt.Sprintf("x402_uptime_seconds %.2f\n", uptime))
-	
+
 	b.WriteString("# HELP x402_requests_total Total requests by endpoint\n")
 	b.WriteString("# TYPE x402_requests_total counter\n")
 	for endpoint, count := range m.requestsTotal {
 		b.WriteString(fmt.Sprintf("x402_requests_total{endpoint=\"%s\"} %d\n", endpoint, count))
 	}
-	
+
 	b.WriteString("# HELP x402_requests_by_status_total Requests by endpoint and status\n")
 	b.WriteString("# TYPE x402_requests_by_status_total counter\n")
 	for endpoint, statuses := range m.requestsByStatus {
@@ -161,21 +193,27 @@ func (m *Metrics) PrometheusFormat() string {
 			b.WriteString(fmt.Sprintf("x402_requests_by_status_total{endpoint=\"%s\",status=\"%s\"} %d\n", endpoint, status, count))
 		}
 	}
-	
+
 	b.WriteString("# HELP x402_payments_total Total successful payments\n")
 	b.WriteString("# TYPE x402_payments_total counter\n")
 	b.WriteString(fmt.Sprintf("x402_payments_total %d\n", atomic.LoadInt64(&m.paymentsTotal)))
-	
+
 	b.WriteString("# HELP x402_payments_by_endpoint_total Payments by endpoint\n")
 	b.WriteString("# TYPE x402_payments_by_endpoint_total counter\n")
 	for endpoint, count := range m.paymentsByEndpoint {
 		b.WriteString(fmt.Sprintf("x402_payments_by_endpoint_total{endpoint=\"%s\"} %d\n", endpoint, count))
 	}
-	
+
+	b.WriteString("# HELP x402_payments_by_payer_total Payments by payer identity\n")
+	b.WriteString("# TYPE x402_payments_by_payer_total counter\n")
+	for payer, count := range m.paymentsByPayer {
+		b.WriteString(fmt.Sprintf("x402_payments_by_payer_total{payer=\"%s\"} %d\n", payer, count))
+	}
+
 	b.WriteString("# HELP x402_payment_amount_usd_total Total payment amount in USD\n")
 	b.WriteString("# TYPE x402_payment_amount_usd_total counter\n")
 	b.WriteString(fmt.Sprintf("x402_payment_amount_usd_total %.6f\n", m.paymentAmountUSD))
-	
+
 	// Response time histograms
 	b.WriteString("# HELP x402_response_time_seconds Response time in seconds\n")
 	b.WriteString("# TYPE x402_response_time_seconds histogram\n")
@@ -209,37 +247,48 @@ func (m *Metrics) PrometheusFormat() string {
 		b.WriteString(fmt.Sprintf("x402_response_time_seconds_sum{endpoint=\"%s\"} %.6f\n", endpoint, sum))
 		b.WriteString(fmt.Sprintf("x402_response_time_seconds_count{endpoint=\"%s\"} %d\n", endpoint, count))
 	}
-	
+
+	for _, collect := range m.collectors {
+		collect(&b)
+	}
+
 	return b.String()
 }
 
 func main() {
-	// Load config from env or use defaults
-	receiver := getEnv("RECEIVER_ADDRESS", "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91")
 	port := getEnv("PORT", "8080")
 	metricsPort := getEnv("METRICS_PORT", "9090")
-	rpcURL := getEnv("ETH_RPC_URL", "https://eth.drpc.org")
 
-	config := ServiceConfig{
-		Price:       "0.001",
-		Asset:       "USDC",
-		Network:     "base",
-		Receiver:    receiver,
-		Description: "Arithmos API - Real-time Ethereum data",
+	svc, err := newService()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
-	// Initialize metrics
-	metrics := NewMetrics()
+	// Hand over leadership at once instead of waiting for the lease to lapse
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+		svc.leader.Resign()
+		os.Exit(0)
+	}()
 
-	// Create RPC client
-	rpcClient := &RPCClient{url: rpcURL}
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			if err := runtimeConfig.Reload(); err != nil {
+				log.Printf("⚠️  Config reload failed, keeping previous config: %v", err)
+			}
+		}
+	}()
 
 	// Start metrics server on separate port (internal monitoring only)
 	go func() {
 		metricsMux := http.NewServeMux()
 		metricsMux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-			w.Write([]byte(metrics.PrometheusFormat()))
+			w.Write([]byte(svc.metrics.PrometheusFormat()))
 		})
 		addr := "0.0.0.0:" + metricsPort
 		log.Printf("📊 Metrics server starting on %s (internal)", addr)
@@ -248,6 +297,197 @@ func main() {
 		}
 	}()
 
+	// gRPC server for scan, preflight, gas and price (separate port)
+	if grpcPort := grpcPort(); grpcPort != "" {
+		go func() {
+			lis, err := net.Listen("tcp", ":"+grpcPort)
+			if err != nil {
+				log.Printf("❌ gRPC listen error: %v", err)
+				return
+			}
+			log.Printf("🔌 gRPC server starting on :%s", grpcPort)
+			if err := svc.grpc.Serve(lis); err != nil {
+				log.Printf("❌ gRPC server error: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("🚀 x402 service starting on :%s", port)
+	log.Printf("💰 Receiver: %s", svc.config.Receiver)
+	log.Printf("⛽ ETH RPC: %s", svc.rpcURL)
+	log.Fatal(http.ListenAndServe(":"+port, svc.handler))
+}
+
+// service is the assembled HTTP and gRPC API. main serves it; end-to-end
+// tests build one against fake upstreams.
+type service struct {
+	handler http.Handler
+	grpc    *grpc.Server
+	metrics *Metrics
+	leader  *Leader
+	config  ServiceConfig
+	rpcURL  string
+}
+
+// newService wires up the paywall, data and security APIs from the
+// environment. It starts background workers but does not listen.
+func newService() (*service, error) {
+	// Load config from env or use defaults
+	receiver := getEnv("RECEIVER_ADDRESS", "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91")
+	rpcURL := getEnv("ETH_RPC_URL", defaultRPCURL)
+	bundlerURL := getEnv("BUNDLER_URL", "") // ERC-4337 bundler for user operations
+	dataDir := getEnv("DATA_DIR", "./data")
+
+	config := ServiceConfig{
+		Price:       "0.001",
+		Asset:       getEnv("PAYMENT_ASSET", "USDC"),
+		Network:     "base",
+		Receiver:    receiver,
+		Description: "Arithmos API - Real-time Ethereum data",
+	}
+	assets, err := parsePaymentAssets(os.Getenv("PAYMENT_ASSETS"), config.Asset)
+	if err != nil {
+		return nil, fmt.Errorf("PAYMENT_ASSETS: %w", err)
+	}
+	config.Assets = assets
+
+	// Sandbox: accept test-network tokens without recording revenue
+	sandboxMode, err := ParseSandboxMode(os.Getenv("SANDBOX_MODE"))
+	if err != nil {
+		return nil, fmt.Errorf("SANDBOX_MODE: %w", err)
+	}
+	sandbox := SandboxPolicy{Mode: sandboxMode, Network: getEnv("SANDBOX_NETWORK", defaultSandboxNetwork)}
+	if sandbox.Mode == SandboxOnly {
+		config.Network = sandbox.Network
+		log.Printf("🧪 Sandbox deployment: payments on %s, nothing is recorded", sandbox.Network)
+	}
+
+	// Opt-in detached signatures on paid responses
+	responseSigner = nil
+	if seed := os.Getenv("RESPONSE_SIGNING_KEY"); seed != "" {
+		key, err := respsig.ParsePrivateKey(seed)
+		if err != nil {
+			return nil, fmt.Errorf("RESPONSE_SIGNING_KEY: %w", err)
+		}
+		responseSigner = NewResponseSigner(key)
+		log.Printf("✍️  Signing paid responses with key %s", respsig.KeyID(responseSigner.PublicKey()))
+	}
+
+	// Trusted execution environment attestation, if running in one
+	attester, err = detectAttester(os.Getenv("TEE_ATTESTATION"))
+	if err != nil {
+		return nil, fmt.Errorf("TEE_ATTESTATION: %w", err)
+	}
+	if attester != nil {
+		log.Printf("🔒 Running in a TEE (%s), serving /.well-known/attestation", attester.Platform())
+	}
+
+	// Payment lifecycle tracing
+	tracer, err = newTracer(os.Getenv("TRACING"))
+	if err != nil {
+		return nil, fmt.Errorf("TRACING: %w", err)
+	}
+
+	// Checks of paid responses against their declared output schemas
+	responseSchemas, err = NewResponseSchemas(os.Getenv("RESPONSE_SCHEMAS"))
+	if err != nil {
+		return nil, fmt.Errorf("RESPONSE_SCHEMAS: %w", err)
+	}
+
+	// State shared between replicas, in-process unless SHARED_STATE_URL is set
+	if sharedState != nil {
+		sharedState.Close()
+	}
+	sharedState, err = kv.Open(os.Getenv("SHARED_STATE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("SHARED_STATE_URL: %w", err)
+	}
+	if isShared(sharedState) {
+		log.Printf("🔗 Sharing rate limits and job status across replicas")
+	}
+
+	// Background tasks; singleton tasks run only on the elected leader
+	leader := NewLeader(sharedState, "scheduler")
+	leader.Campaign()
+	go leader.Run()
+	scheduler := NewScheduler(leader)
+
+	// Initialize metrics
+	metrics := NewMetrics()
+	metrics.RegisterCollector(WriteBuildInfo)
+	metrics.RegisterCollector(scheduler.WriteMetrics)
+
+	// Experimental features, switchable via env, config or admin API
+	if err := featureFlags.ParseEnv(os.Getenv("FEATURE_FLAGS")); err != nil {
+		return nil, fmt.Errorf("FEATURE_FLAGS: %w", err)
+	}
+	metrics.RegisterCollector(featureFlags.WriteMetrics)
+	log.Printf("🏷️  Build: version=%s commit=%s date=%s", buildInfo.Version, buildInfo.Commit, buildInfo.BuildDate)
+
+	// Bound concurrent calls per upstream provider
+	upstreamLimiter.SetDefaults(getEnvInt("UPSTREAM_MAX_CONCURRENCY", 4), time.Duration(getEnvInt("UPSTREAM_QUEUE_TIMEOUT_SEC", 15))*time.Second)
+	if err := upstreamLimiter.ParseLimits(os.Getenv("UPSTREAM_LIMITS")); err != nil {
+		return nil, fmt.Errorf("UPSTREAM_LIMITS: %w", err)
+	}
+	metrics.RegisterCollector(upstreamLimiter.WriteMetrics)
+
+	// Per-key budget for explorer API calls
+	explorerKeys.SetBudget(getEnvInt("EXPLORER_RATE_PER_SEC", 5), time.Duration(getEnvInt("EXPLORER_QUEUE_TIMEOUT_SEC", 30))*time.Second)
+	metrics.RegisterCollector(explorerKeys.WriteMetrics)
+
+	// Shared cache of explorer ABI, source and creation lookups
+	explorerCache = NewExplorerCache(upstreamHTTP, time.Duration(getEnvInt("EXPLORER_CACHE_TTL_MIN", 60))*time.Minute, time.Duration(getEnvInt("EXPLORER_NEGATIVE_TTL_MIN", 10))*time.Minute)
+	metrics.RegisterCollector(explorerCache.WriteMetrics)
+
+	// Hot-reloadable config: prices, chains, patterns, blocklist
+	runtimeConfig.SetPath(os.Getenv("CONFIG_FILE"))
+	if err := runtimeConfig.Reload(); err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+
+	// Create RPC client
+	rpcClient := &RPCClient{url: rpcURL}
+
+	// Beacon nodes, tried in order
+	beaconClient = NewBeaconClient(strings.Split(getEnv("BEACON_API_URL", defaultBeaconURL), ","), time.Duration(getEnvInt("BEACON_TIMEOUT_SEC", 60))*time.Second)
+	scheduler.Every("validator-refresh", beaconEpoch, beaconClient.RefreshValidators)
+
+	// Upstream providers, optionally swapped for in-memory mocks
+	providers = liveProviders(rpcClient)
+	if err := providers.Configure(os.Getenv("PROVIDERS")); err != nil {
+		return nil, fmt.Errorf("PROVIDERS: %w", err)
+	}
+
+	// Notification channels come from the config file
+	notifier := NewNotifier()
+	metrics.RegisterCollector(notifier.WriteMetrics)
+	sloWindow := time.Duration(getEnvInt("SLO_WINDOW_SEC", 300)) * time.Second
+	slo := NewSLOWatch(metrics, notifier, float64(getEnvInt("SLO_ERROR_RATE_PCT", 5))/100, int64(getEnvInt("SLO_MIN_REQUESTS", 20)), sloWindow)
+	scheduler.Every("slo-check", sloWindow, slo.Check)
+	anomalyWindow := time.Duration(getEnvInt("ANOMALY_WINDOW_SEC", 300)) * time.Second
+	anomalies := NewAnomalyDetector(AnomalyPolicy{
+		MinEvents:   getEnvInt("ANOMALY_MIN_EVENTS", 20),
+		SpikeFactor: float64(getEnvInt("ANOMALY_SPIKE_FACTOR", 3)),
+		PayerShare:  float64(getEnvInt("ANOMALY_PAYER_SHARE_PCT", 90)) / 100,
+		NearMiss:    float64(getEnvInt("ANOMALY_NEAR_MISS_PCT", 10)) / 100,
+	}, anomalyWindow, notifier)
+	scheduler.Every("anomaly-check", anomalyWindow, anomalies.Check)
+
+	// Stablecoin peg checks, run by the leader and synced to every replica
+	depegAction, err := ParseDepegAction(os.Getenv("DEPEG_MONITOR"))
+	if err != nil {
+		return nil, fmt.Errorf("DEPEG_MONITOR: %w", err)
+	}
+	var peg *PegMonitor
+	if depegAction != DepegOff {
+		interval := time.Duration(getEnvInt("DEPEG_CHECK_INTERVAL_SEC", 60)) * time.Second
+		peg = NewPegMonitor(sharedState, append([]string{config.Asset}, config.Assets...), depegAction, float64(getEnvInt("DEPEG_THRESHOLD_PCT", 2))/100, 5*interval)
+		scheduler.Singleton("peg-check", interval, peg.Check)
+		scheduler.Every("peg-sync", 15*time.Second, peg.Sync)
+		peg.SetNotifier(notifier)
+		metrics.RegisterCollector(peg.WriteMetrics)
+	}
+
 	mux := http.NewServeMux()
 
 	// Health check (free)
@@ -259,677 +499,729 @@ func main() {
 			"service":   "arithmos-x402",
 			"agent":     "Arithmos Quillsworth",
 			"erc8004":   "1941",
+			"version":   buildInfo.Version,
+			"commit":    buildInfo.Commit,
+			"leader":    leader.IsLeader(),
 			"timestamp": time.Now().Unix(),
 		})
 		metrics.RecordRequest("/health", "200")
 		metrics.RecordResponseTime("/health", time.Since(start))
 	})
 
+	// Build metadata (free)
+	mux.HandleFunc("/version", handleVersion)
+
+	// Public status page (free, cached for a minute)
+	status := NewStatusHistory(metrics, upstreamLimiter)
+	scheduler.Every("status-sample", time.Minute, status.Sample)
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		status.handleStatus(w, r)
+		metrics.RecordRequest("/status", "200")
+		metrics.RecordResponseTime("/status", time.Since(start))
+	})
+
+	ledger, err := NewLedger(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("ledger: %w", err)
+	}
+	paywall := NewPaywall(config, metrics, ledger)
+
 	// x402 config endpoint
 	mux.HandleFunc("/.well-known/x402", func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		w.Header().Set("Content-Type", "application/json")
+		reqs, err := paywall.Requirements(r)
+		if err != nil {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, `{"error":"Pricing unavailable, try again shortly"}`, http.StatusServiceUnavailable)
+			metrics.RecordRequest("/.well-known/x402", "503")
+			return
+		}
+		// One requirement per paid route, network and asset, at the price a
+		// challenge for that route would quote
 		x402 := X402Config{
-			Version: "1.0",
-			PaymentRequirements: []PaymentRequirement{
-				{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   config.Price,
-					MinAmount:   config.Price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: config.Description,
-				},
-			},
+			Version:             "1.0",
+			PaymentRequirements: reqs,
+			Assets:              peg.Statuses(),
 		}
-		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(x402)
 		metrics.RecordRequest("/.well-known/x402", "200")
 		metrics.RecordResponseTime("/.well-known/x402", time.Since(start))
 	})
 
-	// Protected endpoint - real gas prices
-	mux.HandleFunc("/api/gas", func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		price := "0.001" // USDC
-		priceFloat := 0.001
-
-		// Check for x402 payment
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Get current Ethereum gas prices",
-				},
-			})
-			metrics.RecordRequest("/api/gas", "402")
-			metrics.RecordResponseTime("/api/gas", time.Since(start))
-			return
+	// Side effects of payments, scans and upstream failures subscribe to the event bus
+	events = NewEventBus()
+	metrics.RegisterCollector(events.WriteMetrics)
+	paywall.SetEvents(events)
+	events.Subscribe(EventPaymentVerified, "anomaly", anomalies.onPaymentVerified)
+	events.Subscribe(EventPaymentVerified, "notifier", notifier.onPaymentVerified)
+	events.Subscribe(EventPaymentSettled, "notifier", notifier.onPaymentSettled)
+	// Conversion of each price variant, from challenge to payment
+	experiments := NewExperiments()
+	paywall.SetExperiments(experiments)
+	events.Subscribe(EventPaymentVerified, "experiments", experiments.onPaymentVerified)
+	metrics.RegisterCollector(experiments.WriteMetrics)
+	events.Subscribe(EventScanCompleted, "token-snapshots", onScanCompleted)
+	riskHistory, err := NewRiskHistory(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("risk history: %w", err)
+	}
+	events.Subscribe(EventScanCompleted, "risk-history", riskHistory.onScanCompleted)
+	events.Subscribe(EventUpstreamDegraded, "notifier", notifier.onUpstreamDegraded)
+
+	// Shed free, then cheap paid requests when saturated
+	shedder := NewLoadShedder(getEnvInt("LOAD_SHED_MAX_INFLIGHT", 0), float64(getEnvInt("LOAD_SHED_FREE_AT_PCT", 80))/100, upstreamLimiter)
+	if shedder.freeAt <= 0 || shedder.freeAt >= 1 {
+		return nil, fmt.Errorf("LOAD_SHED_FREE_AT_PCT must be between 1 and 99")
+	}
+	paywall.SetLoadShedder(shedder)
+	metrics.RegisterCollector(shedder.WriteMetrics)
+	paywall.SetSandbox(sandbox)
+	paywall.SetAnomalyDetector(anomalies)
+
+	// Prices set in fiat are converted into the payment asset per challenge
+	pricing, err := NewPriceConverter(config.Asset, os.Getenv("PRICE_CURRENCY"))
+	if err != nil {
+		return nil, fmt.Errorf("PAYMENT_ASSET/PRICE_CURRENCY: %w", err)
+	}
+	refresh, maxAge := time.Duration(getEnvInt("PRICE_RATE_REFRESH_SEC", 60))*time.Second, time.Duration(getEnvInt("PRICE_RATE_MAX_AGE_SEC", 600))*time.Second
+	tolerance := float64(getEnvInt("PRICE_TOLERANCE_PCT", 2)) / 100
+	pricing.SetLimits(refresh, maxAge, tolerance)
+	paywall.SetPricing(pricing)
+	// The other accepted assets are priced from the same prices. Without a
+	// PRICE_CURRENCY those are amounts of a stablecoin, so worth as many USD.
+	plainCurrency := os.Getenv("PRICE_CURRENCY")
+	if plainCurrency == "" {
+		plainCurrency = "usd"
+	}
+	var others []*PriceConverter
+	for _, asset := range config.Assets {
+		conv, err := NewPriceConverter(asset, plainCurrency)
+		if err != nil {
+			return nil, fmt.Errorf("PAYMENT_ASSETS: %w", err)
+		}
+		conv.SetLimits(refresh, maxAge, tolerance)
+		others = append(others, conv)
+	}
+	paywall.SetAssets(others)
+	if currency := strings.ToLower(os.Getenv("ACCOUNTING_CURRENCY")); currency != "" {
+		if !priceCurrencies[currency] {
+			return nil, fmt.Errorf("ACCOUNTING_CURRENCY: unsupported currency %q - use %s", currency, optionList(priceCurrencies))
+		}
+		paywall.SetAccountingCurrency(currency)
+	}
+
+	paywall.SetPegMonitor(peg)
+	perMinute, burst := getEnvInt("RATE_LIMIT_PER_MINUTE", 0), 0
+	if perMinute > 0 {
+		burst = getEnvInt("RATE_LIMIT_BURST", perMinute)
+		paywall.SetRateLimit(newRateLimit("paid", perMinute, burst))
+	}
+	coupons := NewCoupons(os.Getenv("COUPON_SECRET"))
+	paywall.SetCoupons(coupons)
+	// Prepaid balances, debited per call with a signed X-Account-Debit
+	var accounts *Accounts
+	if os.Getenv("PREPAID_ACCOUNTS") == "true" {
+		accounts = NewAccounts(config.Asset)
+		paywall.SetAccounts(accounts)
+		metrics.RegisterCollector(accounts.WriteMetrics)
+	}
+
+	// Endpoints whose paid requests must be signed by the payer
+	signedRequests := parseSignedRequests(os.Getenv("SIGNED_REQUESTS"))
+	paywall.SetSignedRequests(signedRequests)
+
+	// Keys payment tokens are signed with. Without one every token is
+	// refused. PAYMENT_SIGNING_KEY is the older name of X402_SIGNING_KEY.
+	keys, err := parsePaymentKeys(os.Getenv("X402_SIGNING_KEYS"))
+	if err != nil {
+		return nil, fmt.Errorf("X402_SIGNING_KEYS: %w", err)
+	}
+	if key := getEnv("X402_SIGNING_KEY", os.Getenv("PAYMENT_SIGNING_KEY")); key != "" {
+		keys[""] = []byte(key)
+	}
+	paymentKeys.Set(keys, time.Duration(getEnvInt("PAYMENT_LEEWAY_SEC", int(defaultTokenLeeway.Seconds())))*time.Second)
+	paymentKeys.SetMaxLifetime(time.Duration(getEnvInt("PAYMENT_MAX_LIFETIME_SEC", 0)) * time.Second)
+	if len(keys) == 0 {
+		log.Printf("⚠️  No X402_SIGNING_KEY: payment tokens will be refused")
+	}
+
+	// Strict payment validation, and refused tokens' failed checks in the 402
+	var strict *StrictPayments
+	if os.Getenv("STRICT_PAYMENTS") == "true" {
+		strict = &StrictPayments{Audience: os.Getenv("PAYMENT_AUDIENCE")}
+		if strict.Audience == "" {
+			return nil, fmt.Errorf("STRICT_PAYMENTS requires PAYMENT_AUDIENCE")
+		}
+		paywall.SetStrictPayments(strict)
+		log.Printf("🔐 Strict payments: signed tokens for audience %s only", strict.Audience)
+	}
+	paymentDiagnostics := os.Getenv("PAYMENT_DIAGNOSTICS") == "true"
+	paywall.SetPaymentDiagnostics(paymentDiagnostics)
+
+	// On-chain settlement: tokens must name a confirmed transfer to the receiver
+	settlementRPCs := networkRPCs()
+	settlementRPCs["base"] = getEnv("SETTLEMENT_RPC_URL", settlementRPCs["base"])
+	settlementRPCs["base-sepolia"] = getEnv("SETTLEMENT_SANDBOX_RPC_URL", settlementRPCs["base-sepolia"])
+	settlementRPCs["ethereum"] = getEnv("SETTLEMENT_ETHEREUM_RPC_URL", settlementRPCs["ethereum"])
+	settlementRPCs["polygon"] = getEnv("SETTLEMENT_POLYGON_RPC_URL", settlementRPCs["polygon"])
+	settlementVerify := os.Getenv("SETTLEMENT_VERIFY") == "true"
+	if settlementVerify {
+		settlement := NewSettlementVerifier(settlementRPCs, int64(getEnvInt("SETTLEMENT_CONFIRMATIONS", 2)))
+		paywall.SetSettlement(settlement)
+		metrics.RegisterCollector(settlement.WriteMetrics)
+		log.Printf("⛓️  Settlement verification: payments need %d confirmations", settlement.confirmations)
+	}
+	// Payments stay unfinished until their transfer is deep enough to
+	// survive a reorg
+	if depth := getEnvInt("SETTLEMENT_FINALITY_BLOCKS", 0); depth > 0 {
+		finality := NewFinality(ledger, events, settlementRPCs, int64(depth))
+		events.Subscribe(EventPaymentFinalized, "ledger", ledger.onPaymentFinalized)
+		events.Subscribe(EventPaymentReorged, "ledger", ledger.onPaymentReorged)
+		events.Subscribe(EventPaymentReorged, "notifier", notifier.onPaymentReorged)
+		scheduler.Every("settlement-finality", finalityInterval, finality.Check)
+		metrics.RegisterCollector(finality.WriteMetrics)
+		log.Printf("⛓️  Settlement finality: payments are final at %d confirmations", finality.depth)
+	}
+	// x402 facilitator: verifies and settles exact payments
+	if url := os.Getenv("FACILITATOR_URL"); url != "" {
+		facilitator := NewFacilitatorClient(url)
+		paywall.SetFacilitator(facilitator)
+		metrics.RegisterCollector(facilitator.WriteMetrics)
+		log.Printf("🤝 Facilitator: exact payments verified and settled by %s", facilitator.url)
+	}
+	// Facilitators that settle asynchronously call back once the transfer is mined
+	if secret := os.Getenv("FACILITATOR_WEBHOOK_SECRET"); secret != "" {
+		webhook := NewFacilitatorWebhook(secret, ledger, events)
+		mux.HandleFunc("/webhooks/facilitator", postOnly(webhook.handleCallback))
+		metrics.RegisterCollector(webhook.WriteMetrics)
+	}
+	agents := NewAgentRegistry(getEnv("ERC8004_RPC_URL", defaultERC8004RPC), getEnv("ERC8004_REGISTRY", defaultERC8004Registry))
+	referrals := NewReferrals(agents, float64(getEnvInt("REFERRAL_SHARE_PCT", 0)))
+	paywall.SetReferrals(referrals)
+
+	// Capability probe for SDK feature negotiation
+	mux.HandleFunc("/capabilities", handleCapabilities(Capabilities{
+		Version: "1.0",
+		Payment: PaymentCapabilities{
+			Schemes:         []string{"x402"},
+			Network:         config.Network,
+			Assets:          append([]string{config.Asset}, config.Assets...),
+			Coupons:         coupons != nil,
+			Referrals:       referrals != nil,
+			PrepaidAccounts: accounts != nil,
+			SignedResponses: responseSigner != nil,
+			SignedRequests:  signedRequests,
+			Attestation:     attester != nil,
+			StrictPayments:  strict != nil,
+			Diagnostics:     paymentDiagnostics,
+			Settlement:      settlementVerify,
+		},
+		Sandbox: SandboxCapabilities{Available: sandbox.Mode != SandboxOff, Mode: sandbox.Mode, Network: sandbox.Network},
+		Transports: TransportCapabilities{
+			HTTP:      true,
+			GraphQL:   "/graphql",
+			GRPCPort:  grpcPort(),
+			MCP:       "/mcp",
+			A2A:       "/.well-known/agent-card.json",
+			AsyncJobs: true,
+			Streaming: []string{},
+		},
+		Formats: []string{mediaJSON, mediaMsgPack, mediaCSV},
+		Limits: LimitCapabilities{
+			MaxRequestBytes:    maxRequestBytes,
+			MaxSafeBatchCalls:  maxSafeBatch,
+			RateLimitPerMinute: perMinute,
+			RateLimitBurst:     burst,
+		},
+	}))
+
+	// Decoy paid endpoints, never advertised: whoever calls them is scanning
+	decoyPaths := parseDecoyPaths(os.Getenv("HONEYTOKEN_PATHS"))
+	var abuse *Abuse
+	if len(decoyPaths) > 0 {
+		scannerPerMinute := getEnvInt("ABUSE_SCANNER_PER_MINUTE", 5)
+		scannerLimit := newRateLimit("scanner", scannerPerMinute, scannerPerMinute)
+		proxies, err := parseTrustedProxies(os.Getenv("TRUST_PROXY"))
+		if err != nil {
+			return nil, fmt.Errorf("TRUST_PROXY: %w", err)
 		}
+		abuse = NewAbuse(time.Duration(getEnvInt("ABUSE_TTL_HOURS", 24))*time.Hour, scannerLimit, proxies)
+		paywall.SetAbuse(abuse)
+		metrics.RegisterCollector(abuse.WriteMetrics)
+	}
+	chaos := NewChaosInjector()
+	paywall.SetChaos(chaos)
+	metrics.RegisterCollector(chaos.WriteMetrics)
+	metrics.RegisterCollector(paymentReplays.WriteMetrics)
+	jobs := NewJobManager(dataDir, getEnvInt("JOB_WORKERS", 4), metrics)
+	metrics.RegisterCollector(jobs.WriteMetrics)
+
+	// Webhooks and failed settlements are queued on disk and retried until
+	// delivered or dead-lettered
+	outbox, err := NewOutbox(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	jobs.SetOutbox(outbox, RetryPolicy{
+		MaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		Backoff:     time.Duration(getEnvInt("WEBHOOK_RETRY_SEC", 5)) * time.Second,
+		MaxBackoff:  30 * time.Minute,
+	})
+	paywall.SetOutbox(outbox, RetryPolicy{
+		MaxAttempts: getEnvInt("SETTLEMENT_MAX_ATTEMPTS", 12),
+		Backoff:     30 * time.Second,
+		MaxBackoff:  time.Hour,
+	})
+	scheduler.Every("outbox", 5*time.Second, outbox.Deliver)
+	metrics.RegisterCollector(outbox.WriteMetrics)
+	metrics.RegisterCollector(responseSchemas.WriteMetrics)
+
+	// Payers' own allow/deny lists for preflight and MEV checks
+	watchLists, err = NewWatchLists(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("watch lists: %w", err)
+	}
+	metrics.RegisterCollector(watchLists.WriteMetrics)
+	metrics.RegisterCollector(policyStats.WriteMetrics)
+	if isShared(sharedState) {
+		jobs.Share(sharedState)
+	}
+	retention := NewRetention(retentionPolicyFromEnv(), ledger, jobs, metrics)
+	scheduler.Every("retention", time.Hour, retention.Prune)
 
-		// Validate payment
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
+	// Scheduled export of persisted state (disabled unless BACKUP_DEST is set)
+	var backups *Backups
+	if dest := os.Getenv("BACKUP_DEST"); dest != "" {
+		store, err := backup.OpenStore(dest, backup.S3ConfigFromEnv())
+		if err != nil {
+			return nil, fmt.Errorf("BACKUP_DEST: %w", err)
+		}
+		backups = NewBackups(store, ledger, jobs)
+		if hours := getEnvInt("BACKUP_INTERVAL_HOURS", 24); hours > 0 {
+			scheduler.Every("backup", time.Duration(hours)*time.Hour, func() {
+				if _, err := backups.Backup(); err != nil {
+					log.Printf("⚠️  Backup failed: %v", err)
+				}
 			})
-			metrics.RecordRequest("/api/gas", "402")
+		}
+	}
+
+	// Sweeps of accumulated payments to cold storage (disabled unless PAYOUT_ADDRESS is set)
+	var payouts *Payouts
+	if to := os.Getenv("PAYOUT_ADDRESS"); to != "" {
+		maxGas, err := strconv.ParseFloat(getEnv("PAYOUT_MAX_GAS_GWEI", "0"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("PAYOUT_MAX_GAS_GWEI: %w", err)
+		}
+		chain, _ := runtimeConfig.Current().Chain(config.Network)
+		policy := PayoutPolicy{To: to, MinAmount: float64(getEnvInt("PAYOUT_MIN_AMOUNT", 100)), MaxGasGwei: maxGas}
+		token := getEnv("PAYOUT_TOKEN", payoutTokens[config.Network+":"+config.Asset])
+		payouts, err = NewPayouts(dataDir, getEnv("PAYOUT_RPC_URL", defaultBaseRPC), token, chain.ChainID, config, policy, ledger)
+		if err != nil {
+			return nil, fmt.Errorf("payouts: %w", err)
+		}
+		payouts.SetNotifier(notifier)
+		scheduler.Singleton("payout-check", time.Duration(getEnvInt("PAYOUT_CHECK_INTERVAL_MIN", 60))*time.Minute, payouts.Check)
+	}
+
+	// Degradation policy for data endpoints when upstreams fail
+	degradedMode, err := ParseDegradationMode(os.Getenv("DEGRADED_MODE"))
+	if err != nil {
+		return nil, fmt.Errorf("DEGRADED_MODE: %w", err)
+	}
+	degradation := DegradationPolicy{
+		Mode:           degradedMode,
+		ChargeFraction: float64(getEnvInt("DEGRADED_CHARGE_PCT", 50)) / 100,
+		MaxStaleness:   time.Duration(getEnvInt("MAX_STALENESS_SEC", 300)) * time.Second,
+	}
+	if degradation.Mode == DegradeCredit {
+		credits := NewCredits()
+		paywall.SetCredits(credits)
+		metrics.RegisterCollector(credits.WriteMetrics)
+	}
+	var (
+		gasCache       lastGood[GasData]
+		validatorCache lastGood[ValidatorData]
+		priceCache     lastGood[PriceData]
+	)
+	opStackFees := NewOPStackFees(networkRPCs())
+
+	// Async job status (free - job IDs are unguessable)
+	mux.HandleFunc("/api/jobs/", jobs.handleGetJob)
+
+	// Signed payment receipts (free - payment IDs are unguessable)
+	mux.HandleFunc("/api/receipts/", getOnly(ledger.handleReceipt))
+
+	// Payers' watch lists (free - requests are signed by the payer)
+	mux.HandleFunc("/api/watchlist", watchLists.handleWatchList)
+
+	// Prepaid balances: topped up by a payment, then debited per call
+	if accounts != nil {
+		mux.HandleFunc("/api/account/topup", paidPost(paywall.ProtectRoute("/api/account/topup", accounts.handleTopup)))
+		mux.HandleFunc("/api/account/balance", getOnly(accounts.handleBalance))
+	}
+
+	// Protected endpoint - real gas prices
+	mux.HandleFunc("/api/gas", getOnly(withDataOptions(paywall.ProtectRoute("/api/gas", withStalenessLimit(degradation.MaxStaleness, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		opts, _ := parseDataOptions(r.URL.Query())
+		if opts.Chain != "ethereum" {
+			metrics.RecordRequest("/api/gas", opStackFees.serveGas(w, r, opts, degradation.MaxStaleness))
 			metrics.RecordResponseTime("/api/gas", time.Since(start))
 			return
 		}
 
-		// Record successful payment
-		metrics.RecordPayment("/api/gas", priceFloat)
-
 		// Fetch real gas prices
-		gasData, err := rpcClient.fetchGasPrices()
-		if err != nil {
+		gasData, err := providers.Gas.GasPrices()
+		if err == nil {
+			gasCache.Store(*gasData)
+		} else {
 			log.Printf("Error fetching gas: %v", err)
-			// Return cached/estimated data on error
-			gasData = &GasData{
-				Timestamp: time.Now().Unix(),
-				Gas: map[string]float64{
-					"safe":    0.25,
-					"average": 0.35,
-					"fast":    0.50,
-				},
-				Unit:   "gwei",
-				Source: "estimated",
+			if cached, age, ok := gasCache.Load(degradation.MaxStaleness); ok {
+				gasData = &cached
+				gasData.DataQuality = types.DataQuality{Quality: types.QualityStale, StalenessSeconds: int64(age.Seconds())}
+				w.Header().Set("X-Data-Quality", types.QualityStale)
+			} else {
+				if !degradation.Fallback(w, r) {
+					metrics.RecordRequest("/api/gas", "503")
+					return
+				}
+				gasData = &GasData{
+					Timestamp: time.Now().Unix(),
+					Gas: map[string]float64{
+						"safe":    0.25,
+						"current": 0.35,
+						"fast":    0.50,
+					},
+					Unit:        "gwei",
+					Source:      "estimated",
+					DataQuality: types.DataQuality{Quality: types.QualityFallback},
+				}
 			}
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"data":             gasData,
-			"payment_verified": true,
-		})
+		writePaidData(w, r, opts.applyGas(gasData))
 		metrics.RecordRequest("/api/gas", "200")
 		metrics.RecordResponseTime("/api/gas", time.Since(start))
-	})
+	})))))
 
 	// Validator queue endpoint
-	mux.HandleFunc("/api/validators", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/validators", getOnly(paywall.ProtectRoute("/api/validators", withStalenessLimit(degradation.MaxStaleness, func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		price := "0.005" // USDC
-		priceFloat := 0.005
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Get validator queue status",
-				},
-			})
-			metrics.RecordRequest("/api/validators", "402")
-			metrics.RecordResponseTime("/api/validators", time.Since(start))
-			return
-		}
 
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/validators", "402")
-			metrics.RecordResponseTime("/api/validators", time.Since(start))
-			return
-		}
-
-		metrics.RecordPayment("/api/validators", priceFloat)
-
-		validatorData, err := rpcClient.fetchValidatorData()
-		if err != nil {
+		validatorData, err := providers.Beacon.ValidatorData()
+		if err == nil {
+			validatorCache.Store(*validatorData)
+		} else {
 			log.Printf("Error fetching validator data: %v", err)
-			validatorData = &ValidatorData{
-				Timestamp: time.Now().Unix(),
-				Queue: map[string]interface{}{
-					"entry_wait_hours": 4,
-					"exit_wait_hours":  2,
-				},
-				Active:          1048576,
-				PendingDeposits: 0,
+			if cached, age, ok := validatorCache.Load(degradation.MaxStaleness); ok {
+				validatorData = &cached
+				validatorData.DataQuality = types.DataQuality{Quality: types.QualityStale, StalenessSeconds: int64(age.Seconds())}
+				w.Header().Set("X-Data-Quality", types.QualityStale)
+			} else {
+				if !degradation.Fallback(w, r) {
+					metrics.RecordRequest("/api/validators", "503")
+					return
+				}
+				validatorData = &ValidatorData{
+					Timestamp: time.Now().Unix(),
+					Queue: map[string]interface{}{
+						"entry_wait_hours": 4,
+						"exit_wait_hours":  2,
+					},
+					Active:          1048576,
+					PendingDeposits: 0,
+					DataQuality:     types.DataQuality{Quality: types.QualityFallback},
+				}
 			}
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"data":             validatorData,
-			"payment_verified": true,
-		})
+		writePaidData(w, r, validatorData)
 		metrics.RecordRequest("/api/validators", "200")
 		metrics.RecordResponseTime("/api/validators", time.Since(start))
-	})
+	}))))
 
 	// ETH Price endpoint (0.002 USDC)
-	mux.HandleFunc("/api/price", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/price", getOnly(withDataOptions(paywall.ProtectRoute("/api/price", withStalenessLimit(degradation.MaxStaleness, func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		price := "0.002" // USDC
-		priceFloat := 0.002
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Get ETH/USD price from multiple exchanges",
-				},
-			})
-			metrics.RecordRequest("/api/price", "402")
-			metrics.RecordResponseTime("/api/price", time.Since(start))
-			return
-		}
 
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/price", "402")
-			metrics.RecordResponseTime("/api/price", time.Since(start))
-			return
+		priceData, err := providers.Price.ETHPrice()
+		if err == nil {
+			priceCache.Store(*priceData)
+		} else {
+			log.Printf("Error fetching price: %v", err)
+			if cached, age, ok := priceCache.Load(degradation.MaxStaleness); ok {
+				priceData = &cached
+				priceData.DataQuality = types.DataQuality{Quality: types.QualityStale, StalenessSeconds: int64(age.Seconds())}
+				w.Header().Set("X-Data-Quality", types.QualityStale)
+			} else {
+				if !degradation.Fallback(w, r) {
+					metrics.RecordRequest("/api/price", "503")
+					return
+				}
+				priceData = &PriceData{
+					Timestamp:   time.Now().Unix(),
+					Eth:         2700.00,
+					Sources:     map[string]float64{"fallback": 2700.00},
+					Average:     2700.00,
+					Change24h:   0,
+					DataQuality: types.DataQuality{Quality: types.QualityFallback},
+				}
+			}
 		}
 
-		metrics.RecordPayment("/api/price", priceFloat)
-
-		priceData, err := fetchETHPrice()
+		opts, _ := parseDataOptions(r.URL.Query())
+		converted, err := convertPrice(priceData, opts.Currency)
 		if err != nil {
-			log.Printf("Error fetching price: %v", err)
-			// Return fallback data
-			priceData = &PriceData{
-				Timestamp: time.Now().Unix(),
-				Eth:       2700.00,
-				Sources:   map[string]float64{"fallback": 2700.00},
-				Average:   2700.00,
-				Change24h: 0,
-			}
+			log.Printf("Error converting price to %s: %v", opts.Currency, err)
+			chargeFromContext(r.Context()).refuse()
+			http.Error(w, `{"error":"Currency conversion unavailable, payment not captured"}`, http.StatusServiceUnavailable)
+			metrics.RecordRequest("/api/price", "503")
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"data":             priceData,
-			"payment_verified": true,
-		})
+		writePaidData(w, r, converted)
 		metrics.RecordRequest("/api/price", "200")
 		metrics.RecordResponseTime("/api/price", time.Since(start))
+	})))))
+
+	// Price source health and consensus weights (free)
+	mux.HandleFunc("/api/price/sources", func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		priceSources.handlePriceSources(w, r)
+		metrics.RecordRequest("/api/price/sources", "200")
+		metrics.RecordResponseTime("/api/price/sources", time.Since(start))
 	})
 
+	// Price and latency of every paid route, for budgeting agents (free)
+	mux.HandleFunc("/api/pricing", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		paywall.handlePricing(w, r)
+		metrics.RecordRequest("/api/pricing", "200")
+		metrics.RecordResponseTime("/api/pricing", time.Since(start))
+	}))
+
 	// Initialize security services
 	contractScanner := NewContractScanner()
 	agentScorer := NewAgentScorer()
 	txSimulator := NewTxSimulator(rpcURL)
+	txSimulator.SetBundler(bundlerURL)
+	txSimulator.SetChainRPCs(networkRPCs())
+	if n := getEnvInt("SIMULATION_CACHE_MAX", 10000); n > 0 {
+		simCache := NewSimulationCache(n)
+		txSimulator.SetCache(simCache)
+		metrics.RegisterCollector(simCache.WriteMetrics)
+	}
 	promptGuard := NewPromptGuard()
 
-	// Contract Risk Scanner ($0.01 USDC)
-	mux.HandleFunc("/api/scan-contract", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
-			return
-		}
+	// Self-test of the scanners against known-good and known-bad fixtures (free)
+	benchmark := NewBenchmark(promptGuard)
+	mux.HandleFunc("/api/benchmark", getOnly(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		price := "0.01" // USDC
-		priceFloat := 0.01
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Scan smart contract for risk factors",
-				},
-			})
-			metrics.RecordRequest("/api/scan-contract", "402")
-			metrics.RecordResponseTime("/api/scan-contract", time.Since(start))
-			return
-		}
+		benchmark.handleBenchmark(w, r)
+		metrics.RecordRequest("/api/benchmark", "200")
+		metrics.RecordResponseTime("/api/benchmark", time.Since(start))
+	}))
 
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/scan-contract", "402")
-			metrics.RecordResponseTime("/api/scan-contract", time.Since(start))
-			return
-		}
+	// GraphQL: one paid query across gas, price, validators and scans
+	gql, err := NewGraphQL(paywall, metrics, providers.Gas, contractScanner)
+	if err != nil {
+		return nil, fmt.Errorf("GraphQL schema: %w", err)
+	}
+	metrics.RegisterCollector(gql.WriteMetrics)
+	mux.Handle("/graphql", gql)
 
-		metrics.RecordPayment("/api/scan-contract", priceFloat)
+	// Contract Risk Scanner ($0.01 USDC)
+	mux.HandleFunc("/api/scan-contract", paidPost(paywall.ProtectRoute("/api/scan-contract", jobs.Async("/api/scan-contract", withStalenessLimit(contractScanner.cache.ttl, func(w http.ResponseWriter, r *http.Request) {
 		handleContractScan(w, r, contractScanner, metrics)
-	})
+	})))))
 
 	// Agent Security Score ($0.005 USDC)
-	mux.HandleFunc("/api/agent-score", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
-			return
-		}
-		start := time.Now()
-		price := "0.005" // USDC
-		priceFloat := 0.005
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Get security score for ERC-8004 agent",
-				},
-			})
-			metrics.RecordRequest("/api/agent-score", "402")
-			metrics.RecordResponseTime("/api/agent-score", time.Since(start))
-			return
-		}
-
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/agent-score", "402")
-			metrics.RecordResponseTime("/api/agent-score", time.Since(start))
-			return
-		}
-
-		metrics.RecordPayment("/api/agent-score", priceFloat)
+	mux.HandleFunc("/api/agent-score", paidPost(paywall.ProtectRoute("/api/agent-score", func(w http.ResponseWriter, r *http.Request) {
 		handleAgentScore(w, r, agentScorer, metrics)
-	})
+	})))
 
 	// TX Pre-flight Check ($0.003 USDC)
-	mux.HandleFunc("/api/tx-preflight", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
-			return
-		}
-		start := time.Now()
-		price := "0.003" // USDC
-		priceFloat := 0.003
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Pre-flight transaction risk check",
-				},
-			})
-			metrics.RecordRequest("/api/tx-preflight", "402")
-			metrics.RecordResponseTime("/api/tx-preflight", time.Since(start))
-			return
-		}
-
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/tx-preflight", "402")
-			metrics.RecordResponseTime("/api/tx-preflight", time.Since(start))
-			return
-		}
-
-		metrics.RecordPayment("/api/tx-preflight", priceFloat)
+	mux.HandleFunc("/api/tx-preflight", paidPost(paywall.ProtectRoute("/api/tx-preflight", jobs.Async("/api/tx-preflight", func(w http.ResponseWriter, r *http.Request) {
 		handleTxPreflight(w, r, txSimulator, metrics)
-	})
-
-	// Prompt Injection Test ($0.01 USDC)
-	mux.HandleFunc("/api/prompt-test", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
-			return
-		}
-		start := time.Now()
-		price := "0.01" // USDC
-		priceFloat := 0.01
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Test prompt for injection attacks",
-				},
-			})
-			metrics.RecordRequest("/api/prompt-test", "402")
-			metrics.RecordResponseTime("/api/prompt-test", time.Since(start))
-			return
-		}
+	}))))
 
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/prompt-test", "402")
-			metrics.RecordResponseTime("/api/prompt-test", time.Since(start))
-			return
-		}
+	// Safe Multisig Transaction Check ($0.005 USDC)
+	mux.HandleFunc("/api/safe-check", paidPost(paywall.ProtectRoute("/api/safe-check", func(w http.ResponseWriter, r *http.Request) {
+		handleSafeCheck(w, r, txSimulator, metrics)
+	})))
 
-		metrics.RecordPayment("/api/prompt-test", priceFloat)
+	// Prompt Injection Test ($0.01 USDC)
+	mux.HandleFunc("/api/prompt-test", paidPost(paywall.ProtectRoute("/api/prompt-test", func(w http.ResponseWriter, r *http.Request) {
 		handlePromptTest(w, r, promptGuard, metrics)
-	})
+	})))
 
 	// NEW ENDPOINTS - Token Scanner ($0.008 USDC)
-	mux.HandleFunc("/api/scan-token", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
-			return
-		}
-		start := time.Now()
-		price := "0.008" // USDC
-		priceFloat := 0.008
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Scan token contract for honeypot and mint risks",
-				},
-			})
-			metrics.RecordRequest("/api/scan-token", "402")
-			metrics.RecordResponseTime("/api/scan-token", time.Since(start))
-			return
-		}
+	mux.HandleFunc("/api/scan-token", paidPost(paywall.ProtectRoute("/api/scan-token", jobs.Async("/api/scan-token", handleTokenScan))))
 
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/scan-token", "402")
-			metrics.RecordResponseTime("/api/scan-token", time.Since(start))
-			return
-		}
+	// Token Scan Diff ($0.008 USDC)
+	mux.HandleFunc("/api/scan-token/diff", paidPost(paywall.ProtectRoute("/api/scan-token/diff", jobs.Async("/api/scan-token/diff", handleTokenScanDiff))))
 
-		metrics.RecordPayment("/api/scan-token", priceFloat)
-		handleTokenScan(w, r)
-	})
+	// Risk Score History ($0.001 USDC)
+	mux.HandleFunc("/api/risk-history/", getOnly(paywall.ProtectRoute("/api/risk-history", riskHistory.handleRiskHistory)))
 
 	// Wallet Portfolio Scanner ($0.01 USDC)
-	mux.HandleFunc("/api/scan-wallet", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
-			return
-		}
-		start := time.Now()
-		price := "0.01" // USDC
-		priceFloat := 0.01
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Scan wallet portfolio for risks",
-				},
-			})
-			metrics.RecordRequest("/api/scan-wallet", "402")
-			metrics.RecordResponseTime("/api/scan-wallet", time.Since(start))
-			return
-		}
-
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/scan-wallet", "402")
-			metrics.RecordResponseTime("/api/scan-wallet", time.Since(start))
-			return
-		}
-
-		metrics.RecordPayment("/api/scan-wallet", priceFloat)
-		handleWalletScan(w, r)
-	})
+	mux.HandleFunc("/api/scan-wallet", paidPost(paywall.ProtectRoute("/api/scan-wallet", jobs.Async("/api/scan-wallet", handleWalletScan))))
 
 	// Address Label Lookup ($0.003 USDC)
-	mux.HandleFunc("/api/address-label", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
-			return
-		}
-		start := time.Now()
-		price := "0.003" // USDC
-		priceFloat := 0.003
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Get labels and entity info for address",
-				},
-			})
-			metrics.RecordRequest("/api/address-label", "402")
-			metrics.RecordResponseTime("/api/address-label", time.Since(start))
-			return
-		}
+	mux.HandleFunc("/api/address-label", paidPost(paywall.ProtectRoute("/api/address-label", handleAddressLabel)))
 
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/address-label", "402")
-			metrics.RecordResponseTime("/api/address-label", time.Since(start))
-			return
-		}
+	// Bulk Enrichment ($0.02 USDC per batch)
+	enrichRPCs := networkRPCs()
+	enrichRPCs["ethereum"] = rpcURL
+	enricher := NewEnricher(enrichRPCs)
+	mux.HandleFunc("/api/enrich", paidPost(paywall.ProtectRoute("/api/enrich", enricher.handleEnrich)))
 
-		metrics.RecordPayment("/api/address-label", priceFloat)
-		handleAddressLabel(w, r)
-	})
+	// ERC-20 Transfer Builder ($0.003 USDC), on the same RPCs
+	transferBuilder := NewTransferBuilder(enrichRPCs)
+	mux.HandleFunc("/api/build-transfer", paidPost(paywall.ProtectRoute("/api/build-transfer", transferBuilder.handleBuildTransfer)))
 
 	// MEV Protection Check ($0.005 USDC)
-	mux.HandleFunc("/api/mev-check", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
-			return
-		}
-		start := time.Now()
-		price := "0.005" // USDC
-		priceFloat := 0.005
-
-		paymentHeader := r.Header.Get("X-Payment-Response")
-		if paymentHeader == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Payment required",
-				"version": "x402/1.0",
-				"payment": PaymentRequirement{
-					Scheme:      "x402",
-					Network:     config.Network,
-					MaxAmount:   price,
-					MinAmount:   price,
-					Asset:       config.Asset,
-					Receiver:    config.Receiver,
-					Description: "Check transaction for MEV/sandwich risk",
-				},
-			})
-			metrics.RecordRequest("/api/mev-check", "402")
-			metrics.RecordResponseTime("/api/mev-check", time.Since(start))
-			return
-		}
-
-		if !validatePayment(paymentHeader, price, config.Asset, config.Receiver) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Invalid or insufficient payment",
-				"version": "x402/1.0",
-			})
-			metrics.RecordRequest("/api/mev-check", "402")
-			metrics.RecordResponseTime("/api/mev-check", time.Since(start))
-			return
-		}
+	mux.HandleFunc("/api/mev-check", paidPost(paywall.ProtectRoute("/api/mev-check", handleMEVCheck)))
 
-		metrics.RecordPayment("/api/mev-check", priceFloat)
-		handleMEVCheck(w, r)
-	})
+	// ERC-4337 Gas Sponsorship Quote ($0.003 USDC)
+	gasSponsor := NewGasSponsor(bundlerURL, getEnv("PAYMASTER_URL", ""))
+	mux.HandleFunc("/api/gas-sponsorship", paidPost(paywall.ProtectRoute("/api/gas-sponsorship", gasSponsor.handleGasSponsorship)))
 
 	// Agent info endpoint
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		pricing := map[string]string{
+			"/api/jobs/{id}":      "0.00 USDC", // Free polling for async scans
+			"/api/receipts/{id}":  "0.00 USDC", // Free signed payment receipts
+			"/api/price/sources":  "0.00 USDC", // Free price source health
+			"/api/pricing":        "0.00 USDC", // Free price and latency table
+			"/api/benchmark":      "0.00 USDC", // Free scanner self-test
+			"/api/watchlist":      "0.00 USDC", // Free, signed by the payer
+			"/graphql":            "dynamic", // Sum of the selected fields' prices
+			"/mcp":                "0.00 USDC", // Free endpoint for discovery
+			"/mcp/call":           "dynamic", // Pricing handled by individual tool calls
+			"/.well-known/agent-card.json": "0.00 USDC", // Free endpoint for discovery
+			"/.well-known/oasf.json":      "0.00 USDC", // Free endpoint for discovery
+			"/capabilities":      "0.00 USDC", // Free endpoint for discovery
+			"/.well-known/changelog.json": "0.00 USDC", // Free endpoint for discovery
+			"/.well-known/response-signing": "0.00 USDC", // Free endpoint for discovery
+			"/.well-known/attestation": "0.00 USDC", // Free endpoint for discovery
+		}
+		for _, route := range paidRoutes {
+			if route.endpoint == accountTopupEndpoint && accounts == nil {
+				continue
+			}
+			pricing[route.documentedPath()] = priceLabel(route.price, config.Asset)
+		}
+		if accounts != nil {
+			pricing["/api/account/balance"] = "0.00 USDC" // Free, signed by the payer
+		}
+		endpoints := []string{
+			"/health",
+			"/version",
+			"/capabilities",
+			"/status",
+			"/pay",
+			"/.well-known/x402",
+			"/api/gas",
+			"/api/validators",
+			"/api/price",
+			"/api/price/sources",
+			"/api/pricing",
+			"/api/benchmark",
+			"/api/scan-contract",
+			"/api/scan-token",
+			"/api/scan-token/diff",
+			"/api/risk-history/{address}",
+			"/api/scan-wallet",
+			"/api/address-label",
+			"/api/enrich",
+			"/api/mev-check",
+			"/api/gas-sponsorship",
+			"/api/agent-score",
+			"/api/tx-preflight",
+			"/api/safe-check",
+			"/api/build-transfer",
+			"/api/prompt-test",
+			"/api/jobs/{id}",
+			"/api/receipts/{id}",
+			"/api/watchlist",
+		}
+		if accounts != nil {
+			endpoints = append(endpoints, "/api/account/topup", "/api/account/balance")
+		}
+		endpoints = append(endpoints,
+			"/graphql",
+			"/metrics",
+			"/mcp", // MCP endpoint for tool discovery
+			"/mcp/call", // MCP endpoint for tool execution
+			"/.well-known/agent-card.json", // A2A endpoint
+			"/.well-known/oasf.json", // OASF endpoint
+			"/.well-known/changelog.json", // Skill, price and schema changes
+			"/.well-known/response-signing", // Response signature public key
+			"/.well-known/attestation", // TEE attestation document
+		)
+		for endpoint, price := range runtimeConfig.Current().Prices {
+			pricing[endpoint] = priceLabel(price, config.Asset)
+		}
+		if tenant := TenantFromContext(r.Context()); tenant != nil {
+			for endpoint, price := range tenant.Prices {
+				pricing[endpoint] = priceLabel(price, config.Asset)
+			}
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"agent":      "Arithmos Quillsworth",
 			"type":       "autonomous AI agent",
 			"erc8004_id": "1941",
 			"service":    "x402 payment-enabled API",
-			"endpoints": []string{
-				"/health",
-				"/.well-known/x402",
-				"/api/gas",
-				"/api/validators",
-				"/api/price",
-				"/api/scan-contract",
-				"/api/scan-token",
-				"/api/scan-wallet",
-				"/api/address-label",
-				"/api/mev-check",
-				"/api/agent-score",
-				"/api/tx-preflight",
-				"/api/prompt-test",
-				"/metrics",
-				"/mcp", // MCP endpoint for tool discovery
-				"/mcp/call", // MCP endpoint for tool execution
-				"/.well-known/agent-card.json", // A2A endpoint
-				"/.well-known/oasf.json", // OASF endpoint
-			},
-			"pricing": map[string]string{
-				"/api/gas":            "0.001 USDC",
-				"/api/validators":     "0.005 USDC",
-				"/api/price":          "0.002 USDC",
-				"/api/scan-contract":  "0.01 USDC",
-				"/api/scan-token":     "0.008 USDC",
-				"/api/scan-wallet":    "0.01 USDC",
-				"/api/address-label":  "0.003 USDC",
-				"/api/mev-check":      "0.005 USDC",
-				"/api/agent-score":    "0.005 USDC",
-				"/api/tx-preflight":   "0.003 USDC",
-				"/api/prompt-test":    "0.01 USDC",
-				"/mcp":                "0.00 USDC", // Free endpoint for discovery
-				"/mcp/call":           "dynamic", // Pricing handled by individual tool calls
-				"/.well-known/agent-card.json": "0.00 USDC", // Free endpoint for discovery
-				"/.well-known/oasf.json":      "0.00 USDC", // Free endpoint for discovery
-			},
+			"endpoints":  endpoints,
+			"pricing":       pricing,
 			"documentation": "https://arithmos.dev",
 		})
 		metrics.RecordRequest("/", "200")
 		metrics.RecordResponseTime("/", time.Since(start))
 	})
 
+	// Honeytokens: left out of every manifest on purpose
+	for _, path := range decoyPaths {
+		mux.HandleFunc(path, paywall.Decoy(path, "0.01", 0.01, "Restricted data"))
+	}
+
+	// Reverse-proxy paywall for upstreams configured in CONFIG_FILE
+	mux.Handle("/gw/", NewGateway(paywall, metrics))
+
+	// Admin API (disabled unless ADMIN_TOKEN is set)
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	mux.HandleFunc("/admin/reload", adminOnly(adminToken, runtimeConfig.handleAdminReload))
+	mux.HandleFunc("/admin/config", adminOnly(adminToken, runtimeConfig.handleAdminConfig))
+	mux.HandleFunc("/admin/ledger", adminOnly(adminToken, ledger.handleAdminLedger))
+	mux.HandleFunc("/admin/ledger/export", adminOnly(adminToken, ledger.handleAdminExport))
+	mux.HandleFunc("/admin/payers/", adminOnly(adminToken, retention.handleAdminPayers))
+	mux.HandleFunc("/admin/backup", adminOnly(adminToken, backups.handleAdminBackup))
+	mux.HandleFunc("/admin/flags", adminOnly(adminToken, featureFlags.handleAdminFlags))
+	mux.HandleFunc("/admin/chaos", adminOnly(adminToken, chaos.handleAdminChaos))
+	mux.HandleFunc("/admin/coupons", adminOnly(adminToken, coupons.handleAdminCoupons))
+	mux.HandleFunc("/admin/coupons/", adminOnly(adminToken, coupons.handleAdminCoupons))
+	mux.HandleFunc("/admin/referrals", adminOnly(adminToken, ledger.handleAdminReferrals))
+	mux.HandleFunc("/admin/experiments", adminOnly(adminToken, experiments.handleAdminExperiments))
+	mux.HandleFunc("/admin/payouts", adminOnly(adminToken, payouts.handleAdminPayouts))
+	mux.HandleFunc("/admin/anomalies", adminOnly(adminToken, anomalies.handleAdminAnomalies))
+	mux.HandleFunc("/admin/abuse", adminOnly(adminToken, abuse.handleAdminAbuse))
+	mux.HandleFunc("/admin/abuse/", adminOnly(adminToken, abuse.handleAdminAbuse))
+	mux.HandleFunc("/admin/notifications", adminOnly(adminToken, notifier.handleAdminNotifications))
+	mux.HandleFunc("/admin/notifications/", adminOnly(adminToken, notifier.handleAdminNotifications))
+	mux.HandleFunc("/admin/outbox", adminOnly(adminToken, outbox.handleAdminOutbox))
+	mux.HandleFunc("/admin/outbox/", adminOnly(adminToken, outbox.handleAdminOutbox))
+	mux.HandleFunc("/admin/watchlists", adminOnly(adminToken, watchLists.handleAdminWatchLists))
+	mux.HandleFunc("/admin/watchlists/", adminOnly(adminToken, watchLists.handleAdminWatchLists))
+	dashboard := NewDashboard(metrics, ledger, paywall, upstreamLimiter)
+	mux.HandleFunc("/admin/dashboard", adminBrowserOnly(adminToken, dashboard.handleDashboard))
+	mux.HandleFunc("/admin/dashboard/", adminBrowserOnly(adminToken, dashboard.handleDashboard))
+
 	// Dashboard static files
 	dashboardFS := http.FileServer(http.Dir("./dashboard"))
 	mux.Handle("/dashboard/", http.StripPrefix("/dashboard/", dashboardFS))
@@ -939,13 +1231,29 @@ func main() {
 	mux.HandleFunc("/mcp/call", handleMCPCall)
 	mux.HandleFunc("/.well-known/agent-card.json", handleAgentCard)
 	mux.HandleFunc("/.well-known/oasf.json", handleOASFManifest)
-
-	log.Printf("🚀 x402 service starting on :%s", port)
-	log.Printf("💰 Receiver: %s", config.Receiver)
-	log.Printf("⛽ ETH RPC: %s", rpcURL)
-	log.Fatal(http.ListenAndServe(":"+port, mux))
+	mux.HandleFunc("/.well-known/changelog.json", handleChangelog)
+	mux.HandleFunc("/.well-known/response-signing", responseSigner.handleSigningKey)
+	mux.HandleFunc("/.well-known/attestation", handleAttestation)
+
+	// Browser wallet payments, made as exact scheme authorizations
+	browserPay := NewBrowserPay()
+	mux.HandleFunc("/pay", browserPay.handlePage)
+	mux.HandleFunc("/pay/prepare", postOnly(browserPay.handlePrepare))
+	mux.HandleFunc("/pay/confirm", postOnly(browserPay.handleConfirm))
+
+	return &service{
+		handler: withCORS(parseOrigins(getEnv("CORS_ALLOWED_ORIGINS", "*")), withTenant(withLoadShedding(shedder, mux))),
+		grpc:    NewGRPCServer(paywall, contractScanner, txSimulator, providers.Gas),
+		metrics: metrics,
+		leader:  leader,
+		config:  config,
+		rpcURL:  rpcURL,
+	}, nil
 }
 
+// defaultRPCURL is used unless ETH_RPC_URL is set
+const defaultRPCURL = "https://eth.drpc.org"
+
 // RPCClient handles Ethereum RPC calls
 type RPCClient struct {
 	url string
@@ -960,7 +1268,7 @@ func (c *RPCClient) call(method string, params []interface{}) (map[string]interf
 	}
 
 	jsonPayload, _ := json.Marshal(payload)
-	resp, err := http.Post(c.url, "application/json", strings.NewReader(string(jsonPayload)))
+	resp, err := upstreamHTTP.Post(c.url, "application/json", strings.NewReader(string(jsonPayload)))
 	if err != nil {
 		return nil, err
 	}
@@ -974,7 +1282,8 @@ func (c *RPCClient) call(method string, params []interface{}) (map[string]interf
 	return result, nil
 }
 
-func (c *RPCClient) fetchGasPrices() (*GasData, error) {
+// GasPrices implements GasProvider
+func (c *RPCClient) GasPrices() (*GasData, error) {
 	// eth_gasPrice returns current gas price
 	result, err := c.call("eth_gasPrice", []interface{}{})
 	if err != nil {
@@ -987,12 +1296,12 @@ func (c *RPCClient) fetchGasPrices() (*GasData, error) {
 	}
 
 	// Convert hex to gwei
-	gasPriceWei, err := strconv.ParseInt(strings.TrimPrefix(gasPriceHex, "0x"), 16, 64)
+	gasPriceWei, err := units.ParseHex(gasPriceHex)
 	if err != nil {
 		return nil, err
 	}
 
-	gasPriceGwei := float64(gasPriceWei) / 1e9
+	gasPriceGwei := units.ToGwei(gasPriceWei)
 
 	return &GasData{
 		Timestamp: time.Now().Unix(),
@@ -1001,120 +1310,25 @@ func (c *RPCClient) fetchGasPrices() (*GasData, error) {
 			"safe":    round(gasPriceGwei*0.9, 2),
 			"fast":    round(gasPriceGwei*1.2, 2),
 		},
-		Unit:   "gwei",
-		Source: "ethereum_mainnet",
-	}, nil
-}
-
-// BeaconClient handles Beacon Chain API calls for validator data
-type BeaconClient struct {
-	url string
-}
-
-func NewBeaconClient() *BeaconClient {
-	// Use environment variable or default to a public beacon node
-	beaconURL := getEnv("BEACON_API_URL", "https://ethereum-beacon-api.publicnode.com")
-	return &BeaconClient{url: beaconURL}
-}
-
-func (c *BeaconClient) fetchValidatorData() (*ValidatorData, error) {
-	// Fetch validator queue data from beacon chain
-	// Using the eth/v1/beacon/states/head/validator_count endpoint
-	
-	resp, err := http.Get(c.url + "/eth/v1/beacon/states/head/validator_count")
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
-
-	data, ok := result["data"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid beacon API response")
-	}
-
-	activeValidators := 0
-	if active, ok := data["active"].(float64); ok {
-		activeValidators = int(active)
-	}
-
-	// Fetch pending deposits (entry queue)
-	// This is a simplified estimation based on deposit contract
-	pendingDeposits := 0
-	
-	// Fetch exit queue data
-	exitQueueHours := 0
-	entryQueueHours := 0
-
-	// Estimate wait times based on churn limit
-	// Current churn limit is ~8 validators per epoch (1800 per day)
-	// Entry queue is roughly pending deposits / 1800 * 24 hours
-	if pendingDeposits > 0 {
-		entryQueueHours = pendingDeposits / 75 // ~75 validators per hour
-	}
-
-	return &ValidatorData{
-		Timestamp: time.Now().Unix(),
-		Queue: map[string]interface{}{
-			"entry_wait_hours": entryQueueHours,
-			"exit_wait_hours":  exitQueueHours,
-			"churn_limit_per_epoch": 8,
-			"churn_limit_per_day": 1800,
-		},
-		Active:          activeValidators,
-		PendingDeposits: pendingDeposits,
+		Unit:        "gwei",
+		Source:      "ethereum_mainnet",
+		DataQuality: types.DataQuality{Quality: types.QualityLive},
 	}, nil
 }
 
-// Backwards compatibility - use BeaconClient
-func (c *RPCClient) fetchValidatorData() (*ValidatorData, error) {
-	beacon := NewBeaconClient()
-	return beacon.fetchValidatorData()
-}
-
-func validatePayment(tokenString, expectedAmount, expectedAsset, expectedReceiver string) bool {
-	// Parse the JWT token (simplified validation)
-	// In production, you'd verify the signature against the network
-	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, &PaymentToken{})
-	if err != nil {
-		log.Printf("Token parse error: %v", err)
-		return false
-	}
-
-	claims, ok := token.Claims.(*PaymentToken)
-	if !ok {
-		return false
-	}
-
-	// Basic validation
-	if claims.Payment.Amount != expectedAmount {
-		log.Printf("Amount mismatch: got %s, want %s", claims.Payment.Amount, expectedAmount)
-		return false
-	}
-	if claims.Payment.Asset != expectedAsset {
-		log.Printf("Asset mismatch: got %s, want %s", claims.Payment.Asset, expectedAsset)
-		return false
-	}
-	if strings.ToLower(claims.Payment.Receiver) != strings.ToLower(expectedReceiver) {
-		log.Printf("Receiver mismatch: got %s, want %s", claims.Payment.Receiver, expectedReceiver)
-		return false
-	}
-
-	// Check expiration
-	if token.Valid {
-		// Additional expiry check could go here
+func getEnv(key, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
 	}
-
-	return true
+	return defaultVal
 }
 
-func getEnv(key, defaultVal string) string {
+func getEnvInt(key string, defaultVal int) int {
 	if val := os.Getenv(key); val != "" {
-		return val
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+		log.Printf("⚠️  Ignoring invalid %s=%q", key, val)
 	}
 	return defaultVal
 }
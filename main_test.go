@@ -4,9 +4,45 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
+// testSigningKey is the default payment key tests run with
+const testSigningKey = "test"
+
+func TestMain(m *testing.M) {
+	paymentKeys.Set(map[string][]byte{"": []byte(testSigningKey)}, defaultTokenLeeway)
+	os.Exit(m.Run())
+}
+
+// signPayment signs claims as a payment token with testSigningKey. A token
+// without exp expires in an hour, and one without a jti gets a fresh one, so
+// no two tests spend the same token.
+func signPayment(tb testing.TB, claims PaymentToken) string {
+	tb.Helper()
+	if claims.ID == "" {
+		claims.ID = randomNonce()
+	}
+	return signPaymentWithoutID(tb, claims)
+}
+
+// signPaymentWithoutID signs claims as they are, for tokens without a jti
+func signPaymentWithoutID(tb testing.TB, claims PaymentToken) string {
+	tb.Helper()
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSigningKey))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return token
+}
+
 func TestHealthEndpoint(t *testing.T) {
 	req, err := http.NewRequest("GET", "/health", nil)
 	if err != nil {
@@ -103,3 +139,74 @@ func TestRound(t *testing.T) {
 		}
 	}
 }
+
+func TestPaywallPropagatesPayer(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), nil)
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.001"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = config.Receiver
+	claims.Subject = "0xAbC0000000000000000000000000000000000001"
+	token := signPayment(t, claims)
+
+	var got Payer
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PayerFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/api/gas", nil)
+	req.Header.Set("X-Payment-Response", token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got.Address != "0xabc0000000000000000000000000000000000001" || got.Source != "sub" {
+		t.Errorf("unexpected payer: %+v", got)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/gas", nil))
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("missing payment returned %d, want 402", rr.Code)
+	}
+}
+
+func TestDegradationPolicyCapture(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.002"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = config.Receiver
+
+	tests := []struct {
+		mode       string
+		wantCode   int
+		wantAmount float64
+	}{
+		{DegradeServe, http.StatusOK, 0.002},
+		{DegradeDiscount, http.StatusOK, 0.001},
+		{DegradeRefuse, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tt := range tests {
+		metrics := NewMetrics()
+		policy := DegradationPolicy{Mode: tt.mode, ChargeFraction: 0.5}
+		handler := NewPaywall(config, metrics, nil).Protect("/api/price", "0.002", 0.002, "test", func(w http.ResponseWriter, r *http.Request) {
+			policy.Fallback(w, r)
+		})
+
+		req := httptest.NewRequest("GET", "/api/price", nil)
+		req.Header.Set("X-Payment-Response", signPayment(t, claims))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.mode, rr.Code, tt.wantCode)
+		}
+		if metrics.paymentAmountUSD != tt.wantAmount {
+			t.Errorf("%s: captured %v USD, want %v", tt.mode, metrics.paymentAmountUSD, tt.wantAmount)
+		}
+	}
+}
@@ -247,8 +247,7 @@ func handleMCPCall(w http.ResponseWriter, r *http.Request) {
 
 // Individual tool handlers
 func handleMCPGasPrices(w http.ResponseWriter, r *http.Request, args map[string]interface{}) {
-	rpcClient := &RPCClient{url: getEnv("ETH_RPC_URL", "https://ethereum-rpc.publicnode.com")}
-	gasData, err := rpcClient.fetchGasPrices()
+	gasData, err := providers.Gas.GasPrices()
 	
 	if err != nil {
 		json.NewEncoder(w).Encode(MCPResponse{
@@ -265,8 +264,7 @@ func handleMCPGasPrices(w http.ResponseWriter, r *http.Request, args map[string]
 }
 
 func handleMCPValidatorQueue(w http.ResponseWriter, r *http.Request, args map[string]interface{}) {
-	beaconClient := NewBeaconClient()
-	validatorData, err := beaconClient.fetchValidatorData()
+	validatorData, err := providers.Beacon.ValidatorData()
 	
 	if err != nil {
 		json.NewEncoder(w).Encode(MCPResponse{
@@ -292,6 +290,14 @@ func handleMCPScanToken(w http.ResponseWriter, r *http.Request, args map[string]
 		return
 	}
 
+	if !isValidAddress(tokenAddress) {
+		json.NewEncoder(w).Encode(MCPResponse{
+			Content: []MCPContent{{Type: "text", Text: "Invalid tokenAddress: must be 0x-prefixed hex with a valid EIP-55 checksum"}},
+			IsError: true,
+		})
+		return
+	}
+
 	chain, _ := args["chain"].(string)
 	if chain == "" {
 		chain = "base" // Default to Base
@@ -299,6 +305,7 @@ func handleMCPScanToken(w http.ResponseWriter, r *http.Request, args map[string]
 
 	// Use internal scan function
 	result := scanToken(tokenAddress, chain)
+	events.Publish(r.Context(), EventScanCompleted, ScanCompleted{Kind: "token", Chain: chain, Address: tokenAddress, Result: result})
 	resultJSON, _ := json.MarshalIndent(result, "", "  ")
 	
 	json.NewEncoder(w).Encode(MCPResponse{
@@ -316,6 +323,14 @@ func handleMCPScanWallet(w http.ResponseWriter, r *http.Request, args map[string
 		return
 	}
 
+	if !isValidAddress(walletAddress) {
+		json.NewEncoder(w).Encode(MCPResponse{
+			Content: []MCPContent{{Type: "text", Text: "Invalid walletAddress: must be 0x-prefixed hex with a valid EIP-55 checksum"}},
+			IsError: true,
+		})
+		return
+	}
+
 	chain, _ := args["chain"].(string)
 	if chain == "" {
 		chain = "base"
@@ -339,6 +354,14 @@ func handleMCPAddressLabels(w http.ResponseWriter, r *http.Request, args map[str
 		return
 	}
 
+	if !isValidAddress(address) {
+		json.NewEncoder(w).Encode(MCPResponse{
+			Content: []MCPContent{{Type: "text", Text: "Invalid address: must be 0x-prefixed hex with a valid EIP-55 checksum"}},
+			IsError: true,
+		})
+		return
+	}
+
 	result := lookupAddressLabel(address)
 	resultJSON, _ := json.MarshalIndent(result, "", "  ")
 	
@@ -376,7 +399,7 @@ func handleMCPMEVCheck(w http.ResponseWriter, r *http.Request, args map[string]i
 }
 
 func handleMCPEthPrice(w http.ResponseWriter, r *http.Request, args map[string]interface{}) {
-	price, err := fetchETHPrice()
+	price, err := providers.Price.ETHPrice()
 	if err != nil {
 		json.NewEncoder(w).Encode(MCPResponse{
 			Content: []MCPContent{{Type: "text", Text: "Error fetching ETH price: " + err.Error()}},
@@ -386,7 +409,7 @@ func handleMCPEthPrice(w http.ResponseWriter, r *http.Request, args map[string]i
 	}
 
 	json.NewEncoder(w).Encode(MCPResponse{
-		Content: []MCPContent{{Type: "text", Text: fmt.Sprintf(`{"price_usd": %.2f}`, price)}},
+		Content: []MCPContent{{Type: "text", Text: fmt.Sprintf(`{"price_usd": %.2f}`, price.Eth)}},
 	})
 }
 
@@ -422,6 +445,7 @@ func handleMCPPreflight(w http.ResponseWriter, r *http.Request, args map[string]
 		})
 		return
 	}
+	applyPolicies(runtimeConfig.Current().Policies, &req, result)
 	
 	resultJSON, _ := json.MarshalIndent(result, "", "  ")
 	
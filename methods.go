@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// anyMethod is the Allow set of a route that takes any method
+var anyMethod = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// allowSet completes methods to the set an endpoint answers: HEAD wherever
+// GET is served, and always OPTIONS
+func allowSet(methods []string) []string {
+	var allowed []string
+	for _, m := range methods {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" && !slices.Contains(allowed, m) {
+			allowed = append(allowed, m)
+		}
+	}
+	if slices.Contains(allowed, http.MethodGet) && !slices.Contains(allowed, http.MethodHead) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	if !slices.Contains(allowed, http.MethodOptions) {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	return allowed
+}
+
+// allowMethods serves next for methods. OPTIONS is answered with the Allow
+// set and anything else is a 405 carrying it.
+func allowMethods(next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allowed := allowSet(methods)
+	allow := strings.Join(allowed, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodOptions:
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+		case slices.Contains(allowed, r.Method):
+			next(w, r)
+		default:
+			w.Header().Set("Allow", allow)
+			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// postOnly rejects any method other than POST
+func postOnly(next http.HandlerFunc) http.HandlerFunc {
+	return allowMethods(next, http.MethodPost)
+}
+
+// getOnly serves GET and HEAD
+func getOnly(next http.HandlerFunc) http.HandlerFunc {
+	return allowMethods(next, http.MethodGet)
+}
+
+// paidPost serves a paid POST endpoint. HEAD is allowed too and, like any
+// request without a payment, gets the 402 challenge: its headers quote the
+// price without the body.
+func paidPost(next http.HandlerFunc) http.HandlerFunc {
+	return allowMethods(next, http.MethodPost, http.MethodHead)
+}
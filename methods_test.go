@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestE2EHeadQuotesPrice(t *testing.T) {
+	srv, _ := startService(t, nil)
+
+	req, _ := http.NewRequest("HEAD", srv.URL+"/api/scan-contract", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPaymentRequired || len(body) != 0 {
+		t.Fatalf("HEAD = %d with %d byte body, want a bare 402", resp.StatusCode, len(body))
+	}
+	header := resp.Header.Get("X-Payment-Required")
+	for _, field := range []string{`scheme="x402"`, `maxAmount="0.01"`, `asset="USDC"`} {
+		if !strings.Contains(header, field) {
+			t.Errorf("X-Payment-Required %q missing %s", header, field)
+		}
+	}
+
+	// A paid HEAD is still only a quote
+	challenge, _ := http.Post(srv.URL+"/api/scan-contract", "application/json", strings.NewReader("{}"))
+	token := pay(t, challenge)
+	challenge.Body.Close()
+	req, _ = http.NewRequest("HEAD", srv.URL+"/api/scan-contract", nil)
+	req.Header.Set("X-Payment-Response", token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPaymentRequired || len(ledgerEntries(t, srv)) != 0 {
+		t.Errorf("paid HEAD = %d, want 402 and nothing charged", resp.StatusCode)
+	}
+}
+
+func TestE2EAllowedMethods(t *testing.T) {
+	srv, _ := startService(t, nil)
+
+	cases := []struct {
+		method, path string
+		status       int
+		allow        string
+	}{
+		{"OPTIONS", "/api/gas", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/api/scan-contract", http.StatusNoContent, "POST, HEAD, OPTIONS"},
+		{"OPTIONS", "/pay/prepare", http.StatusNoContent, "POST, OPTIONS"},
+		{"POST", "/api/gas", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"GET", "/api/scan-contract", http.StatusMethodNotAllowed, "POST, HEAD, OPTIONS"},
+		{"HEAD", "/api/gas", http.StatusPaymentRequired, ""},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || resp.Header.Get("Allow") != tc.allow {
+			t.Errorf("%s %s = %d Allow %q, want %d Allow %q", tc.method, tc.path, resp.StatusCode, resp.Header.Get("Allow"), tc.status, tc.allow)
+		}
+	}
+}
+
+func TestGatewayRouteAllowed(t *testing.T) {
+	route := GatewayRoute{Methods: []string{"get", "POST"}}
+	if got := strings.Join(route.allowed(), ", "); got != "GET, POST, HEAD, OPTIONS" {
+		t.Errorf("allowed = %q", got)
+	}
+	if route.allowsMethod("DELETE") || !route.allowsMethod("HEAD") {
+		t.Error("allowsMethod does not follow the Allow set")
+	}
+}
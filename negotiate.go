@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported response media types
+const (
+	mediaJSON    = "application/json"
+	mediaMsgPack = "application/msgpack"
+	mediaCSV     = "text/csv"
+)
+
+// negotiate picks a response media type from the Accept header. It returns
+// "" when the client accepts none of the supported types.
+func negotiate(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return mediaJSON
+	}
+
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		media := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == "q" {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+
+		var candidate string
+		switch media {
+		case mediaJSON, "application/*", "*/*":
+			candidate = mediaJSON
+		case mediaMsgPack, "application/x-msgpack", "application/vnd.msgpack":
+			candidate = mediaMsgPack
+		case mediaCSV, "text/*":
+			candidate = mediaCSV
+		}
+		if candidate != "" && q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
+
+// writePaidData writes a paid response in the negotiated format. JSON and
+// MessagePack carry the usual {"data", "payment_verified"} envelope; CSV
+// carries only the data, flattened into columns. Sandbox responses are
+// marked with "sandbox": true, and every envelope carries a "meta" block
+// describing how fresh the data is. ?fields=gas.fast,timestamp
+// trims the data to the listed paths. If no supported format is acceptable
+// the payment is not captured.
+func writePaidData(w http.ResponseWriter, r *http.Request, data interface{}) {
+	if err := responseSchemas.Check(r.URL.Path, data); err != nil {
+		chargeFromContext(r.Context()).refuse()
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	meta := responseMeta(r.Context(), data)
+	w.Header().Set("Age", strconv.FormatInt(meta.CacheAgeSeconds, 10))
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		selected, err := selectFields(data, strings.Split(fields, ","))
+		if err != nil {
+			http.Error(w, `{"error":"Could not encode response"}`, http.StatusInternalServerError)
+			return
+		}
+		data = selected
+	}
+	body := map[string]interface{}{
+		"data":             data,
+		"payment_verified": true,
+		"meta":             meta,
+	}
+	if IsSandbox(r.Context()) {
+		body["sandbox"] = true
+	}
+	writeNegotiated(w, r, body, data)
+}
+
+// writeNegotiated writes body as JSON or MessagePack, or rows as CSV. Paid
+// responses are signed when response signing is enabled.
+func writeNegotiated(w http.ResponseWriter, r *http.Request, body, rows interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	var out []byte
+	var err error
+	switch negotiate(r.Header.Get("Accept")) {
+	case mediaJSON:
+		if out, err = json.Marshal(body); err == nil {
+			out = append(out, '\n')
+		}
+		w.Header().Set("Content-Type", mediaJSON)
+	case mediaMsgPack:
+		out, err = encodeMsgPack(body)
+		w.Header().Set("Content-Type", mediaMsgPack)
+	case mediaCSV:
+		out, err = encodeCSV(rows)
+		w.Header().Set("Content-Type", mediaCSV+"; charset=utf-8")
+	default:
+		chargeFromContext(r.Context()).refuse()
+		http.Error(w, `{"error":"Not acceptable - use application/json, application/msgpack or text/csv"}`, http.StatusNotAcceptable)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Could not encode response"}`, http.StatusInternalServerError)
+		return
+	}
+	responseSigner.sign(w, r, out)
+	w.Write(out)
+}
+
+// jsonTree converts v to its generic JSON form so the other encoders honour
+// the same field names and omitempty rules as the JSON API
+func jsonTree(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// selectFields keeps only the dotted paths in fields. Lists are filtered
+// element by element. Paths that are absent, such as empty omitempty
+// fields, are left out.
+func selectFields(data interface{}, fields []string) (interface{}, error) {
+	tree, err := jsonTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths [][]string
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			paths = append(paths, strings.Split(f, "."))
+		}
+	}
+
+	if items, ok := tree.([]interface{}); ok {
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = pickPaths(item, paths)
+		}
+		return out, nil
+	}
+	return pickPaths(tree, paths), nil
+}
+
+func pickPaths(tree interface{}, paths [][]string) map[string]interface{} {
+	out := make(map[string]interface{})
+	for _, path := range paths {
+		value, ok := lookupPath(tree, path)
+		if !ok {
+			continue
+		}
+		dst := out
+		for _, key := range path[:len(path)-1] {
+			next, ok := dst[key].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				dst[key] = next
+			}
+			dst = next
+		}
+		dst[path[len(path)-1]] = value
+	}
+	return out
+}
+
+func lookupPath(tree interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		m, ok := tree.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if tree, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return tree, true
+}
+
+// encodeMsgPack encodes v as MessagePack
+func encodeMsgPack(v interface{}) ([]byte, error) {
+	tree, err := jsonTree(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeMsgPack(&buf, tree)
+	return buf.Bytes(), nil
+}
+
+func writeMsgPack(buf *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if x {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			writeMsgPackInt(buf, i)
+			return
+		}
+		f, _ := x.Float64()
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		n := len(x)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(x)
+	case []interface{}:
+		writeMsgPackHeader(buf, len(x), 0x90, 0xdc, 0xdd)
+		for _, item := range x {
+			writeMsgPack(buf, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeMsgPackHeader(buf, len(x), 0x80, 0xde, 0xdf)
+		for _, k := range keys {
+			writeMsgPack(buf, k)
+			writeMsgPack(buf, x[k])
+		}
+	}
+}
+
+func writeMsgPackHeader(buf *bytes.Buffer, n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeMsgPackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i < 128:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+// encodeCSV renders v as CSV. A list becomes one row per element and
+// anything else a single row. Nested objects are flattened into dotted
+// column names and scalar lists are joined with ";".
+func encodeCSV(v interface{}) ([]byte, error) {
+	tree, err := jsonTree(v)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := tree.([]interface{})
+	if !ok {
+		items = []interface{}{tree}
+	}
+
+	rows := make([]map[string]string, 0, len(items))
+	columns := make(map[string]bool)
+	for _, item := range items {
+		row := make(map[string]string)
+		flattenCSV(row, "", item)
+		for col := range row {
+			columns[col] = true
+		}
+		rows = append(rows, row)
+	}
+
+	header := make([]string, 0, len(columns))
+	for col := range columns {
+		header = append(header, col)
+	}
+	sort.Strings(header)
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(header)
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for i, col := range header {
+			record[i] = row[col]
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+func flattenCSV(row map[string]string, prefix string, v interface{}) {
+	key := prefix
+	if key == "" {
+		key = "value"
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, child := range x {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flattenCSV(row, k, child)
+		}
+	case []interface{}:
+		parts := make([]string, 0, len(x))
+		for _, item := range x {
+			if _, nested := item.(map[string]interface{}); nested {
+				b, _ := json.Marshal(item)
+				parts = append(parts, string(b))
+				continue
+			}
+			parts = append(parts, fmt.Sprint(item))
+		}
+		row[key] = strings.Join(parts, ";")
+	case nil:
+		row[key] = ""
+	default:
+		row[key] = fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                                   mediaJSON,
+		"*/*":                                mediaJSON,
+		"application/msgpack":                mediaMsgPack,
+		"application/x-msgpack":              mediaMsgPack,
+		"text/csv":                           mediaCSV,
+		"text/csv;q=0.5, application/json":   mediaJSON,
+		"application/json;q=0.1, text/csv":   mediaCSV,
+		"image/png":                          "",
+		"application/xml, text/csv;q=0.2":    mediaCSV,
+		"application/msgpack;q=0, text/html": "",
+	}
+	for accept, want := range cases {
+		if got := negotiate(accept); got != want {
+			t.Errorf("negotiate(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestWritePaidDataFormats(t *testing.T) {
+	data := map[string]interface{}{
+		"timestamp": 1700000000,
+		"gas":       map[string]string{"fast": "30", "slow": "10"},
+		"sources":   []string{"a", "b"},
+	}
+
+	serve := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		writePaidData(rr, req, data)
+		return rr
+	}
+
+	rr := serve("text/csv")
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, mediaCSV) {
+		t.Fatalf("Content-Type = %q, want text/csv", ct)
+	}
+	want := "gas.fast,gas.slow,sources,timestamp\n30,10,a;b,1700000000\n"
+	if rr.Body.String() != want {
+		t.Errorf("csv body = %q, want %q", rr.Body.String(), want)
+	}
+
+	rr = serve("application/msgpack")
+	if rr.Header().Get("Content-Type") != mediaMsgPack {
+		t.Fatalf("Content-Type = %q, want msgpack", rr.Header().Get("Content-Type"))
+	}
+	// fixmap(3) {"data": fixmap(3) {"gas": ...
+	if !bytes.HasPrefix(rr.Body.Bytes(), []byte("\x83\xa4data\x83\xa3gas\x82\xa4fast\xa230")) {
+		t.Errorf("unexpected msgpack body: %x", rr.Body.Bytes())
+	}
+	if !bytes.HasSuffix(rr.Body.Bytes(), []byte("\xb0payment_verified\xc3")) {
+		t.Errorf("msgpack body missing payment_verified: %x", rr.Body.Bytes())
+	}
+
+	rr = serve("image/png")
+	if rr.Code != http.StatusNotAcceptable {
+		t.Errorf("unsupported Accept returned %d, want 406", rr.Code)
+	}
+}
+
+func TestEncodeCSVRows(t *testing.T) {
+	entries := []LedgerEntry{
+		{ID: "pay_1", Endpoint: "/api/gas", AmountUSD: 0.001},
+		{ID: "pay_2", Endpoint: "/api/price", AmountUSD: 0.002},
+	}
+	out, err := encodeCSV(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want header + 2 rows:\n%s", len(lines), out)
+	}
+	if !strings.Contains(lines[0], "amount_usd") || !strings.Contains(lines[2], "pay_2") {
+		t.Errorf("unexpected csv:\n%s", out)
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	data := map[string]interface{}{
+		"timestamp": 1700000000,
+		"gas":       map[string]string{"fast": "30", "slow": "10"},
+		"source":    "rpc",
+	}
+
+	req := httptest.NewRequest("GET", "/api/gas?fields=gas.fast,timestamp,missing", nil)
+	rr := httptest.NewRecorder()
+	writePaidData(rr, req, data)
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	want := `{"gas":{"fast":"30"},"timestamp":1700000000}`
+	if got := string(body.Data); got != want {
+		t.Errorf("data = %s, want %s", got, want)
+	}
+
+	rows, _ := selectFields([]map[string]int{{"a": 1, "b": 2}, {"a": 3}}, []string{"a"})
+	if got, _ := jsonTree(rows); len(got.([]interface{})) != 2 {
+		t.Errorf("list filtering dropped rows: %v", got)
+	}
+}
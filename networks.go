@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PaymentNetwork is a chain payments can be made on
+type PaymentNetwork struct {
+	ChainID int64
+	RPC     string            // public JSON-RPC endpoint, for settlement checks
+	Native  string            // the asset paid as the transaction value
+	Assets  map[string]string // asset -> token contract
+	OPStack bool              // an OP-stack rollup, charging an L1 data fee per transaction
+}
+
+// paymentNetworks are the chains payments can be accepted on, with the
+// contracts of the assets they are paid in
+var paymentNetworks = map[string]PaymentNetwork{
+	"base": {ChainID: 8453, RPC: defaultBaseRPC, Native: "ETH", OPStack: true, Assets: map[string]string{
+		"USDC": "0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913",
+		"DAI":  "0x50c5725949A6F0c72E6C4a641F24049A917DB0Cb",
+		"WETH": "0x4200000000000000000000000000000000000006",
+	}},
+	"base-sepolia": {ChainID: 84532, RPC: "https://sepolia.base.org", Native: "ETH", OPStack: true, Assets: map[string]string{
+		"USDC": "0x036CbD53842c5426634e7929541eC2318f3dCF7e",
+	}},
+	"ethereum": {ChainID: 1, RPC: "https://ethereum-rpc.publicnode.com", Native: "ETH", Assets: map[string]string{
+		"USDC": "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+		"DAI":  "0x6B175474E89094C44Da98b954EedeAC495271d0F",
+		"WETH": "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+	}},
+	"polygon": {ChainID: 137, RPC: "https://polygon-rpc.com", Native: "POL", Assets: map[string]string{
+		"USDC": "0x3c499c542cEF5E3811e1192ce70d8cC03d5c3359",
+		"DAI":  "0x8f3Cf7ad23Cd3CaDbD9735AFf958023239c6A063",
+		"WETH": "0x7ceB23fD6bC0adD59E62ac25578270cFf1b9f619",
+	}},
+}
+
+// assetOn returns the contract asset is paid with on network, empty for
+// the network's native asset, and whether it can be paid there at all
+func assetOn(network, asset string) (contract string, ok bool) {
+	n := paymentNetworks[network]
+	if asset != "" && asset == n.Native {
+		return "", true
+	}
+	contract, ok = n.Assets[asset]
+	return contract, ok
+}
+
+// networkTokens returns every network's asset contracts, by "network:asset"
+func networkTokens() map[string]string {
+	tokens := make(map[string]string)
+	for name, network := range paymentNetworks {
+		for asset, contract := range network.Assets {
+			tokens[name+":"+asset] = contract
+		}
+	}
+	return tokens
+}
+
+// networkRPCs returns every network's public JSON-RPC endpoint, the ones
+// payments are verified against by default
+func networkRPCs() map[string]string {
+	rpcs := make(map[string]string, len(paymentNetworks))
+	for name, network := range paymentNetworks {
+		rpcs[name] = network.RPC
+	}
+	return rpcs
+}
+
+// PaymentNetworkConfig accepts payments on another network besides the
+// deployment's own. Without a receiver they are paid to the deployment's
+// receiver, and without endpoints every paid endpoint accepts them.
+// Tenants are always paid to their own receiver.
+type PaymentNetworkConfig struct {
+	Network   string   `json:"network"`
+	Receiver  string   `json:"receiver,omitempty"`
+	Endpoints []string `json:"endpoints,omitempty"`
+}
+
+func (n *PaymentNetworkConfig) validate() error {
+	if _, ok := paymentNetworks[n.Network]; !ok {
+		return fmt.Errorf("payment network %q: want one of %s", n.Network, strings.Join(sortedKeys(paymentNetworks), ", "))
+	}
+	if n.Receiver != "" {
+		if err := address.Validate(n.Receiver); err != nil {
+			return fmt.Errorf("payment network %s receiver: %w", n.Network, err)
+		}
+	}
+	for _, endpoint := range n.Endpoints {
+		if !strings.HasPrefix(endpoint, "/") {
+			return fmt.Errorf("payment network %s: endpoint %q must start with /", n.Network, endpoint)
+		}
+	}
+	return nil
+}
+
+// accepts reports whether endpoint can be paid on the network. An empty
+// endpoint is the service as a whole, which only networks open to every
+// endpoint accept.
+func (n *PaymentNetworkConfig) accepts(endpoint string) bool {
+	if len(n.Endpoints) == 0 {
+		return true
+	}
+	for _, e := range n.Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedNetwork is a network a quote can be paid on, and who is paid
+type acceptedNetwork struct {
+	network  string
+	receiver string
+}
+
+// acceptedNetworks returns the networks endpoint can be paid on: primary,
+// paid to receiver, then the configured networks accepting endpoint, in
+// config order. A configured entry for primary only changes its receiver.
+// Tenants are paid to receiver on every network.
+func (c *RuntimeConfig) acceptedNetworks(endpoint, primary, receiver string, tenant bool) []acceptedNetwork {
+	out := []acceptedNetwork{{network: primary, receiver: receiver}}
+	for _, n := range c.PaymentNetworks {
+		if !n.accepts(endpoint) {
+			continue
+		}
+		to := receiver
+		if n.Receiver != "" && !tenant {
+			to = n.Receiver
+		}
+		if n.Network == primary {
+			out[0].receiver = to
+			continue
+		}
+		out = append(out, acceptedNetwork{network: n.Network, receiver: to})
+	}
+	return out
+}
+
+// networkNames returns the networks payments are accepted on anywhere in
+// the service, primary first and the rest sorted
+func (c *RuntimeConfig) networkNames(primary string) []string {
+	seen := map[string]bool{primary: true}
+	var rest []string
+	for _, n := range c.PaymentNetworks {
+		if !seen[n.Network] {
+			seen[n.Network] = true
+			rest = append(rest, n.Network)
+		}
+	}
+	sort.Strings(rest)
+	return append([]string{primary}, rest...)
+}
+
+// claimedPayment returns the network and asset a payment says it was made
+// in, before any of it is checked, so it is checked against that network's
+// receiver and that asset's price. Exact payments do not name their asset.
+func claimedPayment(scheme, token string) (network, asset string) {
+	if scheme == SchemeExact {
+		var payment ExactPayment
+		if data, err := base64.StdEncoding.DecodeString(token); err == nil {
+			json.Unmarshal(data, &payment)
+		}
+		return payment.Network, ""
+	}
+	claims := &PaymentToken{}
+	new(jwt.Parser).ParseUnverified(token, claims)
+	return claims.Payment.Network, claims.Payment.Asset
+}
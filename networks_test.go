@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParsePaymentNetworks(t *testing.T) {
+	for name, raw := range map[string]string{
+		"unknown network":   `{"payment_networks": [{"network": "solana"}]}`,
+		"invalid receiver":  `{"payment_networks": [{"network": "polygon", "receiver": "0x1234"}]}`,
+		"relative endpoint": `{"payment_networks": [{"network": "polygon", "endpoints": ["api/gas"]}]}`,
+		"duplicate network": `{"payment_networks": [{"network": "polygon"}, {"network": "polygon", "endpoints": ["/api/gas"]}]}`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(raw)); err == nil {
+			t.Errorf("%s: config accepted", name)
+		}
+	}
+}
+
+func TestPaywallMultiNetwork(t *testing.T) {
+	const polygonReceiver = "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+	cfg, err := parseRuntimeConfig([]byte(`{"payment_networks": [
+		{"network": "ethereum"},
+		{"network": "polygon", "receiver": "` + polygonReceiver + `", "endpoints": ["/api/gas"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	handlers := map[string]http.HandlerFunc{
+		"/api/gas":  paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {}),
+		"/api/scan": paywall.Protect("/api/scan", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {}),
+	}
+	call := func(endpoint, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", endpoint, nil)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		rr := httptest.NewRecorder()
+		handlers[endpoint](rr, req)
+		return rr
+	}
+
+	// Each endpoint is challenged on every network it accepts, the
+	// deployment's first
+	for endpoint, want := range map[string][]string{
+		"/api/gas":  {"base " + config.Receiver, "ethereum " + config.Receiver, "polygon " + polygonReceiver},
+		"/api/scan": {"base " + config.Receiver, "ethereum " + config.Receiver},
+	} {
+		var body struct {
+			Payment PaymentRequirement   `json:"payment"`
+			Accepts []PaymentRequirement `json:"accepts"`
+		}
+		if err := json.NewDecoder(call(endpoint, "").Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, req := range body.Accepts {
+			got = append(got, req.Network+" "+req.Receiver)
+			if req.AssetAddress != payoutTokens[req.Network+":USDC"] {
+				t.Errorf("%s on %s: asset address %q", endpoint, req.Network, req.AssetAddress)
+			}
+		}
+		if strings.Join(got, ", ") != strings.Join(want, ", ") || body.Payment.Network != "base" {
+			t.Errorf("%s accepts %v, want %v", endpoint, got, want)
+		}
+	}
+
+	pay := func(network, receiver string) string {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Network = network
+		claims.Payment.Receiver = receiver
+		return signPayment(t, claims)
+	}
+	// A payment goes to the receiver on the network it was made on
+	if rr := call("/api/gas", pay("polygon", config.Receiver)); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("polygon payment to the base receiver returned %d, want 402", rr.Code)
+	}
+	if rr := call("/api/gas", pay("polygon", polygonReceiver)); rr.Code != http.StatusOK {
+		t.Fatalf("polygon payment returned %d: %s", rr.Code, rr.Body)
+	}
+	entries := ledger.Entries(DefaultTenant)
+	if len(entries) != 1 || entries[0].Network != "polygon" || entries[0].Receiver != polygonReceiver {
+		t.Errorf("ledger = %+v, want the polygon payment", entries)
+	}
+
+	// Strict mode refuses networks the endpoint does not accept
+	paywall.SetStrictPayments(&StrictPayments{Audience: "https://api.example.com"})
+	q, err := paywall.quote(httptest.NewRequest("GET", "/api/scan", nil).Context(), "/api/scan", "0.001", 0.001, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := paywall.checkNetwork("ethereum", q); err != nil {
+		t.Errorf("ethereum refused: %v", err)
+	}
+	if _, err := paywall.checkNetwork("polygon", q); err == nil || !strings.Contains(err.Error(), "want base or ethereum") {
+		t.Errorf("polygon on /api/scan: err = %v", err)
+	}
+}
+
+func TestAcceptedNetworksForTenant(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(`{"payment_networks": [
+		{"network": "base", "receiver": "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"},
+		{"network": "polygon", "receiver": "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const tenantReceiver = "0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC"
+	// The operator's receivers are never used for a tenant's payments
+	for _, n := range cfg.acceptedNetworks("/api/gas", "base", tenantReceiver, true) {
+		if n.receiver != tenantReceiver {
+			t.Errorf("tenant paid to %s on %s", n.receiver, n.network)
+		}
+	}
+	if got := cfg.acceptedNetworks("/api/gas", "base", "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91", false); len(got) != 2 || got[0].receiver != "0x70997970C51812dc3A010C7d01b50e0d17dc79C8" {
+		t.Errorf("networks = %+v, want base with its configured receiver, then polygon", got)
+	}
+}
+
+func TestPaywallMultiAsset(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(`{"payment_networks": [{"network": "polygon"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	var others []*PriceConverter
+	for _, asset := range []string{"DAI", "ETH"} {
+		conv, err := NewPriceConverter(asset, "usd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conv.assetUSD = func(string) (float64, error) { return 2000, nil }
+		others = append(others, conv)
+	}
+	paywall.SetAssets(others)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+	call := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	// Every asset is offered on the networks it can be paid on, each in
+	// its own decimals. Polygon's native asset is not ETH.
+	var body struct {
+		Accepts []PaymentRequirement `json:"accepts"`
+	}
+	if err := json.NewDecoder(call("").Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, req := range body.Accepts {
+		got = append(got, req.Network+" "+req.MinAmount+"-"+req.MaxAmount+" "+req.Asset+" "+req.AssetAddress)
+	}
+	want := []string{
+		"base 0.001-0.001 USDC " + payoutTokens["base:USDC"],
+		"base 0.001-0.001 DAI " + payoutTokens["base:DAI"],
+		"base 0.00000049-0.0000005 ETH ",
+		"polygon 0.001-0.001 USDC " + payoutTokens["polygon:USDC"],
+		"polygon 0.001-0.001 DAI " + payoutTokens["polygon:DAI"],
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("accepts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// A payment is checked against the price in the asset it names
+	pay := func(amount, asset string) string {
+		claims := PaymentToken{}
+		claims.Payment.Amount = amount
+		claims.Payment.Asset = asset
+		claims.Payment.Network = "base"
+		claims.Payment.Receiver = config.Receiver
+		return signPayment(t, claims)
+	}
+	for _, payment := range []struct {
+		amount, asset string
+		want          int
+	}{
+		{"0.001", "DAI", http.StatusOK},
+		{"0.0000005", "ETH", http.StatusOK},
+		{"0.0000005", "USDC", http.StatusPaymentRequired},
+		{"0.001", "ETH", http.StatusPaymentRequired},
+		{"0.001", "USDT", http.StatusPaymentRequired},
+	} {
+		if rr := call(pay(payment.amount, payment.asset)); rr.Code != payment.want {
+			t.Errorf("%s %s returned %d, want %d", payment.amount, payment.asset, rr.Code, payment.want)
+		}
+	}
+	var assets []string
+	for _, e := range ledger.Entries(DefaultTenant) {
+		assets = append(assets, e.Amount+" "+e.Asset)
+	}
+	if strings.Join(assets, ", ") != "0.0000005 ETH, 0.001 DAI" {
+		t.Errorf("ledger = %v", assets)
+	}
+}
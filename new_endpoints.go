@@ -2,13 +2,13 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
 	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
 )
 
 // ==================== NEW ENDPOINT TYPES ====================
@@ -31,11 +31,13 @@ type TokenScanResult struct {
 	HasBlacklist     bool     `json:"has_blacklist"`
 	IsProxy          bool     `json:"is_proxy"`
 	IsVerified       bool     `json:"is_verified"`
-	TotalSupply      string   `json:"total_supply,omitempty"`
+	Known            string   `json:"known_contract,omitempty"` // name of a recognized protocol contract
+	TokenState
 	HolderCount      int      `json:"holder_count,omitempty"`
 	Flags            []string `json:"flags"`
 	Warnings         []string `json:"warnings"`
 	ScannedAt        int64    `json:"scanned_at"`
+	Scoring
 }
 
 // WalletScanRequest represents the input for wallet portfolio scanning
@@ -66,6 +68,7 @@ type WalletScanResult struct {
 	SuspiciousTokens int           `json:"suspicious_tokens"`
 	RiskScore       int            `json:"risk_score"` // Aggregate risk
 	ScannedAt       int64          `json:"scanned_at"`
+	Scoring
 }
 
 // AddressLabelRequest represents the input for address label lookup
@@ -101,9 +104,14 @@ type MEVCheckResult struct {
 	SandwichRisk      string   `json:"sandwich_risk"`      // "low", "medium", "high"
 	FrontrunRisk      string   `json:"frontrun_risk"`      // "low", "medium", "high"
 	GasPriceRisk      string   `json:"gas_price_risk"`     // "low", "medium", "high"
-	RecommendedSlippage string `json:"recommended_slippage"`
+	RecommendedSlippage string `json:"recommended_slippage,omitempty"` // swaps only
 	ProtectedRPCs     []string `json:"protected_rpcs,omitempty"`
+	Swap              *SwapAnalysis `json:"swap,omitempty"`
+	Bridge            *BridgeInfo `json:"bridge,omitempty"`
+	Fees              *FeeRecommendation `json:"fees,omitempty"`
+	PolicyViolations  []string `json:"policy_violations,omitempty"` // the payer's watch list, see /api/watchlist
 	CheckedAt         int64    `json:"checked_at"`
+	Scoring
 }
 
 // ==================== TOKEN SCANNER ====================
@@ -117,14 +125,14 @@ func handleTokenScan(w http.ResponseWriter, r *http.Request) {
 
 	var req TokenScanRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Token scan decode error: %v", err)
+		log.Printf("Token scan decode error (payer=%s): %v", payerLabel(r), err)
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	// Validate address
-	if !isValidAddress(req.Address) {
-		http.Error(w, "Invalid address format", http.StatusBadRequest)
+	// Validate address (hex + EIP-55 checksum)
+	if err := address.Validate(req.Address); err != nil {
+		http.Error(w, "Invalid address: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -132,19 +140,16 @@ func handleTokenScan(w http.ResponseWriter, r *http.Request) {
 	if req.Chain == "" {
 		req.Chain = "base"
 	}
-	if req.Chain != "base" && req.Chain != "ethereum" {
-		http.Error(w, "Chain must be 'base' or 'ethereum'", http.StatusBadRequest)
+	if _, ok := runtimeConfig.Current().Chain(req.Chain); !ok {
+		http.Error(w, "Chain must be one of "+runtimeConfig.Current().ChainNames(), http.StatusBadRequest)
 		return
 	}
 
 	// Perform scan (mock for now, would integrate with API)
 	result := scanToken(req.Address, req.Chain)
+	events.Publish(r.Context(), EventScanCompleted, ScanCompleted{Kind: "token", Chain: req.Chain, Address: req.Address, Result: result})
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":            result,
-		"payment_verified": true,
-	})
+	writePaidData(w, r, result)
 }
 
 // scanToken performs token risk analysis
@@ -157,23 +162,34 @@ func scanToken(address, chain string) TokenScanResult {
 		Warnings:  []string{},
 	}
 
+	if warning := specialAddressWarning(address); warning != "" {
+		result.Flags = append(result.Flags, "special_address")
+		result.Warnings = append(result.Warnings, warning)
+		result.RiskScore += runtimeConfig.Current().RiskWeight(RuleSpecialAddress)
+	}
+	if runtimeConfig.Current().IsBlocked(address) {
+		result.Flags = append(result.Flags, "blocklisted")
+		result.Warnings = append(result.Warnings, "Address is on the operator blocklist")
+		result.RiskScore += runtimeConfig.Current().RiskWeight(RuleBlocklisted)
+	}
+
 	// Try to fetch contract info from explorer
-	apiKey := getAPIKeyForChain(chain)
-	if apiKey != "" {
+	chainConfig, _ := runtimeConfig.Current().Chain(chain)
+	if chainConfig.APIKey() != "" {
 		// Fetch contract ABI to check for risky functions
-		if abi, err := fetchContractABI(address, chain, apiKey); err == nil {
+		if abi, err := providers.Explorer.ContractABI(address, chainConfig); err == nil {
 			// Check for mint function
 			if strings.Contains(abi, "mint") || strings.Contains(abi, "_mint") {
 				result.HasMintFunction = true
 				result.Warnings = append(result.Warnings, "Contract has mint function - supply can be inflated")
-				result.RiskScore += 20
+				result.RiskScore += runtimeConfig.Current().RiskWeight(RuleMintFunction)
 			}
 
 			// Check for blacklist
 			if strings.Contains(abi, "blacklist") || strings.Contains(abi, "blocked") {
 				result.HasBlacklist = true
 				result.Warnings = append(result.Warnings, "Contract can blacklist addresses")
-				result.RiskScore += 15
+				result.RiskScore += runtimeConfig.Current().RiskWeight(RuleBlacklistFunction)
 			}
 
 			// Check for proxy
@@ -187,20 +203,38 @@ func scanToken(address, chain string) TokenScanResult {
 			result.IsVerified = false
 			result.Flags = append(result.Flags, "unverified_contract")
 			result.Warnings = append(result.Warnings, "Contract source code is not verified")
-			result.RiskScore += 30
+			result.RiskScore += runtimeConfig.Current().RiskWeight(RuleUnverifiedContract)
 		}
 	}
 
+	// Owner, supply, liquidity and taxes, compared by /api/scan-token/diff
+	state, honeypot := fetchTokenState(address, chainConfig)
+	result.TokenState = state
+	if honeypot {
+		result.IsHoneypot = true
+		result.Flags = append(result.Flags, "honeypot_indicators")
+		result.Warnings = append(result.Warnings, "Honeypot patterns detected - extreme caution")
+		result.RiskScore += runtimeConfig.Current().RiskWeight(RuleHoneypot)
+	}
+
 	// Additional heuristics would go here:
-	// - Check honeypot.is or similar service
 	// - Analyze holder distribution
 	// - Check liquidity locked
-	// - Verify ownership renounced
+
+	// Recognized protocol contracts are capped unless blocklisted
+	if name, ok := runtimeConfig.Current().KnownContract(chain, address); ok && !runtimeConfig.Current().IsBlocked(address) {
+		result.Known = name
+		result.Flags = append(result.Flags, "recognized_protocol_contract")
+		if result.RiskScore > knownContractMaxRisk {
+			result.RiskScore = knownContractMaxRisk
+		}
+	}
 
 	// Cap risk score
 	if result.RiskScore > 100 {
 		result.RiskScore = 100
 	}
+	result.Scoring = scoring("token", runtimeConfig.Current(), result.ScannedAt, SourceExplorer, SourceHoneypot)
 
 	return result
 }
@@ -216,13 +250,13 @@ func handleWalletScan(w http.ResponseWriter, r *http.Request) {
 
 	var req WalletScanRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Wallet scan decode error: %v", err)
+		log.Printf("Wallet scan decode error (payer=%s): %v", payerLabel(r), err)
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	if !isValidAddress(req.Address) {
-		http.Error(w, "Invalid address format", http.StatusBadRequest)
+	if err := address.Validate(req.Address); err != nil {
+		http.Error(w, "Invalid address: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -232,11 +266,7 @@ func handleWalletScan(w http.ResponseWriter, r *http.Request) {
 
 	result := scanWallet(req.Address, req.Chain)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":            result,
-		"payment_verified": true,
-	})
+	writePaidData(w, r, result)
 }
 
 // scanWallet performs wallet portfolio analysis
@@ -288,6 +318,7 @@ func scanWallet(address, chain string) WalletScanResult {
 	if result.RiskScore > 100 {
 		result.RiskScore = 100
 	}
+	result.Scoring = scoring("wallet", runtimeConfig.Current(), result.ScannedAt)
 
 	return result
 }
@@ -303,23 +334,19 @@ func handleAddressLabel(w http.ResponseWriter, r *http.Request) {
 
 	var req AddressLabelRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Address label decode error: %v", err)
+		log.Printf("Address label decode error (payer=%s): %v", payerLabel(r), err)
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	if !isValidAddress(req.Address) {
-		http.Error(w, "Invalid address format", http.StatusBadRequest)
+	if err := address.Validate(req.Address); err != nil {
+		http.Error(w, "Invalid address: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	result := lookupAddressLabel(req.Address)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":            result,
-		"payment_verified": true,
-	})
+	writePaidData(w, r, result)
 }
 
 // Known address labels database (expandable)
@@ -376,18 +403,15 @@ func handleMEVCheck(w http.ResponseWriter, r *http.Request) {
 
 	var req MEVCheckRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("MEV check decode error: %v", err)
+		log.Printf("MEV check decode error (payer=%s): %v", payerLabel(r), err)
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	result := checkMEVRisk(req)
+	watchLists.checkMEV(r.Context(), req, &result)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":            result,
-		"payment_verified": true,
-	})
+	writePaidData(w, r, result)
 }
 
 // checkMEVRisk analyzes transaction for MEV exposure
@@ -399,7 +423,6 @@ func checkMEVRisk(req MEVCheckRequest) MEVCheckResult {
 		SandwichRisk:      "low",
 		FrontrunRisk:      "low",
 		GasPriceRisk:      "low",
-		RecommendedSlippage: "0.5%",
 		ProtectedRPCs:     []string{
 			"https://rpc.flashbots.net",
 			"https://mevblocker.io",
@@ -407,44 +430,47 @@ func checkMEVRisk(req MEVCheckRequest) MEVCheckResult {
 		CheckedAt:         time.Now().Unix(),
 	}
 
-	// Parse value
-	valueWei := req.Value
-	if valueWei == "" {
-		valueWei = "0x0"
-	}
-
 	// Check for high value transfers
-	if valueWei != "0x0" && valueWei != "0" {
-		value, _ := strconv.ParseInt(strings.TrimPrefix(valueWei, "0x"), 16, 64)
-		if value > 1000000000000000000 { // > 1 ETH
-			result.RiskFactors = append(result.RiskFactors, "high_value_transfer")
-			result.MEVRiskScore += 20
+	value, err := units.ParseWei(req.Value)
+	if err != nil {
+		result.RiskFactors = append(result.RiskFactors, "invalid_value")
+	} else if value.Cmp(units.Ether) > 0 { // > 1 ETH
+		result.RiskFactors = append(result.RiskFactors, "high_value_transfer")
+		result.MEVRiskScore += 20
+	}
+
+	// Check DEX swaps: slippage and deadline come from the calldata
+	rpc := &RPCClient{url: getEnv("ETH_RPC_URL", "https://eth.drpc.org")}
+	if swap, findings := analyzeSwap(req, rpc); swap != nil {
+		result.Swap = swap
+		result.RiskFactors = append(result.RiskFactors, "dex_swap_detected")
+		result.SandwichRisk = "medium"
+		result.MEVRiskScore += 30
+		for _, f := range findings {
+			result.RiskFactors = append(result.RiskFactors, f.factor)
+			result.MEVRiskScore += f.score
+			if f.factor == "no_slippage_protection" || f.factor == "excessive_slippage" {
+				result.SandwichRisk = "high"
+			}
 		}
+		result.RecommendedSlippage = swap.recommendedSlippage()
 	}
 
-	// Check transaction data
-	if len(req.Data) > 10 {
-		// DEX swap signatures
-		swapSignatures := []string{
-			"0x38ed1739", // swapExactTokensForTokens
-			"0x8803dbee", // swapTokensForExactTokens
-			"0x7ff36ab5", // swapExactETHForTokens
-			"0x18cbafe5", // swapExactTokensForETH
-		}
-
-		for _, sig := range swapSignatures {
-			if strings.HasPrefix(req.Data, sig) {
-				result.RiskFactors = append(result.RiskFactors, "dex_swap_detected")
-				result.SandwichRisk = "medium"
-				result.MEVRiskScore += 30
-				result.RecommendedSlippage = "0.1%"
-				break
-			}
-		}
+	// Check bridge interactions
+	bridge, findings := checkBridge(req.To, req.Data)
+	result.Bridge = bridge
+	for _, f := range findings {
+		result.RiskFactors = append(result.RiskFactors, f.factor)
+		result.MEVRiskScore += f.score
 	}
 
-	// Check gas price risk
-	gasPrice, _ := getCurrentGasPrice()
+	// Check gas price risk: what the next block costs to get into
+	fees, err := estimateFees(rpc)
+	var gasPrice float64
+	if err == nil {
+		result.Fees = fees
+		gasPrice = fees.BaseFeeGwei + fees.MaxPriorityFeePerGasGwei
+	}
 	if gasPrice > 50 {
 		result.GasPriceRisk = "high"
 		result.MEVRiskScore += 10
@@ -465,60 +491,26 @@ func checkMEVRisk(req MEVCheckRequest) MEVCheckResult {
 	if result.MEVRiskScore > 100 {
 		result.MEVRiskScore = 100
 	}
+	result.Scoring = scoring("mev", runtimeConfig.Current(), result.CheckedAt, SourceRPC, SourceExplorer)
 
 	return result
 }
 
 // ==================== HELPERS ====================
 
-// getAPIKeyForChain returns the appropriate API key
-func getAPIKeyForChain(chain string) string {
-	if chain == "base" {
-		return os.Getenv("BASESCAN_API_KEY")
-	}
-	return os.Getenv("ETHERSCAN_API_KEY")
+// isValidAddress validates Ethereum address format and EIP-55 checksum
+func isValidAddress(addr string) bool {
+	return address.Validate(addr) == nil
 }
 
-// fetchContractABI fetches contract ABI from explorer
-func fetchContractABI(address, chain, apiKey string) (string, error) {
-	baseURL := "https://api.basescan.org/api"
-	if chain == "ethereum" {
-		baseURL = "https://api.etherscan.io/api"
-	}
-
-	url := fmt.Sprintf("%s?module=contract&action=getabi&address=%s&apikey=%s",
-		baseURL, address, apiKey)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Result  string `json:"result"`
+// specialAddressWarning describes why addr is not a normal account, or
+// returns "" for ordinary addresses
+func specialAddressWarning(addr string) string {
+	switch {
+	case address.IsZero(addr):
+		return "Zero address - funds sent here are burned"
+	case address.IsPrecompile(addr):
+		return "Precompile address - not a regular account or contract"
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
-
-	if result.Status != "1" {
-		return "", fmt.Errorf("API error: %s", result.Message)
-	}
-
-	return result.Result, nil
-}
-
-// getCurrentGasPrice gets current gas price (simplified)
-func getCurrentGasPrice() (float64, error) {
-	// Would integrate with actual RPC
-	return 20.0, nil // Placeholder
-}
-
-// isValidAddress validates Ethereum address format
-func isValidAddress(addr string) bool {
-	return len(addr) == 42 && strings.HasPrefix(addr, "0x")
+	return ""
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// challengeNonceTTL is how long a 402 challenge's nonce can be paid with
+const challengeNonceTTL = 5 * time.Minute
+
+// nonceKey is where an issued nonce waits in the shared state. Its value
+// is the endpoint and receiver it was quoted for.
+func nonceKey(nonce string) string {
+	return "nonce:" + nonce
+}
+
+func nonceBinding(q quote) string {
+	return q.endpoint + " " + q.receiver
+}
+
+// noncesRequired reports whether payments must echo a challenge nonce: with
+// the challenge_nonces flag on, and always in strict mode
+func (p *Paywall) noncesRequired() bool {
+	return p.strict != nil || featureFlags.Enabled(FlagChallengeNonces)
+}
+
+// issueNonce returns a fresh nonce for a challenge and when it expires, or
+// nothing unless nonces are required. A token minted before the challenge
+// cannot carry it, so clients cannot stock up on tokens at an old price.
+func (p *Paywall) issueNonce(q quote) (string, int64) {
+	if !p.noncesRequired() {
+		return "", 0
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	if err := sharedState.Set(nonceKey(nonce), nonceBinding(q), challengeNonceTTL); err != nil {
+		log.Printf("⚠️  Challenge nonce not stored: %v", err)
+	}
+	return nonce, p.clock.Now().Add(challengeNonceTTL).Unix()
+}
+
+// consumeNonce reports why a payment for q may not proceed, if it may not.
+// When nonces are required, nonce must have been issued for the same
+// endpoint and receiver and not yet used or expired. Each nonce pays for
+// one request. If the store is unreachable the payment is allowed, except
+// in strict mode.
+func (p *Paywall) consumeNonce(nonce string, q quote) error {
+	if !p.noncesRequired() {
+		return nil
+	}
+	if nonce == "" {
+		return errors.New("payment does not echo the challenge nonce")
+	}
+	ok, err := sharedState.DeleteIf(nonceKey(nonce), nonceBinding(q))
+	if err != nil && p.strict != nil {
+		return fmt.Errorf("challenge nonces unavailable: %w", err)
+	}
+	if err != nil {
+		log.Printf("⚠️  Challenge nonces unavailable, allowing payment: %v", err)
+		return nil
+	}
+	if !ok {
+		return errors.New("unknown, used or expired challenge nonce")
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+)
+
+// Notification event kinds
+const (
+	NotifyPayment    = "payment"    // a payment was captured
+	NotifySettlement = "settlement" // a facilitator settled a payment on-chain
+	NotifyMonitor    = "monitor"    // a monitor changed state, e.g. a stablecoin depegged
+	NotifySLO        = "slo"        // an endpoint breached or recovered its error-rate SLO
+	NotifyPayout     = "payout"     // payments at the receiver are due to be swept
+	NotifyTest       = "test"       // sent from the admin API to check a channel
+)
+
+// Notification channel types
+const (
+	ChannelTelegram = "telegram"
+	ChannelDiscord  = "discord"
+	ChannelSlack    = "slack"
+	ChannelEmail    = "email"
+)
+
+// defaultNotifyRate is how many notifications a channel sends per minute
+// unless its config says otherwise
+const defaultNotifyRate = 10
+
+// defaultTemplates render each event kind unless a channel overrides them
+var defaultTemplates = map[string]string{
+	NotifyPayment:    `💳 Payment of {{.Data.amount}} {{.Data.asset}} for {{.Data.endpoint}} from {{.Data.payer}} (id {{.Data.id}})`,
+	NotifySettlement: `⛓️ Payment {{.Data.id}} of {{.Data.amount}} {{.Data.asset}} settled in {{.Data.tx_hash}}`,
+	NotifyMonitor:    `🚨 {{.Data.message}}`,
+	NotifySLO:        `⚠️ {{.Data.message}}`,
+	NotifyPayout:     `🏦 {{.Data.message}}`,
+	NotifyTest:       `✅ Test notification for channel {{.Channel}}`,
+}
+
+// telegramAPI and sendMail are replaced in tests
+var (
+	telegramAPI = "https://api.telegram.org"
+	sendMail    = smtp.SendMail
+)
+
+// NotifierConfig is a notification channel from the config file. Secrets
+// are read from the environment variables it names.
+type NotifierConfig struct {
+	Name          string            `json:"name"`
+	Type          string            `json:"type"`                      // telegram, discord, slack or email
+	Events        []string          `json:"events,omitempty"`          // default monitor and slo
+	Templates     map[string]string `json:"templates,omitempty"`       // event kind -> text/template
+	RatePerMinute int               `json:"rate_per_minute,omitempty"` // default 10
+	URLEnv        string            `json:"url_env,omitempty"`         // discord and slack: webhook URL
+	TokenEnv      string            `json:"token_env,omitempty"`       // telegram: bot token
+	ChatID        string            `json:"chat_id,omitempty"`         // telegram
+	SMTPAddr      string            `json:"smtp_addr,omitempty"`       // email: host:port
+	From          string            `json:"from,omitempty"`            // email
+	To            []string          `json:"to,omitempty"`              // email
+	PasswordEnv   string            `json:"password_env,omitempty"`    // email: SMTP password, none if unset
+
+	templates map[string]*template.Template
+}
+
+func (c *NotifierConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("notifier needs a name")
+	}
+	switch c.Type {
+	case ChannelTelegram:
+		if c.TokenEnv == "" || c.ChatID == "" {
+			return fmt.Errorf("notifier %s: telegram needs token_env and chat_id", c.Name)
+		}
+	case ChannelDiscord, ChannelSlack:
+		if c.URLEnv == "" {
+			return fmt.Errorf("notifier %s: %s needs url_env", c.Name, c.Type)
+		}
+	case ChannelEmail:
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil || c.From == "" || len(c.To) == 0 {
+			return fmt.Errorf("notifier %s: email needs smtp_addr (host:port), from and to", c.Name)
+		}
+	default:
+		return fmt.Errorf("notifier %s: unknown type %q", c.Name, c.Type)
+	}
+	if c.RatePerMinute < 0 {
+		return fmt.Errorf("notifier %s: invalid rate_per_minute %d", c.Name, c.RatePerMinute)
+	}
+	for _, kind := range c.Events {
+		if _, ok := defaultTemplates[kind]; !ok || kind == NotifyTest {
+			return fmt.Errorf("notifier %s: unknown event %q", c.Name, kind)
+		}
+	}
+
+	c.templates = make(map[string]*template.Template, len(defaultTemplates))
+	for kind, text := range defaultTemplates {
+		if custom, ok := c.Templates[kind]; ok {
+			text = custom
+		}
+		tmpl, err := template.New(kind).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return fmt.Errorf("notifier %s: %s template: %w", c.Name, kind, err)
+		}
+		c.templates[kind] = tmpl
+	}
+	for kind := range c.Templates {
+		if _, ok := defaultTemplates[kind]; !ok {
+			return fmt.Errorf("notifier %s: template for unknown event %q", c.Name, kind)
+		}
+	}
+	return nil
+}
+
+// wants reports whether the channel subscribes to events of kind
+func (c *NotifierConfig) wants(kind string) bool {
+	if len(c.Events) == 0 {
+		return kind == NotifyMonitor || kind == NotifySLO
+	}
+	for _, k := range c.Events {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *NotifierConfig) rate() int {
+	if c.RatePerMinute == 0 {
+		return defaultNotifyRate
+	}
+	return c.RatePerMinute
+}
+
+// Notification is an event sent to the notification channels
+type Notification struct {
+	Kind string            `json:"kind"`
+	Data map[string]string `json:"data"`
+	At   time.Time         `json:"at"`
+}
+
+// render formats n with the channel's template for its kind
+func (c *NotifierConfig) render(n Notification) (string, error) {
+	var buf bytes.Buffer
+	err := c.templates[n.Kind].Execute(&buf, struct {
+		Notification
+		Channel string
+	}{n, c.Name})
+	return buf.String(), err
+}
+
+// Notifier delivers events to the channels in the runtime config. Each
+// channel has its own rate limit; events over it are dropped and counted.
+type Notifier struct {
+	client *http.Client
+
+	mu       sync.Mutex
+	limiters map[string]*ratelimit.Bucket // channel -> limiter
+	rates    map[string]int               // channel -> rate the limiter was built with
+	counts   map[string]map[string]int64
+}
+
+// NewNotifier creates a notifier with no delivery history
+func NewNotifier() *Notifier {
+	return &Notifier{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		limiters: make(map[string]*ratelimit.Bucket),
+		rates:    make(map[string]int),
+		counts:   make(map[string]map[string]int64),
+	}
+}
+
+// Notify sends an event of kind to every channel subscribed to it.
+// Delivery happens in the background; failures are logged and counted.
+func (n *Notifier) Notify(kind string, data map[string]string) {
+	if n == nil {
+		return
+	}
+	note := Notification{Kind: kind, Data: data, At: time.Now().UTC()}
+	channels := runtimeConfig.Current().Notifiers
+	for i := range channels {
+		ch := &channels[i]
+		if !ch.wants(kind) {
+			continue
+		}
+		if !n.allow(ch) {
+			n.count(ch.Name, "dropped")
+			continue
+		}
+		go func() {
+			if err := n.send(ch, note); err != nil {
+				log.Printf("⚠️  Notification to %s failed: %v", ch.Name, err)
+			}
+		}()
+	}
+}
+
+// onPaymentVerified announces a captured payment
+func (n *Notifier) onPaymentVerified(_ context.Context, e Event) error {
+	entry := e.Data.(VerifiedPayment).Entry
+	n.Notify(NotifyPayment, map[string]string{
+		"id":         entry.ID,
+		"tenant":     entry.Tenant,
+		"endpoint":   entry.Endpoint,
+		"payer":      entry.Payer,
+		"amount":     entry.Amount,
+		"asset":      entry.Asset,
+		"amount_usd": strconv.FormatFloat(entry.AmountUSD, 'f', -1, 64),
+	})
+	return nil
+}
+
+// onPaymentSettled announces a payment settled by the facilitator
+func (n *Notifier) onPaymentSettled(_ context.Context, e Event) error {
+	entry := e.Data.(SettledPayment).Entry
+	n.Notify(NotifySettlement, map[string]string{
+		"id":      entry.ID,
+		"tenant":  entry.Tenant,
+		"payer":   entry.Payer,
+		"amount":  entry.Amount,
+		"asset":   entry.Asset,
+		"tx_hash": entry.TxHash,
+	})
+	return nil
+}
+
+// onPaymentReorged alerts when a reorg drops or moves a payment's transfer
+func (n *Notifier) onPaymentReorged(_ context.Context, e Event) error {
+	r := e.Data.(ReorgedPayment)
+	n.Notify(NotifyMonitor, map[string]string{
+		"monitor": "reorg",
+		"id":      r.Entry.ID,
+		"tenant":  r.Entry.Tenant,
+		"payer":   r.Entry.Payer,
+		"amount":  r.Entry.Amount,
+		"asset":   r.Entry.Asset,
+		"network": r.Entry.Network,
+		"tx_hash": r.Entry.TxHash,
+		"status":  r.Entry.Status,
+		"message": "Payment " + r.Entry.ID + ": " + r.Reason,
+	})
+	return nil
+}
+
+// onUpstreamDegraded alerts when a provider is marked down and when it
+// recovers
+func (n *Notifier) onUpstreamDegraded(_ context.Context, e Event) error {
+	u := e.Data.(UpstreamDegradation)
+	message := fmt.Sprintf("Upstream %s is back up", u.Provider)
+	if u.Status == UpstreamDown {
+		message = fmt.Sprintf("Upstream %s is down: %s", u.Provider, u.LastError)
+	}
+	n.Notify(NotifyMonitor, map[string]string{
+		"monitor":  "upstream",
+		"provider": u.Provider,
+		"status":   u.Status,
+		"message":  message,
+	})
+	return nil
+}
+
+// allow takes a token from the channel's rate limit. Limiters are rebuilt
+// when a reload changes the channel's rate.
+func (n *Notifier) allow(ch *NotifierConfig) bool {
+	n.mu.Lock()
+	limiter, ok := n.limiters[ch.Name]
+	if !ok || n.rates[ch.Name] != ch.rate() {
+		limiter = ratelimit.New(ch.rate(), ch.rate())
+		n.limiters[ch.Name] = limiter
+		n.rates[ch.Name] = ch.rate()
+	}
+	n.mu.Unlock()
+	return limiter.Allow(ch.Name)
+}
+
+func (n *Notifier) count(channel, result string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.counts[channel] == nil {
+		n.counts[channel] = make(map[string]int64)
+	}
+	n.counts[channel][result]++
+}
+
+// send renders and delivers one notification
+func (n *Notifier) send(ch *NotifierConfig, note Notification) error {
+	text, err := ch.render(note)
+	if err == nil {
+		err = n.deliver(ch, note.Kind, text)
+	}
+	if err != nil {
+		n.count(ch.Name, "failed")
+		return err
+	}
+	n.count(ch.Name, "sent")
+	return nil
+}
+
+func (n *Notifier) deliver(ch *NotifierConfig, kind, text string) error {
+	switch ch.Type {
+	case ChannelTelegram:
+		url := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, os.Getenv(ch.TokenEnv))
+		return n.post(url, map[string]string{"chat_id": ch.ChatID, "text": text})
+	case ChannelDiscord:
+		return n.post(os.Getenv(ch.URLEnv), map[string]string{"content": text})
+	case ChannelSlack:
+		return n.post(os.Getenv(ch.URLEnv), map[string]string{"text": text})
+	case ChannelEmail:
+		host, _, _ := net.SplitHostPort(ch.SMTPAddr)
+		var auth smtp.Auth
+		if password := os.Getenv(ch.PasswordEnv); ch.PasswordEnv != "" && password != "" {
+			auth = smtp.PlainAuth("", ch.From, password, host)
+		}
+		msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [x402] %s notification\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+			ch.From, strings.Join(ch.To, ", "), kind, text)
+		return sendMail(ch.SMTPAddr, auth, ch.From, ch.To, []byte(msg))
+	}
+	return fmt.Errorf("unknown channel type %q", ch.Type)
+}
+
+func (n *Notifier) post(url string, payload interface{}) error {
+	if url == "" {
+		return fmt.Errorf("no URL configured")
+	}
+	body, _ := json.Marshal(payload)
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL carries the channel's secret; keep it out of the logs
+		return fmt.Errorf("post failed")
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("post returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// NotifierStatus is a channel as shown by the admin API
+type NotifierStatus struct {
+	Name          string           `json:"name"`
+	Type          string           `json:"type"`
+	Events        []string         `json:"events"`
+	RatePerMinute int              `json:"rate_per_minute"`
+	Counts        map[string]int64 `json:"counts"` // sent, failed, dropped
+}
+
+// handleAdminNotifications serves GET /admin/notifications, which lists
+// the channels and their delivery counts, and
+// POST /admin/notifications/{name}/test, which sends a test message
+// synchronously. Test sends are not rate limited.
+func (n *Notifier) handleAdminNotifications(w http.ResponseWriter, r *http.Request) {
+	channels := runtimeConfig.Current().Notifiers
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/notifications"), "/")
+
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		out := make([]NotifierStatus, 0, len(channels))
+		n.mu.Lock()
+		for i := range channels {
+			ch := &channels[i]
+			events := []string{}
+			for kind := range defaultTemplates {
+				if kind != NotifyTest && ch.wants(kind) {
+					events = append(events, kind)
+				}
+			}
+			sort.Strings(events)
+			counts := map[string]int64{"sent": 0, "failed": 0, "dropped": 0}
+			for result, c := range n.counts[ch.Name] {
+				counts[result] = c
+			}
+			out = append(out, NotifierStatus{Name: ch.Name, Type: ch.Type, Events: events, RatePerMinute: ch.rate(), Counts: counts})
+		}
+		n.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	name, action, _ := strings.Cut(rest, "/")
+	if action != "test" {
+		http.Error(w, `{"error":"Not found"}`, http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	for i := range channels {
+		if channels[i].Name != name {
+			continue
+		}
+		note := Notification{Kind: NotifyTest, Data: map[string]string{}, At: time.Now().UTC()}
+		w.Header().Set("Content-Type", "application/json")
+		if err := n.send(&channels[i], note); err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]interface{}{"sent": false, "error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sent": true})
+		return
+	}
+	http.Error(w, `{"error":"Unknown notifier"}`, http.StatusNotFound)
+}
+
+// WriteMetrics writes the x402_notifications_total counter
+func (n *Notifier) WriteMetrics(b *strings.Builder) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	channels := make([]string, 0, len(n.counts))
+	for name := range n.counts {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+
+	b.WriteString("# HELP x402_notifications_total Notifications by channel and result\n")
+	b.WriteString("# TYPE x402_notifications_total counter\n")
+	for _, name := range channels {
+		for _, result := range []string{"sent", "failed", "dropped"} {
+			fmt.Fprintf(b, "x402_notifications_total{channel=%q,result=%q} %d\n", name, result, n.counts[name][result])
+		}
+	}
+}
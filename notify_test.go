@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// notifyTarget records the JSON bodies posted to it
+func notifyTarget(t *testing.T) (*httptest.Server, chan map[string]string) {
+	t.Helper()
+	got := make(chan map[string]string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		body["path"] = r.URL.Path
+		got <- body
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func useNotifiers(t *testing.T, notifiers string) {
+	t.Helper()
+	cfg, err := parseRuntimeConfig([]byte(`{"notifiers": ` + notifiers + `}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	t.Cleanup(func() { runtimeConfig.current.Store(previous) })
+}
+
+func receive(t *testing.T, got chan map[string]string) map[string]string {
+	t.Helper()
+	select {
+	case body := <-got:
+		return body
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notification delivered")
+		return nil
+	}
+}
+
+func TestNotifierChannels(t *testing.T) {
+	srv, got := notifyTarget(t)
+	t.Setenv("TEST_SLACK_URL", srv.URL+"/slack")
+	t.Setenv("TEST_DISCORD_URL", srv.URL+"/discord")
+	t.Setenv("TEST_TELEGRAM_TOKEN", "123:abc")
+	previousAPI := telegramAPI
+	telegramAPI = srv.URL
+	t.Cleanup(func() { telegramAPI = previousAPI })
+
+	mail := make(chan string, 1)
+	previousMail := sendMail
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mail <- addr + " " + strings.Join(to, ",") + "\n" + string(msg)
+		return nil
+	}
+	t.Cleanup(func() { sendMail = previousMail })
+
+	useNotifiers(t, `[
+		{"name": "ops-slack", "type": "slack", "url_env": "TEST_SLACK_URL", "events": ["payment"]},
+		{"name": "ops-discord", "type": "discord", "url_env": "TEST_DISCORD_URL", "templates": {"monitor": "peg {{.Data.asset}} via {{.Channel}}"}},
+		{"name": "ops-telegram", "type": "telegram", "token_env": "TEST_TELEGRAM_TOKEN", "chat_id": "-100", "events": ["slo"]},
+		{"name": "ops-email", "type": "email", "smtp_addr": "mail.example:587", "from": "x402@example.com", "to": ["ops@example.com"], "events": ["payment"]}
+	]`)
+	n := NewNotifier()
+
+	n.Notify(NotifyPayment, map[string]string{"id": "pay_1", "endpoint": "/api/gas", "payer": "0xabc", "amount": "0.001", "asset": "USDC"})
+	if body := receive(t, got); body["path"] != "/slack" || body["text"] != "💳 Payment of 0.001 USDC for /api/gas from 0xabc (id pay_1)" {
+		t.Errorf("slack = %v", body)
+	}
+	select {
+	case msg := <-mail:
+		if !strings.HasPrefix(msg, "mail.example:587 ops@example.com\n") || !strings.Contains(msg, "Subject: [x402] payment notification") {
+			t.Errorf("email = %q", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no email sent")
+	}
+
+	// Channels without events get monitor and SLO alerts, in their own template
+	n.Notify(NotifyMonitor, map[string]string{"asset": "USDC", "message": "USDC is off its peg"})
+	if body := receive(t, got); body["path"] != "/discord" || body["content"] != "peg USDC via ops-discord" {
+		t.Errorf("discord = %v", body)
+	}
+	n.Notify(NotifySLO, map[string]string{"message": "SLO breach on /api/gas"})
+	for range 2 {
+		switch body := receive(t, got); body["path"] {
+		case "/bot123:abc/sendMessage":
+			if body["chat_id"] != "-100" || body["text"] != "⚠️ SLO breach on /api/gas" {
+				t.Errorf("telegram = %v", body)
+			}
+		case "/discord":
+		default:
+			t.Errorf("unexpected delivery %v", body)
+		}
+	}
+}
+
+func TestNotifierRateLimit(t *testing.T) {
+	srv, got := notifyTarget(t)
+	t.Setenv("TEST_SLACK_URL", srv.URL)
+	useNotifiers(t, `[{"name": "ops", "type": "slack", "url_env": "TEST_SLACK_URL", "rate_per_minute": 1}]`)
+	n := NewNotifier()
+
+	n.Notify(NotifyMonitor, map[string]string{"message": "first"})
+	n.Notify(NotifyMonitor, map[string]string{"message": "second"})
+	if body := receive(t, got); body["text"] != "🚨 first" {
+		t.Errorf("delivered %v", body)
+	}
+
+	// Test sends skip the rate limit
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		n.handleAdminNotifications(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+	if rr := admin("POST", "/admin/notifications/ops/test"); rr.Code != http.StatusOK {
+		t.Fatalf("test send returned %d: %s", rr.Code, rr.Body)
+	}
+	if body := receive(t, got); body["text"] != "✅ Test notification for channel ops" {
+		t.Errorf("test message = %v", body)
+	}
+	if rr := admin("POST", "/admin/notifications/missing/test"); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown channel returned %d", rr.Code)
+	}
+
+	// The background delivery is counted once its post returns
+	var channels []NotifierStatus
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		json.NewDecoder(admin("GET", "/admin/notifications").Body).Decode(&channels)
+		if len(channels) != 1 || channels[0].Counts["sent"] == 2 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if len(channels) != 1 || channels[0].Counts["sent"] != 2 || channels[0].Counts["dropped"] != 1 || strings.Join(channels[0].Events, ",") != "monitor,slo" {
+		t.Errorf("channels = %+v", channels)
+	}
+}
+
+func TestNotifierConfigValidation(t *testing.T) {
+	for _, bad := range []string{
+		`[{"name": "x", "type": "pager"}]`,
+		`[{"name": "x", "type": "slack"}]`,
+		`[{"name": "x", "type": "telegram", "token_env": "T"}]`,
+		`[{"name": "x", "type": "email", "smtp_addr": "mail.example", "from": "a@example.com", "to": ["b@example.com"]}]`,
+		`[{"name": "x", "type": "slack", "url_env": "U", "events": ["test"]}]`,
+		`[{"name": "x", "type": "slack", "url_env": "U", "templates": {"payment": "{{.Data"}}]`,
+		`[{"name": "x", "type": "slack", "url_env": "U"}, {"name": "x", "type": "discord", "url_env": "U"}]`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(`{"notifiers": ` + bad + `}`)); err == nil {
+			t.Errorf("accepted %s", bad)
+		}
+	}
+}
+
+func TestSLOWatch(t *testing.T) {
+	srv, got := notifyTarget(t)
+	t.Setenv("TEST_SLACK_URL", srv.URL)
+	useNotifiers(t, `[{"name": "ops", "type": "slack", "url_env": "TEST_SLACK_URL"}]`)
+	metrics := NewMetrics()
+	watch := NewSLOWatch(metrics, NewNotifier(), 0.05, 20, 5*time.Minute)
+
+	record := func(ok, failed int) {
+		for range ok {
+			metrics.RecordRequest("/api/gas", "200")
+		}
+		for range failed {
+			metrics.RecordRequest("/api/gas", "503")
+		}
+	}
+
+	// Too little traffic to judge
+	record(1, 5)
+	watch.Check()
+
+	record(18, 2)
+	watch.Check()
+	if body := receive(t, got); body["text"] != "⚠️ SLO breach on /api/gas: 10.0% of 20 requests failed in the last 5m0s (target 5.0%)" {
+		t.Errorf("breach = %v", body)
+	}
+
+	// A continuing breach is not repeated, and recovery is reported once
+	record(17, 3)
+	watch.Check()
+	record(40, 0)
+	watch.Check()
+	if body := receive(t, got); !strings.Contains(body["text"], "/api/gas is back within its SLO") {
+		t.Errorf("recovery = %v", body)
+	}
+	select {
+	case body := <-got:
+		t.Errorf("extra notification %v", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -17,6 +17,7 @@ type OASFManifest struct {
 	Domains         []OASFDomain    `json:"domains"`
 	Integrations    []OASFIntegration `json:"integrations"`
 	Endpoints       OASFEndpoints   `json:"endpoints"`
+	Build           BuildInfo       `json:"build"`
 }
 
 // OASFAgent represents basic agent info
@@ -38,6 +39,7 @@ type OASFCapabilities struct {
 	Autonomous       bool     `json:"autonomous"`
 	PaymentEnabled   bool     `json:"payment_enabled"`
 	TEESupported     bool     `json:"tee_supported"`
+	TEEPlatform      string   `json:"tee_platform,omitempty"`
 }
 
 // OASFSkill represents a skill with detailed metadata
@@ -100,6 +102,7 @@ type OASFEndpoints struct {
 	OASF      string `json:"oasf,omitempty"`
 	X402      string `json:"x402,omitempty"`
 	Health    string `json:"health,omitempty"`
+	Attestation string `json:"attestation,omitempty"`
 	Website   string `json:"website,omitempty"`
 }
 
@@ -127,245 +130,9 @@ func handleOASFManifest(w http.ResponseWriter, r *http.Request) {
 			MultiModal:     false,
 			Autonomous:     true,
 			PaymentEnabled: true,
-			TEESupported:   false,
-		},
-		Skills: []OASFSkill{
-			{
-				ID:          "gas_monitoring",
-				Name:        "Ethereum Gas Monitoring",
-				Description: "Real-time gas price monitoring with trend analysis",
-				Version:     "1.0.0",
-				Category:    "infrastructure",
-				InputSchema: map[string]interface{}{
-					"type":       "object",
-					"properties": map[string]interface{}{},
-					"required":   []string{},
-				},
-				OutputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"timestamp": map[string]interface{}{"type": "integer"},
-						"gas": map[string]interface{}{
-							"type": "object",
-							"properties": map[string]interface{}{
-								"safe":    map[string]interface{}{"type": "number"},
-								"average": map[string]interface{}{"type": "number"},
-								"fast":    map[string]interface{}{"type": "number"},
-							},
-						},
-						"unit":   map[string]interface{}{"type": "string"},
-						"source": map[string]interface{}{"type": "string"},
-					},
-				},
-				Examples: []OASFExample{
-					{
-						Name:        "Current Gas",
-						Description: "Get current gas prices",
-						Input:       `{}`,
-						Output:      `{"timestamp": 1707868800, "gas": {"safe": 0.25, "average": 0.35, "fast": 0.50}, "unit": "gwei", "source": "ethereum_mainnet"}`,
-					},
-				},
-				Pricing: &OASFPricing{
-					Model:    "per_call",
-					Price:    0.001,
-					Currency: "USDC",
-					Unit:     "per request",
-				},
-			},
-			{
-				ID:          "validator_queue",
-				Name:        "Validator Queue Tracking",
-				Description: "Track Ethereum validator queue status and wait times",
-				Version:     "1.0.0",
-				Category:    "infrastructure",
-				InputSchema: map[string]interface{}{
-					"type":       "object",
-					"properties": map[string]interface{}{},
-					"required":   []string{},
-				},
-				OutputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"timestamp": map[string]interface{}{"type": "integer"},
-						"queue": map[string]interface{}{
-							"type": "object",
-							"properties": map[string]interface{}{
-								"entry_wait_time_days": map[string]interface{}{"type": "number"},
-								"exit_wait_time_days":  map[string]interface{}{"type": "number"},
-							},
-						},
-					},
-				},
-				Pricing: &OASFPricing{
-					Model:    "per_call",
-					Price:    0.005,
-					Currency: "USDC",
-					Unit:     "per request",
-				},
-			},
-			{
-				ID:          "token_security_scan",
-				Name:        "Token Security Scanner",
-				Description: "Comprehensive ERC-20 token security analysis",
-				Version:     "1.0.0",
-				Category:    "security",
-				InputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"tokenAddress": map[string]interface{}{
-							"type":        "string",
-							"description": "Token contract address",
-						},
-						"chain": map[string]interface{}{
-							"type":        "string",
-							"description": "Chain ID (1, 8453)",
-						},
-					},
-					"required": []string{"tokenAddress"},
-				},
-				OutputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"risk_score": map[string]interface{}{"type": "integer"},
-						"flags":      map[string]interface{}{"type": "array"},
-						"verified":   map[string]interface{}{"type": "boolean"},
-					},
-				},
-				Pricing: &OASFPricing{
-					Model:    "per_call",
-					Price:    0.008,
-					Currency: "USDC",
-					Unit:     "per request",
-				},
-			},
-			{
-				ID:          "wallet_risk_analysis",
-				Name:        "Wallet Risk Analysis",
-				Description: "Analyze wallet addresses for risk profiles",
-				Version:     "1.0.0",
-				Category:    "security",
-				InputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"walletAddress": map[string]interface{}{
-							"type":        "string",
-							"description": "Wallet address",
-						},
-						"chain": map[string]interface{}{
-							"type":        "string",
-							"description": "Chain ID",
-						},
-					},
-					"required": []string{"walletAddress"},
-				},
-				OutputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"risk_score": map[string]interface{}{"type": "integer"},
-						"flags":      map[string]interface{}{"type": "array"},
-						"holdings":   map[string]interface{}{"type": "object"},
-					},
-				},
-				Pricing: &OASFPricing{
-					Model:    "per_call",
-					Price:    0.01,
-					Currency: "USDC",
-					Unit:     "per request",
-				},
-			},
-			{
-				ID:          "address_labels",
-				Name:        "Address Intelligence",
-				Description: "Get labels and entity info for addresses",
-				Version:     "1.0.0",
-				Category:    "intelligence",
-				InputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"address": map[string]interface{}{
-							"type":        "string",
-							"description": "Address to lookup",
-						},
-					},
-					"required": []string{"address"},
-				},
-				OutputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"address": map[string]interface{}{"type": "string"},
-						"labels":  map[string]interface{}{"type": "array"},
-						"entity":  map[string]interface{}{"type": "string"},
-					},
-				},
-				Pricing: &OASFPricing{
-					Model:    "per_call",
-					Price:    0.003,
-					Currency: "USDC",
-					Unit:     "per request",
-				},
-			},
-			{
-				ID:          "mev_protection",
-				Name:        "MEV Protection Check",
-				Description: "Check transactions for MEV attack risks",
-				Version:     "1.0.0",
-				Category:    "security",
-				InputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"txData": map[string]interface{}{"type": "string"},
-						"to":     map[string]interface{}{"type": "string"},
-						"value":  map[string]interface{}{"type": "string"},
-					},
-					"required": []string{"txData", "to"},
-				},
-				OutputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"risk_level":    map[string]interface{}{"type": "string"},
-						"attack_types":  map[string]interface{}{"type": "array"},
-						"protected":     map[string]interface{}{"type": "boolean"},
-					},
-				},
-				Pricing: &OASFPricing{
-					Model:    "per_call",
-					Price:    0.005,
-					Currency: "USDC",
-					Unit:     "per request",
-				},
-			},
-			{
-				ID:          "tx_preflight",
-				Name:        "Transaction Pre-flight",
-				Description: "Comprehensive pre-flight transaction checks",
-				Version:     "1.0.0",
-				Category:    "security",
-				InputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"txData": map[string]interface{}{"type": "string"},
-						"to":     map[string]interface{}{"type": "string"},
-						"value":  map[string]interface{}{"type": "string"},
-						"from":   map[string]interface{}{"type": "string"},
-					},
-					"required": []string{"txData", "to", "from"},
-				},
-				OutputSchema: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"safe":          map[string]interface{}{"type": "boolean"},
-						"warnings":      map[string]interface{}{"type": "array"},
-						"risk_score":    map[string]interface{}{"type": "integer"},
-					},
-				},
-				Pricing: &OASFPricing{
-					Model:    "per_call",
-					Price:    0.003,
-					Currency: "USDC",
-					Unit:     "per request",
-				},
-			},
+			TEESupported:   attester != nil,
 		},
+		Skills: oasfSkills(),
 		Domains: []OASFDomain{
 			{
 				ID:          "ethereum_security",
@@ -459,8 +226,245 @@ func handleOASFManifest(w http.ResponseWriter, r *http.Request) {
 			Health:  "https://api-x402.arithmos.dev/health",
 			Website: "https://arithmos.dev",
 		},
+		Build: buildInfo,
 	}
+	if attester != nil {
+		manifest.Capabilities.TEEPlatform = attester.Platform()
+		manifest.Endpoints.Attestation = "https://api-x402.arithmos.dev/.well-known/attestation"
+	}
+	localizeOASF(&manifest, localizer(w, r))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(manifest)
 }
+
+// oasfSkills returns the skill registry the manifest advertises. It is built
+// fresh on each call as the manifest localizes it in place.
+func oasfSkills() []OASFSkill {
+	return []OASFSkill{
+		{
+			ID:          "gas_monitoring",
+			Name:        "Ethereum Gas Monitoring",
+			Description: "Real-time gas price monitoring with trend analysis",
+			Version:     "1.1.1",
+			Category:    "infrastructure",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"unit": map[string]interface{}{
+						"type":        "string",
+						"description": "Gas unit (gwei, wei, eth)",
+					},
+					"chain": map[string]interface{}{
+						"type":        "string",
+						"description": "Chain (ethereum, base, base-sepolia); OP-stack chains add L1 data fees",
+					},
+				},
+				"required": []string{},
+			},
+			OutputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"timestamp": map[string]interface{}{"type": "integer"},
+					"gas": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"current": map[string]interface{}{"type": "number"},
+							"safe":    map[string]interface{}{"type": "number"},
+							"fast":    map[string]interface{}{"type": "number"},
+						},
+						"required": []string{"current", "safe", "fast"},
+					},
+					"unit":   map[string]interface{}{"type": "string"},
+					"source": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"timestamp", "gas", "unit", "source"},
+			},
+			Examples: []OASFExample{
+				{
+					Name:        "Current Gas",
+					Description: "Get current gas prices",
+					Input:       `{}`,
+					Output:      `{"timestamp": 1707868800, "gas": {"current": 0.35, "safe": 0.25, "fast": 0.50}, "unit": "gwei", "source": "ethereum_mainnet"}`,
+				},
+			},
+			Pricing: skillPricing("/api/gas"),
+		},
+		{
+			ID:          "validator_queue",
+			Name:        "Validator Queue Tracking",
+			Description: "Track Ethereum validator queue status and wait times",
+			Version:     "1.0.1",
+			Category:    "infrastructure",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+				"required":   []string{},
+			},
+			OutputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"timestamp": map[string]interface{}{"type": "integer"},
+					"queue": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"entry_wait_hours": map[string]interface{}{"type": "number"},
+							"exit_wait_hours":  map[string]interface{}{"type": "number"},
+						},
+						"required": []string{"entry_wait_hours", "exit_wait_hours"},
+					},
+				},
+				"required": []string{"timestamp", "queue"},
+			},
+			Pricing: skillPricing("/api/validators"),
+		},
+		{
+			ID:          "token_security_scan",
+			Name:        "Token Security Scanner",
+			Description: "Comprehensive ERC-20 token security analysis",
+			Version:     "1.0.1",
+			Category:    "security",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tokenAddress": map[string]interface{}{
+						"type":        "string",
+						"description": "Token contract address",
+					},
+					"chain": map[string]interface{}{
+						"type":        "string",
+						"description": "Chain ID (1, 8453)",
+					},
+				},
+				"required": []string{"tokenAddress"},
+			},
+			OutputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"risk_score":  map[string]interface{}{"type": "integer"},
+					"flags":       map[string]interface{}{"type": "array"},
+					"is_verified": map[string]interface{}{"type": "boolean"},
+				},
+				"required": []string{"risk_score", "flags", "is_verified"},
+			},
+			Pricing: skillPricing("/api/scan-token"),
+		},
+		{
+			ID:          "wallet_risk_analysis",
+			Name:        "Wallet Risk Analysis",
+			Description: "Analyze wallet addresses for risk profiles",
+			Version:     "1.0.1",
+			Category:    "security",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"walletAddress": map[string]interface{}{
+						"type":        "string",
+						"description": "Wallet address",
+					},
+					"chain": map[string]interface{}{
+						"type":        "string",
+						"description": "Chain ID",
+					},
+				},
+				"required": []string{"walletAddress"},
+			},
+			OutputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"risk_score":        map[string]interface{}{"type": "integer"},
+					"suspicious_tokens": map[string]interface{}{"type": "integer"},
+					"holdings":          map[string]interface{}{"type": "array"},
+				},
+				"required": []string{"risk_score", "suspicious_tokens", "holdings"},
+			},
+			Pricing: skillPricing("/api/scan-wallet"),
+		},
+		{
+			ID:          "address_labels",
+			Name:        "Address Intelligence",
+			Description: "Get labels and entity info for addresses",
+			Version:     "1.0.1",
+			Category:    "intelligence",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"address": map[string]interface{}{
+						"type":        "string",
+						"description": "Address to lookup",
+					},
+				},
+				"required": []string{"address"},
+			},
+			OutputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"address": map[string]interface{}{"type": "string"},
+					"labels":  map[string]interface{}{"type": "array"},
+					"entity":  map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"address", "labels"},
+			},
+			Pricing: skillPricing("/api/address-label"),
+		},
+		{
+			ID:          "mev_protection",
+			Name:        "MEV Protection Check",
+			Description: "Check transactions for MEV attack risks",
+			Version:     "1.0.1",
+			Category:    "security",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"txData": map[string]interface{}{"type": "string"},
+					"to":     map[string]interface{}{"type": "string"},
+					"value":  map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"txData", "to"},
+			},
+			OutputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"safe":           map[string]interface{}{"type": "boolean"},
+					"mev_risk_score": map[string]interface{}{"type": "integer"},
+					"risk_factors":   map[string]interface{}{"type": "array"},
+					"sandwich_risk":  map[string]interface{}{"type": "string"},
+					"frontrun_risk":  map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"safe", "mev_risk_score", "risk_factors", "sandwich_risk", "frontrun_risk"},
+			},
+			Pricing: skillPricing("/api/mev-check"),
+		},
+		{
+			ID:          "tx_preflight",
+			Name:        "Transaction Pre-flight",
+			Description: "Comprehensive pre-flight transaction checks",
+			Version:     "1.1.1",
+			Category:    "security",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"txData": map[string]interface{}{"type": "string"},
+					"to":     map[string]interface{}{"type": "string"},
+					"value":  map[string]interface{}{"type": "string"},
+					"from":   map[string]interface{}{"type": "string"},
+					"user_operation": map[string]interface{}{
+						"type":        "object",
+						"description": "ERC-4337 v0.7 user operation, checked instead of a transaction",
+					},
+				},
+				"required": []string{"txData", "to", "from"},
+			},
+			OutputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"safe":       map[string]interface{}{"type": "boolean"},
+					"warnings":   map[string]interface{}{"type": "array"},
+					"risk_score": map[string]interface{}{"type": "integer"},
+				},
+				"required": []string{"safe", "warnings", "risk_score"},
+			},
+			Pricing: skillPricing("/api/tx-preflight"),
+		},
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// gasPriceOracle is the OP-stack predeploy that prices the L1 data fee
+const gasPriceOracle = "0x420000000000000000000000000000000000000F"
+
+// Selectors of the gas price oracle calls
+const (
+	selectorGetL1Fee    = "49948e0e" // getL1Fee(bytes)
+	selectorL1BaseFee   = "519b4bd3" // l1BaseFee()
+	selectorBlobBaseFee = "f8206140" // blobBaseFee()
+)
+
+// referenceRecipient receives the reference transactions priced by
+// /api/gas. A real address compresses no better than any other, so the
+// L1 data fee is not underestimated.
+const referenceRecipient = "0x4838B106FCe9647Bdf1E7877BF73cE8B0BAD5f97"
+
+// Reference transactions priced for each OP-stack chain
+const (
+	costETHTransfer   = "eth_transfer"
+	costERC20Transfer = "erc20_transfer"
+)
+
+// referenceTx is a typical transaction priced by /api/gas
+type referenceTx struct {
+	to    string
+	value *big.Int
+	data  string
+	gas   uint64
+}
+
+// referenceTxs returns the transactions priced for chain, by kind
+func referenceTxs(chain string) map[string]referenceTx {
+	refs := map[string]referenceTx{
+		costETHTransfer: {referenceRecipient, units.Ether, "0x", 21000},
+	}
+	if usdc, ok := paymentNetworks[chain].Assets["USDC"]; ok {
+		refs[costERC20Transfer] = referenceTx{usdc, new(big.Int), encodeTransfer(referenceRecipient, big.NewInt(1_000_000)), erc20TransferGas}
+	}
+	return refs
+}
+
+// OPStackFees reports gas prices for OP-stack chains such as Base. Their
+// transactions pay the L2 execution fee plus an L1 data fee for posting
+// the transaction to Ethereum, which the gas price alone does not show.
+type OPStackFees struct {
+	rpcs map[string]*RPCClient // chain -> node
+
+	mu       sync.Mutex
+	lastGood map[string]*lastGood[GasData] // chain -> last fetched prices
+}
+
+// NewOPStackFees returns fees for the OP-stack chains among rpcURLs
+func NewOPStackFees(rpcURLs map[string]string) *OPStackFees {
+	f := &OPStackFees{rpcs: make(map[string]*RPCClient), lastGood: make(map[string]*lastGood[GasData])}
+	for chain, url := range rpcURLs {
+		if paymentNetworks[chain].OPStack {
+			f.rpcs[chain] = &RPCClient{url: url}
+		}
+	}
+	return f
+}
+
+// Chains returns the chains fees are reported for, sorted
+func (f *OPStackFees) Chains() []string {
+	chains := make([]string, 0, len(f.rpcs))
+	for chain := range f.rpcs {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+	return chains
+}
+
+// GasPrices returns chain's gas prices in gwei, its L1 fee parameters and
+// what the reference transactions cost to send. L2 gas prices are a
+// fraction of a gwei, so they are kept to six decimals.
+func (f *OPStackFees) GasPrices(chain string) (*GasData, error) {
+	rpc, ok := f.rpcs[chain]
+	if !ok {
+		return nil, fmt.Errorf("no OP-stack node for %s", chain)
+	}
+	fees, err := estimateFees(rpc)
+	if err != nil {
+		return nil, err
+	}
+	l1BaseFee, err := oracleCall(rpc, selectorL1BaseFee)
+	if err != nil {
+		return nil, fmt.Errorf("l1BaseFee: %w", err)
+	}
+	// Chains before Ecotone have no blob base fee; it is left out
+	blobBaseFee, err := oracleCall(rpc, selectorBlobBaseFee)
+	if err != nil {
+		blobBaseFee = new(big.Int)
+	}
+
+	base, _ := new(big.Int).SetString(fees.BaseFeePerGas, 10)
+	tip, _ := new(big.Int).SetString(fees.MaxPriorityFeePerGas, 10)
+	current := units.ToGwei(new(big.Int).Add(base, tip))
+	gas := &GasData{
+		Timestamp: time.Now().Unix(),
+		Gas: map[string]float64{
+			"current": round(current, 6),
+			"safe":    round(current*0.9, 6),
+			"fast":    round(current*1.2, 6),
+		},
+		Unit:            "gwei",
+		Source:          chain,
+		Chain:           chain,
+		L1BaseFeeGwei:   round(units.ToGwei(l1BaseFee), 9),
+		BlobBaseFeeGwei: round(units.ToGwei(blobBaseFee), 9),
+		Costs:           make(map[string]*TxCost),
+		DataQuality:     types.DataQuality{Quality: types.QualityLive},
+	}
+
+	for kind, ref := range referenceTxs(chain) {
+		cost, err := txCost(rpc, chain, ref.to, ref.value, ref.data, ref.gas, fees)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kind, err)
+		}
+		gas.Costs[kind] = cost
+	}
+	return gas, nil
+}
+
+// serveGas answers /api/gas for opts.Chain. When the node is down the last
+// prices are served while fresh enough; there is no estimate to fall back
+// to, as the service's fixed estimates are Ethereum's.
+func (f *OPStackFees) serveGas(w http.ResponseWriter, r *http.Request, opts DataOptions, maxStaleness time.Duration) string {
+	chain := opts.Chain
+	f.mu.Lock()
+	cache, ok := f.lastGood[chain]
+	if !ok {
+		cache = &lastGood[GasData]{}
+		f.lastGood[chain] = cache
+	}
+	f.mu.Unlock()
+
+	gas, err := f.GasPrices(chain)
+	if err == nil {
+		cache.Store(*gas)
+	} else {
+		log.Printf("Error fetching %s gas: %v", chain, err)
+		cached, age, ok := cache.Load(maxStaleness)
+		if !ok {
+			chargeFromContext(r.Context()).refuse()
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, fmt.Sprintf(`{"error":"%s gas prices unavailable, payment not captured"}`, chain), http.StatusServiceUnavailable)
+			return "503"
+		}
+		gas = &cached
+		gas.DataQuality = types.DataQuality{Quality: types.QualityStale, StalenessSeconds: int64(age.Seconds())}
+		w.Header().Set("X-Data-Quality", types.QualityStale)
+	}
+	writePaidData(w, r, opts.applyGas(gas))
+	return "200"
+}
+
+// txCost prices a transaction of gas at fees on chain. On OP-stack chains
+// the gas price oracle adds the L1 data fee of the transaction, priced
+// unsigned: getL1Fee accounts for the signature itself.
+func txCost(rpc *RPCClient, chain, to string, value *big.Int, data string, gas uint64, fees *FeeRecommendation) (*TxCost, error) {
+	base, ok := new(big.Int).SetString(fees.BaseFeePerGas, 10)
+	if !ok {
+		return nil, fmt.Errorf("no base fee")
+	}
+	tip, ok := new(big.Int).SetString(fees.MaxPriorityFeePerGas, 10)
+	if !ok {
+		return nil, fmt.Errorf("no priority fee")
+	}
+	gasLimit := new(big.Int).SetUint64(gas)
+	execution := new(big.Int).Mul(gasLimit, new(big.Int).Add(base, tip))
+	cost := &TxCost{Gas: gas, ExecutionFee: execution.String()}
+	total := new(big.Int).Set(execution)
+
+	network := paymentNetworks[chain]
+	if network.OPStack {
+		maxFee, _ := new(big.Int).SetString(fees.MaxFeePerGas, 10)
+		tx, err := unsignedTx(network.ChainID, tip, maxFee, gasLimit, to, value, data)
+		if err != nil {
+			return nil, err
+		}
+		l1Fee, err := l1DataFee(rpc, tx)
+		if err != nil {
+			return nil, fmt.Errorf("getL1Fee: %w", err)
+		}
+		cost.L1DataFee = l1Fee.String()
+		total.Add(total, l1Fee)
+	}
+	cost.TotalFee = total.String()
+	cost.TotalFeeETH = units.ToEther(total)
+	return cost, nil
+}
+
+// l1DataFee asks the gas price oracle what posting tx to Ethereum costs
+func l1DataFee(rpc *RPCClient, tx []byte) (*big.Int, error) {
+	padded := make([]byte, (len(tx)+31)/32*32)
+	copy(padded, tx)
+	args := fmt.Sprintf("%064x%064x%s", 32, len(tx), hex.EncodeToString(padded))
+	return oracleCall(rpc, selectorGetL1Fee+args)
+}
+
+// oracleCall calls the gas price oracle with calldata and decodes the
+// uint256 it returns
+func oracleCall(rpc *RPCClient, calldata string) (*big.Int, error) {
+	var result string
+	call := map[string]string{"to": gasPriceOracle, "data": "0x" + calldata}
+	if err := jsonRPC(rpc.url, "eth_call", []interface{}{call, "latest"}, &result); err != nil {
+		return nil, err
+	}
+	word := strings.TrimPrefix(result, "0x")
+	if len(word) < 64 {
+		return nil, fmt.Errorf("no fee in %q", result)
+	}
+	return units.ParseHex("0x" + word[:64])
+}
+
+// unsignedTx encodes an EIP-1559 transaction without its signature, as
+// 0x02 || rlp([chainId, nonce, tip, maxFee, gas, to, value, data, []])
+func unsignedTx(chainID int64, tip, maxFee, gas *big.Int, to string, value *big.Int, data string) ([]byte, error) {
+	toBytes, err := hex.DecodeString(strings.TrimPrefix(to, "0x"))
+	if err != nil || len(toBytes) != 20 {
+		return nil, fmt.Errorf("invalid to address %q", to)
+	}
+	dataBytes, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %w", err)
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	payload := rlpList(
+		rlpUint(big.NewInt(chainID)),
+		rlpUint(new(big.Int)), // the nonce barely changes the size
+		rlpUint(tip),
+		rlpUint(maxFee),
+		rlpUint(gas),
+		rlpBytes(toBytes),
+		rlpUint(value),
+		rlpBytes(dataBytes),
+		rlpList(), // access list
+	)
+	return append([]byte{0x02}, payload...), nil
+}
+
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return b
+	}
+	return append(rlpHeader(0x80, len(b)), b...)
+}
+
+func rlpUint(v *big.Int) []byte {
+	return rlpBytes(v.Bytes())
+}
+
+func rlpList(items ...[]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+	return append(rlpHeader(0xc0, len(payload)), payload...)
+}
+
+func rlpHeader(offset byte, n int) []byte {
+	if n < 56 {
+		return []byte{offset + byte(n)}
+	}
+	size := big.NewInt(int64(n)).Bytes()
+	return append([]byte{offset + 55 + byte(len(size))}, size...)
+}
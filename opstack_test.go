@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRLP(t *testing.T) {
+	for _, tc := range []struct {
+		got  []byte
+		want string
+	}{
+		{rlpBytes([]byte("dog")), "83646f67"},
+		{rlpBytes([]byte{0x7f}), "7f"},
+		{rlpUint(new(big.Int)), "80"},
+		{rlpUint(big.NewInt(1024)), "820400"},
+		{rlpList(rlpBytes([]byte("cat")), rlpBytes([]byte("dog"))), "c88363617483646f67"},
+		{rlpList(), "c0"},
+		{rlpBytes([]byte(strings.Repeat("a", 56))), "b838" + strings.Repeat("61", 56)},
+	} {
+		if got := hex.EncodeToString(tc.got); got != tc.want {
+			t.Errorf("rlp = %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestOPStackFees(t *testing.T) {
+	// A Base node at a 0.01 gwei base fee and 0.001 gwei tips, whose oracle
+	// charges 1000 wei per byte of transaction
+	down := false
+	rpc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": 1}
+		switch {
+		case down:
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		case req.Method == "eth_feeHistory":
+			reply["result"] = map[string]interface{}{
+				"baseFeePerGas": []string{"0x989680", "0x989680", "0x989680"},
+				"reward":        [][]string{{"0xf4240"}, {"0xf4240"}},
+			}
+		case req.Method == "eth_getCode":
+			reply["result"] = "0x"
+		case req.Method == "eth_estimateGas":
+			reply["result"] = "0x5208"
+		case req.Method == "eth_call":
+			var call struct{ To, Data string }
+			json.Unmarshal(req.Params[0], &call)
+			data := strings.TrimPrefix(call.Data, "0x")
+			switch {
+			case !strings.EqualFold(call.To, gasPriceOracle):
+				reply["error"] = map[string]interface{}{"code": 3, "message": "execution reverted"}
+			case data == selectorL1BaseFee:
+				reply["result"] = fmt.Sprintf("0x%064x", 2_000_000_000)
+			case data == selectorBlobBaseFee:
+				reply["result"] = fmt.Sprintf("0x%064x", 1)
+			case strings.HasPrefix(data, selectorGetL1Fee):
+				n, _ := strconv.ParseInt(data[8+64:8+128], 16, 64)
+				tx, _ := hex.DecodeString(data[8+128 : 8+128+2*n])
+				if tx[0] != 0x02 {
+					reply["error"] = map[string]interface{}{"code": 3, "message": "not an EIP-1559 transaction"}
+					break
+				}
+				reply["result"] = fmt.Sprintf("0x%064x", 1000*n)
+			}
+		}
+		json.NewEncoder(w).Encode(reply)
+	}))
+	defer rpc.Close()
+	fees := NewOPStackFees(map[string]string{"base": rpc.URL, "ethereum": rpc.URL})
+	if got := strings.Join(fees.Chains(), ","); got != "base" {
+		t.Fatalf("chains = %s, want base only", got)
+	}
+
+	gas, err := fees.GasPrices("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gas.Chain != "base" || gas.Gas["current"] != 0.011 || gas.L1BaseFeeGwei != 2 || gas.BlobBaseFeeGwei != 1e-9 {
+		t.Errorf("gas = %+v", gas)
+	}
+	for kind, gasUsed := range map[string]uint64{costETHTransfer: 21000, costERC20Transfer: erc20TransferGas} {
+		cost := gas.Costs[kind]
+		if cost == nil {
+			t.Fatalf("no %s cost", kind)
+		}
+		execution := new(big.Int).SetUint64(gasUsed * 11_000_000)
+		l1, _ := new(big.Int).SetString(cost.L1DataFee, 10)
+		total, _ := new(big.Int).SetString(cost.TotalFee, 10)
+		if cost.Gas != gasUsed || cost.ExecutionFee != execution.String() || l1 == nil || l1.Sign() <= 0 || total.Cmp(new(big.Int).Add(execution, l1)) != 0 {
+			t.Errorf("%s cost = %+v", kind, cost)
+		}
+	}
+	// A token transfer's calldata costs more to post than a plain transfer
+	eth, _ := strconv.Atoi(gas.Costs[costETHTransfer].L1DataFee)
+	erc20, _ := strconv.Atoi(gas.Costs[costERC20Transfer].L1DataFee)
+	if erc20 <= eth {
+		t.Errorf("l1 data fees: eth %d, erc20 %d", eth, erc20)
+	}
+
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		fees.serveGas(rr, httptest.NewRequest("GET", "/api/gas?chain=base", nil), DataOptions{Unit: "gwei", Chain: "base"}, time.Minute)
+		return rr
+	}
+	if rr := serve(); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"l1_data_fee"`) {
+		t.Errorf("served %d: %s", rr.Code, rr.Body)
+	}
+	// A node outage serves the last prices, and with none cached refuses
+	down = true
+	if rr := serve(); rr.Code != http.StatusOK || rr.Header().Get("X-Data-Quality") != "stale" {
+		t.Errorf("outage served %d, quality %q", rr.Code, rr.Header().Get("X-Data-Quality"))
+	}
+	fees.lastGood["base"] = &lastGood[GasData]{}
+	if rr := serve(); rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "payment not captured") {
+		t.Errorf("outage without prices served %d: %s", rr.Code, rr.Body)
+	}
+	down = false
+
+	// A preflight for Base is simulated there and priced with its L1 fee
+	simulator := NewTxSimulator("http://127.0.0.1:1")
+	simulator.SetChainRPCs(map[string]string{"base": rpc.URL})
+	result, err := simulator.Simulate(&TxPreflightRequest{Chain: "base", To: "0x00000000000000000000000000000000000000a1", Value: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Cost == nil || result.Cost.Gas != 25200 || result.Cost.L1DataFee == "" || result.Fees.BaseFeePerGas != "10000000" {
+		t.Errorf("preflight cost = %+v, fees %+v", result.Cost, result.Fees)
+	}
+
+	if _, err := parseDataOptions(map[string][]string{"chain": {"solana"}}); err == nil {
+		t.Error("unknown gas chain accepted")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// gasUnits maps the ?unit values accepted by gas endpoints to the factor
+// that converts gwei into that unit
+var gasUnits = map[string]float64{
+	"wei":  1e9,
+	"gwei": 1,
+	"eth":  1e-9,
+}
+
+// priceCurrencies are the ?currency values accepted by price endpoints
+var priceCurrencies = map[string]bool{
+	"usd": true, "eur": true, "gbp": true, "jpy": true, "chf": true,
+	"cad": true, "aud": true, "cny": true, "krw": true, "inr": true,
+}
+
+// DataOptions are the presentation options shared by the data endpoints
+type DataOptions struct {
+	Unit     string // gas unit, default gwei
+	Currency string // price currency, default usd
+	Chain    string // gas chain, default ethereum
+}
+
+// gasChains are the ?chain values accepted by gas endpoints: Ethereum and
+// the OP-stack chains, whose L1 data fees are reported
+func gasChains() map[string]bool {
+	chains := map[string]bool{"ethereum": true}
+	for name, network := range paymentNetworks {
+		if network.OPStack {
+			chains[name] = true
+		}
+	}
+	return chains
+}
+
+// parseDataOptions validates ?unit, ?currency and ?chain. Values are
+// case-insensitive.
+func parseDataOptions(q url.Values) (DataOptions, error) {
+	opts := DataOptions{Unit: "gwei", Currency: "usd", Chain: "ethereum"}
+
+	if v := strings.ToLower(q.Get("unit")); v != "" {
+		if _, ok := gasUnits[v]; !ok {
+			return opts, fmt.Errorf("invalid unit - use %s", optionList(gasUnits))
+		}
+		opts.Unit = v
+	}
+	if v := strings.ToLower(q.Get("currency")); v != "" {
+		if !priceCurrencies[v] {
+			return opts, fmt.Errorf("invalid currency - use %s", optionList(priceCurrencies))
+		}
+		opts.Currency = v
+	}
+	if v := strings.ToLower(q.Get("chain")); v != "" {
+		if chains := gasChains(); !chains[v] {
+			return opts, fmt.Errorf("invalid chain - use %s", optionList(chains))
+		}
+		opts.Chain = v
+	}
+	return opts, nil
+}
+
+func optionList[V any](m map[string]V) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// withDataOptions rejects invalid ?unit, ?currency and ?chain values before the
+// paywall, so a client is never charged for a request that cannot succeed
+func withDataOptions(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := parseDataOptions(r.URL.Query()); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// applyGas returns gas converted to the requested unit. The input is left
+// untouched since it may be shared with the last-good cache.
+func (o DataOptions) applyGas(gas *GasData) *GasData {
+	if o.Unit == "" || o.Unit == gas.Unit {
+		return gas
+	}
+	factor := gasUnits[o.Unit]
+	out := *gas
+	out.Gas = make(map[string]float64, len(gas.Gas))
+	for level, gwei := range gas.Gas {
+		v := gwei * factor
+		if o.Unit == "wei" {
+			v = math.Round(v)
+		}
+		out.Gas[level] = v
+	}
+	out.Unit = o.Unit
+	return &out
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseDataOptions(t *testing.T) {
+	opts, err := parseDataOptions(url.Values{"unit": {"WEI"}, "currency": {"eur"}})
+	if err != nil || opts.Unit != "wei" || opts.Currency != "eur" {
+		t.Fatalf("got %+v, %v", opts, err)
+	}
+	if _, err := parseDataOptions(url.Values{"unit": {"finney"}}); err == nil {
+		t.Error("invalid unit accepted")
+	}
+	if _, err := parseDataOptions(url.Values{"currency": {"doge"}}); err == nil {
+		t.Error("invalid currency accepted")
+	}
+
+	// Rejected before the paywall runs
+	called := false
+	handler := withDataOptions(func(w http.ResponseWriter, r *http.Request) { called = true })
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/api/gas?unit=finney", nil))
+	if rr.Code != http.StatusBadRequest || called {
+		t.Errorf("invalid unit: status %d, handler called %v", rr.Code, called)
+	}
+}
+
+func TestApplyGas(t *testing.T) {
+	gas := &GasData{Gas: map[string]float64{"fast": 0.5}, Unit: "gwei"}
+
+	wei := DataOptions{Unit: "wei"}.applyGas(gas)
+	if wei.Gas["fast"] != 5e8 || wei.Unit != "wei" {
+		t.Errorf("wei conversion: %+v", wei)
+	}
+	eth := DataOptions{Unit: "eth"}.applyGas(gas)
+	if eth.Gas["fast"] != 5e-10 {
+		t.Errorf("eth conversion: %+v", eth)
+	}
+	if gas.Gas["fast"] != 0.5 || gas.Unit != "gwei" {
+		t.Errorf("input modified: %+v", gas)
+	}
+}
+
+func TestConvertPrice(t *testing.T) {
+	fxRates.Store(map[string]float64{"EUR": 0.9})
+
+	price, err := convertPrice(&PriceData{Eth: 2000}, "eur")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.EthPrice != 1800 || price.Currency != "eur" || price.Eth != 2000 {
+		t.Errorf("unexpected conversion: %+v", price)
+	}
+}
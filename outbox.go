@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// Delivery kinds
+const (
+	DeliveryWebhook    = "webhook"    // a finished async job, posted to its callback URL
+	DeliverySettlement = "settlement" // a facilitated payment the facilitator did not settle at capture
+)
+
+// Delivery states
+const (
+	DeliveryPending = "pending" // waiting for its next attempt
+	DeliveryDead    = "dead"    // out of attempts, kept for an operator
+)
+
+// RetryPolicy is how often a kind of delivery is attempted. The wait
+// after each failure doubles from Backoff up to MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// wait is the pause before the next attempt, after attempts have failed
+func (p RetryPolicy) wait(attempts int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < attempts && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, p.MaxBackoff)
+}
+
+// Delivery is one side effect owed to the outside world
+type Delivery struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Status    string          `json:"status"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	NextAt    int64           `json:"next_at,omitempty"`
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt int64           `json:"created_at"`
+	UpdatedAt int64           `json:"updated_at"`
+}
+
+// DeliveryHandler makes one attempt at a delivery. Deliveries are made at
+// least once, so handlers pass d.ID on for receivers to drop repeats.
+type DeliveryHandler func(d Delivery) error
+
+type deliveryKind struct {
+	policy RetryPolicy
+	handle DeliveryHandler
+}
+
+// Outbox is a durable queue of deliveries that must survive a crash: job
+// webhooks and settlements the facilitator has yet to make. A delivery is written to DATA_DIR/outbox.json before
+// Enqueue returns and removed only once its handler succeeds, so one in
+// flight during a restart is attempted again. Failures are retried under
+// the kind's policy; deliveries that run out of attempts are dead-lettered
+// for an operator to retry or drop.
+type Outbox struct {
+	path  string
+	clock clock.Clock
+	kick  func() // starts a pass after an enqueue or retry; tests replace it
+
+	mu         sync.Mutex
+	items      map[string]*Delivery
+	kinds      map[string]deliveryKind
+	attempts   map[string]int64 // kind + "\x00" + result -> attempts
+	delivering sync.Mutex       // one pass at a time
+}
+
+// NewOutbox creates an outbox persisting to dataDir/outbox.json, loading
+// the deliveries a previous run left
+func NewOutbox(dataDir string) (*Outbox, error) {
+	o := &Outbox{
+		path:     filepath.Join(dataDir, "outbox.json"),
+		clock:    clock.System,
+		items:    make(map[string]*Delivery),
+		kinds:    make(map[string]deliveryKind),
+		attempts: make(map[string]int64),
+	}
+	o.kick = func() { go o.Deliver() }
+	data, err := os.ReadFile(o.path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored []Delivery
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("%s: %w", o.path, err)
+	}
+	pending := 0
+	for i := range stored {
+		o.items[stored[i].ID] = &stored[i]
+		if stored[i].Status == DeliveryPending {
+			pending++
+		}
+	}
+	if pending > 0 {
+		log.Printf("🔁 %d deliveries pending from the last run", pending)
+	}
+	return o, nil
+}
+
+// Register delivers deliveries of kind with handle under policy
+func (o *Outbox) Register(kind string, policy RetryPolicy, handle DeliveryHandler) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.kinds[kind] = deliveryKind{policy: policy, handle: handle}
+}
+
+// Enqueue stores a delivery of payload and starts its first attempt. Once
+// it returns without error the delivery survives a crash.
+func (o *Outbox) Enqueue(kind string, payload interface{}) (string, error) {
+	if o == nil {
+		return "", errors.New("no outbox")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	now := o.clock.Now().Unix()
+	d := &Delivery{
+		ID:        "dlv_" + hex.EncodeToString(b),
+		Kind:      kind,
+		Status:    DeliveryPending,
+		Payload:   data,
+		NextAt:    now,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	o.mu.Lock()
+	o.items[d.ID] = d
+	err = o.persistLocked()
+	if err != nil {
+		delete(o.items, d.ID)
+	}
+	o.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	o.kick()
+	return d.ID, nil
+}
+
+// Deliver attempts every pending delivery that is due, oldest first. It is
+// run on a schedule to pick up retries; a pass already running is not
+// joined.
+func (o *Outbox) Deliver() {
+	if !o.delivering.TryLock() {
+		return
+	}
+	defer o.delivering.Unlock()
+
+	o.mu.Lock()
+	now := o.clock.Now().Unix()
+	var due []Delivery
+	for _, d := range o.items {
+		if _, ok := o.kinds[d.Kind]; ok && d.Status == DeliveryPending && d.NextAt <= now {
+			due = append(due, *d)
+		}
+	}
+	o.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt < due[j].CreatedAt })
+
+	for _, d := range due {
+		o.attempt(d)
+	}
+}
+
+// attempt makes one delivery attempt and records its outcome
+func (o *Outbox) attempt(d Delivery) {
+	o.mu.Lock()
+	kind := o.kinds[d.Kind]
+	o.mu.Unlock()
+
+	err := kind.handle(d)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	item, ok := o.items[d.ID]
+	if !ok {
+		return // dropped by an operator meanwhile
+	}
+	result := "delivered"
+	if err == nil {
+		delete(o.items, d.ID)
+	} else {
+		now := o.clock.Now()
+		item.Attempts++
+		item.LastError = err.Error()
+		item.UpdatedAt = now.Unix()
+		result = "failed"
+		if item.Attempts >= kind.policy.MaxAttempts {
+			item.Status = DeliveryDead
+			item.NextAt = 0
+			result = "dead"
+			log.Printf("☠️  Delivery %s (%s) dead after %d attempts: %v", item.ID, item.Kind, item.Attempts, err)
+		} else {
+			item.NextAt = now.Add(kind.policy.wait(item.Attempts)).Unix()
+			log.Printf("Delivery %s (%s) attempt %d failed: %v", item.ID, item.Kind, item.Attempts, err)
+		}
+	}
+	o.attempts[d.Kind+"\x00"+result]++
+	if err := o.persistLocked(); err != nil {
+		log.Printf("⚠️  Could not persist outbox: %v", err)
+	}
+}
+
+// Retry puts a delivery back in the queue with its attempts reset
+func (o *Outbox) Retry(id string) (Delivery, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	d, ok := o.items[id]
+	if !ok {
+		return Delivery{}, false
+	}
+	now := o.clock.Now().Unix()
+	d.Status, d.Attempts, d.NextAt, d.UpdatedAt = DeliveryPending, 0, now, now
+	if err := o.persistLocked(); err != nil {
+		log.Printf("⚠️  Could not persist outbox: %v", err)
+	}
+	o.kick()
+	return *d, true
+}
+
+// Drop removes a delivery without making it
+func (o *Outbox) Drop(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.items[id]; !ok {
+		return false
+	}
+	delete(o.items, id)
+	if err := o.persistLocked(); err != nil {
+		log.Printf("⚠️  Could not persist outbox: %v", err)
+	}
+	return true
+}
+
+// List returns the deliveries in status, or all of them, oldest first.
+// Status "stuck" lists those that have failed at least once, dead or not.
+func (o *Outbox) List(status string) []Delivery {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := []Delivery{}
+	for _, d := range o.items {
+		if status == "" || d.Status == status || status == "stuck" && d.Attempts > 0 {
+			out = append(out, *d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	return out
+}
+
+// persistLocked writes every delivery to disk atomically. o.mu is held.
+func (o *Outbox) persistLocked() error {
+	stored := make([]Delivery, 0, len(o.items))
+	for _, d := range o.items {
+		stored = append(stored, *d)
+	}
+	return writeJSONFile(o.path, stored)
+}
+
+// handleAdminOutbox lists deliveries, optionally by ?status=, and retries
+// or drops one: POST /admin/outbox/{id}/retry, DELETE /admin/outbox/{id}
+func (o *Outbox) handleAdminOutbox(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/outbox"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		json.NewEncoder(w).Encode(map[string]interface{}{"deliveries": o.List(r.URL.Query().Get("status"))})
+	case r.Method == http.MethodPost && action == "retry":
+		d, ok := o.Retry(id)
+		if !ok {
+			http.Error(w, `{"error":"Delivery not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("🔁 Delivery %s (%s) queued for retry", d.ID, d.Kind)
+		json.NewEncoder(w).Encode(d)
+	case r.Method == http.MethodDelete && id != "" && action == "":
+		if !o.Drop(id) {
+			http.Error(w, `{"error":"Delivery not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("🗑️  Delivery %s dropped", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// WriteMetrics emits queued deliveries by state and attempts by result
+func (o *Outbox) WriteMetrics(b *strings.Builder) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	queued := make(map[string]int)
+	for _, d := range o.items {
+		queued[d.Kind+"\x00"+d.Status]++
+	}
+	b.WriteString("# HELP x402_outbox_deliveries Deliveries in the outbox, by kind and status\n")
+	b.WriteString("# TYPE x402_outbox_deliveries gauge\n")
+	for _, key := range sortedKeys(queued) {
+		kind, status, _ := strings.Cut(key, "\x00")
+		fmt.Fprintf(b, "x402_outbox_deliveries{kind=%q,status=%q} %d\n", kind, status, queued[key])
+	}
+	b.WriteString("# HELP x402_outbox_attempts_total Delivery attempts, by kind and result\n")
+	b.WriteString("# TYPE x402_outbox_attempts_total counter\n")
+	for _, key := range sortedKeys(o.attempts) {
+		kind, result, _ := strings.Cut(key, "\x00")
+		fmt.Fprintf(b, "x402_outbox_attempts_total{kind=%q,result=%q} %d\n", kind, result, o.attempts[key])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
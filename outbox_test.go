@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestOutboxRetriesAndDeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(time.Now())
+	o.clock, o.kick = fake, func() {}
+
+	var calls int
+	o.Register(DeliveryWebhook, RetryPolicy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour}, func(d Delivery) error {
+		calls++
+		return errors.New("connection refused")
+	})
+	id, err := o.Enqueue(DeliveryWebhook, map[string]string{"url": "http://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.Deliver()
+	o.Deliver() // not due again for a minute
+	if calls != 1 {
+		t.Fatalf("%d attempts before the backoff passed, want 1", calls)
+	}
+	fake.Advance(time.Minute)
+	o.Deliver()
+	fake.Advance(time.Minute) // the second retry waits two
+	o.Deliver()
+	fake.Advance(time.Minute)
+	o.Deliver()
+	fake.Advance(time.Hour)
+	o.Deliver()
+	if calls != 3 {
+		t.Errorf("%d attempts, want 3", calls)
+	}
+	dead := o.List(DeliveryDead)
+	if len(dead) != 1 || dead[0].ID != id || dead[0].LastError != "connection refused" {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+	if stuck := o.List("stuck"); len(stuck) != 1 {
+		t.Errorf("stuck = %+v", stuck)
+	}
+
+	// An operator retries it once the receiver is back
+	o.Register(DeliveryWebhook, RetryPolicy{MaxAttempts: 3}, func(d Delivery) error { return nil })
+	rr := httptest.NewRecorder()
+	o.handleAdminOutbox(rr, httptest.NewRequest("POST", "/admin/outbox/"+id+"/retry", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("retry returned %d: %s", rr.Code, rr.Body)
+	}
+	o.Deliver()
+	if left := o.List(""); len(left) != 0 {
+		t.Errorf("outbox after delivery = %+v", left)
+	}
+
+	var b strings.Builder
+	o.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_outbox_attempts_total{kind="webhook",result="dead"} 1`,
+		`x402_outbox_attempts_total{kind="webhook",result="delivered"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.kick = func() {}
+	// Nothing delivers webhooks yet, as if the process died first
+	id, err := o.Enqueue(DeliveryWebhook, jobWebhook{URL: "http://example.com/hook", Job: Job{ID: "job1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.kick = func() {}
+	var got jobWebhook
+	var gotID string
+	restarted.Register(DeliveryWebhook, RetryPolicy{MaxAttempts: 1}, func(d Delivery) error {
+		gotID = d.ID
+		return json.Unmarshal(d.Payload, &got)
+	})
+	restarted.Deliver()
+	if gotID != id || got.Job.ID != "job1" {
+		t.Errorf("delivered %s %+v after restart, want %s", gotID, got, id)
+	}
+
+	again, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := again.List(""); len(left) != 0 {
+		t.Errorf("delivered webhook still on disk: %+v", left)
+	}
+}
+
+func TestE2EJobWebhook(t *testing.T) {
+	hooks := make(chan *http.Request, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hooks <- r
+	}))
+	defer receiver.Close()
+	srv, _ := startService(t, map[string]string{"PROVIDERS": "mock"})
+
+	do := func(token string) *http.Response {
+		req, _ := http.NewRequest("POST", srv.URL+"/api/scan-contract?async=true", strings.NewReader(`{"address":"0x1111111111111111111111111111111111111111","chain":"base"}`))
+		req.Header.Set("X-Callback-URL", receiver.URL)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	challenge := do("")
+	resp := do(pay(t, challenge))
+	challenge.Body.Close()
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("async request returned %d", resp.StatusCode)
+	}
+
+	select {
+	case r := <-hooks:
+		if !strings.HasPrefix(r.Header.Get("X-Delivery-Id"), "dlv_") {
+			t.Errorf("webhook X-Delivery-Id = %q", r.Header.Get("X-Delivery-Id"))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+}
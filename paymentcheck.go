@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Checks a payment token can fail, as named in rejection diagnostics
+const (
+	CheckFormat      = "format"    // not a JWT carrying payment claims, or an exact payment payload
+	CheckSignature   = "signature" // not signed with a payment key; exact: not signed by the payer
+	CheckExpiry      = "expiry"    // exp past; exact: validBefore past
+	CheckLifetime    = "lifetime"  // exp missing or further ahead than allowed; exact: validBefore too far ahead
+	CheckNotBefore   = "nbf"       // nbf still in the future; exact: validAfter not passed
+	CheckIssuedAt    = "iat"       // iat in the future
+	CheckAudience    = "audience"  // strict: aud does not name this service
+	CheckAmount      = "amount"
+	CheckAsset       = "asset"
+	CheckReceiver    = "receiver"
+	CheckNetwork     = "network"     // a sandbox token the deployment refuses, or in strict mode any other network
+	CheckBinding     = "binding"     // request body or signer mismatch
+	CheckRoute       = "route"       // method or path claim names another request; strict: missing
+	CheckNonce       = "nonce"       // missing, unknown, used or expired challenge nonce
+	CheckSettlement  = "settlement"  // no confirmed on-chain transfer backs the payment
+	CheckReplay      = "replay"      // the token's jti already paid for a request
+	CheckFacilitator = "facilitator" // the facilitator refused an exact payment
+)
+
+// CheckFailure is one reason a payment token was refused
+type CheckFailure struct {
+	Check  string `json:"check"`
+	Reason string `json:"reason"`
+}
+
+func (f CheckFailure) String() string {
+	return f.Check + ": " + f.Reason
+}
+
+// StrictPayments is what STRICT_PAYMENTS checks besides the quote, the
+// token's signature and its lifetime. Without it a token only has to match
+// those, the request it pays for, a challenge nonce if the
+// challenge_nonces flag is on, and the sandbox policy.
+type StrictPayments struct {
+	Audience string // must appear in the aud claim
+}
+
+// checkToken parses a payment token and runs the checks that depend only on
+// the token: its signature against keys, its exp, nbf and iat claims, the
+// quoted amount range, asset and receiver, and with strict set its aud
+// claim. It returns every check that failed; claims is nil only if the
+// token could not be parsed.
+func checkToken(tokenString, minAmount, maxAmount, expectedAsset, expectedReceiver string, keys *PaymentKeys, strict *StrictPayments, now time.Time) (*PaymentToken, []CheckFailure) {
+	claims := &PaymentToken{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+		return nil, []CheckFailure{{CheckFormat, err.Error()}}
+	}
+
+	failed := keys.check(tokenString, claims, now)
+	if strict != nil && !slices.Contains(claims.Audience, strict.Audience) {
+		failed = append(failed, CheckFailure{CheckAudience, fmt.Sprintf("aud is %q, want %q", []string(claims.Audience), strict.Audience)})
+	}
+
+	failed = append(failed, checkQuoted(claims.Payment, minAmount, maxAmount, expectedAsset, expectedReceiver)...)
+	return claims, failed
+}
+
+// checkQuoted checks that a payment matches the quoted amount range, asset
+// and receiver
+func checkQuoted(payment PaymentClaims, minAmount, maxAmount, expectedAsset, expectedReceiver string) []CheckFailure {
+	var failed []CheckFailure
+	fail := func(check, format string, args ...interface{}) {
+		failed = append(failed, CheckFailure{check, fmt.Sprintf(format, args...)})
+	}
+	if !amountInRange(payment.Amount, minAmount, maxAmount) {
+		if minAmount == maxAmount {
+			fail(CheckAmount, "got %s, want %s", payment.Amount, minAmount)
+		} else {
+			fail(CheckAmount, "got %s, want %s to %s", payment.Amount, minAmount, maxAmount)
+		}
+	}
+	if payment.Asset != expectedAsset {
+		fail(CheckAsset, "got %s, want %s", payment.Asset, expectedAsset)
+	}
+	if strings.ToLower(payment.Receiver) != strings.ToLower(expectedReceiver) {
+		fail(CheckReceiver, "got %s, want %s", payment.Receiver, expectedReceiver)
+	}
+	return failed
+}
+
+// checkRoute matches a token's method and path claims to the request it
+// pays for, so a token bought for one endpoint cannot be spent on another
+// at the same price. path must name endpoint or, under it, the path
+// requested; method the request's method. A nil binding, for transports
+// without an HTTP request, only checks path. With strict set the claims
+// are required.
+func checkRoute(claims *PaymentToken, endpoint string, b *requestBinding, strict *StrictPayments) []CheckFailure {
+	var failed []CheckFailure
+	fail := func(format string, args ...interface{}) {
+		failed = append(failed, CheckFailure{CheckRoute, fmt.Sprintf(format, args...)})
+	}
+	method, path := claims.Payment.Method, claims.Payment.Path
+	switch {
+	case path == "" && strict != nil:
+		fail("path missing, want %s", endpoint)
+	case path == "" || path == endpoint:
+	case b == nil || path != b.path:
+		fail("payment is for %s, not %s", path, endpoint)
+	}
+	if b == nil {
+		return failed
+	}
+	switch {
+	case method == "" && strict != nil:
+		fail("method missing, want %s", b.method)
+	case method != "" && !strings.EqualFold(method, b.method):
+		fail("payment is for %s, not %s", strings.ToUpper(method), b.method)
+	}
+	return failed
+}
+
+// Codes of a 402 refusing a payment, besides paymentSpentCode, so a client
+// can tell a payment it only has to renew from one it has to fix
+const (
+	paymentInvalidCode     = "payment_invalid"
+	paymentExpiredCode     = "payment_expired"       // pay again
+	paymentNotYetValidCode = "payment_not_yet_valid" // retry once nbf has passed, or fix the clock
+)
+
+// refusalCode is the code of a 402 refusing a payment that failed checks.
+// A payment is only expired or not yet valid if nothing else is wrong
+// with it.
+func refusalCode(failed []CheckFailure) string {
+	if spent(failed) {
+		return paymentSpentCode
+	}
+	only := func(checks ...string) bool {
+		for _, f := range failed {
+			if !slices.Contains(checks, f.Check) {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case only(CheckExpiry):
+		return paymentExpiredCode
+	case only(CheckNotBefore, CheckIssuedAt):
+		return paymentNotYetValidCode
+	}
+	return paymentInvalidCode
+}
+
+// rejectionReason is what a refused payment is recorded as on the
+// dashboard: failures of the token's own checks as one reason, otherwise
+// the first failure
+func rejectionReason(failed []CheckFailure) string {
+	switch failed[0].Check {
+	case CheckNetwork, CheckBinding, CheckRoute, CheckNonce, CheckSettlement, CheckReplay, CheckFacilitator:
+		return failed[0].Reason
+	}
+	return "invalid or insufficient payment"
+}
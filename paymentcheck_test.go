@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckTokenStrict(t *testing.T) {
+	keys := &PaymentKeys{}
+	keys.Set(map[string][]byte{"": []byte("secret"), "next": []byte("rotated")}, 30*time.Second)
+	strict := &StrictPayments{Audience: "https://api.example.com"}
+	receiver := "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"
+	valid := func() PaymentToken {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Receiver = receiver
+		claims.Payment.Network = "base"
+		claims.Audience = jwt.ClaimStrings{strict.Audience}
+		claims.ExpiresAt = jwt.NewNumericDate(epoch.Add(5 * time.Minute))
+		claims.NotBefore = jwt.NewNumericDate(epoch)
+		claims.IssuedAt = jwt.NewNumericDate(epoch)
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		edit   func(*PaymentToken)
+		kid    string
+		key    string
+		failed []string
+	}{
+		{"valid", func(*PaymentToken) {}, "", "secret", nil},
+		{"wrong key", func(*PaymentToken) {}, "", "other", []string{CheckSignature}},
+		{"named key", func(*PaymentToken) {}, "next", "rotated", nil},
+		{"other named key", func(*PaymentToken) {}, "next", "secret", []string{CheckSignature}},
+		{"unknown key ID", func(*PaymentToken) {}, "retired", "secret", []string{CheckSignature}},
+		{"no exp", func(c *PaymentToken) { c.ExpiresAt = nil }, "", "secret", []string{CheckLifetime}},
+		{"expired", func(c *PaymentToken) { c.ExpiresAt = jwt.NewNumericDate(epoch.Add(-time.Minute)) }, "", "secret", []string{CheckExpiry}},
+		{"expired within leeway", func(c *PaymentToken) { c.ExpiresAt = jwt.NewNumericDate(epoch.Add(-10 * time.Second)) }, "", "secret", nil},
+		{"not yet valid", func(c *PaymentToken) { c.NotBefore = jwt.NewNumericDate(epoch.Add(time.Minute)) }, "", "secret", []string{CheckNotBefore}},
+		{"issued in the future", func(c *PaymentToken) { c.IssuedAt = jwt.NewNumericDate(epoch.Add(time.Minute)) }, "", "secret", []string{CheckIssuedAt}},
+		{"other audience", func(c *PaymentToken) { c.Audience = jwt.ClaimStrings{"https://other.example.com"} }, "", "secret", []string{CheckAudience}},
+		{"everything wrong", func(c *PaymentToken) {
+			c.Audience, c.ExpiresAt = nil, nil
+			c.Payment.Amount, c.Payment.Asset, c.Payment.Receiver = "0.0001", "DAI", "0x0"
+		}, "", "other", []string{CheckAmount, CheckAsset, CheckAudience, CheckLifetime, CheckReceiver, CheckSignature}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.edit(&claims)
+			unsigned := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+			if tt.kid != "" {
+				unsigned.Header["kid"] = tt.kid
+			}
+			token, err := unsigned.SignedString([]byte(tt.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, failed := checkToken(token, "0.001", "0.001", "USDC", receiver, keys, strict, epoch)
+			var got []string
+			for _, f := range failed {
+				got = append(got, f.Check)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.failed, ",") {
+				t.Errorf("failed checks = %v, want %v", failed, tt.failed)
+			}
+		})
+	}
+
+	if _, failed := checkToken("not-a-jwt", "0.001", "0.001", "USDC", receiver, keys, strict, epoch); len(failed) != 1 || failed[0].Check != CheckFormat {
+		t.Errorf("garbage token failed %v, want format", failed)
+	}
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, failed := checkToken(unsigned, "0.001", "0.001", "USDC", receiver, keys, strict, epoch); len(failed) != 1 || failed[0].Check != CheckSignature {
+		t.Errorf("alg none token failed %v, want signature", failed)
+	}
+
+	// Only strict mode asks for the audience, and without a key nothing passes
+	claims := valid()
+	claims.Audience = nil
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if _, failed := checkToken(token, "0.001", "0.001", "USDC", receiver, keys, nil, epoch); len(failed) != 0 {
+		t.Errorf("lenient token failed %v", failed)
+	}
+	if _, failed := checkToken(token, "0.001", "0.001", "USDC", receiver, &PaymentKeys{}, nil, epoch); len(failed) != 1 || failed[0].Check != CheckSignature {
+		t.Errorf("token checked without keys failed %v, want signature", failed)
+	}
+
+	// A maximum lifetime refuses tokens valid for longer, skew allowed
+	keys.SetMaxLifetime(2 * time.Minute)
+	for ttl, want := range map[time.Duration]int{2 * time.Minute: 0, 150 * time.Second: 0, 3 * time.Minute: 1} {
+		claims := valid()
+		claims.ExpiresAt = jwt.NewNumericDate(epoch.Add(ttl))
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if _, failed := checkToken(token, "0.001", "0.001", "USDC", receiver, keys, strict, epoch); len(failed) != want || (want > 0 && failed[0].Check != CheckLifetime) {
+			t.Errorf("token valid for %s failed %v, want %d lifetime failures", ttl, failed, want)
+		}
+	}
+}
+
+func TestRefusalCode(t *testing.T) {
+	tests := []struct {
+		checks []string
+		code   string
+	}{
+		{[]string{CheckExpiry}, paymentExpiredCode},
+		{[]string{CheckNotBefore}, paymentNotYetValidCode},
+		{[]string{CheckNotBefore, CheckIssuedAt}, paymentNotYetValidCode},
+		{[]string{CheckReplay}, paymentSpentCode},
+		{[]string{CheckExpiry, CheckSignature}, paymentInvalidCode},
+		{[]string{CheckExpiry, CheckNotBefore}, paymentInvalidCode},
+		{[]string{CheckLifetime}, paymentInvalidCode},
+		{[]string{CheckAmount}, paymentInvalidCode},
+	}
+	for _, tt := range tests {
+		var failed []CheckFailure
+		for _, check := range tt.checks {
+			failed = append(failed, CheckFailure{Check: check})
+		}
+		if got := refusalCode(failed); got != tt.code {
+			t.Errorf("refusalCode(%v) = %s, want %s", tt.checks, got, tt.code)
+		}
+	}
+}
+
+func TestExpiredPaymentCode(t *testing.T) {
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+	pay := func(edit func(*PaymentToken)) (int, string, string) {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Network = "base"
+		claims.Payment.Receiver = config.Receiver
+		edit(&claims)
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment-Response", signPayment(t, claims))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		var body struct {
+			Code  string `json:"code"`
+			Retry string `json:"retry"`
+		}
+		json.NewDecoder(rr.Body).Decode(&body)
+		return rr.Code, body.Code, body.Retry
+	}
+
+	tests := []struct {
+		name        string
+		edit        func(*PaymentToken)
+		code, retry string
+	}{
+		{"expired", func(c *PaymentToken) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour)) }, paymentExpiredCode, "new_payment"},
+		{"not yet valid", func(c *PaymentToken) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour)) }, paymentNotYetValidCode, ""},
+		{"underpaid", func(c *PaymentToken) { c.Payment.Amount = "0.0001" }, paymentInvalidCode, ""},
+		{"expired and underpaid", func(c *PaymentToken) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			c.Payment.Amount = "0.0001"
+		}, paymentInvalidCode, ""},
+	}
+	for _, tt := range tests {
+		if status, code, retry := pay(tt.edit); status != http.StatusPaymentRequired || code != tt.code || retry != tt.retry {
+			t.Errorf("%s: returned %d %s %q, want 402 %s %q", tt.name, status, code, retry, tt.code, tt.retry)
+		}
+	}
+}
+
+func TestCheckRoute(t *testing.T) {
+	strict := &StrictPayments{Audience: "https://api.example.com"}
+	history := &requestBinding{method: "GET", path: "/api/risk-history/0xabc"}
+	tests := []struct {
+		name         string
+		method, path string
+		binding      *requestBinding
+		strict       *StrictPayments
+		failed       int
+	}{
+		{"unbound", "", "", history, nil, 0},
+		{"endpoint", "GET", "/api/risk-history", history, nil, 0},
+		{"requested path", "get", "/api/risk-history/0xabc", history, nil, 0},
+		{"other path", "", "/api/risk-history/0xdef", history, nil, 1},
+		{"other endpoint", "", "/api/gas", history, nil, 1},
+		{"other method", "POST", "", history, nil, 1},
+		{"strict unbound", "", "", history, strict, 2},
+		{"strict bound", "GET", "/api/risk-history", history, strict, 0},
+		{"no request", "POST", "/api/risk-history", nil, strict, 0},
+		{"no request, other endpoint", "", "/api/gas", nil, nil, 1},
+	}
+	for _, tt := range tests {
+		claims := &PaymentToken{}
+		claims.Payment.Method, claims.Payment.Path = tt.method, tt.path
+		failed := checkRoute(claims, "/api/risk-history", tt.binding, tt.strict)
+		if len(failed) != tt.failed {
+			t.Errorf("%s: failed %v, want %d failures", tt.name, failed, tt.failed)
+		}
+		for _, f := range failed {
+			if f.Check != CheckRoute {
+				t.Errorf("%s: failed %v, want route", tt.name, f)
+			}
+		}
+	}
+}
+
+func TestE2EStrictPayments(t *testing.T) {
+	srv, _ := startService(t, map[string]string{
+		"STRICT_PAYMENTS":     "true",
+		"X402_SIGNING_KEY":    "",
+		"PAYMENT_SIGNING_KEY": "secret",
+		"PAYMENT_AUDIENCE":    "https://api.example.com",
+		"PAYMENT_DIAGNOSTICS": "true",
+	})
+
+	get := func(token string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/gas", nil)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	challenge := func() PaymentRequirement {
+		var body struct {
+			Payment PaymentRequirement `json:"payment"`
+		}
+		json.NewDecoder(get("").Body).Decode(&body)
+		if body.Payment.Nonce == "" || body.Payment.Audience != "https://api.example.com" {
+			t.Fatalf("challenge = %+v, want a nonce and the audience", body.Payment)
+		}
+		return body.Payment
+	}
+
+	// A token signed with another key for no audience or route is refused,
+	// with every reason listed
+	loose := get(pay(t, get("")))
+	var refused struct {
+		Checks []CheckFailure `json:"checks"`
+	}
+	json.NewDecoder(loose.Body).Decode(&refused)
+	var checks []string
+	for _, f := range refused.Checks {
+		checks = append(checks, f.Check)
+	}
+	if loose.StatusCode != http.StatusPaymentRequired || strings.Join(checks, ",") != "signature,audience,route,route" {
+		t.Errorf("lenient token returned %d with checks %+v", loose.StatusCode, refused.Checks)
+	}
+
+	// The nonce survives a refusal, so a fixed token can still use it
+	req := challenge()
+	claims := PaymentToken{}
+	claims.Payment.Amount = req.MaxAmount
+	claims.Payment.Asset = req.Asset
+	claims.Payment.Receiver = req.Receiver
+	claims.Payment.Network = "base-sepolia"
+	claims.Payment.Nonce = req.Nonce
+	claims.Payment.Method = "GET"
+	claims.Payment.Path = req.Resource
+	claims.Audience = jwt.ClaimStrings{req.Audience}
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	sign := func() string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	if resp := get(sign()); resp.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("sandbox token returned %d, want 402", resp.StatusCode)
+	}
+	claims.Payment.Network = "base"
+	claims.Payment.Path = "/api/price"
+	if resp := get(sign()); resp.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("token for another endpoint returned %d, want 402", resp.StatusCode)
+	}
+	claims.Payment.Path = req.Resource
+	if resp := get(sign()); resp.StatusCode != http.StatusOK {
+		t.Errorf("strict token returned %d", resp.StatusCode)
+	}
+	if resp := get(sign()); resp.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("reused nonce returned %d, want 402", resp.StatusCode)
+	}
+}
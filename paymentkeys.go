@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultTokenLeeway is the clock skew allowed on exp, nbf and iat unless
+// PAYMENT_LEEWAY_SEC says otherwise
+const defaultTokenLeeway = 30 * time.Second
+
+// paymentKeys verifies payment tokens. newService loads it from
+// X402_SIGNING_KEY and X402_SIGNING_KEYS; until then, and with neither
+// set, every token is refused.
+var paymentKeys = &PaymentKeys{leeway: defaultTokenLeeway}
+
+// PaymentKeys are the HS256 secrets payment tokens may be signed with, by
+// key ID. A token whose kid header names a key must be signed with that
+// key; a token without kid with the default key, whose ID is "".
+type PaymentKeys struct {
+	mu          sync.RWMutex
+	keys        map[string][]byte
+	leeway      time.Duration
+	maxLifetime time.Duration // 0 for no limit
+}
+
+// Set replaces the key set and the clock skew allowed on token times
+func (k *PaymentKeys) Set(keys map[string][]byte, leeway time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.leeway = leeway
+}
+
+// SetMaxLifetime limits how far ahead of now a token's exp may be, so a
+// token cannot be held for later and its jti is not remembered for long.
+// 0 removes the limit.
+func (k *PaymentKeys) SetMaxLifetime(d time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.maxLifetime = d
+}
+
+// Len returns how many keys tokens can be signed with
+func (k *PaymentKeys) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys)
+}
+
+func (k *PaymentKeys) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	if !ok {
+		if kid == "" {
+			return nil, fmt.Errorf("token has no kid and there is no default key")
+		}
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+// check verifies the signature of tokenString, whose claims are claims,
+// and its lifetime: exp is required, must not have passed and, with a
+// maximum lifetime set, must not be further ahead than that, and nbf and
+// iat must not be in the future. With no keys every token fails.
+func (k *PaymentKeys) check(tokenString string, claims *PaymentToken, now time.Time) []CheckFailure {
+	var failed []CheckFailure
+	fail := func(check, format string, args ...interface{}) {
+		failed = append(failed, CheckFailure{check, fmt.Sprintf(format, args...)})
+	}
+	k.mu.RLock()
+	leeway, maxLifetime, keyed := k.leeway, k.maxLifetime, len(k.keys) > 0
+	k.mu.RUnlock()
+
+	if !keyed {
+		fail(CheckSignature, "no payment signing key is configured")
+	} else {
+		parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation())
+		if _, err := parser.ParseWithClaims(tokenString, &PaymentToken{}, k.key); err != nil {
+			fail(CheckSignature, "%v", err)
+		}
+	}
+	switch exp := claims.ExpiresAt; {
+	case exp == nil:
+		fail(CheckLifetime, "token has no exp claim")
+	case now.After(exp.Add(leeway)):
+		fail(CheckExpiry, "token expired at %s", exp.UTC().Format(time.RFC3339))
+	case maxLifetime > 0 && exp.Sub(now) > maxLifetime+leeway:
+		fail(CheckLifetime, "token valid until %s, at most %s ahead is accepted", exp.UTC().Format(time.RFC3339), maxLifetime)
+	}
+	if nbf := claims.NotBefore; nbf != nil && now.Add(leeway).Before(nbf.Time) {
+		fail(CheckNotBefore, "token not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+	if iat := claims.IssuedAt; iat != nil && now.Add(leeway).Before(iat.Time) {
+		fail(CheckIssuedAt, "token issued in the future, at %s", iat.UTC().Format(time.RFC3339))
+	}
+	return failed
+}
+
+// parsePaymentKeys parses X402_SIGNING_KEYS, comma-separated kid:secret
+// pairs
+func parsePaymentKeys(s string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, fmt.Errorf("%q: want kid:secret", pair)
+		}
+		if _, dup := keys[kid]; dup {
+			return nil, fmt.Errorf("key ID %q listed twice", kid)
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys, nil
+}
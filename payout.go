@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// defaultBaseRPC is the public Base RPC used for on-chain lookups
+const defaultBaseRPC = "https://mainnet.base.org"
+
+// payoutTokens are the payment asset contracts, by "network:asset"
+var payoutTokens = networkTokens()
+
+const (
+	selectorBalanceOf = "70a08231"
+	selectorTransfer  = "a9059cbb"
+
+	// erc20TransferTopic is keccak256("Transfer(address,address,uint256)")
+	erc20TransferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	// erc20TransferGas is used when the sweep cannot be estimated, e.g.
+	// while the receiver holds no ETH for gas
+	erc20TransferGas = 65000
+)
+
+// PayoutPolicy is when accumulated payments are swept to cold storage
+type PayoutPolicy struct {
+	To         string  // cold address
+	MinAmount  float64 // in the payment asset; smaller balances wait
+	MaxGasGwei float64 // sweeps wait while gas costs more; 0 for no ceiling
+}
+
+// SweepTx is an unsigned transfer of the receiver's whole balance, for the
+// receiver's wallet to sign and send
+type SweepTx struct {
+	From     string `json:"from"`
+	To       string `json:"to"` // the token contract
+	Data     string `json:"data"`
+	Value    string `json:"value"`
+	Gas      string `json:"gas"`
+	GasPrice string `json:"gasPrice"`
+	Nonce    string `json:"nonce"`
+	ChainID  string `json:"chainId,omitempty"`
+}
+
+// SweepPlan is the sweep the receiver is due, if any
+type SweepPlan struct {
+	Receiver     string   `json:"receiver"`
+	Destination  string   `json:"destination"`
+	Asset        string   `json:"asset"`
+	Balance      string   `json:"balance"`
+	MinAmount    float64  `json:"min_amount"`
+	Payments     int      `json:"payments"` // ledger payments since the last sweep
+	RevenueUSD   float64  `json:"revenue_usd"`
+	GasPriceGwei float64  `json:"gas_price_gwei"`
+	MaxGasGwei   float64  `json:"max_gas_gwei,omitempty"`
+	Due          bool     `json:"due"`
+	Reason       string   `json:"reason,omitempty"` // why no sweep is due
+	Tx           *SweepTx `json:"tx,omitempty"`
+	CheckedAt    int64    `json:"checked_at"`
+}
+
+// Sweep is a confirmed transfer from the receiver to the cold address
+type Sweep struct {
+	TxHash     string  `json:"tx_hash"`
+	Block      int64   `json:"block"`
+	Amount     string  `json:"amount"`
+	Asset      string  `json:"asset"`
+	To         string  `json:"to"`
+	Payments   int     `json:"payments"` // ledger payments it settled
+	RevenueUSD float64 `json:"revenue_usd"`
+	SweptAt    int64   `json:"swept_at"`
+}
+
+// Payouts batches the payments that accumulate at the receiver into
+// sweeps to a cold address. The service holds no keys: the leader checks
+// the receiver's balance and gas price, announces a sweep once one is due
+// and serves the unsigned transfer for the operator to sign. Sweeps are
+// recorded once their receipt confirms the transfer, in
+// DATA_DIR/payouts.jsonl.
+type Payouts struct {
+	rpcURL   string
+	token    string
+	asset    string
+	decimals int
+	chainID  string
+	receiver string
+	policy   PayoutPolicy
+	ledger   *Ledger
+	notify   *Notifier
+	clock    clock.Clock
+	path     string
+
+	mu     sync.Mutex
+	sweeps []Sweep // oldest first
+	due    bool    // the last check announced a due sweep
+}
+
+// NewPayouts sweeps the asset paid to config.Receiver through token,
+// loading the sweeps recorded in dataDir
+func NewPayouts(dataDir, rpcURL, token, chainID string, config ServiceConfig, policy PayoutPolicy, ledger *Ledger) (*Payouts, error) {
+	if err := address.Validate(policy.To); err != nil {
+		return nil, fmt.Errorf("payout address: %w", err)
+	}
+	if err := address.Validate(token); err != nil {
+		return nil, fmt.Errorf("payout token: %w", err)
+	}
+	p := &Payouts{
+		rpcURL:   rpcURL,
+		token:    strings.ToLower(token),
+		asset:    config.Asset,
+		decimals: paymentAssets[config.Asset].decimals,
+		chainID:  chainID,
+		receiver: strings.ToLower(config.Receiver),
+		policy:   policy,
+		ledger:   ledger,
+		clock:    clock.System,
+		path:     filepath.Join(dataDir, "payouts.jsonl"),
+	}
+	f, err := os.Open(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s Sweep
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return nil, fmt.Errorf("%s: %w", p.path, err)
+		}
+		p.sweeps = append(p.sweeps, s)
+	}
+	return p, scanner.Err()
+}
+
+// SetNotifier announces due sweeps on the notification channels
+func (p *Payouts) SetNotifier(n *Notifier) {
+	p.notify = n
+}
+
+// Sweeps returns the recorded sweeps, newest first
+func (p *Payouts) Sweeps() []Sweep {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]Sweep, len(p.sweeps))
+	for i, s := range p.sweeps {
+		out[len(p.sweeps)-1-i] = s
+	}
+	return out
+}
+
+// lastSweep returns when the receiver was last swept, or 0
+func (p *Payouts) lastSweep() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.sweeps) == 0 {
+		return 0
+	}
+	return p.sweeps[len(p.sweeps)-1].SweptAt
+}
+
+// unswept counts the ledger payments to the receiver since the last sweep
+func (p *Payouts) unswept(through int64) (int, float64) {
+	since := p.lastSweep()
+	count, usd := 0, 0.0
+	for _, tenant := range p.ledger.Tenants() {
+		for _, e := range p.ledger.Entries(tenant) {
+			if e.CreatedAt <= since || e.CreatedAt > through || strings.ToLower(e.Receiver) != p.receiver || e.Amount == "0" {
+				continue
+			}
+			count++
+			usd += e.AmountUSD
+		}
+	}
+	return count, round(usd, 6)
+}
+
+func (p *Payouts) rpc(method string, params ...interface{}) (string, error) {
+	var out string
+	err := jsonRPC(p.rpcURL, method, params, &out)
+	return out, err
+}
+
+// Plan reads the receiver's balance and the gas price and returns the
+// sweep they call for
+func (p *Payouts) Plan() (*SweepPlan, error) {
+	now := p.clock.Now().Unix()
+	plan := &SweepPlan{
+		Receiver:    p.receiver,
+		Destination: strings.ToLower(p.policy.To),
+		Asset:       p.asset,
+		MinAmount:   p.policy.MinAmount,
+		MaxGasGwei:  p.policy.MaxGasGwei,
+		CheckedAt:   now,
+	}
+	plan.Payments, plan.RevenueUSD = p.unswept(now)
+
+	raw, err := p.rpc("eth_call", map[string]string{"to": p.token, "data": "0x" + selectorBalanceOf + fmt.Sprintf("%064s", strings.TrimPrefix(p.receiver, "0x"))}, "latest")
+	if err != nil {
+		return nil, fmt.Errorf("balance: %w", err)
+	}
+	data, _ := hex.DecodeString(strings.TrimPrefix(raw, "0x"))
+	balance, err := abiData(data).uint(0)
+	if err != nil {
+		return nil, fmt.Errorf("balance: %w", err)
+	}
+	plan.Balance = units.Format(balance, p.decimals)
+
+	raw, err = p.rpc("eth_gasPrice")
+	if err != nil {
+		return nil, fmt.Errorf("gas price: %w", err)
+	}
+	gasPrice, err := units.ParseHex(raw)
+	if err != nil {
+		return nil, fmt.Errorf("gas price: %w", err)
+	}
+	plan.GasPriceGwei = round(units.ToGwei(gasPrice), 6)
+
+	amount := units.ToUnit(balance, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(p.decimals)), nil))
+	switch {
+	case balance.Sign() == 0:
+		plan.Reason = "nothing to sweep"
+		return plan, nil
+	case amount < p.policy.MinAmount:
+		plan.Reason = "balance below the sweep threshold"
+	case p.policy.MaxGasGwei > 0 && plan.GasPriceGwei > p.policy.MaxGasGwei:
+		plan.Reason = "gas price above the ceiling"
+	default:
+		plan.Due = true
+	}
+
+	tx := &SweepTx{
+		From:     p.receiver,
+		To:       p.token,
+		Data:     "0x" + selectorTransfer + fmt.Sprintf("%064s%064x", strings.TrimPrefix(plan.Destination, "0x"), balance),
+		Value:    "0x0",
+		Gas:      units.Hex(big.NewInt(erc20TransferGas)),
+		GasPrice: units.Hex(gasPrice),
+		ChainID:  p.chainID,
+	}
+	if tx.Nonce, err = p.rpc("eth_getTransactionCount", p.receiver, "pending"); err != nil {
+		return nil, fmt.Errorf("nonce: %w", err)
+	}
+	if gas, err := p.rpc("eth_estimateGas", map[string]string{"from": tx.From, "to": tx.To, "data": tx.Data}); err == nil {
+		tx.Gas = gas
+	}
+	plan.Tx = tx
+	return plan, nil
+}
+
+// Check announces a sweep when one falls due. Run it on the leader only.
+func (p *Payouts) Check() {
+	plan, err := p.Plan()
+	if err != nil {
+		log.Printf("⚠️  Payout check failed: %v", err)
+		return
+	}
+	p.mu.Lock()
+	announce := plan.Due && !p.due
+	p.due = plan.Due
+	p.mu.Unlock()
+	if !announce {
+		return
+	}
+	message := fmt.Sprintf("Sweep %s %s from %s to %s (%d payments, gas %.4f gwei)", plan.Balance, plan.Asset, plan.Receiver, plan.Destination, plan.Payments, plan.GasPriceGwei)
+	log.Printf("🏦 %s", message)
+	p.notify.Notify(NotifyPayout, map[string]string{
+		"amount":   plan.Balance,
+		"asset":    plan.Asset,
+		"from":     plan.Receiver,
+		"to":       plan.Destination,
+		"payments": fmt.Sprint(plan.Payments),
+		"message":  message,
+	})
+}
+
+// txReceipt is the part of a transaction receipt a sweep is checked against
+type txReceipt struct {
+	Status      string `json:"status"`
+	BlockNumber string `json:"blockNumber"`
+	BlockHash   string `json:"blockHash"`
+	Logs        []struct {
+		Address string   `json:"address"`
+		Topics  []string `json:"topics"`
+		Data    string   `json:"data"`
+	} `json:"logs"`
+}
+
+// topicAddress is the address in an indexed log topic
+func topicAddress(topic string) string {
+	return "0x" + strings.ToLower(strings.TrimPrefix(topic, "0x")[24:])
+}
+
+// Record checks that txHash moved the asset from the receiver to the cold
+// address and records it as a sweep of the payments before it
+func (p *Payouts) Record(txHash string) (Sweep, error) {
+	p.mu.Lock()
+	for _, s := range p.sweeps {
+		if strings.EqualFold(s.TxHash, txHash) {
+			p.mu.Unlock()
+			return s, fmt.Errorf("transaction %s is already recorded", txHash)
+		}
+	}
+	p.mu.Unlock()
+
+	var receipt *txReceipt
+	if err := jsonRPC(p.rpcURL, "eth_getTransactionReceipt", []interface{}{txHash}, &receipt); err != nil {
+		return Sweep{}, err
+	}
+	if receipt == nil {
+		return Sweep{}, fmt.Errorf("transaction %s is not mined yet", txHash)
+	}
+	if receipt.Status != "0x1" {
+		return Sweep{}, fmt.Errorf("transaction %s failed", txHash)
+	}
+	amount := new(big.Int)
+	for _, l := range receipt.Logs {
+		if !strings.EqualFold(l.Address, p.token) || len(l.Topics) != 3 || l.Topics[0] != erc20TransferTopic || len(strings.TrimPrefix(l.Topics[1], "0x")) != 64 || len(strings.TrimPrefix(l.Topics[2], "0x")) != 64 {
+			continue
+		}
+		if topicAddress(l.Topics[1]) != p.receiver || topicAddress(l.Topics[2]) != strings.ToLower(p.policy.To) {
+			continue
+		}
+		if v, err := units.ParseHex(l.Data); err == nil {
+			amount.Add(amount, v)
+		}
+	}
+	if amount.Sign() == 0 {
+		return Sweep{}, fmt.Errorf("transaction %s moved no %s from %s to %s", txHash, p.asset, p.receiver, p.policy.To)
+	}
+	block, _ := units.ParseHex(receipt.BlockNumber)
+
+	now := p.clock.Now().Unix()
+	s := Sweep{
+		TxHash:  strings.ToLower(txHash),
+		Amount:  units.Format(amount, p.decimals),
+		Asset:   p.asset,
+		To:      strings.ToLower(p.policy.To),
+		SweptAt: now,
+	}
+	if block != nil {
+		s.Block = block.Int64()
+	}
+	s.Payments, s.RevenueUSD = p.unswept(now)
+
+	line, _ := json.Marshal(s)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return s, err
+	}
+	p.sweeps = append(p.sweeps, s)
+	p.due = false
+	log.Printf("🏦 Sweep recorded: tx=%s amount=%s %s payments=%d", s.TxHash, s.Amount, s.Asset, s.Payments)
+	return s, nil
+}
+
+// handleAdminPayouts serves /admin/payouts. GET returns the current sweep
+// plan, with the unsigned transfer to sign, and the recorded sweeps. POST
+// {"tx_hash": "0x..."} records a sent sweep once it is mined.
+func (p *Payouts) handleAdminPayouts(w http.ResponseWriter, r *http.Request) {
+	if p == nil {
+		http.Error(w, `{"error":"Payouts are disabled: set PAYOUT_ADDRESS"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		resp := map[string]interface{}{"sweeps": p.Sweeps()}
+		if plan, err := p.Plan(); err != nil {
+			resp["error"] = err.Error()
+		} else {
+			resp["plan"] = plan
+		}
+		json.NewEncoder(w).Encode(resp)
+	case http.MethodPost:
+		var req struct {
+			TxHash string `json:"tx_hash"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.TxHash) != 66 || !strings.HasPrefix(req.TxHash, "0x") {
+			http.Error(w, `{"error":"tx_hash must be a 0x-prefixed transaction hash"}`, http.StatusBadRequest)
+			return
+		}
+		s, err := p.Record(req.TxHash)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(s)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
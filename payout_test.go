@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestPayouts(t *testing.T) {
+	up := testhttp.New(t)
+	dir := t.TempDir()
+	ledger, err := NewLedger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+
+	const receiver = "0x120e011fb8a12bfcb61e5c1d751c26a5d33aae91"
+	const cold = "0x00000000000000000000000000000000000000c0"
+	token := payoutTokens["base:USDC"]
+	for range 2 {
+		ledger.Record(LedgerEntry{Receiver: receiver, Amount: "0.001", Asset: "USDC", AmountUSD: 0.001, CreatedAt: fake.Now().Unix() - 10})
+	}
+	ledger.Record(LedgerEntry{Receiver: receiver, Amount: "0", Asset: "USDC", Coupon: "cpn_1", CreatedAt: fake.Now().Unix() - 10})
+
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: receiver}
+	open := func() *Payouts {
+		p, err := NewPayouts(dir, up.RPC.URL, token, "8453", config, PayoutPolicy{To: cold, MinAmount: 100, MaxGasGwei: 10}, ledger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.clock = fake
+		return p
+	}
+	p := open()
+	word := func(hex string) string { return fmt.Sprintf("%064s", strings.TrimPrefix(hex, "0x")) }
+	up.SetRPCResult("eth_call", "0x"+word("8f0d180")) // 150 USDC
+	up.SetRPCResult("eth_getTransactionCount", "0x5")
+
+	// The default gas price of 20 gwei is over the ceiling
+	plan, err := p.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Due || plan.Reason != "gas price above the ceiling" || plan.Balance != "150" || plan.Payments != 2 {
+		t.Errorf("plan at 20 gwei = %+v", plan)
+	}
+
+	up.SetRPCResult("eth_gasPrice", "0x3b9aca00") // 1 gwei
+	plan, err = p.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := plan.Tx
+	if !plan.Due || tx == nil || tx.To != strings.ToLower(token) || tx.Nonce != "0x5" || tx.Gas != "0x5208" ||
+		tx.Data != "0x"+selectorTransfer+word(cold)+word("8f0d180") {
+		t.Fatalf("plan at 1 gwei = %+v %+v", plan, tx)
+	}
+	p.Check()
+	if !p.due {
+		t.Error("due sweep not announced")
+	}
+
+	receipt := func(to string) map[string]interface{} {
+		return map[string]interface{}{
+			"status":      "0x1",
+			"blockNumber": "0x10",
+			"logs": []map[string]interface{}{{
+				"address": token,
+				"topics":  []string{erc20TransferTopic, "0x" + word(receiver), "0x" + word(to)},
+				"data":    "0x" + word("8f0d180"),
+			}},
+		}
+	}
+	hash := "0x" + strings.Repeat("ab", 32)
+	up.SetRPCResult("eth_getTransactionReceipt", receipt("0x00000000000000000000000000000000000000ee"))
+	if _, err := p.Record(hash); err == nil {
+		t.Error("transfer to another address recorded as a sweep")
+	}
+	up.SetRPCResult("eth_getTransactionReceipt", receipt(cold))
+	sweep, err := p.Record(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sweep.Amount != "150" || sweep.Block != 16 || sweep.Payments != 2 || sweep.RevenueUSD != 0.002 {
+		t.Errorf("sweep = %+v", sweep)
+	}
+	if _, err := p.Record(hash); err == nil {
+		t.Error("sweep recorded twice")
+	}
+
+	// Sweeps survive a restart and settle the payments before them
+	fake.Advance(time.Minute)
+	p = open()
+	if sweeps := p.Sweeps(); len(sweeps) != 1 || sweeps[0].TxHash != hash {
+		t.Errorf("sweeps after reopening = %+v", sweeps)
+	}
+	if plan, err := p.Plan(); err != nil || plan.Payments != 0 {
+		t.Errorf("plan after the sweep = %+v, %v", plan, err)
+	}
+}
@@ -0,0 +1,1042 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/trace"
+)
+
+// Payer identifies who paid for a request
+type Payer struct {
+	Address string `json:"address"` // canonical lowercase identity
+	Source  string `json:"source"`  // "signer" or "sub"
+}
+
+// String returns the payer identity for logs and metric labels
+func (p Payer) String() string {
+	if p.Address == "" {
+		return "anonymous"
+	}
+	return p.Address
+}
+
+type contextKey string
+
+const payerContextKey contextKey = "x402.payer"
+
+// withPayer attaches the payer identity to a request context
+func withPayer(ctx context.Context, payer Payer) context.Context {
+	return context.WithValue(ctx, payerContextKey, payer)
+}
+
+// PayerFromContext returns the payer attached by the paywall, if any
+func PayerFromContext(ctx context.Context) (Payer, bool) {
+	payer, ok := ctx.Value(payerContextKey).(Payer)
+	return payer, ok
+}
+
+// payerLabel returns the payer of r for log lines
+func payerLabel(r *http.Request) string {
+	payer, _ := PayerFromContext(r.Context())
+	return payer.String()
+}
+
+// payerFromClaims derives the canonical payer identity from validated claims.
+// A recovered signer takes precedence over the sub claim.
+func payerFromClaims(claims *PaymentToken, signer string) Payer {
+	if signer != "" {
+		return Payer{Address: strings.ToLower(signer), Source: "signer"}
+	}
+	if claims != nil && claims.Subject != "" {
+		return Payer{Address: strings.ToLower(strings.TrimSpace(claims.Subject)), Source: "sub"}
+	}
+	return Payer{}
+}
+
+// Paywall enforces x402 payment in front of paid handlers
+type Paywall struct {
+	config  ServiceConfig
+	metrics *Metrics
+	ledger  *Ledger
+	sandbox SandboxPolicy
+	chaos   *ChaosInjector
+	pricing *PriceConverter
+	peg     *PegMonitor
+	assets  []*PriceConverter // the other assets payments are accepted in
+	events  *EventBus
+	limiter ratelimit.Limiter
+	coupons *Coupons
+	credits *Credits // nil unless DEGRADED_MODE is credit
+	account *Accounts
+	refer   *Referrals
+	anomaly *AnomalyDetector
+	abuse   *Abuse
+	clock   clock.Clock
+
+	accounting     string          // currency payments are valued in besides USD
+	signedRequests map[string]bool // endpoints that refuse unsigned requests
+	shedder        *LoadShedder
+	strict         *StrictPayments     // nil unless STRICT_PAYMENTS is on
+	diagnostics    bool                // 402s for refused tokens list the failed checks
+	settlement     *SettlementVerifier // nil unless SETTLEMENT_VERIFY is on
+	facilitator    *FacilitatorClient  // nil unless FACILITATOR_URL is set
+	outbox         *Outbox             // retries settlements the facilitator failed
+	experiments    *Experiments
+	routes         routeTable // every protected route, for /api/pricing
+
+	failMu   sync.Mutex
+	failures []PaymentFailure // newest last, at most maxPaymentFailures
+}
+
+// maxPaymentFailures is how many recent payment failures the paywall keeps
+// for the operator dashboard
+const maxPaymentFailures = 50
+
+// PaymentFailure is a paid request that could not be charged
+type PaymentFailure struct {
+	At       int64  `json:"at"`
+	Endpoint string `json:"endpoint"`
+	Tenant   string `json:"tenant"`
+	Payer    string `json:"payer,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// recordFailure remembers a failed payment
+func (p *Paywall) recordFailure(ctx context.Context, endpoint, payer, reason string) {
+	p.failMu.Lock()
+	defer p.failMu.Unlock()
+	p.failures = append(p.failures, PaymentFailure{
+		At:       p.clock.Now().Unix(),
+		Endpoint: endpoint,
+		Tenant:   tenantID(ctx),
+		Payer:    payer,
+		Reason:   reason,
+	})
+	if len(p.failures) > maxPaymentFailures {
+		p.failures = p.failures[len(p.failures)-maxPaymentFailures:]
+	}
+}
+
+// Failures returns the recent payment failures, newest first
+func (p *Paywall) Failures() []PaymentFailure {
+	p.failMu.Lock()
+	defer p.failMu.Unlock()
+	out := make([]PaymentFailure, len(p.failures))
+	for i, f := range p.failures {
+		out[len(p.failures)-1-i] = f
+	}
+	return out
+}
+
+// NewPaywall creates a paywall for the given service config. Captured
+// payments are written to ledger unless it is nil.
+func NewPaywall(config ServiceConfig, metrics *Metrics, ledger *Ledger) *Paywall {
+	pricing, _ := NewPriceConverter(config.Asset, "")
+	p := &Paywall{
+		config:  config,
+		metrics: metrics,
+		ledger:  ledger,
+		sandbox: SandboxPolicy{Mode: SandboxOff, Network: defaultSandboxNetwork},
+		pricing: pricing,
+		clock:   clock.System,
+	}
+	p.SetEvents(NewEventBus())
+	return p
+}
+
+// SetEvents publishes captured payments on bus as payment.verified, and
+// those the facilitator settled as payment.settled, subscribing the
+// paywall's metrics and ledger
+func (p *Paywall) SetEvents(bus *EventBus) {
+	p.events = bus
+	bus.Subscribe(EventPaymentVerified, "metrics", p.metrics.onPaymentVerified)
+	bus.Subscribe(EventPaymentVerified, "ledger", p.ledger.onPaymentVerified)
+	bus.Subscribe(EventPaymentSettled, "ledger", p.ledger.onPaymentSettled)
+}
+
+// SetStrictPayments checks the aud claim and the network of every token,
+// and requires challenge nonces. nil turns it off.
+func (p *Paywall) SetStrictPayments(strict *StrictPayments) {
+	p.strict = strict
+}
+
+// SetPaymentDiagnostics lists the checks a refused token failed in the 402
+// response, so integrators can see what is wrong with the tokens they build
+func (p *Paywall) SetPaymentDiagnostics(on bool) {
+	p.diagnostics = on
+}
+
+// SetSettlement only accepts payments backed by a confirmed on-chain
+// transfer. nil turns it off.
+func (p *Paywall) SetSettlement(v *SettlementVerifier) {
+	p.settlement = v
+}
+
+// SetSandbox sets which test payments the paywall accepts
+func (p *Paywall) SetSandbox(policy SandboxPolicy) {
+	p.sandbox = policy
+}
+
+// SetFacilitator verifies and settles exact payments through f
+func (p *Paywall) SetFacilitator(f *FacilitatorClient) {
+	p.facilitator = f
+}
+
+// SetOutbox queues facilitated payments the facilitator could not settle
+// at capture in o, settled again under policy
+func (p *Paywall) SetOutbox(o *Outbox, policy RetryPolicy) {
+	p.outbox = o
+	o.Register(DeliverySettlement, policy, p.deliverSettlement)
+}
+
+// SetChaos attaches a fault injector to paid requests
+func (p *Paywall) SetChaos(chaos *ChaosInjector) {
+	p.chaos = chaos
+}
+
+// SetPricing sets how fiat prices are converted into the payment asset
+func (p *Paywall) SetPricing(pricing *PriceConverter) {
+	p.pricing = pricing
+}
+
+// SetAssets accepts payments in more assets besides the deployment's, each
+// priced by its converter
+func (p *Paywall) SetAssets(assets []*PriceConverter) {
+	p.assets = assets
+}
+
+// converter returns the converter that prices asset, nil if none does
+func (p *Paywall) converter(asset string) *PriceConverter {
+	if asset == p.config.Asset {
+		return p.pricing
+	}
+	for _, c := range p.assets {
+		if c.asset == asset {
+			return c
+		}
+	}
+	return nil
+}
+
+// SetPegMonitor refuses payments in assets the monitor has paused
+func (p *Paywall) SetPegMonitor(peg *PegMonitor) {
+	p.peg = peg
+}
+
+// SetLoadShedder ranks paid endpoints by price for shedding under load.
+// Call before routes are protected.
+func (p *Paywall) SetLoadShedder(shedder *LoadShedder) {
+	p.shedder = shedder
+}
+
+// SetSignedRequests makes endpoints refuse paid requests that are not
+// signed by the payer. Any paid request may be signed.
+func (p *Paywall) SetSignedRequests(endpoints []string) {
+	p.signedRequests = make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		p.signedRequests[endpoint] = true
+	}
+}
+
+// SetRateLimit limits how often each payer may call paid endpoints.
+// Requests over the limit are refused with 429 and not charged.
+func (p *Paywall) SetRateLimit(limiter ratelimit.Limiter) {
+	p.limiter = limiter
+}
+
+// SetCoupons accepts coupon codes in X-Coupon alongside or instead of
+// payment
+func (p *Paywall) SetCoupons(coupons *Coupons) {
+	p.coupons = coupons
+}
+
+// SetCredits refunds calls served from fallback data with a credit for the
+// payer's next call to the endpoint
+func (p *Paywall) SetCredits(credits *Credits) {
+	p.credits = credits
+}
+
+// SetAccounts lets payers pay for calls from a prepaid balance
+func (p *Paywall) SetAccounts(accounts *Accounts) {
+	p.account = accounts
+}
+
+// SetReferrals records a revenue share for payments naming a registered
+// ERC-8004 agent as referrer
+func (p *Paywall) SetReferrals(r *Referrals) {
+	p.refer = r
+}
+
+// SetAnomalyDetector reports refused payments to d
+func (p *Paywall) SetAnomalyDetector(d *AnomalyDetector) {
+	p.anomaly = d
+}
+
+// SetExperiments counts the challenges quoting each price variant in e
+func (p *Paywall) SetExperiments(e *Experiments) {
+	p.experiments = e
+}
+
+// SetAbuse gives sources marked as scanners by a's decoy endpoints its
+// smaller allowance on paid endpoints
+func (p *Paywall) SetAbuse(a *Abuse) {
+	p.abuse = a
+}
+
+// SetClock replaces the time source used for payment timestamps and
+// response times. Tests pass a *clock.Fake.
+func (p *Paywall) SetClock(c clock.Clock) {
+	p.clock = c
+}
+
+// quote is the price and receiver a request must pay
+type quote struct {
+	endpoint    string
+	description string
+	lang        string // language of description, if it was localized
+	price       string // asset amount
+	minPrice    string // accepted range, equal to price unless converted
+	maxPrice    string
+	fiat        string // the fiat price the amount was converted from, if any
+	priceUSD    float64
+	asset       string       // the asset price is in
+	others      []assetPrice // the price in the other accepted assets
+	receiver    string
+	networks    []acceptedNetwork // every network q can be paid on, the deployment's first
+	coupon      *Coupon           // applied to the price, if any
+	binding     *requestBinding   // the request body and signer the payment must match
+	experiment  string            // the price experiment q was priced by, if any
+	variant     string
+}
+
+// assetPrice is a quote's price in one of the other accepted assets
+type assetPrice struct {
+	asset    string
+	price    string
+	minPrice string
+	maxPrice string
+	fiat     string
+}
+
+// quote resolves the price for endpoint in ctx. Price overrides from the
+// runtime config take effect on reload, and a tenant's own receiver and
+// prices win over the deployment's. The deployment's network is always
+// accepted, and the configured payment networks for endpoint besides it.
+// A price experiment on endpoint quotes the deployment's own callers the
+// price of the variant their address is assigned. Fiat prices are
+// converted into the payment asset; that fails only if no recent exchange
+// rate is available. The other accepted assets are priced alongside it.
+func (p *Paywall) quote(ctx context.Context, endpoint, price string, priceUSD float64, description string) (quote, error) {
+	cfg := runtimeConfig.Current()
+	q := quote{endpoint: endpoint, description: description, price: price, priceUSD: priceUSD, asset: p.config.Asset, receiver: p.config.Receiver}
+	if override, usd, ok := cfg.Price(endpoint); ok {
+		q.price, q.priceUSD = override, usd
+	}
+	tenant := TenantFromContext(ctx)
+	if exp, ok := cfg.PriceExperiment(endpoint); ok && tenant == nil {
+		v := exp.assign(clientFromContext(ctx))
+		q.price, q.experiment, q.variant = v.Price, exp.Name, v.Name
+		q.priceUSD, _ = strconv.ParseFloat(v.Price, 64)
+	}
+	if tenant != nil {
+		q.receiver = tenant.Receiver
+		if override, usd, ok := tenant.Price(endpoint); ok {
+			q.price, q.priceUSD = override, usd
+		}
+	}
+	q.networks = cfg.acceptedNetworks(endpoint, p.config.Network, q.receiver, tenant != nil)
+	q.receiver = q.networks[0].receiver
+	q.others = p.priceOthers(q.price)
+	return q, p.convert(&q)
+}
+
+// priceOthers prices price in the other accepted assets. An asset that is
+// paused or has no recent exchange rate is left out until it recovers.
+func (p *Paywall) priceOthers(price string) []assetPrice {
+	var out []assetPrice
+	for _, c := range p.assets {
+		if p.peg.Paused(c.asset) {
+			continue
+		}
+		other := assetPrice{asset: c.asset, price: price, minPrice: price, maxPrice: price}
+		fiat, ok, err := c.fiatPrice(price)
+		if err != nil {
+			continue
+		}
+		if ok {
+			conv, err := c.Convert(fiat)
+			if err != nil {
+				log.Printf("⚠️  Not quoting %s: %v", c.asset, err)
+				continue
+			}
+			other.price, other.minPrice, other.maxPrice, other.fiat = conv.Amount, conv.Min, conv.Max, fiat.String()
+		}
+		out = append(out, other)
+	}
+	return out
+}
+
+// on returns q as paid on network in asset, to that network's receiver and
+// at that asset's price. A network or asset q cannot be paid in leaves it
+// as it is.
+func (q quote) on(network, asset string) quote {
+	for _, n := range q.networks {
+		if strings.EqualFold(n.network, network) {
+			q.receiver = n.receiver
+			break
+		}
+	}
+	for _, other := range q.others {
+		if other.asset == asset {
+			q.asset, q.price, q.minPrice, q.maxPrice, q.fiat = other.asset, other.price, other.minPrice, other.maxPrice, other.fiat
+			break
+		}
+	}
+	return q
+}
+
+// exactAsset returns the asset of an exact payment on network: the first
+// asset q can be paid in that has transfer authorizations there
+func (q quote) exactAsset(network string) string {
+	if _, ok := exactDomains[network+":"+q.asset]; ok {
+		return q.asset
+	}
+	for _, other := range q.others {
+		if _, ok := exactDomains[network+":"+other.asset]; ok {
+			return other.asset
+		}
+	}
+	return q.asset
+}
+
+// accepts reports whether q can be paid on network
+func (q quote) accepts(network string) bool {
+	for _, n := range q.networks {
+		if strings.EqualFold(n.network, network) {
+			return true
+		}
+	}
+	return false
+}
+
+// convert replaces a fiat price in q with the asset amount it is worth now
+func (p *Paywall) convert(q *quote) error {
+	q.minPrice, q.maxPrice = q.price, q.price
+	if p.peg.Paused(p.config.Asset) {
+		return fmt.Errorf("%s: %w", p.config.Asset, errAssetPaused)
+	}
+	if p.pricing == nil {
+		if _, ok, _ := parseFiatPrice(q.price); ok {
+			return fmt.Errorf("fiat price %s: %s has no conversion", q.price, p.config.Asset)
+		}
+		return nil
+	}
+	fiat, ok, err := p.pricing.fiatPrice(q.price)
+	if err != nil || !ok {
+		return err
+	}
+	conv, err := p.pricing.Convert(fiat)
+	if err != nil {
+		return err
+	}
+	q.price, q.minPrice, q.maxPrice = conv.Amount, conv.Min, conv.Max
+	q.fiat, q.priceUSD = fiat.String(), conv.USD
+	return nil
+}
+
+// priceUSD values a configured price in USD as it would be quoted: fiat
+// prices through the price converter, plain asset amounts at face value
+func (p *Paywall) priceUSD(price string) (float64, error) {
+	if err := validatePrice(price); err != nil {
+		return 0, err
+	}
+	fiat, ok, err := parseFiatPrice(price)
+	if p.pricing != nil {
+		fiat, ok, err = p.pricing.fiatPrice(price)
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case !ok:
+		return strconv.ParseFloat(price, 64)
+	case p.pricing != nil:
+		conv, err := p.pricing.Convert(fiat)
+		return conv.USD, err
+	case fiat.Currency == "usd":
+		return fiat.Amount, nil
+	}
+	return 0, fmt.Errorf("fiat price %s: %s has no conversion", price, p.config.Asset)
+}
+
+// discount applies coupon to q. A free coupon leaves the price as it is,
+// since no payment is asked for.
+func (p *Paywall) discount(q quote, coupon *Coupon) quote {
+	q.coupon = coupon
+	if coupon.free() {
+		return q
+	}
+	keep := 1 - float64(coupon.DiscountPct)/100
+	scale := func(asset, amount string) string {
+		v, _ := strconv.ParseFloat(amount, 64)
+		return p.formatAmount(asset, v*keep)
+	}
+	q.price, q.minPrice, q.maxPrice = scale(q.asset, q.price), scale(q.asset, q.minPrice), scale(q.asset, q.maxPrice)
+	q.others = slices.Clone(q.others)
+	for i := range q.others {
+		o := &q.others[i]
+		o.price, o.minPrice, o.maxPrice = scale(o.asset, o.price), scale(o.asset, o.minPrice), scale(o.asset, o.maxPrice)
+	}
+	q.priceUSD = round(q.priceUSD*keep, 6)
+	return q
+}
+
+// formatAmount formats v in asset, to its decimals if known
+func (p *Paywall) formatAmount(asset string, v float64) string {
+	c := p.converter(asset)
+	if c == nil {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return c.format(v)
+}
+
+// redeemFree returns a context carrying a zero charge for a call paid for
+// entirely by q's coupon
+func (p *Paywall) redeemFree(ctx context.Context, q quote) (context.Context, Payer) {
+	payer := Payer{Address: "coupon:" + q.coupon.ID, Source: "coupon"}
+	c := &charge{id: newPaymentID(), amount: "0", asset: q.asset, fiat: q.fiat, receiver: q.receiver, fraction: 1}
+	trace.FromContext(ctx).SetAttr("payment.id", c.id)
+	return withCharge(withPayer(ctx, payer), c), payer
+}
+
+// requirements are the x402 payment requirements advertised for q, one per
+// network and asset it can be paid in with the deployment's first. They
+// share one challenge nonce, as any of them pays for the request.
+func (p *Paywall) requirements(q quote) []PaymentRequirement {
+	nonce, expires := p.issueNonce(q)
+	reqs := p.offers(q)
+	for i := range reqs {
+		reqs[i].Nonce, reqs[i].NonceExpiresAt = nonce, expires
+	}
+	return reqs
+}
+
+// offers are q's payment requirements without a challenge nonce. The
+// deployment's asset is offered on every network, the other assets on the
+// networks they can be paid on.
+func (p *Paywall) offers(q quote) []PaymentRequirement {
+	prices := append([]assetPrice{{asset: q.asset, price: q.price, minPrice: q.minPrice, maxPrice: q.maxPrice, fiat: q.fiat}}, q.others...)
+	var reqs []PaymentRequirement
+	for _, n := range q.networks {
+		for i, price := range prices {
+			contract, ok := assetOn(n.network, price.asset)
+			if i > 0 && !ok {
+				continue
+			}
+			req := PaymentRequirement{
+				Scheme:       "x402",
+				Network:      n.network,
+				MaxAmount:    price.price,
+				MinAmount:    price.minPrice,
+				Asset:        price.asset,
+				Receiver:     n.receiver,
+				Description:  q.description,
+				FiatPrice:    price.fiat,
+				AssetAddress: contract,
+				Resource:     q.endpoint,
+			}
+			if p.strict != nil {
+				req.Audience = p.strict.Audience
+			}
+			if p.signedRequests[q.endpoint] {
+				req.RequestSignature = "required"
+			}
+			if p.settlement != nil {
+				req.Settlement, req.Confirmations = "onchain", p.settlement.confirmations
+			}
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// verify validates a payment against q and returns a context carrying the
+// payer and a fresh charge, marked as sandbox for test payments. token is
+// a JWT, or for the exact scheme an X-PAYMENT payload. A refused payment
+// returns every check it failed. Its nonce is only used up once every
+// other check has passed, and its settlement transaction last. The token,
+// authorization and transaction it spends are given back by the charge's
+// release unless the request captures the payment.
+func (p *Paywall) verify(ctx context.Context, scheme, token string, q quote) (context.Context, Payer, []CheckFailure) {
+	_, span := tracer.Start(ctx, "x402.verify")
+	defer span.End()
+	span.SetAttr("payment.scheme", scheme)
+
+	var claims *PaymentToken
+	var auth *ExactPayload
+	var facilitated *facilitatorRequest
+	var spends []*paymentClaim
+	var failed []CheckFailure
+	signer := ""
+	// The payment must go to the receiver on the network it was made on,
+	// at the price in the asset it was made in. The nonce was issued for q
+	// as challenged.
+	network, asset := claimedPayment(scheme, token)
+	if scheme == SchemeExact {
+		asset = q.exactAsset(network)
+	}
+	paid := q.on(network, asset)
+	if scheme == SchemeExact {
+		claims, auth, failed = checkExactPayment(token, paid.minPrice, paid.maxPrice, paid.asset, paid.receiver, p.clock.Now())
+		if claims != nil {
+			signer = claims.Subject
+		}
+		if auth != nil && p.facilitator != nil {
+			failed, facilitated = p.facilitator.check(ctx, claims, auth, paid, paid.asset, failed)
+		}
+	} else {
+		claims, failed = checkToken(token, paid.minPrice, paid.maxPrice, paid.asset, paid.receiver, paymentKeys, p.strict, p.clock.Now())
+	}
+	payer := payerFromClaims(claims, signer)
+	sandbox := false
+	if claims != nil {
+		if err := q.binding.check(claims); err != nil {
+			failed = append(failed, CheckFailure{CheckBinding, err.Error()})
+		} else if bound := q.binding.signerAddress(); bound != "" {
+			payer = payerFromClaims(claims, bound)
+		}
+		// Exact payments are authorizations of a transfer, which name no route
+		if scheme != SchemeExact {
+			failed = append(failed, checkRoute(claims, q.endpoint, q.binding, p.strict)...)
+		}
+		var err error
+		if sandbox, err = p.checkNetwork(claims.Payment.Network, q); err != nil {
+			failed = append(failed, CheckFailure{CheckNetwork, err.Error()})
+		}
+		// Sandbox payments are test payments and are not settled. Exact
+		// payments are settled by the facilitator, or by the receiver
+		// submitting the authorization.
+		settle := p.settlement != nil && !sandbox && auth == nil
+		if len(failed) == 0 && settle {
+			if err := p.settlement.check(claims, paid.asset, paid.receiver); err != nil {
+				failed = append(failed, CheckFailure{CheckSettlement, err.Error()})
+			}
+		}
+		// The token or authorization is claimed before anything else is
+		// spent, so the loser of a race between requests presenting it is
+		// refused as a replay without using up the nonce
+		if len(failed) == 0 {
+			var claim *paymentClaim
+			var err error
+			if auth != nil {
+				claim, err = claimAuthorization(auth, p.clock.Now())
+			} else {
+				claim, err = claimTokenID(token, claims, p.clock.Now())
+			}
+			if err != nil {
+				failed = append(failed, CheckFailure{CheckReplay, err.Error()})
+			}
+			spends = append(spends, claim)
+		}
+		if len(failed) == 0 || claims.Payment.Nonce == "" {
+			if err := p.consumeNonce(claims.Payment.Nonce, q); err != nil {
+				failed = append(failed, CheckFailure{CheckNonce, err.Error()})
+			}
+		}
+		if len(failed) == 0 && settle {
+			claim, err := p.settlement.claim(claims.Payment.TxHash)
+			if err != nil {
+				failed = append(failed, CheckFailure{CheckSettlement, err.Error()})
+			}
+			spends = append(spends, claim)
+		}
+		if len(failed) > 0 {
+			for _, claim := range spends {
+				claim.release()
+			}
+		}
+	}
+	if len(failed) > 0 {
+		for _, f := range failed {
+			log.Printf("Payment rejected on %s: %s", q.endpoint, f)
+		}
+		reason := rejectionReason(failed)
+		span.SetError(reason)
+		p.recordFailure(ctx, q.endpoint, payer.String(), reason)
+		p.anomaly.Rejected(token, paid.minPrice)
+		return ctx, Payer{}, failed
+	}
+
+	c := &charge{id: newPaymentID(), amount: claims.Payment.Amount, asset: paid.asset, fiat: paid.fiat, network: claims.Payment.Network, receiver: paid.receiver, referrer: claims.Payment.Referrer, authorization: auth, facilitated: facilitated, spends: spends, fraction: 1}
+	if p.settlement != nil && !sandbox && auth == nil {
+		c.txHash = strings.ToLower(claims.Payment.TxHash)
+		span.SetAttr("payment.tx_hash", c.txHash)
+	}
+	span.SetAttr("payment.id", c.id)
+	span.SetAttr("payment.network", claims.Payment.Network)
+	span.SetAttr("payer", payer.String())
+	trace.FromContext(ctx).SetAttr("payment.id", c.id)
+	ctx = withCharge(withPayer(ctx, payer), c)
+	if sandbox {
+		ctx = withSandbox(ctx)
+	}
+	return ctx, payer, nil
+}
+
+// checkNetwork reports whether a payment for q on network is a sandbox
+// payment, or why it is refused. Strict mode refuses any network q cannot
+// be paid on other than an accepted sandbox network.
+func (p *Paywall) checkNetwork(network string, q quote) (sandbox bool, err error) {
+	sandbox, ok := p.sandbox.classify(network)
+	if !ok {
+		return false, errors.New("sandbox token rejected")
+	}
+	if p.strict != nil && !q.accepts(network) && !(sandbox && strings.EqualFold(network, p.sandbox.Network)) {
+		names := make([]string, len(q.networks))
+		for i, n := range q.networks {
+			names[i] = n.network
+		}
+		return false, fmt.Errorf("got %q, want %s", network, strings.Join(names, " or "))
+	}
+	return sandbox, nil
+}
+
+// capture records a verified payment once the handler has run, scaled by any
+// discount it applied and skipped entirely if it refused capture
+func (p *Paywall) capture(ctx context.Context, q quote, payer Payer) {
+	ctx, span := tracer.Start(ctx, "x402.capture")
+	defer span.End()
+
+	c := chargeFromContext(ctx)
+	fraction, ok := c.captured()
+	credit := c.credited()
+	if !ok {
+		span.SetAttr("capture", "refused")
+		p.coupons.release(q.coupon)
+		if credit == CreditRedeemed {
+			p.credits.restore(tenantID(ctx), payer.String(), q.endpoint)
+		}
+		return
+	}
+	if credit != CreditRedeemed {
+		// A call paid for by a credit gives its payment back
+		c.keep()
+		// and a discounted debit the rest of the price
+		if fraction < 1 {
+			c.hold.refund(1 - fraction)
+		}
+	}
+	account := c.accountMovement()
+	if IsSandbox(ctx) {
+		span.SetAttr("capture", "sandbox")
+		log.Printf("🧪 Sandbox payment (not recorded): id=%s tenant=%s endpoint=%s payer=%s amount=%s %s", c.id, tenantID(ctx), q.endpoint, payer, c.amount, c.asset)
+		return
+	}
+	span.SetAttr("capture", strconv.FormatFloat(fraction, 'f', 2, 64))
+	log.Printf("💳 Payment accepted: id=%s tenant=%s endpoint=%s payer=%s amount=%s %s charge=%.2f", c.id, tenantID(ctx), q.endpoint, payer, c.amount, c.asset, fraction)
+	entry := LedgerEntry{
+		ID:            c.id,
+		Tenant:        tenantID(ctx),
+		Endpoint:      q.endpoint,
+		Payer:         payer.String(),
+		Receiver:      c.receiver,
+		Network:       c.network,
+		Amount:        c.amount,
+		Asset:         c.asset,
+		AmountUSD:     q.priceUSD * fraction,
+		FiatPrice:     c.fiat,
+		Credit:        credit,
+		Account:       account,
+		Coupon:        couponID(q.coupon),
+		Experiment:    q.experiment,
+		Variant:       q.variant,
+		TxHash:        c.txHash,
+		Authorization: c.authorization,
+		CreatedAt:     p.clock.Now().Unix(),
+		TraceID:       span.Context.TraceID.String(),
+	}
+	// A deposit is revenue once it is spent, so it is the debits that
+	// carry the price
+	if credit == CreditRedeemed || account == AccountDeposit {
+		entry.AmountUSD = 0
+	}
+	if account == AccountDebit && credit != CreditRedeemed {
+		p.account.count(AccountDebit)
+	}
+	if owner, share, ok := p.refer.lookup(c.referrer, payer.String()); ok {
+		amount, _ := strconv.ParseFloat(c.amount, 64)
+		entry.Referrer, entry.ReferrerAddress = c.referrer, owner
+		entry.ReferralAmount = p.formatAmount(c.asset, amount*fraction*share)
+		entry.ReferralUSD = round(entry.AmountUSD*share, 6)
+		span.SetAttr("referrer", c.referrer)
+	}
+	if c.facilitated != nil {
+		// The authorization stays in the ledger for the receiver to submit
+		// if the facilitator cannot settle it
+		if txHash, err := p.facilitator.settle(ctx, c.facilitated); err != nil {
+			log.Printf("⚠️  Facilitator settle failed for %s: %v", c.id, err)
+			p.recordFailure(ctx, q.endpoint, payer.String(), "facilitator settle failed: "+err.Error())
+			if p.outbox != nil {
+				if _, err := p.outbox.Enqueue(DeliverySettlement, settlementDelivery{Tenant: entry.Tenant, PaymentID: c.id, Request: c.facilitated}); err != nil {
+					log.Printf("⚠️  Settlement of %s not queued: %v", c.id, err)
+				}
+			}
+		} else if txHash != "" {
+			// A facilitator that settles asynchronously answers without
+			// the transaction and calls back once it is mined
+			entry.Status = PaymentSettled
+			entry.TxHash = txHash
+			span.SetAttr("payment.tx_hash", txHash)
+		}
+	}
+	p.value(&entry)
+
+	// Metrics, the ledger, anomaly counts and notifications subscribe
+	if err := p.events.Publish(ctx, EventPaymentVerified, VerifiedPayment{Entry: entry}); err != nil {
+		p.recordFailure(ctx, q.endpoint, payer.String(), err.Error())
+		return
+	}
+	if entry.Status == PaymentSettled {
+		if err := p.events.Publish(ctx, EventPaymentSettled, SettledPayment{Entry: entry}); err != nil {
+			p.recordFailure(ctx, q.endpoint, payer.String(), err.Error())
+		}
+	}
+	if credit == CreditGranted {
+		if err := p.credits.grant(entry.Tenant, entry.Payer, q.endpoint); err != nil {
+			p.recordFailure(ctx, q.endpoint, payer.String(), "credit not granted: "+err.Error())
+		}
+	}
+}
+
+// replaceRoutes lists routes in place of the routes under prefix and
+// ranks them for load shedding. Handlers protected with protectPriced call
+// it when the routes they serve change.
+func (p *Paywall) replaceRoutes(prefix string, routes []paidRoute) {
+	prices := make(map[string]float64, len(routes))
+	for _, route := range routes {
+		prices[route.endpoint] = route.priceUSD
+	}
+	p.shedder.replace(prefix, prices)
+	p.routes.replace(prefix, routes)
+}
+
+// Protect wraps next so it only runs after a valid payment of price has been
+// presented. The payer identity is available to next via PayerFromContext.
+// The payment is recorded once next returns, scaled by any discount the
+// handler applied, and skipped entirely if the handler refused capture.
+//
+// Each request is traced as an "x402.payment" span, continuing the caller's
+// traceparent if sent. X-Trace-Id carries the trace ID on every response and
+// X-Payment-Id the ID the payment is recorded under in the ledger.
+//
+// The route is listed in /api/pricing and ranked for load shedding, so
+// Protect is called once per route, as the mux is built.
+func (p *Paywall) Protect(endpoint, price string, priceUSD float64, description string, next http.HandlerFunc) http.HandlerFunc {
+	route := paidRoute{endpoint: endpoint, price: price, priceUSD: priceUSD, description: description}
+	p.shedder.Register(endpoint, priceUSD)
+	p.routes.register(endpoint, price, priceUSD, description)
+	return p.protectPriced(func(*http.Request) paidRoute { return route }, next)
+}
+
+// protectPriced is Protect for handlers whose route is only known per
+// request: a gateway route from the current config, or a GraphQL query
+// priced by its fields. price returns it for r. Nothing is registered;
+// the caller lists the routes it can serve, if any.
+func (p *Paywall) protectPriced(price func(r *http.Request) paidRoute, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route := price(r)
+		endpoint := route.endpoint
+		start := p.clock.Now()
+		ctx, span := tracer.StartServer(r, "x402.payment")
+		defer span.End()
+		w.Header().Set("X-Trace-Id", span.Context.TraceID.String())
+		r = r.WithContext(withClient(ctx, p.abuse.clientIP(r)))
+
+		// HEAD only asks for the price, so it is never charged
+		call := paidCall{route: route, payment: r.Header.Get("X-Payment-Response"), scheme: "x402", coupon: r.Header.Get("X-Coupon"),
+			debitID: r.Header.Get(reqsig.DebitHeader), quoteOnly: r.Method == http.MethodHead, request: r}
+		if exact := r.Header.Get("X-Payment"); call.payment == "" && exact != "" && featureFlags.Enabled(FlagExactScheme) {
+			call.payment, call.scheme = exact, SchemeExact
+		}
+		a := p.admit(r.Context(), call)
+		// Every path below that does not capture gives the payment back
+		defer chargeFromContext(a.ctx).release()
+		if a.rate != nil {
+			ratelimit.SetHeaders(w, *a.rate)
+		}
+		if c := chargeFromContext(a.ctx); c != nil {
+			w.Header().Set("X-Payment-Id", c.id)
+			if IsSandbox(a.ctx) {
+				w.Header().Set("X-Sandbox", "true")
+			}
+		}
+		if a.balance != "" {
+			w.Header().Set("X-Account-Balance", a.balance)
+		}
+		if a.refusal != nil {
+			p.writeRefusal(w, a)
+			p.metrics.RecordRequest(endpoint, strconv.Itoa(a.refusal.status))
+			p.metrics.RecordResponseTime(endpoint, clock.Since(p.clock, start))
+			return
+		}
+		ctx, q, payer := a.ctx, a.q, a.payer
+
+		// Injected faults are not charged, except slow responses
+		fault := p.chaos.pick(r)
+		if fault != "" {
+			span.SetAttr("chaos.fault", fault)
+		}
+		switch fault {
+		case FaultRechallenge:
+			w.Header().Set("X-Chaos-Fault", fault)
+			p.challenge(w, q)
+			p.metrics.RecordRequest(endpoint, "402")
+			return
+		case FaultRateLimit:
+			w.Header().Set("X-Chaos-Fault", fault)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, `{"error":"Rate limit exceeded, payment not captured"}`, http.StatusTooManyRequests)
+			p.metrics.RecordRequest(endpoint, "429")
+			return
+		case FaultSlow:
+			w.Header().Set("X-Chaos-Fault", fault)
+			select {
+			case <-time.After(p.chaos.delay()):
+			case <-r.Context().Done():
+				return
+			}
+		case FaultTruncate:
+			w.Header().Set("X-Chaos-Fault", fault)
+			truncated(w, r.WithContext(ctx), next)
+			return
+		}
+
+		// A credit from an earlier fallback response pays for the call
+		if p.redeemCredit(a) {
+			w.Header().Set("X-Payment-Credit", CreditRedeemed)
+		}
+
+		handlerCtx, handler := tracer.Start(ctx, "x402.handler")
+		c := chargeFromContext(ctx)
+		next(&receiptWriter{ResponseWriter: w, receipt: func() string {
+			if _, ok := c.captured(); !ok {
+				return ""
+			}
+			return p.receipt(c, payer, q.endpoint)
+		}}, r.WithContext(handlerCtx))
+		handler.End()
+		p.routes.observe(endpoint, clock.Since(p.clock, start))
+		p.capture(ctx, q, payer)
+	}
+}
+
+// writeRefusal answers an HTTP call the paywall turned away
+func (p *Paywall) writeRefusal(w http.ResponseWriter, a *admission) {
+	r := a.refusal
+	for name, value := range r.headers {
+		w.Header().Set(name, value)
+	}
+	switch {
+	case len(r.failed) > 0:
+		p.refusePayment(w, a.q, r.failed)
+	case r.challenge:
+		p.challenge(w, a.q)
+	default:
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, r.message), r.status)
+	}
+}
+
+// refusePayment answers a payment that failed checks with a 402 naming why
+func (p *Paywall) refusePayment(w http.ResponseWriter, q quote, failed []CheckFailure) {
+	code := refusalCode(failed)
+	body := map[string]interface{}{
+		"error":   "Invalid or insufficient payment",
+		"code":    code,
+		"version": "x402/1.0",
+	}
+	switch code {
+	case paymentSpentCode, paymentExpiredCode:
+		// Retrying the same payment cannot succeed, so the client
+		// gets a fresh challenge to pay again
+		reqs := p.requirements(q)
+		w.Header().Set("X-Payment-Required", paymentRequiredHeader(reqs[0]))
+		body["error"] = "Payment already spent"
+		if code == paymentExpiredCode {
+			body["error"] = "Payment expired"
+		}
+		body["retry"] = "new_payment"
+		body["payment"] = reqs[0]
+		body["accepts"] = reqs
+	case paymentNotYetValidCode:
+		body["error"] = "Payment not yet valid"
+	}
+	if p.diagnostics {
+		body["checks"] = failed
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPaymentRequired)
+	json.NewEncoder(w).Encode(body)
+}
+
+// challenge writes the 402 response asking for payment of q: payment on
+// the deployment's network, and accepts on every network q can be paid on
+func (p *Paywall) challenge(w http.ResponseWriter, q quote) {
+	reqs := p.requirements(q)
+	w.Header().Set("X-Payment-Required", paymentRequiredHeader(reqs[0]))
+	if q.lang != "" {
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", q.lang)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPaymentRequired)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   "Payment required",
+		"version": "x402/1.0",
+		"payment": reqs[0],
+		"accepts": reqs,
+	})
+}
+
+// paymentRequiredHeader renders req as a structured-field dictionary for
+// X-Payment-Required, so a client can read the price from a HEAD request:
+//
+//	scheme="x402", network="base", maxAmount="0.001", minAmount="0.001", asset="USDC", receiver="0x…"
+//
+// The description is left out as it may be localized beyond ASCII.
+func paymentRequiredHeader(req PaymentRequirement) string {
+	esc := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+	fields := []string{
+		`scheme="` + esc(req.Scheme) + `"`,
+		`network="` + esc(req.Network) + `"`,
+		`maxAmount="` + esc(req.MaxAmount) + `"`,
+		`minAmount="` + esc(req.MinAmount) + `"`,
+		`asset="` + esc(req.Asset) + `"`,
+		`receiver="` + esc(req.Receiver) + `"`,
+	}
+	if req.FiatPrice != "" {
+		fields = append(fields, `fiatPrice="`+esc(req.FiatPrice)+`"`)
+	}
+	if req.Nonce != "" {
+		fields = append(fields, `nonce="`+esc(req.Nonce)+`"`, "nonceExpiresAt="+strconv.FormatInt(req.NonceExpiresAt, 10))
+	}
+	if req.RequestSignature != "" {
+		fields = append(fields, `requestSignature="`+esc(req.RequestSignature)+`"`)
+	}
+	if req.Settlement != "" {
+		fields = append(fields, `settlement="`+esc(req.Settlement)+`"`, "confirmations="+strconv.FormatInt(req.Confirmations, 10))
+	}
+	return strings.Join(fields, ", ")
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/kv"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// errAssetPaused is returned when quoting in an asset whose acceptance the
+// peg monitor has paused
+var errAssetPaused = errors.New("asset is off its peg, payments paused")
+
+// AssetStatus is the peg status of an accepted stablecoin
+type AssetStatus = types.AssetStatus
+
+// DepegAction is what the peg monitor does about a depegged asset
+type DepegAction string
+
+const (
+	DepegOff   DepegAction = "off"   // not monitored
+	DepegFlag  DepegAction = "flag"  // reported in /.well-known/x402 and metrics only
+	DepegPause DepegAction = "pause" // payments in the asset are refused until it recovers
+)
+
+// ParseDepegAction reads a DEPEG_MONITOR value; empty means pause
+func ParseDepegAction(s string) (DepegAction, error) {
+	switch a := DepegAction(strings.ToLower(strings.TrimSpace(s))); a {
+	case "":
+		return DepegPause, nil
+	case DepegOff, DepegFlag, DepegPause:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown depeg action %q (use off, flag or pause)", s)
+}
+
+// PegMonitor watches the USD price of the accepted stablecoins. The leader
+// checks prices and publishes each asset's status to the shared store, and
+// every replica syncs the statuses from there, so all replicas pause and
+// resume an asset together. An asset is depegged once it is more than
+// threshold from one USD, and recovers once it is back within half that.
+type PegMonitor struct {
+	store     kv.Store
+	assets    []string
+	action    DepegAction
+	threshold float64 // fraction of one USD
+	ttl       time.Duration
+	fetch     func(asset string) (float64, error)
+	clock     clock.Clock
+	notify    *Notifier
+
+	mu     sync.RWMutex
+	status map[string]AssetStatus
+}
+
+// NewPegMonitor monitors the pegged assets among assets. Statuses expire
+// from the store after ttl, so a stalled leader cannot pause an asset
+// forever.
+func NewPegMonitor(store kv.Store, assets []string, action DepegAction, threshold float64, ttl time.Duration) *PegMonitor {
+	m := &PegMonitor{
+		store:     store,
+		action:    action,
+		threshold: threshold,
+		ttl:       ttl,
+		fetch:     fetchStablecoinUSD,
+		clock:     clock.System,
+		status:    make(map[string]AssetStatus),
+	}
+	for _, asset := range assets {
+		if paymentAssets[asset].pegged {
+			m.assets = append(m.assets, asset)
+		}
+	}
+	return m
+}
+
+// SetNotifier sends depeg and recovery alerts to the notification channels
+func (m *PegMonitor) SetNotifier(n *Notifier) {
+	m.notify = n
+}
+
+func pegKey(asset string) string { return "peg:" + asset }
+
+// Check fetches each asset's price and publishes its status. Run it on
+// the leader only.
+func (m *PegMonitor) Check() {
+	for _, asset := range m.assets {
+		price, err := m.fetch(asset)
+		if err != nil {
+			// No price is no evidence of a depeg; keep the last status
+			log.Printf("⚠️  Peg check for %s failed: %v", asset, err)
+			continue
+		}
+		m.mu.RLock()
+		previous := m.status[asset]
+		m.mu.RUnlock()
+
+		deviation := math.Abs(price - 1)
+		status := AssetStatus{
+			Asset:     asset,
+			PriceUSD:  price,
+			Depegged:  deviation > m.threshold || previous.Depegged && deviation > m.threshold/2,
+			CheckedAt: m.clock.Now().Unix(),
+		}
+		status.Paused = status.Depegged && m.action == DepegPause
+		if status.Depegged != previous.Depegged {
+			message := fmt.Sprintf("%s is back on its peg at $%.4f", asset, price)
+			if status.Depegged {
+				message = fmt.Sprintf("%s is off its peg at $%.4f (paused=%v)", asset, price, status.Paused)
+				log.Printf("🚨 %s", message)
+			} else {
+				log.Printf("✅ %s", message)
+			}
+			m.notify.Notify(NotifyMonitor, map[string]string{
+				"monitor":   "peg",
+				"asset":     asset,
+				"price_usd": strconv.FormatFloat(price, 'f', 4, 64),
+				"depegged":  strconv.FormatBool(status.Depegged),
+				"paused":    strconv.FormatBool(status.Paused),
+				"message":   message,
+			})
+		}
+
+		data, _ := json.Marshal(status)
+		if err := m.store.Set(pegKey(asset), string(data), m.ttl); err != nil {
+			log.Printf("⚠️  Publishing peg status for %s failed: %v", asset, err)
+		}
+		m.mu.Lock()
+		m.status[asset] = status
+		m.mu.Unlock()
+	}
+}
+
+// Sync loads the statuses published by the leader. Run it on every
+// replica.
+func (m *PegMonitor) Sync() {
+	for _, asset := range m.assets {
+		value, ok, err := m.store.Get(pegKey(asset))
+		if err != nil {
+			log.Printf("⚠️  Reading peg status for %s failed: %v", asset, err)
+			continue
+		}
+		var status AssetStatus
+		if ok {
+			if err := json.Unmarshal([]byte(value), &status); err != nil {
+				continue
+			}
+		}
+		m.mu.Lock()
+		if ok {
+			m.status[asset] = status
+		} else {
+			delete(m.status, asset)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Paused reports whether payments in asset are currently refused
+func (m *PegMonitor) Paused(asset string) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status[asset].Paused
+}
+
+// Statuses returns the last known status of each monitored asset
+func (m *PegMonitor) Statuses() []AssetStatus {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]AssetStatus, 0, len(m.status))
+	for _, status := range m.status {
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Asset < out[j].Asset })
+	return out
+}
+
+// WriteMetrics writes x402_asset_price_usd and x402_asset_paused
+func (m *PegMonitor) WriteMetrics(b *strings.Builder) {
+	statuses := m.Statuses()
+	b.WriteString("# HELP x402_asset_price_usd Last checked USD price of an accepted stablecoin\n")
+	b.WriteString("# TYPE x402_asset_price_usd gauge\n")
+	for _, s := range statuses {
+		fmt.Fprintf(b, "x402_asset_price_usd{asset=%q} %g\n", s.Asset, s.PriceUSD)
+	}
+	b.WriteString("# HELP x402_asset_paused Whether payments in an asset are paused after a depeg\n")
+	b.WriteString("# TYPE x402_asset_paused gauge\n")
+	for _, s := range statuses {
+		paused := 0
+		if s.Paused {
+			paused = 1
+		}
+		fmt.Fprintf(b, "x402_asset_paused{asset=%q} %d\n", s.Asset, paused)
+	}
+}
+
+// fetchStablecoinUSD averages the USD price of a stablecoin from Coinbase
+// and CoinGecko
+func fetchStablecoinUSD(asset string) (float64, error) {
+	var prices []float64
+	if price, err := fetchCoinbaseUSD(asset); err == nil {
+		prices = append(prices, price)
+	}
+	if id, ok := coingeckoIDs[asset]; ok {
+		if price, err := fetchCoinGeckoUSD(id); err == nil {
+			prices = append(prices, price)
+		}
+	}
+	if len(prices) == 0 {
+		return 0, fmt.Errorf("no price for %s from any source", asset)
+	}
+	var sum float64
+	for _, p := range prices {
+		sum += p
+	}
+	return sum / float64(len(prices)), nil
+}
+
+var coingeckoIDs = map[string]string{"USDC": "usd-coin", "USDT": "tether", "DAI": "dai"}
+
+func fetchCoinbaseUSD(asset string) (float64, error) {
+	resp, err := upstreamHTTP.Get("https://api.coinbase.com/v2/exchange-rates?currency=" + asset)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			Rates map[string]string `json:"rates"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	if rate, ok := result.Data.Rates["USD"]; ok {
+		return strconv.ParseFloat(rate, 64)
+	}
+	return 0, fmt.Errorf("rate not found")
+}
+
+func fetchCoinGeckoUSD(id string) (float64, error) {
+	resp, err := upstreamHTTP.Get("https://api.coingecko.com/api/v3/simple/price?ids=" + id + "&vs_currencies=usd")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result map[string]map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	if price, ok := result[id]["usd"]; ok {
+		return price, nil
+	}
+	return 0, fmt.Errorf("price not found")
+}
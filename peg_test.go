@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+	"github.com/arithmosquillsworth/x402-service/pkg/kv"
+)
+
+func TestPegMonitor(t *testing.T) {
+	store := kv.NewMemory()
+	price := 1.0
+	leader := NewPegMonitor(store, []string{"USDC", "ETH"}, DepegPause, 0.02, time.Hour)
+	leader.fetch = func(string) (float64, error) { return price, nil }
+	follower := NewPegMonitor(store, []string{"USDC"}, DepegPause, 0.02, time.Hour)
+
+	check := func(p float64) AssetStatus {
+		t.Helper()
+		price = p
+		leader.Check()
+		follower.Sync()
+		statuses := follower.Statuses()
+		if len(statuses) != 1 || statuses[0].Asset != "USDC" {
+			t.Fatalf("statuses = %+v, want USDC only", statuses)
+		}
+		return statuses[0]
+	}
+
+	if s := check(0.999); s.Depegged || follower.Paused("USDC") {
+		t.Errorf("on peg: %+v", s)
+	}
+	if s := check(0.95); !s.Depegged || !follower.Paused("USDC") || s.PriceUSD != 0.95 {
+		t.Errorf("depegged: %+v", s)
+	}
+	// Recovery needs the price back within half the threshold
+	if s := check(0.985); !s.Depegged {
+		t.Errorf("recovered too early: %+v", s)
+	}
+	if s := check(0.995); s.Depegged || follower.Paused("USDC") {
+		t.Errorf("not recovered: %+v", s)
+	}
+
+	// In flag mode a depeg is reported but payments continue
+	leader.action = DepegFlag
+	if s := check(1.1); !s.Depegged || s.Paused {
+		t.Errorf("flag mode: %+v", s)
+	}
+
+	var b strings.Builder
+	follower.WriteMetrics(&b)
+	if !strings.Contains(b.String(), `x402_asset_price_usd{asset="USDC"} 1.1`) || !strings.Contains(b.String(), `x402_asset_paused{asset="USDC"} 0`) {
+		t.Errorf("metrics:\n%s", b.String())
+	}
+}
+
+func TestPausedAssetRefused(t *testing.T) {
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), nil)
+	peg := NewPegMonitor(kv.NewMemory(), []string{"USDC"}, DepegPause, 0.02, time.Hour)
+	peg.fetch = func(string) (float64, error) { return 0.9, nil }
+	paywall.SetPegMonitor(peg)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", "/api/gas", nil))
+		return rr
+	}
+	if rr := serve(); rr.Code != http.StatusPaymentRequired {
+		t.Fatalf("before the check: %d", rr.Code)
+	}
+	peg.Check()
+	if rr := serve(); rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "off its peg") {
+		t.Errorf("paused asset: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestFetchStablecoinUSD(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+
+	up.SetStablecoinPrice("USDT", 0.97)
+	if price, err := fetchStablecoinUSD("USDT"); err != nil || price != 0.97 {
+		t.Errorf("USDT = %v, %v", price, err)
+	}
+	up.Fail(testhttp.Coinbase, true)
+	up.Fail(testhttp.CoinGecko, true)
+	if _, err := fetchStablecoinUSD("USDC"); err == nil {
+		t.Error("no error with every source down")
+	}
+}
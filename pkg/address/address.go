@@ -0,0 +1,113 @@
+// Package address provides Ethereum address validation and EIP-55 checksum
+// formatting shared by the request validators and scanners.
+package address
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Zero is the all-zero address
+const Zero = "0x0000000000000000000000000000000000000000"
+
+// maxPrecompile is the highest precompile address currently assigned on
+// Ethereum mainnet (BLS12-381 operations, Prague)
+const maxPrecompile = 0x11
+
+var (
+	// ErrFormat is returned when an address is not 0x followed by 40 hex digits
+	ErrFormat = errors.New("invalid address format")
+	// ErrChecksum is returned when a mixed-case address fails EIP-55 verification
+	ErrChecksum = errors.New("invalid EIP-55 checksum")
+)
+
+// IsHex reports whether addr is 0x followed by exactly 40 hex digits
+func IsHex(addr string) bool {
+	if len(addr) != 42 || !strings.HasPrefix(addr, "0x") && !strings.HasPrefix(addr, "0X") {
+		return false
+	}
+	_, err := hex.DecodeString(addr[2:])
+	return err == nil
+}
+
+// Checksum returns the EIP-55 mixed-case encoding of addr. The input must
+// already be well formed.
+func Checksum(addr string) string {
+	lower := strings.ToLower(addr[2:])
+
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(lower))
+	digest := h.Sum(nil)
+
+	out := []byte(lower)
+	for i, c := range out {
+		if c < 'a' {
+			continue
+		}
+		// Uppercase the letter when the matching hash nibble is >= 8
+		nibble := digest[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		if nibble&0x0f >= 8 {
+			out[i] = c - 32
+		}
+	}
+	return "0x" + string(out)
+}
+
+// HasValidChecksum reports whether addr satisfies EIP-55. All-lowercase and
+// all-uppercase addresses carry no checksum and are accepted.
+func HasValidChecksum(addr string) bool {
+	if !IsHex(addr) {
+		return false
+	}
+	body := addr[2:]
+	if body == strings.ToLower(body) || body == strings.ToUpper(body) {
+		return true
+	}
+	return Checksum(addr) == "0x"+body
+}
+
+// Validate performs strict validation: well-formed hex and, for mixed-case
+// input, a correct EIP-55 checksum.
+func Validate(addr string) error {
+	if !IsHex(addr) {
+		return ErrFormat
+	}
+	if !HasValidChecksum(addr) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// Normalize validates addr and returns its lowercase form
+func Normalize(addr string) (string, error) {
+	if err := Validate(addr); err != nil {
+		return "", err
+	}
+	return "0x" + strings.ToLower(addr[2:]), nil
+}
+
+// IsZero reports whether addr is the zero address
+func IsZero(addr string) bool {
+	return IsHex(addr) && strings.TrimLeft(addr[2:], "0") == ""
+}
+
+// IsPrecompile reports whether addr is one of the reserved precompile
+// addresses (0x01 through 0x11)
+func IsPrecompile(addr string) bool {
+	if !IsHex(addr) {
+		return false
+	}
+	b, _ := hex.DecodeString(addr[2:])
+	for _, v := range b[:19] {
+		if v != 0 {
+			return false
+		}
+	}
+	return b[19] >= 1 && b[19] <= maxPrecompile
+}
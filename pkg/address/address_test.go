@@ -0,0 +1,52 @@
+package address
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	// Vectors from EIP-55
+	vectors := []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	}
+	for _, v := range vectors {
+		if got := Checksum(v); got != v {
+			t.Errorf("Checksum(%s) = %s", v, got)
+		}
+		if err := Validate(v); err != nil {
+			t.Errorf("Validate(%s) = %v", v, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		addr string
+		want error
+	}{
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", nil},
+		{"0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", nil},
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", ErrChecksum},
+		{"0xzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz", ErrFormat},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea", ErrFormat},
+		{"5aaeb6053f3e94c9b9a09f33669435e7ef1beaed00", ErrFormat},
+	}
+	for _, tt := range tests {
+		if got := Validate(tt.addr); got != tt.want {
+			t.Errorf("Validate(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestSpecialAddresses(t *testing.T) {
+	if !IsZero(Zero) {
+		t.Error("IsZero(Zero) = false")
+	}
+	if !IsPrecompile("0x0000000000000000000000000000000000000001") {
+		t.Error("ecrecover should be a precompile")
+	}
+	if IsPrecompile(Zero) || IsPrecompile("0x0000000000000000000000000000000000000100") {
+		t.Error("non-precompile reported as precompile")
+	}
+}
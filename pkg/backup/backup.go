@@ -0,0 +1,226 @@
+// Package backup writes and restores snapshots of the service's persisted
+// state. A snapshot is a gzipped tar archive holding the state files and a
+// manifest.json listing the SHA-256 of each. Every archive is stored with a
+// sidecar "<name>.sha256" in sha256sum format, so an archive can be checked
+// with standard tools before it is restored.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the archive format version written to the manifest
+const Version = 1
+
+// ManifestName is the archive entry holding the manifest
+const ManifestName = "manifest.json"
+
+// ErrChecksum is returned when an archive or a file in it does not match
+// its recorded checksum
+var ErrChecksum = errors.New("backup checksum mismatch")
+
+// Manifest describes the contents of an archive
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []Entry   `json:"files"`
+}
+
+// Entry is one file in an archive
+type Entry struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Checksum returns the hex SHA-256 of data
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Name returns the archive name for a snapshot taken at t
+func Name(t time.Time) string {
+	return "x402-backup-" + t.UTC().Format("20060102T150405Z") + ".tar.gz"
+}
+
+// SidecarName returns the name of the checksum file stored next to archive
+func SidecarName(archive string) string {
+	return archive + ".sha256"
+}
+
+// Create builds an archive from files, keyed by slash-separated relative
+// path
+func Create(files map[string][]byte, at time.Time) ([]byte, Manifest, error) {
+	manifest := Manifest{Version: Version, CreatedAt: at.UTC()}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		if !validPath(p) {
+			return nil, manifest, fmt.Errorf("invalid backup path %q", p)
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		manifest.Files = append(manifest.Files, Entry{Path: p, Size: len(files[p]), SHA256: Checksum(files[p])})
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, manifest, err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := add(ManifestName, manifestJSON); err != nil {
+		return nil, manifest, err
+	}
+	for _, p := range paths {
+		if err := add(p, files[p]); err != nil {
+			return nil, manifest, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, manifest, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, manifest, err
+	}
+	return buf.Bytes(), manifest, nil
+}
+
+// Open reads an archive and verifies every file against the manifest
+func Open(archive []byte) (map[string][]byte, Manifest, error) {
+	var manifest Manifest
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, manifest, fmt.Errorf("reading backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	var manifestJSON []byte
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, manifest, fmt.Errorf("reading backup: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, manifest, fmt.Errorf("reading backup: %w", err)
+		}
+		if hdr.Name == ManifestName {
+			manifestJSON = data
+			continue
+		}
+		if !validPath(hdr.Name) {
+			return nil, manifest, fmt.Errorf("backup contains invalid path %q", hdr.Name)
+		}
+		files[hdr.Name] = data
+	}
+
+	if manifestJSON == nil {
+		return nil, manifest, errors.New("backup has no manifest")
+	}
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, manifest, fmt.Errorf("backup manifest: %w", err)
+	}
+	if manifest.Version != Version {
+		return nil, manifest, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	if len(manifest.Files) != len(files) {
+		return nil, manifest, fmt.Errorf("%w: manifest lists %d files, archive holds %d", ErrChecksum, len(manifest.Files), len(files))
+	}
+	for _, e := range manifest.Files {
+		data, ok := files[e.Path]
+		if !ok {
+			return nil, manifest, fmt.Errorf("%w: %s is missing", ErrChecksum, e.Path)
+		}
+		if Checksum(data) != e.SHA256 {
+			return nil, manifest, fmt.Errorf("%w: %s", ErrChecksum, e.Path)
+		}
+	}
+	return files, manifest, nil
+}
+
+// Restore verifies archive and writes its files under dir, replacing any
+// existing files of the same name
+func Restore(archive []byte, dir string) (Manifest, error) {
+	files, manifest, err := Open(archive)
+	if err != nil {
+		return manifest, err
+	}
+	for _, e := range manifest.Files {
+		dest := filepath.Join(dir, filepath.FromSlash(e.Path))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return manifest, err
+		}
+		tmp := dest + ".tmp"
+		if err := os.WriteFile(tmp, files[e.Path], 0o600); err != nil {
+			return manifest, err
+		}
+		if err := os.Rename(tmp, dest); err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+// Upload stores archive and its checksum sidecar under name
+func Upload(store Store, name string, archive []byte) error {
+	if err := store.Put(name, archive); err != nil {
+		return err
+	}
+	sidecar := fmt.Sprintf("%s  %s\n", Checksum(archive), path.Base(name))
+	return store.Put(SidecarName(name), []byte(sidecar))
+}
+
+// Download fetches the archive stored under name and checks it against its
+// sidecar
+func Download(store Store, name string) ([]byte, error) {
+	archive, err := store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	sidecar, err := store.Get(SidecarName(name))
+	if err != nil {
+		return nil, fmt.Errorf("reading checksum: %w", err)
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) == 0 || fields[0] != Checksum(archive) {
+		return nil, fmt.Errorf("%w: %s", ErrChecksum, name)
+	}
+	return archive, nil
+}
+
+// validPath accepts clean, relative, slash-separated paths that stay inside
+// the data directory
+func validPath(p string) bool {
+	return p != "" && p != ManifestName && path.Clean(p) == p && !path.IsAbs(p) &&
+		p != ".." && !strings.HasPrefix(p, "../") && !strings.Contains(p, "\\")
+}
@@ -0,0 +1,203 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store is where archives are kept
+type Store interface {
+	Put(name string, data []byte) error
+	Get(name string) ([]byte, error)
+}
+
+// S3Config holds credentials for S3-compatible storage
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.us-east-1.amazonaws.com or a MinIO URL
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3ConfigFromEnv reads BACKUP_S3_ENDPOINT, AWS_REGION, AWS_ACCESS_KEY_ID
+// and AWS_SECRET_ACCESS_KEY
+func S3ConfigFromEnv() S3Config {
+	c := S3Config{
+		Endpoint:  os.Getenv("BACKUP_S3_ENDPOINT"),
+		Region:    os.Getenv("AWS_REGION"),
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	return c
+}
+
+// OpenStore returns the store for dest: "s3://bucket/prefix" for
+// S3-compatible storage, otherwise a local directory (optionally given as
+// "file:///path")
+func OpenStore(dest string, s3 S3Config) (Store, error) {
+	if rest, ok := strings.CutPrefix(dest, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("backup destination %q has no bucket", dest)
+		}
+		if s3.AccessKey == "" || s3.SecretKey == "" {
+			return nil, fmt.Errorf("backup destination %q needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", dest)
+		}
+		return &S3Store{
+			config: s3,
+			bucket: bucket,
+			prefix: strings.Trim(prefix, "/"),
+			client: &http.Client{Timeout: 5 * time.Minute},
+		}, nil
+	}
+	dir := strings.TrimPrefix(dest, "file://")
+	if dir == "" {
+		return nil, fmt.Errorf("empty backup destination")
+	}
+	return DirStore(dir), nil
+}
+
+// DirStore keeps archives in a local directory
+type DirStore string
+
+func (d DirStore) Put(name string, data []byte) error {
+	if err := os.MkdirAll(string(d), 0o700); err != nil {
+		return err
+	}
+	dest := filepath.Join(string(d), filepath.Base(name))
+	tmp := dest + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+func (d DirStore) Get(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.Base(name)))
+}
+
+// S3Store keeps archives in a bucket, using path-style requests signed
+// with AWS Signature Version 4
+type S3Store struct {
+	config S3Config
+	bucket string
+	prefix string
+	client *http.Client
+}
+
+func (s *S3Store) Put(name string, data []byte) error {
+	_, err := s.do(http.MethodPut, name, data)
+	return err
+}
+
+func (s *S3Store) Get(name string) ([]byte, error) {
+	return s.do(http.MethodGet, name, nil)
+}
+
+func (s *S3Store) do(method, name string, body []byte) ([]byte, error) {
+	key := name
+	if s.prefix != "" {
+		key = s.prefix + "/" + name
+	}
+	u := strings.TrimRight(s.config.Endpoint, "/") + "/" + s.bucket + "/" + key
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	signV4(req, body, s.config, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3 %s %s/%s: %s: %s", method, s.bucket, key, resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// signV4 adds AWS Signature Version 4 headers to req. Every header already
+// set on req is signed, along with Host.
+func signV4(req *http.Request, body []byte, c S3Config, at time.Time) {
+	amzDate := at.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := Checksum(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + Checksum([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalURI escapes each path segment as SigV4 requires
+func canonicalURI(u *url.URL) string {
+	segments := strings.Split(u.Path, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(s), "+", "%2B")
+	}
+	if p := strings.Join(segments, "/"); p != "" {
+		return p
+	}
+	return "/"
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
@@ -0,0 +1,23 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	if !f.Now().Equal(start) {
+		t.Fatalf("Now() = %v, want %v", f.Now(), start)
+	}
+	f.Advance(90 * time.Second)
+	if got := Since(f, start); got != 90*time.Second {
+		t.Errorf("Since = %v after Advance(90s)", got)
+	}
+	f.Set(start.Add(-time.Hour))
+	if got := Since(f, start); got != -time.Hour {
+		t.Errorf("Since = %v after Set to an hour earlier", got)
+	}
+}
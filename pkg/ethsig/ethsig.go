@@ -0,0 +1,230 @@
+// Package ethsig recovers the signer of Ethereum personal_sign (EIP-191)
+// and typed data (EIP-712) signatures, as produced by browser wallets
+// through EIP-1193.
+package ethsig
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// ErrSignature is returned for signatures that are malformed or do not
+// recover to a public key
+var ErrSignature = errors.New("invalid signature")
+
+// secp256k1 domain parameters
+var (
+	curveP, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	curveN, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	curveGx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	curveGy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+	halfN      = new(big.Int).Rsh(curveN, 1)
+)
+
+// point is an affine curve point; nil is the point at infinity
+type point struct{ x, y *big.Int }
+
+var generator = &point{curveGx, curveGy}
+
+func add(a, b *point) *point {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	var slope *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		if new(big.Int).Add(a.y, b.y).Mod(new(big.Int).Add(a.y, b.y), curveP).Sign() == 0 {
+			return nil
+		}
+		// Doubling: (3x²) / (2y)
+		num := new(big.Int).Mul(a.x, a.x)
+		num.Mul(num, big.NewInt(3))
+		den := new(big.Int).Lsh(a.y, 1)
+		slope = num.Mul(num, den.ModInverse(den, curveP))
+	} else {
+		num := new(big.Int).Sub(b.y, a.y)
+		den := new(big.Int).Sub(b.x, a.x)
+		den.Mod(den, curveP)
+		slope = num.Mul(num, den.ModInverse(den, curveP))
+	}
+	slope.Mod(slope, curveP)
+
+	x := new(big.Int).Mul(slope, slope)
+	x.Sub(x, a.x).Sub(x, b.x).Mod(x, curveP)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, slope).Sub(y, a.y).Mod(y, curveP)
+	return &point{x, y}
+}
+
+// mul is double-and-add scalar multiplication. It is not constant time.
+func mul(p *point, k *big.Int) *point {
+	var out *point
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		out = add(out, out)
+		if k.Bit(i) == 1 {
+			out = add(out, p)
+		}
+	}
+	return out
+}
+
+func keccak(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func address(p *point) string {
+	pub := make([]byte, 64)
+	p.x.FillBytes(pub[:32])
+	p.y.FillBytes(pub[32:])
+	return "0x" + hex.EncodeToString(keccak(pub)[12:])
+}
+
+// PersonalHash is the digest personal_sign signs: keccak256 of the EIP-191
+// prefix, the message length in decimal and the message
+func PersonalHash(message []byte) []byte {
+	return keccak([]byte("\x19Ethereum Signed Message:\n"+strconv.Itoa(len(message))), message)
+}
+
+// Keccak256 hashes the concatenation of data
+func Keccak256(data ...[]byte) []byte {
+	return keccak(data...)
+}
+
+// domainTypeHash is keccak256 of the EIP712Domain type Domain encodes
+var domainTypeHash = keccak([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+
+// Domain is an EIP-712 signing domain with a name, version, chain ID and
+// verifying contract
+type Domain struct {
+	Name              string
+	Version           string
+	ChainID           int64
+	VerifyingContract string // 0x-prefixed address
+}
+
+// Separator returns the domain separator, hashStruct(domain)
+func (d Domain) Separator() ([]byte, error) {
+	contract, err := Word(d.VerifyingContract)
+	if err != nil {
+		return nil, err
+	}
+	return keccak(domainTypeHash, keccak([]byte(d.Name)), keccak([]byte(d.Version)), Uint(big.NewInt(d.ChainID)), contract), nil
+}
+
+// TypedDataHash is the digest an EIP-712 signature signs: keccak256 of
+// "\x19\x01", the domain separator and the hash of the message struct
+func TypedDataHash(domainSeparator, structHash []byte) []byte {
+	return keccak([]byte{0x19, 0x01}, domainSeparator, structHash)
+}
+
+// Uint ABI-encodes a non-negative integer as a 32-byte word
+func Uint(v *big.Int) []byte {
+	return v.FillBytes(make([]byte, 32))
+}
+
+// Word left-pads a 0x-prefixed hex address or bytes32 value to a 32-byte
+// word
+func Word(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) > 32 {
+		return nil, errors.New("invalid hex word")
+	}
+	return append(make([]byte, 32-len(b)), b...), nil
+}
+
+// Recover returns the lowercase address that produced the 65-byte [r|s|v]
+// signature of hash. v may be 0/1 or 27/28.
+func Recover(hash, sig []byte) (string, error) {
+	if len(hash) != 32 || len(sig) != 65 {
+		return "", ErrSignature
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 || r.Sign() == 0 || s.Sign() == 0 || r.Cmp(curveN) >= 0 || s.Cmp(curveN) >= 0 {
+		return "", ErrSignature
+	}
+
+	// R is the point with x = r and the parity of y given by v
+	y2 := new(big.Int).Exp(r, big.NewInt(3), curveP)
+	y2.Add(y2, big.NewInt(7)).Mod(y2, curveP)
+	y := new(big.Int).Exp(y2, new(big.Int).Rsh(new(big.Int).Add(curveP, big.NewInt(1)), 2), curveP)
+	if new(big.Int).Exp(y, big.NewInt(2), curveP).Cmp(y2) != 0 {
+		return "", ErrSignature
+	}
+	if y.Bit(0) != uint(v) {
+		y.Sub(curveP, y)
+	}
+
+	// Q = r⁻¹(sR - eG)
+	rInv := new(big.Int).ModInverse(r, curveN)
+	e := new(big.Int).SetBytes(hash)
+	u1 := new(big.Int).Neg(e)
+	u1.Mul(u1, rInv).Mod(u1, curveN)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, curveN)
+	q := add(mul(generator, u1), mul(&point{r, y}, u2))
+	if q == nil {
+		return "", ErrSignature
+	}
+	return address(q), nil
+}
+
+// Address returns the lowercase address of a private key
+func Address(key *big.Int) string {
+	return address(mul(generator, key))
+}
+
+// Sign signs hash with key, returning a 65-byte [r|s|v] signature with v
+// 27 or 28 and a low s, as wallets do. It is not constant time and is
+// meant for tests and tooling, not for guarding real funds.
+func Sign(hash []byte, key *big.Int) ([]byte, error) {
+	if len(hash) != 32 || key.Sign() <= 0 || key.Cmp(curveN) >= 0 {
+		return nil, ErrSignature
+	}
+	e := new(big.Int).SetBytes(hash)
+	for {
+		k, err := rand.Int(rand.Reader, curveN)
+		if err != nil {
+			return nil, err
+		}
+		if k.Sign() == 0 {
+			continue
+		}
+		R := mul(generator, k)
+		r := new(big.Int).Mod(R.x, curveN)
+		if r.Sign() == 0 {
+			continue
+		}
+		s := new(big.Int).Mul(r, key)
+		s.Add(s, e).Mul(s, k.ModInverse(k, curveN)).Mod(s, curveN)
+		if s.Sign() == 0 {
+			continue
+		}
+		v := byte(R.y.Bit(0))
+		if s.Cmp(halfN) > 0 {
+			s.Sub(curveN, s)
+			v ^= 1
+		}
+		sig := make([]byte, 65)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:64])
+		sig[64] = 27 + v
+		return sig, nil
+	}
+}
@@ -0,0 +1,91 @@
+package ethsig
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"1", "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf"},
+		{"2", "0x2b5ad5c4795c026514f8317c7a215e218dccd6cf"},
+		// First Hardhat/Anvil development account
+		{"ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"},
+	}
+	for _, tt := range tests {
+		key, _ := new(big.Int).SetString(tt.key, 16)
+		if got := Address(key); got != tt.want {
+			t.Errorf("Address(%s) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestPersonalHash(t *testing.T) {
+	// keccak256("\x19Ethereum Signed Message:\n11hello world")
+	want := "d9eba16ed0ecae432b71fe008c98cc872bb4cc214d3220a36f365326cf807d68"
+	if got := hex.EncodeToString(PersonalHash([]byte("hello world"))); got != want {
+		t.Errorf("PersonalHash = %s, want %s", got, want)
+	}
+}
+
+func TestTypedDataHash(t *testing.T) {
+	// The Mail example from EIP-712
+	domain := Domain{Name: "Ether Mail", Version: "1", ChainID: 1, VerifyingContract: "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"}
+	separator, err := domain.Separator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(separator), "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f"; got != want {
+		t.Errorf("Separator = %s, want %s", got, want)
+	}
+	person := func(name, wallet string) []byte {
+		w, _ := Word(wallet)
+		return Keccak256(Keccak256([]byte("Person(string name,address wallet)")), Keccak256([]byte(name)), w)
+	}
+	mail := Keccak256(
+		Keccak256([]byte("Mail(Person from,Person to,string contents)Person(string name,address wallet)")),
+		person("Cow", "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"),
+		person("Bob", "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"),
+		Keccak256([]byte("Hello, Bob!")),
+	)
+	if got, want := hex.EncodeToString(TypedDataHash(separator, mail)), "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"; got != want {
+		t.Errorf("TypedDataHash = %s, want %s", got, want)
+	}
+
+	if _, err := (Domain{VerifyingContract: "0xnothex"}).Separator(); err == nil {
+		t.Error("Separator accepted an invalid contract address")
+	}
+}
+
+func TestSignRecover(t *testing.T) {
+	key, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	hash := PersonalHash([]byte("Pay 0.001 USDC"))
+	for range 8 {
+		sig, err := Sign(hash, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := Recover(hash, sig); err != nil || got != Address(key) {
+			t.Fatalf("Recover = %s, %v, want %s", got, err, Address(key))
+		}
+		// Wallets may also send v as 0 or 1
+		sig[64] -= 27
+		if got, _ := Recover(hash, sig); got != Address(key) {
+			t.Errorf("Recover with v=%d = %s", sig[64], got)
+		}
+		if got, _ := Recover(PersonalHash([]byte("Pay 1000 USDC")), sig); got == Address(key) {
+			t.Error("signature recovered the signer for another message")
+		}
+	}
+
+	if _, err := Recover(hash, make([]byte, 65)); err != ErrSignature {
+		t.Errorf("zero signature: %v", err)
+	}
+	if _, err := Recover(hash, make([]byte, 64)); err != ErrSignature {
+		t.Errorf("short signature: %v", err)
+	}
+}
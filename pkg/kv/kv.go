@@ -0,0 +1,56 @@
+// Package kv is the state shared between replicas of the service. Open
+// returns an in-process store by default, which is correct for a single
+// replica, or a Redis store when several replicas run behind a load
+// balancer.
+package kv
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Store is a key-value store with per-key expiry. A ttl of zero means the
+// key does not expire.
+type Store interface {
+	// Get returns the value at key, reporting false if it is absent
+	Get(key string) (string, bool, error)
+	// Set stores value at key
+	Set(key, value string, ttl time.Duration) error
+	// SetNX stores value at key only if the key is absent, reporting
+	// whether it was stored
+	SetNX(key, value string, ttl time.Duration) (bool, error)
+	// Incr adds one to the counter at key and returns the new value. The
+	// ttl applies when the counter is created and is not extended.
+	Incr(key string, ttl time.Duration) (int64, error)
+	// IncrBy adds delta, which may be negative, to the counter at key and
+	// returns the new value. The counter never expires.
+	IncrBy(key string, delta int64) (int64, error)
+	// Delete removes key
+	Delete(key string) error
+	// Refresh resets the ttl of key if it holds value, reporting whether
+	// it did
+	Refresh(key, value string, ttl time.Duration) (bool, error)
+	// DeleteIf removes key if it holds value, reporting whether it did
+	DeleteIf(key, value string) (bool, error)
+	// Close releases the store's connections
+	Close() error
+}
+
+// Open returns the store for rawURL: "" or "memory://" for an in-process
+// store, "redis://[:password@]host:port[/db]" or "rediss://..." for Redis
+func Open(rawURL string) (Store, error) {
+	if rawURL == "" || rawURL == "memory://" {
+		return NewMemory(), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "redis", "rediss":
+		return NewRedis(u)
+	}
+	return nil, fmt.Errorf("unsupported shared state URL scheme %q (want redis, rediss or memory)", u.Scheme)
+}
@@ -0,0 +1,228 @@
+package kv
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// exercise runs the behaviour every Store must share
+func exercise(t *testing.T, s Store) {
+	t.Helper()
+	if _, ok, err := s.Get("missing"); ok || err != nil {
+		t.Errorf("Get(missing) = %v, %v", ok, err)
+	}
+	if err := s.Set("a", "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, _ := s.Get("a"); !ok || v != "1" {
+		t.Errorf("Get(a) = %q, %v", v, ok)
+	}
+	if ok, _ := s.SetNX("a", "2", time.Minute); ok {
+		t.Error("SetNX overwrote an existing key")
+	}
+	if ok, _ := s.SetNX("b", "2", time.Minute); !ok {
+		t.Error("SetNX did not set an absent key")
+	}
+	for want := int64(1); want <= 3; want++ {
+		if n, err := s.Incr("c", time.Minute); err != nil || n != want {
+			t.Errorf("Incr = %d, %v, want %d", n, err, want)
+		}
+	}
+	if n, err := s.IncrBy("balance", 5); err != nil || n != 5 {
+		t.Errorf("IncrBy(5) = %d, %v", n, err)
+	}
+	if n, err := s.IncrBy("balance", -7); err != nil || n != -2 {
+		t.Errorf("IncrBy(-7) = %d, %v, want -2", n, err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get("a"); ok {
+		t.Error("deleted key still present")
+	}
+
+	if ok, _ := s.Refresh("b", "other", time.Minute); ok {
+		t.Error("Refresh matched the wrong value")
+	}
+	if ok, _ := s.Refresh("b", "2", time.Minute); !ok {
+		t.Error("Refresh did not match the stored value")
+	}
+	if ok, _ := s.DeleteIf("b", "other"); ok {
+		t.Error("DeleteIf matched the wrong value")
+	}
+	if ok, _ := s.DeleteIf("b", "2"); !ok {
+		t.Error("DeleteIf did not match the stored value")
+	}
+	if _, ok, _ := s.Get("b"); ok {
+		t.Error("DeleteIf left the key in place")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	s := NewMemory()
+	exercise(t, s)
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s.clock = fake
+	s.Set("ttl", "v", time.Minute)
+	s.Incr("counter", time.Minute)
+	fake.Advance(30 * time.Second)
+	s.Incr("counter", time.Minute) // does not extend the expiry
+	fake.Advance(30 * time.Second)
+	if _, ok, _ := s.Get("ttl"); ok {
+		t.Error("key served after its ttl")
+	}
+	if n, _ := s.Incr("counter", time.Minute); n != 1 {
+		t.Errorf("counter after expiry = %d, want 1", n)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	addr := fakeRedis(t, "secret")
+	s, err := Open("redis://:secret@" + addr + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	exercise(t, s)
+
+	bad, _ := Open("redis://:wrong@" + addr)
+	if _, _, err := bad.Get("a"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("wrong password: err = %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if s, err := Open(""); err != nil || s == nil {
+		t.Errorf("Open(\"\") = %v, %v", s, err)
+	}
+	if _, err := Open("postgres://db"); err == nil {
+		t.Error("Open accepted an unsupported scheme")
+	}
+	if _, err := Open("redis://host/notadb"); err == nil {
+		t.Error("Open accepted a non-numeric database")
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*3\r\n:1\r\n$-1\r\n*1\r\n$3\r\nfoo\r\n"))
+	v, err := readReply(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := v.([]interface{})
+	if items[0] != int64(1) || items[1] != nil || items[2].([]interface{})[0] != "foo" {
+		t.Errorf("reply = %#v", v)
+	}
+	if _, err := readReply(bufio.NewReader(strings.NewReader("-ERR boom\r\n"))); err != RedisError("ERR boom") {
+		t.Errorf("error reply = %v", err)
+	}
+}
+
+// fakeRedis serves the commands Redis uses from a Memory store
+func fakeRedis(t *testing.T, password string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	data := NewMemory()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeRedis(conn, data, password)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFakeRedis(conn net.Conn, data *Memory, password string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := password == ""
+	for {
+		v, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range v.([]interface{}) {
+			args = append(args, a.(string))
+		}
+
+		reply := "+OK\r\n"
+		bulk := func(s string, ok bool, _ error) {
+			if ok {
+				reply = "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		}
+		ttl := func(rest []string) time.Duration {
+			for i := 0; i+1 < len(rest); i++ {
+				if rest[i] == "PX" {
+					ms, _ := strconv.Atoi(rest[i+1])
+					return time.Duration(ms) * time.Millisecond
+				}
+			}
+			return 0
+		}
+
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			if args[len(args)-1] != password {
+				reply = "-WRONGPASS invalid password\r\n"
+			} else {
+				authed = true
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SELECT":
+		case cmd == "GET":
+			bulk(data.Get(args[1]))
+		case cmd == "SET" && len(args) > 3 && args[3] == "NX":
+			if ok, _ := data.SetNX(args[1], args[2], ttl(args[3:])); !ok {
+				reply = "$-1\r\n"
+			}
+		case cmd == "SET":
+			data.Set(args[1], args[2], ttl(args[3:]))
+		case cmd == "DEL":
+			data.Delete(args[1])
+			reply = ":1\r\n"
+		case cmd == "INCRBY":
+			delta, _ := strconv.ParseInt(args[2], 10, 64)
+			n, _ := data.IncrBy(args[1], delta)
+			reply = ":" + strconv.FormatInt(n, 10) + "\r\n"
+		case cmd == "EVAL" && args[1] == incrScript:
+			ms, _ := strconv.Atoi(args[4])
+			n, _ := data.Incr(args[3], time.Duration(ms)*time.Millisecond)
+			reply = ":" + strconv.FormatInt(n, 10) + "\r\n"
+		case cmd == "EVAL" && (args[1] == refreshScript || args[1] == deleteIfScript):
+			var ok bool
+			if args[1] == refreshScript {
+				ms, _ := strconv.Atoi(args[5])
+				ok, _ = data.Refresh(args[3], args[4], time.Duration(ms)*time.Millisecond)
+			} else {
+				ok, _ = data.DeleteIf(args[3], args[4])
+			}
+			reply = ":0\r\n"
+			if ok {
+				reply = ":1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		conn.Write([]byte(reply))
+	}
+}
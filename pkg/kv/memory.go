@@ -0,0 +1,143 @@
+package kv
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// Memory is an in-process Store. Expired keys are dropped lazily on access
+// and swept whenever the store has doubled in size since the last sweep.
+type Memory struct {
+	mu        sync.Mutex
+	items     map[string]memoryItem
+	lastSweep int
+	clock     clock.Clock
+}
+
+type memoryItem struct {
+	value   string
+	expires time.Time // zero for no expiry
+}
+
+// NewMemory creates an empty in-process store
+func NewMemory() *Memory {
+	return &Memory{items: make(map[string]memoryItem), clock: clock.System}
+}
+
+// get returns the live item at key. The caller holds m.mu.
+func (m *Memory) get(key string) (memoryItem, bool) {
+	item, ok := m.items[key]
+	if ok && !item.expires.IsZero() && !m.clock.Now().Before(item.expires) {
+		delete(m.items, key)
+		return memoryItem{}, false
+	}
+	return item, ok
+}
+
+// put stores an item. The caller holds m.mu.
+func (m *Memory) put(key, value string, ttl time.Duration) {
+	item := memoryItem{value: value}
+	if ttl > 0 {
+		item.expires = m.clock.Now().Add(ttl)
+	}
+	m.items[key] = item
+
+	if len(m.items) > 2*m.lastSweep+1024 {
+		now := m.clock.Now()
+		for k, it := range m.items {
+			if !it.expires.IsZero() && !now.Before(it.expires) {
+				delete(m.items, k)
+			}
+		}
+		m.lastSweep = len(m.items)
+	}
+}
+
+func (m *Memory) Get(key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	return item.value, ok, nil
+}
+
+func (m *Memory) Set(key, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(key, value, ttl)
+	return nil
+}
+
+func (m *Memory) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); ok {
+		return false, nil
+	}
+	m.put(key, value, ttl)
+	return true, nil
+}
+
+func (m *Memory) Incr(key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		m.put(key, "1", ttl)
+		return 1, nil
+	}
+	n, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	n++
+	item.value = strconv.FormatInt(n, 10)
+	m.items[key] = item
+	return n, nil
+}
+
+func (m *Memory) IncrBy(key string, delta int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	if item, ok := m.get(key); ok {
+		var err error
+		if n, err = strconv.ParseInt(item.value, 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	n += delta
+	m.put(key, strconv.FormatInt(n, 10), 0)
+	return n, nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	return nil
+}
+
+func (m *Memory) Refresh(key, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if item, ok := m.get(key); !ok || item.value != value {
+		return false, nil
+	}
+	m.put(key, value, ttl)
+	return true, nil
+}
+
+func (m *Memory) DeleteIf(key, value string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if item, ok := m.get(key); !ok || item.value != value {
+		return false, nil
+	}
+	delete(m.items, key)
+	return true, nil
+}
+
+func (m *Memory) Close() error { return nil }
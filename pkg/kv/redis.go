@@ -0,0 +1,292 @@
+package kv
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNil is returned by Redis.Do for a nil reply
+var ErrNil = errors.New("redis: nil reply")
+
+// RedisError is an error reply from the server
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+// incrScript increments a counter and sets its expiry when it is created,
+// atomically
+const incrScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`
+
+// refreshScript resets a key's expiry if it holds the expected value
+const refreshScript = `if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+if tonumber(ARGV[2]) > 0 then redis.call('PEXPIRE', KEYS[1], ARGV[2]) else redis.call('PERSIST', KEYS[1]) end
+return 1`
+
+// deleteIfScript deletes a key if it holds the expected value
+const deleteIfScript = `if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+return redis.call('DEL', KEYS[1])`
+
+// Redis is a Store backed by a Redis server, speaking RESP2 over a small
+// pool of connections
+type Redis struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	timeout  time.Duration
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NewRedis creates a store for a redis:// or rediss:// URL. Connections are
+// opened on first use.
+func NewRedis(u *url.URL) (*Redis, error) {
+	r := &Redis{
+		addr:    u.Host,
+		timeout: 5 * time.Second,
+		pool:    make(chan *redisConn, 16),
+	}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+		r.db = n
+	}
+	if strings.EqualFold(u.Scheme, "rediss") {
+		r.tls = &tls.Config{ServerName: u.Hostname()}
+	}
+	return r, nil
+}
+
+func (r *Redis) Get(key string) (string, bool, error) {
+	v, err := r.Do("GET", key)
+	if err == ErrNil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	s, _ := v.(string)
+	return s, true, nil
+}
+
+func (r *Redis) Set(key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.Do(args...)
+	return err
+}
+
+func (r *Redis) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	args := []string{"SET", key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.Do(args...)
+	if err == ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *Redis) Incr(key string, ttl time.Duration) (int64, error) {
+	v, err := r.Do("EVAL", incrScript, "1", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %v", v)
+	}
+	return n, nil
+}
+
+func (r *Redis) IncrBy(key string, delta int64) (int64, error) {
+	v, err := r.Do("INCRBY", key, strconv.FormatInt(delta, 10))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCRBY reply %v", v)
+	}
+	return n, nil
+}
+
+func (r *Redis) Delete(key string) error {
+	_, err := r.Do("DEL", key)
+	return err
+}
+
+func (r *Redis) Refresh(key, value string, ttl time.Duration) (bool, error) {
+	v, err := r.Do("EVAL", refreshScript, "1", key, value, strconv.FormatInt(ttl.Milliseconds(), 10))
+	return v == int64(1), err
+}
+
+func (r *Redis) DeleteIf(key, value string) (bool, error) {
+	v, err := r.Do("EVAL", deleteIfScript, "1", key, value)
+	return v == int64(1), err
+}
+
+// Close closes the idle connections
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.pool:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Do sends a command and returns its reply: a string, int64, []interface{},
+// or ErrNil. Error replies are returned as RedisError.
+func (r *Redis) Do(args ...string) (interface{}, error) {
+	c, err := r.conn()
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.do(r.timeout, args...)
+	var re RedisError
+	if err != nil && err != ErrNil && !errors.As(err, &re) {
+		c.Close() // the connection state is unknown
+		return nil, err
+	}
+	select {
+	case r.pool <- c:
+	default:
+		c.Close()
+	}
+	return v, err
+}
+
+// conn takes an idle connection or dials a new one
+func (r *Redis) conn() (*redisConn, error) {
+	select {
+	case c := <-r.pool:
+		return c, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: r.timeout}
+	var nc net.Conn
+	var err error
+	if r.tls != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", r.addr, r.tls)
+	} else {
+		nc, err = dialer.Dial("tcp", r.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+
+	if r.password != "" {
+		auth := []string{"AUTH", r.password}
+		if r.username != "" {
+			auth = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := c.do(r.timeout, auth...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.do(r.timeout, "SELECT", strconv.Itoa(r.db)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(timeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// readReply reads one RESP2 reply
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, RedisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", body)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readReply(r)
+			if err != nil && err != ErrNil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
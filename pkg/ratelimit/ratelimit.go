@@ -0,0 +1,187 @@
+// Package ratelimit limits requests per key, such as a payer or an API
+// key, with token buckets. A bucket holds up to burst tokens and refills
+// at a steady rate; each request takes one. Bucket state lives in a Store:
+// NewMemory keeps it in process, NewRedis in Redis so every replica of a
+// service draws on the same buckets.
+//
+// It is what the x402 service limits paid requests, gateway routes and
+// explorer API keys with, and works as is in front of any http.Handler:
+//
+//	limiter := ratelimit.New(60, 10)
+//	http.Handle("/api/", ratelimit.Middleware(limiter, ratelimit.ByRemoteAddr, api))
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// Limiter decides whether a request from key may proceed
+type Limiter interface {
+	Allow(key string) bool
+	// Take is Allow that also reports what is left of key's allowance
+	Take(key string) Status
+}
+
+// Status is the outcome of taking from a key's allowance
+type Status struct {
+	Allowed   bool
+	Limit     int           // requests allowed in a burst
+	Remaining int           // requests left right now
+	Reset     time.Duration // until the allowance is full again
+	Retry     time.Duration // until the next request is allowed, if refused
+}
+
+// Store keeps the token buckets of one or more limiters
+type Store interface {
+	// Take refills the bucket at key by rate tokens a second since it was
+	// last used, up to burst, then takes a token if a whole one is there.
+	// It returns the tokens left and whether one was taken. A new bucket
+	// starts full.
+	Take(key string, rate, burst float64, now time.Time) (tokens float64, allowed bool, err error)
+}
+
+// Bucket is a per-key token bucket limiter
+type Bucket struct {
+	name  string
+	rate  float64 // tokens per second
+	burst float64
+	store Store
+	clock clock.Clock
+}
+
+// New allows perMinute requests per key with bursts up to burst, keeping
+// its buckets in process
+func New(perMinute, burst int) *Bucket {
+	return NewShared(NewMemory(), "", perMinute, burst)
+}
+
+// NewShared is New with its buckets kept in store. name keeps the buckets
+// of limiters sharing a store apart.
+func NewShared(store Store, name string, perMinute, burst int) *Bucket {
+	return &Bucket{
+		name:  name,
+		rate:  float64(perMinute) / 60,
+		burst: float64(max(burst, 1)),
+		store: store,
+		clock: clock.System,
+	}
+}
+
+// SetClock replaces the clock buckets refill by, for tests
+func (b *Bucket) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
+// Allow takes a token for key, reporting false if none is available
+func (b *Bucket) Allow(key string) bool {
+	return b.Take(key).Allowed
+}
+
+// Take takes a token for key. Reset is when the bucket is full again. If
+// the store fails the request is allowed.
+func (b *Bucket) Take(key string) Status {
+	st := Status{Allowed: true, Limit: int(b.burst)}
+	tokens, allowed, err := b.store.Take("ratelimit:"+b.name+":"+key, b.rate, b.burst, b.clock.Now())
+	if err != nil {
+		log.Printf("⚠️  Rate limit store unavailable, allowing request: %v", err)
+		st.Remaining = st.Limit
+		return st
+	}
+	st.Allowed = allowed
+	if !allowed {
+		st.Retry = b.refill(1 - tokens)
+	}
+	st.Remaining = int(tokens)
+	st.Reset = b.refill(b.burst - tokens)
+	return st
+}
+
+// refill is how long the bucket takes to gain tokens
+func (b *Bucket) refill(tokens float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / b.rate * float64(time.Second))
+}
+
+// Memory is a Store in process memory
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemory creates an empty in-process store
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+// Take implements Store
+func (m *Memory) Take(key string, rate, burst float64, now time.Time) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+// SetHeaders lets clients pace themselves: X-RateLimit-Limit, -Remaining
+// and -Reset, and Retry-After on a refusal. Times are in seconds from now.
+func SetHeaders(w http.ResponseWriter, st Status) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(st.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(st.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(st.Reset)))
+	if !st.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(st.Retry))))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Middleware limits requests to next by the key key returns, answering
+// 429 once a key's allowance is spent
+func Middleware(l Limiter, key func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := l.Take(key(r))
+		SetHeaders(w, st)
+		if !st.Allowed {
+			http.Error(w, `{"error":"Rate limit exceeded"}`, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ByRemoteAddr keys requests by the client's IP address, as seen by the
+// server. Behind a proxy, key by the header it sets instead.
+func ByRemoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
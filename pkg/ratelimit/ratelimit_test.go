@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestBucket(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	b := New(60, 2)
+	b.SetClock(fake)
+
+	if st := b.Take("a"); !st.Allowed || st.Limit != 2 || st.Remaining != 1 || st.Reset != time.Second {
+		t.Errorf("first take = %+v", st)
+	}
+	b.Take("a")
+	st := b.Take("a")
+	if st.Allowed || st.Remaining != 0 || st.Retry != time.Second || st.Reset != 2*time.Second {
+		t.Errorf("refused take = %+v", st)
+	}
+	if !b.Allow("b") {
+		t.Error("keys are not limited separately")
+	}
+	fake.Advance(time.Second)
+	if !b.Allow("a") || b.Allow("a") {
+		t.Error("refill after one second is not exactly one token")
+	}
+
+	rr := httptest.NewRecorder()
+	SetHeaders(rr, st)
+	for header, want := range map[string]string{"X-RateLimit-Limit": "2", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "2", "Retry-After": "1"} {
+		if got := rr.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestSharedStore(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	store := NewMemory()
+	replicas := []*Bucket{NewShared(store, "gw:api", 60, 3), NewShared(store, "gw:api", 60, 3)}
+	for _, b := range replicas {
+		b.SetClock(fake)
+	}
+
+	for i := range 3 {
+		if !replicas[i%2].Allow("payer") {
+			t.Fatalf("request %d refused", i)
+		}
+	}
+	if replicas[1].Allow("payer") || replicas[0].Allow("payer") {
+		t.Error("bucket not shared between replicas")
+	}
+	if !NewShared(store, "gw:other", 60, 3).Allow("payer") {
+		t.Error("limiters with different names share buckets")
+	}
+	fake.Advance(time.Second)
+	if !replicas[1].Allow("payer") {
+		t.Error("shared bucket did not refill")
+	}
+}
+
+// fakeRedis runs takeScript against a Memory store
+type fakeRedis struct {
+	data *Memory
+	err  error
+}
+
+func (f *fakeRedis) Do(args ...string) (interface{}, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(args) != 7 || args[0] != "EVAL" || args[1] != takeScript || args[2] != "1" {
+		return nil, errors.New("unexpected command")
+	}
+	rate, _ := strconv.ParseFloat(args[4], 64)
+	burst, _ := strconv.ParseFloat(args[5], 64)
+	now, _ := strconv.ParseFloat(args[6], 64)
+	tokens, taken, _ := f.data.Take(args[3], rate, burst, time.UnixMicro(int64(now*1e6)))
+	n := int64(0)
+	if taken {
+		n = 1
+	}
+	return []interface{}{n, strconv.FormatFloat(tokens, 'f', -1, 64)}, nil
+}
+
+func TestRedis(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	server := &fakeRedis{data: NewMemory()}
+	b := NewShared(NewRedis(server), "paid", 60, 2)
+	b.SetClock(fake)
+
+	if st := b.Take("a"); !st.Allowed || st.Remaining != 1 {
+		t.Errorf("first take = %+v", st)
+	}
+	b.Take("a")
+	if st := b.Take("a"); st.Allowed || st.Retry != time.Second {
+		t.Errorf("refused take = %+v", st)
+	}
+	fake.Advance(500 * time.Millisecond)
+	if b.Allow("a") {
+		t.Error("half a token allowed a request")
+	}
+
+	// An unreachable store lets requests through
+	server.err = errors.New("connection refused")
+	if st := b.Take("a"); !st.Allowed || st.Remaining != 2 {
+		t.Errorf("take with the store down = %+v", st)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	h := Middleware(New(1, 1), ByRemoteAddr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	call := func(addr string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := call("192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("first request = %d", code)
+	}
+	if code := call("192.0.2.1:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("second request from the same address = %d, want 429", code)
+	}
+	if code := call("192.0.2.2:1234"); code != http.StatusOK {
+		t.Errorf("request from another address = %d", code)
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// takeScript refills and takes from a bucket kept in a hash, atomically.
+// It expires once the bucket would be full again, as a full bucket and a
+// missing one are the same.
+const takeScript = `local rate, burst, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens, last = tonumber(b[1]), tonumber(b[2])
+if tokens == nil then tokens, last = burst, now end
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+local taken = 0
+if tokens >= 1 then tokens, taken = tokens - 1, 1 end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', ARGV[3])
+local full = 0
+if rate > 0 then full = math.ceil((burst - tokens) / rate * 1000) end
+redis.call('PEXPIRE', KEYS[1], math.max(full, 1000))
+return {taken, tostring(tokens)}`
+
+// Doer sends a Redis command and returns its reply, as *kv.Redis does
+type Doer interface {
+	Do(args ...string) (interface{}, error)
+}
+
+// Redis is a Store in Redis, shared by every replica using the server
+type Redis struct {
+	client Doer
+}
+
+// NewRedis keeps buckets in the Redis server client talks to
+func NewRedis(client Doer) *Redis {
+	return &Redis{client: client}
+}
+
+// Take implements Store
+func (r *Redis) Take(key string, rate, burst float64, now time.Time) (float64, bool, error) {
+	reply, err := r.client.Do("EVAL", takeScript, "1", key,
+		strconv.FormatFloat(rate, 'f', -1, 64),
+		strconv.FormatFloat(burst, 'f', -1, 64),
+		strconv.FormatFloat(float64(now.UnixMicro())/1e6, 'f', 6, 64))
+	if err != nil {
+		return 0, false, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 2 {
+		return 0, false, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	taken, _ := items[0].(int64)
+	s, _ := items[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	return tokens, taken == 1, nil
+}
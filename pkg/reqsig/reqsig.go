@@ -0,0 +1,78 @@
+// Package reqsig binds a paid request to its exact body. The payer signs
+// the request with personal_sign (EIP-191) from the paying wallet, and may
+// put the body hash in the payment token's bodyHash claim, so a proxy
+// cannot swap the scanned address or transaction after payment.
+//
+// The signed message is
+//
+//	x402-request/v1
+//	<METHOD> <request URI>
+//	<BodyHash of the body>
+//
+// A request paid from a prepaid account instead carries a debit ID, and
+// the payer signs
+//
+//	x402-debit/v1
+//	<METHOD> <request URI>
+//	<BodyHash of the body>
+//	<debit ID>
+package reqsig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+)
+
+// Header carries the hex [r|s|v] signature of Message
+const Header = "X-Request-Signature"
+
+// DebitHeader carries the debit ID of a request paid from a prepaid account
+const DebitHeader = "X-Account-Debit"
+
+// ErrInvalid is returned by Recover for a malformed signature
+var ErrInvalid = errors.New("invalid request signature")
+
+// BodyHash is the hash a request is bound to: "0x" and the hex SHA-256 of
+// the body as sent
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+// Message is the text the payer signs for a request
+func Message(method, requestURI, bodyHash string) []byte {
+	return []byte("x402-request/v1\n" + strings.ToUpper(method) + " " + requestURI + "\n" + strings.ToLower(bodyHash))
+}
+
+// DebitMessage is the text the payer signs for a request paid from a
+// prepaid account
+func DebitMessage(method, requestURI, bodyHash, debitID string) []byte {
+	return []byte("x402-debit/v1\n" + strings.ToUpper(method) + " " + requestURI + "\n" + strings.ToLower(bodyHash) + "\n" + debitID)
+}
+
+// Recover returns the lowercase address that signed the request
+func Recover(signature, method, requestURI string, body []byte) (string, error) {
+	return recoverSigner(signature, Message(method, requestURI, BodyHash(body)))
+}
+
+// RecoverDebit returns the lowercase address that signed the request and
+// its debit ID
+func RecoverDebit(signature, method, requestURI string, body []byte, debitID string) (string, error) {
+	return recoverSigner(signature, DebitMessage(method, requestURI, BodyHash(body), debitID))
+}
+
+func recoverSigner(signature string, message []byte) (string, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "0x"))
+	if err != nil {
+		return "", ErrInvalid
+	}
+	signer, err := ethsig.Recover(ethsig.PersonalHash(message), sig)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	return signer, nil
+}
@@ -0,0 +1,54 @@
+package reqsig
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+)
+
+func TestRecover(t *testing.T) {
+	key, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	body := []byte(`{"address":"0x1111111111111111111111111111111111111111","chain":"base"}`)
+	sig, err := ethsig.Sign(ethsig.PersonalHash(Message("post", "/api/scan-contract", BodyHash(body))), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := "0x" + hex.EncodeToString(sig)
+
+	if got, err := Recover(signature, "POST", "/api/scan-contract", body); err != nil || got != ethsig.Address(key) {
+		t.Errorf("Recover = %s, %v, want %s", got, err, ethsig.Address(key))
+	}
+	// A substituted body or path recovers some other address
+	swapped := []byte(`{"address":"0x2222222222222222222222222222222222222222","chain":"base"}`)
+	if got, _ := Recover(signature, "POST", "/api/scan-contract", swapped); got == ethsig.Address(key) {
+		t.Error("signature valid for another body")
+	}
+	if got, _ := Recover(signature, "POST", "/api/scan-token", body); got == ethsig.Address(key) {
+		t.Error("signature valid for another path")
+	}
+	if _, err := Recover("0xnothex", "POST", "/api/scan-contract", body); err != ErrInvalid {
+		t.Errorf("malformed signature: %v", err)
+	}
+}
+
+func TestRecoverDebit(t *testing.T) {
+	key, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	sig, err := ethsig.Sign(ethsig.PersonalHash(DebitMessage("GET", "/api/gas", BodyHash(nil), "1700000000.a1")), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := "0x" + hex.EncodeToString(sig)
+
+	if got, err := RecoverDebit(signature, "GET", "/api/gas", nil, "1700000000.a1"); err != nil || got != ethsig.Address(key) {
+		t.Errorf("RecoverDebit = %s, %v, want %s", got, err, ethsig.Address(key))
+	}
+	// The signature covers the debit ID, and is no request signature
+	if got, _ := RecoverDebit(signature, "GET", "/api/gas", nil, "1700000000.a2"); got == ethsig.Address(key) {
+		t.Error("signature valid for another debit ID")
+	}
+	if got, _ := Recover(signature, "GET", "/api/gas", nil); got == ethsig.Address(key) {
+		t.Error("debit signature valid as a request signature")
+	}
+}
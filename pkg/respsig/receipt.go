@@ -0,0 +1,83 @@
+package respsig
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// HeaderReceipt carries the receipt of a paid response, base64-encoded JSON
+const HeaderReceipt = "X-Payment-Response"
+
+// ErrReceiptUnsigned is returned by VerifyReceipt for a receipt without a
+// signature
+var ErrReceiptUnsigned = errors.New("receipt is not signed")
+
+// ReceiptMessage builds the byte string a receipt's signature covers:
+//
+//	x402-receipt/v2
+//	<unix timestamp>
+//	<payment ID>
+//	<endpoint>
+//	<network> <transaction>
+//	<payer> <receiver>
+//	<amount> <asset>
+//
+// Receipts without an endpoint are signed as x402-receipt/v1, which has no
+// endpoint line, so receipts issued before endpoints were added still
+// verify.
+func ReceiptMessage(r types.PaymentReceipt) []byte {
+	if r.Endpoint == "" {
+		return []byte(fmt.Sprintf("x402-receipt/v1\n%d\n%s\n%s %s\n%s %s\n%s %s",
+			r.Timestamp, r.ID, r.Network, r.Transaction, r.Payer, r.Receiver, r.Amount, r.Asset))
+	}
+	return []byte(fmt.Sprintf("x402-receipt/v2\n%d\n%s\n%s\n%s %s\n%s %s\n%s %s",
+		r.Timestamp, r.ID, r.Endpoint, r.Network, r.Transaction, r.Payer, r.Receiver, r.Amount, r.Asset))
+}
+
+// SignReceipt sets r's key ID and signature
+func SignReceipt(key ed25519.PrivateKey, r *types.PaymentReceipt) {
+	r.KeyID = KeyID(key.Public().(ed25519.PublicKey))
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, ReceiptMessage(*r)))
+}
+
+// VerifyReceipt checks r's signature against pub
+func VerifyReceipt(pub ed25519.PublicKey, r types.PaymentReceipt) error {
+	if r.Signature == "" {
+		return ErrReceiptUnsigned
+	}
+	if r.KeyID != "" && r.KeyID != KeyID(pub) {
+		return fmt.Errorf("%w: signed by key %s, want %s", ErrInvalid, r.KeyID, KeyID(pub))
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if !ed25519.Verify(pub, ReceiptMessage(r), sig) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// EncodeReceipt returns r as the value of HeaderReceipt
+func EncodeReceipt(r types.PaymentReceipt) string {
+	data, _ := json.Marshal(r)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// DecodeReceipt reads the value of HeaderReceipt
+func DecodeReceipt(s string) (types.PaymentReceipt, error) {
+	var r types.PaymentReceipt
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return r, fmt.Errorf("receipt is not base64: %w", err)
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("receipt is not JSON: %w", err)
+	}
+	return r, nil
+}
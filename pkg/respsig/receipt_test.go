@@ -0,0 +1,69 @@
+package respsig
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+func TestReceipt(t *testing.T) {
+	key := testKey(t)
+	pub := key.Public().(ed25519.PublicKey)
+	receipt := types.PaymentReceipt{
+		Success:   true,
+		ID:        "pay_1",
+		Network:   "base",
+		Payer:     "0x70997970c51812dc3a010c7d01b50e0d17dc79c8",
+		Receiver:  "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91",
+		Amount:    "0.001",
+		Asset:     "USDC",
+		Timestamp: 1700000000,
+	}
+	if err := VerifyReceipt(pub, receipt); !errors.Is(err, ErrReceiptUnsigned) {
+		t.Errorf("unsigned receipt: err = %v", err)
+	}
+
+	SignReceipt(key, &receipt)
+	decoded, err := DecodeReceipt(EncodeReceipt(receipt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != receipt {
+		t.Fatalf("decoded %+v, want %+v", decoded, receipt)
+	}
+	if err := VerifyReceipt(pub, decoded); err != nil {
+		t.Errorf("signed receipt: %v", err)
+	}
+
+	tampered := decoded
+	tampered.Amount = "0.01"
+	if err := VerifyReceipt(pub, tampered); !errors.Is(err, ErrInvalid) {
+		t.Errorf("tampered receipt: err = %v", err)
+	}
+	other := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)).Public().(ed25519.PublicKey)
+	if err := VerifyReceipt(other, decoded); !errors.Is(err, ErrInvalid) {
+		t.Errorf("receipt checked with another key: err = %v", err)
+	}
+
+	// A receipt naming its endpoint is signed over it
+	receipt.Endpoint = "/api/gas"
+	SignReceipt(key, &receipt)
+	if err := VerifyReceipt(pub, receipt); err != nil {
+		t.Errorf("receipt with an endpoint: %v", err)
+	}
+	moved := receipt
+	moved.Endpoint = "/api/scan-wallet"
+	if err := VerifyReceipt(pub, moved); !errors.Is(err, ErrInvalid) {
+		t.Errorf("receipt moved to another endpoint: err = %v", err)
+	}
+	moved.Endpoint = ""
+	if err := VerifyReceipt(pub, moved); !errors.Is(err, ErrInvalid) {
+		t.Errorf("receipt stripped of its endpoint: err = %v", err)
+	}
+
+	if _, err := DecodeReceipt("not base64!"); err == nil {
+		t.Error("invalid header decoded")
+	}
+}
@@ -0,0 +1,142 @@
+// Package respsig signs and verifies paid API responses. A signature is
+// detached: it travels in response headers and covers the request, a
+// timestamp and the canonicalized body, so a client can keep the body and
+// headers and later prove to a third party what the service returned.
+//
+// The signed message is
+//
+//	x402-response/v1
+//	<unix timestamp>
+//	<METHOD> <request URI>
+//	<hex SHA-256 of the canonical body>
+//
+// JSON bodies are canonicalized by sorting object keys and removing
+// insignificant whitespace, with numbers kept exactly as written. Other
+// bodies (MessagePack, CSV) are signed as sent.
+//
+// The payment receipt in a paid response's X-Payment-Response header is
+// signed with the same key, over ReceiptMessage.
+package respsig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alg is the only signature algorithm in use
+const Alg = "ed25519"
+
+// Response headers carrying a signature
+const (
+	HeaderSignature = "X-Response-Signature"           // base64 signature
+	HeaderTimestamp = "X-Response-Signature-Timestamp" // unix seconds
+	HeaderKeyID     = "X-Response-Signature-Key"       // KeyID of the signing key
+)
+
+// ErrUnsigned is returned by Verify for a response without a signature
+var ErrUnsigned = errors.New("response is not signed")
+
+// ErrInvalid is returned by Verify when the signature does not match
+var ErrInvalid = errors.New("invalid response signature")
+
+// KeyID identifies a public key: the first 8 bytes of its SHA-256, in hex
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParsePrivateKey reads a 32-byte Ed25519 seed given as hex or base64
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	s = strings.TrimSpace(s)
+	seed, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		seed, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be a %d-byte Ed25519 seed in hex or base64", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Canonical returns the form of body that is hashed. JSON is re-encoded
+// with sorted keys and no whitespace; anything else is returned unchanged.
+func Canonical(contentType string, body []byte) ([]byte, error) {
+	if !strings.Contains(strings.ToLower(contentType), "json") {
+		return body, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, fmt.Errorf("canonicalizing JSON body: %w", err)
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(tree); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+// Message builds the byte string that is signed
+func Message(timestamp int64, method, requestURI, contentType string, body []byte) ([]byte, error) {
+	canonical, err := Canonical(contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(canonical)
+	return []byte(fmt.Sprintf("x402-response/v1\n%d\n%s %s\n%s", timestamp, method, requestURI, hex.EncodeToString(sum[:]))), nil
+}
+
+// Sign sets the signature headers on h for a response to method requestURI
+// with the given body. Content-Type must already be set on h.
+func Sign(key ed25519.PrivateKey, h http.Header, at time.Time, method, requestURI string, body []byte) error {
+	ts := at.Unix()
+	msg, err := Message(ts, method, requestURI, h.Get("Content-Type"), body)
+	if err != nil {
+		return err
+	}
+	h.Set(HeaderSignature, base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg)))
+	h.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	h.Set(HeaderKeyID, KeyID(key.Public().(ed25519.PublicKey)))
+	return nil
+}
+
+// Verify checks the signature headers in h against pub for a response to
+// method requestURI with the given body. It returns the signing time.
+func Verify(pub ed25519.PublicKey, h http.Header, method, requestURI string, body []byte) (time.Time, error) {
+	encoded := h.Get(HeaderSignature)
+	if encoded == "" {
+		return time.Time{}, ErrUnsigned
+	}
+	if id := h.Get(HeaderKeyID); id != "" && id != KeyID(pub) {
+		return time.Time{}, fmt.Errorf("%w: signed by key %s, want %s", ErrInvalid, id, KeyID(pub))
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	ts, err := strconv.ParseInt(h.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: bad timestamp", ErrInvalid)
+	}
+	msg, err := Message(ts, method, requestURI, h.Get("Content-Type"), body)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		return time.Time{}, ErrInvalid
+	}
+	return time.Unix(ts, 0), nil
+}
@@ -0,0 +1,78 @@
+package respsig
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	key, err := ParsePrivateKey(strings.Repeat("01", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSignVerify(t *testing.T) {
+	key := testKey(t)
+	pub := key.Public().(ed25519.PublicKey)
+	at := time.Unix(1700000000, 0)
+	body := []byte(`{"data":{"gas":{"fast":24.5,"slow":18}},"payment_verified":true}` + "\n")
+
+	h := http.Header{"Content-Type": {"application/json"}}
+	if err := Sign(key, h, at, "GET", "/api/gas?unit=gwei", body); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Verify(pub, h, "GET", "/api/gas?unit=gwei", body); err != nil || !got.Equal(at) {
+		t.Fatalf("Verify = %v, %v", got, err)
+	}
+
+	// Re-serialized JSON with other key order and whitespace still verifies
+	reformatted := []byte(`{ "payment_verified": true, "data": { "gas": { "slow": 18, "fast": 24.5 } } }`)
+	if _, err := Verify(pub, h, "GET", "/api/gas?unit=gwei", reformatted); err != nil {
+		t.Errorf("canonical form not used: %v", err)
+	}
+
+	tampered := []byte(`{"data":{"gas":{"fast":2.5,"slow":18}},"payment_verified":true}`)
+	for name, check := range map[string]func() error{
+		"body":    func() error { _, err := Verify(pub, h, "GET", "/api/gas?unit=gwei", tampered); return err },
+		"request": func() error { _, err := Verify(pub, h, "GET", "/api/gas?unit=wei", body); return err },
+		"key": func() error {
+			other := ed25519.NewKeyFromSeed(make([]byte, 32)).Public().(ed25519.PublicKey)
+			_, err := Verify(other, h, "GET", "/api/gas?unit=gwei", body)
+			return err
+		},
+	} {
+		if err := check(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("tampered %s: err = %v, want ErrInvalid", name, err)
+		}
+	}
+
+	if _, err := Verify(pub, http.Header{}, "GET", "/api/gas", body); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned response: err = %v", err)
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	hexKey, err := ParsePrivateKey("0x" + strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64Key, err := ParsePrivateKey("q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hexKey.Equal(b64Key) {
+		t.Error("hex and base64 forms of the same seed differ")
+	}
+	for _, bad := range []string{"", "abcd", strings.Repeat("zz", 32)} {
+		if _, err := ParsePrivateKey(bad); err == nil {
+			t.Errorf("ParsePrivateKey(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogExporter writes each span as one JSON log line
+type LogExporter struct{}
+
+func (LogExporter) Export(s SpanData) {
+	line := map[string]interface{}{
+		"trace_id":    s.Context.TraceID.String(),
+		"span_id":     s.Context.SpanID.String(),
+		"name":        s.Name,
+		"duration_ms": float64(s.End.Sub(s.Start).Microseconds()) / 1000,
+	}
+	if !s.Parent.IsZero() {
+		line["parent_id"] = s.Parent.String()
+	}
+	if len(s.Attributes) > 0 {
+		line["attributes"] = s.Attributes
+	}
+	if s.Status == StatusError {
+		line["error"] = s.Message
+	}
+	data, _ := json.Marshal(line)
+	log.Printf("🔭 span %s", data)
+}
+
+// OTLPExporter batches spans and posts them to an OpenTelemetry collector
+// using OTLP/HTTP with JSON encoding
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+	spans   chan SpanData
+}
+
+// NewOTLPExporter exports to endpoint (e.g. http://localhost:4318) as
+// service, flushing every interval. Spans are dropped if the collector
+// falls behind.
+func NewOTLPExporter(endpoint, service string, interval time.Duration) *OTLPExporter {
+	e := &OTLPExporter{
+		url:     strings.TrimRight(endpoint, "/") + "/v1/traces",
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		spans:   make(chan SpanData, 4096),
+	}
+	go e.run(interval)
+	return e
+}
+
+func (e *OTLPExporter) Export(s SpanData) {
+	select {
+	case e.spans <- s:
+	default:
+	}
+}
+
+func (e *OTLPExporter) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	for {
+		select {
+		case s := <-e.spans:
+			if batch = append(batch, s); len(batch) < 512 {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := e.post(batch); err != nil {
+			log.Printf("⚠️  Trace export failed, dropped %d spans: %v", len(batch), err)
+		}
+		batch = nil
+	}
+}
+
+func (e *OTLPExporter) post(batch []SpanData) error {
+	body, err := json.Marshal(OTLPRequest(e.service, batch))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLPRequest builds an ExportTraceServiceRequest in OTLP's JSON encoding
+func OTLPRequest(service string, spans []SpanData) map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		keys := make([]string, 0, len(s.Attributes))
+		for k := range s.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := make([]map[string]interface{}, 0, len(keys))
+		for _, k := range keys {
+			attrs = append(attrs, stringAttr(k, s.Attributes[k]))
+		}
+
+		kind := 1 // SPAN_KIND_INTERNAL
+		if s.Server {
+			kind = 2 // SPAN_KIND_SERVER
+		}
+		span := map[string]interface{}{
+			"traceId":           s.Context.TraceID.String(),
+			"spanId":            s.Context.SpanID.String(),
+			"name":              s.Name,
+			"kind":              kind,
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        attrs,
+			"status":            map[string]interface{}{"code": s.Status, "message": s.Message},
+		}
+		if !s.Parent.IsZero() {
+			span["parentSpanId"] = s.Parent.String()
+		}
+		out = append(out, span)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []interface{}{stringAttr("service.name", service)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": service},
+				"spans": out,
+			}},
+		}},
+	}
+}
+
+func stringAttr(key, value string) map[string]interface{} {
+	return map[string]interface{}{"key": key, "value": map[string]string{"stringValue": value}}
+}
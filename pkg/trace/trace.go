@@ -0,0 +1,243 @@
+// Package trace records spans for the payment lifecycle and propagates
+// them with W3C Trace Context (the traceparent header), so one payment
+// can be followed from its 402 challenge to its ledger write, and into
+// any upstream or facilitator that continues the trace.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// Header is the W3C Trace Context propagation header
+const Header = "traceparent"
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsZero reports whether t is the invalid all-zero ID
+func (t TraceID) IsZero() bool { return t == TraceID{} }
+
+// IsZero reports whether s is the invalid all-zero ID
+func (s SpanID) IsZero() bool { return s == SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Traceparent formats sc as a version 00 traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent reads a traceparent header value. Unknown future
+// versions are accepted as long as the version 00 fields parse.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || sc.TraceID.IsZero() {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || sc.SpanID.IsZero() {
+		return sc, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// Status codes, as in OpenTelemetry
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Span is one timed operation. Spans are safe for concurrent use.
+type Span struct {
+	Name    string
+	Context SpanContext
+	Parent  SpanID // zero for a root span
+	Server  bool   // the span handles an incoming request
+	Start   time.Time
+
+	mu      sync.Mutex
+	end     time.Time
+	attrs   map[string]string
+	status  int
+	message string
+	tracer  *Tracer
+}
+
+// SetAttr records a string attribute
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]string)
+	}
+	s.attrs[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.message = StatusError, message
+}
+
+// End finishes the span and hands it to the exporter. Only the first call
+// has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = s.tracer.clock.Now()
+	s.mu.Unlock()
+	if s.Context.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(s.Snapshot())
+	}
+}
+
+// Snapshot returns the finished span's data
+func (s *Span) Snapshot() SpanData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attrs := make(map[string]string, len(s.attrs))
+	for k, v := range s.attrs {
+		attrs[k] = v
+	}
+	return SpanData{
+		Name:       s.Name,
+		Context:    s.Context,
+		Parent:     s.Parent,
+		Server:     s.Server,
+		Start:      s.Start,
+		End:        s.end,
+		Attributes: attrs,
+		Status:     s.status,
+		Message:    s.message,
+	}
+}
+
+// SpanData is an exported span
+type SpanData struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanID
+	Server     bool
+	Start, End time.Time
+	Attributes map[string]string
+	Status     int
+	Message    string
+}
+
+// Exporter receives finished, sampled spans. Export must not block.
+type Exporter interface {
+	Export(SpanData)
+}
+
+// Tracer starts spans. A Tracer without an exporter still assigns IDs, so
+// trace IDs can be logged and echoed even when nothing is exported.
+type Tracer struct {
+	exporter Exporter
+	clock    clock.Clock
+}
+
+// New creates a tracer sending spans to exporter, which may be nil
+func New(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter, clock: clock.System}
+}
+
+type spanKey struct{}
+
+// FromContext returns the span in ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins a span named name, a child of the span in ctx if any
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{Name: name, Start: t.clock.Now(), tracer: t}
+	if parent := FromContext(ctx); parent != nil {
+		s.Context = SpanContext{TraceID: parent.Context.TraceID, Sampled: parent.Context.Sampled}
+		s.Parent = parent.Context.SpanID
+	} else {
+		rand.Read(s.Context.TraceID[:])
+		s.Context.Sampled = true
+	}
+	rand.Read(s.Context.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// StartServer begins a server span for r, continuing the caller's trace
+// when r carries a valid traceparent header
+func (t *Tracer) StartServer(r *http.Request, name string) (context.Context, *Span) {
+	return t.Continue(r.Context(), r.Header.Get(Header), name)
+}
+
+// Continue begins a server span for a request received with the given
+// traceparent value, starting a new trace if it is empty or invalid. It
+// serves transports other than HTTP, such as gRPC metadata.
+func (t *Tracer) Continue(ctx context.Context, traceparent, name string) (context.Context, *Span) {
+	remote, ok := ParseTraceparent(traceparent)
+	if !ok {
+		ctx, s := t.Start(ctx, name)
+		s.Server = true
+		return ctx, s
+	}
+	s := &Span{Name: name, Server: true, Start: t.clock.Now(), tracer: t, Parent: remote.SpanID}
+	s.Context = SpanContext{TraceID: remote.TraceID, Sampled: remote.Sampled}
+	rand.Read(s.Context.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Inject sets the traceparent header on an outgoing request from the span
+// in its context
+func Inject(req *http.Request) {
+	if s := FromContext(req.Context()); s != nil {
+		req.Header.Set(Header, s.Context.Traceparent())
+	}
+}
@@ -0,0 +1,145 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector keeps exported spans
+type collector struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (c *collector) Export(s SpanData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = append(c.spans, s)
+}
+
+func TestTraceparent(t *testing.T) {
+	const example = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(example)
+	if !ok || !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("ParseTraceparent = %+v, %v", sc, ok)
+	}
+	if got := sc.Traceparent(); got != example {
+		t.Errorf("Traceparent() = %s", got)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", // zero trace ID
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", // zero span ID
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", // invalid version
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-xyz92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("ParseTraceparent accepted %q", bad)
+		}
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"); !ok {
+		t.Error("future version with extra fields rejected")
+	}
+}
+
+func TestSpanTree(t *testing.T) {
+	c := &collector{}
+	tracer := New(c)
+
+	req := httptest.NewRequest("GET", "/api/gas", nil)
+	req.Header.Set(Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := tracer.StartServer(req, "payment")
+	_, child := tracer.Start(ctx, "verify")
+	child.SetAttr("payer", "0xabc")
+	child.SetError("bad token")
+	child.End()
+	child.End() // only exported once
+	root.End()
+
+	if len(c.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(c.spans))
+	}
+	verify, payment := c.spans[0], c.spans[1]
+	if payment.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || payment.Parent.String() != "00f067aa0ba902b7" || !payment.Server {
+		t.Errorf("server span did not continue the caller's trace: %+v", payment)
+	}
+	if verify.Context.TraceID != payment.Context.TraceID || verify.Parent != payment.Context.SpanID {
+		t.Errorf("child not linked to its parent: %+v", verify)
+	}
+	if verify.Attributes["payer"] != "0xabc" || verify.Status != StatusError || verify.Message != "bad token" {
+		t.Errorf("child span = %+v", verify)
+	}
+
+	// An unsampled caller's trace is followed but not exported
+	req.Header.Set(Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, quiet := tracer.StartServer(req, "payment")
+	quiet.End()
+	if len(c.spans) != 2 {
+		t.Error("unsampled span exported")
+	}
+
+	// A request without a traceparent starts a new trace
+	_, fresh := tracer.StartServer(httptest.NewRequest("GET", "/", nil), "payment")
+	if fresh.Context.TraceID.IsZero() || !fresh.Parent.IsZero() || !fresh.Context.Sampled {
+		t.Errorf("new root span = %+v", fresh.Context)
+	}
+}
+
+func TestInject(t *testing.T) {
+	ctx, span := New(nil).Start(context.Background(), "proxy")
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://upstream/", nil)
+	Inject(req)
+	if got, ok := ParseTraceparent(req.Header.Get(Header)); !ok || got != span.Context {
+		t.Errorf("injected %q", req.Header.Get(Header))
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("export to %s as %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body
+	}))
+	defer srv.Close()
+
+	tracer := New(NewOTLPExporter(srv.URL, "x402-test", 10*time.Millisecond))
+	ctx, root := tracer.Start(context.Background(), "payment")
+	root.SetAttr("payment.id", "pay_1")
+	_, child := tracer.Start(ctx, "capture")
+	child.End()
+	root.End()
+
+	var body map[string]interface{}
+	select {
+	case body = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no export received")
+	}
+	rs := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	service := rs["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if service["value"].(map[string]interface{})["stringValue"] != "x402-test" {
+		t.Errorf("resource = %v", rs["resource"])
+	}
+	spans := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans", len(spans))
+	}
+	capture, payment := spans[0].(map[string]interface{}), spans[1].(map[string]interface{})
+	if capture["parentSpanId"] != payment["spanId"] || capture["traceId"] != root.Context.TraceID.String() {
+		t.Errorf("spans not linked: %v / %v", capture, payment)
+	}
+	if _, ok := payment["parentSpanId"]; ok {
+		t.Error("root span has a parent")
+	}
+}
@@ -0,0 +1,388 @@
+// Package types holds the x402 wire formats shared by the server, the
+// generate/verify CLIs and the Go client, so they cannot drift apart.
+package types
+
+import "github.com/golang-jwt/jwt/v5"
+
+// ==================== PAYMENT ====================
+
+// PaymentClaims is the payment section of a PaymentToken
+type PaymentClaims struct {
+	Amount   string `json:"amount"`
+	Asset    string `json:"asset"`
+	Receiver string `json:"receiver"`
+	Network  string `json:"network"`
+	Nonce    string `json:"nonce,omitempty"`    // echoed from the 402 challenge
+	Referrer string `json:"referrer,omitempty"` // ERC-8004 agent ID that referred the payer
+	BodyHash string `json:"bodyHash,omitempty"` // binds the payment to one request body, see pkg/reqsig
+	Method   string `json:"method,omitempty"`   // binds the payment to one HTTP method
+	Path     string `json:"path,omitempty"`     // binds the payment to one endpoint, as named in the requirement's resource
+	TxHash   string `json:"txHash,omitempty"`   // the on-chain transfer that paid, when the server verifies settlement
+}
+
+// PaymentToken represents the JWT token structure for x402 payments
+type PaymentToken struct {
+	Payment PaymentClaims `json:"payment"`
+	jwt.RegisteredClaims
+}
+
+// PaymentRequirement is what the server sends in 402 responses
+type PaymentRequirement struct {
+	Scheme      string `json:"scheme"`
+	Network     string `json:"network"`
+	MaxAmount   string `json:"maxAmount"`
+	MinAmount   string `json:"minAmount"`
+	Asset       string `json:"asset"`
+	Receiver    string `json:"receiver"`
+	Description string `json:"description"`
+	FiatPrice   string `json:"fiatPrice,omitempty"` // e.g. "0.001 USD" when the amount is converted from fiat
+	// Resource is the endpoint the requirement pays for
+	Resource string `json:"resource,omitempty"`
+	// AssetAddress is the asset's token contract on Network, where known
+	AssetAddress string `json:"assetAddress,omitempty"`
+	// Nonce must be echoed in the payment before NonceExpiresAt (unix
+	// seconds), when the server issues one
+	Nonce          string `json:"nonce,omitempty"`
+	NonceExpiresAt int64  `json:"nonceExpiresAt,omitempty"`
+	// RequestSignature is "required" when the paid request must be signed
+	// by the payer (X-Request-Signature)
+	RequestSignature string `json:"requestSignature,omitempty"`
+	// Audience must appear in the token's aud claim, when the server
+	// validates payments strictly
+	Audience string `json:"audience,omitempty"`
+	// Settlement is "onchain" when the token must name, in txHash, a
+	// transfer with at least Confirmations confirmations
+	Settlement    string `json:"settlement,omitempty"`
+	Confirmations int64  `json:"confirmations,omitempty"`
+	// MaxAmountRequired is MaxAmount in the asset's smallest unit, and
+	// Extra the EIP-712 domain authorizations are signed for, in "exact"
+	// scheme requirements
+	MaxAmountRequired string       `json:"maxAmountRequired,omitempty"`
+	Extra             *SchemeExtra `json:"extra,omitempty"`
+}
+
+// SchemeExtra is the EIP-712 domain of the asset contract that "exact"
+// scheme payments are authorized on
+type SchemeExtra struct {
+	Name              string `json:"name"`
+	Version           string `json:"version"`
+	ChainID           int64  `json:"chainId"`
+	VerifyingContract string `json:"verifyingContract"`
+}
+
+// ExactPayment is the X-PAYMENT header of the x402 "exact" scheme, sent as
+// base64-encoded JSON: an EIP-3009 transferWithAuthorization of the
+// payment, signed by the payer under EIP-712
+type ExactPayment struct {
+	X402Version int          `json:"x402Version"`
+	Scheme      string       `json:"scheme"` // "exact"
+	Network     string       `json:"network"`
+	Payload     ExactPayload `json:"payload"`
+}
+
+// ExactPayload is a signed transfer authorization
+type ExactPayload struct {
+	Signature     string                `json:"signature"` // 0x-prefixed 65-byte EIP-712 signature
+	Authorization TransferAuthorization `json:"authorization"`
+}
+
+// TransferAuthorization is the EIP-3009 TransferWithAuthorization message.
+// Value is in the asset's smallest unit, ValidAfter and ValidBefore are
+// unix seconds, all as decimal strings.
+type TransferAuthorization struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Value       string `json:"value"`
+	ValidAfter  string `json:"validAfter"`
+	ValidBefore string `json:"validBefore"`
+	Nonce       string `json:"nonce"` // 0x-prefixed bytes32
+}
+
+// PaymentReceipt is the settlement response sent base64-encoded in the
+// X-PAYMENT-RESPONSE header of every response that captured a payment, so
+// the client can prove it paid. It is signed when the server signs
+// responses (see pkg/respsig).
+type PaymentReceipt struct {
+	Success     bool   `json:"success"`
+	ID          string `json:"id"`                    // the payment's X-Payment-Id
+	Endpoint    string `json:"endpoint,omitempty"`    // the paid endpoint; receipts with one are signed as x402-receipt/v2
+	Transaction string `json:"transaction,omitempty"` // the on-chain transfer, if known when the response was sent
+	Network     string `json:"network"`
+	Payer       string `json:"payer"`
+	Receiver    string `json:"receiver"`
+	Amount      string `json:"amount"`
+	Asset       string `json:"asset"`
+	Timestamp   int64  `json:"timestamp"` // unix seconds
+	KeyID       string `json:"keyId,omitempty"`
+	Signature   string `json:"signature,omitempty"` // base64 Ed25519 signature
+}
+
+// AssetStatus reports whether an accepted stablecoin holds its peg
+type AssetStatus struct {
+	Asset     string  `json:"asset"`
+	PriceUSD  float64 `json:"priceUsd"`
+	Depegged  bool    `json:"depegged"`
+	Paused    bool    `json:"paused"` // payments in the asset are refused
+	CheckedAt int64   `json:"checkedAt"`
+}
+
+// X402Config is the /.well-known/x402 discovery document
+type X402Config struct {
+	Version             string               `json:"version"`
+	PaymentRequirements []PaymentRequirement `json:"paymentRequirements"`
+	Assets              []AssetStatus        `json:"assets,omitempty"`
+}
+
+// ==================== DATA APIS ====================
+
+// Data quality levels reported by the data endpoints
+const (
+	QualityLive     = "live"     // fetched from upstream for this request
+	QualityStale    = "stale"    // last good upstream value, re-served after a failure
+	QualityFallback = "fallback" // hardcoded estimate, no upstream data available
+	QualityCached   = "cached"   // served from a response cache within its TTL
+)
+
+// DataQuality describes how fresh a data response is
+type DataQuality struct {
+	Quality          string `json:"data_quality"`
+	StalenessSeconds int64  `json:"staleness_seconds"`
+}
+
+// Freshness returns the quality of the data it is embedded in
+func (q DataQuality) Freshness() DataQuality {
+	return q
+}
+
+// ResponseMeta is the freshness contract carried by every paid response, so
+// clients can reject data older than they can use
+type ResponseMeta struct {
+	GeneratedAt           int64  `json:"generated_at"`            // unix time the data was fetched upstream
+	CacheAgeSeconds       int64  `json:"cache_age_seconds"`       // seconds since GeneratedAt
+	Source                string `json:"source"`                  // live, cached, stale or fallback
+	StalenessLimitSeconds int64  `json:"staleness_limit_seconds"` // oldest data the endpoint serves
+}
+
+// GasData represents current gas prices
+type GasData struct {
+	Timestamp int64              `json:"timestamp"`
+	Gas       map[string]float64 `json:"gas"`
+	Unit      string             `json:"unit"`
+	Source    string             `json:"source"`
+	Chain     string             `json:"chain,omitempty"` // set unless ethereum
+
+	// OP-stack chains such as Base also charge for posting a transaction
+	// to Ethereum. Costs are what reference transactions cost to send,
+	// both fees included, by kind (eth_transfer, erc20_transfer).
+	L1BaseFeeGwei   float64            `json:"l1_base_fee_gwei,omitempty"`
+	BlobBaseFeeGwei float64            `json:"blob_base_fee_gwei,omitempty"`
+	Costs           map[string]*TxCost `json:"costs,omitempty"`
+	DataQuality
+}
+
+// TxCost is what a transaction costs to send at the recommended fees. On
+// OP-stack chains the L1 data fee, charged for posting the transaction to
+// Ethereum, comes on top of the execution fee and often dwarfs it.
+type TxCost struct {
+	Gas          uint64  `json:"gas"`
+	ExecutionFee string  `json:"execution_fee"`         // wei, gas at the next base fee plus the tip
+	L1DataFee    string  `json:"l1_data_fee,omitempty"` // wei, OP-stack chains only
+	TotalFee     string  `json:"total_fee"`             // wei
+	TotalFeeETH  float64 `json:"total_fee_eth"`
+}
+
+// ValidatorData represents validator queue status
+type ValidatorData struct {
+	Timestamp       int64                  `json:"timestamp"`
+	AsOf            int64                  `json:"as_of"` // unix time the beacon state was read
+	Queue           map[string]interface{} `json:"queue"`
+	Active          int                    `json:"active_validators"`
+	PendingDeposits int                    `json:"pending_deposits"`
+	DataQuality
+}
+
+// PriceData represents ETH price information
+type PriceData struct {
+	Timestamp int64              `json:"timestamp"`
+	Eth       float64            `json:"eth_usd"`
+	Sources   map[string]float64 `json:"sources"`
+	Average   float64            `json:"average_usd"`
+	Change24h float64            `json:"change_24h_percent"`
+	// Set when a currency other than USD was requested
+	Currency string  `json:"currency,omitempty"`
+	EthPrice float64 `json:"eth_price,omitempty"`
+	FXRate   float64 `json:"usd_fx_rate,omitempty"` // units of Currency per USD
+	DataQuality
+}
+
+// ==================== SECURITY APIS ====================
+
+// ContractScanRequest represents the input for contract scanning
+type ContractScanRequest struct {
+	Address string `json:"address"`
+	Chain   string `json:"chain"` // "base" or "ethereum"
+}
+
+// Scoring is how a risk score was computed: the scoring model's version, a
+// hash of the operator's rules it applied and when each data source it
+// read was read. Scores with the same model version and ruleset hash were
+// computed the same way, so they differ only by their data.
+type Scoring struct {
+	ModelVersion string           `json:"model_version"`
+	RulesetHash  string           `json:"ruleset_hash"`
+	DataSources  map[string]int64 `json:"data_sources"` // source -> unix seconds
+}
+
+// ContractScanResult represents the output of contract scanning
+type ContractScanResult struct {
+	Address    string   `json:"address"`
+	Chain      string   `json:"chain"`
+	RiskScore  int      `json:"risk_score"` // 0-100
+	IsVerified bool     `json:"is_verified"`
+	IsProxy    bool     `json:"is_proxy"`
+	IsHoneypot bool     `json:"is_honeypot"`
+	Known      string   `json:"known_contract,omitempty"` // name of a recognized protocol contract
+	Deployer   string   `json:"deployer,omitempty"`
+	CreationTx string   `json:"creation_tx,omitempty"`
+	DeployedAt int64    `json:"deployed_at,omitempty"` // unix seconds
+	AgeDays    *int     `json:"age_days,omitempty"`
+	Flags      []string `json:"flags"`
+	Warnings   []string `json:"warnings"`
+	Cached     bool     `json:"cached"`
+	CachedAt   int64    `json:"cached_at,omitempty"`
+	ScannedAt  int64    `json:"scanned_at"`
+	Scoring
+}
+
+// AgentScoreRequest represents the input for agent scoring
+type AgentScoreRequest struct {
+	AgentID string `json:"agent_id"` // ERC-8004 agent ID or wallet address
+}
+
+// AgentScoreResult represents the output of agent scoring
+type AgentScoreResult struct {
+	AgentID          string   `json:"agent_id"`
+	SecurityScore    int      `json:"security_score"` // 0-100
+	HasSecurityStack bool     `json:"has_security_stack"`
+	FailedTxRate     float64  `json:"failed_tx_rate"`
+	RegistrationDays int      `json:"registration_days"`
+	FeedbackRating   float64  `json:"feedback_rating"`
+	Factors          []string `json:"factors"`
+	ScoredAt         int64    `json:"scored_at"`
+	Scoring
+}
+
+// TxPreflightRequest represents the input for transaction pre-flight. A
+// request carries either a plain transaction or a user operation.
+type TxPreflightRequest struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"` // in wei, 0x-hex or decimal
+	Data  string `json:"data"`  // hex encoded
+
+	UserOperation *UserOperation `json:"user_operation,omitempty"`
+	EntryPoint    string         `json:"entry_point,omitempty"` // defaults to the v0.7 EntryPoint
+
+	// Chain the transaction will be sent on, as the operator's policies
+	// see it; defaults to ethereum
+	Chain string `json:"chain,omitempty"`
+	// Policies names the operator's policies to apply; all by default
+	Policies []string `json:"policies,omitempty"`
+}
+
+// UserOperation is an ERC-4337 v0.7 user operation in the unpacked form
+// bundlers accept over JSON-RPC. Quantities are 0x-hex strings.
+type UserOperation struct {
+	Sender                        string `json:"sender"`
+	Nonce                         string `json:"nonce"`
+	Factory                       string `json:"factory,omitempty"`
+	FactoryData                   string `json:"factoryData,omitempty"`
+	CallData                      string `json:"callData"`
+	CallGasLimit                  string `json:"callGasLimit"`
+	VerificationGasLimit          string `json:"verificationGasLimit"`
+	PreVerificationGas            string `json:"preVerificationGas"`
+	MaxFeePerGas                  string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas          string `json:"maxPriorityFeePerGas"`
+	Paymaster                     string `json:"paymaster,omitempty"`
+	PaymasterVerificationGasLimit string `json:"paymasterVerificationGasLimit,omitempty"`
+	PaymasterPostOpGasLimit       string `json:"paymasterPostOpGasLimit,omitempty"`
+	PaymasterData                 string `json:"paymasterData,omitempty"`
+	Signature                     string `json:"signature"`
+}
+
+// UserOperationGas is a bundler's gas estimate for a user operation
+type UserOperationGas struct {
+	PreVerificationGas            uint64 `json:"pre_verification_gas"`
+	VerificationGasLimit          uint64 `json:"verification_gas_limit"`
+	CallGasLimit                  uint64 `json:"call_gas_limit"`
+	PaymasterVerificationGasLimit uint64 `json:"paymaster_verification_gas_limit"`
+	PaymasterPostOpGasLimit       uint64 `json:"paymaster_post_op_gas_limit"`
+	Total                         uint64 `json:"total"`
+}
+
+// TxPreflightResult represents the output of transaction pre-flight
+type TxPreflightResult struct {
+	Safe              bool               `json:"safe"`
+	RiskScore         int                `json:"risk_score"` // 0-100
+	SimulationSuccess bool               `json:"simulation_success"`
+	GasEstimate       string             `json:"gas_estimate"`
+	UserOperationGas  *UserOperationGas  `json:"user_operation_gas,omitempty"`
+	Bridge            *BridgeInfo        `json:"bridge,omitempty"`
+	Fees              *FeeRecommendation `json:"fees,omitempty"`
+	Cost              *TxCost            `json:"cost,omitempty"` // at Fees, with the L1 data fee on OP-stack chains
+	Warnings          []string           `json:"warnings"`
+	Errors            []string           `json:"errors"`
+	Recommendations   []string           `json:"recommendations"`
+	PolicyViolations  []string           `json:"policy_violations,omitempty"` // the payer's watch list, see /api/watchlist
+	Policies          []PolicyDecision   `json:"policies,omitempty"`          // the operator's transaction policies
+	CheckedAt         int64              `json:"checked_at"`
+	Scoring
+}
+
+// PolicyDecision is how one of the operator's transaction policies rules
+// on a transaction
+type PolicyDecision struct {
+	Policy   string   `json:"policy"`
+	Decision string   `json:"decision"` // allow, needs_review or deny
+	Reasons  []string `json:"reasons"`  // why it is not allowed outright
+}
+
+// BridgeInfo describes the bridge a transaction interacts with
+type BridgeInfo struct {
+	Name     string `json:"name,omitempty"`
+	Kind     string `json:"kind"`               // canonical, third_party or unregistered
+	Method   string `json:"method,omitempty"`   // bridge method called, if recognized
+	Verified *bool  `json:"verified,omitempty"` // source verified on the explorer; unregistered bridges only
+	AgeDays  *int   `json:"age_days,omitempty"` // days since deployment; unregistered bridges only
+}
+
+// FeeRecommendation is EIP-1559 fee guidance for sending a transaction
+type FeeRecommendation struct {
+	BaseFeeGwei              float64 `json:"base_fee_gwei"`            // next block's base fee
+	BaseFeePerGas            string  `json:"base_fee_per_gas"`         // wei
+	MaxFeePerGas             string  `json:"max_fee_per_gas"`          // wei
+	MaxPriorityFeePerGas     string  `json:"max_priority_fee_per_gas"` // wei
+	MaxFeePerGasGwei         float64 `json:"max_fee_per_gas_gwei"`
+	MaxPriorityFeePerGasGwei float64 `json:"max_priority_fee_per_gas_gwei"`
+	BaseFeeTrend             string  `json:"base_fee_trend"` // rising, falling, steady or unknown
+	Timing                   string  `json:"timing"`         // send_now or wait
+	Reason                   string  `json:"reason"`
+}
+
+// PromptTestRequest represents the input for prompt injection testing
+type PromptTestRequest struct {
+	Prompt string `json:"prompt"`
+}
+
+// PromptTestResult represents the output of prompt testing
+type PromptTestResult struct {
+	Prompt      string   `json:"prompt"`
+	RiskScore   int      `json:"risk_score"` // 0-100
+	Safe        bool     `json:"safe"`
+	ThreatLevel string   `json:"threat_level"`
+	Patterns    []string `json:"patterns"`
+	Detections  []string `json:"detections"`
+	Warnings    []string `json:"warnings"`
+	TestedAt    int64    `json:"tested_at"`
+	Scoring
+}
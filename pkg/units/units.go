@@ -0,0 +1,109 @@
+// Package units provides arbitrary-precision wei arithmetic. Values are
+// carried as *big.Int so amounts above int64 range (~9.2 ETH) are handled
+// correctly.
+package units
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+var (
+	// Wei is one wei
+	Wei = big.NewInt(1)
+	// Gwei is 1e9 wei
+	Gwei = big.NewInt(1_000_000_000)
+	// Ether is 1e18 wei
+	Ether = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	// MaxUint256 is 2^256 - 1, the value used for unlimited approvals
+	MaxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+)
+
+// ErrInvalid is returned for values that are neither 0x-hex nor decimal
+var ErrInvalid = errors.New("invalid wei value")
+
+// ErrOverflow is returned for values larger than uint256
+var ErrOverflow = errors.New("wei value exceeds uint256")
+
+// ParseWei parses a wei amount given as 0x-prefixed hex (as in JSON-RPC) or
+// as a plain decimal string. The empty string and "0x" parse as zero.
+func ParseWei(s string) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return new(big.Int), nil
+	}
+
+	var v *big.Int
+	var ok bool
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		digits := s[2:]
+		if digits == "" {
+			return new(big.Int), nil
+		}
+		v, ok = new(big.Int).SetString(digits, 16)
+	} else {
+		v, ok = new(big.Int).SetString(s, 10)
+	}
+	if !ok || v.Sign() < 0 {
+		return nil, ErrInvalid
+	}
+	if v.Cmp(MaxUint256) > 0 {
+		return nil, ErrOverflow
+	}
+	return v, nil
+}
+
+// ParseHex parses a 0x-prefixed hex quantity such as an RPC result
+func ParseHex(s string) (*big.Int, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, ErrInvalid
+	}
+	return ParseWei(s)
+}
+
+// Hex renders v as a 0x-prefixed JSON-RPC quantity
+func Hex(v *big.Int) string {
+	return "0x" + v.Text(16)
+}
+
+// ToUnit converts wei into a floating-point count of unit (Gwei, Ether).
+// Intended for display and coarse thresholds, not for further arithmetic.
+func ToUnit(wei, unit *big.Int) float64 {
+	f, _ := new(big.Rat).SetFrac(wei, unit).Float64()
+	return f
+}
+
+// ToGwei converts wei to gwei
+func ToGwei(wei *big.Int) float64 {
+	return ToUnit(wei, Gwei)
+}
+
+// ToEther converts wei to ether
+func ToEther(wei *big.Int) float64 {
+	return ToUnit(wei, Ether)
+}
+
+// FromEther converts a whole number of ether to wei
+func FromEther(eth int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(eth), Ether)
+}
+
+// Format renders wei as a decimal string in a unit with the given number of
+// decimals (18 for ether, 9 for gwei, 6 for USDC), trimming trailing zeros
+func Format(wei *big.Int, decimals int) string {
+	neg := wei.Sign() < 0
+	digits := new(big.Int).Abs(wei).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	out := whole
+	if frac != "" {
+		out += "." + frac
+	}
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package units
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseWei(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "0"},
+		{"0x", "0"},
+		{"0x0", "0"},
+		{"1000", "1000"},
+		{"0x3e8", "1000"},
+		// 100 ETH overflows int64-based parsing
+		{"0x56bc75e2d63100000", "100000000000000000000"},
+		{"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", MaxUint256.String()},
+	}
+	for _, tt := range tests {
+		got, err := ParseWei(tt.in)
+		if err != nil {
+			t.Errorf("ParseWei(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseWei(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"0xzz", "-1", "1.5", "0x1" + MaxUint256.Text(16)} {
+		if _, err := ParseWei(bad); err == nil {
+			t.Errorf("ParseWei(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		wei      *big.Int
+		decimals int
+		want     string
+	}{
+		{FromEther(100), 18, "100"},
+		{big.NewInt(1500000), 6, "1.5"},
+		{big.NewInt(1), 18, "0.000000000000000001"},
+		{big.NewInt(0), 18, "0"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.wei, tt.decimals); got != tt.want {
+			t.Errorf("Format(%s, %d) = %s, want %s", tt.wei, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestToEther(t *testing.T) {
+	if got := ToEther(FromEther(12)); got != 12 {
+		t.Errorf("ToEther = %v, want 12", got)
+	}
+}
+
+// FuzzParseWei checks that every accepted value is in uint256 range and
+// survives a round trip through Hex. Calldata amounts reach ParseWei
+// straight from request bodies.
+func FuzzParseWei(f *testing.F) {
+	for _, seed := range []string{"", "0x", "0x3e8", "1000", "-1", "0x-1", "+5", " 0X1f ", "0x1" + MaxUint256.Text(16)} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		v, err := ParseWei(s)
+		if err != nil {
+			return
+		}
+		if v.Sign() < 0 || v.Cmp(MaxUint256) > 0 {
+			t.Fatalf("ParseWei(%q) = %s, out of uint256 range", s, v)
+		}
+		back, err := ParseHex(Hex(v))
+		if err != nil || back.Cmp(v) != 0 {
+			t.Fatalf("Hex round trip of %s gave %v, %v", v, back, err)
+		}
+	})
+}
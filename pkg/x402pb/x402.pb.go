@@ -0,0 +1,840 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.5
+// 	protoc        (unknown)
+// source: x402/v1/x402.proto
+
+package x402pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ScanContractRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Chain         string                 `protobuf:"bytes,2,opt,name=chain,proto3" json:"chain,omitempty"` // "base" (default) or "ethereum"
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanContractRequest) Reset() {
+	*x = ScanContractRequest{}
+	mi := &file_x402_v1_x402_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanContractRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanContractRequest) ProtoMessage() {}
+
+func (x *ScanContractRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanContractRequest.ProtoReflect.Descriptor instead.
+func (*ScanContractRequest) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ScanContractRequest) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *ScanContractRequest) GetChain() string {
+	if x != nil {
+		return x.Chain
+	}
+	return ""
+}
+
+type ContractScanResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Chain         string                 `protobuf:"bytes,2,opt,name=chain,proto3" json:"chain,omitempty"`
+	RiskScore     int32                  `protobuf:"varint,3,opt,name=risk_score,json=riskScore,proto3" json:"risk_score,omitempty"`
+	IsVerified    bool                   `protobuf:"varint,4,opt,name=is_verified,json=isVerified,proto3" json:"is_verified,omitempty"`
+	IsProxy       bool                   `protobuf:"varint,5,opt,name=is_proxy,json=isProxy,proto3" json:"is_proxy,omitempty"`
+	IsHoneypot    bool                   `protobuf:"varint,6,opt,name=is_honeypot,json=isHoneypot,proto3" json:"is_honeypot,omitempty"`
+	Flags         []string               `protobuf:"bytes,7,rep,name=flags,proto3" json:"flags,omitempty"`
+	Warnings      []string               `protobuf:"bytes,8,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	Cached        bool                   `protobuf:"varint,9,opt,name=cached,proto3" json:"cached,omitempty"`
+	CachedAt      int64                  `protobuf:"varint,10,opt,name=cached_at,json=cachedAt,proto3" json:"cached_at,omitempty"`
+	ScannedAt     int64                  `protobuf:"varint,11,opt,name=scanned_at,json=scannedAt,proto3" json:"scanned_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ContractScanResult) Reset() {
+	*x = ContractScanResult{}
+	mi := &file_x402_v1_x402_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ContractScanResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContractScanResult) ProtoMessage() {}
+
+func (x *ContractScanResult) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContractScanResult.ProtoReflect.Descriptor instead.
+func (*ContractScanResult) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ContractScanResult) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *ContractScanResult) GetChain() string {
+	if x != nil {
+		return x.Chain
+	}
+	return ""
+}
+
+func (x *ContractScanResult) GetRiskScore() int32 {
+	if x != nil {
+		return x.RiskScore
+	}
+	return 0
+}
+
+func (x *ContractScanResult) GetIsVerified() bool {
+	if x != nil {
+		return x.IsVerified
+	}
+	return false
+}
+
+func (x *ContractScanResult) GetIsProxy() bool {
+	if x != nil {
+		return x.IsProxy
+	}
+	return false
+}
+
+func (x *ContractScanResult) GetIsHoneypot() bool {
+	if x != nil {
+		return x.IsHoneypot
+	}
+	return false
+}
+
+func (x *ContractScanResult) GetFlags() []string {
+	if x != nil {
+		return x.Flags
+	}
+	return nil
+}
+
+func (x *ContractScanResult) GetWarnings() []string {
+	if x != nil {
+		return x.Warnings
+	}
+	return nil
+}
+
+func (x *ContractScanResult) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *ContractScanResult) GetCachedAt() int64 {
+	if x != nil {
+		return x.CachedAt
+	}
+	return 0
+}
+
+func (x *ContractScanResult) GetScannedAt() int64 {
+	if x != nil {
+		return x.ScannedAt
+	}
+	return 0
+}
+
+type TxPreflightRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	From          string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To            string                 `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"` // wei, 0x-hex or decimal
+	Data          string                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`   // hex encoded calldata
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TxPreflightRequest) Reset() {
+	*x = TxPreflightRequest{}
+	mi := &file_x402_v1_x402_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TxPreflightRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TxPreflightRequest) ProtoMessage() {}
+
+func (x *TxPreflightRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TxPreflightRequest.ProtoReflect.Descriptor instead.
+func (*TxPreflightRequest) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TxPreflightRequest) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *TxPreflightRequest) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *TxPreflightRequest) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *TxPreflightRequest) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+type TxPreflightResult struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Safe              bool                   `protobuf:"varint,1,opt,name=safe,proto3" json:"safe,omitempty"`
+	RiskScore         int32                  `protobuf:"varint,2,opt,name=risk_score,json=riskScore,proto3" json:"risk_score,omitempty"`
+	SimulationSuccess bool                   `protobuf:"varint,3,opt,name=simulation_success,json=simulationSuccess,proto3" json:"simulation_success,omitempty"`
+	GasEstimate       string                 `protobuf:"bytes,4,opt,name=gas_estimate,json=gasEstimate,proto3" json:"gas_estimate,omitempty"`
+	Warnings          []string               `protobuf:"bytes,5,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	Errors            []string               `protobuf:"bytes,6,rep,name=errors,proto3" json:"errors,omitempty"`
+	Recommendations   []string               `protobuf:"bytes,7,rep,name=recommendations,proto3" json:"recommendations,omitempty"`
+	CheckedAt         int64                  `protobuf:"varint,8,opt,name=checked_at,json=checkedAt,proto3" json:"checked_at,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *TxPreflightResult) Reset() {
+	*x = TxPreflightResult{}
+	mi := &file_x402_v1_x402_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TxPreflightResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TxPreflightResult) ProtoMessage() {}
+
+func (x *TxPreflightResult) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TxPreflightResult.ProtoReflect.Descriptor instead.
+func (*TxPreflightResult) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TxPreflightResult) GetSafe() bool {
+	if x != nil {
+		return x.Safe
+	}
+	return false
+}
+
+func (x *TxPreflightResult) GetRiskScore() int32 {
+	if x != nil {
+		return x.RiskScore
+	}
+	return 0
+}
+
+func (x *TxPreflightResult) GetSimulationSuccess() bool {
+	if x != nil {
+		return x.SimulationSuccess
+	}
+	return false
+}
+
+func (x *TxPreflightResult) GetGasEstimate() string {
+	if x != nil {
+		return x.GasEstimate
+	}
+	return ""
+}
+
+func (x *TxPreflightResult) GetWarnings() []string {
+	if x != nil {
+		return x.Warnings
+	}
+	return nil
+}
+
+func (x *TxPreflightResult) GetErrors() []string {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+func (x *TxPreflightResult) GetRecommendations() []string {
+	if x != nil {
+		return x.Recommendations
+	}
+	return nil
+}
+
+func (x *TxPreflightResult) GetCheckedAt() int64 {
+	if x != nil {
+		return x.CheckedAt
+	}
+	return 0
+}
+
+type DataQuality struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Quality          string                 `protobuf:"bytes,1,opt,name=quality,proto3" json:"quality,omitempty"` // "live", "stale" or "fallback"
+	StalenessSeconds int64                  `protobuf:"varint,2,opt,name=staleness_seconds,json=stalenessSeconds,proto3" json:"staleness_seconds,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *DataQuality) Reset() {
+	*x = DataQuality{}
+	mi := &file_x402_v1_x402_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DataQuality) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataQuality) ProtoMessage() {}
+
+func (x *DataQuality) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataQuality.ProtoReflect.Descriptor instead.
+func (*DataQuality) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DataQuality) GetQuality() string {
+	if x != nil {
+		return x.Quality
+	}
+	return ""
+}
+
+func (x *DataQuality) GetStalenessSeconds() int64 {
+	if x != nil {
+		return x.StalenessSeconds
+	}
+	return 0
+}
+
+type GetGasRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetGasRequest) Reset() {
+	*x = GetGasRequest{}
+	mi := &file_x402_v1_x402_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGasRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGasRequest) ProtoMessage() {}
+
+func (x *GetGasRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGasRequest.ProtoReflect.Descriptor instead.
+func (*GetGasRequest) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{5}
+}
+
+type GasData struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     int64                  `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Gas           map[string]float64     `protobuf:"bytes,2,rep,name=gas,proto3" json:"gas,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	Unit          string                 `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	Source        string                 `protobuf:"bytes,4,opt,name=source,proto3" json:"source,omitempty"`
+	DataQuality   *DataQuality           `protobuf:"bytes,5,opt,name=data_quality,json=dataQuality,proto3" json:"data_quality,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GasData) Reset() {
+	*x = GasData{}
+	mi := &file_x402_v1_x402_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GasData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GasData) ProtoMessage() {}
+
+func (x *GasData) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GasData.ProtoReflect.Descriptor instead.
+func (*GasData) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GasData) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *GasData) GetGas() map[string]float64 {
+	if x != nil {
+		return x.Gas
+	}
+	return nil
+}
+
+func (x *GasData) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *GasData) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *GasData) GetDataQuality() *DataQuality {
+	if x != nil {
+		return x.DataQuality
+	}
+	return nil
+}
+
+type GetPriceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPriceRequest) Reset() {
+	*x = GetPriceRequest{}
+	mi := &file_x402_v1_x402_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPriceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPriceRequest) ProtoMessage() {}
+
+func (x *GetPriceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPriceRequest.ProtoReflect.Descriptor instead.
+func (*GetPriceRequest) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{7}
+}
+
+type PriceData struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp         int64                  `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	EthUsd            float64                `protobuf:"fixed64,2,opt,name=eth_usd,json=ethUsd,proto3" json:"eth_usd,omitempty"`
+	Sources           map[string]float64     `protobuf:"bytes,3,rep,name=sources,proto3" json:"sources,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	AverageUsd        float64                `protobuf:"fixed64,4,opt,name=average_usd,json=averageUsd,proto3" json:"average_usd,omitempty"`
+	Change_24HPercent float64                `protobuf:"fixed64,5,opt,name=change_24h_percent,json=change24hPercent,proto3" json:"change_24h_percent,omitempty"`
+	DataQuality       *DataQuality           `protobuf:"bytes,6,opt,name=data_quality,json=dataQuality,proto3" json:"data_quality,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *PriceData) Reset() {
+	*x = PriceData{}
+	mi := &file_x402_v1_x402_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PriceData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PriceData) ProtoMessage() {}
+
+func (x *PriceData) ProtoReflect() protoreflect.Message {
+	mi := &file_x402_v1_x402_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PriceData.ProtoReflect.Descriptor instead.
+func (*PriceData) Descriptor() ([]byte, []int) {
+	return file_x402_v1_x402_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PriceData) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *PriceData) GetEthUsd() float64 {
+	if x != nil {
+		return x.EthUsd
+	}
+	return 0
+}
+
+func (x *PriceData) GetSources() map[string]float64 {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+func (x *PriceData) GetAverageUsd() float64 {
+	if x != nil {
+		return x.AverageUsd
+	}
+	return 0
+}
+
+func (x *PriceData) GetChange_24HPercent() float64 {
+	if x != nil {
+		return x.Change_24HPercent
+	}
+	return 0
+}
+
+func (x *PriceData) GetDataQuality() *DataQuality {
+	if x != nil {
+		return x.DataQuality
+	}
+	return nil
+}
+
+var File_x402_v1_x402_proto protoreflect.FileDescriptor
+
+var file_x402_v1_x402_proto_rawDesc = string([]byte{
+	0x0a, 0x12, 0x78, 0x34, 0x30, 0x32, 0x2f, 0x76, 0x31, 0x2f, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x76, 0x31, 0x22, 0x45, 0x0a,
+	0x13, 0x53, 0x63, 0x61, 0x6e, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x14,
+	0x0a, 0x05, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x63,
+	0x68, 0x61, 0x69, 0x6e, 0x22, 0xc6, 0x02, 0x0a, 0x12, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63,
+	0x74, 0x53, 0x63, 0x61, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x61,
+	0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64,
+	0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x12, 0x1d, 0x0a, 0x0a, 0x72,
+	0x69, 0x73, 0x6b, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x09, 0x72, 0x69, 0x73, 0x6b, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x69, 0x73,
+	0x5f, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x0a, 0x69, 0x73, 0x56, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x69,
+	0x73, 0x5f, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x69,
+	0x73, 0x50, 0x72, 0x6f, 0x78, 0x79, 0x12, 0x1f, 0x0a, 0x0b, 0x69, 0x73, 0x5f, 0x68, 0x6f, 0x6e,
+	0x65, 0x79, 0x70, 0x6f, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x48,
+	0x6f, 0x6e, 0x65, 0x79, 0x70, 0x6f, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73,
+	0x18, 0x07, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x12, 0x1a, 0x0a,
+	0x08, 0x77, 0x61, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x08, 0x77, 0x61, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x61, 0x63,
+	0x68, 0x65, 0x64, 0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x63, 0x61, 0x63, 0x68, 0x65,
+	0x64, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x61, 0x63, 0x68, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x0a,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x63, 0x61, 0x63, 0x68, 0x65, 0x64, 0x41, 0x74, 0x12, 0x1d,
+	0x0a, 0x0a, 0x73, 0x63, 0x61, 0x6e, 0x6e, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x0b, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x09, 0x73, 0x63, 0x61, 0x6e, 0x6e, 0x65, 0x64, 0x41, 0x74, 0x22, 0x62, 0x0a,
+	0x12, 0x54, 0x78, 0x50, 0x72, 0x65, 0x66, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x6f, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x02, 0x74, 0x6f, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x12, 0x0a,
+	0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x64, 0x61, 0x74,
+	0x61, 0x22, 0x95, 0x02, 0x0a, 0x11, 0x54, 0x78, 0x50, 0x72, 0x65, 0x66, 0x6c, 0x69, 0x67, 0x68,
+	0x74, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x61, 0x66, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x73, 0x61, 0x66, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x72,
+	0x69, 0x73, 0x6b, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x09, 0x72, 0x69, 0x73, 0x6b, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x2d, 0x0a, 0x12, 0x73, 0x69,
+	0x6d, 0x75, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x11, 0x73, 0x69, 0x6d, 0x75, 0x6c, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x67, 0x61, 0x73,
+	0x5f, 0x65, 0x73, 0x74, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0b, 0x67, 0x61, 0x73, 0x45, 0x73, 0x74, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x12, 0x1a, 0x0a, 0x08,
+	0x77, 0x61, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08,
+	0x77, 0x61, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x65, 0x72, 0x72, 0x6f,
+	0x72, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x73,
+	0x12, 0x28, 0x0a, 0x0f, 0x72, 0x65, 0x63, 0x6f, 0x6d, 0x6d, 0x65, 0x6e, 0x64, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0f, 0x72, 0x65, 0x63, 0x6f, 0x6d,
+	0x6d, 0x65, 0x6e, 0x64, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x68,
+	0x65, 0x63, 0x6b, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09,
+	0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x64, 0x41, 0x74, 0x22, 0x54, 0x0a, 0x0b, 0x44, 0x61, 0x74,
+	0x61, 0x51, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x71, 0x75, 0x61, 0x6c,
+	0x69, 0x74, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x71, 0x75, 0x61, 0x6c, 0x69,
+	0x74, 0x79, 0x12, 0x2b, 0x0a, 0x11, 0x73, 0x74, 0x61, 0x6c, 0x65, 0x6e, 0x65, 0x73, 0x73, 0x5f,
+	0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x10, 0x73,
+	0x74, 0x61, 0x6c, 0x65, 0x6e, 0x65, 0x73, 0x73, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x22,
+	0x0f, 0x0a, 0x0d, 0x47, 0x65, 0x74, 0x47, 0x61, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x22, 0xf1, 0x01, 0x0a, 0x07, 0x47, 0x61, 0x73, 0x44, 0x61, 0x74, 0x61, 0x12, 0x1c, 0x0a, 0x09,
+	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x2b, 0x0a, 0x03, 0x67, 0x61,
+	0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x76,
+	0x31, 0x2e, 0x47, 0x61, 0x73, 0x44, 0x61, 0x74, 0x61, 0x2e, 0x47, 0x61, 0x73, 0x45, 0x6e, 0x74,
+	0x72, 0x79, 0x52, 0x03, 0x67, 0x61, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x75, 0x6e, 0x69, 0x74, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x6e, 0x69, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x73,
+	0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x12, 0x37, 0x0a, 0x0c, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x71, 0x75, 0x61, 0x6c,
+	0x69, 0x74, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x78, 0x34, 0x30, 0x32,
+	0x2e, 0x76, 0x31, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x51, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x52,
+	0x0b, 0x64, 0x61, 0x74, 0x61, 0x51, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x1a, 0x36, 0x0a, 0x08,
+	0x47, 0x61, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x3a, 0x02, 0x38, 0x01, 0x22, 0x11, 0x0a, 0x0f, 0x47, 0x65, 0x74, 0x50, 0x72, 0x69, 0x63, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xc1, 0x02, 0x0a, 0x09, 0x50, 0x72, 0x69, 0x63,
+	0x65, 0x44, 0x61, 0x74, 0x61, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x12, 0x17, 0x0a, 0x07, 0x65, 0x74, 0x68, 0x5f, 0x75, 0x73, 0x64, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x01, 0x52, 0x06, 0x65, 0x74, 0x68, 0x55, 0x73, 0x64, 0x12, 0x39, 0x0a, 0x07,
+	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1f, 0x2e,
+	0x78, 0x34, 0x30, 0x32, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x69, 0x63, 0x65, 0x44, 0x61, 0x74,
+	0x61, 0x2e, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x07,
+	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x61, 0x76, 0x65, 0x72, 0x61,
+	0x67, 0x65, 0x5f, 0x75, 0x73, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x61, 0x76,
+	0x65, 0x72, 0x61, 0x67, 0x65, 0x55, 0x73, 0x64, 0x12, 0x2c, 0x0a, 0x12, 0x63, 0x68, 0x61, 0x6e,
+	0x67, 0x65, 0x5f, 0x32, 0x34, 0x68, 0x5f, 0x70, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x01, 0x52, 0x10, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x32, 0x34, 0x68, 0x50,
+	0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x12, 0x37, 0x0a, 0x0c, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x71,
+	0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x78,
+	0x34, 0x30, 0x32, 0x2e, 0x76, 0x31, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x51, 0x75, 0x61, 0x6c, 0x69,
+	0x74, 0x79, 0x52, 0x0b, 0x64, 0x61, 0x74, 0x61, 0x51, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x1a,
+	0x3a, 0x0a, 0x0c, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12,
+	0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65,
+	0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x32, 0x87, 0x02, 0x0a, 0x04,
+	0x58, 0x34, 0x30, 0x32, 0x12, 0x49, 0x0a, 0x0c, 0x53, 0x63, 0x61, 0x6e, 0x43, 0x6f, 0x6e, 0x74,
+	0x72, 0x61, 0x63, 0x74, 0x12, 0x1c, 0x2e, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x76, 0x31, 0x2e, 0x53,
+	0x63, 0x61, 0x6e, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x1b, 0x2e, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6e,
+	0x74, 0x72, 0x61, 0x63, 0x74, 0x53, 0x63, 0x61, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12,
+	0x46, 0x0a, 0x0b, 0x54, 0x78, 0x50, 0x72, 0x65, 0x66, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x12, 0x1b,
+	0x2e, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x78, 0x50, 0x72, 0x65, 0x66, 0x6c,
+	0x69, 0x67, 0x68, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a, 0x2e, 0x78, 0x34,
+	0x30, 0x32, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x78, 0x50, 0x72, 0x65, 0x66, 0x6c, 0x69, 0x67, 0x68,
+	0x74, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x32, 0x0a, 0x06, 0x47, 0x65, 0x74, 0x47, 0x61,
+	0x73, 0x12, 0x16, 0x2e, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x47,
+	0x61, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x78, 0x34, 0x30, 0x32,
+	0x2e, 0x76, 0x31, 0x2e, 0x47, 0x61, 0x73, 0x44, 0x61, 0x74, 0x61, 0x12, 0x38, 0x0a, 0x08, 0x47,
+	0x65, 0x74, 0x50, 0x72, 0x69, 0x63, 0x65, 0x12, 0x18, 0x2e, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x76,
+	0x31, 0x2e, 0x47, 0x65, 0x74, 0x50, 0x72, 0x69, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x12, 0x2e, 0x78, 0x34, 0x30, 0x32, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x69, 0x63,
+	0x65, 0x44, 0x61, 0x74, 0x61, 0x42, 0x3f, 0x5a, 0x3d, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x72, 0x69, 0x74, 0x68, 0x6d, 0x6f, 0x73, 0x71, 0x75, 0x69, 0x6c,
+	0x6c, 0x73, 0x77, 0x6f, 0x72, 0x74, 0x68, 0x2f, 0x78, 0x34, 0x30, 0x32, 0x2d, 0x73, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x78, 0x34, 0x30, 0x32, 0x70, 0x62, 0x3b,
+	0x78, 0x34, 0x30, 0x32, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+})
+
+var (
+	file_x402_v1_x402_proto_rawDescOnce sync.Once
+	file_x402_v1_x402_proto_rawDescData []byte
+)
+
+func file_x402_v1_x402_proto_rawDescGZIP() []byte {
+	file_x402_v1_x402_proto_rawDescOnce.Do(func() {
+		file_x402_v1_x402_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_x402_v1_x402_proto_rawDesc), len(file_x402_v1_x402_proto_rawDesc)))
+	})
+	return file_x402_v1_x402_proto_rawDescData
+}
+
+var file_x402_v1_x402_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_x402_v1_x402_proto_goTypes = []any{
+	(*ScanContractRequest)(nil), // 0: x402.v1.ScanContractRequest
+	(*ContractScanResult)(nil),  // 1: x402.v1.ContractScanResult
+	(*TxPreflightRequest)(nil),  // 2: x402.v1.TxPreflightRequest
+	(*TxPreflightResult)(nil),   // 3: x402.v1.TxPreflightResult
+	(*DataQuality)(nil),         // 4: x402.v1.DataQuality
+	(*GetGasRequest)(nil),       // 5: x402.v1.GetGasRequest
+	(*GasData)(nil),             // 6: x402.v1.GasData
+	(*GetPriceRequest)(nil),     // 7: x402.v1.GetPriceRequest
+	(*PriceData)(nil),           // 8: x402.v1.PriceData
+	nil,                         // 9: x402.v1.GasData.GasEntry
+	nil,                         // 10: x402.v1.PriceData.SourcesEntry
+}
+var file_x402_v1_x402_proto_depIdxs = []int32{
+	9,  // 0: x402.v1.GasData.gas:type_name -> x402.v1.GasData.GasEntry
+	4,  // 1: x402.v1.GasData.data_quality:type_name -> x402.v1.DataQuality
+	10, // 2: x402.v1.PriceData.sources:type_name -> x402.v1.PriceData.SourcesEntry
+	4,  // 3: x402.v1.PriceData.data_quality:type_name -> x402.v1.DataQuality
+	0,  // 4: x402.v1.X402.ScanContract:input_type -> x402.v1.ScanContractRequest
+	2,  // 5: x402.v1.X402.TxPreflight:input_type -> x402.v1.TxPreflightRequest
+	5,  // 6: x402.v1.X402.GetGas:input_type -> x402.v1.GetGasRequest
+	7,  // 7: x402.v1.X402.GetPrice:input_type -> x402.v1.GetPriceRequest
+	1,  // 8: x402.v1.X402.ScanContract:output_type -> x402.v1.ContractScanResult
+	3,  // 9: x402.v1.X402.TxPreflight:output_type -> x402.v1.TxPreflightResult
+	6,  // 10: x402.v1.X402.GetGas:output_type -> x402.v1.GasData
+	8,  // 11: x402.v1.X402.GetPrice:output_type -> x402.v1.PriceData
+	8,  // [8:12] is the sub-list for method output_type
+	4,  // [4:8] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_x402_v1_x402_proto_init() }
+func file_x402_v1_x402_proto_init() {
+	if File_x402_v1_x402_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_x402_v1_x402_proto_rawDesc), len(file_x402_v1_x402_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_x402_v1_x402_proto_goTypes,
+		DependencyIndexes: file_x402_v1_x402_proto_depIdxs,
+		MessageInfos:      file_x402_v1_x402_proto_msgTypes,
+	}.Build()
+	File_x402_v1_x402_proto = out.File
+	file_x402_v1_x402_proto_goTypes = nil
+	file_x402_v1_x402_proto_depIdxs = nil
+}
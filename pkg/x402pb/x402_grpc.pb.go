@@ -0,0 +1,257 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: x402/v1/x402.proto
+
+package x402pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	X402_ScanContract_FullMethodName = "/x402.v1.X402/ScanContract"
+	X402_TxPreflight_FullMethodName  = "/x402.v1.X402/TxPreflight"
+	X402_GetGas_FullMethodName       = "/x402.v1.X402/GetGas"
+	X402_GetPrice_FullMethodName     = "/x402.v1.X402/GetPrice"
+)
+
+// X402Client is the client API for X402 service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// X402 exposes the paid security and data APIs over gRPC.
+//
+// Payment is carried in request metadata under "x-payment-response", the
+// same signed token the REST API takes in the X-Payment-Response header.
+// Calls without a valid payment fail with FAILED_PRECONDITION and a
+// "x402-payment-required" trailer holding the JSON payment requirement.
+type X402Client interface {
+	// ScanContract scores a smart contract for security risks (0.01 USDC)
+	ScanContract(ctx context.Context, in *ScanContractRequest, opts ...grpc.CallOption) (*ContractScanResult, error)
+	// TxPreflight simulates a transaction and assesses its risk (0.003 USDC)
+	TxPreflight(ctx context.Context, in *TxPreflightRequest, opts ...grpc.CallOption) (*TxPreflightResult, error)
+	// GetGas returns current Ethereum gas prices (0.001 USDC)
+	GetGas(ctx context.Context, in *GetGasRequest, opts ...grpc.CallOption) (*GasData, error)
+	// GetPrice returns the ETH/USD price across exchanges (0.002 USDC)
+	GetPrice(ctx context.Context, in *GetPriceRequest, opts ...grpc.CallOption) (*PriceData, error)
+}
+
+type x402Client struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewX402Client(cc grpc.ClientConnInterface) X402Client {
+	return &x402Client{cc}
+}
+
+func (c *x402Client) ScanContract(ctx context.Context, in *ScanContractRequest, opts ...grpc.CallOption) (*ContractScanResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ContractScanResult)
+	err := c.cc.Invoke(ctx, X402_ScanContract_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *x402Client) TxPreflight(ctx context.Context, in *TxPreflightRequest, opts ...grpc.CallOption) (*TxPreflightResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TxPreflightResult)
+	err := c.cc.Invoke(ctx, X402_TxPreflight_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *x402Client) GetGas(ctx context.Context, in *GetGasRequest, opts ...grpc.CallOption) (*GasData, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GasData)
+	err := c.cc.Invoke(ctx, X402_GetGas_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *x402Client) GetPrice(ctx context.Context, in *GetPriceRequest, opts ...grpc.CallOption) (*PriceData, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PriceData)
+	err := c.cc.Invoke(ctx, X402_GetPrice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// X402Server is the server API for X402 service.
+// All implementations must embed UnimplementedX402Server
+// for forward compatibility.
+//
+// X402 exposes the paid security and data APIs over gRPC.
+//
+// Payment is carried in request metadata under "x-payment-response", the
+// same signed token the REST API takes in the X-Payment-Response header.
+// Calls without a valid payment fail with FAILED_PRECONDITION and a
+// "x402-payment-required" trailer holding the JSON payment requirement.
+type X402Server interface {
+	// ScanContract scores a smart contract for security risks (0.01 USDC)
+	ScanContract(context.Context, *ScanContractRequest) (*ContractScanResult, error)
+	// TxPreflight simulates a transaction and assesses its risk (0.003 USDC)
+	TxPreflight(context.Context, *TxPreflightRequest) (*TxPreflightResult, error)
+	// GetGas returns current Ethereum gas prices (0.001 USDC)
+	GetGas(context.Context, *GetGasRequest) (*GasData, error)
+	// GetPrice returns the ETH/USD price across exchanges (0.002 USDC)
+	GetPrice(context.Context, *GetPriceRequest) (*PriceData, error)
+	mustEmbedUnimplementedX402Server()
+}
+
+// UnimplementedX402Server must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedX402Server struct{}
+
+func (UnimplementedX402Server) ScanContract(context.Context, *ScanContractRequest) (*ContractScanResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScanContract not implemented")
+}
+func (UnimplementedX402Server) TxPreflight(context.Context, *TxPreflightRequest) (*TxPreflightResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TxPreflight not implemented")
+}
+func (UnimplementedX402Server) GetGas(context.Context, *GetGasRequest) (*GasData, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGas not implemented")
+}
+func (UnimplementedX402Server) GetPrice(context.Context, *GetPriceRequest) (*PriceData, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPrice not implemented")
+}
+func (UnimplementedX402Server) mustEmbedUnimplementedX402Server() {}
+func (UnimplementedX402Server) testEmbeddedByValue()              {}
+
+// UnsafeX402Server may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to X402Server will
+// result in compilation errors.
+type UnsafeX402Server interface {
+	mustEmbedUnimplementedX402Server()
+}
+
+func RegisterX402Server(s grpc.ServiceRegistrar, srv X402Server) {
+	// If the following call pancis, it indicates UnimplementedX402Server was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&X402_ServiceDesc, srv)
+}
+
+func _X402_ScanContract_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanContractRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(X402Server).ScanContract(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: X402_ScanContract_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(X402Server).ScanContract(ctx, req.(*ScanContractRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _X402_TxPreflight_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxPreflightRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(X402Server).TxPreflight(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: X402_TxPreflight_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(X402Server).TxPreflight(ctx, req.(*TxPreflightRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _X402_GetGas_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGasRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(X402Server).GetGas(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: X402_GetGas_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(X402Server).GetGas(ctx, req.(*GetGasRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _X402_GetPrice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPriceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(X402Server).GetPrice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: X402_GetPrice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(X402Server).GetPrice(ctx, req.(*GetPriceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// X402_ServiceDesc is the grpc.ServiceDesc for X402 service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var X402_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "x402.v1.X402",
+	HandlerType: (*X402Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ScanContract",
+			Handler:    _X402_ScanContract_Handler,
+		},
+		{
+			MethodName: "TxPreflight",
+			Handler:    _X402_TxPreflight_Handler,
+		},
+		{
+			MethodName: "GetGas",
+			Handler:    _X402_GetGas_Handler,
+		},
+		{
+			MethodName: "GetPrice",
+			Handler:    _X402_GetPrice_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "x402/v1/x402.proto",
+}
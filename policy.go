@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// PolicyDecision is how one policy ruled on a transaction
+type PolicyDecision = types.PolicyDecision
+
+// Policy decisions, from least to most restrictive
+const (
+	PolicyAllow       = "allow"
+	PolicyNeedsReview = "needs_review"
+	PolicyDeny        = "deny"
+)
+
+// defaultPolicyChain is the chain policies assume a transaction is for when
+// the request does not say
+const defaultPolicyChain = "ethereum"
+
+var selectorPattern = regexp.MustCompile(`^0x[0-9a-f]{8}$`)
+
+// validate checks the policy's rules, with chains the chains configured,
+// and lowercases its selectors
+func (p *PolicyConfig) validate(chains map[string]ChainConfig) error {
+	if p.Name == "" {
+		return fmt.Errorf("policy needs a name")
+	}
+	for _, c := range p.Chains {
+		if _, ok := chains[c]; !ok {
+			return fmt.Errorf("policy %s: unknown chain %q", p.Name, c)
+		}
+	}
+	for _, v := range []string{p.MaxValue, p.ReviewValue} {
+		if _, err := units.ParseWei(v); err != nil {
+			return fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+	}
+	for i, s := range p.Selectors {
+		if p.Selectors[i] = strings.ToLower(s); !selectorPattern.MatchString(p.Selectors[i]) {
+			return fmt.Errorf("policy %s: selector %q is not 0x and 8 hex digits", p.Name, s)
+		}
+	}
+	for _, score := range []*int{p.MaxRiskScore, p.ReviewRiskScore} {
+		if score != nil && (*score < 0 || *score > 100) {
+			return fmt.Errorf("policy %s: risk score threshold %d is not 0-100", p.Name, *score)
+		}
+	}
+	return nil
+}
+
+// SelectPolicies returns the policies named, or every policy if names is
+// empty
+func (c *RuntimeConfig) SelectPolicies(names []string) ([]PolicyConfig, error) {
+	if len(names) == 0 {
+		return c.Policies, nil
+	}
+	selected := make([]PolicyConfig, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(c.Policies, func(p PolicyConfig) bool { return p.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown policy %q", name)
+		}
+		selected = append(selected, c.Policies[i])
+	}
+	return selected, nil
+}
+
+// policyIntent is what policies read from a transaction: the chain, the
+// value sent and the function called. For user operations it is the call
+// the smart account executes.
+type policyIntent struct {
+	chain    string
+	value    *big.Int // nil if the request's value is not a valid amount
+	selector string   // "" for a plain transfer
+}
+
+func newPolicyIntent(tx *TxPreflightRequest) policyIntent {
+	intent := policyIntent{chain: tx.Chain}
+	if intent.chain == "" {
+		intent.chain = defaultPolicyChain
+	}
+	if op := tx.UserOperation; op != nil {
+		if _, value, data, ok := decodeExecute(op.CallData); ok {
+			intent.value, intent.selector = value, callSelector(data)
+		} else {
+			intent.value, intent.selector = new(big.Int), callSelector(op.CallData)
+		}
+		return intent
+	}
+	if v, err := units.ParseWei(tx.Value); err == nil {
+		intent.value = v
+	}
+	intent.selector = callSelector(tx.Data)
+	return intent
+}
+
+// callSelector returns the 0x-prefixed function selector of calldata, or ""
+// if it is too short to call a function
+func callSelector(data string) string {
+	data = strings.ToLower(strings.TrimPrefix(data, "0x"))
+	if len(data) < 8 {
+		return ""
+	}
+	return "0x" + data[:8]
+}
+
+// evaluate rules on a transaction, given its preflight result. The
+// decision is the most restrictive of the rules'.
+func (p *PolicyConfig) evaluate(intent policyIntent, result *TxPreflightResult) PolicyDecision {
+	decision := PolicyDecision{Policy: p.Name, Decision: PolicyAllow, Reasons: []string{}}
+	rule := func(outcome, format string, args ...interface{}) {
+		if policyRank(outcome) > policyRank(decision.Decision) {
+			decision.Decision = outcome
+		}
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf(format, args...))
+	}
+
+	if len(p.Chains) > 0 && !slices.Contains(p.Chains, intent.chain) {
+		rule(PolicyDeny, "chain %s is not allowed", intent.chain)
+	}
+	if intent.value == nil && (p.MaxValue != "" || p.ReviewValue != "") {
+		rule(PolicyDeny, "value is not a valid amount")
+	} else if intent.value != nil {
+		limit, _ := units.ParseWei(p.MaxValue)
+		review, _ := units.ParseWei(p.ReviewValue)
+		if p.MaxValue != "" && intent.value.Cmp(limit) > 0 {
+			rule(PolicyDeny, "value %s wei is over the %s wei limit", intent.value, limit)
+		} else if p.ReviewValue != "" && intent.value.Cmp(review) > 0 {
+			rule(PolicyNeedsReview, "value %s wei is over the %s wei review threshold", intent.value, review)
+		}
+	}
+	if len(p.Selectors) > 0 && intent.selector != "" && !slices.Contains(p.Selectors, intent.selector) {
+		rule(PolicyDeny, "function %s is not allowed", intent.selector)
+	}
+	if p.MaxRiskScore != nil && result.RiskScore > *p.MaxRiskScore {
+		rule(PolicyDeny, "risk score %d is over %d", result.RiskScore, *p.MaxRiskScore)
+	} else if p.ReviewRiskScore != nil && result.RiskScore > *p.ReviewRiskScore {
+		rule(PolicyNeedsReview, "risk score %d is over the review threshold %d", result.RiskScore, *p.ReviewRiskScore)
+	}
+	return decision
+}
+
+func policyRank(decision string) int {
+	switch decision {
+	case PolicyNeedsReview:
+		return 1
+	case PolicyDeny:
+		return 2
+	}
+	return 0
+}
+
+// applyPolicies adds each policy's decision on tx to its preflight result
+func applyPolicies(policies []PolicyConfig, tx *TxPreflightRequest, result *TxPreflightResult) {
+	if len(policies) == 0 {
+		return
+	}
+	intent := newPolicyIntent(tx)
+	for i := range policies {
+		decision := policies[i].evaluate(intent, result)
+		result.Policies = append(result.Policies, decision)
+		policyStats.record(decision)
+	}
+}
+
+// policyStats counts policy decisions for /metrics
+var policyStats = &PolicyStats{decisions: make(map[[2]string]int64)}
+
+// PolicyStats counts decisions by policy and decision
+type PolicyStats struct {
+	mu        sync.Mutex
+	decisions map[[2]string]int64
+}
+
+func (s *PolicyStats) record(d PolicyDecision) {
+	s.mu.Lock()
+	s.decisions[[2]string{d.Policy, d.Decision}]++
+	s.mu.Unlock()
+}
+
+// WriteMetrics emits the decision counts
+func (s *PolicyStats) WriteMetrics(b *strings.Builder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.WriteString("# HELP x402_policy_decisions_total Transaction policy decisions, by policy and decision\n")
+	b.WriteString("# TYPE x402_policy_decisions_total counter\n")
+	keys := make([][2]string, 0, len(s.decisions))
+	for k := range s.decisions {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b [2]string) int {
+		return strings.Compare(a[0]+"\x00"+a[1], b[0]+"\x00"+b[1])
+	})
+	for _, k := range keys {
+		fmt.Fprintf(b, "x402_policy_decisions_total{policy=%q,decision=%q} %d\n", k[0], k[1], s.decisions[k])
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyEvaluate(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(`{"policies":[{
+		"name": "treasury", "chains": ["base"],
+		"max_value": "1000", "review_value": "0x64",
+		"selectors": ["0xA9059CBB"],
+		"max_risk_score": 70, "review_risk_score": 30
+	}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := cfg.Policies[0]
+	transfer := "0xa9059cbb" + strings.Repeat("0", 128)
+
+	for _, tt := range []struct {
+		name     string
+		tx       TxPreflightRequest
+		score    int
+		decision string
+		reasons  int
+	}{
+		{"within every rule", TxPreflightRequest{Chain: "base", Value: "50", Data: transfer}, 10, PolicyAllow, 0},
+		{"plain transfer", TxPreflightRequest{Chain: "base", Value: "0x10"}, 0, PolicyAllow, 0},
+		{"default chain", TxPreflightRequest{Value: "50"}, 0, PolicyDeny, 1},
+		{"value to review", TxPreflightRequest{Chain: "base", Value: "101"}, 0, PolicyNeedsReview, 1},
+		{"value over the limit", TxPreflightRequest{Chain: "base", Value: "1001"}, 0, PolicyDeny, 1},
+		{"invalid value", TxPreflightRequest{Chain: "base", Value: "lots"}, 0, PolicyDeny, 1},
+		{"other function", TxPreflightRequest{Chain: "base", Data: "0x095ea7b3"}, 0, PolicyDeny, 1},
+		{"risk to review", TxPreflightRequest{Chain: "base"}, 31, PolicyNeedsReview, 1},
+		{"review and deny", TxPreflightRequest{Chain: "base", Value: "500"}, 71, PolicyDeny, 2},
+		{"user operation", TxPreflightRequest{Chain: "base", UserOperation: &UserOperation{
+			Sender:   "0x2222222222222222222222222222222222222222",
+			CallData: executeCall(watchedRouter, 5000, "0x095ea7b3"),
+		}}, 0, PolicyDeny, 2},
+	} {
+		got := policy.evaluate(newPolicyIntent(&tt.tx), &TxPreflightResult{RiskScore: tt.score})
+		if got.Decision != tt.decision || len(got.Reasons) != tt.reasons {
+			t.Errorf("%s: %+v, want %s with %d reasons", tt.name, got, tt.decision, tt.reasons)
+		}
+	}
+
+	if _, err := cfg.SelectPolicies([]string{"treasury", "ops"}); err == nil {
+		t.Error("unknown policy selected")
+	}
+	for _, bad := range []string{
+		`{"policies":[{"name":"a"},{"name":"a"}]}`,
+		`{"policies":[{"name":"a","chains":["solana"]}]}`,
+		`{"policies":[{"name":"a","max_value":"-1"}]}`,
+		`{"policies":[{"name":"a","selectors":["transfer"]}]}`,
+		`{"policies":[{"name":"a","max_risk_score":101}]}`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(bad)); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
+
+func TestE2EPolicyPreflight(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"policies":[{"name":"small","max_value":"1000"},{"name":"base-only","chains":["base"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv, _ := startService(t, map[string]string{"CONFIG_FILE": config})
+
+	resp := paidRequest(t, srv, "POST", "/api/tx-preflight", `{"from":"0x742d35cc6634c0532925a3b844bc454e4438f44e","to":"0x742d35cc6634c0532925a3b844bc454e4438f44e","value":"5000","policies":["small"]}`)
+	defer resp.Body.Close()
+	var body struct {
+		Data TxPreflightResult `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || len(body.Data.Policies) != 1 || body.Data.Policies[0].Decision != PolicyDeny {
+		t.Errorf("preflight over the value limit returned %d %+v", resp.StatusCode, body.Data.Policies)
+	}
+
+	unknown := paidRequest(t, srv, "POST", "/api/tx-preflight", `{"to":"0x742d35cc6634c0532925a3b844bc454e4438f44e","policies":["nope"]}`)
+	defer unknown.Body.Close()
+	if unknown.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown policy returned %d, want 400", unknown.StatusCode)
+	}
+}
@@ -3,61 +3,105 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
 )
 
 // PriceData represents ETH price information
-type PriceData struct {
-	Timestamp   int64              `json:"timestamp"`
-	Eth         float64            `json:"eth_usd"`
-	Sources     map[string]float64 `json:"sources"`
-	Average     float64            `json:"average_usd"`
-	Change24h   float64            `json:"change_24h_percent"`
-}
+type PriceData = types.PriceData
 
-// fetchETHPrice fetches ETH/USD price from multiple sources
+// fetchETHPrice fetches ETH/USD price from multiple sources. The consensus
+// is the weighted mean of the enabled sources that answered.
 func fetchETHPrice() (*PriceData, error) {
-	sources := make(map[string]float64)
-	
-	// Try CoinGecko
-	if price, err := fetchCoinGeckoPrice(); err == nil {
-		sources["coingecko"] = price
-	}
-	
-	// Try Coinbase
-	if price, err := fetchCoinbasePrice(); err == nil {
-		sources["coinbase"] = price
-	}
-	
-	// Try Kraken
-	if price, err := fetchKrakenPrice(); err == nil {
-		sources["kraken"] = price
-	}
-	
+	consensus, sources := weightedConsensus(runtimeConfig.Current())
 	if len(sources) == 0 {
 		return nil, fmt.Errorf("failed to fetch price from all sources")
 	}
-	
-	// Calculate average
-	var sum float64
-	for _, price := range sources {
-		sum += price
-	}
-	average := sum / float64(len(sources))
-	
+
 	return &PriceData{
 		Timestamp: time.Now().Unix(),
-		Eth:       round(average, 2),
+		Eth:       round(consensus, 2),
 		Sources:   sources,
-		Average:   round(average, 2),
+		Average:   round(consensus, 2),
 		Change24h: 0, // Would need historical data
+		DataQuality: types.DataQuality{Quality: types.QualityLive},
 	}, nil
 }
 
+// fxRates caches USD exchange rates; they move far slower than ETH
+var fxRates lastGood[map[string]float64]
+
+const fxMaxAge = 10 * time.Minute
+
+// convertPrice returns price with eth_price quoted in currency. The USD
+// fields are kept so existing consumers are unaffected.
+func convertPrice(price *PriceData, currency string) (*PriceData, error) {
+	if currency == "" || currency == "usd" {
+		return price, nil
+	}
+	rate, err := fxRate(currency)
+	if err != nil {
+		return nil, err
+	}
+	out := *price
+	out.Currency = currency
+	out.FXRate = rate
+	out.EthPrice = round(price.Eth*rate, 2)
+	return &out, nil
+}
+
+// fxRate returns how many units of currency one USD buys
+func fxRate(currency string) (float64, error) {
+	rates, _, ok := fxRates.Load(fxMaxAge)
+	if !ok {
+		fresh, err := fetchUSDRates()
+		if err != nil {
+			return 0, err
+		}
+		fxRates.Store(fresh)
+		rates = fresh
+	}
+	rate, ok := rates[strings.ToUpper(currency)]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no USD rate for %s", currency)
+	}
+	return rate, nil
+}
+
+func fetchUSDRates() (map[string]float64, error) {
+	resp, err := upstreamHTTP.Get("https://api.coinbase.com/v2/exchange-rates?currency=USD")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			Rates map[string]string `json:"rates"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]float64, len(priceCurrencies))
+	for currency := range priceCurrencies {
+		code := strings.ToUpper(currency)
+		if v, err := strconv.ParseFloat(result.Data.Rates[code], 64); err == nil {
+			rates[code] = v
+		}
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no exchange rates returned")
+	}
+	return rates, nil
+}
+
 func fetchCoinGeckoPrice() (float64, error) {
-	resp, err := http.Get("https://api.coingecko.com/api/v3/simple/price?ids=ethereum&vs_currencies=usd")
+	resp, err := upstreamHTTP.Get("https://api.coingecko.com/api/v3/simple/price?ids=ethereum&vs_currencies=usd")
 	if err != nil {
 		return 0, err
 	}
@@ -77,7 +121,7 @@ func fetchCoinGeckoPrice() (float64, error) {
 }
 
 func fetchCoinbasePrice() (float64, error) {
-	resp, err := http.Get("https://api.coinbase.com/v2/exchange-rates?currency=ETH")
+	resp, err := upstreamHTTP.Get("https://api.coinbase.com/v2/exchange-rates?currency=ETH")
 	if err != nil {
 		return 0, err
 	}
@@ -99,7 +143,7 @@ func fetchCoinbasePrice() (float64, error) {
 }
 
 func fetchKrakenPrice() (float64, error) {
-	resp, err := http.Get("https://api.kraken.com/0/public/Ticker?pair=ETHUSD")
+	resp, err := upstreamHTTP.Get("https://api.kraken.com/0/public/Ticker?pair=ETHUSD")
 	if err != nil {
 		return 0, err
 	}
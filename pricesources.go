@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// priceSource is an exchange quoted in the ETH/USD consensus
+type priceSource struct {
+	name  string
+	fetch func() (float64, error)
+}
+
+// ethPriceSources are polled in order for each price request. Weights and
+// disablement come from price_sources in CONFIG_FILE.
+var ethPriceSources = []priceSource{
+	{"coingecko", fetchCoinGeckoPrice},
+	{"coinbase", fetchCoinbasePrice},
+	{"kraken", fetchKrakenPrice},
+}
+
+func isPriceSource(name string) bool {
+	for _, src := range ethPriceSources {
+		if src.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PriceSourceHealth is the last known state of a price source
+type PriceSourceHealth struct {
+	Name                string  `json:"name"`
+	Enabled             bool    `json:"enabled"`
+	Weight              float64 `json:"weight"`
+	LastPrice           float64 `json:"last_price,omitempty"`
+	LastSuccess         int64   `json:"last_success,omitempty"`
+	LatencyMs           int64   `json:"latency_ms,omitempty"` // of the last attempt
+	DeviationPct        float64 `json:"deviation_pct"`        // from the consensus of the last successful attempt
+	LastError           string  `json:"last_error,omitempty"`
+	LastErrorAt         int64   `json:"last_error_at,omitempty"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+}
+
+// PriceSourceStats tracks each price source's latency, failures and
+// deviation from the consensus price
+type PriceSourceStats struct {
+	mu          sync.Mutex
+	sources     map[string]*PriceSourceHealth
+	consensus   float64
+	consensusAt int64
+	clock       clock.Clock
+}
+
+// NewPriceSourceStats creates an empty tracker
+func NewPriceSourceStats() *PriceSourceStats {
+	return &PriceSourceStats{sources: make(map[string]*PriceSourceHealth), clock: clock.System}
+}
+
+// priceSources is the process-wide price source tracker
+var priceSources = NewPriceSourceStats()
+
+func (s *PriceSourceStats) source(name string) *PriceSourceHealth {
+	h, ok := s.sources[name]
+	if !ok {
+		h = &PriceSourceHealth{Name: name}
+		s.sources[name] = h
+	}
+	return h
+}
+
+// fetch polls src, recording its latency and outcome
+func (s *PriceSourceStats) fetch(src priceSource) (float64, error) {
+	start := s.clock.Now()
+	price, err := src.fetch()
+	if err == nil && !(price > 0) {
+		err = fmt.Errorf("implausible price %v", price)
+	}
+	latency := clock.Since(s.clock, start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.source(src.name)
+	h.LatencyMs = latency.Milliseconds()
+	if err != nil {
+		h.LastError = err.Error()
+		h.LastErrorAt = s.clock.Now().Unix()
+		h.ConsecutiveFailures++
+		return 0, err
+	}
+	h.LastPrice = price
+	h.LastSuccess = s.clock.Now().Unix()
+	h.ConsecutiveFailures = 0
+	return price, nil
+}
+
+// settle records the consensus of one round and how far each source that
+// answered in it was from it
+func (s *PriceSourceStats) settle(consensus float64, prices map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consensus = consensus
+	s.consensusAt = s.clock.Now().Unix()
+	for name, price := range prices {
+		// round is only correct for positive values
+		s.source(name).DeviationPct = math.Round((price-consensus)/consensus*10000) / 100
+	}
+}
+
+// Snapshot returns every configured source, with weights from cfg
+func (s *PriceSourceStats) Snapshot(cfg *RuntimeConfig) []PriceSourceHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]PriceSourceHealth, 0, len(ethPriceSources))
+	for _, src := range ethPriceSources {
+		h := *s.source(src.name)
+		h.Weight, h.Enabled = cfg.PriceSource(src.name)
+		out = append(out, h)
+	}
+	return out
+}
+
+// weightedConsensus fetches every enabled source and returns the weighted
+// mean of those that answered, with each answer
+func weightedConsensus(cfg *RuntimeConfig) (float64, map[string]float64) {
+	prices := make(map[string]float64)
+	var sum, total float64
+	for _, src := range ethPriceSources {
+		weight, ok := cfg.PriceSource(src.name)
+		if !ok {
+			continue
+		}
+		price, err := priceSources.fetch(src)
+		if err != nil {
+			continue
+		}
+		prices[src.name] = price
+		sum += price * weight
+		total += weight
+	}
+	if len(prices) == 0 {
+		return 0, prices
+	}
+	consensus := sum / total
+	priceSources.settle(consensus, prices)
+	return consensus, prices
+}
+
+// handlePriceSources serves GET /api/price/sources (free)
+func (s *PriceSourceStats) handlePriceSources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	sources := s.Snapshot(runtimeConfig.Current())
+
+	s.mu.Lock()
+	consensus, at := s.consensus, s.consensusAt
+	s.mu.Unlock()
+
+	body := map[string]interface{}{"sources": sources}
+	if at != 0 {
+		body["consensus"] = round(consensus, 2)
+		body["consensus_at"] = at
+		body["consensus_age_sec"] = int64(clock.Since(s.clock, time.Unix(at, 0)).Seconds())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestWeightedConsensus(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	stats := NewPriceSourceStats()
+	stats.clock = fake
+	previous, previousSources := priceSources, ethPriceSources
+	priceSources = stats
+	t.Cleanup(func() { priceSources, ethPriceSources = previous, previousSources })
+
+	calls := map[string]int{}
+	quote := func(name string, price float64, err error) priceSource {
+		return priceSource{name, func() (float64, error) {
+			calls[name]++
+			fake.Advance(20 * time.Millisecond)
+			return price, err
+		}}
+	}
+	ethPriceSources = []priceSource{
+		quote("coingecko", 2000, nil),
+		quote("coinbase", 2100, nil),
+		quote("kraken", 0, errors.New("timeout")),
+	}
+
+	cfg, err := parseRuntimeConfig([]byte(`{"price_sources": {"coinbase": {"weight": 3}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	consensus, prices := weightedConsensus(cfg)
+	if consensus != 2075 || len(prices) != 2 {
+		t.Fatalf("consensus = %v from %v, want 2075 from coingecko and coinbase", consensus, prices)
+	}
+
+	fake.Advance(time.Minute)
+	rr := httptest.NewRecorder()
+	previousConfig := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previousConfig)
+	stats.handlePriceSources(rr, httptest.NewRequest("GET", "/api/price/sources", nil))
+
+	var body struct {
+		Consensus float64             `json:"consensus"`
+		Age       int64               `json:"consensus_age_sec"`
+		Sources   []PriceSourceHealth `json:"sources"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Consensus != 2075 || body.Age != 60 || len(body.Sources) != 3 {
+		t.Fatalf("response = %+v", body)
+	}
+	coingecko, coinbase, kraken := body.Sources[0], body.Sources[1], body.Sources[2]
+	if coingecko.Weight != 1 || coingecko.LatencyMs != 20 || coingecko.DeviationPct != -3.61 || coingecko.LastSuccess != epoch.Unix() {
+		t.Errorf("coingecko = %+v", coingecko)
+	}
+	if coinbase.Weight != 3 || coinbase.DeviationPct != 1.2 {
+		t.Errorf("coinbase = %+v", coinbase)
+	}
+	if kraken.LastError != "timeout" || kraken.ConsecutiveFailures != 1 || kraken.LastSuccess != 0 {
+		t.Errorf("kraken = %+v", kraken)
+	}
+
+	// Disabled sources are not polled
+	cfg, err = parseRuntimeConfig([]byte(`{"price_sources": {"kraken": {"disabled": true}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	weightedConsensus(cfg)
+	if calls["kraken"] != 1 || calls["coingecko"] != 2 {
+		t.Errorf("calls = %v", calls)
+	}
+	if weight, ok := cfg.PriceSource("kraken"); ok || weight != 0 {
+		t.Errorf("disabled source reported weight %v", weight)
+	}
+}
+
+func TestPriceSourceConfigValidation(t *testing.T) {
+	for _, bad := range []string{
+		`{"price_sources": {"binance": {}}}`,
+		`{"price_sources": {"kraken": {"weight": -1}}}`,
+		`{"price_sources": {"coingecko": {"disabled": true}, "coinbase": {"disabled": true}, "kraken": {"disabled": true}}}`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(bad)); err == nil {
+			t.Errorf("accepted %s", bad)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLatencySamples is how many recent paid calls a route's average
+// latency is taken over
+const maxLatencySamples = 100
+
+// pricedRoute is a paid route as it was protected, with the latency of its
+// recent paid calls
+type pricedRoute struct {
+	endpoint    string
+	price       string
+	priceUSD    float64
+	description string
+	latencies   []time.Duration // newest last, at most maxLatencySamples
+}
+
+// routeTable remembers every route the paywall protects
+type routeTable struct {
+	mu     sync.Mutex
+	routes map[string]*pricedRoute // endpoint ->
+}
+
+// register adds a protected route. Protecting an endpoint again keeps its
+// latency samples.
+func (t *routeTable) register(endpoint, price string, priceUSD float64, description string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.routes == nil {
+		t.routes = make(map[string]*pricedRoute)
+	}
+	r, ok := t.routes[endpoint]
+	if !ok {
+		r = &pricedRoute{endpoint: endpoint}
+		t.routes[endpoint] = r
+	}
+	r.price, r.priceUSD, r.description = price, priceUSD, description
+}
+
+// replace swaps the routes under prefix for routes, as a config reload
+// replaces gateway routes. A route kept across the swap keeps its latency
+// samples.
+func (t *routeTable) replace(prefix string, routes []paidRoute) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.routes == nil {
+		t.routes = make(map[string]*pricedRoute)
+	}
+	old := make(map[string]*pricedRoute)
+	for endpoint, r := range t.routes {
+		if strings.HasPrefix(endpoint, prefix) {
+			old[endpoint] = r
+			delete(t.routes, endpoint)
+		}
+	}
+	for _, route := range routes {
+		r, ok := old[route.endpoint]
+		if !ok {
+			r = &pricedRoute{endpoint: route.endpoint}
+		}
+		r.price, r.priceUSD, r.description = route.price, route.priceUSD, route.description
+		t.routes[route.endpoint] = r
+	}
+}
+
+// observe records how long a paid call to endpoint took, payment included
+func (t *routeTable) observe(endpoint string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.routes[endpoint]
+	if !ok {
+		return
+	}
+	r.latencies = append(r.latencies, d)
+	if len(r.latencies) > maxLatencySamples {
+		r.latencies = r.latencies[len(r.latencies)-maxLatencySamples:]
+	}
+}
+
+// list returns a copy of every route, by endpoint
+func (t *routeTable) list() []pricedRoute {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]pricedRoute, 0, len(t.routes))
+	for _, endpoint := range sortedKeys(t.routes) {
+		r := *t.routes[endpoint]
+		r.latencies = append([]time.Duration(nil), r.latencies...)
+		out = append(out, r)
+	}
+	return out
+}
+
+// RoutePrice is one row of /api/pricing: what a call to a paid route costs
+// the caller now, and how long recent paid calls took
+type RoutePrice struct {
+	Endpoint       string   `json:"endpoint"`
+	Description    string   `json:"description"`
+	Price          string   `json:"price"` // in Asset
+	Asset          string   `json:"asset"`
+	Network        string   `json:"network"`
+	Networks       []string `json:"networks"` // every network it can be paid on, Network first
+	PriceUSD       float64  `json:"price_usd"`
+	FiatPrice      string   `json:"fiat_price,omitempty"` // the fiat price Price was converted from, if any
+	AvgLatencyMS   float64  `json:"avg_latency_ms,omitempty"`
+	LatencySamples int      `json:"latency_samples"` // paid calls the average is over; 0 if none yet
+}
+
+// Pricing returns the price table as quoted to the caller of r: runtime
+// overrides, the caller's tenant and price experiment variant apply, and
+// fiat prices are converted at the current rate
+func (p *Paywall) Pricing(r *http.Request) ([]RoutePrice, error) {
+	ctx := withClient(r.Context(), p.abuse.clientIP(r))
+	var out []RoutePrice
+	for _, route := range p.routes.list() {
+		q, err := p.quote(ctx, route.endpoint, route.price, route.priceUSD, route.description)
+		if err != nil {
+			return nil, err
+		}
+		q.localize(r)
+		row := RoutePrice{
+			Endpoint:       route.endpoint,
+			Description:    q.description,
+			Price:          q.price,
+			Asset:          q.asset,
+			Network:        p.config.Network,
+			PriceUSD:       q.priceUSD,
+			FiatPrice:      q.fiat,
+			LatencySamples: len(route.latencies),
+		}
+		for _, n := range q.networks {
+			row.Networks = append(row.Networks, n.network)
+		}
+		if len(route.latencies) > 0 {
+			var total time.Duration
+			for _, d := range route.latencies {
+				total += d
+			}
+			row.AvgLatencyMS = round(float64(total)/float64(len(route.latencies))/float64(time.Millisecond), 1)
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+// handlePricing serves GET /api/pricing, the price and average latency of
+// every paid route, so agents can estimate what a workflow costs before
+// starting it
+func (p *Paywall) handlePricing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	routes, err := p.Pricing(r)
+	if err != nil {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if errors.Is(err, errAssetPaused) {
+			json.NewEncoder(w).Encode(map[string]string{"error": "Payments in " + p.config.Asset + " are paused: the asset is off its peg"})
+			return
+		}
+		log.Printf("❌ Pricing table failed: %v", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Pricing unavailable, try again shortly"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": "x402/1.0",
+		"routes":  routes,
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestPricingTable(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(`{"prices": {"/api/scan": "0.02"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	fake := clock.NewFake(time.Now())
+	paywall.SetClock(fake)
+	gas := paywall.Protect("/api/gas", "0.001", 0.001, "Gas prices", func(w http.ResponseWriter, r *http.Request) {
+		fake.Advance(40 * time.Millisecond)
+	})
+	paywall.Protect("/api/scan", "0.01", 0.01, "Contract scan", func(w http.ResponseWriter, r *http.Request) {})
+
+	table := func() map[string]RoutePrice {
+		rr := httptest.NewRecorder()
+		paywall.handlePricing(rr, httptest.NewRequest("GET", "/api/pricing", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("/api/pricing returned %d: %s", rr.Code, rr.Body)
+		}
+		var body struct {
+			Routes []RoutePrice `json:"routes"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		rows := make(map[string]RoutePrice)
+		for _, row := range body.Routes {
+			rows[row.Endpoint] = row
+		}
+		return rows
+	}
+
+	// Every paid route, at the price a challenge would quote
+	rows := table()
+	if len(rows) != 2 {
+		t.Fatalf("routes = %+v, want both paid routes", rows)
+	}
+	if row := rows["/api/scan"]; row.Price != "0.02" || row.PriceUSD != 0.02 || row.Asset != "USDC" || row.Network != "base" {
+		t.Errorf("/api/scan = %+v, want the overridden price", row)
+	}
+	if row := rows["/api/gas"]; row.Price != "0.001" || row.Description != "Gas prices" || row.LatencySamples != 0 || row.AvgLatencyMS != 0 {
+		t.Errorf("/api/gas = %+v, want its price and no latency yet", row)
+	}
+
+	// Paid calls are timed; challenges are not
+	gas(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/gas", nil))
+	for i := 0; i < 2; i++ {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Network = "base"
+		claims.Payment.Receiver = config.Receiver
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment-Response", signPayment(t, claims))
+		rr := httptest.NewRecorder()
+		gas(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("payment returned %d: %s", rr.Code, rr.Body)
+		}
+	}
+	if row := table()["/api/gas"]; row.LatencySamples != 2 || row.AvgLatencyMS != 40 {
+		t.Errorf("/api/gas = %+v, want two paid calls of 40ms", row)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GasProvider reports current gas prices
+type GasProvider interface {
+	GasPrices() (*GasData, error)
+}
+
+// PriceProvider reports the ETH/USD price
+type PriceProvider interface {
+	ETHPrice() (*PriceData, error)
+}
+
+// BeaconProvider reports the validator queue
+type BeaconProvider interface {
+	ValidatorData() (*ValidatorData, error)
+}
+
+// ExplorerProvider answers contract and account lookups from a chain's
+// block explorer
+type ExplorerProvider interface {
+	// ContractABI returns a verified contract's ABI, or errNotVerified
+	ContractABI(addr string, chain ChainConfig) (string, error)
+	ContractSource(addr string, chain ChainConfig) (*contractSource, error)
+	ContractCreation(addr string, chain ChainConfig) (*contractCreation, error)
+	// AccountTxs returns an account's earliest normal ("txlist") or
+	// internal ("txlistinternal") transactions
+	AccountTxs(addr, action string, chain ChainConfig) ([]explorerTx, error)
+	// Call runs a no-argument eth_call and returns the raw result
+	Call(to, selector string, chain ChainConfig) ([]byte, error)
+}
+
+// HoneypotProvider simulates trading a token to detect honeypots
+type HoneypotProvider interface {
+	Honeypot(addr string, chain ChainConfig) (*HoneypotReport, error)
+}
+
+// HoneypotReport is a token's simulated trade. Taxes and liquidity are nil
+// when the simulation could not measure them.
+type HoneypotReport struct {
+	IsHoneypot   bool
+	BuyTaxPct    *float64
+	SellTaxPct   *float64
+	LiquidityUSD *float64
+}
+
+// Providers holds the upstream data providers that handlers and scanners
+// read through, so any of them can be swapped for a mock
+type Providers struct {
+	Gas      GasProvider
+	Price    PriceProvider
+	Beacon   BeaconProvider
+	Explorer ExplorerProvider
+	Honeypot HoneypotProvider
+}
+
+// providers is used by every handler and scanner. newService replaces it
+// according to PROVIDERS.
+var providers = liveProviders(&RPCClient{url: defaultRPCURL})
+
+// liveProviders returns the real upstreams: rpc for gas, the price source
+// consensus, beaconClient, the explorers and honeypot.is
+func liveProviders(rpc *RPCClient) Providers {
+	return Providers{
+		Gas:      rpc,
+		Price:    consensusPrice{},
+		Beacon:   beaconClient,
+		Explorer: etherscanExplorer{},
+		Honeypot: honeypotIs{},
+	}
+}
+
+// Configure swaps providers for mocks. spec is "mock" for all of them, or
+// a list of kind=live|mock such as "explorer=mock,honeypot=mock".
+func (p *Providers) Configure(spec string) error {
+	live, mocks := *p, NewMockProviders()
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch item {
+		case "", "live":
+			continue
+		case "mock":
+			*p = mocks
+			continue
+		}
+		kind, source, _ := strings.Cut(item, "=")
+		var from Providers
+		switch source {
+		case "live":
+			from = live
+		case "mock":
+			from = mocks
+		default:
+			return fmt.Errorf("provider %s: unknown source %q, want live or mock", kind, source)
+		}
+		switch kind {
+		case "gas":
+			p.Gas = from.Gas
+		case "price":
+			p.Price = from.Price
+		case "beacon":
+			p.Beacon = from.Beacon
+		case "explorer":
+			p.Explorer = from.Explorer
+		case "honeypot":
+			p.Honeypot = from.Honeypot
+		default:
+			return fmt.Errorf("unknown provider %q", kind)
+		}
+	}
+	return nil
+}
+
+// consensusPrice is the weighted consensus of the ETH price sources
+type consensusPrice struct{}
+
+// ETHPrice implements PriceProvider
+func (consensusPrice) ETHPrice() (*PriceData, error) {
+	return fetchETHPrice()
+}
+
+// honeypotIs is the honeypot.is simulation API
+type honeypotIs struct{}
+
+// Honeypot implements HoneypotProvider
+func (honeypotIs) Honeypot(addr string, chain ChainConfig) (*HoneypotReport, error) {
+	url := fmt.Sprintf("https://api.honeypot.is/v2/IsHoneypot?address=%s&chainID=%s", addr, chain.ChainID)
+	resp, err := upstreamHTTP.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The v2 API nests the verdict under honeypotResult
+	var result struct {
+		IsHoneypot     bool `json:"IsHoneypot"`
+		HoneypotResult struct {
+			IsHoneypot bool `json:"isHoneypot"`
+		} `json:"honeypotResult"`
+		SimulationResult *struct {
+			BuyTax  float64 `json:"buyTax"`
+			SellTax float64 `json:"sellTax"`
+		} `json:"simulationResult"`
+		Pair *struct {
+			Liquidity float64 `json:"liquidity"`
+		} `json:"pair"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	report := &HoneypotReport{IsHoneypot: result.IsHoneypot || result.HoneypotResult.IsHoneypot}
+	if result.SimulationResult != nil {
+		report.BuyTaxPct = &result.SimulationResult.BuyTax
+		report.SellTaxPct = &result.SimulationResult.SellTax
+	}
+	if result.Pair != nil {
+		report.LiquidityUSD = &result.Pair.Liquidity
+	}
+	return report, nil
+}
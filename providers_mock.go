@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+)
+
+// The mocks below serve fixed, in-memory data. PROVIDERS=mock runs the
+// service on them without any upstream, and tests set them up to drive a
+// scanner through a specific case. Setting Err makes every call fail.
+
+// MockGas serves fixed gas prices
+type MockGas struct {
+	Data GasData
+	Err  error
+}
+
+// GasPrices implements GasProvider
+func (m *MockGas) GasPrices() (*GasData, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	data := m.Data
+	data.Timestamp = time.Now().Unix()
+	return &data, nil
+}
+
+// MockPrice serves a fixed ETH price
+type MockPrice struct {
+	Data PriceData
+	Err  error
+}
+
+// ETHPrice implements PriceProvider
+func (m *MockPrice) ETHPrice() (*PriceData, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	data := m.Data
+	data.Timestamp = time.Now().Unix()
+	return &data, nil
+}
+
+// MockBeacon serves a fixed validator queue
+type MockBeacon struct {
+	Data ValidatorData
+	Err  error
+}
+
+// ValidatorData implements BeaconProvider
+func (m *MockBeacon) ValidatorData() (*ValidatorData, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	data := m.Data
+	data.Timestamp = time.Now().Unix()
+	data.AsOf = data.Timestamp
+	return &data, nil
+}
+
+// MockContract is a contract as a MockExplorer reports it
+type MockContract struct {
+	Name    string
+	ABI     string // empty if the source is not verified
+	Proxy   bool
+	Creator string
+	TxHash  string
+	Created time.Time // zero for no creation timestamp
+}
+
+// MockExplorer answers from contracts, transactions and eth_call results
+// set on it. Unknown contracts are unverified and have no creation record.
+type MockExplorer struct {
+	Err error
+
+	mu        sync.Mutex
+	contracts map[string]MockContract // lowercase address ->
+	txs       map[string][]explorerTx // "action:address" ->
+	calls     map[string][]byte       // "address:selector" ->
+}
+
+// NewMockExplorer returns an explorer that knows no contracts
+func NewMockExplorer() *MockExplorer {
+	return &MockExplorer{
+		contracts: make(map[string]MockContract),
+		txs:       make(map[string][]explorerTx),
+		calls:     make(map[string][]byte),
+	}
+}
+
+// SetContract adds or replaces the contract at addr
+func (m *MockExplorer) SetContract(addr string, c MockContract) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.contracts[strings.ToLower(addr)] = c
+}
+
+// SetTxs sets the transactions AccountTxs returns for an account and action
+func (m *MockExplorer) SetTxs(addr, action string, txs []explorerTx) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.txs[action+":"+strings.ToLower(addr)] = txs
+}
+
+// SetCall sets the result of calling selector on to
+func (m *MockExplorer) SetCall(to, selector string, out []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[strings.ToLower(to)+":"+selector] = out
+}
+
+func (m *MockExplorer) contract(addr string) (MockContract, bool, error) {
+	if m.Err != nil {
+		return MockContract{}, false, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.contracts[strings.ToLower(addr)]
+	return c, ok, nil
+}
+
+// ContractABI implements ExplorerProvider
+func (m *MockExplorer) ContractABI(addr string, chain ChainConfig) (string, error) {
+	c, _, err := m.contract(addr)
+	if err != nil {
+		return "", err
+	}
+	if c.ABI == "" {
+		return "", errNotVerified
+	}
+	return c.ABI, nil
+}
+
+// ContractSource implements ExplorerProvider
+func (m *MockExplorer) ContractSource(addr string, chain ChainConfig) (*contractSource, error) {
+	c, ok, err := m.contract(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no source information")
+	}
+	return &contractSource{Name: c.Name, Verified: c.ABI != "", Proxy: c.Proxy}, nil
+}
+
+// ContractCreation implements ExplorerProvider
+func (m *MockExplorer) ContractCreation(addr string, chain ChainConfig) (*contractCreation, error) {
+	c, ok, err := m.contract(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || c.Creator == "" {
+		return nil, fmt.Errorf("no creation record")
+	}
+	return &contractCreation{Creator: strings.ToLower(c.Creator), TxHash: c.TxHash, Created: c.Created}, nil
+}
+
+// AccountTxs implements ExplorerProvider
+func (m *MockExplorer) AccountTxs(addr, action string, chain ChainConfig) ([]explorerTx, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.txs[action+":"+strings.ToLower(addr)], nil
+}
+
+// Call implements ExplorerProvider
+func (m *MockExplorer) Call(to, selector string, chain ChainConfig) ([]byte, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out, ok := m.calls[strings.ToLower(to)+":"+selector]
+	if !ok {
+		return nil, fmt.Errorf("eth_call failed: execution reverted")
+	}
+	return out, nil
+}
+
+// MockHoneypot reports the tokens set on it as honeypots or not. Unknown
+// tokens trade normally.
+type MockHoneypot struct {
+	Err error
+
+	mu      sync.Mutex
+	reports map[string]HoneypotReport // lowercase address ->
+}
+
+// NewMockHoneypot returns a simulator under which every token trades
+func NewMockHoneypot() *MockHoneypot {
+	return &MockHoneypot{reports: make(map[string]HoneypotReport)}
+}
+
+// SetReport sets the simulation result for addr
+func (m *MockHoneypot) SetReport(addr string, report HoneypotReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reports[strings.ToLower(addr)] = report
+}
+
+// Honeypot implements HoneypotProvider
+func (m *MockHoneypot) Honeypot(addr string, chain ChainConfig) (*HoneypotReport, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := m.reports[strings.ToLower(addr)]
+	return &report, nil
+}
+
+// NewMockProviders returns mocks serving plausible mainnet figures
+func NewMockProviders() Providers {
+	live := types.DataQuality{Quality: types.QualityLive}
+	return Providers{
+		Gas: &MockGas{Data: GasData{
+			Gas:         map[string]float64{"current": 20, "safe": 18, "fast": 24},
+			Unit:        "gwei",
+			Source:      "mock",
+			DataQuality: live,
+		}},
+		Price: &MockPrice{Data: PriceData{
+			Eth:         3000,
+			Sources:     map[string]float64{"mock": 3000},
+			Average:     3000,
+			DataQuality: live,
+		}},
+		Beacon: &MockBeacon{Data: ValidatorData{
+			Queue: map[string]interface{}{
+				"entry_wait_hours":      0,
+				"exit_wait_hours":       0,
+				"churn_limit_per_epoch": 8,
+				"churn_limit_per_day":   1800,
+			},
+			Active:      1000000,
+			DataQuality: live,
+		}},
+		Explorer: NewMockExplorer(),
+		Honeypot: NewMockHoneypot(),
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestProvidersConfigure(t *testing.T) {
+	live := liveProviders(&RPCClient{})
+
+	p := live
+	if err := p.Configure("explorer=mock,honeypot=mock"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Explorer.(*MockExplorer); !ok || p.Gas != live.Gas {
+		t.Errorf("explorer=mock,honeypot=mock gave %+v", p)
+	}
+
+	p = live
+	if err := p.Configure("mock, gas=live"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Price.(*MockPrice); !ok || p.Gas != live.Gas {
+		t.Errorf("mock,gas=live gave %+v", p)
+	}
+
+	for _, bad := range []string{"gas=fake", "oracle=mock", "gas"} {
+		p = live
+		if err := p.Configure(bad); err == nil {
+			t.Errorf("%q: accepted", bad)
+		}
+	}
+}
+
+func TestContractScanWithMockProviders(t *testing.T) {
+	previous := providers
+	t.Cleanup(func() { providers = previous })
+	providers = NewMockProviders()
+
+	const token = "0x1111111111111111111111111111111111111111"
+	explorer := providers.Explorer.(*MockExplorer)
+	explorer.SetContract(token, MockContract{
+		Proxy:   true,
+		Creator: "0x2222222222222222222222222222222222222222",
+		Created: time.Now().Add(-48 * time.Hour),
+	})
+	providers.Honeypot.(*MockHoneypot).SetReport(token, HoneypotReport{IsHoneypot: true})
+
+	result, err := NewContractScanner().Scan(token, "ethereum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, flag := range []string{"unverified_contract", "honeypot_indicators", "deployed_2_days_ago"} {
+		if !slices.Contains(result.Flags, flag) {
+			t.Errorf("flags %v missing %s", result.Flags, flag)
+		}
+	}
+	if !result.IsProxy || result.IsVerified || result.Deployer != "0x2222222222222222222222222222222222222222" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestE2EMockProviders(t *testing.T) {
+	srv, up := startService(t, map[string]string{"PROVIDERS": "mock"})
+
+	resp := paidRequest(t, srv, "GET", "/api/gas", "")
+	defer resp.Body.Close()
+	var body struct {
+		Data GasData `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || body.Data.Source != "mock" {
+		t.Errorf("gas = %d %+v", resp.StatusCode, body.Data)
+	}
+	if up.Hits(testhttp.RPC) != 0 {
+		t.Error("mock gas called the RPC node")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+)
+
+func TestPaywallRateLimit(t *testing.T) {
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	paywall.SetRateLimit(ratelimit.New(1, 1))
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.001"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = config.Receiver
+	claims.Payment.Network = "base"
+	claims.Subject = "0xabc0000000000000000000000000000000000001"
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment-Response", signPayment(t, claims))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	if rr := call(); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "1" || rr.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("first request returned %d %v", rr.Code, rr.Header())
+	}
+	rr := call()
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("limited request returned %d %v", rr.Code, rr.Header())
+	}
+	if entries := ledger.Entries(DefaultTenant); len(entries) != 1 {
+		t.Errorf("ledger has %d entries, want the limited request uncharged", len(entries))
+	}
+}
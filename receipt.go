@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/respsig"
+)
+
+// receipt returns the X-Payment-Response header for the payment payer
+// made with c at endpoint, signed if responses are signed
+func (p *Paywall) receipt(c *charge, payer Payer, endpoint string) string {
+	r := PaymentReceipt{
+		Success:     true,
+		ID:          c.id,
+		Endpoint:    endpoint,
+		Transaction: c.txHash,
+		Network:     c.network,
+		Payer:       payer.String(),
+		Receiver:    c.receiver,
+		Amount:      c.amount,
+		Asset:       c.asset,
+		Timestamp:   p.clock.Now().Unix(),
+	}
+	if responseSigner != nil {
+		respsig.SignReceipt(responseSigner.key, &r)
+	}
+	return respsig.EncodeReceipt(r)
+}
+
+// handleReceipt serves GET /api/receipts/{payment_id}: a signed receipt
+// for a recorded payment, so a payer can prove the purchase to a third
+// party long after the response. It is timestamped when the payment was
+// made, and names the transfer once it is known. Payment IDs are
+// unguessable, so anyone holding one may fetch its receipt.
+func (l *Ledger) handleReceipt(w http.ResponseWriter, r *http.Request) {
+	if responseSigner == nil {
+		http.Error(w, `{"error":"Receipts are not signed - RESPONSE_SIGNING_KEY is not set"}`, http.StatusServiceUnavailable)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/receipts/")
+	e, ok := l.Find(tenantID(r.Context()), id)
+	if !ok {
+		http.Error(w, `{"error":"Payment not found"}`, http.StatusNotFound)
+		return
+	}
+	if e.Status == PaymentReorged {
+		http.Error(w, fmt.Sprintf(`{"error":"Payment %s was dropped by a reorg"}`, e.ID), http.StatusConflict)
+		return
+	}
+
+	receipt := PaymentReceipt{
+		Success:     true,
+		ID:          e.ID,
+		Endpoint:    e.Endpoint,
+		Transaction: e.TxHash,
+		Network:     e.Network,
+		Payer:       e.Payer,
+		Receiver:    e.Receiver,
+		Amount:      e.Amount,
+		Asset:       e.Asset,
+		Timestamp:   e.CreatedAt,
+	}
+	respsig.SignReceipt(responseSigner.key, &receipt)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(receipt)
+}
+
+// receiptWriter adds the payment receipt to a paid response as its headers
+// are written, unless the handler refused the payment by then
+type receiptWriter struct {
+	http.ResponseWriter
+	receipt func() string // "" once the payment is refused
+	wrote   bool
+}
+
+func (w *receiptWriter) WriteHeader(status int) {
+	if !w.wrote {
+		w.wrote = true
+		if receipt := w.receipt(); receipt != "" {
+			w.Header().Set(respsig.HeaderReceipt, receipt)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *receiptWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streamed responses through
+func (w *receiptWriter) Flush() {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/respsig"
+)
+
+func TestPaymentReceipt(t *testing.T) {
+	key, err := respsig.ParsePrivateKey(strings.Repeat("02", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := responseSigner
+	responseSigner = NewResponseSigner(key)
+	defer func() { responseSigner = previous }()
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	refuse := false
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		if refuse {
+			DegradationPolicy{Mode: DegradeRefuse}.Fallback(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":{}}`))
+	})
+	call := func(pay bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		if pay {
+			claims := PaymentToken{}
+			claims.Payment.Amount = "0.001"
+			claims.Payment.Asset = "USDC"
+			claims.Payment.Network = "base"
+			claims.Payment.Receiver = config.Receiver
+			claims.Subject = "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+			req.Header.Set("X-Payment-Response", signPayment(t, claims))
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	if rr := call(false); rr.Header().Get(respsig.HeaderReceipt) != "" {
+		t.Error("402 challenge carries a receipt")
+	}
+
+	// A captured payment comes with a signed receipt matching its ledger entry
+	rr := call(true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("payment returned %d: %s", rr.Code, rr.Body)
+	}
+	receipt, err := respsig.DecodeReceipt(rr.Header().Get(respsig.HeaderReceipt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := respsig.VerifyReceipt(responseSigner.PublicKey(), receipt); err != nil {
+		t.Errorf("receipt signature: %v", err)
+	}
+	entries := ledger.Entries(DefaultTenant)
+	if len(entries) != 1 {
+		t.Fatalf("ledger = %+v, want one entry", entries)
+	}
+	want := PaymentReceipt{
+		Success:   true,
+		ID:        entries[0].ID,
+		Endpoint:  "/api/gas",
+		Network:   "base",
+		Payer:     entries[0].Payer,
+		Receiver:  config.Receiver,
+		Amount:    "0.001",
+		Asset:     "USDC",
+		Timestamp: receipt.Timestamp,
+		KeyID:     respsig.KeyID(key.Public().(ed25519.PublicKey)),
+		Signature: receipt.Signature,
+	}
+	if receipt != want || receipt.ID != rr.Header().Get("X-Payment-Id") {
+		t.Errorf("receipt = %+v, want %+v", receipt, want)
+	}
+
+	// The receipt can be fetched again later, timestamped at payment time
+	fetch := func(id string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		ledger.handleReceipt(rr, httptest.NewRequest("GET", "/api/receipts/"+id, nil))
+		return rr
+	}
+	rr = fetch(receipt.ID)
+	var fetched PaymentReceipt
+	if err := json.NewDecoder(rr.Body).Decode(&fetched); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("fetched receipt returned %d: %v", rr.Code, err)
+	}
+	if err := respsig.VerifyReceipt(responseSigner.PublicKey(), fetched); err != nil {
+		t.Errorf("fetched receipt signature: %v", err)
+	}
+	if fetched.Timestamp != entries[0].CreatedAt || fetched.Endpoint != "/api/gas" || fetched.Payer != receipt.Payer || fetched.Amount != "0.001" {
+		t.Errorf("fetched receipt = %+v", fetched)
+	}
+	if rr := fetch("pay_unknown"); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown payment returned %d", rr.Code)
+	}
+	reorged := entries[0]
+	reorged.Status = PaymentReorged
+	if err := ledger.Update(reorged); err != nil {
+		t.Fatal(err)
+	}
+	if rr := fetch(receipt.ID); rr.Code != http.StatusConflict {
+		t.Errorf("reorged payment returned %d", rr.Code)
+	}
+
+	// A payment the handler refuses gets none
+	refuse = true
+	if rr := call(true); rr.Code != http.StatusServiceUnavailable || rr.Header().Get(respsig.HeaderReceipt) != "" {
+		t.Errorf("refused payment returned %d with receipt %q", rr.Code, rr.Header().Get(respsig.HeaderReceipt))
+	}
+
+	// Without a signing key there is nothing to vouch for a receipt
+	responseSigner = nil
+	if rr := fetch(receipt.ID); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("unsigned receipts returned %d", rr.Code)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// ERC-8004 identity registry on Base
+const (
+	defaultERC8004Registry = "0x8004A169FB4a3325136EB29fA0ceB6D2e539a432"
+	defaultERC8004RPC      = defaultBaseRPC
+)
+
+// agentOwnerTTL is how long a looked-up agent owner is trusted
+const agentOwnerTTL = time.Hour
+
+// AgentRegistry looks up ERC-8004 agents, which are ERC-721 tokens in the
+// identity registry
+type AgentRegistry struct {
+	rpcURL   string
+	registry string
+	clock    clock.Clock
+
+	mu     sync.Mutex
+	owners map[string]agentOwner // agent ID -> owner, "" if not registered
+}
+
+type agentOwner struct {
+	owner string
+	at    time.Time
+}
+
+// NewAgentRegistry reads the registry at address through rpcURL
+func NewAgentRegistry(rpcURL, address string) *AgentRegistry {
+	return &AgentRegistry{rpcURL: rpcURL, registry: address, clock: clock.System, owners: make(map[string]agentOwner)}
+}
+
+// Owner returns the lowercase address that owns agentID, or "" if no such
+// agent is registered
+func (a *AgentRegistry) Owner(agentID string) (string, error) {
+	id, ok := new(big.Int).SetString(agentID, 10)
+	if !ok || id.Sign() < 0 || id.BitLen() > 256 {
+		return "", nil
+	}
+
+	now := a.clock.Now()
+	a.mu.Lock()
+	cached, ok := a.owners[agentID]
+	a.mu.Unlock()
+	if ok && now.Sub(cached.at) < agentOwnerTTL {
+		return cached.owner, nil
+	}
+
+	// ownerOf(uint256) reverts for tokens that were never minted
+	var out string
+	data := "0x6352211e" + fmt.Sprintf("%064x", id)
+	err := jsonRPC(a.rpcURL, "eth_call", []interface{}{map[string]string{"to": a.registry, "data": data}, "latest"}, &out)
+	var rpcErr *jsonRPCError
+	if err != nil && !errors.As(err, &rpcErr) {
+		return "", err
+	}
+	owner := ""
+	if err == nil {
+		raw, _ := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+		if word, err := abiData(raw).address(0); err == nil && !address.IsZero(word) {
+			owner = strings.ToLower(word)
+		}
+	}
+
+	a.mu.Lock()
+	a.owners[agentID] = agentOwner{owner: owner, at: now}
+	a.mu.Unlock()
+	return owner, nil
+}
+
+// Referrals shares revenue with the ERC-8004 agents that referred payers.
+// A nil *Referrals records no shares.
+type Referrals struct {
+	registry *AgentRegistry
+	share    float64 // fraction of each payment
+}
+
+// NewReferrals shares sharePct percent of referred payments, or returns nil
+// if sharePct is not positive
+func NewReferrals(registry *AgentRegistry, sharePct float64) *Referrals {
+	if sharePct <= 0 {
+		return nil
+	}
+	return &Referrals{registry: registry, share: sharePct / 100}
+}
+
+// lookup returns the payout address and share for a payment from payer
+// referred by agentID. Unknown agents and payers referring themselves get
+// nothing. If the registry is unreachable no share is recorded.
+func (r *Referrals) lookup(agentID, payer string) (string, float64, bool) {
+	if r == nil || agentID == "" {
+		return "", 0, false
+	}
+	owner, err := r.registry.Owner(agentID)
+	if err != nil {
+		log.Printf("⚠️  Referrer %s not checked, no share recorded: %v", agentID, err)
+		return "", 0, false
+	}
+	if owner == "" || owner == payer {
+		log.Printf("Referrer %s ignored: not a registered agent or the payer itself", agentID)
+		return "", 0, false
+	}
+	return owner, r.share, true
+}
+
+// ReferrerPayout is what one referrer has earned
+type ReferrerPayout struct {
+	Referrer    string  `json:"referrer"` // ERC-8004 agent ID
+	Address     string  `json:"address"`  // payout address at the latest payment
+	Payments    int     `json:"payments"`
+	RevenueUSD  float64 `json:"revenue_usd"`
+	ShareUSD    float64 `json:"share_usd"`
+	ShareAmount float64 `json:"share_amount"` // in Asset
+	Asset       string  `json:"asset"`
+}
+
+// referralReport sums the referral shares in entries created at or after
+// since, one row per referrer and asset, largest share first
+func referralReport(entries []LedgerEntry, since int64) []ReferrerPayout {
+	byReferrer := make(map[string]*ReferrerPayout)
+	for _, e := range entries {
+		if e.Referrer == "" || e.CreatedAt < since {
+			continue
+		}
+		key := e.Referrer + " " + e.Asset
+		p, ok := byReferrer[key]
+		if !ok {
+			p = &ReferrerPayout{Referrer: e.Referrer, Asset: e.Asset}
+			byReferrer[key] = p
+		}
+		share, _ := strconv.ParseFloat(e.ReferralAmount, 64)
+		p.Address = e.ReferrerAddress
+		p.Payments++
+		p.RevenueUSD += e.AmountUSD
+		p.ShareUSD += e.ReferralUSD
+		p.ShareAmount += share
+	}
+	out := []ReferrerPayout{}
+	for _, p := range byReferrer {
+		p.RevenueUSD, p.ShareUSD, p.ShareAmount = round(p.RevenueUSD, 6), round(p.ShareUSD, 6), round(p.ShareAmount, 12)
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ShareUSD != out[j].ShareUSD {
+			return out[i].ShareUSD > out[j].ShareUSD
+		}
+		if out[i].Referrer != out[j].Referrer {
+			return out[i].Referrer < out[j].Referrer
+		}
+		return out[i].Asset < out[j].Asset
+	})
+	return out
+}
+
+// handleAdminReferrals serves GET /admin/referrals, the payout owed to each
+// referrer. ?tenant= limits it to one tenant and ?since= (unix seconds) to
+// recent payments; Accept: text/csv returns the rows alone.
+func (l *Ledger) handleAdminReferrals(w http.ResponseWriter, r *http.Request) {
+	since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	tenants := l.Tenants()
+	if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		tenants = []string{tenant}
+	}
+	var entries []LedgerEntry
+	for _, tenant := range tenants {
+		entries = append(entries, l.Entries(tenant)...)
+	}
+	payouts := referralReport(entries, since)
+	writeNegotiated(w, r, map[string]interface{}{
+		"since":     since,
+		"referrers": payouts,
+	}, payouts)
+}
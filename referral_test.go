@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestReferrals(t *testing.T) {
+	srv, up := startService(t, map[string]string{"REFERRAL_SHARE_PCT": "10"})
+
+	const agentOwner = "0x00000000000000000000000000000000000000a1"
+	const payer = "0xabc0000000000000000000000000000000000001"
+	ownedBy := func(owner string) string {
+		return "0x" + strings.Repeat("0", 24) + strings.TrimPrefix(owner, "0x")
+	}
+	referred := func(referrer string) {
+		t.Helper()
+		challenge, err := http.Get(srv.URL + "/api/gas")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer challenge.Body.Close()
+		var claims PaymentToken
+		jwt.ParseWithClaims(pay(t, challenge), &claims, func(*jwt.Token) (interface{}, error) { return []byte(testSigningKey), nil })
+		claims.Payment.Referrer = referrer
+		token := signPayment(t, claims)
+
+		req, _ := http.NewRequest("GET", srv.URL+"/api/gas", nil)
+		req.Header.Set("X-Payment-Response", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("payment referred by %s returned %d", referrer, resp.StatusCode)
+		}
+	}
+
+	up.SetRPCResult("eth_call", ownedBy(agentOwner))
+	referred("42")
+	referred("42")
+	up.SetRPCResult("eth_call", ownedBy(payer))
+	referred("7") // the payer's own agent
+	up.SetRPCResult("eth_call", "0x")
+	referred("8") // never registered
+
+	entries := ledgerEntries(t, srv)
+	if len(entries) != 4 {
+		t.Fatalf("ledger = %+v", entries)
+	}
+	shares := map[string]string{}
+	for _, e := range entries {
+		shares[e.Referrer] += e.ReferrerAddress + " " + e.ReferralAmount + " "
+	}
+	want := agentOwner + " 0.0001 "
+	if shares["42"] != want+want || shares["7"] != "" || shares["8"] != "" {
+		t.Errorf("referral shares = %q", shares)
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/admin/referrals", nil)
+	req.Header.Set("Authorization", "Bearer "+e2eAdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var report struct {
+		Referrers []ReferrerPayout `json:"referrers"`
+	}
+	json.NewDecoder(resp.Body).Decode(&report)
+	if len(report.Referrers) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if r := report.Referrers[0]; r.Referrer != "42" || r.Address != agentOwner || r.Payments != 2 || r.ShareAmount != 0.0002 {
+		t.Errorf("payout = %+v", r)
+	}
+}
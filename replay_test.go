@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+// replayUpstreams serves upstream calls from testdata/upstream/name.json.
+// Set UPSTREAM_RECORD=1 to re-capture the file from the real APIs.
+func replayUpstreams(t *testing.T, name string) {
+	t.Helper()
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = testhttp.Replay(t, filepath.Join("testdata", "upstream", name+".json"))
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+}
+
+func TestScannerReplay(t *testing.T) {
+	tests := []struct {
+		cassette  string
+		address   string
+		chain     string
+		verified  bool
+		proxy     bool
+		honeypot  bool
+		riskScore int
+		flags     []string
+	}{
+		{"contract-verified-proxy", "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", "ethereum", true, true, false, 0, []string{"recognized_protocol_contract"}},
+		{"contract-honeypot", "0x5e2a3b2f1c3d4e5f60718293a4b5c6d7e8f90a1b", "base", false, false, true, 80, []string{"unverified_contract", "honeypot_indicators"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cassette, func(t *testing.T) {
+			replayUpstreams(t, tt.cassette)
+
+			result, err := NewContractScanner().Scan(tt.address, tt.chain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.IsVerified != tt.verified || result.IsProxy != tt.proxy || result.IsHoneypot != tt.honeypot {
+				t.Errorf("verified=%v proxy=%v honeypot=%v, want %v %v %v",
+					result.IsVerified, result.IsProxy, result.IsHoneypot, tt.verified, tt.proxy, tt.honeypot)
+			}
+			if result.RiskScore != tt.riskScore || strings.Join(result.Flags, ",") != strings.Join(tt.flags, ",") {
+				t.Errorf("risk %d flags %v, want %d %v", result.RiskScore, result.Flags, tt.riskScore, tt.flags)
+			}
+			if result.Deployer == "" || result.DeployedAt == 0 {
+				t.Errorf("deployer %q deployed at %d, want the creation record", result.Deployer, result.DeployedAt)
+			}
+		})
+	}
+}
+
+func TestPreflightReplay(t *testing.T) {
+	replayUpstreams(t, "preflight-unlimited-approve")
+
+	result, err := NewTxSimulator("https://eth.drpc.org").Simulate(&TxPreflightRequest{
+		From: "0x742d35cc6634c0532925a3b844bc454e4438f44e",
+		To:   "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48",
+		Data: "0x095ea7b3000000000000000000000000000000000022d473030f116ddee9f6b43ac78ba3ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.SimulationSuccess || result.GasEstimate != "55488" {
+		t.Errorf("simulation %v gas %q, want success with 55488 (46240 + 20%%)", result.SimulationSuccess, result.GasEstimate)
+	}
+	warnings := strings.Join(result.Warnings, "|")
+	if !strings.Contains(warnings, "Recognized protocol contract: USD Coin") || !strings.Contains(warnings, "Unlimited token approval") {
+		t.Errorf("warnings = %v", result.Warnings)
+	}
+	if result.RiskScore != 30 {
+		t.Errorf("risk score = %d, want 30", result.RiskScore)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Response schema modes (RESPONSE_SCHEMAS)
+const (
+	SchemaCheckOff    = "off"
+	SchemaCheckLog    = "log"    // log responses that drift from their schema
+	SchemaCheckStrict = "strict" // and answer 500 instead of sending them
+)
+
+// skillEndpoints maps each OASF skill to the paid endpoint serving it.
+// TestResponseSchemas keeps it in step with the manifest.
+var skillEndpoints = map[string]string{
+	"gas_monitoring":       "/api/gas",
+	"validator_queue":      "/api/validators",
+	"token_security_scan":  "/api/scan-token",
+	"wallet_risk_analysis": "/api/scan-wallet",
+	"address_labels":       "/api/address-label",
+	"mev_protection":       "/api/mev-check",
+	"tx_preflight":         "/api/tx-preflight",
+}
+
+// responseSchemas checks paid responses before they are sent, nil when
+// checks are off
+var responseSchemas *ResponseSchemas
+
+// ResponseSchemas checks what paid endpoints return against the output
+// schemas their skills declare in the OASF manifest, so a handler that
+// drifts from the contract agents code against is caught. Undeclared
+// properties are allowed, as adding fields breaks no one.
+type ResponseSchemas struct {
+	strict  bool
+	schemas map[string]map[string]interface{} // endpoint -> output schema
+
+	mu         sync.Mutex
+	violations map[string]int // endpoint -> drifted responses
+}
+
+// NewResponseSchemas reads RESPONSE_SCHEMAS. It returns nil when checks
+// are off.
+func NewResponseSchemas(mode string) (*ResponseSchemas, error) {
+	switch mode {
+	case "", SchemaCheckOff:
+		return nil, nil
+	case SchemaCheckLog, SchemaCheckStrict:
+	default:
+		return nil, fmt.Errorf("unknown mode %q (use off, log or strict)", mode)
+	}
+	s := &ResponseSchemas{
+		strict:     mode == SchemaCheckStrict,
+		schemas:    make(map[string]map[string]interface{}),
+		violations: make(map[string]int),
+	}
+	for _, skill := range oasfSkills() {
+		if endpoint, ok := skillEndpoints[skill.ID]; ok {
+			s.schemas[endpoint] = skill.OutputSchema
+		}
+	}
+	return s, nil
+}
+
+// Check validates the data an endpoint is about to send and logs any
+// drift. In strict mode it returns an error for a drifted response, which
+// must then not be sent.
+func (s *ResponseSchemas) Check(endpoint string, data interface{}) error {
+	if s == nil {
+		return nil
+	}
+	schema, ok := s.schemas[endpoint]
+	if !ok {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	violations := schemaViolations("data", schema, v)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.violations[endpoint]++
+	s.mu.Unlock()
+	log.Printf("⚠️ Response from %s does not match its declared schema: %s", endpoint, strings.Join(violations, "; "))
+	if s.strict {
+		return fmt.Errorf("response does not match the declared schema: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// schemaViolations lists where v, found at path, departs from schema. Only
+// the type, properties, required and items keywords are checked. Null
+// stands in for an empty array or object, as Go encodes nil slices and
+// maps.
+func schemaViolations(path string, schema map[string]interface{}, v interface{}) []string {
+	typ, _ := schema["type"].(string)
+	if !schemaTypeMatches(typ, v) {
+		return []string{fmt.Sprintf("%s: %s, want %s", path, jsonType(v), typ)}
+	}
+
+	var out []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if _, ok := v[name]; !ok {
+				out = append(out, path+"."+name+": missing")
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sub, _ := props[name].(map[string]interface{})
+			if value, ok := v[name]; ok {
+				out = append(out, schemaViolations(path+"."+name, sub, value)...)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				out = append(out, schemaViolations(fmt.Sprintf("%s[%d]", path, i), items, item)...)
+			}
+		}
+	}
+	return out
+}
+
+func schemaTypeMatches(typ string, v interface{}) bool {
+	switch typ {
+	case "":
+		return true
+	case "object", "array":
+		return v == nil || jsonType(v) == typ
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	default:
+		return jsonType(v) == typ
+	}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// WriteMetrics appends drifted responses per endpoint to the Prometheus
+// output
+func (s *ResponseSchemas) WriteMetrics(b *strings.Builder) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoints := make([]string, 0, len(s.violations))
+	for endpoint := range s.violations {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	b.WriteString("# HELP x402_response_schema_violations_total Paid responses that did not match their declared output schema\n")
+	b.WriteString("# TYPE x402_response_schema_violations_total counter\n")
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(b, "x402_response_schema_violations_total{endpoint=%q} %d\n", endpoint, s.violations[endpoint])
+	}
+}
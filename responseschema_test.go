@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResponseSchemas(t *testing.T) {
+	skills := oasfSkills()
+	for _, skill := range skills {
+		if _, ok := skillEndpoints[skill.ID]; !ok {
+			t.Errorf("skill %s has no endpoint in skillEndpoints", skill.ID)
+		}
+	}
+	if len(skillEndpoints) != len(skills) {
+		t.Errorf("skillEndpoints has %d entries for %d skills", len(skillEndpoints), len(skills))
+	}
+
+	s, err := NewResponseSchemas(SchemaCheckStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := &ValidatorData{Queue: map[string]interface{}{"entry_wait_hours": 4, "exit_wait_hours": 0}}
+	if err := s.Check("/api/validators", ok); err != nil {
+		t.Errorf("matching response rejected: %v", err)
+	}
+	drifted := &ValidatorData{Queue: map[string]interface{}{"entry_wait_time_days": 0.2, "exit_wait_hours": "0"}}
+	err = s.Check("/api/validators", drifted)
+	if err == nil || !strings.Contains(err.Error(), "data.queue.entry_wait_hours: missing") || !strings.Contains(err.Error(), "data.queue.exit_wait_hours: string, want number") {
+		t.Errorf("drifted response: %v", err)
+	}
+	if err := s.Check("/api/scan-wallet", map[string]interface{}{"risk_score": 1.5, "suspicious_tokens": 0, "holdings": map[string]interface{}{}}); err == nil {
+		t.Error("fractional risk_score and object holdings accepted")
+	}
+	if err := s.Check("/api/prompt-test", map[string]interface{}{}); err != nil {
+		t.Errorf("endpoint without a schema checked: %v", err)
+	}
+
+	logged, _ := NewResponseSchemas(SchemaCheckLog)
+	if err := logged.Check("/api/validators", drifted); err != nil {
+		t.Errorf("log mode refused a response: %v", err)
+	}
+	var b strings.Builder
+	logged.WriteMetrics(&b)
+	if !strings.Contains(b.String(), `x402_response_schema_violations_total{endpoint="/api/validators"} 1`) {
+		t.Errorf("metrics = %s", b.String())
+	}
+	if off, err := NewResponseSchemas(""); off != nil || err != nil {
+		t.Errorf("default mode = %v, %v, want off", off, err)
+	}
+	if _, err := NewResponseSchemas("loud"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+func TestE2EDriftedResponseNotSent(t *testing.T) {
+	srv, _ := startService(t, map[string]string{"PROVIDERS": "mock"})
+	providers.Beacon.(*MockBeacon).Data.Queue = map[string]interface{}{"entry_wait_time_days": 0}
+
+	resp := paidRequest(t, srv, "GET", "/api/validators", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("drifted response returned %d, want 500", resp.StatusCode)
+	}
+	if entries := ledgerEntries(t, srv); len(entries) != 0 {
+		t.Errorf("drifted response charged: %+v", entries)
+	}
+}
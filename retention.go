@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// RetentionPolicy says how long each kind of record is kept. Zero keeps
+// records forever.
+type RetentionPolicy struct {
+	Ledger       time.Duration `json:"ledger"`
+	Jobs         time.Duration `json:"jobs"`
+	PayerMetrics time.Duration `json:"payer_metrics"`
+}
+
+// retentionPolicyFromEnv reads RETENTION_LEDGER_DAYS, RETENTION_JOBS_HOURS
+// and RETENTION_PAYER_METRICS_DAYS
+func retentionPolicyFromEnv() RetentionPolicy {
+	return RetentionPolicy{
+		Ledger:       time.Duration(getEnvInt("RETENTION_LEDGER_DAYS", 0)) * 24 * time.Hour,
+		Jobs:         time.Duration(getEnvInt("RETENTION_JOBS_HOURS", 24)) * time.Hour,
+		PayerMetrics: time.Duration(getEnvInt("RETENTION_PAYER_METRICS_DAYS", 0)) * 24 * time.Hour,
+	}
+}
+
+// PurgeReport counts the records removed for a payer
+type PurgeReport struct {
+	Payer         string `json:"payer"`
+	LedgerEntries int    `json:"ledger_entries"`
+	Jobs          int    `json:"jobs"`
+	Metrics       bool   `json:"metrics"`
+	WatchList     bool   `json:"watch_list"`
+}
+
+// Retention prunes records older than the policy allows and erases
+// everything held about a payer on request
+type Retention struct {
+	policy  RetentionPolicy
+	ledger  *Ledger
+	jobs    *JobManager
+	metrics *Metrics
+	clock   clock.Clock
+}
+
+// NewRetention applies policy to the given stores. The job TTL is set
+// immediately; schedule Prune for the rest.
+func NewRetention(policy RetentionPolicy, ledger *Ledger, jobs *JobManager, metrics *Metrics) *Retention {
+	jobs.SetTTL(policy.Jobs)
+	return &Retention{
+		policy:  policy,
+		ledger:  ledger,
+		jobs:    jobs,
+		metrics: metrics,
+		clock:   clock.System,
+	}
+}
+
+// Prune removes ledger entries and per-payer counters older than the
+// policy allows. Expired jobs are dropped by the job manager itself.
+func (r *Retention) Prune() {
+	now := r.clock.Now()
+	if r.policy.Ledger > 0 {
+		cutoff := now.Add(-r.policy.Ledger).Unix()
+		n, err := r.ledger.Remove(func(e LedgerEntry) bool { return e.CreatedAt < cutoff })
+		if err != nil {
+			log.Printf("⚠️  Ledger pruning failed: %v", err)
+		} else if n > 0 {
+			log.Printf("🧹 Pruned %d ledger entries older than %s", n, r.policy.Ledger)
+		}
+	}
+	if r.policy.PayerMetrics > 0 {
+		if n := r.metrics.PrunePayers(now.Add(-r.policy.PayerMetrics)); n > 0 {
+			log.Printf("🧹 Pruned payment counters for %d inactive payers", n)
+		}
+	}
+}
+
+// PurgePayer erases every ledger entry, job, metric series and the watch
+// list for address
+func (r *Retention) PurgePayer(address string) (PurgeReport, error) {
+	report := PurgeReport{Payer: address}
+	n, err := r.ledger.Remove(func(e LedgerEntry) bool { return strings.EqualFold(e.Payer, address) })
+	report.LedgerEntries = n
+	if err != nil {
+		return report, err
+	}
+	report.Jobs = r.jobs.RemovePayer(address)
+	report.Metrics = r.metrics.ForgetPayer(address)
+	report.WatchList, err = watchLists.Delete(address)
+	return report, err
+}
+
+// handleAdminPayers serves DELETE /admin/payers/{address}, erasing all
+// records held about a payer
+func (r *Retention) handleAdminPayers(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	address := strings.ToLower(strings.TrimPrefix(req.URL.Path, "/admin/payers/"))
+	if !isValidAddress(address) {
+		http.Error(w, `{"error":"Invalid payer address"}`, http.StatusBadRequest)
+		return
+	}
+
+	report, err := r.PurgePayer(address)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "purge failed: "+err.Error()), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🗑️  Purged payer %s: %d ledger entries, %d jobs", address, report.LedgerEntries, report.Jobs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+const (
+	alice = "0xa11ce00000000000000000000000000000000001"
+	bob   = "0xb0b0000000000000000000000000000000000002"
+)
+
+func newTestRetention(t *testing.T, policy RetentionPolicy) (*Retention, *clock.Fake, string) {
+	t.Helper()
+	dir := t.TempDir()
+	ledger, err := NewLedger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(epoch)
+	metrics := NewMetrics()
+	metrics.clock = fake
+	jobs := NewJobManager(dir, 0, metrics)
+	jobs.clock = fake
+
+	r := NewRetention(policy, ledger, jobs, metrics)
+	r.clock = fake
+	return r, fake, dir
+}
+
+func recordPayment(t *testing.T, r *Retention, tenant, payer string) {
+	t.Helper()
+	if _, err := r.ledger.Record(LedgerEntry{Tenant: tenant, Endpoint: "/api/gas", Payer: payer, CreatedAt: r.clock.Now().Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	r.metrics.RecordPayment("/api/gas", payer, 0.001)
+}
+
+func TestRetentionPrune(t *testing.T) {
+	r, fake, dir := newTestRetention(t, RetentionPolicy{Ledger: 30 * 24 * time.Hour, PayerMetrics: 7 * 24 * time.Hour})
+
+	recordPayment(t, r, DefaultTenant, alice)
+	fake.Advance(20 * 24 * time.Hour)
+	recordPayment(t, r, DefaultTenant, bob)
+	fake.Advance(15 * 24 * time.Hour)
+
+	r.Prune()
+	entries := r.ledger.Entries(DefaultTenant)
+	if len(entries) != 1 || entries[0].Payer != bob {
+		t.Errorf("entries after prune = %+v", entries)
+	}
+	if _, ok := r.metrics.paymentsByPayer[bob]; ok {
+		t.Error("inactive payer's counter was kept")
+	}
+
+	// Pruning survives a restart
+	reopened, err := NewLedger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(reopened.Entries(DefaultTenant)); n != 1 {
+		t.Errorf("reloaded ledger has %d entries, want 1", n)
+	}
+}
+
+func TestRetentionZeroKeepsForever(t *testing.T) {
+	r, fake, _ := newTestRetention(t, RetentionPolicy{})
+	recordPayment(t, r, DefaultTenant, alice)
+	r.jobs.jobs["done"] = &Job{ID: "done", Status: JobSucceeded, UpdatedAt: fake.Now().Unix()}
+
+	fake.Advance(10 * 365 * 24 * time.Hour)
+	r.Prune()
+	r.jobs.expire()
+	if len(r.ledger.Entries(DefaultTenant)) != 1 || len(r.jobs.jobs) != 1 || r.metrics.paymentsByPayer[alice] != 1 {
+		t.Error("records removed with retention disabled")
+	}
+}
+
+func TestAdminPurgePayer(t *testing.T) {
+	r, _, _ := newTestRetention(t, RetentionPolicy{})
+	recordPayment(t, r, DefaultTenant, alice)
+	recordPayment(t, r, "agent-b", alice)
+	recordPayment(t, r, DefaultTenant, bob)
+	r.jobs.jobs["a"] = &Job{ID: "a", Status: JobSucceeded, Payer: Payer{Address: alice}}
+	r.jobs.jobs["b"] = &Job{ID: "b", Status: JobSucceeded, Payer: Payer{Address: bob}}
+
+	rec := httptest.NewRecorder()
+	r.handleAdminPayers(rec, httptest.NewRequest(http.MethodDelete, "/admin/payers/not-an-address", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid address returned %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	r.handleAdminPayers(rec, httptest.NewRequest(http.MethodDelete, "/admin/payers/"+strings.Replace(alice, "a11ce", "A11CE", 1), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("purge returned %d: %s", rec.Code, rec.Body)
+	}
+	var report PurgeReport
+	json.NewDecoder(rec.Body).Decode(&report)
+	if report != (PurgeReport{Payer: alice, LedgerEntries: 2, Jobs: 1, Metrics: true}) {
+		t.Errorf("report = %+v", report)
+	}
+
+	if len(r.ledger.Entries("agent-b")) != 0 || len(r.ledger.Entries(DefaultTenant)) != 1 {
+		t.Error("ledger still holds the purged payer")
+	}
+	if _, ok := r.jobs.jobs["b"]; !ok || len(r.jobs.jobs) != 1 {
+		t.Errorf("jobs after purge = %v", r.jobs.jobs)
+	}
+	if _, ok := r.metrics.paymentsByPayer[alice]; ok {
+		t.Error("metrics still hold the purged payer")
+	}
+
+	rec = httptest.NewRecorder()
+	r.handleAdminPayers(rec, httptest.NewRequest(http.MethodGet, "/admin/payers/"+bob, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET returned %d, want 405", rec.Code)
+	}
+}
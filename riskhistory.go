@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+)
+
+// maxRiskHistory caps the scores kept in memory, and served, per address
+const maxRiskHistory = 1000
+
+// riskTrendThreshold is how far a score has to move to count as a trend
+const riskTrendThreshold = 10
+
+// Risk trends
+const (
+	RiskRising  = "rising"
+	RiskFalling = "falling"
+	RiskSteady  = "steady"
+	RiskUnknown = "unknown" // fewer than two scores from the latest model
+)
+
+// RiskScoreRecord is one risk score computed for an address
+type RiskScoreRecord struct {
+	Chain        string `json:"chain"`
+	Address      string `json:"address"` // lowercase
+	Kind         string `json:"kind"`    // token or contract
+	RiskScore    int    `json:"risk_score"`
+	ModelVersion string `json:"model_version"`
+	RulesetHash  string `json:"ruleset_hash,omitempty"` // the operator's rules the score applied
+	ScoredAt     int64  `json:"scored_at"`
+}
+
+// RiskHistoryResult is the body of /api/risk-history/{address}
+type RiskHistoryResult struct {
+	Address string            `json:"address"`
+	Chain   string            `json:"chain"`
+	Trend   string            `json:"trend"`
+	Change  int               `json:"change"` // latest score minus the first from the same kind and model
+	Scores  []RiskScoreRecord `json:"scores"` // newest first
+}
+
+// RiskHistory records every risk score a scan computes, appended to
+// DATA_DIR/risk_history.jsonl. The newest maxRiskHistory scores of each
+// address are kept in memory.
+type RiskHistory struct {
+	path string
+
+	mu      sync.RWMutex
+	records map[string][]RiskScoreRecord // "chain:address" -> records, oldest first
+}
+
+// NewRiskHistory opens the history in dataDir, loading the scores recorded
+// so far
+func NewRiskHistory(dataDir string) (*RiskHistory, error) {
+	h := &RiskHistory{
+		path:    filepath.Join(dataDir, "risk_history.jsonl"),
+		records: make(map[string][]RiskScoreRecord),
+	}
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec RiskScoreRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn final line from a crash is skipped, not fatal
+			log.Printf("⚠️  Skipping bad risk history line in %s: %v", h.path, err)
+			continue
+		}
+		h.add(rec)
+	}
+	return h, scanner.Err()
+}
+
+func riskHistoryKey(chain, addr string) string {
+	return chain + ":" + strings.ToLower(addr)
+}
+
+// add keeps rec in memory; the caller holds mu or owns h
+func (h *RiskHistory) add(rec RiskScoreRecord) {
+	key := riskHistoryKey(rec.Chain, rec.Address)
+	records := append(h.records[key], rec)
+	if len(records) > maxRiskHistory {
+		records = records[len(records)-maxRiskHistory:]
+	}
+	h.records[key] = records
+}
+
+// Record appends a score to the history. A score already recorded, as a
+// cached scan result published again is, is skipped.
+func (h *RiskHistory) Record(rec RiskScoreRecord) error {
+	rec.Address = strings.ToLower(rec.Address)
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if records := h.records[riskHistoryKey(rec.Chain, rec.Address)]; len(records) > 0 && records[len(records)-1] == rec {
+		return nil
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	h.add(rec)
+	return nil
+}
+
+// onScanCompleted records the risk score of a finished token or contract
+// scan
+func (h *RiskHistory) onScanCompleted(_ context.Context, e Event) error {
+	scan := e.Data.(ScanCompleted)
+	rec := RiskScoreRecord{Chain: scan.Chain, Address: scan.Address, Kind: scan.Kind}
+	var scored Scoring
+	switch result := scan.Result.(type) {
+	case TokenScanResult:
+		rec.RiskScore, rec.ScoredAt, scored = result.RiskScore, result.ScannedAt, result.Scoring
+	case *TokenScanResult:
+		rec.RiskScore, rec.ScoredAt, scored = result.RiskScore, result.ScannedAt, result.Scoring
+	case *ContractScanResult:
+		rec.RiskScore, rec.ScoredAt, scored = result.RiskScore, result.ScannedAt, result.Scoring
+	default:
+		return nil
+	}
+	rec.ModelVersion, rec.RulesetHash = scored.ModelVersion, scored.RulesetHash
+	if rec.ModelVersion == "" {
+		rec.ModelVersion = riskModelVersions[scan.Kind]
+	}
+	if rec.ScoredAt == 0 {
+		rec.ScoredAt = e.At.Unix()
+	}
+	if err := h.Record(rec); err != nil {
+		log.Printf("⚠️  Recording the risk score of %s failed: %v", scan.Address, err)
+		return err
+	}
+	return nil
+}
+
+// History returns up to limit scores of addr on chain, newest first, and
+// optionally of one kind only. The trend compares the newest score with
+// the oldest one of the same kind and model version.
+func (h *RiskHistory) History(chain, addr, kind string, limit int) RiskHistoryResult {
+	result := RiskHistoryResult{Address: strings.ToLower(addr), Chain: chain, Trend: RiskUnknown, Scores: []RiskScoreRecord{}}
+	h.mu.RLock()
+	records := h.records[riskHistoryKey(chain, addr)]
+	for i := len(records) - 1; i >= 0 && len(result.Scores) < limit; i-- {
+		if kind == "" || records[i].Kind == kind {
+			result.Scores = append(result.Scores, records[i])
+		}
+	}
+	h.mu.RUnlock()
+
+	if len(result.Scores) == 0 {
+		return result
+	}
+	latest := result.Scores[0]
+	var first *RiskScoreRecord
+	for i := range result.Scores[1:] {
+		if s := &result.Scores[i+1]; s.Kind == latest.Kind && s.ModelVersion == latest.ModelVersion {
+			first = s
+		}
+	}
+	if first == nil {
+		return result
+	}
+	result.Change = latest.RiskScore - first.RiskScore
+	switch {
+	case result.Change >= riskTrendThreshold:
+		result.Trend = RiskRising
+	case result.Change <= -riskTrendThreshold:
+		result.Trend = RiskFalling
+	default:
+		result.Trend = RiskSteady
+	}
+	return result
+}
+
+// handleRiskHistory serves GET /api/risk-history/{address}: the risk
+// scores recorded for an address, and whether it has been getting
+// riskier. ?chain= picks the chain (base by default), ?kind= token or
+// contract scores only, and ?limit= how many scores to return.
+func (h *RiskHistory) handleRiskHistory(w http.ResponseWriter, r *http.Request) {
+	addr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/risk-history"), "/")
+	if err := address.Validate(addr); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "Invalid address: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	chain := q.Get("chain")
+	if chain == "" {
+		chain = "base"
+	}
+	if _, ok := runtimeConfig.Current().Chain(chain); !ok {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, "Chain must be one of "+runtimeConfig.Current().ChainNames()), http.StatusBadRequest)
+		return
+	}
+	kind := q.Get("kind")
+	if _, ok := riskModelVersions[kind]; kind != "" && !ok {
+		http.Error(w, `{"error":"kind must be token or contract"}`, http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxRiskHistory {
+			http.Error(w, fmt.Sprintf(`{"error":"limit must be 1-%d"}`, maxRiskHistory), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	writePaidData(w, r, h.History(chain, addr, kind, limit))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRiskHistory(t *testing.T) {
+	dir := t.TempDir()
+	history, err := NewRiskHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913"
+	scan := func(kind string, score int, at int64) {
+		var result interface{} = TokenScanResult{RiskScore: score, ScannedAt: at}
+		if kind == "contract" {
+			result = &ContractScanResult{RiskScore: score, ScannedAt: at}
+		}
+		if err := history.onScanCompleted(context.Background(), Event{Data: ScanCompleted{Kind: kind, Chain: "base", Address: addr, Result: result}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scan("token", 10, 100)
+	scan("token", 10, 100) // a cached result published again
+	scan("contract", 60, 150)
+	scan("token", 25, 200)
+
+	got := history.History("base", addr, "", 10)
+	if len(got.Scores) != 3 || got.Scores[0].RiskScore != 25 || got.Scores[0].ModelVersion != riskModelVersions["token"] {
+		t.Fatalf("history = %+v", got)
+	}
+	if got.Trend != RiskRising || got.Change != 15 {
+		t.Errorf("trend = %s %+d, want rising +15 across token scores", got.Trend, got.Change)
+	}
+	if contracts := history.History("base", addr, "contract", 10); len(contracts.Scores) != 1 || contracts.Trend != RiskUnknown {
+		t.Errorf("contract history = %+v", contracts)
+	}
+	if other := history.History("ethereum", addr, "", 10); len(other.Scores) != 0 {
+		t.Errorf("scores leaked across chains: %+v", other)
+	}
+
+	// A new scoring model starts a new trend
+	riskModelVersions["token"] = "2.0.0"
+	t.Cleanup(func() { riskModelVersions["token"] = "1.0.0" })
+	scan("token", 90, 300)
+	if got := history.History("base", addr, "token", 10); got.Trend != RiskUnknown {
+		t.Errorf("trend across model versions = %s", got.Trend)
+	}
+
+	reloaded, err := NewRiskHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.History("base", addr, "", 10); len(got.Scores) != 4 || got.Scores[0].ModelVersion != "2.0.0" {
+		t.Errorf("reloaded history = %+v", got)
+	}
+}
+
+func TestE2ERiskHistory(t *testing.T) {
+	srv, _ := startService(t, nil)
+	token := "0x833589fcd6edb6e08f4c7c32d4f71b54bda02913"
+
+	scan := paidRequest(t, srv, "POST", "/api/scan-token", `{"address":"`+token+`","chain":"base"}`)
+	scan.Body.Close()
+	if scan.StatusCode != http.StatusOK {
+		t.Fatalf("scan returned %d", scan.StatusCode)
+	}
+
+	resp := paidRequest(t, srv, "GET", "/api/risk-history/"+token+"?kind=token", "")
+	defer resp.Body.Close()
+	var body struct {
+		Data RiskHistoryResult `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || len(body.Data.Scores) != 1 || body.Data.Scores[0].Kind != "token" {
+		t.Errorf("risk history returned %d %+v", resp.StatusCode, body.Data)
+	}
+
+	bad := paidRequest(t, srv, "GET", "/api/risk-history/0x1234", "")
+	defer bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid address returned %d, want 400", bad.StatusCode)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import "net/http"
+
+// paidRoute is the price and description of a paid endpoint. They are
+// declared once, in paidRoutes, and everything that quotes or advertises
+// the endpoint reads them from there: the 402 challenge, /.well-known/x402,
+// the gRPC and GraphQL mirrors, the OASF skills and the index at /.
+type paidRoute struct {
+	endpoint    string
+	path        string // as documented, with its parameters; endpoint if empty
+	price       string // in the payment asset, or a fiat price
+	priceUSD    float64
+	description string
+}
+
+var paidRoutes = []paidRoute{
+	{"/api/gas", "", "0.001", 0.001, "Get current Ethereum gas prices"},
+	{"/api/validators", "", "0.005", 0.005, "Get validator queue status"},
+	{"/api/price", "", "0.002", 0.002, "Get ETH/USD price from multiple exchanges"},
+	{"/api/scan-contract", "", "0.01", 0.01, "Scan smart contract for risk factors"},
+	{"/api/agent-score", "", "0.005", 0.005, "Get security score for ERC-8004 agent"},
+	{"/api/tx-preflight", "", "0.003", 0.003, "Pre-flight transaction risk check"},
+	{"/api/safe-check", "", "0.005", 0.005, "Decode and risk-check a Safe multisig transaction"},
+	{"/api/build-transfer", "", "0.003", 0.003, "Build ERC-20 transfer calldata with recipient and decimals checks"},
+	{"/api/prompt-test", "", "0.01", 0.01, "Test prompt for injection attacks"},
+	{"/api/scan-token", "", "0.008", 0.008, "Scan token contract for honeypot and mint risks"},
+	{"/api/scan-token/diff", "", "0.008", 0.008, "Rescan a token and report changes since its last paid scan"},
+	{"/api/risk-history", "/api/risk-history/{address}", "0.001", 0.001, "Risk scores recorded for an address over time"},
+	{"/api/scan-wallet", "", "0.01", 0.01, "Scan wallet portfolio for risks"},
+	{"/api/address-label", "", "0.003", 0.003, "Get labels and entity info for address"},
+	{"/api/enrich", "", "0.02", 0.02, "Decode, label and risk-flag a batch of transactions and addresses"},
+	{"/api/mev-check", "", "0.005", 0.005, "Check transaction for MEV/sandwich risk"},
+	{"/api/gas-sponsorship", "", "0.003", 0.003, "Check paymaster sponsorship for an ERC-4337 user operation"},
+	{"/api/account/topup", "", "1", 1, "Top up a prepaid balance that later calls are debited from"},
+}
+
+// routeFor returns the registered price of endpoint. Asking for an endpoint
+// that was never registered is a programming error.
+func routeFor(endpoint string) paidRoute {
+	for _, route := range paidRoutes {
+		if route.endpoint == endpoint {
+			return route
+		}
+	}
+	panic("routes: no paid route " + endpoint)
+}
+
+// documentedPath is the path the index lists the route under
+func (route paidRoute) documentedPath() string {
+	if route.path != "" {
+		return route.path
+	}
+	return route.endpoint
+}
+
+// ProtectRoute protects endpoint at its registered price
+func (p *Paywall) ProtectRoute(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	route := routeFor(endpoint)
+	return p.Protect(route.endpoint, route.price, route.priceUSD, route.description, next)
+}
+
+// skillPricing is the OASF pricing of a skill served by endpoint
+func skillPricing(endpoint string) *OASFPricing {
+	route := routeFor(endpoint)
+	return &OASFPricing{
+		Model:    "per_call",
+		Price:    route.priceUSD,
+		Currency: "USDC",
+		Unit:     "per request",
+	}
+}
+
+// Requirements returns the payment requirements of every protected route,
+// as a challenge to the caller of r would state them, for the
+// /.well-known/x402 discovery document. Each requirement names the route
+// it pays for in Resource.
+func (p *Paywall) Requirements(r *http.Request) ([]PaymentRequirement, error) {
+	ctx := withClient(r.Context(), p.abuse.clientIP(r))
+	var reqs []PaymentRequirement
+	for _, route := range p.routes.list() {
+		q, err := p.quote(ctx, route.endpoint, route.price, route.priceUSD, route.description)
+		if err != nil {
+			return nil, err
+		}
+		q.localize(r)
+		for _, req := range p.offers(q) {
+			reqs = append(reqs, req)
+			// Signed transfer authorizations, with exact_scheme on and where
+			// the asset supports them
+			if exact, ok := exactRequirement(req); ok {
+				reqs = append(reqs, exact)
+			}
+		}
+	}
+	return reqs, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestPaidRoutes(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, route := range paidRoutes {
+		if seen[route.endpoint] {
+			t.Errorf("%s registered twice", route.endpoint)
+		}
+		seen[route.endpoint] = true
+		if usd, err := strconv.ParseFloat(route.price, 64); err != nil || usd != route.priceUSD {
+			t.Errorf("%s costs %s but %v USD", route.endpoint, route.price, route.priceUSD)
+		}
+	}
+	// Every skill is priced as its endpoint
+	for _, skill := range oasfSkills() {
+		endpoint, ok := skillEndpoints[skill.ID]
+		if !ok {
+			continue
+		}
+		if skill.Pricing == nil || skill.Pricing.Price != routeFor(endpoint).priceUSD {
+			t.Errorf("%s pricing = %+v, want the price of %s", skill.ID, skill.Pricing, endpoint)
+		}
+	}
+}
+
+func TestRequirementsPerRoute(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(`{"prices": {"/api/scan-contract": "0.02"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	gas := paywall.ProtectRoute("/api/gas", noop)
+	paywall.ProtectRoute("/api/scan-contract", noop)
+
+	reqs, err := paywall.Requirements(httptest.NewRequest("GET", "/.well-known/x402", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices := make(map[string]string)
+	for _, req := range reqs {
+		prices[req.Resource] = req.MaxAmount
+	}
+	if len(reqs) != 2 || prices["/api/gas"] != "0.001" || prices["/api/scan-contract"] != "0.02" {
+		t.Fatalf("requirements = %+v, want each route at its own price", reqs)
+	}
+
+	// The challenge states the same requirement
+	rr := httptest.NewRecorder()
+	gas(rr, httptest.NewRequest("GET", "/api/gas", nil))
+	if rr.Code != http.StatusPaymentRequired {
+		t.Fatalf("unpaid call returned %d, want 402", rr.Code)
+	}
+	var body struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range reqs {
+		if req.Resource == "/api/gas" && (body.Payment.MaxAmount != req.MaxAmount || body.Payment.Resource != req.Resource || body.Payment.Description != req.Description) {
+			t.Errorf("challenge = %+v, discovery = %+v", body.Payment, req)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+)
+
+// SafeCheckRequest is a Safe execTransaction call to analyze
+type SafeCheckRequest struct {
+	Safe string `json:"safe"` // the Safe the call is sent to; needed for the threshold check
+	Data string `json:"data"` // execTransaction calldata
+}
+
+// SafeCall is a call the Safe would make
+type SafeCall struct {
+	Operation string             `json:"operation"` // "call" or "delegatecall"
+	To        string             `json:"to"`
+	Value     string             `json:"value"` // wei
+	Data      string             `json:"data"`
+	Method    string             `json:"method,omitempty"` // decoded name for known selectors
+	Preflight *TxPreflightResult `json:"preflight,omitempty"`
+}
+
+// SafeSignature is one signature packed into execTransaction
+type SafeSignature struct {
+	Type   string `json:"type"`             // ecdsa, eth_sign, approved_hash or contract
+	Signer string `json:"signer,omitempty"` // known without recovery for approved_hash and contract
+}
+
+// SafeCheckResult is the analysis of a Safe transaction
+type SafeCheckResult struct {
+	Safe            bool            `json:"safe"`
+	RiskScore       int             `json:"risk_score"` // 0-100
+	Call            *SafeCall       `json:"call,omitempty"`
+	Batch           []SafeCall      `json:"batch,omitempty"` // calls inside a MultiSend
+	Threshold       int             `json:"threshold,omitempty"`
+	Owners          int             `json:"owners,omitempty"`
+	Signatures      []SafeSignature `json:"signatures"`
+	Warnings        []string        `json:"warnings"`
+	Errors          []string        `json:"errors"`
+	Recommendations []string        `json:"recommendations"`
+	CheckedAt       int64           `json:"checked_at"`
+	Scoring
+}
+
+// Selectors of the Safe calls the check decodes
+const (
+	selectorExecTransaction = "6a761202"
+	selectorMultiSend       = "8d80ff0a"
+	selectorGetThreshold    = "e75235b8"
+	selectorGetOwners       = "a0e67e2b"
+)
+
+// maxSafeBatch bounds how many MultiSend calls are simulated
+const maxSafeBatch = 20
+
+// safeSelfCall is a Safe method that changes its own configuration, with
+// the risk it adds when the Safe calls itself
+type safeSelfCall struct {
+	name  string
+	score int
+}
+
+var safeSelfCalls = map[string]safeSelfCall{
+	"0d582f13": {"addOwnerWithThreshold", 40},
+	"f8dc5dd9": {"removeOwner", 40},
+	"e318b52b": {"swapOwner", 40},
+	"694e80c3": {"changeThreshold", 40},
+	"610b5925": {"enableModule", 60},
+	"e009cfde": {"disableModule", 20},
+	"e19a9dd9": {"setGuard", 50},
+	"f08a0323": {"setFallbackHandler", 50},
+}
+
+// knownMethods names common selectors in inner calls
+var knownMethods = map[string]string{
+	"a9059cbb":        "transfer",
+	"23b872dd":        "transferFrom",
+	"095ea7b3":        "approve",
+	"39509351":        "increaseAllowance",
+	"a22cb465":        "setApprovalForAll",
+	"42842e0e":        "safeTransferFrom",
+	selectorMultiSend: "multiSend",
+}
+
+// safeMultiSends are the canonical MultiSend libraries, keyed by
+// lowercase address. Delegatecalls to them are how Safes batch calls.
+var safeMultiSends = map[string]string{
+	"0xa238cbeb142c10ef7ad8442c6d1f9e89e07e7761": "MultiSend 1.3.0",
+	"0x40a2accbd92bca938b02010e17a5b8929b49130d": "MultiSendCallOnly 1.3.0",
+	"0x38869bf66a61cf6bdb996a6ae40d5853fd43b526": "MultiSend 1.4.1",
+	"0x9641d764fc13c8b624c04430c7356c1c7c8102e2": "MultiSendCallOnly 1.4.1",
+}
+
+// execTransaction is a decoded Safe execTransaction call
+type execTransaction struct {
+	call           SafeCall
+	gasPrice       *big.Int
+	gasToken       string
+	refundReceiver string
+	signatures     []byte
+}
+
+func decodeExecTransaction(data string) (*execTransaction, error) {
+	selector, args, err := decodeCalldata(data)
+	if err != nil {
+		return nil, err
+	}
+	if selector != selectorExecTransaction {
+		return nil, fmt.Errorf("not an execTransaction call (selector 0x%s)", selector)
+	}
+	// execTransaction(to, value, data, operation, safeTxGas, baseGas,
+	// gasPrice, gasToken, refundReceiver, signatures)
+	tx := &execTransaction{}
+	if tx.call.To, err = args.address(0); err != nil {
+		return nil, err
+	}
+	value, err := args.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := args.bytes(2)
+	if err != nil {
+		return nil, err
+	}
+	operation, err := args.uint(3)
+	if err != nil {
+		return nil, err
+	}
+	if tx.gasPrice, err = args.uint(6); err != nil {
+		return nil, err
+	}
+	if tx.gasToken, err = args.address(7); err != nil {
+		return nil, err
+	}
+	if tx.refundReceiver, err = args.address(8); err != nil {
+		return nil, err
+	}
+	if tx.signatures, err = args.bytes(9); err != nil {
+		return nil, err
+	}
+	if !operation.IsInt64() || operation.Int64() > 1 {
+		return nil, fmt.Errorf("invalid operation %s", operation)
+	}
+	tx.call.Operation = safeOperation(byte(operation.Int64()))
+	tx.call.Value = value.String()
+	tx.call.Data = "0x" + hex.EncodeToString(inner)
+	return tx, nil
+}
+
+func safeOperation(op byte) string {
+	if op == 1 {
+		return "delegatecall"
+	}
+	return "call"
+}
+
+// decodeMultiSend unpacks a multiSend(bytes) payload: a sequence of
+// operation (1 byte), to (20), value (32), data length (32) and data
+func decodeMultiSend(args abiData) ([]SafeCall, error) {
+	packed, err := args.bytes(0)
+	if err != nil {
+		return nil, err
+	}
+	var calls []SafeCall
+	for len(packed) > 0 {
+		if len(packed) < 85 {
+			return nil, errABIShort
+		}
+		length := new(big.Int).SetBytes(packed[53:85])
+		if !length.IsInt64() || 85+length.Int64() > int64(len(packed)) {
+			return nil, errABIShort
+		}
+		end := 85 + int(length.Int64())
+		calls = append(calls, SafeCall{
+			Operation: safeOperation(packed[0]),
+			To:        address.Checksum("0x" + hex.EncodeToString(packed[1:21])),
+			Value:     new(big.Int).SetBytes(packed[21:53]).String(),
+			Data:      "0x" + hex.EncodeToString(packed[85:end]),
+		})
+		packed = packed[end:]
+	}
+	return calls, nil
+}
+
+// decodeSafeSignatures reads the 65-byte signature parts. Contract
+// signatures point past the parts to their dynamic data, which is where
+// the parts end.
+func decodeSafeSignatures(sigs []byte) []SafeSignature {
+	out := []SafeSignature{}
+	end := len(sigs)
+	for i := 0; i+65 <= end; i += 65 {
+		r, s, v := sigs[i:i+32], sigs[i+32:i+64], sigs[i+64]
+		signer := address.Checksum("0x" + hex.EncodeToString(r[12:]))
+		switch {
+		case v == 0:
+			out = append(out, SafeSignature{Type: "contract", Signer: signer})
+			if offset := new(big.Int).SetBytes(s); offset.IsInt64() && offset.Int64() < int64(end) {
+				end = int(offset.Int64())
+			}
+		case v == 1:
+			out = append(out, SafeSignature{Type: "approved_hash", Signer: signer})
+		case v > 30:
+			out = append(out, SafeSignature{Type: "eth_sign"})
+		default:
+			out = append(out, SafeSignature{Type: "ecdsa"})
+		}
+	}
+	return out
+}
+
+// CheckSafe decodes a Safe execTransaction call, checks its signatures
+// against the Safe's owners and threshold, and risk-scores the calls it
+// would make
+func (s *TxSimulator) CheckSafe(req *SafeCheckRequest) *SafeCheckResult {
+	result := &SafeCheckResult{
+		Safe:            true,
+		Signatures:      []SafeSignature{},
+		Warnings:        []string{},
+		Errors:          []string{},
+		Recommendations: []string{},
+		CheckedAt:       time.Now().Unix(),
+	}
+	result.Scoring = scoring("safe", runtimeConfig.Current(), result.CheckedAt)
+	if req.Safe != "" && !isValidAddress(req.Safe) {
+		result.Safe = false
+		result.RiskScore = 100
+		result.Errors = append(result.Errors, "Invalid 'safe' address (bad hex or EIP-55 checksum)")
+		return result
+	}
+	tx, err := decodeExecTransaction(req.Data)
+	if err != nil {
+		result.Safe = false
+		result.RiskScore = 100
+		result.Errors = append(result.Errors, fmt.Sprintf("Could not decode execTransaction: %v", err))
+		return result
+	}
+	result.Call = &tx.call
+	result.Signatures = decodeSafeSignatures(tx.signatures)
+
+	if tx.gasPrice.Sign() > 0 {
+		result.RiskScore += 10
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Gas refund paid in %s to %s - check the refund cannot drain the Safe", tx.gasToken, tx.refundReceiver))
+	}
+	for _, sig := range result.Signatures {
+		if sig.Type == "eth_sign" {
+			result.Warnings = append(result.Warnings, "eth_sign signature - signers saw a raw hash, not the transaction")
+			result.RiskScore += 10
+			break
+		}
+	}
+	if req.Safe != "" {
+		s.checkSafeSigners(req.Safe, result)
+	} else {
+		result.Warnings = append(result.Warnings, "No 'safe' address given - signer threshold not checked")
+	}
+
+	s.scoreSafeCall(req.Safe, result.Call, result)
+	if selector, args, err := decodeCalldata(tx.call.Data); err == nil && selector == selectorMultiSend {
+		batch, err := decodeMultiSend(args)
+		if err != nil {
+			result.RiskScore += 20
+			result.Errors = append(result.Errors, fmt.Sprintf("Could not decode MultiSend batch: %v", err))
+		}
+		if len(batch) > maxSafeBatch {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("MultiSend batch of %d calls - only the first %d were checked", len(batch), maxSafeBatch))
+			batch = batch[:maxSafeBatch]
+		}
+		for i := range batch {
+			s.scoreSafeCall(req.Safe, &batch[i], result)
+		}
+		result.Batch = batch
+	}
+	result.DataSources[SourceRPC] = result.CheckedAt
+
+	if result.RiskScore >= 50 {
+		result.Safe = false
+		result.Recommendations = append(result.Recommendations, "Transaction has high risk - review carefully")
+	}
+	if result.RiskScore > 100 {
+		result.RiskScore = 100
+	}
+	return result
+}
+
+// scoreSafeCall names call's method and adds its risk to result:
+// delegatecalls, changes to the Safe's own configuration, and the
+// preflight risk of ordinary calls
+func (s *TxSimulator) scoreSafeCall(safe string, call *SafeCall, result *SafeCheckResult) {
+	selector, _, err := decodeCalldata(call.Data)
+	if err == nil {
+		call.Method = knownMethods[selector]
+	}
+
+	if call.Operation == "delegatecall" {
+		if name, ok := safeMultiSends[strings.ToLower(call.To)]; ok {
+			call.Method = name
+			return
+		}
+		result.RiskScore += 60
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Delegatecall to %s - the target runs with the Safe's storage and can take it over", call.To))
+		return
+	}
+	if safe != "" && strings.EqualFold(call.To, safe) {
+		if change, ok := safeSelfCalls[selector]; ok {
+			call.Method = change.name
+			result.RiskScore += change.score
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Changes the Safe's configuration: %s", change.name))
+		}
+		return
+	}
+
+	preflight, err := s.Simulate(&TxPreflightRequest{From: safe, To: call.To, Value: call.Value, Data: call.Data})
+	if err != nil {
+		return
+	}
+	call.Preflight = preflight
+	if preflight.RiskScore > result.RiskScore {
+		result.RiskScore = preflight.RiskScore
+	}
+}
+
+// checkSafeSigners compares the signatures with the Safe's threshold and
+// owners
+func (s *TxSimulator) checkSafeSigners(safe string, result *SafeCheckResult) {
+	threshold, err := s.safeCall(safe, selectorGetThreshold)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Could not read the Safe's threshold: %v", err))
+		return
+	}
+	t, err := threshold.uint(0)
+	if err != nil || !t.IsInt64() {
+		result.Warnings = append(result.Warnings, "Target did not return a threshold - is it a Safe?")
+		return
+	}
+	result.Threshold = int(t.Int64())
+
+	owners := map[string]bool{}
+	if data, err := s.safeCall(safe, selectorGetOwners); err == nil {
+		list, _ := data.addresses(0)
+		for _, owner := range list {
+			owners[strings.ToLower(owner)] = true
+		}
+	}
+	result.Owners = len(owners)
+
+	if len(result.Signatures) < result.Threshold {
+		result.RiskScore += 20
+		result.Errors = append(result.Errors, fmt.Sprintf("%d of %d required signatures - execution will revert", len(result.Signatures), result.Threshold))
+	}
+	if result.Threshold == 1 && result.Owners > 1 {
+		result.RiskScore += 15
+		result.Warnings = append(result.Warnings, fmt.Sprintf("1-of-%d Safe - any single owner key can execute", result.Owners))
+	}
+	for _, sig := range result.Signatures {
+		if sig.Signer != "" && len(owners) > 0 && !owners[strings.ToLower(sig.Signer)] {
+			result.RiskScore += 30
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Signature from %s, which is not an owner", sig.Signer))
+		}
+	}
+}
+
+// safeCall calls a no-argument view method on the Safe
+func (s *TxSimulator) safeCall(safe, selector string) (abiData, error) {
+	result, err := s.rpcClient.call("eth_call", []interface{}{map[string]string{"to": safe, "data": "0x" + selector}, "latest"})
+	if err != nil {
+		return nil, err
+	}
+	if rpcErr, ok := result["error"].(map[string]interface{}); ok {
+		return nil, fmt.Errorf("%v", rpcErr["message"])
+	}
+	out, _ := result["result"].(string)
+	raw, err := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	return abiData(raw), nil
+}
+
+func handleSafeCheck(w http.ResponseWriter, r *http.Request, simulator *TxSimulator, metrics *Metrics) {
+	start := time.Now()
+
+	var req SafeCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Safe check decode error (payer=%s): %v", payerLabel(r), err)
+		http.Error(w, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		metrics.RecordRequest("/api/safe-check", "400")
+		return
+	}
+
+	writePaidData(w, r, simulator.CheckSafe(&req))
+
+	metrics.RecordRequest("/api/safe-check", "200")
+	metrics.RecordResponseTime("/api/safe-check", time.Since(start))
+}
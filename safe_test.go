@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testSafe   = "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"
+	testOwner1 = "0x1111111111111111111111111111111111111111"
+	testOwner2 = "0x2222222222222222222222222222222222222222"
+	testToken  = "0x3333333333333333333333333333333333333333"
+)
+
+func abiWord(v *big.Int) []byte {
+	return new(big.Int).Set(v).FillBytes(make([]byte, 32))
+}
+
+func abiAddress(addr string) []byte {
+	raw, _ := hex.DecodeString(addr[2:])
+	return append(make([]byte, 12), raw...)
+}
+
+// abiBytes encodes a dynamic bytes value: its length, then the padded data
+func abiBytes(b []byte) []byte {
+	out := abiWord(big.NewInt(int64(len(b))))
+	return append(append(out, b...), make([]byte, (32-len(b)%32)%32)...)
+}
+
+// execTransactionData encodes a Safe execTransaction call
+func execTransactionData(to string, operation int64, data, signatures []byte) string {
+	encodedData := abiBytes(data)
+	head := [][]byte{
+		abiAddress(to),
+		abiWord(big.NewInt(0)),
+		abiWord(big.NewInt(10 * 32)), // data offset
+		abiWord(big.NewInt(operation)),
+		abiWord(big.NewInt(0)),
+		abiWord(big.NewInt(0)),
+		abiWord(big.NewInt(0)),
+		abiAddress("0x0000000000000000000000000000000000000000"),
+		abiAddress("0x0000000000000000000000000000000000000000"),
+		abiWord(big.NewInt(int64(10*32 + len(encodedData)))), // signatures offset
+	}
+	out := []byte{0x6a, 0x76, 0x12, 0x02}
+	for _, word := range head {
+		out = append(out, word...)
+	}
+	out = append(append(out, encodedData...), abiBytes(signatures)...)
+	return "0x" + hex.EncodeToString(out)
+}
+
+// ecdsaSignature is a placeholder ECDSA signature part
+func ecdsaSignature() []byte {
+	sig := make([]byte, 65)
+	sig[64] = 27
+	return sig
+}
+
+// approvedHashSignature is a pre-approved hash signature part from owner
+func approvedHashSignature(owner string) []byte {
+	return append(append(abiAddress(owner), make([]byte, 32)...), 1)
+}
+
+func calldata(selector string, args ...[]byte) []byte {
+	out, _ := hex.DecodeString(selector)
+	for _, arg := range args {
+		out = append(out, arg...)
+	}
+	return out
+}
+
+// fakeSafeRPC serves a 2-of-2 Safe owned by testOwner1 and testOwner2
+func fakeSafeRPC(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var result string
+		switch req.Method {
+		case "eth_call":
+			var call struct {
+				Data string `json:"data"`
+			}
+			json.Unmarshal(req.Params[0], &call)
+			switch call.Data {
+			case "0x" + selectorGetThreshold:
+				result = "0x" + hex.EncodeToString(abiWord(big.NewInt(2)))
+			case "0x" + selectorGetOwners:
+				words := append(append(abiWord(big.NewInt(32)), abiWord(big.NewInt(2))...), abiAddress(testOwner1)...)
+				result = "0x" + hex.EncodeToString(append(words, abiAddress(testOwner2)...))
+			default:
+				result = "0x"
+			}
+		case "eth_getCode":
+			result = "0x6080"
+		case "eth_estimateGas":
+			result = "0xc350"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSafeCheck(t *testing.T) {
+	simulator := NewTxSimulator(fakeSafeRPC(t).URL)
+	hasMessage := func(list []string, substr string) bool {
+		for _, s := range list {
+			if strings.Contains(s, substr) {
+				return true
+			}
+		}
+		return false
+	}
+	twoSigs := append(ecdsaSignature(), ecdsaSignature()...)
+	transfer := calldata("a9059cbb", abiAddress(testOwner1), abiWord(big.NewInt(1000)))
+
+	result := simulator.CheckSafe(&SafeCheckRequest{Safe: testSafe, Data: execTransactionData(testToken, 0, transfer, twoSigs)})
+	if !result.Safe || result.Threshold != 2 || result.Owners != 2 || len(result.Signatures) != 2 || len(result.Errors) != 0 {
+		t.Fatalf("token transfer = %+v", result)
+	}
+	if result.Call.Method != "transfer" || result.Call.To != testToken || result.Call.Preflight == nil || !result.Call.Preflight.SimulationSuccess {
+		t.Errorf("inner call = %+v", result.Call)
+	}
+
+	// An approved hash from a stranger does not count toward the threshold
+	sigs := append(ecdsaSignature(), approvedHashSignature(testToken)...)
+	result = simulator.CheckSafe(&SafeCheckRequest{Safe: testSafe, Data: execTransactionData(testToken, 0, transfer, sigs)})
+	if !hasMessage(result.Warnings, "not an owner") || result.Signatures[1].Type != "approved_hash" {
+		t.Errorf("stranger's signature = %+v", result)
+	}
+	result = simulator.CheckSafe(&SafeCheckRequest{Safe: testSafe, Data: execTransactionData(testToken, 0, transfer, ecdsaSignature())})
+	if !hasMessage(result.Errors, "1 of 2 required signatures") {
+		t.Errorf("missing signature = %+v", result)
+	}
+
+	result = simulator.CheckSafe(&SafeCheckRequest{Safe: testSafe, Data: execTransactionData(testToken, 1, transfer, twoSigs)})
+	if result.Safe || !hasMessage(result.Warnings, "Delegatecall") {
+		t.Errorf("delegatecall = %+v", result)
+	}
+	enableModule := calldata("610b5925", abiAddress(testToken))
+	result = simulator.CheckSafe(&SafeCheckRequest{Safe: testSafe, Data: execTransactionData(testSafe, 0, enableModule, twoSigs)})
+	if result.Safe || result.Call.Method != "enableModule" {
+		t.Errorf("enableModule = %+v", result)
+	}
+
+	// A MultiSend batch is unpacked and each call checked
+	var packed []byte
+	for _, to := range []string{testToken, testOwner2} {
+		packed = append(packed, 0)
+		packed = append(packed, abiAddress(to)[12:]...)
+		packed = append(packed, abiWord(big.NewInt(0))...)
+		packed = append(packed, abiWord(big.NewInt(int64(len(transfer))))...)
+		packed = append(packed, transfer...)
+	}
+	multiSend := calldata(selectorMultiSend, abiWord(big.NewInt(32)), abiBytes(packed))
+	result = simulator.CheckSafe(&SafeCheckRequest{Safe: testSafe, Data: execTransactionData("0x9641d764fc13c8b624c04430c7356c1c7c8102e2", 1, multiSend, twoSigs)})
+	if !result.Safe || result.Call.Method != "MultiSendCallOnly 1.4.1" || len(result.Batch) != 2 || result.Batch[1].To != testOwner2 || result.Batch[1].Preflight == nil {
+		t.Errorf("multiSend = %+v", result)
+	}
+
+	if result := simulator.CheckSafe(&SafeCheckRequest{Data: "0xa9059cbb"}); result.RiskScore != 100 || len(result.Errors) != 1 {
+		t.Errorf("not execTransaction = %+v", result)
+	}
+}
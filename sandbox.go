@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SandboxMode controls whether test payments are accepted
+type SandboxMode string
+
+const (
+	// SandboxOff rejects test tokens (default)
+	SandboxOff SandboxMode = "off"
+	// SandboxAllow accepts test tokens alongside real ones, per request
+	SandboxAllow SandboxMode = "allow"
+	// SandboxOnly runs the whole deployment as a sandbox
+	SandboxOnly SandboxMode = "only"
+)
+
+// ParseSandboxMode parses a SANDBOX_MODE value
+func ParseSandboxMode(s string) (SandboxMode, error) {
+	switch m := SandboxMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return SandboxOff, nil
+	case SandboxOff, SandboxAllow, SandboxOnly:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown sandbox mode %q (want off, allow or only)", s)
+}
+
+// SandboxPolicy decides which payments are test payments. Test tokens are
+// ordinary payment tokens whose network is the sandbox network. Sandbox
+// requests are served normally but watermarked, and they never reach the
+// ledger or the payment metrics.
+type SandboxPolicy struct {
+	Mode    SandboxMode
+	Network string // e.g. "base-sepolia"
+}
+
+// classify reports whether a payment on network is a sandbox payment and
+// whether it is acceptable at all
+func (s SandboxPolicy) classify(network string) (sandbox, ok bool) {
+	test := s.Network != "" && strings.EqualFold(network, s.Network)
+	switch s.Mode {
+	case SandboxOnly:
+		return true, true
+	case SandboxAllow:
+		return test, true
+	default:
+		return false, !test
+	}
+}
+
+// defaultSandboxNetwork is the test network used unless SANDBOX_NETWORK is set
+const defaultSandboxNetwork = "base-sepolia"
+
+const sandboxContextKey contextKey = "x402.sandbox"
+
+// withSandbox marks a request context as a sandbox request
+func withSandbox(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sandboxContextKey, true)
+}
+
+// IsSandbox reports whether the request was paid with a test token
+func IsSandbox(ctx context.Context) bool {
+	sandbox, _ := ctx.Value(sandboxContextKey).(bool)
+	return sandbox
+}
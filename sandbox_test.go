@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSandboxPayments(t *testing.T) {
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	paywall := NewPaywall(config, NewMetrics(), ledger)
+	handler := paywall.Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {
+		writePaidData(w, r, map[string]string{"ok": "yes"})
+	})
+
+	tokenFor := func(network string) string {
+		claims := PaymentToken{}
+		claims.Payment.Amount = "0.001"
+		claims.Payment.Asset = "USDC"
+		claims.Payment.Receiver = config.Receiver
+		claims.Payment.Network = network
+		return signPayment(t, claims)
+	}
+	serve := func(network string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/gas", nil)
+		req.Header.Set("X-Payment-Response", tokenFor(network))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	// Off: test tokens are rejected
+	if rr := serve("base-sepolia"); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("sandbox off: test token returned %d, want 402", rr.Code)
+	}
+
+	// Allow: test tokens are served, watermarked and not recorded
+	paywall.SetSandbox(SandboxPolicy{Mode: SandboxAllow, Network: "base-sepolia"})
+	rr := serve("base-sepolia")
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Sandbox") != "true" || !strings.Contains(rr.Body.String(), `"sandbox":true`) {
+		t.Errorf("sandbox response not watermarked: %d %v %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	if n := len(ledger.Entries(DefaultTenant)); n != 0 {
+		t.Errorf("sandbox payment reached the ledger (%d entries)", n)
+	}
+
+	// Real tokens still count in allow mode
+	rr = serve("base")
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Sandbox") != "" || strings.Contains(rr.Body.String(), "sandbox") {
+		t.Errorf("real payment marked as sandbox: %v %s", rr.Header(), rr.Body.String())
+	}
+	if n := len(ledger.Entries(DefaultTenant)); n != 1 {
+		t.Errorf("real payment not recorded (%d entries)", n)
+	}
+}
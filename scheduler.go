@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/kv"
+)
+
+// leaseTTL is how long a leader's lease lasts without renewal. A replica
+// that dies is replaced within this time.
+const leaseTTL = 30 * time.Second
+
+// Leader holds a lease in the shared store while it can renew it. Only one
+// replica holds the lease at a time; with an in-process store the single
+// replica always leads.
+type Leader struct {
+	store   kv.Store
+	key     string
+	id      string
+	ttl     time.Duration
+	leading atomic.Bool
+}
+
+// NewLeader creates a candidate for the lease named name
+func NewLeader(store kv.Store, name string) *Leader {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &Leader{
+		store: store,
+		key:   "leader:" + name,
+		id:    fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b)),
+		ttl:   leaseTTL,
+	}
+}
+
+// IsLeader reports whether this replica holds the lease
+func (l *Leader) IsLeader() bool {
+	return l.leading.Load()
+}
+
+// Campaign tries to take or renew the lease once and reports whether this
+// replica leads. A store error steps down: the lease will lapse on its own
+// and another replica may take it.
+func (l *Leader) Campaign() bool {
+	var ok bool
+	var err error
+	if l.leading.Load() {
+		ok, err = l.store.Refresh(l.key, l.id, l.ttl)
+	} else {
+		ok, err = l.store.SetNX(l.key, l.id, l.ttl)
+	}
+	if err != nil {
+		log.Printf("⚠️  Leader election failed: %v", err)
+		ok = false
+	}
+	if was := l.leading.Swap(ok); was != ok {
+		if ok {
+			log.Printf("👑 Elected leader (%s)", l.id)
+		} else {
+			log.Printf("👑 Lost leadership (%s)", l.id)
+		}
+	}
+	return ok
+}
+
+// Run campaigns now and then three times per lease
+func (l *Leader) Run() {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		l.Campaign()
+		<-ticker.C
+	}
+}
+
+// Resign gives up the lease so another replica can take it at once
+func (l *Leader) Resign() {
+	if l.leading.Swap(false) {
+		l.store.DeleteIf(l.key, l.id)
+	}
+}
+
+// Scheduler runs periodic background tasks. Every tasks run on each
+// replica and look after its own state; Singleton tasks run only on the
+// leader, so work against shared systems happens once.
+type Scheduler struct {
+	leader *Leader
+
+	mu    sync.Mutex
+	tasks map[string]*scheduledTask
+}
+
+type scheduledTask struct {
+	singleton bool
+	runs      int64
+	skipped   int64
+}
+
+// NewScheduler creates a scheduler gating singleton tasks on leader
+func NewScheduler(leader *Leader) *Scheduler {
+	return &Scheduler{leader: leader, tasks: make(map[string]*scheduledTask)}
+}
+
+// Every runs fn now and then every interval on this replica
+func (s *Scheduler) Every(name string, interval time.Duration, fn func()) {
+	go s.loop(s.add(name, false), interval, fn)
+}
+
+// Singleton runs fn every interval on the leader only
+func (s *Scheduler) Singleton(name string, interval time.Duration, fn func()) {
+	go s.loop(s.add(name, true), interval, fn)
+}
+
+func (s *Scheduler) add(name string, singleton bool) *scheduledTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[name]; ok {
+		panic("scheduler: duplicate task " + name)
+	}
+	task := &scheduledTask{singleton: singleton}
+	s.tasks[name] = task
+	return task
+}
+
+func (s *Scheduler) loop(task *scheduledTask, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(task, fn)
+		<-ticker.C
+	}
+}
+
+// tick runs fn unless the task is a singleton and this replica does not lead
+func (s *Scheduler) tick(task *scheduledTask, fn func()) {
+	if task.singleton && !s.leader.IsLeader() {
+		atomic.AddInt64(&task.skipped, 1)
+		return
+	}
+	fn()
+	atomic.AddInt64(&task.runs, 1)
+}
+
+// WriteMetrics writes x402_leader and the per-task run counters
+func (s *Scheduler) WriteMetrics(b *strings.Builder) {
+	leader := 0
+	if s.leader.IsLeader() {
+		leader = 1
+	}
+	b.WriteString("# HELP x402_leader Whether this replica leads and runs singleton tasks\n")
+	b.WriteString("# TYPE x402_leader gauge\n")
+	fmt.Fprintf(b, "x402_leader %d\n", leader)
+
+	s.mu.Lock()
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("# HELP x402_scheduled_runs_total Background task runs on this replica\n")
+	b.WriteString("# TYPE x402_scheduled_runs_total counter\n")
+	for _, name := range names {
+		t := s.tasks[name]
+		fmt.Fprintf(b, "x402_scheduled_runs_total{task=%q,result=\"ran\"} %d\n", name, atomic.LoadInt64(&t.runs))
+		if t.singleton {
+			fmt.Fprintf(b, "x402_scheduled_runs_total{task=%q,result=\"skipped\"} %d\n", name, atomic.LoadInt64(&t.skipped))
+		}
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/kv"
+)
+
+// brokenStore fails every lease operation
+type brokenStore struct{ kv.Store }
+
+func (brokenStore) Refresh(string, string, time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestLeaderElection(t *testing.T) {
+	store := kv.NewMemory()
+	a, b := NewLeader(store, "test"), NewLeader(store, "test")
+
+	if !a.Campaign() || b.Campaign() {
+		t.Fatal("want exactly the first candidate to lead")
+	}
+	if !a.Campaign() {
+		t.Error("leader could not renew its lease")
+	}
+
+	a.Resign()
+	if a.IsLeader() || !b.Campaign() {
+		t.Error("lease not handed over after resigning")
+	}
+	if a.Campaign() {
+		t.Error("two leaders at once")
+	}
+
+	// A leader that cannot reach the store steps down
+	b.store = brokenStore{store}
+	if b.Campaign() || b.IsLeader() {
+		t.Error("leader kept leading without renewing its lease")
+	}
+}
+
+func TestSchedulerSingletonRunsOnLeaderOnly(t *testing.T) {
+	store := kv.NewMemory()
+	leader, follower := NewLeader(store, "test"), NewLeader(store, "test")
+	leader.Campaign()
+	follower.Campaign()
+
+	ran := map[string]int{}
+	for name, s := range map[string]*Scheduler{"leader": NewScheduler(leader), "follower": NewScheduler(follower)} {
+		name := name
+		every := s.add("every", false)
+		singleton := s.add("sweep", true)
+		s.tick(every, func() { ran[name+"/every"]++ })
+		s.tick(singleton, func() { ran[name+"/sweep"]++ })
+
+		var b strings.Builder
+		s.WriteMetrics(&b)
+		if name == "follower" && !strings.Contains(b.String(), `x402_scheduled_runs_total{task="sweep",result="skipped"} 1`) {
+			t.Errorf("follower metrics:\n%s", b.String())
+		}
+	}
+
+	want := map[string]int{"leader/every": 1, "leader/sweep": 1, "follower/every": 1}
+	if len(ran) != len(want) {
+		t.Fatalf("ran = %v, want %v", ran, want)
+	}
+	for k, n := range want {
+		if ran[k] != n {
+			t.Errorf("ran = %v, want %v", ran, want)
+		}
+	}
+}
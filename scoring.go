@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// riskModelVersions is the version of the model behind each kind of
+// result's risk score. Bump it whenever that score is computed
+// differently, so a history does not read a model change as the address
+// getting riskier and consumers can tell scores apart.
+var riskModelVersions = map[string]string{
+	"token":     "1.0.0",
+	"contract":  "1.0.0",
+	"wallet":    "1.0.0",
+	"agent":     "1.0.0",
+	"preflight": "1.0.0",
+	"safe":      "1.0.0",
+	"mev":       "1.0.0",
+	"prompt":    "1.0.0",
+}
+
+// Named rules of the contract and token scans. Each adds its weight to the
+// risk score of a scan it matches.
+const (
+	RuleSpecialAddress      = "special_address"       // precompile, burn or other reserved address
+	RuleBlocklisted         = "blocklisted"           // on the operator blocklist
+	RuleUnverifiedContract  = "unverified_contract"   // source not verified on the explorer
+	RuleHoneypot            = "honeypot_indicators"   // simulated trades could not sell
+	RuleMintFunction        = "mint_function"         // token supply can be inflated
+	RuleBlacklistFunction   = "blacklist_function"    // token can block holders
+	RuleNewContract         = "new_contract"          // deployed within newContractAge
+	RuleRecentContract      = "recent_contract"       // deployed within recentContractAge
+	RuleDeployerBlocklisted = "deployer_blocklisted"  // deployer on the blocklist
+	RuleDeployerPriorRugs   = "deployer_prior_rugs"   // deployer created blocklisted contracts
+	RuleDeployerMixerFunded = "deployer_mixer_funded" // deployer funded from a mixer
+)
+
+// defaultRiskWeights are the built-in weights of the named rules. The
+// config file's "risk_weights" overrides them per deployment.
+var defaultRiskWeights = map[string]int{
+	RuleSpecialAddress:      50,
+	RuleBlocklisted:         100,
+	RuleUnverifiedContract:  30,
+	RuleHoneypot:            50,
+	RuleMintFunction:        20,
+	RuleBlacklistFunction:   15,
+	RuleNewContract:         25,
+	RuleRecentContract:      10,
+	RuleDeployerBlocklisted: 50,
+	RuleDeployerPriorRugs:   40,
+	RuleDeployerMixerFunded: 30,
+}
+
+// maxRiskWeight is the most a single rule may add, a whole risk score
+const maxRiskWeight = 100
+
+// resolveRiskWeights validates the configured weight overrides and returns
+// every rule's effective weight
+func resolveRiskWeights(overrides map[string]int) (map[string]int, error) {
+	weights := make(map[string]int, len(defaultRiskWeights))
+	for rule, weight := range defaultRiskWeights {
+		weights[rule] = weight
+	}
+	for rule, weight := range overrides {
+		if _, ok := defaultRiskWeights[rule]; !ok {
+			return nil, fmt.Errorf("risk weight %s: unknown rule", rule)
+		}
+		if weight < 0 || weight > maxRiskWeight {
+			return nil, fmt.Errorf("risk weight %s: %d is outside 0-%d", rule, weight, maxRiskWeight)
+		}
+		weights[rule] = weight
+	}
+	return weights, nil
+}
+
+// Data sources a score can be computed from
+const (
+	SourceConfig   = "config"   // the operator's rules, as of when they were loaded
+	SourceExplorer = "explorer" // block explorer lookups and calls
+	SourceHoneypot = "honeypot" // simulated trades
+	SourceRPC      = "rpc"      // the node: code, simulations, fees
+	SourceBundler  = "bundler"  // ERC-4337 user operation estimates
+)
+
+// scoring returns the scoring metadata of a kind of result scored at
+// unix time at under cfg, which read sources at that time
+func scoring(kind string, cfg *RuntimeConfig, at int64, sources ...string) Scoring {
+	s := Scoring{
+		ModelVersion: riskModelVersions[kind],
+		RulesetHash:  cfg.RulesetHash,
+		DataSources:  map[string]int64{SourceConfig: cfg.LoadedAt},
+	}
+	for _, source := range sources {
+		s.DataSources[source] = at
+	}
+	return s
+}
+
+// rulesetHash is the hex SHA-256 of the rules in cfg that scores apply:
+// risk weights, injection patterns, the blocklist, bridges, known
+// contracts and transaction policies. Order does not matter where the
+// rules are a set, and a weight set to its default is the same rule.
+func rulesetHash(cfg *RuntimeConfig) string {
+	blocklist := make([]string, len(cfg.Blocklist))
+	for i, addr := range cfg.Blocklist {
+		blocklist[i] = strings.ToLower(addr)
+	}
+	sort.Strings(blocklist)
+	known := make([]string, 0, len(cfg.known))
+	for key, name := range cfg.known {
+		known = append(known, key+"="+name)
+	}
+	sort.Strings(known)
+	bridges := make([]BridgeConfig, 0, len(cfg.bridges))
+	for _, b := range cfg.bridges {
+		b.Address = strings.ToLower(b.Address)
+		bridges = append(bridges, b)
+	}
+	sort.Slice(bridges, func(i, j int) bool { return bridges[i].Address < bridges[j].Address })
+
+	data, _ := json.Marshal(struct {
+		Weights        map[string]int  `json:"risk_weights"` // encoded with sorted keys
+		Patterns       []PatternConfig `json:"injection_patterns"`
+		Blocklist      []string        `json:"blocklist"`
+		Bridges        []BridgeConfig  `json:"bridges"`
+		KnownContracts []string        `json:"known_contracts"`
+		Policies       []PolicyConfig  `json:"policies"`
+	}{cfg.weights, cfg.Patterns, blocklist, bridges, known, cfg.Policies})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
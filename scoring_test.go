@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestRulesetHash(t *testing.T) {
+	parse := func(data string) *RuntimeConfig {
+		t.Helper()
+		cfg, err := parseRuntimeConfig([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	base := parse(`{"blocklist": ["0x000000000000000000000000000000000000dEaD", "0x0000000000000000000000000000000000000bad"]}`)
+	if len(base.RulesetHash) != 64 {
+		t.Fatalf("ruleset hash = %q", base.RulesetHash)
+	}
+	// Blocklist order and case are not rules
+	if reordered := parse(`{"blocklist": ["0x0000000000000000000000000000000000000BAD", "0x000000000000000000000000000000000000dead"]}`); reordered.RulesetHash != base.RulesetHash {
+		t.Error("reordering the blocklist changed the ruleset hash")
+	}
+	// Prices are not rules either
+	if priced := parse(`{"prices": {"/api/gas": "0.004"}, "blocklist": ["0x000000000000000000000000000000000000dEaD", "0x0000000000000000000000000000000000000bad"]}`); priced.RulesetHash != base.RulesetHash {
+		t.Error("a price override changed the ruleset hash")
+	}
+	for _, changed := range []string{
+		`{"blocklist": ["0x000000000000000000000000000000000000dEaD"]}`,
+		`{"blocklist": ["0x000000000000000000000000000000000000dEaD", "0x0000000000000000000000000000000000000bad"],
+		  "injection_patterns": [{"name": "custom", "regex": "(?i)exfiltrate", "risk_points": 80}]}`,
+	} {
+		if parse(changed).RulesetHash == base.RulesetHash {
+			t.Errorf("%s: ruleset hash unchanged", changed)
+		}
+	}
+}
+
+func TestScanScoringMetadata(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+
+	const target = "0x00000000000000000000000000000000000a11e0"
+	up.SetContract(target, testhttp.Contract{Verified: true})
+	cfg := runtimeConfig.Current()
+	result, err := NewContractScanner().Scan(target, "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ModelVersion != riskModelVersions["contract"] || result.RulesetHash != cfg.RulesetHash {
+		t.Errorf("contract scoring = %+v", result.Scoring)
+	}
+	if result.DataSources[SourceConfig] != cfg.LoadedAt || result.DataSources[SourceExplorer] != result.ScannedAt || result.DataSources[SourceHoneypot] != result.ScannedAt {
+		t.Errorf("contract data sources = %v", result.DataSources)
+	}
+
+	if prompt := NewPromptGuard().Test("hello"); prompt.ModelVersion != riskModelVersions["prompt"] || len(prompt.DataSources) != 1 {
+		t.Errorf("prompt scoring = %+v", prompt.Scoring)
+	}
+	if token := scanToken(target, "base"); token.ModelVersion != riskModelVersions["token"] || token.RulesetHash != cfg.RulesetHash {
+		t.Errorf("token scoring = %+v", token.Scoring)
+	}
+}
+
+func TestRiskWeights(t *testing.T) {
+	for _, bad := range []string{
+		`{"risk_weights": {"no_such_rule": 10}}`,
+		`{"risk_weights": {"unverified_contract": -1}}`,
+		`{"risk_weights": {"unverified_contract": 101}}`,
+	} {
+		if _, err := parseRuntimeConfig([]byte(bad)); err == nil {
+			t.Errorf("%s: accepted", bad)
+		}
+	}
+
+	defaults, _ := parseRuntimeConfig(nil)
+	same, _ := parseRuntimeConfig([]byte(`{"risk_weights": {"unverified_contract": 30}}`))
+	if same.RulesetHash != defaults.RulesetHash {
+		t.Error("a weight set to its default changed the ruleset hash")
+	}
+	cfg, err := parseRuntimeConfig([]byte(`{"risk_weights": {"unverified_contract": 45, "honeypot_indicators": 0}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RulesetHash == defaults.RulesetHash {
+		t.Error("tuned weights kept the default ruleset hash")
+	}
+	if cfg.RiskWeight(RuleUnverifiedContract) != 45 || cfg.RiskWeight(RuleMintFunction) != defaultRiskWeights[RuleMintFunction] {
+		t.Errorf("weights = %v", cfg.EffectiveRiskWeights())
+	}
+
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+	const target = "0x00000000000000000000000000000000000b0b01"
+	up.SetContract(target, testhttp.Contract{Honeypot: true})
+
+	previousConfig := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previousConfig)
+	result, err := NewContractScanner().Scan(target, "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RiskScore != 45 || result.RulesetHash != cfg.RulesetHash {
+		t.Errorf("tuned scan scored %d under %s, want 45", result.RiskScore, result.RulesetHash)
+	}
+}
@@ -2,92 +2,41 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math/big"
 	"net/http"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/types"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
 )
 
 // ==================== TYPES ====================
 
-// ContractScanRequest represents the input for contract scanning
-type ContractScanRequest struct {
-	Address string `json:"address"`
-	Chain   string `json:"chain"` // "base" or "ethereum"
-}
-
-// ContractScanResult represents the output of contract scanning
-type ContractScanResult struct {
-	Address     string   `json:"address"`
-	Chain       string   `json:"chain"`
-	RiskScore   int      `json:"risk_score"` // 0-100
-	IsVerified  bool     `json:"is_verified"`
-	IsProxy     bool     `json:"is_proxy"`
-	IsHoneypot  bool     `json:"is_honeypot"`
-	Flags       []string `json:"flags"`
-	Warnings    []string `json:"warnings"`
-	Cached      bool     `json:"cached"`
-	CachedAt    int64    `json:"cached_at,omitempty"`
-	ScannedAt   int64    `json:"scanned_at"`
-}
-
-// AgentScoreRequest represents the input for agent scoring
-type AgentScoreRequest struct {
-	AgentID string `json:"agent_id"` // ERC-8004 agent ID or wallet address
-}
-
-// AgentScoreResult represents the output of agent scoring
-type AgentScoreResult struct {
-	AgentID           string  `json:"agent_id"`
-	SecurityScore     int     `json:"security_score"` // 0-100
-	HasSecurityStack  bool    `json:"has_security_stack"`
-	FailedTxRate      float64 `json:"failed_tx_rate"`
-	RegistrationDays  int     `json:"registration_days"`
-	FeedbackRating    float64 `json:"feedback_rating"`
-	Factors           []string `json:"factors"`
-	ScoredAt          int64   `json:"scored_at"`
-}
-
-// TxPreflightRequest represents the input for transaction pre-flight
-type TxPreflightRequest struct {
-	From  string `json:"from"`
-	To    string `json:"to"`
-	Value string `json:"value"` // in wei
-	Data  string `json:"data"`  // hex encoded
-}
-
-// TxPreflightResult represents the output of transaction pre-flight
-type TxPreflightResult struct {
-	Safe           bool     `json:"safe"`
-	RiskScore      int      `json:"risk_score"` // 0-100
-	SimulationSuccess bool  `json:"simulation_success"`
-	GasEstimate    string   `json:"gas_estimate"`
-	Warnings       []string `json:"warnings"`
-	Errors         []string `json:"errors"`
-	Recommendations []string `json:"recommendations"`
-	CheckedAt      int64    `json:"checked_at"`
-}
-
-// PromptTestRequest represents the input for prompt injection testing
-type PromptTestRequest struct {
-	Prompt string `json:"prompt"`
-}
-
-// PromptTestResult represents the output of prompt testing
-type PromptTestResult struct {
-	Prompt       string   `json:"prompt"`
-	RiskScore    int      `json:"risk_score"` // 0-100
-	Safe         bool     `json:"safe"`
-	ThreatLevel  string   `json:"threat_level"`
-	Patterns     []string `json:"patterns"`
-	Detections   []string `json:"detections"`
-	Warnings     []string `json:"warnings"`
-	TestedAt     int64    `json:"tested_at"`
-}
+// Request/result wire types shared with the client (see pkg/types)
+type (
+	ContractScanRequest = types.ContractScanRequest
+	ContractScanResult  = types.ContractScanResult
+	AgentScoreRequest   = types.AgentScoreRequest
+	AgentScoreResult    = types.AgentScoreResult
+	TxPreflightRequest  = types.TxPreflightRequest
+	TxPreflightResult   = types.TxPreflightResult
+	UserOperation       = types.UserOperation
+	UserOperationGas    = types.UserOperationGas
+	FeeRecommendation   = types.FeeRecommendation
+	TxCost              = types.TxCost
+	PromptTestRequest   = types.PromptTestRequest
+	PromptTestResult    = types.PromptTestResult
+	Scoring             = types.Scoring
+)
 
 // Pattern for prompt injection detection
 type InjectionPattern struct {
@@ -104,6 +53,7 @@ type Cache struct {
 	mu      sync.RWMutex
 	items   map[string]cacheItem
 	ttl     time.Duration
+	clock   clock.Clock
 }
 
 type cacheItem struct {
@@ -116,6 +66,7 @@ func NewCache(ttl time.Duration) *Cache {
 	c := &Cache{
 		items: make(map[string]cacheItem),
 		ttl:   ttl,
+		clock: clock.System,
 	}
 	go c.cleanup()
 	return c
@@ -127,7 +78,7 @@ func (c *Cache) Get(key string) (interface{}, bool) {
 	defer c.mu.RUnlock()
 	
 	item, exists := c.items[key]
-	if !exists || time.Now().After(item.expiresAt) {
+	if !exists || c.clock.Now().After(item.expiresAt) {
 		return nil, false
 	}
 	return item.value, true
@@ -140,24 +91,37 @@ func (c *Cache) Set(key string, value interface{}) {
 	
 	c.items[key] = cacheItem{
 		value:     value,
-		expiresAt: time.Now().Add(c.ttl),
+		expiresAt: c.clock.Now().Add(c.ttl),
 	}
 }
 
+// Delete removes a value from cache
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, key)
+}
+
 // cleanup periodically removes expired items
 func (c *Cache) cleanup() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 	
 	for range ticker.C {
-		c.mu.Lock()
-		now := time.Now()
-		for key, item := range c.items {
-			if now.After(item.expiresAt) {
-				delete(c.items, key)
-			}
+		c.evictExpired()
+	}
+}
+
+// evictExpired removes every item whose TTL has passed
+func (c *Cache) evictExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	now := c.clock.Now()
+	for key, item := range c.items {
+		if now.After(item.expiresAt) {
+			delete(c.items, key)
 		}
-		c.mu.Unlock()
 	}
 }
 
@@ -165,29 +129,23 @@ func (c *Cache) cleanup() {
 
 // ContractScanner handles contract risk scanning
 type ContractScanner struct {
-	cache          *Cache
-	baseScanAPIKey string
-	etherscanAPIKey string
-	httpClient     *http.Client
+	cache *Cache
 }
 
 // NewContractScanner creates a new contract scanner
 func NewContractScanner() *ContractScanner {
 	return &ContractScanner{
-		cache:           NewCache(24 * time.Hour),
-		baseScanAPIKey:  os.Getenv("BASESCAN_API_KEY"),
-		etherscanAPIKey: os.Getenv("ETHERSCAN_API_KEY"),
-		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		cache: NewCache(24 * time.Hour),
 	}
 }
 
 // Scan scans a contract address for risks
 func (s *ContractScanner) Scan(address, chain string) (*ContractScanResult, error) {
-	// Normalize address
-	address = strings.ToLower(address)
-	if !strings.HasPrefix(address, "0x") {
+	// Validate and normalize address
+	if !isValidAddress(address) {
 		return nil, fmt.Errorf("invalid address format")
 	}
+	address = strings.ToLower(address)
 	
 	// Check cache first
 	cacheKey := fmt.Sprintf("contract:%s:%s", chain, address)
@@ -206,39 +164,50 @@ func (s *ContractScanner) Scan(address, chain string) (*ContractScanResult, erro
 		ScannedAt: time.Now().Unix(),
 	}
 	
-	// Determine which API to use
-	apiKey := s.etherscanAPIKey
-	apiURL := "https://api.etherscan.io/api"
-	if chain == "base" {
-		apiKey = s.baseScanAPIKey
-		apiURL = "https://api.basescan.org/api"
+	if warning := specialAddressWarning(address); warning != "" {
+		result.RiskScore += runtimeConfig.Current().RiskWeight(RuleSpecialAddress)
+		result.Flags = append(result.Flags, "special_address")
+		result.Warnings = append(result.Warnings, warning)
 	}
 	
+	// Determine which API to use
+	chainConfig, _ := runtimeConfig.Current().Chain(chain)
+	
 	// Check if contract is verified
-	verified, err := s.checkVerification(address, apiURL, apiKey)
+	verified, err := s.checkVerification(address, chainConfig)
 	if err == nil {
 		result.IsVerified = verified
 		if !verified {
-			result.RiskScore += 30
+			result.RiskScore += runtimeConfig.Current().RiskWeight(RuleUnverifiedContract)
 			result.Flags = append(result.Flags, "unverified_contract")
 			result.Warnings = append(result.Warnings, "Contract source code is not verified")
 		}
 	}
 	
-	// Check for proxy pattern
-	isProxy, err := s.checkProxy(address, apiURL, apiKey)
+	// Check for proxy pattern; a recognized contract's proxy is upgraded
+	// by its issuer
+	knownName, known := runtimeConfig.Current().KnownContract(chain, address)
+	known = known && !runtimeConfig.Current().IsBlocked(address)
+	isProxy, err := s.checkProxy(address, chainConfig)
 	if err == nil {
 		result.IsProxy = isProxy
-		if isProxy {
+		if isProxy && !known {
 			result.Warnings = append(result.Warnings, "Contract is a proxy - check implementation")
 		}
 	}
 	
+	// Check deployment age and deployer reputation
+	for _, pattern := range s.checkDeployment(address, chainConfig, result) {
+		result.RiskScore += pattern.score
+		result.Flags = append(result.Flags, pattern.name)
+		result.Warnings = append(result.Warnings, pattern.description)
+	}
+	
 	// Check for honeypot indicators
-	hisHoneypot := s.checkHoneypotIndicators(address, chain)
+	hisHoneypot := s.checkHoneypotIndicators(address, chainConfig)
 	result.IsHoneypot = hisHoneypot
 	if hisHoneypot {
-		result.RiskScore += 50
+		result.RiskScore += runtimeConfig.Current().RiskWeight(RuleHoneypot)
 		result.Flags = append(result.Flags, "honeypot_indicators")
 		result.Warnings = append(result.Warnings, "Honeypot patterns detected - extreme caution")
 	}
@@ -251,10 +220,20 @@ func (s *ContractScanner) Scan(address, chain string) (*ContractScanResult, erro
 		result.Warnings = append(result.Warnings, pattern.description)
 	}
 	
+	// Recognized protocol contracts are capped unless blocklisted
+	if known {
+		result.Known = knownName
+		result.Flags = append(result.Flags, "recognized_protocol_contract")
+		if result.RiskScore > knownContractMaxRisk {
+			result.RiskScore = knownContractMaxRisk
+		}
+	}
+	
 	// Cap risk score
 	if result.RiskScore > 100 {
 		result.RiskScore = 100
 	}
+	result.Scoring = scoring("contract", runtimeConfig.Current(), result.ScannedAt, SourceExplorer, SourceHoneypot)
 	
 	// Cache result
 	s.cache.Set(cacheKey, result)
@@ -262,74 +241,25 @@ func (s *ContractScanner) Scan(address, chain string) (*ContractScanResult, erro
 	return result, nil
 }
 
-func (s *ContractScanner) checkVerification(address, apiURL, apiKey string) (bool, error) {
-	url := fmt.Sprintf("%s?module=contract&action=getabi&address=%s&apikey=%s", apiURL, address, apiKey)
-	resp, err := s.httpClient.Get(url)
-	if err != nil {
-		return false, err
+func (s *ContractScanner) checkVerification(address string, chain ChainConfig) (bool, error) {
+	_, err := providers.Explorer.ContractABI(address, chain)
+	if errors.Is(err, errNotVerified) {
+		return false, nil
 	}
-	defer resp.Body.Close()
-	
-	var result struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Result  string `json:"result"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false, err
-	}
-	
-	return result.Status == "1" && result.Result != "Invalid Address format", nil
+	return err == nil, err
 }
 
-func (s *ContractScanner) checkProxy(address, apiURL, apiKey string) (bool, error) {
-	url := fmt.Sprintf("%s?module=contract&action=getsourcecode&address=%s&apikey=%s", apiURL, address, apiKey)
-	resp, err := s.httpClient.Get(url)
+func (s *ContractScanner) checkProxy(address string, chain ChainConfig) (bool, error) {
+	source, err := providers.Explorer.ContractSource(address, chain)
 	if err != nil {
 		return false, err
 	}
-	defer resp.Body.Close()
-	
-	var result struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Result  []struct {
-			Proxy string `json:"Proxy"`
-		} `json:"result"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false, err
-	}
-	
-	if len(result.Result) > 0 {
-		return result.Result[0].Proxy == "1", nil
-	}
-	return false, nil
+	return source.Proxy, nil
 }
 
-func (s *ContractScanner) checkHoneypotIndicators(address, chain string) bool {
-	// Check honeypot.is API or similar service
-	// This is a simplified implementation
-	honeypotURL := fmt.Sprintf("https://api.honeypot.is/v2/IsHoneypot?address=%s&chainID=%s", 
-		address, map[string]string{"base": "8453", "ethereum": "1"}[chain])
-	
-	resp, err := s.httpClient.Get(honeypotURL)
-	if err != nil {
-		return false
-	}
-	defer resp.Body.Close()
-	
-	var result struct {
-		IsHoneypot bool `json:"IsHoneypot"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false
-	}
-	
-	return result.IsHoneypot
+func (s *ContractScanner) checkHoneypotIndicators(address string, chain ChainConfig) bool {
+	report, err := providers.Honeypot.Honeypot(address, chain)
+	return err == nil && report.IsHoneypot
 }
 
 type riskPattern struct {
@@ -343,6 +273,13 @@ func (s *ContractScanner) analyzeContractPatterns(address, chain string) []riskP
 	
 	// Check known scam databases or patterns
 	// This would integrate with services like Chainabuse, ScamSniffer, etc.
+	if runtimeConfig.Current().IsBlocked(address) {
+		patterns = append(patterns, riskPattern{
+			name:        "blocklisted",
+			score:       runtimeConfig.Current().RiskWeight(RuleBlocklisted),
+			description: "Address is on the operator blocklist",
+		})
+	}
 	
 	return patterns
 }
@@ -357,7 +294,7 @@ type AgentScorer struct {
 // NewAgentScorer creates a new agent scorer
 func NewAgentScorer() *AgentScorer {
 	return &AgentScorer{
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: upstreamLimiter},
 	}
 }
 
@@ -419,6 +356,7 @@ func (s *AgentScorer) Score(agentID string) (*AgentScoreResult, error) {
 		score = 0
 	}
 	result.SecurityScore = score
+	result.Scoring = scoring("agent", runtimeConfig.Current(), result.ScoredAt)
 	
 	return result, nil
 }
@@ -454,18 +392,43 @@ func (s *AgentScorer) check8004scanFeedback(agentID string) (float64, int, []str
 
 // TxSimulator simulates transactions before execution
 type TxSimulator struct {
-	rpcClient *RPCClient
+	rpcClient  *RPCClient
+	chain      string                // the chain rpcClient is on
+	chains     map[string]*RPCClient // other chains, see SetChainRPCs
+	bundlerURL string           // ERC-4337 bundler for user operations, optional
+	cache      *SimulationCache // optional, see SetCache
 }
 
 // NewTxSimulator creates a new transaction simulator
 func NewTxSimulator(rpcURL string) *TxSimulator {
 	return &TxSimulator{
 		rpcClient: &RPCClient{url: rpcURL},
+		chain:     "ethereum",
+	}
+}
+
+// SetChainRPCs lets preflights name the chain they are for, by chain name
+func (s *TxSimulator) SetChainRPCs(rpcURLs map[string]string) {
+	s.chains = make(map[string]*RPCClient, len(rpcURLs))
+	for chain, url := range rpcURLs {
+		s.chains[chain] = &RPCClient{url: url}
+	}
+}
+
+// forChain returns the simulator for chain. Chains without a node are
+// simulated on the simulator's own.
+func (s *TxSimulator) forChain(chain string) *TxSimulator {
+	rpc, ok := s.chains[chain]
+	if !ok || chain == s.chain {
+		return s
 	}
+	c := *s
+	c.rpcClient, c.chain = rpc, chain
+	return &c
 }
 
-// Simulate simulates a transaction and returns risk assessment
-func (s *TxSimulator) Simulate(tx *TxPreflightRequest) (*TxPreflightResult, error) {
+// simulate simulates a transaction and returns risk assessment
+func (s *TxSimulator) simulate(tx *TxPreflightRequest) (*TxPreflightResult, error) {
 	result := &TxPreflightResult{
 		Safe:            true,
 		RiskScore:       0,
@@ -474,6 +437,10 @@ func (s *TxSimulator) Simulate(tx *TxPreflightRequest) (*TxPreflightResult, erro
 		Recommendations: []string{},
 		CheckedAt:       time.Now().Unix(),
 	}
+	if tx.UserOperation != nil {
+		return s.simulateUserOperation(tx)
+	}
+	result.Scoring = scoring("preflight", runtimeConfig.Current(), result.CheckedAt)
 	
 	// Validate inputs
 	if tx.To == "" {
@@ -482,10 +449,38 @@ func (s *TxSimulator) Simulate(tx *TxPreflightRequest) (*TxPreflightResult, erro
 		result.Errors = append(result.Errors, "Missing 'to' address")
 		return result, nil
 	}
+	if !isValidAddress(tx.To) {
+		result.Safe = false
+		result.RiskScore = 100
+		result.Errors = append(result.Errors, "Invalid 'to' address (bad hex or EIP-55 checksum)")
+		return result, nil
+	}
+	if tx.From != "" && !isValidAddress(tx.From) {
+		result.Safe = false
+		result.RiskScore = 100
+		result.Errors = append(result.Errors, "Invalid 'from' address (bad hex or EIP-55 checksum)")
+		return result, nil
+	}
+	if warning := specialAddressWarning(tx.To); warning != "" {
+		result.RiskScore += 60
+		result.Warnings = append(result.Warnings, warning)
+	}
+	if runtimeConfig.Current().IsBlocked(tx.To) {
+		result.RiskScore += 100
+		result.Warnings = append(result.Warnings, "Target address is on the operator blocklist")
+	}
+	bridge, findings := checkBridge(tx.To, tx.Data)
+	result.Bridge = bridge
+	for _, f := range findings {
+		result.RiskScore += f.score
+		result.Warnings = append(result.Warnings, f.description)
+	}
 	
 	// Check if target is a contract
 	isContract, err := s.checkIsContract(tx.To)
-	if err == nil && isContract {
+	if name, ok := runtimeConfig.Current().KnownContract(s.chain, tx.To); ok {
+		result.Warnings = append(result.Warnings, recognizedContract(name))
+	} else if err == nil && isContract {
 		result.Warnings = append(result.Warnings, "Target is a smart contract - verify it's trusted")
 	}
 	
@@ -497,15 +492,16 @@ func (s *TxSimulator) Simulate(tx *TxPreflightRequest) (*TxPreflightResult, erro
 	}
 	
 	// Check value transfers
-	if tx.Value != "" && tx.Value != "0" && tx.Value != "0x0" {
-		valueWei, err := strconv.ParseInt(strings.TrimPrefix(tx.Value, "0x"), 16, 64)
-		if err == nil && valueWei > 0 {
-			valueETH := float64(valueWei) / 1e18
-			if valueETH > 1.0 {
-				result.Warnings = append(result.Warnings, fmt.Sprintf("Large ETH transfer: %.4f ETH", valueETH))
-				result.RiskScore += 10
-			}
-		}
+	valueWei, err := units.ParseWei(tx.Value)
+	if err != nil {
+		result.Safe = false
+		result.RiskScore = 100
+		result.Errors = append(result.Errors, fmt.Sprintf("Invalid 'value': %v", err))
+		return result, nil
+	}
+	if valueWei.Cmp(units.Ether) > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Large ETH transfer: %s ETH", units.Format(valueWei, 18)))
+		result.RiskScore += 10
 	}
 	
 	// Simulate gas estimation
@@ -519,14 +515,37 @@ func (s *TxSimulator) Simulate(tx *TxPreflightRequest) (*TxPreflightResult, erro
 		result.GasEstimate = gasEstimate
 		
 		// Check for high gas usage
-		gasInt, _ := strconv.ParseInt(gasEstimate, 10, 64)
+		gasInt, _ := strconv.ParseUint(gasEstimate, 10, 64)
 		if gasInt > 500000 {
 			result.Warnings = append(result.Warnings, "High gas usage detected")
 			result.RiskScore += 5
 		}
 	}
 	
-	// Determine overall safety
+	// Recommend fees for sending now, and price the transaction at them
+	if fees, err := estimateFees(s.rpcClient); err == nil {
+		result.Fees = fees
+		if fees.Timing == "wait" {
+			result.Recommendations = append(result.Recommendations, fees.Reason)
+		}
+		if result.SimulationSuccess {
+			gas, _ := strconv.ParseUint(result.GasEstimate, 10, 64)
+			if cost, err := txCost(s.rpcClient, s.chain, tx.To, valueWei, tx.Data, gas, fees); err == nil {
+				result.Cost = cost
+			} else {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("Could not price the transaction: %v", err))
+			}
+		}
+	}
+	result.DataSources[SourceRPC] = result.CheckedAt
+	result.DataSources[SourceExplorer] = result.CheckedAt // unregistered bridges
+	
+	scorePreflight(result)
+	return result, nil
+}
+
+// scorePreflight determines overall safety from the risk score
+func scorePreflight(result *TxPreflightResult) {
 	if result.RiskScore >= 50 {
 		result.Safe = false
 		result.Recommendations = append(result.Recommendations, "Transaction has high risk - review carefully")
@@ -539,8 +558,6 @@ func (s *TxSimulator) Simulate(tx *TxPreflightRequest) (*TxPreflightResult, erro
 	if result.RiskScore > 100 {
 		result.RiskScore = 100
 	}
-	
-	return result, nil
 }
 
 func (s *TxSimulator) checkIsContract(address string) (bool, error) {
@@ -572,9 +589,9 @@ func (s *TxSimulator) analyzeTxData(data string) []txRiskPattern {
 	// Check for approve() calls with unlimited amounts
 	if strings.Contains(data, "0x095ea7b3") { // approve function signature
 		// Check if amount is max uint256
-		if len(data) >= 74 {
-			amountHex := data[74:]
-			if strings.TrimLeft(amountHex, "f") == "" || strings.TrimLeft(amountHex, "F") == "" {
+		if len(data) >= 138 {
+			amount, err := units.ParseHex("0x" + data[74:138])
+			if err == nil && amount.Cmp(units.MaxUint256) == 0 {
 				patterns = append(patterns, txRiskPattern{
 					score:       30,
 					description: "Unlimited token approval detected - use specific amount instead",
@@ -595,10 +612,14 @@ func (s *TxSimulator) analyzeTxData(data string) []txRiskPattern {
 }
 
 func (s *TxSimulator) estimateGas(tx *TxPreflightRequest) (string, error) {
+	value, err := units.ParseWei(tx.Value)
+	if err != nil {
+		return "", err
+	}
 	params := map[string]string{
 		"from":  tx.From,
 		"to":    tx.To,
-		"value": tx.Value,
+		"value": units.Hex(value),
 		"data":  tx.Data,
 	}
 	
@@ -612,14 +633,14 @@ func (s *TxSimulator) estimateGas(tx *TxPreflightRequest) (string, error) {
 		return "", fmt.Errorf("invalid gas estimate response")
 	}
 	
-	gasInt, err := strconv.ParseInt(strings.TrimPrefix(gasHex, "0x"), 16, 64)
+	gas, err := units.ParseHex(gasHex)
 	if err != nil {
 		return "", err
 	}
 	
 	// Add 20% buffer
-	gasWithBuffer := int64(float64(gasInt) * 1.2)
-	return strconv.FormatInt(gasWithBuffer, 10), nil
+	gasWithBuffer := new(big.Int).Div(new(big.Int).Mul(gas, big.NewInt(12)), big.NewInt(10))
+	return gasWithBuffer.String(), nil
 }
 
 // ==================== PROMPT GUARD ====================
@@ -713,7 +734,9 @@ func (g *PromptGuard) Test(prompt string) *PromptTestResult {
 		TestedAt:   time.Now().Unix(),
 	}
 	
-	for _, pattern := range g.patterns {
+	// Built-in patterns first, then any loaded from the config file
+	patterns := append(append([]InjectionPattern{}, g.patterns...), runtimeConfig.Current().InjectionPatterns()...)
+	for _, pattern := range patterns {
 		if pattern.Regex.MatchString(prompt) {
 			result.RiskScore += pattern.RiskPoints
 			result.Patterns = append(result.Patterns, pattern.Name)
@@ -748,6 +771,7 @@ func (g *PromptGuard) Test(prompt string) *PromptTestResult {
 	default:
 		result.ThreatLevel = "NONE"
 	}
+	result.Scoring = scoring("prompt", runtimeConfig.Current(), result.TestedAt)
 	
 	return result
 }
@@ -771,12 +795,17 @@ func handleContractScan(w http.ResponseWriter, r *http.Request, scanner *Contrac
 		metrics.RecordRequest("/api/scan-contract", "400")
 		return
 	}
+	if err := address.Validate(req.Address); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"Invalid address: %s"}`, err.Error()), http.StatusBadRequest)
+		metrics.RecordRequest("/api/scan-contract", "400")
+		return
+	}
 	
 	if req.Chain == "" {
 		req.Chain = "base"
 	}
-	if req.Chain != "base" && req.Chain != "ethereum" {
-		http.Error(w, `{"error":"Invalid chain - use 'base' or 'ethereum'"}`, http.StatusBadRequest)
+	if _, ok := runtimeConfig.Current().Chain(req.Chain); !ok {
+		http.Error(w, fmt.Sprintf(`{"error":"Invalid chain - use %s"}`, runtimeConfig.Current().ChainNames()), http.StatusBadRequest)
 		metrics.RecordRequest("/api/scan-contract", "400")
 		return
 	}
@@ -784,16 +813,14 @@ func handleContractScan(w http.ResponseWriter, r *http.Request, scanner *Contrac
 	// Scan contract
 	result, err := scanner.Scan(req.Address, req.Chain)
 	if err != nil {
+		log.Printf("/api/scan-contract failed (payer=%s): %v", payerLabel(r), err)
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 		metrics.RecordRequest("/api/scan-contract", "500")
 		return
 	}
+	events.Publish(r.Context(), EventScanCompleted, ScanCompleted{Kind: "contract", Chain: req.Chain, Address: req.Address, Result: result})
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":             result,
-		"payment_verified": true,
-	})
+	writePaidData(w, r, result)
 	
 	metrics.RecordRequest("/api/scan-contract", "200")
 	metrics.RecordResponseTime("/api/scan-contract", time.Since(start))
@@ -817,16 +844,13 @@ func handleAgentScore(w http.ResponseWriter, r *http.Request, scorer *AgentScore
 	
 	result, err := scorer.Score(req.AgentID)
 	if err != nil {
+		log.Printf("/api/agent-score failed (payer=%s): %v", payerLabel(r), err)
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 		metrics.RecordRequest("/api/agent-score", "500")
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":             result,
-		"payment_verified": true,
-	})
+	writePaidData(w, r, result)
 	
 	metrics.RecordRequest("/api/agent-score", "200")
 	metrics.RecordResponseTime("/api/agent-score", time.Since(start))
@@ -842,18 +866,26 @@ func handleTxPreflight(w http.ResponseWriter, r *http.Request, simulator *TxSimu
 		return
 	}
 	
+	policies, err := runtimeConfig.Current().SelectPolicies(req.Policies)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		metrics.RecordRequest("/api/tx-preflight", "400")
+		return
+	}
+	
 	result, err := simulator.Simulate(&req)
+	if err == nil {
+		watchLists.checkPreflight(r.Context(), &req, result)
+		applyPolicies(policies, &req, result)
+	}
 	if err != nil {
+		log.Printf("/api/tx-preflight failed (payer=%s): %v", payerLabel(r), err)
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 		metrics.RecordRequest("/api/tx-preflight", "500")
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":             result,
-		"payment_verified": true,
-	})
+	writePaidData(w, r, result)
 	
 	metrics.RecordRequest("/api/tx-preflight", "200")
 	metrics.RecordResponseTime("/api/tx-preflight", time.Since(start))
@@ -877,11 +909,7 @@ func handlePromptTest(w http.ResponseWriter, r *http.Request, guard *PromptGuard
 	
 	result := guard.Test(req.Prompt)
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":             result,
-		"payment_verified": true,
-	})
+	writePaidData(w, r, result)
 	
 	metrics.RecordRequest("/api/prompt-test", "200")
 	metrics.RecordResponseTime("/api/prompt-test", time.Since(start))
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// Settlement check outcomes, the result label of x402_settlement_checks_total
+const (
+	settlementVerified    = "verified"
+	settlementPending     = "pending"     // not mined or not confirmed yet
+	settlementMismatch    = "mismatch"    // failed, or did not pay the receiver enough
+	settlementReplayed    = "replayed"    // already paid for another request
+	settlementUnavailable = "unavailable" // the RPC or the shared state store failed
+)
+
+// settlementKeyPrefix marks transactions that have paid for a request in
+// the shared state store
+const settlementKeyPrefix = "x402:settlement:"
+
+var txHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// SettlementVerifier checks that a payment token is backed by an on-chain
+// transfer: the transaction it names in payment.txHash succeeded, moved at
+// least the claimed amount of the asset from the token's sub to the
+// receiver, and has enough confirmations. The native asset is paid as the
+// transaction's value. Each transaction pays for one request only; spent hashes
+// are kept in the shared state store, so replicas agree.
+type SettlementVerifier struct {
+	rpcURLs       map[string]string // network -> JSON-RPC URL
+	confirmations int64
+
+	mu     sync.Mutex
+	counts map[string]int64 // outcome -> checks
+}
+
+// NewSettlementVerifier verifies payments against rpcURLs, requiring
+// confirmations blocks including the one the payment is in
+func NewSettlementVerifier(rpcURLs map[string]string, confirmations int64) *SettlementVerifier {
+	return &SettlementVerifier{
+		rpcURLs:       rpcURLs,
+		confirmations: max(confirmations, 1),
+		counts:        make(map[string]int64),
+	}
+}
+
+func (v *SettlementVerifier) count(outcome string) {
+	v.mu.Lock()
+	v.counts[outcome]++
+	v.mu.Unlock()
+}
+
+// check verifies the transfer behind claims without spending it. A nil
+// verifier accepts every payment.
+func (v *SettlementVerifier) check(claims *PaymentToken, asset, receiver string) error {
+	if v == nil {
+		return nil
+	}
+	outcome, err := v.verify(claims, asset, receiver)
+	v.count(outcome)
+	return err
+}
+
+func (v *SettlementVerifier) verify(claims *PaymentToken, asset, receiver string) (string, error) {
+	payment := claims.Payment
+	if !txHashPattern.MatchString(payment.TxHash) {
+		return settlementMismatch, errors.New("payment.txHash must name the transaction that paid")
+	}
+	// Only the payer's own transfers count, so a token cannot claim
+	// someone else's payment to the receiver
+	payer := strings.ToLower(claims.Subject)
+	if payer == "" {
+		return settlementMismatch, errors.New("sub must name the address that paid")
+	}
+	rpcURL, ok := v.rpcURLs[payment.Network]
+	token, known := assetOn(payment.Network, asset)
+	if !ok || !known {
+		return settlementMismatch, fmt.Errorf("%s payments on %s cannot be verified", asset, payment.Network)
+	}
+	if _, used, err := sharedState.Get(settlementKey(payment.TxHash)); err != nil {
+		return settlementUnavailable, fmt.Errorf("settlement records unavailable: %w", err)
+	} else if used {
+		return settlementReplayed, fmt.Errorf("transaction %s already paid for a request", payment.TxHash)
+	}
+
+	var receipt *txReceipt
+	if err := jsonRPC(rpcURL, "eth_getTransactionReceipt", []interface{}{payment.TxHash}, &receipt); err != nil {
+		return settlementUnavailable, fmt.Errorf("reading transaction %s: %w", payment.TxHash, err)
+	}
+	if receipt == nil {
+		return settlementPending, fmt.Errorf("transaction %s is not mined yet", payment.TxHash)
+	}
+	if receipt.Status != "0x1" {
+		return settlementMismatch, fmt.Errorf("transaction %s failed", payment.TxHash)
+	}
+
+	paid := new(big.Int)
+	if token == "" {
+		// The native asset is paid as the transaction's value
+		var tx *nativeTx
+		if err := jsonRPC(rpcURL, "eth_getTransactionByHash", []interface{}{payment.TxHash}, &tx); err != nil {
+			return settlementUnavailable, fmt.Errorf("reading transaction %s: %w", payment.TxHash, err)
+		}
+		if tx == nil {
+			return settlementUnavailable, fmt.Errorf("reading transaction %s: not found", payment.TxHash)
+		}
+		if strings.ToLower(tx.From) == payer && strings.EqualFold(tx.To, receiver) {
+			if value, err := units.ParseHex(tx.Value); err == nil {
+				paid = value
+			}
+		}
+	}
+	for _, l := range receipt.Logs {
+		if !strings.EqualFold(l.Address, token) || len(l.Topics) != 3 || l.Topics[0] != erc20TransferTopic || len(strings.TrimPrefix(l.Topics[1], "0x")) != 64 || len(strings.TrimPrefix(l.Topics[2], "0x")) != 64 {
+			continue
+		}
+		if topicAddress(l.Topics[1]) != payer || topicAddress(l.Topics[2]) != strings.ToLower(receiver) {
+			continue
+		}
+		if amount, err := units.ParseHex(l.Data); err == nil {
+			paid.Add(paid, amount)
+		}
+	}
+	claimed, ok := new(big.Rat).SetString(payment.Amount)
+	if !ok {
+		return settlementMismatch, fmt.Errorf("invalid amount %q", payment.Amount)
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(paymentAssets[asset].decimals)), nil)
+	if new(big.Rat).SetFrac(paid, scale).Cmp(claimed) < 0 {
+		return settlementMismatch, fmt.Errorf("transaction %s paid %s %s from %s to %s, want %s", payment.TxHash, units.Format(paid, paymentAssets[asset].decimals), asset, payer, receiver, payment.Amount)
+	}
+
+	var head string
+	if err := jsonRPC(rpcURL, "eth_blockNumber", []interface{}{}, &head); err != nil {
+		return settlementUnavailable, fmt.Errorf("reading the latest block: %w", err)
+	}
+	latest, err1 := units.ParseHex(head)
+	block, err2 := units.ParseHex(receipt.BlockNumber)
+	if err1 != nil || err2 != nil {
+		return settlementUnavailable, errors.New("reading the latest block: invalid block number")
+	}
+	if confirmations := new(big.Int).Sub(latest, block).Int64() + 1; confirmations < v.confirmations {
+		return settlementPending, fmt.Errorf("transaction %s has %d of %d confirmations", payment.TxHash, max(confirmations, 0), v.confirmations)
+	}
+	return settlementVerified, nil
+}
+
+// claim spends txHash, failing if another request spent it first. A nil
+// verifier spends nothing.
+func (v *SettlementVerifier) claim(txHash string) (*paymentClaim, error) {
+	if v == nil {
+		return nil, nil
+	}
+	c := &paymentClaim{key: settlementKey(txHash), owner: newPaymentID()}
+	ok, err := sharedState.SetNX(c.key, c.owner, 0)
+	if err != nil {
+		v.count(settlementUnavailable)
+		return nil, fmt.Errorf("settlement records unavailable: %w", err)
+	}
+	if !ok {
+		v.count(settlementReplayed)
+		paymentReplays.count(replaySettlement)
+		return nil, fmt.Errorf("transaction %s already paid for a request", txHash)
+	}
+	return c, nil
+}
+
+// nativeTx is the part of a transaction a native payment is checked by
+type nativeTx struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+
+func settlementKey(txHash string) string {
+	return settlementKeyPrefix + strings.ToLower(txHash)
+}
+
+// WriteMetrics emits settlement checks by outcome
+func (v *SettlementVerifier) WriteMetrics(b *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	b.WriteString("# HELP x402_settlement_checks_total On-chain payment settlement checks, by result\n")
+	b.WriteString("# TYPE x402_settlement_checks_total counter\n")
+	for _, outcome := range sortedKeys(v.counts) {
+		fmt.Fprintf(b, "x402_settlement_checks_total{result=%q} %d\n", outcome, v.counts[outcome])
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+const settlementTx = "0x9f0c5b1d7e4a3c2b1a0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b"
+
+// usdcTransfer is a receipt moving amount (hex) of Base USDC to receiver
+func usdcTransfer(receiver, amount string) map[string]interface{} {
+	pad := func(addr string) string {
+		return "0x" + strings.Repeat("0", 24) + strings.ToLower(strings.TrimPrefix(addr, "0x"))
+	}
+	return map[string]interface{}{
+		"status":      "0x1",
+		"blockNumber": "0x10",
+		"logs": []map[string]interface{}{{
+			"address": payoutTokens["base:USDC"],
+			"topics":  []string{erc20TransferTopic, pad("0xabc0000000000000000000000000000000000001"), pad(receiver)},
+			"data":    amount,
+		}},
+	}
+}
+
+func TestE2ESettlement(t *testing.T) {
+	// The default Base RPC is routed to the fake one
+	srv, up := startService(t, map[string]string{
+		"SETTLEMENT_VERIFY":        "true",
+		"SETTLEMENT_CONFIRMATIONS": "3",
+		"PAYMENT_DIAGNOSTICS":      "true",
+	})
+
+	get := func(token string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/gas", nil)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	var challenge struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(get("").Body).Decode(&challenge)
+	req := challenge.Payment
+	if req.Settlement != "onchain" || req.Confirmations != 3 {
+		t.Fatalf("challenge = %+v, want on-chain settlement with 3 confirmations", req)
+	}
+	token := func(txHash string) string {
+		claims := PaymentToken{}
+		claims.Payment.Amount = req.MaxAmount
+		claims.Payment.Asset = req.Asset
+		claims.Payment.Receiver = req.Receiver
+		claims.Payment.Network = req.Network
+		claims.Payment.TxHash = txHash
+		claims.Subject = "0xabc0000000000000000000000000000000000001"
+		return signPayment(t, claims)
+	}
+	refusal := func(resp *http.Response) string {
+		var body struct {
+			Checks []CheckFailure `json:"checks"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusPaymentRequired || len(body.Checks) != 1 || body.Checks[0].Check != CheckSettlement {
+			t.Errorf("refusal = %d %+v, want a settlement failure", resp.StatusCode, body.Checks)
+			return ""
+		}
+		return body.Checks[0].Reason
+	}
+
+	if reason := refusal(get(token(""))); !strings.Contains(reason, "txHash") {
+		t.Errorf("token without a transaction: %s", reason)
+	}
+	up.SetRPCResult("eth_getTransactionReceipt", nil)
+	if reason := refusal(get(token(settlementTx))); !strings.Contains(reason, "not mined") {
+		t.Errorf("unmined transaction: %s", reason)
+	}
+	up.SetRPCResult("eth_getTransactionReceipt", usdcTransfer(req.Receiver, "0x1"))
+	up.SetRPCResult("eth_blockNumber", "0x12")
+	if reason := refusal(get(token(settlementTx))); !strings.Contains(reason, "paid 0.000001 USDC") {
+		t.Errorf("underpaying transaction: %s", reason)
+	}
+	up.SetRPCResult("eth_getTransactionReceipt", usdcTransfer(req.Receiver, "0xf4240"))
+	up.SetRPCResult("eth_blockNumber", "0x11")
+	if reason := refusal(get(token(settlementTx))); !strings.Contains(reason, "2 of 3 confirmations") {
+		t.Errorf("unconfirmed transaction: %s", reason)
+	}
+
+	up.SetRPCResult("eth_blockNumber", "0x12")
+	// Someone else's transfer to the receiver does not pay for the token
+	other := func(txHash string) string {
+		claims := PaymentToken{}
+		claims.Payment.Amount = req.MaxAmount
+		claims.Payment.Asset = req.Asset
+		claims.Payment.Receiver = req.Receiver
+		claims.Payment.Network = req.Network
+		claims.Payment.TxHash = txHash
+		claims.Subject = "0xabc0000000000000000000000000000000000002"
+		return signPayment(t, claims)
+	}
+	if reason := refusal(get(other(settlementTx))); !strings.Contains(reason, "paid 0 USDC") {
+		t.Errorf("transaction from another sender: %s", reason)
+	}
+	if resp := get(token(settlementTx)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("settled payment returned %d", resp.StatusCode)
+	}
+	if reason := refusal(get(token(settlementTx))); !strings.Contains(reason, "already paid") {
+		t.Errorf("replayed transaction: %s", reason)
+	}
+	entries := ledgerEntries(t, srv)
+	if len(entries) != 1 || entries[0].TxHash != settlementTx {
+		t.Errorf("ledger = %+v, want the settlement transaction recorded", entries)
+	}
+}
+
+func TestSettlementNativePayment(t *testing.T) {
+	up := testhttp.New(t)
+	v := NewSettlementVerifier(map[string]string{"base": up.RPC.URL}, 1)
+	const payer, receiver = "0xabc0000000000000000000000000000000000001", "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"
+	up.SetRPCResult("eth_getTransactionReceipt", map[string]interface{}{"status": "0x1", "blockNumber": "0x10", "logs": []interface{}{}})
+	up.SetRPCResult("eth_blockNumber", "0x10")
+	// 0.0005 ETH sent as the transaction's value
+	up.SetRPCResult("eth_getTransactionByHash", map[string]string{"from": payer, "to": strings.ToLower(receiver), "value": "0x1c6bf52634000"})
+
+	claims := &PaymentToken{}
+	claims.Subject = payer
+	claims.Payment = PaymentClaims{Amount: "0.0005", Asset: "ETH", Network: "base", TxHash: "0x" + strings.Repeat("5e", 32)}
+	if err := v.check(claims, "ETH", receiver); err != nil {
+		t.Errorf("native payment refused: %v", err)
+	}
+	claims.Payment.Amount = "0.001"
+	if err := v.check(claims, "ETH", receiver); err == nil || !strings.Contains(err.Error(), "paid 0.0005 ETH") {
+		t.Errorf("underpaid native payment: err = %v", err)
+	}
+	// The value of a transaction to someone else does not count
+	claims.Payment.Amount = "0.0005"
+	if err := v.check(claims, "ETH", "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"); err == nil || !strings.Contains(err.Error(), "paid 0 ETH") {
+		t.Errorf("payment to another address: err = %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/arithmosquillsworth/x402-service/pkg/kv"
+	"github.com/arithmosquillsworth/x402-service/pkg/ratelimit"
+)
+
+// sharedState holds the state replicas must agree on: gateway rate limits
+// and async job status. It is in-process unless SHARED_STATE_URL points at
+// Redis; newService replaces it on start.
+var sharedState kv.Store = kv.NewMemory()
+
+// isShared reports whether store is visible to other replicas
+func isShared(store kv.Store) bool {
+	_, local := store.(*kv.Memory)
+	return store != nil && !local
+}
+
+// newRateLimit allows perMinute requests per key in bursts of burst. Its
+// buckets are kept in sharedState when that is Redis, so every replica
+// draws on the same allowance; name keeps them apart from other limits.
+func newRateLimit(name string, perMinute, burst int) *ratelimit.Bucket {
+	if r, ok := sharedState.(*kv.Redis); ok {
+		return ratelimit.NewShared(ratelimit.NewRedis(r), name, perMinute, burst)
+	}
+	return ratelimit.New(perMinute, burst)
+}
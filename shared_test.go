@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/kv"
+)
+
+func TestJobsSharedAcrossReplicas(t *testing.T) {
+	store := kv.NewMemory()
+	a := NewJobManager(t.TempDir(), 1, NewMetrics())
+	b := NewJobManager(t.TempDir(), 1, NewMetrics())
+	a.Share(store)
+	b.Share(store)
+
+	handler := a.Async("/api/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/echo?async=true", strings.NewReader(`{}`)))
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &accepted)
+
+	// Replica b answers polls for a job run by replica a
+	var job Job
+	for i := 0; i < 100; i++ {
+		job, _ = b.Get(accepted.JobID)
+		if job.Status == JobSucceeded {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.Status != JobSucceeded || string(job.Result) != `{"ok":true}` {
+		t.Fatalf("job seen by the other replica = %+v", job)
+	}
+
+	if n := a.RemovePayer(""); n != 1 {
+		t.Fatalf("RemovePayer removed %d jobs", n)
+	}
+	if _, ok := b.Get(accepted.JobID); ok {
+		t.Error("purged job still visible to the other replica")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// shedRetryAfter is the Retry-After, in seconds, on shed requests
+const shedRetryAfter = "2"
+
+// LoadShedder turns requests away with 503 when the service is saturated,
+// so the capacity left goes to the requests worth most. Pressure is the
+// higher of in-flight requests over maxInflight and the deepest upstream
+// queue over its concurrency cap. Past freeAt, free endpoints are shed;
+// as pressure climbs on to 1, paid endpoints are shed too, cheapest price
+// first. The most expensive endpoints are never shed.
+type LoadShedder struct {
+	maxInflight int64 // 0 disables shedding
+	freeAt      float64
+	upstream    *UpstreamLimiter
+
+	inflight int64
+
+	mu      sync.RWMutex
+	prices  map[string]float64 // paid endpoint -> USD price
+	dynamic map[string]bool    // paid endpoints priced per request
+	tiers   []float64          // distinct paid prices, ascending
+	shed    map[string]int64   // endpoint, or "free", -> requests shed
+}
+
+// NewLoadShedder sheds above maxInflight concurrent requests, starting
+// with free endpoints at freeAt of it. maxInflight 0 disables shedding.
+func NewLoadShedder(maxInflight int, freeAt float64, upstream *UpstreamLimiter) *LoadShedder {
+	return &LoadShedder{
+		maxInflight: int64(maxInflight),
+		freeAt:      freeAt,
+		upstream:    upstream,
+		prices:      make(map[string]float64),
+		dynamic:     make(map[string]bool),
+		shed:        make(map[string]int64),
+	}
+}
+
+// Register records a paid endpoint's price, which ranks it for shedding
+func (s *LoadShedder) Register(endpoint string, priceUSD float64) {
+	if s == nil {
+		return
+	}
+	s.mu.RLock()
+	known, ok := s.prices[endpoint]
+	s.mu.RUnlock()
+	if ok && known == priceUSD {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[endpoint] = priceUSD
+	s.retier()
+}
+
+// RegisterDynamic records a paid endpoint priced per request, such as
+// /graphql. It is left to the paywall like any paid endpoint but not
+// ranked, since it has no one price.
+func (s *LoadShedder) RegisterDynamic(endpoint string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dynamic[endpoint] = true
+}
+
+// replace swaps the paid endpoints under prefix for prices, as a config
+// reload replaces gateway routes
+func (s *LoadShedder) replace(prefix string, prices map[string]float64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for endpoint := range s.prices {
+		if strings.HasPrefix(endpoint, prefix) {
+			delete(s.prices, endpoint)
+		}
+	}
+	for endpoint, price := range prices {
+		s.prices[endpoint] = price
+	}
+	s.retier()
+}
+
+// retier rebuilds the price tiers from prices. Callers hold mu.
+func (s *LoadShedder) retier() {
+	s.tiers = s.tiers[:0]
+	for _, price := range s.prices {
+		s.tiers = append(s.tiers, price)
+	}
+	sort.Float64s(s.tiers)
+	s.tiers = compactFloats(s.tiers)
+}
+
+func compactFloats(sorted []float64) []float64 {
+	out := sorted[:0]
+	for i, v := range sorted {
+		if i == 0 || v != sorted[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Pressure is how saturated the service is, 1 at capacity
+func (s *LoadShedder) Pressure() float64 {
+	pressure := float64(atomic.LoadInt64(&s.inflight)) / float64(s.maxInflight)
+	if s.upstream != nil {
+		pressure = max(pressure, s.upstream.Saturation())
+	}
+	return pressure
+}
+
+// priceFloor is the lowest price still served at pressure, or -1 when
+// nothing is shed. Free endpoints are priced 0.
+func (s *LoadShedder) priceFloor(pressure float64) float64 {
+	if pressure < s.freeAt {
+		return -1
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.tiers) == 0 {
+		return 0
+	}
+	shed := int((pressure - s.freeAt) / (1 - s.freeAt) * float64(len(s.tiers)))
+	// At freeAt only free endpoints go, the top tier always stays
+	return s.tiers[min(shed, len(s.tiers)-1)]
+}
+
+// Admit reports whether a request to endpoint, priced at priceUSD, may run
+// now. Free endpoints pass 0 and are counted together as "free" when shed.
+func (s *LoadShedder) Admit(endpoint string, priceUSD float64) bool {
+	if s == nil || s.maxInflight <= 0 {
+		return true
+	}
+	floor := s.priceFloor(s.Pressure())
+	if floor < 0 || priceUSD > 0 && priceUSD >= floor {
+		return true
+	}
+	s.mu.Lock()
+	s.shed[endpoint]++
+	s.mu.Unlock()
+	return false
+}
+
+// paid returns the registered price of a paid endpoint
+func (s *LoadShedder) paid(endpoint string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	price, ok := s.prices[endpoint]
+	return price, ok
+}
+
+// priced reports whether endpoint is paid, at a registered price or one
+// set per request
+func (s *LoadShedder) priced(endpoint string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.prices[endpoint]
+	return ok || s.dynamic[endpoint]
+}
+
+// refuseShed answers a shed request
+func refuseShed(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", shedRetryAfter)
+	http.Error(w, `{"error":"Service busy, retry shortly"}`, http.StatusServiceUnavailable)
+}
+
+// withLoadShedding counts requests in flight and sheds free ones under
+// pressure. Paid endpoints are left to the paywall, which knows their
+// price. Health checks and the admin API are never shed.
+func withLoadShedding(s *LoadShedder, next http.Handler) http.Handler {
+	if s == nil || s.maxInflight <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.inflight, 1)
+		defer atomic.AddInt64(&s.inflight, -1)
+
+		path := r.URL.Path
+		paid := s.priced(path)
+		exempt := path == "/health" || strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/gw/")
+		if !paid && !exempt && !s.Admit("free", 0) {
+			refuseShed(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteMetrics emits in-flight requests, pressure, the price floor and
+// shed requests per endpoint
+func (s *LoadShedder) WriteMetrics(b *strings.Builder) {
+	if s == nil || s.maxInflight <= 0 {
+		return
+	}
+	pressure := s.Pressure()
+	b.WriteString("# HELP x402_inflight_requests Requests currently being served\n")
+	b.WriteString("# TYPE x402_inflight_requests gauge\n")
+	fmt.Fprintf(b, "x402_inflight_requests %d\n", atomic.LoadInt64(&s.inflight))
+	b.WriteString("# HELP x402_load_pressure Saturation from in-flight requests and upstream queues, 1 at capacity\n")
+	b.WriteString("# TYPE x402_load_pressure gauge\n")
+	fmt.Fprintf(b, "x402_load_pressure %g\n", pressure)
+	b.WriteString("# HELP x402_load_shed_price_floor Lowest endpoint price in USD still served (-1 when nothing is shed)\n")
+	b.WriteString("# TYPE x402_load_shed_price_floor gauge\n")
+	fmt.Fprintf(b, "x402_load_shed_price_floor %g\n", s.priceFloor(pressure))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	endpoints := make([]string, 0, len(s.shed))
+	for endpoint := range s.shed {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	b.WriteString("# HELP x402_load_shed_total Requests refused with 503 to shed load, by paid endpoint or \"free\"\n")
+	b.WriteString("# TYPE x402_load_shed_total counter\n")
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(b, "x402_load_shed_total{endpoint=%q} %d\n", endpoint, s.shed[endpoint])
+	}
+}
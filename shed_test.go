@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadShedderTiers(t *testing.T) {
+	s := NewLoadShedder(10, 0.5, nil)
+	s.Register("/api/gas", 0.001)
+	s.Register("/api/validators", 0.005)
+	s.Register("/api/scan-wallet", 0.01)
+	s.Register("/api/prompt-test", 0.01)
+
+	cases := []struct {
+		inflight int64
+		admitted []string // of free, /api/gas, /api/validators, /api/scan-wallet
+	}{
+		{4, []string{"free", "/api/gas", "/api/validators", "/api/scan-wallet"}},
+		{5, []string{"/api/gas", "/api/validators", "/api/scan-wallet"}},
+		{7, []string{"/api/validators", "/api/scan-wallet"}},
+		{10, []string{"/api/scan-wallet"}},
+		{40, []string{"/api/scan-wallet"}},
+	}
+	for _, tc := range cases {
+		atomic.StoreInt64(&s.inflight, tc.inflight)
+		var admitted []string
+		if s.Admit("free", 0) {
+			admitted = append(admitted, "free")
+		}
+		for _, endpoint := range []string{"/api/gas", "/api/validators", "/api/scan-wallet"} {
+			price, _ := s.paid(endpoint)
+			if s.Admit(endpoint, price) {
+				admitted = append(admitted, endpoint)
+			}
+		}
+		if strings.Join(admitted, " ") != strings.Join(tc.admitted, " ") {
+			t.Errorf("%d in flight admitted %v, want %v", tc.inflight, admitted, tc.admitted)
+		}
+	}
+
+	var b strings.Builder
+	s.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_load_shed_total{endpoint="free"} 4`,
+		`x402_load_shed_total{endpoint="/api/gas"} 3`,
+		`x402_load_shed_price_floor 0.01`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestLoadShedderUpstreamPressure(t *testing.T) {
+	upstream := NewUpstreamLimiter(http.DefaultTransport, 2, time.Second)
+	s := NewLoadShedder(100, 0.8, upstream)
+	s.Register("/api/gas", 0.001)
+	if !s.Admit("free", 0) {
+		t.Error("free request shed while idle")
+	}
+	atomic.StoreInt64(&upstream.pool("etherscan").queued, 2)
+	if s.Admit("free", 0) || !s.Admit("/api/gas", 0.001) {
+		t.Error("a full upstream queue did not shed only free requests")
+	}
+}
+
+func TestWithLoadShedding(t *testing.T) {
+	s := NewLoadShedder(2, 0.5, nil)
+	s.Register("/api/gas", 0.001)
+	served := 0
+	handler := withLoadShedding(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+
+	// One request already in flight, so each test request reaches 1
+	atomic.StoreInt64(&s.inflight, 1)
+	for path, want := range map[string]int{
+		"/.well-known/x402": http.StatusServiceUnavailable,
+		"/health":           http.StatusOK,
+		"/admin/ledger":     http.StatusOK,
+		"/api/gas":          http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != want {
+			t.Errorf("%s = %d, want %d", path, rec.Code, want)
+		}
+		if want == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s shed without Retry-After", path)
+		}
+	}
+	if served != 3 || atomic.LoadInt64(&s.inflight) != 1 {
+		t.Errorf("served %d, %d left in flight", served, atomic.LoadInt64(&s.inflight))
+	}
+}
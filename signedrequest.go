@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+)
+
+// requestBinding is what a paid request's payment must match: its method
+// and path, the hash of its body and, for signed requests, the address that
+// signed it
+type requestBinding struct {
+	method   string
+	path     string
+	bodyHash string // empty if the body is too large to bind
+	signer   string
+}
+
+// parseSignedRequests reads SIGNED_REQUESTS, a comma-separated list of
+// endpoints such as /api/scan-contract
+func parseSignedRequests(s string) []string {
+	endpoints := []string{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints
+}
+
+// bindRequest hashes r's body, leaving it for the handler, and recovers the
+// signer of its X-Request-Signature. When required, unsigned requests are
+// refused.
+func bindRequest(r *http.Request, required bool) (*requestBinding, error) {
+	body, err := peekBody(r)
+	if err != nil {
+		return nil, err
+	}
+	b := &requestBinding{method: r.Method, path: r.URL.Path}
+	if len(body) <= maxRequestBytes {
+		b.bodyHash = reqsig.BodyHash(body)
+	}
+
+	signature := r.Header.Get(reqsig.Header)
+	switch {
+	case signature == "" && required:
+		return nil, errors.New("this endpoint requires a signed request in " + reqsig.Header)
+	case signature == "":
+		return b, nil
+	case b.bodyHash == "":
+		return nil, errors.New("body too large to sign")
+	}
+	signer, err := reqsig.Recover(signature, r.Method, r.URL.RequestURI(), body)
+	if err != nil {
+		return nil, err
+	}
+	b.signer = signer
+	return b, nil
+}
+
+// peekBody reads up to one byte past maxRequestBytes of the request body
+// and puts it back for the handler
+func peekBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	return body, nil
+}
+
+// check matches a payment's claims to the request: a bodyHash claim must be
+// the hash of this body, and a signed request must be signed by the payer
+// the token names. A nil binding, for transports without a request body,
+// refuses tokens bound to one.
+func (b *requestBinding) check(claims *PaymentToken) error {
+	bound := strings.ToLower(claims.Payment.BodyHash)
+	if b == nil {
+		if bound != "" {
+			return errors.New("payment is bound to a request body")
+		}
+		return nil
+	}
+	if bound != "" && bound != b.bodyHash {
+		return errors.New("payment is bound to a different request body")
+	}
+	if sub := strings.TrimSpace(claims.Subject); b.signer != "" && sub != "" && !strings.EqualFold(sub, b.signer) {
+		return fmt.Errorf("request signed by %s, not the payer", b.signer)
+	}
+	return nil
+}
+
+// signerAddress returns the address that signed the request, if it was
+// signed
+func (b *requestBinding) signerAddress() string {
+	if b == nil {
+		return ""
+	}
+	return b.signer
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+)
+
+// signedCall makes a paid request for path. The payment names the signing
+// key's address, is bound to boundBody if set, and the request is signed
+// over signedBody if set, then sent with body.
+func signedCall(t *testing.T, srv *httptest.Server, path, body, boundBody, signedBody string) *http.Response {
+	t.Helper()
+	key, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+
+	challenge, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer challenge.Body.Close()
+	var quoted struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(challenge.Body).Decode(&quoted)
+	claims := PaymentToken{}
+	claims.Payment.Amount = quoted.Payment.MaxAmount
+	claims.Payment.Asset = quoted.Payment.Asset
+	claims.Payment.Receiver = quoted.Payment.Receiver
+	claims.Payment.Network = quoted.Payment.Network
+	claims.Payment.Nonce = quoted.Payment.Nonce
+	claims.Subject = ethsig.Address(key)
+	if boundBody != "" {
+		claims.Payment.BodyHash = reqsig.BodyHash([]byte(boundBody))
+	}
+	token := signPayment(t, claims)
+
+	req, _ := http.NewRequest("POST", srv.URL+path, strings.NewReader(body))
+	req.Header.Set("X-Payment-Response", token)
+	if signedBody != "" {
+		sig, err := ethsig.Sign(ethsig.PersonalHash(reqsig.Message("POST", path, reqsig.BodyHash([]byte(signedBody)))), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(reqsig.Header, "0x"+hex.EncodeToString(sig))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestE2ESignedRequests(t *testing.T) {
+	srv, _ := startService(t, map[string]string{
+		"PROVIDERS":       "mock",
+		"SIGNED_REQUESTS": "/api/scan-contract",
+	})
+	const path = "/api/scan-contract"
+	body := `{"address":"0x1111111111111111111111111111111111111111","chain":"base"}`
+	swapped := `{"address":"0x2222222222222222222222222222222222222222","chain":"base"}`
+
+	resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var quoted struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(resp.Body).Decode(&quoted)
+	resp.Body.Close()
+	if quoted.Payment.RequestSignature != "required" {
+		t.Errorf("challenge requestSignature = %q, want required", quoted.Payment.RequestSignature)
+	}
+
+	cases := []struct {
+		name                string
+		body, bound, signed string
+		want                int
+	}{
+		{"unsigned", body, body, "", http.StatusBadRequest},
+		{"signed and bound", body, body, body, http.StatusOK},
+		{"body swapped after signing", swapped, body, body, http.StatusPaymentRequired},
+		{"re-signed swapped body", swapped, body, swapped, http.StatusPaymentRequired},
+	}
+	for _, tc := range cases {
+		resp := signedCall(t, srv, path, tc.body, tc.bound, tc.signed)
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+
+	entries := ledgerEntries(t, srv)
+	key, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+	if len(entries) != 1 || entries[0].Payer != ethsig.Address(key) {
+		t.Errorf("ledger = %+v, want one entry paid by the signer", entries)
+	}
+}
+
+func TestRequestBindingCheck(t *testing.T) {
+	claims := &PaymentToken{}
+	claims.Payment.BodyHash = reqsig.BodyHash([]byte("{}"))
+
+	var unbound *requestBinding
+	if unbound.check(claims) == nil {
+		t.Error("a transport without a body accepted a body-bound payment")
+	}
+	b := &requestBinding{bodyHash: reqsig.BodyHash([]byte("{}")), signer: "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266"}
+	claims.Subject = "0xF39FD6E51AAD88F6F4CE6AB8827279CFFFB92266"
+	if err := b.check(claims); err != nil {
+		t.Errorf("matching request rejected: %v", err)
+	}
+	claims.Subject = "0xabc0000000000000000000000000000000000001"
+	if b.check(claims) == nil {
+		t.Error("request signed by someone other than the payer accepted")
+	}
+}
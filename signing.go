@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/respsig"
+)
+
+// ResponseSigner adds a detached Ed25519 signature to paid responses so
+// downstream agents can prove what the service returned (see pkg/respsig)
+type ResponseSigner struct {
+	key   ed25519.PrivateKey
+	clock clock.Clock
+}
+
+// NewResponseSigner creates a signer for key
+func NewResponseSigner(key ed25519.PrivateKey) *ResponseSigner {
+	return &ResponseSigner{key: key, clock: clock.System}
+}
+
+// responseSigner is nil unless RESPONSE_SIGNING_KEY is set
+var responseSigner *ResponseSigner
+
+// sign sets the signature headers for a paid response. Content-Type must
+// already be set. Unpaid responses and a nil signer are left unsigned.
+func (s *ResponseSigner) sign(w http.ResponseWriter, r *http.Request, body []byte) {
+	if s == nil {
+		return
+	}
+	if _, paid := PayerFromContext(r.Context()); !paid {
+		return
+	}
+	if err := respsig.Sign(s.key, w.Header(), s.clock.Now(), r.Method, r.URL.RequestURI(), body); err != nil {
+		log.Printf("⚠️  Response signing failed for %s: %v", r.URL.Path, err)
+	}
+}
+
+// PublicKey returns the key third parties verify signatures with
+func (s *ResponseSigner) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// handleSigningKey serves /.well-known/response-signing (free)
+func (s *ResponseSigner) handleSigningKey(w http.ResponseWriter, r *http.Request) {
+	if s == nil {
+		http.Error(w, `{"error":"Response signing is not enabled"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alg":        respsig.Alg,
+		"key_id":     respsig.KeyID(s.PublicKey()),
+		"public_key": base64.StdEncoding.EncodeToString(s.PublicKey()),
+		"headers":    []string{respsig.HeaderSignature, respsig.HeaderTimestamp, respsig.HeaderKeyID},
+		"message":    "x402-response/v1\\n<timestamp>\\n<METHOD> <request URI>\\n<hex sha256 of canonical body>",
+	})
+}
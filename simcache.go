@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// Simulation cache outcomes, the result label of x402_simulation_cache_total
+const (
+	simCacheHit    = "hit"
+	simCacheMiss   = "miss"
+	simCacheBypass = "bypass" // the head could not be read, or lags the cached one
+)
+
+// chainHead is the latest block a node reports
+type chainHead struct {
+	number    uint64
+	stateRoot string
+}
+
+// SimulationCache caches preflight results by chain, state root and the
+// request's inputs, so identical preflights within one block are served
+// without another simulation. Everything cached for a chain is dropped as
+// soon as a newer head is seen. Only successful simulations are cached; a
+// failed gas estimate may have been an RPC error rather than a revert.
+type SimulationCache struct {
+	maxEntries int
+
+	mu            sync.Mutex
+	chains        map[string]*simCacheChain
+	counts        map[string]int64 // outcome -> lookups
+	invalidations int64
+}
+
+// simCacheChain is what is cached for one chain, all at head
+type simCacheChain struct {
+	head    chainHead
+	results map[string][]byte // input hash -> JSON encoded TxPreflightResult
+}
+
+// NewSimulationCache holds up to maxEntries results per chain
+func NewSimulationCache(maxEntries int) *SimulationCache {
+	return &SimulationCache{
+		maxEntries: maxEntries,
+		chains:     make(map[string]*simCacheChain),
+		counts:     make(map[string]int64),
+	}
+}
+
+// simulationInputsKey hashes what Simulate reads from a request, with the
+// config snapshot it was checked against. Chain and policy selection are
+// applied after simulation and left out.
+func simulationInputsKey(tx *TxPreflightRequest, cfg *RuntimeConfig) string {
+	value := tx.Value
+	if v, err := units.ParseWei(tx.Value); err == nil {
+		value = v.String()
+	}
+	inputs, _ := json.Marshal([]interface{}{
+		strings.ToLower(tx.From), strings.ToLower(tx.To), value, strings.ToLower(tx.Data),
+		tx.UserOperation, strings.ToLower(tx.EntryPoint), cfg.LoadedAt,
+	})
+	sum := sha256.Sum256(inputs)
+	return hex.EncodeToString(sum[:])
+}
+
+// advance moves chain to head, dropping what was cached at an older one.
+// It reports whether head can be cached at: false if it is older than the
+// cached head, as a node behind a load balancer may be.
+func (c *SimulationCache) advance(chain string, head chainHead) (*simCacheChain, bool) {
+	cached, ok := c.chains[chain]
+	switch {
+	case !ok:
+		cached = &simCacheChain{head: head, results: make(map[string][]byte)}
+		c.chains[chain] = cached
+	case head.number < cached.head.number:
+		return nil, false
+	case head != cached.head:
+		c.invalidations += int64(len(cached.results))
+		cached.head = head
+		cached.results = make(map[string][]byte)
+	}
+	return cached, true
+}
+
+// Get returns a copy of the result cached for key at head
+func (c *SimulationCache) Get(chain string, head chainHead, key string) (*TxPreflightResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.advance(chain, head)
+	if !ok {
+		c.counts[simCacheBypass]++
+		return nil, false
+	}
+	data, ok := cached.results[key]
+	if !ok {
+		c.counts[simCacheMiss]++
+		return nil, false
+	}
+	var result TxPreflightResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		c.counts[simCacheMiss]++
+		return nil, false
+	}
+	c.counts[simCacheHit]++
+	return &result, true
+}
+
+// Put caches result for key at head
+func (c *SimulationCache) Put(chain string, head chainHead, key string, result *TxPreflightResult) {
+	if !result.SimulationSuccess {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.advance(chain, head)
+	if !ok || len(cached.results) >= c.maxEntries {
+		return
+	}
+	cached.results[key] = data
+}
+
+// bypass counts a lookup made without the cache
+func (c *SimulationCache) bypass() {
+	c.mu.Lock()
+	c.counts[simCacheBypass]++
+	c.mu.Unlock()
+}
+
+// SetCache reuses simulation results through cache
+func (s *TxSimulator) SetCache(cache *SimulationCache) {
+	s.cache = cache
+}
+
+// Simulate simulates a transaction and returns risk assessment. With a
+// cache set, a result for the same inputs at the latest head is reused.
+func (s *TxSimulator) Simulate(tx *TxPreflightRequest) (*TxPreflightResult, error) {
+	s = s.forChain(tx.Chain)
+	if s.cache == nil {
+		return s.simulate(tx)
+	}
+	head, err := latestHead(s.rpcClient)
+	if err != nil {
+		s.cache.bypass()
+		return s.simulate(tx)
+	}
+	key := simulationInputsKey(tx, runtimeConfig.Current())
+	if result, ok := s.cache.Get(s.chain, head, key); ok {
+		return result, nil
+	}
+	result, err := s.simulate(tx)
+	if err == nil {
+		s.cache.Put(s.chain, head, key, result)
+	}
+	return result, err
+}
+
+// latestHead reads the number and state root of the latest block
+func latestHead(rpc *RPCClient) (chainHead, error) {
+	resp, err := rpc.call("eth_getBlockByNumber", []interface{}{"latest", false})
+	if err != nil {
+		return chainHead{}, err
+	}
+	if e, ok := resp["error"].(map[string]interface{}); ok {
+		return chainHead{}, fmt.Errorf("eth_getBlockByNumber: %v", e["message"])
+	}
+	block, _ := resp["result"].(map[string]interface{})
+	numberHex, _ := block["number"].(string)
+	root, _ := block["stateRoot"].(string)
+	number, err := strconv.ParseUint(strings.TrimPrefix(numberHex, "0x"), 16, 64)
+	if err != nil || root == "" {
+		return chainHead{}, fmt.Errorf("eth_getBlockByNumber: no block number or state root")
+	}
+	return chainHead{number: number, stateRoot: strings.ToLower(root)}, nil
+}
+
+// WriteMetrics emits cache lookups by outcome, invalidated entries and the
+// entries held
+func (c *SimulationCache) WriteMetrics(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b.WriteString("# HELP x402_simulation_cache_total Preflight simulation cache lookups, by result\n")
+	b.WriteString("# TYPE x402_simulation_cache_total counter\n")
+	for _, outcome := range []string{simCacheHit, simCacheMiss, simCacheBypass} {
+		fmt.Fprintf(b, "x402_simulation_cache_total{result=%q} %d\n", outcome, c.counts[outcome])
+	}
+	b.WriteString("# HELP x402_simulation_cache_invalidations_total Cached simulations dropped because a new head arrived\n")
+	b.WriteString("# TYPE x402_simulation_cache_invalidations_total counter\n")
+	fmt.Fprintf(b, "x402_simulation_cache_invalidations_total %d\n", c.invalidations)
+	b.WriteString("# HELP x402_simulation_cache_entries Cached simulations, by chain\n")
+	b.WriteString("# TYPE x402_simulation_cache_entries gauge\n")
+	for _, chain := range sortedKeys(c.chains) {
+		fmt.Fprintf(b, "x402_simulation_cache_entries{chain=%q} %d\n", chain, len(c.chains[chain].results))
+	}
+}
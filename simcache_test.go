@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestSimulationCache(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+
+	head := func(number, root string) {
+		up.SetRPCResult("eth_getBlockByNumber", map[string]interface{}{"number": number, "stateRoot": root})
+	}
+	head("0x10", "0xaaaa")
+	cache := NewSimulationCache(100)
+	simulator := NewTxSimulator(up.RPC.URL)
+	simulator.SetCache(cache)
+	tx := &TxPreflightRequest{To: watchedRouter, Value: "0x0"}
+
+	first, err := simulator.Simulate(tx)
+	if err != nil || !first.SimulationSuccess {
+		t.Fatalf("Simulate = %+v, %v", first, err)
+	}
+	before := up.Hits(testhttp.RPC)
+	up.SetRPCResult("eth_estimateGas", "0x5300")
+	again, _ := simulator.Simulate(&TxPreflightRequest{To: "0x" + strings.ToUpper(watchedRouter[2:]), Value: "0"})
+	if up.Hits(testhttp.RPC) != before+1 || again.GasEstimate != first.GasEstimate {
+		t.Errorf("same inputs in the same block made %d RPC calls, gas estimate %s", up.Hits(testhttp.RPC)-before, again.GasEstimate)
+	}
+	again.Warnings = append(again.Warnings, "changed by the caller")
+	if cached, _ := simulator.Simulate(tx); len(cached.Warnings) != len(first.Warnings) {
+		t.Error("a caller's change leaked into the cache")
+	}
+
+	// A new head drops the cached result
+	head("0x11", "0xbbbb")
+	fresh, _ := simulator.Simulate(tx)
+	if fresh.GasEstimate == first.GasEstimate {
+		t.Errorf("new head served the cached gas estimate %s", fresh.GasEstimate)
+	}
+	// A node lagging behind is not cached at
+	head("0x10", "0xaaaa")
+	simulator.Simulate(tx)
+
+	var b strings.Builder
+	cache.WriteMetrics(&b)
+	for _, want := range []string{
+		`x402_simulation_cache_total{result="hit"} 2`,
+		`x402_simulation_cache_total{result="miss"} 2`,
+		`x402_simulation_cache_total{result="bypass"} 1`,
+		"x402_simulation_cache_invalidations_total 1",
+		`x402_simulation_cache_entries{chain="ethereum"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SLOWatch checks each endpoint's share of 5xx responses once per window
+// and notifies when it rises above the target or falls back under it.
+// Each replica watches its own traffic.
+type SLOWatch struct {
+	metrics     *Metrics
+	notifier    *Notifier
+	target      float64 // highest acceptable share of 5xx responses
+	minRequests int64   // windows with less traffic are not judged
+	window      time.Duration
+
+	last     map[string][2]int64 // endpoint -> requests and errors at the last check
+	breached map[string]bool
+}
+
+// NewSLOWatch creates a watch over metrics. Call Check once per window.
+func NewSLOWatch(metrics *Metrics, notifier *Notifier, target float64, minRequests int64, window time.Duration) *SLOWatch {
+	return &SLOWatch{
+		metrics:     metrics,
+		notifier:    notifier,
+		target:      target,
+		minRequests: minRequests,
+		window:      window,
+		last:        make(map[string][2]int64),
+		breached:    make(map[string]bool),
+	}
+}
+
+// Check compares the traffic since the last check with the target
+func (s *SLOWatch) Check() {
+	counts := s.metrics.RequestCounts()
+	endpoints := make([]string, 0, len(counts))
+	for endpoint := range counts {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	for _, endpoint := range endpoints {
+		now := counts[endpoint]
+		requests, errors := now[0]-s.last[endpoint][0], now[1]-s.last[endpoint][1]
+		s.last[endpoint] = now
+		if requests < s.minRequests {
+			continue
+		}
+		rate := float64(errors) / float64(requests)
+		breached := rate > s.target
+		if breached == s.breached[endpoint] {
+			continue
+		}
+		s.breached[endpoint] = breached
+
+		message := fmt.Sprintf("SLO breach on %s: %.1f%% of %d requests failed in the last %s (target %.1f%%)", endpoint, rate*100, requests, s.window, s.target*100)
+		status := "breached"
+		if !breached {
+			message = fmt.Sprintf("%s is back within its SLO: %.1f%% of %d requests failed in the last %s", endpoint, rate*100, requests, s.window)
+			status = "recovered"
+		}
+		log.Printf("📉 %s", message)
+		s.notifier.Notify(NotifySLO, map[string]string{
+			"endpoint":   endpoint,
+			"status":     status,
+			"error_rate": fmt.Sprintf("%.1f", rate*100),
+			"requests":   fmt.Sprint(requests),
+			"target":     fmt.Sprintf("%.1f", s.target*100),
+			"window":     s.window.String(),
+			"message":    message,
+		})
+	}
+}
+
+// RequestCounts returns each endpoint's total requests and 5xx responses
+func (m *Metrics) RequestCounts() map[string][2]int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string][2]int64, len(m.requestsTotal))
+	for endpoint, total := range m.requestsTotal {
+		var errors int64
+		for status, count := range m.requestsByStatus[endpoint] {
+			if strings.HasPrefix(status, "5") {
+				errors += count
+			}
+		}
+		out[endpoint] = [2]int64{total, errors}
+	}
+	return out
+}
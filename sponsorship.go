@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// GasSponsorshipRequest asks whether a user operation can be sponsored
+type GasSponsorshipRequest struct {
+	UserOperation UserOperation          `json:"user_operation"`
+	EntryPoint    string                 `json:"entry_point,omitempty"` // defaults to the bundler's first
+	Context       map[string]interface{} `json:"context,omitempty"`     // paymaster policy context, e.g. a sponsorship policy ID
+}
+
+// GasSponsorshipResult reports whether a paymaster route exists and what
+// it would cost the sponsor at most
+type GasSponsorshipResult struct {
+	Available        bool              `json:"available"`
+	Reason           string            `json:"reason,omitempty"`
+	ChainID          int64             `json:"chain_id"`
+	EntryPoint       string            `json:"entry_point"`
+	Paymaster        string            `json:"paymaster,omitempty"`
+	PaymasterData    string            `json:"paymaster_data,omitempty"`
+	Sponsor          string            `json:"sponsor,omitempty"`
+	Gas              *UserOperationGas `json:"gas,omitempty"`
+	MaxFeePerGasGwei float64           `json:"max_fee_per_gas_gwei,omitempty"`
+	EstimatedCostWei string            `json:"estimated_cost_wei,omitempty"`
+	EstimatedCostETH float64           `json:"estimated_cost_eth,omitempty"`
+	EstimatedCostUSD float64           `json:"estimated_cost_usd,omitempty"`
+	CheckedAt        int64             `json:"checked_at"`
+}
+
+// errSponsorshipDisabled is returned when no bundler is configured
+var errSponsorshipDisabled = errors.New("gas sponsorship is not configured")
+
+// jsonRPCError is an error answered by a JSON-RPC server, as opposed to a
+// failure to reach it. For a bundler or paymaster it is a verdict on the
+// user operation.
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *jsonRPCError) Error() string { return fmt.Sprintf("%s (code %d)", e.Message, e.Code) }
+
+// jsonRPC calls method on url and decodes the result into out
+func jsonRPC(url, method string, params []interface{}, out interface{}) error {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	resp, err := upstreamHTTP.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+		Error  *jsonRPCError   `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%s: HTTP %d: %w", method, resp.StatusCode, err)
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if err := json.Unmarshal(result.Result, out); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	return nil
+}
+
+// GasSponsor quotes ERC-4337 gas sponsorship through a bundler and an
+// ERC-7677 paymaster service. Many providers serve both on one URL, so the
+// paymaster defaults to the bundler.
+type GasSponsor struct {
+	bundlerURL   string
+	paymasterURL string
+}
+
+// NewGasSponsor returns a sponsor for bundlerURL and paymasterURL. An empty
+// bundlerURL disables it.
+func NewGasSponsor(bundlerURL, paymasterURL string) *GasSponsor {
+	if paymasterURL == "" {
+		paymasterURL = bundlerURL
+	}
+	return &GasSponsor{bundlerURL: bundlerURL, paymasterURL: paymasterURL}
+}
+
+// Quote asks the paymaster to sponsor op and the bundler to estimate its
+// gas. A paymaster or bundler rejecting op is an answer, reported as
+// unavailable with the reason; only failing to reach them is an error.
+func (s *GasSponsor) Quote(req GasSponsorshipRequest) (*GasSponsorshipResult, error) {
+	if s.bundlerURL == "" {
+		return nil, errSponsorshipDisabled
+	}
+	op := req.UserOperation
+	fillUserOperation(&op)
+	result := &GasSponsorshipResult{CheckedAt: time.Now().Unix()}
+
+	var entryPoints []string
+	if err := jsonRPC(s.bundlerURL, "eth_supportedEntryPoints", []interface{}{}, &entryPoints); err != nil {
+		return nil, fmt.Errorf("bundler: %w", err)
+	}
+	result.EntryPoint = req.EntryPoint
+	if result.EntryPoint == "" && len(entryPoints) > 0 {
+		result.EntryPoint = entryPoints[0]
+	}
+	var chainID string
+	if err := jsonRPC(s.bundlerURL, "eth_chainId", []interface{}{}, &chainID); err != nil {
+		return nil, fmt.Errorf("bundler: %w", err)
+	}
+	if id, err := units.ParseHex(chainID); err == nil && id.IsInt64() {
+		result.ChainID = id.Int64()
+	}
+	if !containsFold(entryPoints, result.EntryPoint) {
+		result.Reason = fmt.Sprintf("bundler does not support entry point %s", result.EntryPoint)
+		return result, nil
+	}
+
+	var stub struct {
+		Paymaster                     string `json:"paymaster"`
+		PaymasterData                 string `json:"paymasterData"`
+		PaymasterVerificationGasLimit string `json:"paymasterVerificationGasLimit"`
+		PaymasterPostOpGasLimit       string `json:"paymasterPostOpGasLimit"`
+		Sponsor                       *struct {
+			Name string `json:"name"`
+		} `json:"sponsor"`
+	}
+	err := jsonRPC(s.paymasterURL, "pm_getPaymasterStubData", []interface{}{op, result.EntryPoint, chainID, req.Context}, &stub)
+	var rpcErr *jsonRPCError
+	if errors.As(err, &rpcErr) {
+		result.Reason = "paymaster declined: " + rpcErr.Message
+		return result, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("paymaster: %w", err)
+	}
+	if stub.Paymaster == "" {
+		result.Reason = "paymaster returned no sponsorship"
+		return result, nil
+	}
+	op.Paymaster, op.PaymasterData = stub.Paymaster, stub.PaymasterData
+	op.PaymasterVerificationGasLimit, op.PaymasterPostOpGasLimit = stub.PaymasterVerificationGasLimit, stub.PaymasterPostOpGasLimit
+	result.Paymaster, result.PaymasterData = stub.Paymaster, stub.PaymasterData
+	if stub.Sponsor != nil {
+		result.Sponsor = stub.Sponsor.Name
+	}
+
+	gas, err := estimateUserOperationGas(s.bundlerURL, op, result.EntryPoint)
+	if errors.As(err, &rpcErr) {
+		result.Reason = "bundler rejected the operation: " + rpcErr.Message
+		return result, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("bundler: %w", err)
+	}
+	result.Gas = gas
+	result.Available = true
+
+	// Cost at the operation's max fee, or the bundler node's gas price
+	maxFee, _ := units.ParseWei(op.MaxFeePerGas)
+	if maxFee == nil || maxFee.Sign() == 0 {
+		var gasPrice string
+		if err := jsonRPC(s.bundlerURL, "eth_gasPrice", []interface{}{}, &gasPrice); err == nil {
+			maxFee, _ = units.ParseHex(gasPrice)
+		}
+	}
+	if maxFee == nil || maxFee.Sign() == 0 {
+		result.Reason = "no gas price available to estimate the cost"
+		return result, nil
+	}
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(gas.Total), maxFee)
+	result.MaxFeePerGasGwei = round(units.ToGwei(maxFee), 4)
+	result.EstimatedCostWei = cost.String()
+	result.EstimatedCostETH = units.ToEther(cost)
+	if price, err := providers.Price.ETHPrice(); err == nil {
+		result.EstimatedCostUSD = round(result.EstimatedCostETH*price.Eth, 6)
+	}
+	return result, nil
+}
+
+// estimateUserOperationGas asks a bundler for op's gas limits. The
+// paymaster limits already in op stand unless the bundler revises them.
+func estimateUserOperationGas(bundlerURL string, op UserOperation, entryPoint string) (*UserOperationGas, error) {
+	estimate := map[string]string{
+		"paymasterVerificationGasLimit": op.PaymasterVerificationGasLimit,
+		"paymasterPostOpGasLimit":       op.PaymasterPostOpGasLimit,
+	}
+	if err := jsonRPC(bundlerURL, "eth_estimateUserOperationGas", []interface{}{op, entryPoint}, &estimate); err != nil {
+		return nil, err
+	}
+	gas := &UserOperationGas{
+		PreVerificationGas:            hexUint64(estimate["preVerificationGas"]),
+		VerificationGasLimit:          hexUint64(estimate["verificationGasLimit"]),
+		CallGasLimit:                  hexUint64(estimate["callGasLimit"]),
+		PaymasterVerificationGasLimit: hexUint64(estimate["paymasterVerificationGasLimit"]),
+		PaymasterPostOpGasLimit:       hexUint64(estimate["paymasterPostOpGasLimit"]),
+	}
+	gas.Total = gas.PreVerificationGas + gas.VerificationGasLimit + gas.CallGasLimit + gas.PaymasterVerificationGasLimit + gas.PaymasterPostOpGasLimit
+	return gas, nil
+}
+
+// fillUserOperation sets the fields bundlers require for estimation but
+// a caller may leave out
+func fillUserOperation(op *UserOperation) {
+	for _, field := range []*string{&op.Nonce, &op.CallGasLimit, &op.VerificationGasLimit, &op.PreVerificationGas, &op.MaxFeePerGas, &op.MaxPriorityFeePerGas} {
+		if *field == "" {
+			*field = "0x0"
+		}
+	}
+	if op.CallData == "" {
+		op.CallData = "0x"
+	}
+	if op.Signature == "" {
+		op.Signature = "0x"
+	}
+}
+
+func hexUint64(s string) uint64 {
+	v, err := units.ParseHex(s)
+	if err != nil || !v.IsUint64() {
+		return 0
+	}
+	return v.Uint64()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleGasSponsorship quotes sponsorship for a user operation. The payment
+// is not captured when sponsorship is unconfigured or its upstreams are
+// unreachable.
+func (s *GasSponsor) handleGasSponsorship(w http.ResponseWriter, r *http.Request) {
+	var req GasSponsorshipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Gas sponsorship decode error (payer=%s): %v", payerLabel(r), err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !isValidAddress(req.UserOperation.Sender) {
+		chargeFromContext(r.Context()).refuse()
+		http.Error(w, `{"error":"user_operation.sender must be an address, payment not captured"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.Quote(req)
+	if errors.Is(err, errSponsorshipDisabled) {
+		chargeFromContext(r.Context()).refuse()
+		http.Error(w, `{"error":"Gas sponsorship is not configured, payment not captured"}`, http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  Gas sponsorship quote failed (payer=%s): %v", payerLabel(r), err)
+		chargeFromContext(r.Context()).refuse()
+		http.Error(w, `{"error":"Bundler or paymaster unavailable, payment not captured"}`, http.StatusBadGateway)
+		return
+	}
+	writePaidData(w, r, result)
+}
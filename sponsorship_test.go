@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestGasSponsorQuote(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+
+	// The fake RPC node serves as both bundler and paymaster
+	up.SetRPCResult("eth_supportedEntryPoints", []string{entryPointV07})
+	up.SetRPCResult("eth_chainId", "0x2105")
+	up.SetETHPrice(2000)
+	sponsor := NewGasSponsor(up.RPC.URL, "")
+	req := GasSponsorshipRequest{UserOperation: UserOperation{
+		Sender:       "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91",
+		CallData:     "0x",
+		MaxFeePerGas: "0x3b9aca00", // 1 gwei
+	}}
+
+	// No pm_getPaymasterStubData: the paymaster declines
+	result, err := sponsor.Quote(req)
+	if err != nil || result.Available || !strings.HasPrefix(result.Reason, "paymaster declined") || result.ChainID != 8453 || result.EntryPoint != entryPointV07 {
+		t.Fatalf("declined = %+v, %v", result, err)
+	}
+
+	up.SetRPCResult("pm_getPaymasterStubData", map[string]interface{}{
+		"paymaster":                     "0x00000000000000000000000000000000000000aa",
+		"paymasterData":                 "0x01",
+		"paymasterVerificationGasLimit": "0x7530", // 30000
+		"paymasterPostOpGasLimit":       "0x2710", // 10000
+		"sponsor":                       map[string]string{"name": "Test Sponsor"},
+	})
+	up.SetRPCResult("eth_estimateUserOperationGas", map[string]string{
+		"preVerificationGas":   "0xc350",  // 50000
+		"verificationGasLimit": "0x186a0", // 100000
+		"callGasLimit":         "0x13880", // 80000
+	})
+	result, err = sponsor.Quote(req)
+	if err != nil || !result.Available || result.Sponsor != "Test Sponsor" || result.Paymaster == "" {
+		t.Fatalf("sponsored = %+v, %v", result, err)
+	}
+	if result.Gas.Total != 270000 || result.Gas.PaymasterVerificationGasLimit != 30000 {
+		t.Errorf("gas = %+v", result.Gas)
+	}
+	if result.EstimatedCostWei != "270000000000000" || result.EstimatedCostUSD != 0.54 {
+		t.Errorf("cost = %s wei, $%v", result.EstimatedCostWei, result.EstimatedCostUSD)
+	}
+
+	req.EntryPoint = "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"
+	if result, err := sponsor.Quote(req); err != nil || result.Available || !strings.Contains(result.Reason, "entry point") {
+		t.Errorf("unsupported entry point = %+v, %v", result, err)
+	}
+
+	up.Fail(testhttp.RPC, true)
+	if _, err := sponsor.Quote(req); err == nil {
+		t.Error("no error with the bundler down")
+	}
+}
+
+func TestGasSponsorshipNotCaptured(t *testing.T) {
+	handler := NewGasSponsor("", "").handleGasSponsorship
+	c := &charge{fraction: 1}
+	req := httptest.NewRequest("POST", "/api/gas-sponsorship", strings.NewReader(`{"user_operation": {"sender": "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}}`))
+	rr := httptest.NewRecorder()
+	handler(rr, req.WithContext(withCharge(req.Context(), c)))
+	if _, captured := c.captured(); rr.Code != http.StatusServiceUnavailable || captured {
+		t.Errorf("unconfigured: %d, captured=%v", rr.Code, captured)
+	}
+}
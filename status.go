@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+// statusHistoryHours is how far back the status page looks
+const statusHistoryHours = 7 * 24
+
+// statusCacheTTL is how long a rendered status page is served
+const statusCacheTTL = time.Minute
+
+// Overall service states on the status page
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusOutage      = "partial_outage"
+)
+
+// Availability below these shares in the current hour degrades the page
+const (
+	statusDegradedBelow = 99.0
+	statusOutageBelow   = 95.0
+)
+
+// StatusPage is the public summary served at /status
+type StatusPage struct {
+	Status      string           `json:"status"`
+	GeneratedAt int64            `json:"generated_at"`
+	Since       int64            `json:"since"` // start of the recorded history
+	Endpoints   []EndpointStatus `json:"endpoints"`
+	Upstreams   []UpstreamStatus `json:"upstreams"`
+}
+
+// EndpointStatus is the share of an endpoint's requests that did not fail
+// with a 5xx. Availability is null when there were no requests.
+type EndpointStatus struct {
+	Endpoint        string   `json:"endpoint"`
+	Availability24h *float64 `json:"availability_24h"`
+	Availability7d  *float64 `json:"availability_7d"`
+	Requests24h     int64    `json:"requests_24h"`
+	Requests7d      int64    `json:"requests_7d"`
+}
+
+// UpstreamStatus is an upstream provider's current state and the share of
+// requests to it that succeeded
+type UpstreamStatus struct {
+	Provider        string   `json:"provider"`
+	Status          string   `json:"status"` // ok, degraded or down
+	Availability24h *float64 `json:"availability_24h"`
+	Availability7d  *float64 `json:"availability_7d"`
+}
+
+// hourlyCounts is a ring of request and failure counts per hour
+type hourlyCounts [statusHistoryHours]struct {
+	hour          int64 // hours since the epoch
+	total, failed int64
+}
+
+func (h *hourlyCounts) add(hour, total, failed int64) {
+	slot := &h[hour%statusHistoryHours]
+	if slot.hour != hour {
+		slot.hour, slot.total, slot.failed = hour, 0, 0
+	}
+	slot.total += total
+	slot.failed += failed
+}
+
+// sum adds up the hours after since, up to and including now
+func (h *hourlyCounts) sum(since, now int64) (total, failed int64) {
+	for _, slot := range h {
+		if slot.hour > since && slot.hour <= now {
+			total += slot.total
+			failed += slot.failed
+		}
+	}
+	return total, failed
+}
+
+// StatusHistory records hourly request and failure counts per endpoint and
+// upstream provider, sampled from the cumulative metrics. History is kept
+// in memory, so each replica reports what it served since it started.
+type StatusHistory struct {
+	metrics   *Metrics
+	upstreams *UpstreamLimiter
+	clock     clock.Clock
+	started   time.Time
+
+	mu        sync.Mutex
+	last      map[string][2]int64 // "endpoint:" or "upstream:" name -> counters at the last sample
+	endpoints map[string]*hourlyCounts
+	providers map[string]*hourlyCounts
+	page      *StatusPage
+	pageAt    time.Time
+}
+
+// NewStatusHistory starts recording from the current counters
+func NewStatusHistory(metrics *Metrics, upstreams *UpstreamLimiter) *StatusHistory {
+	h := &StatusHistory{
+		metrics:   metrics,
+		upstreams: upstreams,
+		clock:     clock.System,
+		last:      make(map[string][2]int64),
+		endpoints: make(map[string]*hourlyCounts),
+		providers: make(map[string]*hourlyCounts),
+	}
+	h.started = h.clock.Now()
+	return h
+}
+
+// statusEndpoint reports whether an endpoint is listed on the status page
+func statusEndpoint(endpoint string) bool {
+	return (strings.HasPrefix(endpoint, "/api/") || endpoint == "/graphql") && !strings.HasPrefix(endpoint, "/api/jobs")
+}
+
+// Sample adds the requests since the last sample to the current hour
+func (h *StatusHistory) Sample() {
+	hour := h.clock.Now().Unix() / 3600
+	requests := h.metrics.RequestCounts()
+	health := h.upstreams.Health()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for endpoint, counts := range requests {
+		if statusEndpoint(endpoint) {
+			h.record(h.endpoints, "endpoint:"+endpoint, endpoint, hour, counts)
+		}
+	}
+	for _, u := range health {
+		h.record(h.providers, "upstream:"+u.Provider, u.Provider, hour, [2]int64{u.Requests, u.Failures})
+	}
+}
+
+func (h *StatusHistory) record(into map[string]*hourlyCounts, key, name string, hour int64, counts [2]int64) {
+	last := h.last[key]
+	h.last[key] = counts
+	if into[name] == nil {
+		into[name] = &hourlyCounts{}
+	}
+	into[name].add(hour, counts[0]-last[0], counts[1]-last[1])
+}
+
+// Page returns the status page, rebuilt at most once per statusCacheTTL
+func (h *StatusHistory) Page() StatusPage {
+	now := h.clock.Now()
+	h.mu.Lock()
+	if h.page != nil && now.Sub(h.pageAt) < statusCacheTTL {
+		page := *h.page
+		h.mu.Unlock()
+		return page
+	}
+	h.mu.Unlock()
+
+	h.Sample()
+	health := h.upstreams.Health()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hour := now.Unix() / 3600
+	page := StatusPage{
+		Status:      StatusOperational,
+		GeneratedAt: now.Unix(),
+		Since:       h.started.Unix(),
+		Endpoints:   []EndpointStatus{},
+		Upstreams:   []UpstreamStatus{},
+	}
+	worsen := func(status string) {
+		if status == StatusOutage || page.Status == StatusOperational {
+			page.Status = status
+		}
+	}
+
+	for endpoint, counts := range h.endpoints {
+		day, dayFailed := counts.sum(hour-24, hour)
+		week, weekFailed := counts.sum(hour-statusHistoryHours, hour)
+		page.Endpoints = append(page.Endpoints, EndpointStatus{
+			Endpoint:        endpoint,
+			Availability24h: availability(day, dayFailed),
+			Availability7d:  availability(week, weekFailed),
+			Requests24h:     day,
+			Requests7d:      week,
+		})
+		if recent := availability(counts.sum(hour-1, hour)); recent != nil {
+			switch {
+			case *recent < statusOutageBelow:
+				worsen(StatusOutage)
+			case *recent < statusDegradedBelow:
+				worsen(StatusDegraded)
+			}
+		}
+	}
+	sort.Slice(page.Endpoints, func(i, j int) bool { return page.Endpoints[i].Endpoint < page.Endpoints[j].Endpoint })
+
+	for _, u := range health {
+		counts := h.providers[u.Provider]
+		if counts == nil {
+			continue
+		}
+		page.Upstreams = append(page.Upstreams, UpstreamStatus{
+			Provider:        u.Provider,
+			Status:          u.Status,
+			Availability24h: availability(counts.sum(hour-24, hour)),
+			Availability7d:  availability(counts.sum(hour-statusHistoryHours, hour)),
+		})
+		switch u.Status {
+		case UpstreamDown:
+			worsen(StatusOutage)
+		case UpstreamDegraded:
+			worsen(StatusDegraded)
+		}
+	}
+
+	h.page, h.pageAt = &page, now
+	return page
+}
+
+// availability is the percentage of requests that did not fail, or nil
+// without requests
+func availability(total, failed int64) *float64 {
+	if total <= 0 {
+		return nil
+	}
+	pct := math.Round(float64(total-failed)/float64(total)*10000) / 100
+	return &pct
+}
+
+// handleStatus serves GET /status
+func (h *StatusHistory) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(h.Page())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+)
+
+func TestStatusPage(t *testing.T) {
+	metrics := NewMetrics()
+	upstreams := NewUpstreamLimiter(nil, 1, 0)
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 30, 0, 0, time.UTC))
+	history := NewStatusHistory(metrics, upstreams)
+	history.clock = fake
+
+	record := func(endpoint string, ok, failed int) {
+		for range ok {
+			metrics.RecordRequest(endpoint, "200")
+		}
+		for range failed {
+			metrics.RecordRequest(endpoint, "503")
+		}
+	}
+
+	// Two days ago the gas endpoint had an outage
+	record("/api/gas", 50, 50)
+	record("/health", 10, 10)
+	history.Sample()
+	fake.Advance(48 * time.Hour)
+	record("/api/gas", 100, 0)
+	upstreams.pool("etherscan").record(&http.Response{StatusCode: http.StatusOK}, nil, fake.Now())
+
+	page := history.Page()
+	if page.Status != StatusOperational || len(page.Endpoints) != 1 || len(page.Upstreams) != 1 {
+		t.Fatalf("page = %+v", page)
+	}
+	gas := page.Endpoints[0]
+	if *gas.Availability24h != 100 || *gas.Availability7d != 75 || gas.Requests24h != 100 || gas.Requests7d != 200 {
+		t.Errorf("gas = %+v", gas)
+	}
+	if u := page.Upstreams[0]; u.Provider != "etherscan" || u.Status != UpstreamOK || *u.Availability24h != 100 {
+		t.Errorf("upstream = %+v", u)
+	}
+
+	// The page is cached for a minute, then shows the current outage
+	record("/api/gas", 0, 20)
+	if cached := history.Page(); *cached.Endpoints[0].Availability24h != 100 {
+		t.Errorf("cached page = %+v", cached.Endpoints[0])
+	}
+	fake.Advance(statusCacheTTL)
+	if page := history.Page(); page.Status != StatusOutage || *page.Endpoints[0].Availability24h != 83.33 {
+		t.Errorf("outage page = %s %+v", page.Status, page.Endpoints[0])
+	}
+
+	// Requests older than a week drop out
+	fake.Advance(8 * 24 * time.Hour)
+	rr := httptest.NewRecorder()
+	history.handleStatus(rr, httptest.NewRequest("GET", "/status", nil))
+	var out StatusPage
+	json.NewDecoder(rr.Body).Decode(&out)
+	if rr.Header().Get("Cache-Control") != "public, max-age=60" || out.Endpoints[0].Availability7d != nil || out.Endpoints[0].Requests7d != 0 {
+		t.Errorf("week-old page = %+v", out.Endpoints[0])
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// SwapAnalysis is what the MEV check reads from a DEX swap's calldata
+type SwapAnalysis struct {
+	Method             string   `json:"method"`
+	ExactOutput        bool     `json:"exact_output"`
+	Amount             string   `json:"amount"`                         // exact amount in, or exact amount out
+	Limit              string   `json:"limit"`                          // minimum amount out, or maximum amount in
+	Quoted             string   `json:"quoted,omitempty"`               // router's quote for the other side
+	ImpliedSlippagePct *float64 `json:"implied_slippage_pct,omitempty"` // tolerance the limit allows against the quote
+	Deadline           int64    `json:"deadline,omitempty"`             // unix seconds; omitted for routers that take none
+}
+
+// swapLayout locates a swap method's arguments by word index. -1 means the
+// argument is the transaction value (amounts) or absent (path, deadline).
+type swapLayout struct {
+	method      string
+	exactOutput bool
+	amount      int
+	limit       int
+	path        int
+	deadline    int
+}
+
+// swapLayouts are the Uniswap V2 router swaps and the V3 single-pool swaps
+var swapLayouts = map[string]swapLayout{
+	"38ed1739": {"swapExactTokensForTokens", false, 0, 1, 2, 4},
+	"18cbafe5": {"swapExactTokensForETH", false, 0, 1, 2, 4},
+	"7ff36ab5": {"swapExactETHForTokens", false, -1, 0, 1, 3},
+	"8803dbee": {"swapTokensForExactTokens", true, 0, 1, 2, 4},
+	"4a25d94a": {"swapTokensForExactETH", true, 0, 1, 2, 4},
+	"fb3bdb41": {"swapETHForExactTokens", true, 0, -1, 1, 3},
+	// exactInputSingle takes a static struct, encoded in place
+	"414bf389": {"exactInputSingle", false, 5, 6, -1, 4},  // SwapRouter
+	"04e45aaf": {"exactInputSingle", false, 4, 5, -1, -1}, // SwapRouter02
+}
+
+// V2 router quotes
+const (
+	selectorGetAmountsOut = "d06ca61f"
+	selectorGetAmountsIn  = "1f00ca74"
+)
+
+// Swap sanity thresholds
+const (
+	maxSwapSlippagePct   = 5.0
+	longSwapDeadline     = 30 * time.Minute
+	infiniteSwapDeadline = 365 * 24 * time.Hour
+)
+
+// analyzeSwap decodes a DEX swap's amount, limit and deadline. For V2
+// routers the limit is compared with the router's own quote, fetched with
+// rpc, to find the slippage it allows. It returns nil for other calls.
+func analyzeSwap(req MEVCheckRequest, rpc *RPCClient) (*SwapAnalysis, []riskFinding) {
+	selector, args, err := decodeCalldata(req.Data)
+	if err != nil {
+		return nil, nil
+	}
+	layout, ok := swapLayouts[selector]
+	if !ok {
+		return nil, nil
+	}
+	word := func(i int) *big.Int {
+		if i < 0 {
+			v, err := units.ParseWei(req.Value)
+			if err != nil {
+				return new(big.Int)
+			}
+			return v
+		}
+		v, err := args.uint(i)
+		if err != nil {
+			return new(big.Int)
+		}
+		return v
+	}
+	amount, limit := word(layout.amount), word(layout.limit)
+	swap := &SwapAnalysis{
+		Method:      layout.method,
+		ExactOutput: layout.exactOutput,
+		Amount:      amount.String(),
+		Limit:       limit.String(),
+	}
+	var findings []riskFinding
+
+	if layout.deadline >= 0 {
+		findings = append(findings, swap.checkDeadline(word(layout.deadline), time.Now())...)
+	}
+
+	if !layout.exactOutput && limit.Sign() == 0 {
+		findings = append(findings, riskFinding{"no_slippage_protection", 40, "Swap accepts any output amount - it can be sandwiched for the full value"})
+		return swap, findings
+	}
+	if layout.path < 0 {
+		return swap, findings
+	}
+	path, err := args.addresses(layout.path)
+	if err != nil || len(path) < 2 {
+		return swap, findings
+	}
+	quoted, err := quoteV2Swap(rpc, req.To, layout.exactOutput, amount, path)
+	if err != nil || quoted.Sign() == 0 {
+		return swap, findings
+	}
+	swap.Quoted = quoted.String()
+
+	// Exact input: how far below the quote the output may fall. Exact
+	// output: how far above the quote the input may rise.
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(limit), new(big.Float).SetInt(quoted)).Float64()
+	slippage := (1 - ratio) * 100
+	if layout.exactOutput {
+		slippage = (ratio - 1) * 100
+	}
+	slippage = math.Round(slippage*100) / 100 // round() is wrong for negatives
+	swap.ImpliedSlippagePct = &slippage
+	if slippage > maxSwapSlippagePct {
+		findings = append(findings, riskFinding{"excessive_slippage", 25, fmt.Sprintf("Swap allows %.2f%% slippage - more than %.0f%% invites sandwiching", slippage, maxSwapSlippagePct)})
+	}
+	return swap, findings
+}
+
+// checkDeadline flags expired, long and effectively infinite deadlines
+func (s *SwapAnalysis) checkDeadline(deadline *big.Int, now time.Time) []riskFinding {
+	if !deadline.IsInt64() || deadline.Int64()-now.Unix() > int64(infiniteSwapDeadline.Seconds()) {
+		if deadline.IsInt64() {
+			s.Deadline = deadline.Int64()
+		}
+		return []riskFinding{{"infinite_deadline", 15, "Swap has no effective deadline - it can be held and executed later at a worse price"}}
+	}
+	s.Deadline = deadline.Int64()
+	remaining := time.Duration(s.Deadline-now.Unix()) * time.Second
+	switch {
+	case remaining < 0:
+		return []riskFinding{{"expired_deadline", 0, "Swap deadline has passed - the transaction will revert"}}
+	case remaining > longSwapDeadline:
+		return []riskFinding{{"long_deadline", 5, fmt.Sprintf("Swap deadline is %s away - pending swaps can be executed at a worse price", remaining.Round(time.Minute))}}
+	}
+	return nil
+}
+
+// recommendedSlippage is the slippage tolerance to suggest for the swap:
+// the calldata's own when it is within bounds, or 0.5% otherwise
+func (s *SwapAnalysis) recommendedSlippage() string {
+	if s.ImpliedSlippagePct != nil && *s.ImpliedSlippagePct <= maxSwapSlippagePct {
+		return strconv.FormatFloat(math.Max(*s.ImpliedSlippagePct, 0), 'f', -1, 64) + "%"
+	}
+	return "0.5%"
+}
+
+// quoteV2Swap asks a V2 router for the output of an exact input, or the
+// input needed for an exact output
+func quoteV2Swap(rpc *RPCClient, router string, exactOutput bool, amount *big.Int, path []string) (*big.Int, error) {
+	selector := selectorGetAmountsOut
+	if exactOutput {
+		selector = selectorGetAmountsIn
+	}
+	result, err := rpc.call("eth_call", []interface{}{map[string]string{"to": router, "data": encodeUintAddresses(selector, amount, path)}, "latest"})
+	if err != nil {
+		return nil, err
+	}
+	out, ok := result["result"].(string)
+	if !ok {
+		return nil, fmt.Errorf("no quote from router")
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	amounts, err := abiData(raw).uints(0)
+	if err != nil || len(amounts) == 0 {
+		return nil, fmt.Errorf("invalid quote from router")
+	}
+	if exactOutput {
+		return amounts[0], nil
+	}
+	return amounts[len(amounts)-1], nil
+}
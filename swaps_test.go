@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// v2SwapData encodes a V2 router swap taking (amount, limit, path, to,
+// deadline)
+func v2SwapData(selector string, amount, limit int64, deadline *big.Int) string {
+	path := []string{testToken, testOwner1}
+	out := calldata(selector,
+		abiWord(big.NewInt(amount)),
+		abiWord(big.NewInt(limit)),
+		abiWord(big.NewInt(5*32)), // path offset
+		abiAddress(testOwner2),
+		abiWord(deadline),
+		abiWord(big.NewInt(int64(len(path)))),
+	)
+	for _, a := range path {
+		out = append(out, abiAddress(a)...)
+	}
+	return "0x" + hex.EncodeToString(out)
+}
+
+func TestMEVCheckSwapSanity(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+	t.Setenv("ETH_RPC_URL", up.RPC.URL)
+
+	// The router quotes 1000 out for 1000 in, and 1000 in for 1000 out
+	quote := append(append(abiWord(big.NewInt(32)), abiWord(big.NewInt(2))...), append(abiWord(big.NewInt(1000)), abiWord(big.NewInt(1000))...)...)
+	up.SetRPCResult("eth_call", "0x"+hex.EncodeToString(quote))
+	soon := big.NewInt(time.Now().Add(10 * time.Minute).Unix())
+	hasFactor := func(result MEVCheckResult, factor string) bool {
+		for _, f := range result.RiskFactors {
+			if f == factor {
+				return true
+			}
+		}
+		return false
+	}
+	check := func(data string) MEVCheckResult {
+		return checkMEVRisk(MEVCheckRequest{To: testToken, Value: "0", Data: data})
+	}
+
+	result := check(v2SwapData("38ed1739", 1000, 900, soon))
+	if result.Swap == nil || *result.Swap.ImpliedSlippagePct != 10 || result.Swap.Quoted != "1000" || !hasFactor(result, "excessive_slippage") || result.SandwichRisk != "high" || result.RecommendedSlippage != "0.5%" {
+		t.Errorf("10%% slippage = %+v, swap %+v", result, result.Swap)
+	}
+
+	result = check(v2SwapData("38ed1739", 1000, 990, units.MaxUint256))
+	if !hasFactor(result, "infinite_deadline") || hasFactor(result, "excessive_slippage") || result.RecommendedSlippage != "1%" {
+		t.Errorf("infinite deadline = %+v", result)
+	}
+
+	result = check(v2SwapData("38ed1739", 1000, 0, soon))
+	if !hasFactor(result, "no_slippage_protection") || result.SandwichRisk != "high" {
+		t.Errorf("no minimum output = %+v", result)
+	}
+
+	// Exact output: the limit is the most the swap may spend
+	result = check(v2SwapData("8803dbee", 1000, 1020, soon))
+	if result.Swap == nil || !result.Swap.ExactOutput || *result.Swap.ImpliedSlippagePct != 2 || result.RecommendedSlippage != "2%" || len(result.RiskFactors) != 1 {
+		t.Errorf("exact output = %+v, swap %+v", result, result.Swap)
+	}
+
+	if result := check("0xa9059cbb"); result.Swap != nil || result.RecommendedSlippage != "" {
+		t.Errorf("transfer = %+v", result)
+	}
+
+	var swap SwapAnalysis
+	if findings := swap.checkDeadline(big.NewInt(time.Now().Add(-time.Minute).Unix()), time.Now()); len(findings) != 1 || findings[0].factor != "expired_deadline" {
+		t.Errorf("expired deadline = %+v", findings)
+	}
+	if findings := swap.checkDeadline(big.NewInt(time.Now().Add(2*time.Hour).Unix()), time.Now()); len(findings) != 1 || findings[0].factor != "long_deadline" {
+		t.Errorf("long deadline = %+v", findings)
+	}
+}
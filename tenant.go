@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+)
+
+// TenantConfig is a seller hosted on this deployment with its own receiver,
+// prices and ledger partition
+type TenantConfig struct {
+	ID         string            `json:"id"`
+	Receiver   string            `json:"receiver"`
+	Hosts      []string          `json:"hosts,omitempty"`       // e.g. "agent-a.example.com"
+	PathPrefix string            `json:"path_prefix,omitempty"` // e.g. "/t/agent-a"
+	Prices     map[string]string `json:"prices,omitempty"`      // endpoint -> USDC price override
+}
+
+// Price returns the tenant's price override for endpoint, if any
+func (t *TenantConfig) Price(endpoint string) (string, float64, bool) {
+	return lookupPrice(t.Prices, endpoint)
+}
+
+func (t *TenantConfig) validate() error {
+	if t.ID == "" || t.ID == DefaultTenant || strings.ContainsAny(t.ID, `/\. `) {
+		return fmt.Errorf("invalid tenant id %q", t.ID)
+	}
+	if err := address.Validate(t.Receiver); err != nil {
+		return fmt.Errorf("tenant %s receiver: %w", t.ID, err)
+	}
+	if len(t.Hosts) == 0 && t.PathPrefix == "" {
+		return fmt.Errorf("tenant %s needs hosts or path_prefix", t.ID)
+	}
+	if t.PathPrefix != "" && (!strings.HasPrefix(t.PathPrefix, "/") || strings.HasSuffix(t.PathPrefix, "/")) {
+		return fmt.Errorf("tenant %s path_prefix must start and not end with /", t.ID)
+	}
+	return validatePrices(t.Prices)
+}
+
+// ResolveTenant finds the tenant for a request by hostname, then by path
+// prefix. It returns the path with any tenant prefix removed.
+func (c *RuntimeConfig) ResolveTenant(host, path string) (*TenantConfig, string) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for i := range c.Tenants {
+		t := &c.Tenants[i]
+		for _, h := range t.Hosts {
+			if strings.EqualFold(h, host) {
+				return t, path
+			}
+		}
+	}
+	for i := range c.Tenants {
+		t := &c.Tenants[i]
+		if t.PathPrefix == "" {
+			continue
+		}
+		if path == t.PathPrefix {
+			return t, "/"
+		}
+		if strings.HasPrefix(path, t.PathPrefix+"/") {
+			return t, strings.TrimPrefix(path, t.PathPrefix)
+		}
+	}
+	return nil, path
+}
+
+const tenantContextKey contextKey = "x402.tenant"
+
+// TenantFromContext returns the tenant selected for the request, or nil for
+// the default seller
+func TenantFromContext(ctx context.Context) *TenantConfig {
+	t, _ := ctx.Value(tenantContextKey).(*TenantConfig)
+	return t
+}
+
+// tenantID returns the ledger partition for a request
+func tenantID(ctx context.Context) string {
+	if t := TenantFromContext(ctx); t != nil {
+		return t.ID
+	}
+	return DefaultTenant
+}
+
+// withTenant resolves the tenant for each request, strips its path prefix
+// and attaches it to the context before routing
+func withTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, path := runtimeConfig.Current().ResolveTenant(r.Host, r.URL.Path)
+		if tenant == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), tenantContextKey, tenant))
+		if path != r.URL.Path {
+			u := *r.URL
+			u.Path = path
+			u.RawPath = ""
+			r.URL = &u
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const tenantTestConfig = `{
+	"tenants": [
+		{"id": "agent-a", "receiver": "0x00000000000000000000000000000000000000a1", "hosts": ["a.example.com"], "prices": {"/api/gas": "0.002"}},
+		{"id": "agent-b", "receiver": "0x00000000000000000000000000000000000000b2", "path_prefix": "/t/agent-b"}
+	]
+}`
+
+func TestResolveTenant(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(tenantTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host, path   string
+		wantTenant   string
+		wantStripped string
+	}{
+		{"a.example.com:443", "/api/gas", "agent-a", "/api/gas"},
+		{"localhost", "/t/agent-b/api/gas", "agent-b", "/api/gas"},
+		{"localhost", "/t/agent-b", "agent-b", "/"},
+		{"localhost", "/t/agent-bx/api/gas", "", "/t/agent-bx/api/gas"},
+		{"localhost", "/api/gas", "", "/api/gas"},
+	}
+	for _, tt := range tests {
+		tenant, path := cfg.ResolveTenant(tt.host, tt.path)
+		got := ""
+		if tenant != nil {
+			got = tenant.ID
+		}
+		if got != tt.wantTenant || path != tt.wantStripped {
+			t.Errorf("ResolveTenant(%q, %q) = %q, %q; want %q, %q", tt.host, tt.path, got, path, tt.wantTenant, tt.wantStripped)
+		}
+	}
+
+	if _, err := parseRuntimeConfig([]byte(`{"tenants": [{"id": "x", "receiver": "0x1", "hosts": ["x.example.com"]}]}`)); err == nil {
+		t.Error("expected error for invalid tenant receiver")
+	}
+}
+
+func TestTenantPaymentGoesToTenantPartition(t *testing.T) {
+	cfg, err := parseRuntimeConfig([]byte(tenantTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeConfig.Current()
+	runtimeConfig.current.Store(cfg)
+	defer runtimeConfig.current.Store(previous)
+
+	ledger, err := NewLedger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServiceConfig{Asset: "USDC", Network: "base", Receiver: "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/gas", NewPaywall(config, NewMetrics(), ledger).Protect("/api/gas", "0.001", 0.001, "test", func(w http.ResponseWriter, r *http.Request) {}))
+	handler := withTenant(mux)
+
+	// Unpaid request quotes the tenant's receiver and price
+	req := httptest.NewRequest("GET", "http://a.example.com/api/gas", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var body struct {
+		Payment PaymentRequirement `json:"payment"`
+	}
+	json.NewDecoder(rr.Body).Decode(&body)
+	if body.Payment.Receiver != "0x00000000000000000000000000000000000000a1" || body.Payment.MaxAmount != "0.002" {
+		t.Errorf("402 quoted %+v", body.Payment)
+	}
+
+	claims := PaymentToken{}
+	claims.Payment.Amount = "0.002"
+	claims.Payment.Asset = "USDC"
+	claims.Payment.Receiver = "0x00000000000000000000000000000000000000a1"
+	token := signPayment(t, claims)
+
+	req = httptest.NewRequest("GET", "http://a.example.com/api/gas", nil)
+	req.Header.Set("X-Payment-Response", token)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("paid request returned %d", rr.Code)
+	}
+
+	entries := ledger.Entries("agent-a")
+	if len(entries) != 1 || entries[0].Receiver != "0x00000000000000000000000000000000000000a1" {
+		t.Errorf("agent-a partition = %+v", entries)
+	}
+	if len(ledger.Entries(DefaultTenant)) != 0 {
+		t.Error("payment leaked into the default partition")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/address"
+)
+
+// TokenState is the part of a token scan that is compared between scans
+type TokenState struct {
+	Owner        string   `json:"owner,omitempty"`        // owner(), zero address if renounced
+	TotalSupply  string   `json:"total_supply,omitempty"` // raw units
+	LiquidityUSD *float64 `json:"liquidity_usd,omitempty"`
+	BuyTaxPct    *float64 `json:"buy_tax_pct,omitempty"`
+	SellTaxPct   *float64 `json:"sell_tax_pct,omitempty"`
+}
+
+// TokenChange is one difference between two scans of a token
+type TokenChange struct {
+	Kind        string `json:"kind"`     // ownership_changed, mint, burn, liquidity_pulled, tax_changed, became_honeypot, risk_increased
+	Severity    string `json:"severity"` // info, medium or high
+	Before      string `json:"before"`
+	After       string `json:"after"`
+	Description string `json:"description"`
+}
+
+// TokenScanDiff compares a token scan with the last paid scan of the token
+type TokenScanDiff struct {
+	Address           string          `json:"address"`
+	Chain             string          `json:"chain"`
+	HasBaseline       bool            `json:"has_baseline"`
+	PreviousScannedAt int64           `json:"previous_scanned_at,omitempty"`
+	Changes           []TokenChange   `json:"changes"`
+	Alert             bool            `json:"alert"` // a high-severity change
+	Current           TokenScanResult `json:"current"`
+}
+
+// Token state selectors
+const (
+	selectorOwner       = "8da5cb5b"
+	selectorTotalSupply = "18160ddd"
+)
+
+// Change thresholds
+const (
+	liquidityPulledPct = 50.0 // drop in liquidity that counts as pulled
+	taxChangePct       = 1.0  // change in buy or sell tax worth reporting
+)
+
+// tokenSnapshotTTL is how long the last scan of a token is kept as the
+// baseline for diffs
+const tokenSnapshotTTL = 30 * 24 * time.Hour
+
+func tokenSnapshotKey(chain, addr string) string {
+	return "token-scan:" + chain + ":" + strings.ToLower(addr)
+}
+
+// saveTokenSnapshot stores a paid scan as the baseline for the next diff.
+// Snapshots live in the shared store, so every replica diffs against the
+// same scan.
+func saveTokenSnapshot(result TokenScanResult) {
+	data, _ := json.Marshal(result)
+	if err := sharedState.Set(tokenSnapshotKey(result.Chain, result.Address), string(data), tokenSnapshotTTL); err != nil {
+		log.Printf("⚠️  Storing token scan snapshot for %s failed: %v", result.Address, err)
+	}
+}
+
+// onScanCompleted keeps each token scan as the baseline for the next diff
+func onScanCompleted(_ context.Context, e Event) error {
+	if result, ok := e.Data.(ScanCompleted).Result.(TokenScanResult); ok {
+		saveTokenSnapshot(result)
+	}
+	return nil
+}
+
+// loadTokenSnapshot returns the last paid scan of a token, if any
+func loadTokenSnapshot(chain, addr string) (*TokenScanResult, error) {
+	value, ok, err := sharedState.Get(tokenSnapshotKey(chain, addr))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var result TokenScanResult
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// handleTokenScanDiff scans a token and reports what changed since its
+// last paid scan, which the new scan then replaces
+func handleTokenScanDiff(w http.ResponseWriter, r *http.Request) {
+	var req TokenScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Token scan diff decode error (payer=%s): %v", payerLabel(r), err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := address.Validate(req.Address); err != nil {
+		http.Error(w, "Invalid address: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Chain == "" {
+		req.Chain = "base"
+	}
+	if _, ok := runtimeConfig.Current().Chain(req.Chain); !ok {
+		http.Error(w, "Chain must be one of "+runtimeConfig.Current().ChainNames(), http.StatusBadRequest)
+		return
+	}
+
+	previous, err := loadTokenSnapshot(req.Chain, req.Address)
+	if err != nil {
+		log.Printf("⚠️  Reading token scan snapshot for %s failed: %v", req.Address, err)
+	}
+	current := scanToken(req.Address, req.Chain)
+	events.Publish(r.Context(), EventScanCompleted, ScanCompleted{Kind: "token", Chain: req.Chain, Address: req.Address, Result: current})
+
+	writePaidData(w, r, diffTokenScans(previous, current))
+}
+
+// diffTokenScans lists the changes from previous to current. A nil
+// previous scan gives an empty diff without a baseline.
+func diffTokenScans(previous *TokenScanResult, current TokenScanResult) TokenScanDiff {
+	diff := TokenScanDiff{
+		Address: current.Address,
+		Chain:   current.Chain,
+		Changes: []TokenChange{},
+		Current: current,
+	}
+	if previous == nil {
+		return diff
+	}
+	diff.HasBaseline = true
+	diff.PreviousScannedAt = previous.ScannedAt
+	add := func(kind, severity, before, after, description string) {
+		diff.Changes = append(diff.Changes, TokenChange{kind, severity, before, after, description})
+		if severity == "high" {
+			diff.Alert = true
+		}
+	}
+
+	if before, after := previous.Owner, current.Owner; before != "" && after != "" && !strings.EqualFold(before, after) {
+		if after == address.Zero {
+			add("ownership_changed", "info", before, after, "Ownership was renounced")
+		} else {
+			add("ownership_changed", "high", before, after, "Token ownership moved to a new address")
+		}
+	}
+
+	before, okBefore := new(big.Int).SetString(previous.TotalSupply, 10)
+	after, okAfter := new(big.Int).SetString(current.TotalSupply, 10)
+	if okBefore && okAfter {
+		switch after.Cmp(before) {
+		case 1:
+			add("mint", "high", before.String(), after.String(), fmt.Sprintf("Total supply grew by %s - tokens were minted", new(big.Int).Sub(after, before)))
+		case -1:
+			add("burn", "info", before.String(), after.String(), fmt.Sprintf("Total supply shrank by %s - tokens were burned", new(big.Int).Sub(before, after)))
+		}
+	}
+
+	if previous.LiquidityUSD != nil && current.LiquidityUSD != nil && *previous.LiquidityUSD > 0 {
+		drop := (1 - *current.LiquidityUSD / *previous.LiquidityUSD) * 100
+		if drop >= liquidityPulledPct {
+			add("liquidity_pulled", "high", formatUSD(*previous.LiquidityUSD), formatUSD(*current.LiquidityUSD), fmt.Sprintf("Liquidity fell %.0f%% since the last scan", drop))
+		}
+	}
+
+	for _, tax := range []struct {
+		side            string
+		before, current *float64
+	}{{"Buy", previous.BuyTaxPct, current.BuyTaxPct}, {"Sell", previous.SellTaxPct, current.SellTaxPct}} {
+		if tax.before == nil || tax.current == nil || math.Abs(*tax.current-*tax.before) < taxChangePct {
+			continue
+		}
+		severity := "medium"
+		if *tax.current > *tax.before {
+			severity = "high"
+		}
+		add("tax_changed", severity, fmt.Sprintf("%g%%", *tax.before), fmt.Sprintf("%g%%", *tax.current), fmt.Sprintf("%s tax changed from %g%% to %g%%", tax.side, *tax.before, *tax.current))
+	}
+
+	if current.IsHoneypot && !previous.IsHoneypot {
+		add("became_honeypot", "high", "false", "true", "Token now shows honeypot behavior")
+	}
+	if current.RiskScore > previous.RiskScore {
+		add("risk_increased", "medium", fmt.Sprint(previous.RiskScore), fmt.Sprint(current.RiskScore), "Risk score increased since the last scan")
+	}
+	return diff
+}
+
+func formatUSD(v float64) string {
+	return fmt.Sprintf("$%.2f", v)
+}
+
+// fetchTokenState reads the token's owner and supply through the
+// explorer's eth_call proxy, and its liquidity and taxes from honeypot.is.
+// It also returns honeypot.is's honeypot verdict.
+func fetchTokenState(addr string, chain ChainConfig) (TokenState, bool) {
+	var state TokenState
+	if out, err := providers.Explorer.Call(addr, selectorOwner, chain); err == nil && len(out) == 32 {
+		state.Owner = "0x" + hex.EncodeToString(out[12:])
+	}
+	if out, err := providers.Explorer.Call(addr, selectorTotalSupply, chain); err == nil && len(out) == 32 {
+		state.TotalSupply = new(big.Int).SetBytes(out).String()
+	}
+
+	report, err := providers.Honeypot.Honeypot(addr, chain)
+	if err != nil {
+		return state, false
+	}
+	state.BuyTaxPct, state.SellTaxPct, state.LiquidityUSD = report.BuyTaxPct, report.SellTaxPct, report.LiquidityUSD
+	return state, report.IsHoneypot
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestTokenScanDiff(t *testing.T) {
+	srv, up := startService(t, nil)
+	const (
+		token = "0x00000000000000000000000000000000000d1ff0"
+		owner = "0x00000000000000000000000000000000000d1ff1"
+		body  = `{"address":"` + token + `","chain":"base"}`
+	)
+	diff := func() TokenScanDiff {
+		t.Helper()
+		resp := paidRequest(t, srv, "POST", "/api/scan-token/diff", body)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("diff returned %d", resp.StatusCode)
+		}
+		var out struct {
+			Data TokenScanDiff `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return out.Data
+	}
+
+	up.SetContract(token, testhttp.Contract{Owner: owner, TotalSupply: 1000000, BuyTax: 1, SellTax: 2, Liquidity: 120000})
+	resp := paidRequest(t, srv, "POST", "/api/scan-token", body)
+	var scan struct {
+		Data TokenScanResult `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&scan)
+	resp.Body.Close()
+	if scan.Data.Owner != owner || scan.Data.TotalSupply != "1000000" || *scan.Data.LiquidityUSD != 120000 || *scan.Data.SellTaxPct != 2 {
+		t.Fatalf("scan state = %+v", scan.Data.TokenState)
+	}
+
+	// Nothing changed since the paid scan
+	if d := diff(); !d.HasBaseline || len(d.Changes) != 0 || d.Alert {
+		t.Errorf("unchanged token = %+v", d)
+	}
+
+	// The owner mints, raises the sell tax and pulls liquidity
+	up.SetContract(token, testhttp.Contract{Owner: owner, TotalSupply: 5000000, BuyTax: 1, SellTax: 30, Liquidity: 3000})
+	d := diff()
+	kinds := map[string]string{}
+	for _, c := range d.Changes {
+		kinds[c.Kind] = c.Severity
+	}
+	if !d.Alert || len(d.Changes) != 3 || kinds["mint"] != "high" || kinds["tax_changed"] != "high" || kinds["liquidity_pulled"] != "high" {
+		t.Errorf("rug = %+v", d.Changes)
+	}
+	if d.Current.TotalSupply != "5000000" {
+		t.Errorf("current = %+v", d.Current)
+	}
+
+	// Renouncing ownership is not an alert
+	up.SetContract(token, testhttp.Contract{Owner: "0x0000000000000000000000000000000000000000", TotalSupply: 5000000, BuyTax: 1, SellTax: 30, Liquidity: 3000})
+	if d := diff(); d.Alert || len(d.Changes) != 1 || d.Changes[0].Kind != "ownership_changed" || d.Changes[0].Severity != "info" {
+		t.Errorf("renounced = %+v", d.Changes)
+	}
+}
+
+func TestDiffTokenScansWithoutBaseline(t *testing.T) {
+	d := diffTokenScans(nil, TokenScanResult{Address: "0x00000000000000000000000000000000000d1ff0", Chain: "base"})
+	if d.HasBaseline || d.Changes == nil || len(d.Changes) != 0 {
+		t.Errorf("first diff = %+v", d)
+	}
+}
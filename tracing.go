@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/trace"
+)
+
+// tracer records the spans of each payment: challenge, verification, the
+// paid handler and the ledger write. It always assigns trace IDs, so they
+// can be echoed in X-Trace-Id, but only exports when TRACING is set.
+var tracer = trace.New(nil)
+
+// newTracer builds the tracer selected by TRACING: "off" (the default),
+// "log" to write spans to the log, or "otlp" to send them to an
+// OpenTelemetry collector at OTEL_EXPORTER_OTLP_ENDPOINT
+func newTracer(mode string) (*trace.Tracer, error) {
+	switch mode {
+	case "", "off":
+		return trace.New(nil), nil
+	case "log":
+		return trace.New(trace.LogExporter{}), nil
+	case "otlp":
+		endpoint := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+		service := getEnv("OTEL_SERVICE_NAME", "x402-service")
+		return trace.New(trace.NewOTLPExporter(endpoint, service, 5*time.Second)), nil
+	default:
+		return nil, fmt.Errorf("unknown tracing mode %q (use off, log or otlp)", mode)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/trace"
+)
+
+// spanRecorder collects exported spans by name
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans map[string]trace.SpanData
+}
+
+func (s *spanRecorder) Export(span trace.SpanData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans[span.Name] = span
+}
+
+func (s *spanRecorder) get(name string) trace.SpanData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.spans[name]
+}
+
+func TestPaymentTrace(t *testing.T) {
+	srv, _ := startService(t, nil)
+	spans := &spanRecorder{spans: make(map[string]trace.SpanData)}
+	tracer = trace.New(spans)
+	t.Cleanup(func() { tracer = trace.New(nil) })
+
+	const caller = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	do := func(token string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/gas", nil)
+		req.Header.Set(trace.Header, caller)
+		if token != "" {
+			req.Header.Set("X-Payment-Response", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	challenge := do("")
+	if challenge.Header.Get("X-Trace-Id") != "4bf92f3577b34da6a3ce929d0e0e4736" || challenge.Header.Get("X-Payment-Id") != "" {
+		t.Errorf("challenge headers: trace %q, payment %q", challenge.Header.Get("X-Trace-Id"), challenge.Header.Get("X-Payment-Id"))
+	}
+	if got := spans.get("x402.payment").Attributes["outcome"]; got != "challenged" {
+		t.Errorf("challenge outcome = %q", got)
+	}
+	token := pay(t, challenge)
+	challenge.Body.Close()
+
+	resp := do(token)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("paid request returned %d", resp.StatusCode)
+	}
+	paymentID, traceID := resp.Header.Get("X-Payment-Id"), resp.Header.Get("X-Trace-Id")
+	if paymentID == "" || traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("paid response headers: payment %q, trace %q", paymentID, traceID)
+	}
+
+	entries := ledgerEntries(t, srv)
+	if len(entries) != 1 || entries[0].ID != paymentID || entries[0].TraceID != traceID {
+		t.Fatalf("ledger = %+v, want id %s trace %s", entries, paymentID, traceID)
+	}
+
+	root := spans.get("x402.payment")
+	if root.Parent.String() != "00f067aa0ba902b7" || root.Attributes["payment.id"] != paymentID || root.Attributes["endpoint"] != "/api/gas" {
+		t.Errorf("payment span = %+v", root)
+	}
+	for child, parent := range map[string]string{
+		"x402.verify":  "x402.payment",
+		"x402.handler": "x402.payment",
+		"x402.capture": "x402.payment",
+		"ledger.write": "x402.capture",
+	} {
+		c, p := spans.get(child), spans.get(parent)
+		if c.Context.TraceID.String() != traceID || c.Parent != p.Context.SpanID {
+			t.Errorf("%s is not a child of %s", child, parent)
+		}
+	}
+	if spans.get("ledger.write").Status == trace.StatusError {
+		t.Errorf("ledger write failed: %s", spans.get("ledger.write").Message)
+	}
+}
+
+func TestNewTracer(t *testing.T) {
+	for _, mode := range []string{"", "off", "log"} {
+		if _, err := newTracer(mode); err != nil {
+			t.Errorf("newTracer(%q): %v", mode, err)
+		}
+	}
+	if _, err := newTracer("jaeger"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/units"
+)
+
+// Selectors of the token calls the transfer builder reads
+const (
+	selectorDecimals      = "313ce567"
+	selectorSymbol        = "95d89b41"
+	selectorIsBlacklisted = "fe575a87" // Circle tokens: isBlacklisted(address)
+	selectorIsBlackListed = "e47d6060" // Tether tokens: isBlackListed(address)
+)
+
+// Preflight checks of a built transfer, and their outcomes
+const (
+	transferCheckToken     = "token_contract"     // the token is a contract answering decimals()
+	transferCheckDecimals  = "decimals"           // the caller's decimals match the token's
+	transferCheckRecipient = "recipient_address"  // not the zero address or a precompile
+	transferCheckTrap      = "recipient_contract" // not the token itself, or an unknown contract
+	transferCheckBlacklist = "recipient_blacklist"
+
+	transferPass = "pass"
+	transferWarn = "warn"
+	transferFail = "fail"
+)
+
+// BuildTransferRequest asks for an ERC-20 transfer of amount whole tokens
+type BuildTransferRequest struct {
+	Token     string `json:"token"` // contract address, or a payment asset such as USDC
+	Recipient string `json:"recipient"`
+	Amount    string `json:"amount"`             // in whole tokens, e.g. "12.5"
+	Decimals  *int   `json:"decimals,omitempty"` // the caller's, checked against the token's
+	Chain     string `json:"chain,omitempty"`    // default base
+}
+
+// TransferTx is an unsigned transfer for the sender's wallet to sign
+type TransferTx struct {
+	To      string `json:"to"` // the token contract
+	Data    string `json:"data"`
+	Value   string `json:"value"`
+	ChainID int64  `json:"chainId"`
+}
+
+// TransferCheck is the outcome of one preflight check
+type TransferCheck struct {
+	Check  string `json:"check"`
+	Status string `json:"status"` // pass, warn or fail
+	Detail string `json:"detail,omitempty"`
+}
+
+// BuildTransferResult is the response of /api/build-transfer. Transaction
+// is left out if the token cannot be read.
+type BuildTransferResult struct {
+	Safe        bool            `json:"safe"` // no check failed
+	Chain       string          `json:"chain"`
+	Token       string          `json:"token"`
+	Symbol      string          `json:"symbol,omitempty"`
+	Decimals    int             `json:"decimals"`
+	Recipient   string          `json:"recipient"`
+	Amount      string          `json:"amount"`
+	RawAmount   string          `json:"raw_amount,omitempty"` // in the token's smallest unit
+	Transaction *TransferTx     `json:"transaction,omitempty"`
+	Checks      []TransferCheck `json:"checks"`
+	CheckedAt   int64           `json:"checked_at"`
+}
+
+func (r *BuildTransferResult) check(check, status, detail string) {
+	r.Checks = append(r.Checks, TransferCheck{Check: check, Status: status, Detail: detail})
+	if status == transferFail {
+		r.Safe = false
+	}
+}
+
+// maxTokenDecimals is the most decimals a uint256 amount can have
+const maxTokenDecimals = 77
+
+// errTransferAmount is a well-formed amount the token cannot represent
+var errTransferAmount = errors.New("invalid amount")
+
+// TransferBuilder encodes ERC-20 transfers and checks them against the
+// token and recipient on each chain's RPC
+type TransferBuilder struct {
+	rpcURLs map[string]string // chain -> JSON-RPC URL
+}
+
+// NewTransferBuilder reads tokens from rpcURLs, by chain
+func NewTransferBuilder(rpcURLs map[string]string) *TransferBuilder {
+	return &TransferBuilder{rpcURLs: rpcURLs}
+}
+
+// Build encodes req and runs the preflight checks. It fails if the RPC is
+// unreachable, or with errTransferAmount if the amount does not fit the
+// token's decimals.
+func (b *TransferBuilder) Build(req BuildTransferRequest) (*BuildTransferResult, error) {
+	cfg := runtimeConfig.Current()
+	rpcURL := b.rpcURLs[req.Chain]
+	token, recipient := strings.ToLower(req.Token), strings.ToLower(req.Recipient)
+	result := &BuildTransferResult{Safe: true, Chain: req.Chain, Token: token, Recipient: recipient, Amount: req.Amount, Checks: []TransferCheck{}, CheckedAt: time.Now().Unix()}
+
+	var code string
+	if err := jsonRPC(rpcURL, "eth_getCode", []interface{}{token, "latest"}, &code); err != nil {
+		return nil, err
+	}
+	decimals, err := b.decimals(rpcURL, token)
+	var rpcErr *jsonRPCError
+	readable := false
+	switch {
+	case code == "" || code == "0x":
+		result.check(transferCheckToken, transferFail, "no contract is deployed at "+token+" on "+req.Chain)
+	case errors.As(err, &rpcErr):
+		result.check(transferCheckToken, transferFail, "the contract does not answer decimals(), it is not an ERC-20 token")
+	case err != nil:
+		return nil, err
+	default:
+		result.Decimals = decimals
+		result.Symbol = b.symbol(rpcURL, token)
+		result.check(transferCheckToken, transferPass, "")
+		readable = true
+	}
+
+	if readable {
+		raw, err := parseTokenAmount(req.Amount, decimals)
+		if err != nil {
+			return nil, err
+		}
+		result.RawAmount = raw.String()
+		result.Transaction = &TransferTx{
+			To:      token,
+			Data:    encodeTransfer(recipient, raw),
+			Value:   "0",
+			ChainID: paymentNetworks[req.Chain].ChainID,
+		}
+		switch {
+		case req.Decimals == nil:
+			result.check(transferCheckDecimals, transferPass, fmt.Sprintf("read %d from the token", decimals))
+		case *req.Decimals != decimals:
+			result.check(transferCheckDecimals, transferFail, fmt.Sprintf("the token has %d decimals, not %d; the amount was scaled by %d", decimals, *req.Decimals, decimals))
+		default:
+			result.check(transferCheckDecimals, transferPass, "")
+		}
+	}
+
+	if warning := specialAddressWarning(recipient); warning != "" {
+		result.check(transferCheckRecipient, transferFail, warning)
+	} else {
+		result.check(transferCheckRecipient, transferPass, "")
+	}
+
+	// Tokens sent to a contract that cannot move them are stuck for good;
+	// sending a token to its own contract is the classic case
+	var recipientCode string
+	switch err := jsonRPC(rpcURL, "eth_getCode", []interface{}{recipient, "latest"}, &recipientCode); {
+	case recipient == token:
+		result.check(transferCheckTrap, transferFail, "the recipient is the token contract itself, tokens sent there are lost")
+	case err != nil:
+		result.check(transferCheckTrap, transferWarn, "the recipient could not be checked: RPC unavailable")
+	case recipientCode == "" || recipientCode == "0x":
+		result.check(transferCheckTrap, transferPass, "")
+	default:
+		if name, ok := cfg.KnownContract(req.Chain, recipient); ok {
+			result.check(transferCheckTrap, transferPass, "recognized contract: "+name)
+		} else {
+			result.check(transferCheckTrap, transferWarn, "the recipient is a contract; make sure it can move "+tokenName(result)+" out again")
+		}
+	}
+
+	b.checkBlacklist(cfg, rpcURL, result)
+	return result, nil
+}
+
+// checkBlacklist fails the transfer if the recipient is on the blocklist or
+// the token's own blacklist, where the token keeps one
+func (b *TransferBuilder) checkBlacklist(cfg *RuntimeConfig, rpcURL string, result *BuildTransferResult) {
+	if cfg.IsBlocked(result.Recipient) {
+		result.check(transferCheckBlacklist, transferFail, "the recipient is on the blocklist")
+		return
+	}
+	if label := lookupAddressLabel(result.Recipient); label.RiskLevel == "high" {
+		result.check(transferCheckBlacklist, transferFail, "the recipient is labeled high risk")
+		return
+	}
+	if result.Transaction != nil {
+		for _, selector := range []string{selectorIsBlacklisted, selectorIsBlackListed} {
+			var out string
+			err := jsonRPC(rpcURL, "eth_call", []interface{}{map[string]string{"to": result.Token, "data": "0x" + selector + fmt.Sprintf("%064s", strings.TrimPrefix(result.Recipient, "0x"))}, "latest"}, &out)
+			if err != nil {
+				// Reverts: the token keeps no blacklist of this kind
+				continue
+			}
+			if listed, err := units.ParseHex(out); err == nil && listed.Sign() != 0 {
+				result.check(transferCheckBlacklist, transferFail, "the token blacklists the recipient; the transfer would revert")
+				return
+			}
+		}
+	}
+	result.check(transferCheckBlacklist, transferPass, "")
+}
+
+// decimals reads the token's decimals()
+func (b *TransferBuilder) decimals(rpcURL, token string) (int, error) {
+	var out string
+	if err := jsonRPC(rpcURL, "eth_call", []interface{}{map[string]string{"to": token, "data": "0x" + selectorDecimals}, "latest"}, &out); err != nil {
+		return 0, err
+	}
+	_, args, err := decodeCalldata("0x00000000" + strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return 0, &jsonRPCError{Message: "decimals() returned nothing"}
+	}
+	d, err := args.uint(0)
+	if err != nil || !d.IsInt64() || d.Int64() > maxTokenDecimals {
+		return 0, &jsonRPCError{Message: "decimals() returned an invalid value"}
+	}
+	return int(d.Int64()), nil
+}
+
+// symbol reads the token's symbol(), or "" if it has none readable
+func (b *TransferBuilder) symbol(rpcURL, token string) string {
+	var out string
+	if err := jsonRPC(rpcURL, "eth_call", []interface{}{map[string]string{"to": token, "data": "0x" + selectorSymbol}, "latest"}, &out); err != nil {
+		return ""
+	}
+	_, args, err := decodeCalldata("0x00000000" + strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return ""
+	}
+	symbol, err := args.bytes(0)
+	if err != nil {
+		return ""
+	}
+	return string(symbol)
+}
+
+func tokenName(r *BuildTransferResult) string {
+	if r.Symbol != "" {
+		return r.Symbol
+	}
+	return "the token"
+}
+
+// tokenAmountDigits splits a whole-token amount such as "12.5" into its
+// integer and fractional digits
+func tokenAmountDigits(amount string) (whole, frac string, err error) {
+	whole, frac, _ = strings.Cut(strings.TrimSpace(amount), ".")
+	if whole == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return "", "", fmt.Errorf("%w: want a decimal number of tokens", errTransferAmount)
+	}
+	if strings.Trim(whole+frac, "0") == "" {
+		return "", "", fmt.Errorf("%w: must be more than 0", errTransferAmount)
+	}
+	return whole, frac, nil
+}
+
+// parseTokenAmount converts a whole-token amount into the token's smallest
+// unit
+func parseTokenAmount(amount string, decimals int) (*big.Int, error) {
+	whole, frac, err := tokenAmountDigits(amount)
+	if err != nil {
+		return nil, err
+	}
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("%w: the token has %d decimals", errTransferAmount, decimals)
+	}
+	raw, _ := new(big.Int).SetString(whole+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	if raw.Cmp(units.MaxUint256) > 0 {
+		return nil, fmt.Errorf("%w: too large", errTransferAmount)
+	}
+	return raw, nil
+}
+
+// encodeTransfer encodes transfer(to, amount)
+func encodeTransfer(to string, amount *big.Int) string {
+	return fmt.Sprintf("0x%s%064s%064x", selectorTransfer, strings.ToLower(strings.TrimPrefix(to, "0x")), amount)
+}
+
+// handleBuildTransfer serves POST /api/build-transfer. Requests that cannot
+// be built are refused without capturing the payment.
+func (b *TransferBuilder) handleBuildTransfer(w http.ResponseWriter, r *http.Request) {
+	var req BuildTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Build transfer decode error (payer=%s): %v", payerLabel(r), err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Chain == "" {
+		req.Chain = "base"
+	}
+	refuse := func(status int, msg string) {
+		chargeFromContext(r.Context()).refuse()
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, msg+", payment not captured"), status)
+	}
+	if _, ok := b.rpcURLs[req.Chain]; !ok {
+		refuse(http.StatusBadRequest, fmt.Sprintf("unsupported chain %q, want one of %s", req.Chain, strings.Join(sortedKeys(b.rpcURLs), ", ")))
+		return
+	}
+	if contract, ok := assetOn(req.Chain, strings.ToUpper(req.Token)); ok && contract != "" {
+		req.Token = contract
+	}
+	if !isValidAddress(req.Token) {
+		refuse(http.StatusBadRequest, "token must be an address or a payment asset on "+req.Chain)
+		return
+	}
+	if !isValidAddress(req.Recipient) {
+		refuse(http.StatusBadRequest, "recipient must be an address")
+		return
+	}
+	if req.Decimals != nil && (*req.Decimals < 0 || *req.Decimals > maxTokenDecimals) {
+		refuse(http.StatusBadRequest, fmt.Sprintf("decimals must be between 0 and %d", maxTokenDecimals))
+		return
+	}
+	if _, _, err := tokenAmountDigits(req.Amount); err != nil {
+		refuse(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := b.Build(req)
+	if errors.Is(err, errTransferAmount) {
+		refuse(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  Build transfer failed on %s (payer=%s): %v", req.Chain, payerLabel(r), err)
+		refuse(http.StatusBadGateway, req.Chain+" RPC unavailable")
+		return
+	}
+	writePaidData(w, r, result)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBuildTransfer(t *testing.T) {
+	const (
+		token       = "0x00000000000000000000000000000000000070c1"
+		wallet      = "0x00000000000000000000000000000000000000a1"
+		vault       = "0x00000000000000000000000000000000000000c1"
+		blacklisted = "0x00000000000000000000000000000000000000d1"
+		notToken    = "0x00000000000000000000000000000000000000e1"
+	)
+	// A token with 6 decimals and a Circle-style blacklist; vault and the
+	// token are contracts
+	rpc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": 1}
+		switch req.Method {
+		case "eth_getCode":
+			var addr string
+			json.Unmarshal(req.Params[0], &addr)
+			reply["result"] = "0x"
+			if addr == token || addr == vault || addr == notToken {
+				reply["result"] = "0x6080"
+			}
+		case "eth_call":
+			var call struct{ To, Data string }
+			json.Unmarshal(req.Params[0], &call)
+			switch {
+			case call.To != token:
+				reply["error"] = map[string]interface{}{"code": 3, "message": "execution reverted"}
+			case call.Data == "0x"+selectorDecimals:
+				reply["result"] = fmt.Sprintf("0x%064x", 6)
+			case call.Data == "0x"+selectorSymbol:
+				reply["result"] = "0x" + fmt.Sprintf("%064x%064x", 32, 3) + fmt.Sprintf("%x", "TKN") + strings.Repeat("0", 58)
+			case strings.HasPrefix(call.Data, "0x"+selectorIsBlacklisted):
+				listed := 0
+				if strings.HasSuffix(call.Data, blacklisted[2:]) {
+					listed = 1
+				}
+				reply["result"] = fmt.Sprintf("0x%064x", listed)
+			default:
+				reply["error"] = map[string]interface{}{"code": 3, "message": "execution reverted"}
+			}
+		}
+		json.NewEncoder(w).Encode(reply)
+	}))
+	defer rpc.Close()
+	builder := NewTransferBuilder(map[string]string{"base": rpc.URL})
+
+	build := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		builder.handleBuildTransfer(rr, httptest.NewRequest("POST", "/api/build-transfer", strings.NewReader(body)))
+		return rr
+	}
+	result := func(body string) BuildTransferResult {
+		t.Helper()
+		rr := build(body)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s returned %d: %s", body, rr.Code, rr.Body)
+		}
+		var resp struct {
+			Data BuildTransferResult `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+	statuses := func(r BuildTransferResult) string {
+		var s []string
+		for _, c := range r.Checks {
+			s = append(s, c.Check+"="+c.Status)
+		}
+		return strings.Join(s, ",")
+	}
+
+	for name, body := range map[string]string{
+		"unknown chain": `{"chain": "solana", "token": "` + token + `", "recipient": "` + wallet + `", "amount": "1"}`,
+		"bad token":     `{"token": "TKN", "recipient": "` + wallet + `", "amount": "1"}`,
+		"bad recipient": `{"token": "` + token + `", "recipient": "0x1", "amount": "1"}`,
+		"bad amount":    `{"token": "` + token + `", "recipient": "` + wallet + `", "amount": "-1"}`,
+		"zero amount":   `{"token": "` + token + `", "recipient": "` + wallet + `", "amount": "0.0"}`,
+		"too precise":   `{"token": "` + token + `", "recipient": "` + wallet + `", "amount": "1.0000001"}`,
+	} {
+		if rr := build(body); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "payment not captured") {
+			t.Errorf("%s returned %d: %s", name, rr.Code, rr.Body)
+		}
+	}
+
+	// A plain transfer to a wallet
+	r := result(`{"token": "` + token + `", "recipient": "` + wallet + `", "amount": "12.5", "decimals": 6}`)
+	wantData := "0xa9059cbb" + strings.Repeat("0", 24) + wallet[2:] + fmt.Sprintf("%064x", 12_500_000)
+	if !r.Safe || r.Decimals != 6 || r.Symbol != "TKN" || r.RawAmount != "12500000" || r.Transaction == nil || r.Transaction.Data != wantData || r.Transaction.To != token || r.Transaction.ChainID != 8453 {
+		t.Errorf("transfer = %+v, tx = %+v", r, r.Transaction)
+	}
+	if got := statuses(r); got != "token_contract=pass,decimals=pass,recipient_address=pass,recipient_contract=pass,recipient_blacklist=pass" {
+		t.Errorf("checks = %s", got)
+	}
+
+	// The wrong decimals are caught, the amount still scaled by the token's
+	if r := result(`{"token": "` + token + `", "recipient": "` + wallet + `", "amount": "1", "decimals": 18}`); r.Safe || r.RawAmount != "1000000" || !strings.Contains(statuses(r), "decimals=fail") {
+		t.Errorf("wrong decimals = %+v", r)
+	}
+
+	// Traps and blacklists
+	for name, tc := range map[string]struct{ recipient, want string }{
+		"zero address":    {"0x0000000000000000000000000000000000000000", "recipient_address=fail"},
+		"token itself":    {token, "recipient_contract=fail"},
+		"contract":        {vault, "recipient_contract=warn"},
+		"token blacklist": {blacklisted, "recipient_blacklist=fail"},
+	} {
+		r := result(`{"token": "` + token + `", "recipient": "` + tc.recipient + `", "amount": "1"}`)
+		if !strings.Contains(statuses(r), tc.want) || r.Transaction == nil {
+			t.Errorf("%s: checks = %s", name, statuses(r))
+		}
+		if strings.HasSuffix(tc.want, "fail") == r.Safe {
+			t.Errorf("%s: safe = %v", name, r.Safe)
+		}
+	}
+
+	// A contract that is no token gets no transaction
+	if r := result(`{"token": "` + notToken + `", "recipient": "` + wallet + `", "amount": "1"}`); r.Safe || r.Transaction != nil || !strings.Contains(statuses(r), "token_contract=fail") {
+		t.Errorf("not a token = %+v", r)
+	}
+}
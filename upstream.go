@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUpstreamBusy is returned when a request waited too long for a slot
+var ErrUpstreamBusy = errors.New("upstream concurrency limit reached")
+
+// upstreamProviders maps known upstream hosts to provider names. Unknown
+// hosts (RPC and beacon nodes) are limited under their own host name.
+var upstreamProviders = map[string]string{
+	"api.etherscan.io":  "etherscan",
+	"api.basescan.org":  "basescan",
+	"api.honeypot.is":   "honeypot",
+	"api.coingecko.com": "coingecko",
+	"api.coinbase.com":  "coinbase",
+	"api.kraken.com":    "kraken",
+}
+
+// UpstreamLimiter is an http.RoundTripper that bounds concurrent requests per
+// upstream provider. Requests beyond the cap queue for up to wait before
+// failing with ErrUpstreamBusy.
+type UpstreamLimiter struct {
+	next       http.RoundTripper
+	defaultCap int
+	wait       time.Duration
+
+	mu    sync.Mutex
+	caps  map[string]int
+	pools map[string]*upstreamPool
+}
+
+type upstreamPool struct {
+	slots    chan struct{}
+	queued   int64
+	inflight int64
+	rejected int64
+
+	requests    int64
+	failures    int64
+	consecutive int64 // failures since the last success
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt int64
+}
+
+// record counts the outcome of a request. Transport errors, 429s and 5xx
+// responses are failures. It returns UpstreamDown when this request marked
+// the provider down, UpstreamOK when it brought a down provider back, and
+// "" otherwise.
+func (p *upstreamPool) record(resp *http.Response, err error, now time.Time) string {
+	atomic.AddInt64(&p.requests, 1)
+	switch {
+	case err != nil:
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		err = fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		if atomic.SwapInt64(&p.consecutive, 0) >= upstreamDownAfter {
+			return UpstreamOK
+		}
+		return ""
+	}
+	atomic.AddInt64(&p.failures, 1)
+	p.mu.Lock()
+	p.lastError = err.Error()
+	p.lastErrorAt = now.Unix()
+	p.mu.Unlock()
+	if atomic.AddInt64(&p.consecutive, 1) == upstreamDownAfter {
+		return UpstreamDown
+	}
+	return ""
+}
+
+// NewUpstreamLimiter wraps next with a per-provider concurrency cap
+func NewUpstreamLimiter(next http.RoundTripper, defaultCap int, wait time.Duration) *UpstreamLimiter {
+	return &UpstreamLimiter{
+		next:       next,
+		defaultCap: defaultCap,
+		wait:       wait,
+		caps:       make(map[string]int),
+		pools:      make(map[string]*upstreamPool),
+	}
+}
+
+// SetDefaults changes the default cap and queue wait. Call before serving.
+func (l *UpstreamLimiter) SetDefaults(defaultCap int, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.defaultCap = defaultCap
+	l.wait = wait
+}
+
+// SetLimit overrides the concurrency cap for one provider. It only affects
+// pools created after the call.
+func (l *UpstreamLimiter) SetLimit(provider string, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.caps[provider] = limit
+}
+
+// ParseLimits applies overrides of the form "etherscan=2,honeypot=1"
+func (l *UpstreamLimiter) ParseLimits(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil || n < 1 {
+			return fmt.Errorf("invalid upstream limit %q", part)
+		}
+		l.SetLimit(strings.TrimSpace(name), n)
+	}
+	return nil
+}
+
+func (l *UpstreamLimiter) pool(provider string) *upstreamPool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p, ok := l.pools[provider]
+	if !ok {
+		limit := l.defaultCap
+		if c, ok := l.caps[provider]; ok {
+			limit = c
+		}
+		p = &upstreamPool{slots: make(chan struct{}, limit)}
+		l.pools[provider] = p
+	}
+	return p
+}
+
+// RoundTrip implements http.RoundTripper
+func (l *UpstreamLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := upstreamProvider(req.URL.Hostname())
+	p := l.pool(provider)
+
+	atomic.AddInt64(&p.queued, 1)
+	timer := time.NewTimer(l.wait)
+	select {
+	case p.slots <- struct{}{}:
+		timer.Stop()
+		atomic.AddInt64(&p.queued, -1)
+	case <-timer.C:
+		atomic.AddInt64(&p.queued, -1)
+		atomic.AddInt64(&p.rejected, 1)
+		return nil, fmt.Errorf("%s: %w", provider, ErrUpstreamBusy)
+	case <-req.Context().Done():
+		timer.Stop()
+		atomic.AddInt64(&p.queued, -1)
+		return nil, req.Context().Err()
+	}
+
+	atomic.AddInt64(&p.inflight, 1)
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			atomic.AddInt64(&p.inflight, -1)
+			<-p.slots
+		})
+	}
+
+	resp, err := l.next.RoundTrip(req)
+	if status := p.record(resp, err, time.Now()); status != "" {
+		p.mu.Lock()
+		lastError := p.lastError
+		p.mu.Unlock()
+		events.Publish(req.Context(), EventUpstreamDegraded, UpstreamDegradation{Provider: provider, Status: status, LastError: lastError})
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// Hold the slot until the caller has finished reading the body
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// Saturation is the deepest provider queue relative to its concurrency
+// cap: 0 when nothing waits, 1 when as many requests wait as can run
+func (l *UpstreamLimiter) Saturation() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var worst float64
+	for _, p := range l.pools {
+		if slots := cap(p.slots); slots > 0 {
+			worst = max(worst, float64(atomic.LoadInt64(&p.queued))/float64(slots))
+		}
+	}
+	return worst
+}
+
+// WriteMetrics emits queue depth, in-flight and rejection gauges per provider
+func (l *UpstreamLimiter) WriteMetrics(b *strings.Builder) {
+	l.mu.Lock()
+	names := make([]string, 0, len(l.pools))
+	for name := range l.pools {
+		names = append(names, name)
+	}
+	l.mu.Unlock()
+	sort.Strings(names)
+
+	b.WriteString("# HELP x402_upstream_queue_depth Requests waiting for an upstream slot\n")
+	b.WriteString("# TYPE x402_upstream_queue_depth gauge\n")
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("x402_upstream_queue_depth{provider=\"%s\"} %d\n", name, atomic.LoadInt64(&l.pool(name).queued)))
+	}
+	b.WriteString("# HELP x402_upstream_inflight Requests currently running against an upstream\n")
+	b.WriteString("# TYPE x402_upstream_inflight gauge\n")
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("x402_upstream_inflight{provider=\"%s\"} %d\n", name, atomic.LoadInt64(&l.pool(name).inflight)))
+	}
+	b.WriteString("# HELP x402_upstream_rejected_total Requests that timed out waiting for an upstream slot\n")
+	b.WriteString("# TYPE x402_upstream_rejected_total counter\n")
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("x402_upstream_rejected_total{provider=\"%s\"} %d\n", name, atomic.LoadInt64(&l.pool(name).rejected)))
+	}
+}
+
+// Upstream health states
+const (
+	UpstreamOK       = "ok"
+	UpstreamDegraded = "degraded" // the last request failed
+	UpstreamDown     = "down"     // the last upstreamDownAfter requests failed
+)
+
+// upstreamDownAfter is how many failures in a row mark a provider down
+const upstreamDownAfter = 3
+
+// UpstreamHealth summarizes the requests made to one provider since start
+type UpstreamHealth struct {
+	Provider    string `json:"provider"`
+	Status      string `json:"status"`
+	Requests    int64  `json:"requests"`
+	Failures    int64  `json:"failures"`
+	Rejected    int64  `json:"rejected"`
+	Inflight    int64  `json:"inflight"`
+	Queued      int64  `json:"queued"`
+	LastError   string `json:"last_error,omitempty"`
+	LastErrorAt int64  `json:"last_error_at,omitempty"`
+}
+
+// Health returns the health of every provider called so far, by name
+func (l *UpstreamLimiter) Health() []UpstreamHealth {
+	l.mu.Lock()
+	names := make([]string, 0, len(l.pools))
+	for name := range l.pools {
+		names = append(names, name)
+	}
+	l.mu.Unlock()
+	sort.Strings(names)
+
+	out := make([]UpstreamHealth, 0, len(names))
+	for _, name := range names {
+		p := l.pool(name)
+		h := UpstreamHealth{
+			Provider: name,
+			Status:   UpstreamOK,
+			Requests: atomic.LoadInt64(&p.requests),
+			Failures: atomic.LoadInt64(&p.failures),
+			Rejected: atomic.LoadInt64(&p.rejected),
+			Inflight: atomic.LoadInt64(&p.inflight),
+			Queued:   atomic.LoadInt64(&p.queued),
+		}
+		switch consecutive := atomic.LoadInt64(&p.consecutive); {
+		case consecutive >= upstreamDownAfter:
+			h.Status = UpstreamDown
+		case consecutive > 0:
+			h.Status = UpstreamDegraded
+		}
+		p.mu.Lock()
+		h.LastError, h.LastErrorAt = p.lastError, p.lastErrorAt
+		p.mu.Unlock()
+		out = append(out, h)
+	}
+	return out
+}
+
+func upstreamProvider(host string) string {
+	if name, ok := upstreamProviders[host]; ok {
+		return name
+	}
+	return host
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
+
+// upstreamLimiter bounds concurrency for every outbound call made through
+// upstreamHTTP. main applies UPSTREAM_* overrides at startup.
+var upstreamLimiter = NewUpstreamLimiter(http.DefaultTransport, 4, 15*time.Second)
+
+// upstreamHTTP is the shared client for explorer, honeypot, price, RPC and
+// beacon requests. Explorer calls are budgeted per API key by explorerKeys.
+var upstreamHTTP = &http.Client{Timeout: 30 * time.Second, Transport: explorerKeys}
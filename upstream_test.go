@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpstreamLimiterQueuesAndRejects(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	limiter := NewUpstreamLimiter(http.DefaultTransport, 1, 50*time.Millisecond)
+	client := &http.Client{Transport: limiter}
+
+	// Occupy the only slot
+	done := make(chan struct{})
+	go func() {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrUpstreamBusy) {
+		t.Errorf("second request error = %v, want ErrUpstreamBusy", err)
+	}
+
+	close(release)
+	<-done
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request after release failed: %v", err)
+	}
+	resp.Body.Close()
+}
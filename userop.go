@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entryPointV07 is the canonical ERC-4337 v0.7 EntryPoint, used when a
+// preflight request names none
+const entryPointV07 = "0x0000000071727De22E5E9d8BAf0edAc6f37da032"
+
+// knownEntryPoints are the canonical EntryPoint deployments that take
+// v0.7-style unpacked user operations, keyed by lowercase address
+var knownEntryPoints = map[string]string{
+	"0x0000000071727de22e5e9d8baf0edac6f37da032": "v0.7",
+	"0x4337084d9e255ff0702461cf8895ce9e3b5ff108": "v0.8",
+}
+
+// SetBundler simulates user operations with eth_estimateUserOperationGas
+// on bundlerURL. Without a bundler only the account's execution is
+// simulated, with eth_call from the EntryPoint.
+func (s *TxSimulator) SetBundler(bundlerURL string) {
+	s.bundlerURL = bundlerURL
+}
+
+// simulateUserOperation checks an ERC-4337 user operation: its sender,
+// factory, paymaster and EntryPoint, the call it executes, and whether it
+// simulates
+func (s *TxSimulator) simulateUserOperation(tx *TxPreflightRequest) (*TxPreflightResult, error) {
+	op := *tx.UserOperation
+	result := &TxPreflightResult{
+		Safe:            true,
+		Warnings:        []string{},
+		Errors:          []string{},
+		Recommendations: []string{},
+		CheckedAt:       time.Now().Unix(),
+	}
+	result.Scoring = scoring("preflight", runtimeConfig.Current(), result.CheckedAt)
+	invalid := func(msg string) (*TxPreflightResult, error) {
+		result.Safe = false
+		result.RiskScore = 100
+		result.Errors = append(result.Errors, msg)
+		return result, nil
+	}
+
+	entryPoint := tx.EntryPoint
+	if entryPoint == "" {
+		entryPoint = entryPointV07
+	}
+	if !isValidAddress(op.Sender) {
+		return invalid("Invalid 'sender' address (bad hex or EIP-55 checksum)")
+	}
+	if !isValidAddress(entryPoint) {
+		return invalid("Invalid 'entry_point' address (bad hex or EIP-55 checksum)")
+	}
+	if op.Factory != "" && !isValidAddress(op.Factory) {
+		return invalid("Invalid 'factory' address (bad hex or EIP-55 checksum)")
+	}
+	if op.Paymaster != "" && !isValidAddress(op.Paymaster) {
+		return invalid("Invalid 'paymaster' address (bad hex or EIP-55 checksum)")
+	}
+
+	if _, ok := knownEntryPoints[strings.ToLower(entryPoint)]; !ok {
+		result.RiskScore += 50
+		result.Warnings = append(result.Warnings, "Unknown EntryPoint - not a canonical ERC-4337 deployment")
+	}
+	deployed, err := s.checkIsContract(op.Sender)
+	if err == nil {
+		switch {
+		case deployed && op.Factory != "":
+			result.RiskScore += 20
+			result.Errors = append(result.Errors, "Factory set for an account that is already deployed - the EntryPoint will reject the operation")
+		case !deployed && op.Factory == "":
+			result.RiskScore += 20
+			result.Errors = append(result.Errors, "Sender has no code and no factory to deploy it")
+		}
+	}
+	if op.Factory != "" {
+		s.flagUserOpContract(result, "Factory", op.Factory)
+	}
+	if op.Paymaster != "" {
+		s.flagUserOpContract(result, "Paymaster", op.Paymaster)
+	}
+	for _, pattern := range s.analyzeTxData(op.CallData) {
+		result.RiskScore += pattern.score
+		result.Warnings = append(result.Warnings, pattern.description)
+	}
+
+	switch {
+	case s.bundlerURL != "":
+		fillUserOperation(&op)
+		gas, err := estimateUserOperationGas(s.bundlerURL, op, entryPoint)
+		if err != nil {
+			result.RiskScore += 20
+			result.Errors = append(result.Errors, fmt.Sprintf("User operation simulation failed: %v", err))
+			break
+		}
+		result.SimulationSuccess = true
+		result.GasEstimate = strconv.FormatUint(gas.Total, 10)
+		result.UserOperationGas = gas
+		if gas.CallGasLimit > 500000 {
+			result.Warnings = append(result.Warnings, "High gas usage detected")
+			result.RiskScore += 5
+		}
+	case deployed:
+		if err := s.callFromEntryPoint(entryPoint, op); err != nil {
+			result.RiskScore += 20
+			result.Errors = append(result.Errors, fmt.Sprintf("Execution simulation failed: %v", err))
+			break
+		}
+		result.SimulationSuccess = true
+		result.Warnings = append(result.Warnings, "Only the execution was simulated - validation and paymaster checks need a bundler")
+	default:
+		result.Warnings = append(result.Warnings, "Account is not deployed yet - execution was not simulated")
+	}
+	result.DataSources[SourceRPC] = result.CheckedAt
+	if s.bundlerURL != "" {
+		result.DataSources[SourceBundler] = result.CheckedAt
+	}
+
+	scorePreflight(result)
+	return result, nil
+}
+
+// flagUserOpContract flags a factory or paymaster that is a special
+// address, blocklisted, or has no code
+func (s *TxSimulator) flagUserOpContract(result *TxPreflightResult, role, addr string) {
+	if warning := specialAddressWarning(addr); warning != "" {
+		result.RiskScore += 60
+		result.Warnings = append(result.Warnings, role+": "+warning)
+	}
+	if runtimeConfig.Current().IsBlocked(addr) {
+		result.RiskScore += 100
+		result.Warnings = append(result.Warnings, role+" is on the operator blocklist")
+	}
+	if isContract, err := s.checkIsContract(addr); err == nil && !isContract {
+		result.RiskScore += 40
+		result.Warnings = append(result.Warnings, role+" has no code - the operation cannot validate")
+	}
+}
+
+// callFromEntryPoint runs the operation's callData against the sender as
+// the EntryPoint would after validation
+func (s *TxSimulator) callFromEntryPoint(entryPoint string, op UserOperation) error {
+	params := map[string]string{
+		"from": entryPoint,
+		"to":   op.Sender,
+		"data": op.CallData,
+	}
+	result, err := s.rpcClient.call("eth_call", []interface{}{params, "latest"})
+	if err != nil {
+		return err
+	}
+	if rpcErr, ok := result["error"].(map[string]interface{}); ok {
+		return fmt.Errorf("%v", rpcErr["message"])
+	}
+	return nil
+}
+
+// executeSelector is execute(address,uint256,bytes), the call most smart
+// accounts make from a user operation
+const executeSelector = "b61d27f6"
+
+// decodeExecute reads the target, value and calldata of the call a smart
+// account's execute makes, if callData is one
+func decodeExecute(callData string) (target string, value *big.Int, data string, ok bool) {
+	args := strings.ToLower(strings.TrimPrefix(callData, "0x"))
+	if len(args) < 8+3*64 || args[:8] != executeSelector {
+		return "", nil, "", false
+	}
+	args = args[8:]
+	word := func(at int) (*big.Int, bool) {
+		if at < 0 || at+64 > len(args) {
+			return nil, false
+		}
+		return new(big.Int).SetString(args[at:at+64], 16)
+	}
+	if strings.Trim(args[:24], "0") != "" {
+		return "", nil, "", false
+	}
+	value, ok = word(64)
+	offset, ok2 := word(128)
+	if !ok || !ok2 || !offset.IsInt64() || offset.Int64() > int64(len(args)) {
+		return "", nil, "", false
+	}
+	start := int(offset.Int64()) * 2
+	length, ok := word(start)
+	if !ok || !length.IsInt64() || length.Int64() > int64(len(args)) || start+64+int(length.Int64())*2 > len(args) {
+		return "", nil, "", false
+	}
+	return "0x" + args[24:64], value, "0x" + args[start+64:start+64+int(length.Int64())*2], true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/arithmosquillsworth/x402-service/internal/testhttp"
+)
+
+func TestUserOperationPreflight(t *testing.T) {
+	up := testhttp.New(t)
+	previous := upstreamLimiter.next
+	upstreamLimiter.next = up.Transport()
+	t.Cleanup(func() { upstreamLimiter.next = previous })
+
+	simulator := NewTxSimulator(up.RPC.URL)
+	preflight := func(op UserOperation, entryPoint string) *TxPreflightResult {
+		t.Helper()
+		result, err := simulator.Simulate(&TxPreflightRequest{UserOperation: &op, EntryPoint: entryPoint})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	hasMessage := func(list []string, substr string) bool {
+		for _, s := range list {
+			if strings.Contains(s, substr) {
+				return true
+			}
+		}
+		return false
+	}
+	sender := "0x120e011fB8a12bfcB61e5c1d751C26A5D33Aae91"
+	paymaster := "0x00000000000000000000000000000000000000aa"
+
+	// Deployed account, no bundler: the execution is simulated with eth_call
+	up.SetRPCResult("eth_getCode", "0x6080")
+	result := preflight(UserOperation{Sender: sender, CallData: "0x"}, "")
+	if !result.Safe || !result.SimulationSuccess || result.RiskScore != 0 {
+		t.Errorf("plain operation = %+v", result)
+	}
+	result = preflight(UserOperation{Sender: sender, Factory: paymaster}, "")
+	if !hasMessage(result.Errors, "already deployed") {
+		t.Errorf("factory for a deployed account = %+v", result)
+	}
+	if result := preflight(UserOperation{Sender: sender}, "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"); result.Safe || !hasMessage(result.Warnings, "Unknown EntryPoint") {
+		t.Errorf("v0.6 EntryPoint = %+v", result)
+	}
+
+	// Undeployed addresses: a paymaster without code cannot validate
+	up.SetRPCResult("eth_getCode", "0x")
+	result = preflight(UserOperation{Sender: sender, Paymaster: paymaster}, "")
+	if result.Safe || !hasMessage(result.Warnings, "Paymaster has no code") || !hasMessage(result.Errors, "no factory") || result.SimulationSuccess {
+		t.Errorf("codeless paymaster = %+v", result)
+	}
+	if result := preflight(UserOperation{Sender: "0x12"}, ""); result.RiskScore != 100 || len(result.Errors) != 1 {
+		t.Errorf("bad sender = %+v", result)
+	}
+
+	// With a bundler the whole operation is simulated
+	up.SetRPCResult("eth_getCode", "0x6080")
+	up.SetRPCResult("eth_estimateUserOperationGas", map[string]string{
+		"preVerificationGas":   "0xc350",  // 50000
+		"verificationGasLimit": "0x186a0", // 100000
+		"callGasLimit":         "0x13880", // 80000
+	})
+	simulator.SetBundler(up.RPC.URL)
+	result = preflight(UserOperation{Sender: sender, CallData: "0x"}, "")
+	if !result.SimulationSuccess || result.GasEstimate != "230000" || result.UserOperationGas == nil || result.UserOperationGas.CallGasLimit != 80000 {
+		t.Errorf("bundler simulation = %+v", result)
+	}
+}
+
+// executeCall encodes execute(target, value, data) for a smart account
+func executeCall(target string, value int64, data string) string {
+	data = strings.TrimPrefix(data, "0x")
+	padded := data + strings.Repeat("0", (64-len(data)%64)%64)
+	return "0x" + executeSelector + fmt.Sprintf("%064s%064x%064x%064x", strings.TrimPrefix(target, "0x"), value, 96, len(data)/2) + padded
+}
+
+func TestDecodeExecute(t *testing.T) {
+	target, value, data, ok := decodeExecute(executeCall("0x7a250d5630b4cf539739df2c5dacb4c659f2488d", 5, "0xa9059cbb0102"))
+	if !ok || target != "0x7a250d5630b4cf539739df2c5dacb4c659f2488d" || value.Int64() != 5 || data != "0xa9059cbb0102" {
+		t.Errorf("decodeExecute = %s %v %s %v", target, value, data, ok)
+	}
+	for _, callData := range []string{
+		"0x",
+		"0xa9059cbb" + strings.Repeat("0", 192),
+		"0x" + executeSelector + strings.Repeat("f", 192),                                     // target wider than an address
+		executeCall("0x7a250d5630b4cf539739df2c5dacb4c659f2488d", 0, "0xa9059cbb")[:2+8+64*4], // bytes cut off
+	} {
+		if _, _, _, ok := decodeExecute(callData); ok {
+			t.Errorf("decoded %s", callData)
+		}
+	}
+}
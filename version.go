@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Build metadata, injected at build time:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildInfo identifies the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// buildInfo is resolved once at startup. Without ldflags the commit and
+// date fall back to the VCS stamp the go tool embeds in the binary.
+var buildInfo = resolveBuildInfo()
+
+func resolveBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// handleVersion serves the build metadata and enabled feature flags (free)
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		BuildInfo
+		Flags []string `json:"feature_flags"`
+	}{buildInfo, featureFlags.EnabledSet()})
+}
+
+// WriteBuildInfo writes the x402_build_info metric
+func WriteBuildInfo(b *strings.Builder) {
+	b.WriteString("# HELP x402_build_info Build metadata of the running binary\n")
+	b.WriteString("# TYPE x402_build_info gauge\n")
+	fmt.Fprintf(b, "x402_build_info{version=%q,commit=%q,build_date=%q,go_version=%q} 1\n",
+		buildInfo.Version, buildInfo.Commit, buildInfo.BuildDate, buildInfo.GoVersion)
+}
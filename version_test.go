@@ -0,0 +1,18 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildInfoMetric(t *testing.T) {
+	if buildInfo.Version == "" || buildInfo.Commit == "" || buildInfo.BuildDate == "" {
+		t.Fatalf("build info has empty fields: %+v", buildInfo)
+	}
+
+	var b strings.Builder
+	WriteBuildInfo(&b)
+	if !strings.Contains(b.String(), `x402_build_info{version="`+buildInfo.Version+`"`) {
+		t.Errorf("unexpected metric output:\n%s", b.String())
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+)
+
+// maxWatchListAddresses caps each of a payer's allow and deny lists
+const maxWatchListAddresses = 1000
+
+// watchListSignatureAge is how far a signed watch list upload's signed_at
+// may be from now
+const watchListSignatureAge = 5 * time.Minute
+
+// WatchList is a payer's own policy on who their transactions may touch.
+// A non-empty Allow list is the only addresses they interact with; Deny
+// addresses are refused even if allowed.
+type WatchList struct {
+	Allow     []string `json:"allow"`
+	Deny      []string `json:"deny"`
+	SignedAt  int64    `json:"signed_at,omitempty"` // of the last upload by the payer
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+// violation is why addr breaks the list, or "" if it does not
+func (l *WatchList) violation(addr string) string {
+	addr = strings.ToLower(addr)
+	switch {
+	case containsAddress(l.Deny, addr):
+		return "is on your deny list"
+	case len(l.Allow) > 0 && !containsAddress(l.Allow, addr):
+		return "is not on your allow list"
+	}
+	return ""
+}
+
+func containsAddress(list []string, addr string) bool {
+	i := sort.SearchStrings(list, addr)
+	return i < len(list) && list[i] == addr
+}
+
+// normalize validates both lists and leaves them lowercased, sorted and
+// without repeats
+func (l *WatchList) normalize() error {
+	var err error
+	if l.Allow, err = normalizeAddresses("allow", l.Allow); err != nil {
+		return err
+	}
+	l.Deny, err = normalizeAddresses("deny", l.Deny)
+	return err
+}
+
+// normalizeAddresses validates list and returns it lowercased, sorted and
+// without repeats
+func normalizeAddresses(name string, list []string) ([]string, error) {
+	if len(list) > maxWatchListAddresses {
+		return nil, fmt.Errorf("%s list has %d addresses, at most %d are allowed", name, len(list), maxWatchListAddresses)
+	}
+	seen := make(map[string]bool, len(list))
+	out := []string{}
+	for _, addr := range list {
+		addr = strings.TrimSpace(addr)
+		if !isValidAddress(addr) {
+			return nil, fmt.Errorf("%s list: invalid address %q", name, addr)
+		}
+		if addr = strings.ToLower(addr); !seen[addr] {
+			seen[addr] = true
+			out = append(out, addr)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// WatchLists holds every payer's watch list, persisted to
+// DATA_DIR/watchlists.json. Preflight and MEV checks consult the list of
+// the payer who paid for them.
+type WatchLists struct {
+	path  string
+	clock clock.Clock
+
+	mu         sync.RWMutex
+	lists      map[string]*WatchList // by lowercase payer address
+	violations map[string]int64      // by check
+}
+
+// watchLists is nil until newService loads it
+var watchLists *WatchLists
+
+// NewWatchLists loads the watch lists saved in dataDir
+func NewWatchLists(dataDir string) (*WatchLists, error) {
+	w := &WatchLists{
+		path:       filepath.Join(dataDir, "watchlists.json"),
+		clock:      clock.System,
+		lists:      make(map[string]*WatchList),
+		violations: make(map[string]int64),
+	}
+	data, err := os.ReadFile(w.path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &w.lists); err != nil {
+		return nil, fmt.Errorf("%s: %w", w.path, err)
+	}
+	return w, nil
+}
+
+// Get returns payer's watch list
+func (w *WatchLists) Get(payer string) (WatchList, bool) {
+	if w == nil {
+		return WatchList{}, false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	l, ok := w.lists[strings.ToLower(payer)]
+	if !ok {
+		return WatchList{}, false
+	}
+	return *l, true
+}
+
+// Set validates list and replaces payer's watch list with it
+func (w *WatchLists) Set(payer string, list WatchList) (WatchList, error) {
+	if err := list.normalize(); err != nil {
+		return WatchList{}, err
+	}
+	list.UpdatedAt = w.clock.Now().Unix()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	payer = strings.ToLower(payer)
+	previous, existed := w.lists[payer]
+	w.lists[payer] = &list
+	if err := writeJSONFile(w.path, w.lists); err != nil {
+		if existed {
+			w.lists[payer] = previous
+		} else {
+			delete(w.lists, payer)
+		}
+		return WatchList{}, err
+	}
+	return list, nil
+}
+
+// Delete removes payer's watch list, reporting whether there was one
+func (w *WatchLists) Delete(payer string) (bool, error) {
+	if w == nil {
+		return false, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	payer = strings.ToLower(payer)
+	if _, ok := w.lists[payer]; !ok {
+		return false, nil
+	}
+	delete(w.lists, payer)
+	return true, writeJSONFile(w.path, w.lists)
+}
+
+// check returns the ways the addresses a call touches, as role and address
+// pairs, break the watch list of the payer in ctx. Empty addresses are
+// skipped.
+func (w *WatchLists) check(ctx context.Context, check string, touched [][2]string) []string {
+	payer, ok := PayerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	list, ok := w.Get(payer.Address)
+	if !ok {
+		return nil
+	}
+	var violations []string
+	for _, t := range touched {
+		if t[1] == "" {
+			continue
+		}
+		if v := list.violation(t[1]); v != "" {
+			violations = append(violations, fmt.Sprintf("%s %s %s", t[0], t[1], v))
+		}
+	}
+	if len(violations) > 0 {
+		w.mu.Lock()
+		w.violations[check]++
+		w.mu.Unlock()
+	}
+	return violations
+}
+
+// checkPreflight marks a preflight result unsafe if the transaction
+// touches an address the payer's watch list rules out: its target, an
+// approved spender, or a user operation's factory, paymaster or executed
+// call target
+func (w *WatchLists) checkPreflight(ctx context.Context, tx *TxPreflightRequest, result *TxPreflightResult) {
+	touched := [][2]string{{"Target", tx.To}, {"Approved spender", approveSpender(tx.Data)}}
+	if op := tx.UserOperation; op != nil {
+		touched = [][2]string{{"Factory", op.Factory}, {"Paymaster", op.Paymaster}, {"Call target", executeTarget(op.CallData)}}
+	}
+	violations := w.check(ctx, "tx_preflight", touched)
+	if len(violations) == 0 {
+		return
+	}
+	result.Safe = false
+	result.RiskScore = 100
+	result.PolicyViolations = violations
+	result.Warnings = append(result.Warnings, violations...)
+	result.Recommendations = append(result.Recommendations, "Do not send - the transaction breaks your watch list")
+}
+
+// checkMEV marks an MEV check unsafe if the transaction's target or an
+// approved spender breaks the payer's watch list
+func (w *WatchLists) checkMEV(ctx context.Context, req MEVCheckRequest, result *MEVCheckResult) {
+	touched := [][2]string{{"Target", req.To}, {"Approved spender", approveSpender(req.Data)}}
+	violations := w.check(ctx, "mev_check", touched)
+	if len(violations) == 0 {
+		return
+	}
+	result.Safe = false
+	result.PolicyViolations = violations
+	result.RiskFactors = append(result.RiskFactors, "watch_list_violation")
+}
+
+// approveSpender returns the spender of an ERC-20 approve call, if data
+// is one
+func approveSpender(data string) string {
+	return addressArg(data, "095ea7b3")
+}
+
+// executeTarget returns the target of a smart account's
+// execute(address,uint256,bytes) call, if callData is one
+func executeTarget(callData string) string {
+	target, _, _, _ := decodeExecute(callData)
+	return target
+}
+
+// addressArg returns the first argument of a call to selector as an
+// address
+func addressArg(data, selector string) string {
+	data = strings.ToLower(strings.TrimPrefix(data, "0x"))
+	if len(data) < 8+64 || data[:8] != selector || strings.Trim(data[8:32], "0") != "" {
+		return ""
+	}
+	return "0x" + data[32:72]
+}
+
+// handleWatchList serves a payer's own watch list at /api/watchlist. The
+// request must be signed by the payer (X-Request-Signature, see
+// pkg/reqsig). GET returns the list; PUT replaces it, and its body's
+// signed_at must be within five minutes of now and newer than the last
+// upload's, so a captured upload cannot be replayed.
+func (w *WatchLists) handleWatchList(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(rw, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+	if err != nil || len(body) > maxRequestBytes {
+		http.Error(rw, `{"error":"Could not read body"}`, http.StatusBadRequest)
+		return
+	}
+	signature := r.Header.Get(reqsig.Header)
+	if signature == "" {
+		http.Error(rw, fmt.Sprintf(`{"error":%q}`, "Sign the request with the paying wallet in "+reqsig.Header), http.StatusUnauthorized)
+		return
+	}
+	payer, err := reqsig.Recover(signature, r.Method, r.URL.RequestURI(), body)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		list, _ := w.Get(payer)
+		json.NewEncoder(rw).Encode(map[string]interface{}{"payer": payer, "watch_list": list})
+		return
+	}
+	var list WatchList
+	if err := json.Unmarshal(body, &list); err != nil {
+		http.Error(rw, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	now := w.clock.Now()
+	if d := now.Sub(time.Unix(list.SignedAt, 0)); d > watchListSignatureAge || d < -watchListSignatureAge {
+		http.Error(rw, `{"error":"signed_at must be within five minutes of now"}`, http.StatusBadRequest)
+		return
+	}
+	if current, ok := w.Get(payer); ok && list.SignedAt <= current.SignedAt {
+		http.Error(rw, `{"error":"signed_at is not newer than the current list"}`, http.StatusConflict)
+		return
+	}
+	w.put(rw, payer, list)
+}
+
+// handleAdminWatchLists lists every payer with a watch list at
+// /admin/watchlists, and reads, replaces or deletes one at
+// /admin/watchlists/{payer}
+func (w *WatchLists) handleAdminWatchLists(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	payer := strings.ToLower(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/watchlists"), "/"))
+	if payer == "" {
+		if r.Method != http.MethodGet {
+			http.Error(rw, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		w.mu.RLock()
+		lists := make(map[string]WatchList, len(w.lists))
+		for p, l := range w.lists {
+			lists[p] = *l
+		}
+		w.mu.RUnlock()
+		json.NewEncoder(rw).Encode(map[string]interface{}{"watch_lists": lists})
+		return
+	}
+	if !isValidAddress(payer) {
+		http.Error(rw, `{"error":"Invalid payer address"}`, http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, ok := w.Get(payer)
+		if !ok {
+			http.Error(rw, `{"error":"No watch list for this payer"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{"payer": payer, "watch_list": list})
+	case http.MethodPut:
+		var list WatchList
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBytes)).Decode(&list); err != nil {
+			http.Error(rw, `{"error":"Invalid JSON"}`, http.StatusBadRequest)
+			return
+		}
+		current, _ := w.Get(payer)
+		list.SignedAt = current.SignedAt
+		w.put(rw, payer, list)
+	case http.MethodDelete:
+		ok, err := w.Delete(payer)
+		if err != nil {
+			http.Error(rw, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(rw, `{"error":"No watch list for this payer"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("🗑️  Watch list of %s deleted", payer)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(rw, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// put stores payer's list and answers with it
+func (w *WatchLists) put(rw http.ResponseWriter, payer string, list WatchList) {
+	if err := list.normalize(); err != nil {
+		http.Error(rw, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	list, err := w.Set(payer, list)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf(`{"error":%q}`, "saving watch list: "+err.Error()), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("📋 Watch list of %s set: %d allowed, %d denied", payer, len(list.Allow), len(list.Deny))
+	json.NewEncoder(rw).Encode(map[string]interface{}{"payer": payer, "watch_list": list})
+}
+
+// WriteMetrics emits how many payers have watch lists and how often checks
+// found a violation
+func (w *WatchLists) WriteMetrics(b *strings.Builder) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	b.WriteString("# HELP x402_watch_lists Payers with a watch list\n")
+	b.WriteString("# TYPE x402_watch_lists gauge\n")
+	fmt.Fprintf(b, "x402_watch_lists %d\n", len(w.lists))
+	b.WriteString("# HELP x402_watch_list_violations_total Checks that found a watch list violation, by check\n")
+	b.WriteString("# TYPE x402_watch_list_violations_total counter\n")
+	for _, check := range sortedKeys(w.violations) {
+		fmt.Fprintf(b, "x402_watch_list_violations_total{check=%q} %d\n", check, w.violations[check])
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arithmosquillsworth/x402-service/pkg/clock"
+	"github.com/arithmosquillsworth/x402-service/pkg/ethsig"
+	"github.com/arithmosquillsworth/x402-service/pkg/reqsig"
+)
+
+const (
+	watchedRouter  = "0x7a250d5630b4cf539739df2c5dacb4c659f2488d"
+	watchedDrainer = "0x000000000000000000000000000000000000dead"
+)
+
+func TestWatchListChecks(t *testing.T) {
+	lists, err := NewWatchLists(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	payer := "0xabc0000000000000000000000000000000000001"
+	if _, err := lists.Set(payer, WatchList{Allow: []string{"0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"}, Deny: []string{watchedDrainer}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lists.Set(payer, WatchList{Allow: []string{"0x1234"}}); err == nil {
+		t.Error("invalid address accepted")
+	}
+	ctx := withPayer(context.Background(), Payer{Address: payer, Source: "sub"})
+
+	preflight := func(ctx context.Context, tx TxPreflightRequest) *TxPreflightResult {
+		result := &TxPreflightResult{Safe: true}
+		lists.checkPreflight(ctx, &tx, result)
+		return result
+	}
+	approve := "0x095ea7b3000000000000000000000000" + strings.TrimPrefix(watchedDrainer, "0x") + strings.Repeat("f", 64)
+	for _, tt := range []struct {
+		name       string
+		tx         TxPreflightRequest
+		violations int
+	}{
+		{"allowed target", TxPreflightRequest{To: watchedRouter}, 0},
+		{"unlisted target", TxPreflightRequest{To: "0x1111111111111111111111111111111111111111"}, 1},
+		{"denied spender", TxPreflightRequest{To: watchedRouter, Data: approve}, 1},
+		{"user operation call target", TxPreflightRequest{UserOperation: &UserOperation{
+			Sender:   "0x2222222222222222222222222222222222222222",
+			CallData: executeCall(watchedDrainer, 0, ""),
+		}}, 1},
+	} {
+		result := preflight(ctx, tt.tx)
+		if len(result.PolicyViolations) != tt.violations || result.Safe != (tt.violations == 0) {
+			t.Errorf("%s: safe=%v violations %v", tt.name, result.Safe, result.PolicyViolations)
+		}
+	}
+	if result := preflight(context.Background(), TxPreflightRequest{To: watchedDrainer}); !result.Safe {
+		t.Error("unpaid check consulted a watch list")
+	}
+
+	mev := MEVCheckResult{Safe: true}
+	lists.checkMEV(ctx, MEVCheckRequest{To: watchedDrainer}, &mev)
+	if mev.Safe || len(mev.PolicyViolations) != 1 || mev.PolicyViolations[0] != "Target "+watchedDrainer+" is on your deny list" {
+		t.Errorf("MEV check = %+v", mev)
+	}
+
+	var b strings.Builder
+	lists.WriteMetrics(&b)
+	if !strings.Contains(b.String(), `x402_watch_list_violations_total{check="tx_preflight"} 3`) || !strings.Contains(b.String(), "x402_watch_lists 1") {
+		t.Errorf("metrics:\n%s", b.String())
+	}
+}
+
+func TestWatchListSignedUpload(t *testing.T) {
+	dir := t.TempDir()
+	lists, err := NewWatchLists(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(epoch)
+	lists.clock = fake
+	key, _ := new(big.Int).SetString("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", 16)
+
+	call := func(method, body string, sign bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/watchlist", strings.NewReader(body))
+		if sign {
+			sig, err := ethsig.Sign(ethsig.PersonalHash(reqsig.Message(method, "/api/watchlist", reqsig.BodyHash([]byte(body)))), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(reqsig.Header, "0x"+hex.EncodeToString(sig))
+		}
+		rr := httptest.NewRecorder()
+		lists.handleWatchList(rr, req)
+		return rr
+	}
+
+	upload := fmt.Sprintf(`{"allow":[%q],"signed_at":%d}`, watchedRouter, epoch.Unix())
+	if rr := call("PUT", upload, false); rr.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned upload returned %d", rr.Code)
+	}
+	if rr := call("PUT", upload, true); rr.Code != http.StatusOK {
+		t.Fatalf("signed upload returned %d: %s", rr.Code, rr.Body)
+	}
+	if rr := call("PUT", upload, true); rr.Code != http.StatusConflict {
+		t.Errorf("replayed upload returned %d, want 409", rr.Code)
+	}
+	fake.Advance(10 * time.Minute)
+	if rr := call("PUT", fmt.Sprintf(`{"deny":[],"signed_at":%d}`, epoch.Unix()+1), true); rr.Code != http.StatusBadRequest {
+		t.Errorf("stale upload returned %d, want 400", rr.Code)
+	}
+
+	// The list is the signer's, and survives a restart
+	reloaded, err := NewWatchLists(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, ok := reloaded.Get(ethsig.Address(key))
+	if !ok || len(list.Allow) != 1 || list.Allow[0] != watchedRouter {
+		t.Errorf("reloaded list = %+v, %v", list, ok)
+	}
+	rr := call("GET", "", true)
+	var got struct {
+		Payer     string    `json:"payer"`
+		WatchList WatchList `json:"watch_list"`
+	}
+	json.NewDecoder(rr.Body).Decode(&got)
+	if rr.Code != http.StatusOK || got.Payer != strings.ToLower(ethsig.Address(key)) || len(got.WatchList.Allow) != 1 {
+		t.Errorf("GET returned %d %+v", rr.Code, got)
+	}
+}
+
+func TestE2EWatchListPreflight(t *testing.T) {
+	srv, _ := startService(t, nil)
+	payer := "0xabc0000000000000000000000000000000000001" // pay() names it in sub
+
+	req, _ := http.NewRequest("PUT", srv.URL+"/admin/watchlists/"+payer, strings.NewReader(fmt.Sprintf(`{"allow":[%q]}`, watchedRouter)))
+	req.Header.Set("Authorization", "Bearer "+e2eAdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("admin PUT returned %d", resp.StatusCode)
+	}
+
+	resp = paidRequest(t, srv, "POST", "/api/tx-preflight", `{"from":"0x742d35cc6634c0532925a3b844bc454e4438f44e","to":"0x1111111111111111111111111111111111111111","value":"0"}`)
+	defer resp.Body.Close()
+	var body struct {
+		Data TxPreflightResult `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || body.Data.Safe || len(body.Data.PolicyViolations) != 1 {
+		t.Errorf("preflight to an unlisted contract returned %d %+v", resp.StatusCode, body.Data)
+	}
+}